@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	//"log"
 	"bufio"
 	"net/http"
@@ -19,17 +20,21 @@ import (
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 )
 
-func NewTLSConfig(certFile string, keyFile string) (*tls.Config, string) {
-	// Import trusted certificates from CAfile.pem.
-	// Alternatively, manually add CA certificates to
-	// default openssl CA bundle.
-	/*
-	   certpool := x509.NewCertPool()
-	   pemCerts, err := ioutil.ReadFile("samplecerts/CAfile.pem")
-	   if err == nil {
-	       certpool.AppendCertsFromPEM(pemCerts)
-	   }
-	*/
+func NewTLSConfig(certFile string, keyFile string, caFile string, skipVerify bool) (*tls.Config, string) {
+	// Import trusted certificates from the CA file.  If a CA file is not
+	// provided, the system's CA bundle is used to verify the broker's cert.
+	var certpool *x509.CertPool
+	if caFile != "" {
+		pemCerts, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			panic(err)
+		}
+
+		certpool = x509.NewCertPool()
+		if certpool.AppendCertsFromPEM(pemCerts) == false {
+			panic("Unable to load any certificates from the CA file: " + caFile)
+		}
+	}
 
 	// Import client certificate/key pair
 	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
@@ -47,7 +52,7 @@ func NewTLSConfig(certFile string, keyFile string) (*tls.Config, string) {
 
 	tlsConfig := &tls.Config{
 		// RootCAs = certs used to verify server cert.
-		//RootCAs: certpool,
+		RootCAs: certpool,
 		// ClientAuth = whether to request cert from server.
 		// Since the server is set up for SSL, this happens
 		// anyways.
@@ -56,7 +61,7 @@ func NewTLSConfig(certFile string, keyFile string) (*tls.Config, string) {
 		//ClientCAs: nil,
 		// InsecureSkipVerify = verify that cert contents
 		// match server. IP matches what is in cert etc.
-		InsecureSkipVerify: true,
+		InsecureSkipVerify: skipVerify,
 		// Certificates = list of certs client sends to server.
 		Certificates: []tls.Certificate{cert},
 	}
@@ -78,13 +83,15 @@ func main() {
 	broker := flag.String("broker", "tcp://eclipse-mosquitto:1883", "hostname / port of broker")
 	certFile := flag.String("cert", "cert.pem", "path to cert file")
 	keyFile := flag.String("key", "key.pem", "path to key file")
+	caFile := flag.String("ca", "", "path to CA bundle used to verify the broker's cert")
+	skipVerify := flag.Bool("skip-verify", false, "skip verification of the broker's cert")
 	flag.Parse()
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
 	for i := 0; i < *connectionCount; i++ {
-		go startProducer(*certFile, *keyFile, *broker, i)
+		go startProducer(*certFile, *keyFile, *caFile, *skipVerify, *broker, i)
 	}
 
 	<-c
@@ -95,8 +102,8 @@ var m MQTT.MessageHandler = func(client MQTT.Client, msg MQTT.Message) {
 	fmt.Printf("default handler rec TOPIC: %s MSG:%s\n", msg.Topic(), msg.Payload())
 }
 
-func startProducer(certFile string, keyFile string, broker string, i int) {
-	tlsconfig, clientID := NewTLSConfig(certFile, keyFile)
+func startProducer(certFile string, keyFile string, caFile string, skipVerify bool, broker string, i int) {
+	tlsconfig, clientID := NewTLSConfig(certFile, keyFile, caFile, skipVerify)
 
 	controlReadTopic := fmt.Sprintf("redhat/insights/%s/control/in", clientID)
 	controlWriteTopic := fmt.Sprintf("redhat/insights/%s/control/out", clientID)
@@ -148,6 +155,10 @@ func startProducer(certFile string, keyFile string, broker string, i int) {
 		if token := c.Subscribe(controlReadTopic, 0, onMessageReceived); token.Wait() && token.Error() != nil {
 			panic(token.Error())
 		}
+		fmt.Println("*** OnConnect - subscribing to topic:", Connector.BROADCAST_CONTROL_TOPIC)
+		if token := c.Subscribe(Connector.BROADCAST_CONTROL_TOPIC, 0, onMessageReceived); token.Wait() && token.Error() != nil {
+			panic(token.Error())
+		}
 	}
 
 	client := MQTT.NewClient(connOpts)
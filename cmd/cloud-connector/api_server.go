@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller/api"
+	"github.com/RedHatInsights/cloud-connector/internal/mqtt"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/utils"
+	"github.com/redhatinsights/platform-go-middlewares/request_id"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// startCloudConnectorApiServer starts a service that connects to the broker purely to
+// publish commands to the clients.  It does not subscribe to any topics.
+func startCloudConnectorApiServer(mgmtAddr string, broker string, certFile string, keyFile string) {
+
+	logger.Log.Info("Starting Cloud-Connector API server")
+
+	cfg := config.GetConfig()
+
+	if err := logger.Configure(cfg.LogFormat, cfg.LogLevel); err != nil {
+		logger.Log.Fatal("Unable to configure the logger: ", err)
+	}
+
+	logger.Log.Info("Cloud-Connector configuration:\n", cfg)
+
+	err := verifyConfiguration(cfg, broker, certFile, keyFile)
+	if err != nil {
+		logger.Log.Fatal("Configuration error encountered during startup: ", err)
+	}
+
+	err = mqtt.VerifyTimestampFormat(cfg.ControlMessageTimestampFormat)
+	if err != nil {
+		logger.Log.Fatal("Invalid control message timestamp format: ", err)
+	}
+
+	messageSigner, err := mqtt.NewMessageSigner(cfg.ControlMessageSigning, cfg.ControlMessageSigningKeyFile)
+	if err != nil {
+		logger.Log.Fatal("Unable to configure control message signing: ", err)
+	}
+
+	mqttMetrics := mqtt.NewMetrics(prometheus.DefaultRegisterer)
+
+	tlsConfig, err := newBrokerTlsConfig(cfg, certFile, keyFile)
+	if err != nil {
+		logger.Log.Fatal("Unable to configure TLS for the MQTT broker connection: ", err)
+	}
+
+	shutdownCtx, stopListeningForShutdown := newShutdownContext()
+	defer stopListeningForShutdown()
+
+	mqttClient, err := mqtt.NewPublishOnlyConnection(shutdownCtx, cfg, mqtt.ParseBrokerUrls(broker), tlsConfig, mqttMetrics)
+	if err != nil && shutdownCtx.Err() != nil {
+		logger.Log.Info("Shutdown requested before connecting to the MQTT broker")
+		return
+	} else if err != nil {
+		logger.Log.Fatal("Failed to connect to MQTT broker: ", err)
+	}
+
+	apiMux := mux.NewRouter()
+	apiMux.Use(request_id.ConfiguredRequestID("x-rh-insights-request-id"))
+
+	brokerConnectivity := mqtt.NewBrokerConnectivityChecker(mqttClient, cfg.MqttConnectivityCheckInterval)
+	brokerConnectivity.Start()
+	defer brokerConnectivity.Stop()
+
+	monitoringServer := api.NewMonitoringServer(nil, apiMux, cfg)
+	monitoringServer.AddReadinessCheck("mqtt_broker", brokerConnectivity.Ready)
+	monitoringServer.Routes()
+
+	controlMessageSender := mqtt.NewControlMessageSender(mqttClient, mqtt.NewTopicBuilder(),
+		mqtt.WithSyncDelivery(cfg.MqttReconnectMessageQos, cfg.MqttPublishAckTimeout),
+		mqtt.WithMessageSigner(messageSigner),
+		mqtt.WithTimestampFormat(cfg.ControlMessageTimestampFormat))
+	reconnectServer := api.NewReconnectServer(controlMessageSender, apiMux, cfg)
+	reconnectServer.Routes()
+
+	apiSrv := utils.StartHTTPServer(mgmtAddr, "management", apiMux)
+
+	<-shutdownCtx.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HttpShutdownTimeout)
+	defer cancel()
+
+	utils.ShutdownHTTPServer(ctx, "management", apiSrv)
+
+	mqttClient.Disconnect(250)
+
+	logger.Log.Info("Cloud-Connector API server shutting down")
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/mqtt"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/queue"
+	"github.com/RedHatInsights/cloud-connector/internal/tls_utils"
+)
+
+const (
+	MQTT_MESSAGE_CONSUMER = "mqtt_message_consumer"
+	API_SERVER            = "api_server"
+	SEND_MESSAGE          = "send-message"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s <%s|%s|%s> [flags]\n", os.Args[0], MQTT_MESSAGE_CONSUMER, API_SERVER, SEND_MESSAGE)
+	os.Exit(1)
+}
+
+// verifyConfiguration checks the configuration and the command line options before
+// anything is started so that a misconfigured deployment fails fast
+func verifyConfiguration(cfg *config.Config, broker string, certFile string, keyFile string) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	if err := verifyBrokerUrls(broker); err != nil {
+		return err
+	}
+
+	if certFile == "" || keyFile == "" {
+		return errors.New("Both the -cert and -key options are required to connect to the MQTT broker")
+	}
+
+	if _, err := queue.ParseRequiredAcks(cfg.KafkaRequiredAcks); err != nil {
+		return err
+	}
+
+	if err := mqtt.VerifyChunkSize(cfg.MqttDataMessageChunkSize, cfg.MqttBrokerMaxMessageSize); err != nil {
+		return err
+	}
+
+	if err := mqtt.VerifyQos(cfg.MqttReconnectMessageQos); err != nil {
+		return err
+	}
+
+	if err := mqtt.VerifyMessageSigning(cfg.ControlMessageSigning, cfg.ControlMessageRequireSignature); err != nil {
+		return err
+	}
+
+	if err := mqtt.VerifyReconnectDelayRange(cfg.ReconnectDelayMin, cfg.ReconnectDelayMax); err != nil {
+		return err
+	}
+
+	if err := mqtt.VerifyDuplicateConnectionHandling(cfg.DuplicateConnectionHandling); err != nil {
+		return err
+	}
+
+	if err := mqtt.VerifyFactsHashAlgorithm(cfg.FactsHashAlgorithm); err != nil {
+		return err
+	}
+
+	for _, version := range []string{cfg.SourcesIdentityHeaderVersion, cfg.InventoryIdentityHeaderVersion} {
+		if _, err := controller.NewIdentityHeaderBuilder(version); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func verifyBrokerUrls(broker string) error {
+	brokerUrls := mqtt.ParseBrokerUrls(broker)
+	if len(brokerUrls) == 0 {
+		return errors.New("At least one MQTT broker uri is required")
+	}
+
+	for _, brokerUrl := range brokerUrls {
+		if u, err := url.Parse(brokerUrl); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("Invalid MQTT broker uri (%s), expected scheme://host:port", brokerUrl)
+		}
+	}
+
+	return nil
+}
+
+func newBrokerTlsConfig(cfg *config.Config, certFile string, keyFile string) (*tls.Config, error) {
+	return tls_utils.NewTlsConfig(certFile, keyFile,
+		tls_utils.WithClientSessionCache(cfg.MqttBrokerTlsSessionCacheSize),
+		tls_utils.WithSessionTicketsDisabled(cfg.MqttBrokerTlsSessionTicketsDisabled),
+		tls_utils.WithRenegotiation(cfg.MqttBrokerTlsRenegotiation))
+}
+
+func main() {
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	subcommand := os.Args[1]
+
+	flags := flag.NewFlagSet(subcommand, flag.ExitOnError)
+	var mgmtAddr = flags.String("mgmtAddr", ":8081", "Hostname:port of the management server")
+	var broker = flags.String("broker", "ssl://localhost:8883", "uri of broker, or a comma separated list of broker uris to fail over between")
+	var certFile = flags.String("cert", "connector-service-cert.pem", "path to cert file")
+	var keyFile = flags.String("key", "connector-service-key.pem", "path to key file")
+	var clientID = flags.String("client-id", "", "id of the client to send the message to (send-message only)")
+	var directive = flags.String("directive", "", "directive of the message (send-message only)")
+	var payload = flags.String("payload", "", "payload of the message, or @file to read the payload from a file (send-message only)")
+
+	flags.Parse(os.Args[2:])
+
+	logger.InitLogger()
+
+	switch subcommand {
+	case MQTT_MESSAGE_CONSUMER:
+		startMqttMessageConsumer(*mgmtAddr, *broker, *certFile, *keyFile)
+	case API_SERVER:
+		startCloudConnectorApiServer(*mgmtAddr, *broker, *certFile, *keyFile)
+	case SEND_MESSAGE:
+		sendMessage(*broker, *certFile, *keyFile, *clientID, *directive, *payload)
+	default:
+		usage()
+	}
+}
+
+// newShutdownContext returns a context that is cancelled once the process is asked to
+// shut down (SIGINT or SIGTERM).  It is created before connecting to the broker so that
+// a shutdown request stops the connection attempts instead of waiting for them to
+// finish.  The returned func stops listening for the signals.
+func newShutdownContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signalChan := make(chan os.Signal, 1)
+
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-signalChan:
+			logger.Log.Info("Received signal to shutdown: ", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signalChan)
+		cancel()
+	}
+}
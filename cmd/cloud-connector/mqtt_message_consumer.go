@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/controller/api"
+	"github.com/RedHatInsights/cloud-connector/internal/mqtt"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/queue"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/utils"
+	"github.com/redhatinsights/platform-go-middlewares/request_id"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	kafka "github.com/segmentio/kafka-go"
+)
+
+func startMqttMessageConsumer(mgmtAddr string, broker string, certFile string, keyFile string) {
+
+	logger.Log.Info("Starting Cloud-Connector MQTT message consumer")
+
+	cfg := config.GetConfig()
+
+	if err := logger.Configure(cfg.LogFormat, cfg.LogLevel); err != nil {
+		logger.Log.Fatal("Unable to configure the logger: ", err)
+	}
+
+	logger.Log.Info("Receptor Controller configuration:\n", cfg)
+
+	err := verifyConfiguration(cfg, broker, certFile, keyFile)
+	if err != nil {
+		logger.Log.Fatal("Configuration error encountered during startup: ", err)
+	}
+
+	err = mqtt.VerifyTimestampFormat(cfg.ControlMessageTimestampFormat)
+	if err != nil {
+		logger.Log.Fatal("Invalid control message timestamp format: ", err)
+	}
+
+	messageSigner, err := mqtt.NewMessageSigner(cfg.ControlMessageSigning, cfg.ControlMessageSigningKeyFile)
+	if err != nil {
+		logger.Log.Fatal("Unable to configure control message signing: ", err)
+	}
+
+	mqttMetrics := mqtt.NewMetrics(prometheus.DefaultRegisterer)
+	controllerMetrics := controller.NewMetrics(prometheus.DefaultRegisterer)
+
+	messageSizeLimits, err := mqtt.NewMessageSizeLimits(cfg.MaxMessageSizeBytes, cfg.MaxMessageSizeBytesPerDirective, mqttMetrics)
+	if err != nil {
+		logger.Log.Fatal("Unable to configure the message size limits: ", err)
+	}
+
+	forwardingController, err := queue.NewForwardingController(cfg.KafkaPausedTopicMode, cfg.KafkaPausedTopicBufferSize)
+	if err != nil {
+		logger.Log.Fatal("Unable to create the kafka forwarding controller: ", err)
+	}
+
+	redisConfig := controller.RedisConfig{
+		Address:  cfg.RedisAddress,
+		Password: cfg.RedisPassword,
+		DB:       cfg.RedisDB,
+		TTL:      cfg.RedisConnectionTTL,
+	}
+
+	// The receptors publish with the MQTT client, which is connected after the connection
+	// manager has been created
+	receptorFactory := controller.NewDeferredReceptorFactory()
+
+	registrar, err := controller.NewConnectionManager(cfg.ConnectionRegistrarImpl, redisConfig, receptorFactory.Create, controllerMetrics)
+	if err != nil {
+		logger.Log.Fatal("Unable to create the connection registrar: ", err)
+	}
+
+	connectionManager := controller.NewInstrumentedConnectionManager(registrar, controllerMetrics)
+	lastErrors := controller.NewLastErrorTracker(cfg.LastErrorMaxClients, cfg.LastErrorTTL)
+	subscriptions := mqtt.NewSubscriptionTracker(mqttMetrics)
+	clientStates := mqtt.NewClientStateManager(lastErrors)
+
+	processedMessages, err := mqtt.NewProcessedMessageStore(cfg.ProcessedMessageStoreImpl, redisConfig, cfg.OnlineMessageDedupTTL)
+	if err != nil {
+		logger.Log.Fatal("Unable to create the processed message store: ", err)
+	}
+
+	accountResolver, err := controller.NewAccountIdResolver(cfg.ClientIdToAccountIdImpl, cfg.ClientIdToAccountIdCacheMaxSize, cfg.ClientIdToAccountIdCacheTTL, redisConfig, controllerMetrics)
+	if err != nil {
+		logger.Log.Fatal("Unable to create the account id resolver: ", err)
+	}
+
+	factsEnricher, err := controller.NewFactsEnricher(cfg.FactsEnricherImpl, cfg.StaticFacts)
+	if err != nil {
+		logger.Log.Fatal("Unable to create the facts enricher: ", err)
+	}
+
+	sourcesRecorder, err := controller.NewSourcesRecorder(cfg.SourcesRecorderImpl,
+		controller.HttpSourcesConfig{
+			BaseURL:    cfg.SourcesBaseUrl,
+			Timeout:    cfg.SourcesHttpTimeout,
+			MaxRetries: cfg.SourcesHttpMaxRetries,
+			RetryDelay: cfg.SourcesHttpRetryDelay,
+		}, controllerMetrics)
+	if err != nil {
+		logger.Log.Fatal("Unable to create the sources recorder: ", err)
+	}
+
+	tlsConfig, err := newBrokerTlsConfig(cfg, certFile, keyFile)
+	if err != nil {
+		logger.Log.Fatal("Unable to configure TLS for the MQTT broker connection: ", err)
+	}
+
+	requiredAcks, err := queue.ParseRequiredAcks(cfg.KafkaRequiredAcks)
+	if err != nil {
+		logger.Log.Fatal("Unable to configure the kafka producer: ", err)
+	}
+
+	startProducer := func(topic string) *queue.Producer {
+		return queue.StartProducer(&queue.ProducerConfig{
+			Brokers:          cfg.KafkaBrokers,
+			Topic:            topic,
+			BatchSize:        cfg.KafkaResponsesBatchSize,
+			BatchBytes:       cfg.KafkaResponsesBatchBytes,
+			RequiredAcks:     requiredAcks,
+			LogWriteOutcomes: cfg.KafkaLogWriteOutcomes,
+		})
+	}
+
+	var deadLetterWriter queue.Writer
+	if cfg.UnverifiableTopicHandling == mqtt.UnverifiableTopicHandlingDeadLetter {
+		deadLetterProducer := startProducer(cfg.KafkaDeadLetterTopic)
+		defer deadLetterProducer.Close()
+
+		asyncDeadLetterWriter, stopAsyncDeadLetterWriter := startAsyncKafkaWriter(cfg, forwardingController.Writer(cfg.KafkaDeadLetterTopic, deadLetterProducer))
+		defer stopAsyncDeadLetterWriter()
+
+		deadLetterWriter = asyncDeadLetterWriter
+	}
+
+	var clientEventWriter queue.Writer
+	if cfg.ClientEventForwarding {
+		clientEventProducer := startProducer(cfg.KafkaClientEventsTopic)
+		defer clientEventProducer.Close()
+
+		asyncClientEventWriter, stopAsyncClientEventWriter := startAsyncKafkaWriter(cfg, forwardingController.Writer(cfg.KafkaClientEventsTopic, clientEventProducer))
+		defer stopAsyncClientEventWriter()
+
+		clientEventWriter = asyncClientEventWriter
+
+		if cfg.KafkaCompressMessageValues {
+			clientEventWriter = queue.NewCompressingWriter(clientEventWriter, cfg.KafkaCompressionThreshold)
+		}
+	}
+
+	var inventoryWriter queue.Writer
+	if cfg.InventoryRegisterHosts || cfg.InventoryDeleteEphemeralHosts {
+		inventoryProducer := startProducer(cfg.KafkaInventoryTopic)
+		defer inventoryProducer.Close()
+
+		asyncInventoryWriter, stopAsyncInventoryWriter := startAsyncKafkaWriter(cfg, forwardingController.Writer(cfg.KafkaInventoryTopic, inventoryProducer))
+		defer stopAsyncInventoryWriter()
+
+		inventoryWriter = asyncInventoryWriter
+	}
+
+	// Delivery confirmations are disabled while the confirmer is nil
+	var deliveryConfirmer *mqtt.DeliveryConfirmer
+
+	if cfg.DataMessageDeliveryConfirmation {
+		deliveryConfirmationProducer := startProducer(cfg.KafkaDeliveryConfirmationTopic)
+		defer deliveryConfirmationProducer.Close()
+
+		asyncDeliveryConfirmationWriter, stopAsyncDeliveryConfirmationWriter := startAsyncKafkaWriter(cfg, forwardingController.Writer(cfg.KafkaDeliveryConfirmationTopic, deliveryConfirmationProducer))
+		defer stopAsyncDeliveryConfirmationWriter()
+
+		deliveryConfirmer = mqtt.NewDeliveryConfirmer(asyncDeliveryConfirmationWriter, cfg.ControlMessageTimestampFormat, mqttMetrics)
+	}
+
+	unverifiableTopicHandler, err := mqtt.NewUnverifiableTopicHandler(cfg.UnverifiableTopicHandling, deadLetterWriter, mqttMetrics)
+	if err != nil {
+		logger.Log.Fatal("Unable to create the unverifiable topic handler: ", err)
+	}
+
+	eventPublisher, err := controller.NewConnectionEventPublisher(cfg.ConnectionEventPublisherImpl,
+		controller.WebhookConfig{
+			URL:        cfg.ConnectionEventWebhookUrl,
+			Secret:     cfg.ConnectionEventWebhookSecret,
+			QueueSize:  cfg.ConnectionEventWebhookQueueSize,
+			MaxRetries: cfg.ConnectionEventWebhookMaxRetries,
+			RetryDelay: cfg.ConnectionEventWebhookRetryDelay,
+			Timeout:    cfg.ConnectionEventWebhookTimeout,
+		}, controllerMetrics)
+	if err != nil {
+		logger.Log.Fatal("Unable to create the connection event publisher: ", err)
+	}
+
+	// The publisher is closed after everything that publishes events has been stopped
+	// so that the queued events are delivered before exiting
+	if closer, ok := eventPublisher.(interface{ Close() }); ok {
+		defer closer.Close()
+	}
+
+	inFlightMessages := mqtt.NewInFlightMessageTracker()
+
+	pongs := mqtt.NewPongTracker()
+
+	disconnects := mqtt.NewDisconnectHandler()
+
+	shutdownCtx, stopListeningForShutdown := newShutdownContext()
+	defer stopListeningForShutdown()
+
+	mqttClient, err := mqtt.NewConnectionRegistrar(shutdownCtx, cfg, mqtt.ParseBrokerUrls(broker), tlsConfig, mqtt.ConnectionRegistrarDeps{
+		ConnectionRegistrar:      connectionManager,
+		AccountResolver:          accountResolver,
+		FactsEnricher:            factsEnricher,
+		SourcesRecorder:          sourcesRecorder,
+		LastErrors:               lastErrors,
+		Subscriptions:            subscriptions,
+		ClientStates:             clientStates,
+		ProcessedMessages:        processedMessages,
+		InFlight:                 inFlightMessages,
+		UnverifiableTopicHandler: unverifiableTopicHandler,
+		EventPublisher:           eventPublisher,
+		EventForwarder:           mqtt.NewEventForwarder(clientEventWriter, mqttMetrics),
+		InventoryKafkaWriter:     inventoryWriter,
+		Pongs:                    pongs,
+		Disconnects:              disconnects,
+		Signer:                   messageSigner,
+		Confirmer:                deliveryConfirmer,
+		SizeLimits:               messageSizeLimits,
+	}, mqttMetrics)
+	if err != nil && shutdownCtx.Err() != nil {
+		logger.Log.Info("Shutdown requested before connecting to the MQTT broker")
+		return
+	} else if err != nil {
+		logger.Log.Fatal("Failed to connect to MQTT broker: ", err)
+	}
+
+	proxyFactory := mqtt.NewReceptorMQTTProxyFactory(mqttClient, cfg.MqttDataMessageChunkSize, messageSigner, cfg.ControlMessageTimestampFormat, deliveryConfirmer, messageSizeLimits)
+	receptorFactory.Attach(proxyFactory)
+
+	apiMux := mux.NewRouter()
+	apiMux.Use(request_id.ConfiguredRequestID("x-rh-insights-request-id"))
+
+	brokerConnectivity := mqtt.NewBrokerConnectivityChecker(mqttClient, cfg.MqttConnectivityCheckInterval)
+	brokerConnectivity.Start()
+	defer brokerConnectivity.Stop()
+
+	monitoringServer := api.NewMonitoringServer(connectionManager, apiMux, cfg)
+	monitoringServer.AddReadinessCheck("mqtt_broker", brokerConnectivity.Ready)
+
+	clientCounter := controller.NewClientCounter(connectionManager, cfg.ClientCountCacheInterval, controllerMetrics)
+	clientCounter.Start()
+	defer clientCounter.Stop()
+
+	monitoringServer.SetClientCounter(clientCounter)
+	monitoringServer.Routes()
+
+	mgmtServer := api.NewManagementServer(connectionManager, lastErrors, apiMux, cfg)
+	mgmtServer.Routes()
+
+	jr := api.NewMessageReceiver(connectionManager, apiMux, cfg)
+	jr.Routes()
+
+	forwardingServer := api.NewForwardingServer(forwardingController, apiMux, cfg)
+	forwardingServer.Routes()
+
+	connectionImportServer := api.NewConnectionImportServer(connectionManager, proxyFactory, apiMux, cfg)
+	connectionImportServer.Routes()
+
+	subscriptionServer := api.NewSubscriptionServer(subscriptions, apiMux, cfg)
+	subscriptionServer.Routes()
+
+	clientStateServer := api.NewClientStateServer(clientStates, apiMux, cfg)
+	clientStateServer.Routes()
+
+	connectionQueryServer := api.NewConnectionQueryServer(connectionManager, apiMux, cfg)
+	connectionQueryServer.Routes()
+
+	// The commands and directives are sent to any client unless the clients are required
+	// to advertise support for them
+	var capabilities *mqtt.CapabilityGate
+	if cfg.RequireCommandCapability {
+		capabilities = mqtt.NewCapabilityGate(connectionManager)
+	}
+
+	dataMessageSender := mqtt.NewDataMessageSender(mqttClient, mqtt.NewTopicBuilder(), cfg.MqttDataMessageChunkSize,
+		mqtt.WithDeliveryConfirmer(deliveryConfirmer), mqtt.WithMessageSizeLimits(messageSizeLimits),
+		mqtt.WithDataMessageCapabilityGate(capabilities))
+
+	clientMessageServer := api.NewClientMessageServer(dataMessageSender, connectionManager, apiMux, cfg)
+	clientMessageServer.Routes()
+
+	// The workers that publish to the broker are stopped before the MQTT client is shut
+	// down.  Otherwise they would keep publishing on a disconnected client.
+	var stopPublishers []func()
+
+	if cfg.KafkaJobsConsumerEnabled {
+		jobsReader := queue.StartConsumer(&queue.ConsumerConfig{
+			Brokers:        cfg.KafkaBrokers,
+			Topic:          cfg.KafkaJobsTopic,
+			GroupID:        cfg.KafkaGroupID,
+			ConsumerOffset: kafka.LastOffset,
+		})
+		defer jobsReader.Close()
+
+		responsesProducer := startProducer(cfg.KafkaResponsesTopic)
+		defer responsesProducer.Close()
+
+		// The job's offset is committed once the job is published so the broker must
+		// acknowledge the job before the sender returns
+		jobSender := mqtt.NewDataMessageSender(mqttClient, mqtt.NewTopicBuilder(), cfg.MqttDataMessageChunkSize,
+			mqtt.WithDataMessageQos(1), mqtt.WithDeliveryConfirmer(deliveryConfirmer),
+			mqtt.WithMessageSizeLimits(messageSizeLimits), mqtt.WithDataMessageCapabilityGate(capabilities))
+
+		jobConsumer := controller.NewJobConsumer(jobsReader, connectionManager, jobSender,
+			forwardingController.Writer(cfg.KafkaResponsesTopic, responsesProducer),
+			cfg.DefaultDataDirective, cfg.KafkaJobsSendTimeout, cfg.KafkaJobsRetryInterval, cfg.KafkaJobsMaxAttempts, cfg.KafkaMaxDecompressedSize, controllerMetrics)
+		jobConsumer.Start()
+		stopPublishers = append(stopPublishers, jobConsumer.Stop)
+	}
+
+	controlMessageSender := mqtt.NewControlMessageSender(mqttClient, mqtt.NewTopicBuilder(),
+		mqtt.WithSyncDelivery(cfg.MqttReconnectMessageQos, cfg.MqttPublishAckTimeout),
+		mqtt.WithPongTracking(pongs, cfg.MqttPongTimeout),
+		mqtt.WithMessageSigner(messageSigner),
+		mqtt.WithTimestampFormat(cfg.ControlMessageTimestampFormat),
+		mqtt.WithCapabilityGate(capabilities))
+
+	reconnectServer := api.NewReconnectServer(controlMessageSender, apiMux, cfg)
+	reconnectServer.Routes()
+
+	consistencyChecker := controller.NewConsistencyChecker(connectionManager, controlMessageSender, controlMessageSender,
+		controller.ConsistencyCheckerConfig{
+			Interval:    cfg.ConsistencyCheckInterval,
+			SampleSize:  cfg.ConsistencyCheckSampleSize,
+			PingTimeout: cfg.ConsistencyCheckPingTimeout,
+			Repair:      cfg.ConsistencyCheckRepair,
+		}, controllerMetrics)
+	consistencyServer := api.NewConsistencyServer(consistencyChecker, apiMux, cfg)
+	consistencyServer.Routes()
+
+	if cfg.ConsistencyCheckInterval > 0 {
+		consistencyChecker.Start()
+		stopPublishers = append(stopPublishers, consistencyChecker.Stop)
+	}
+
+	if cfg.StaleConnectionTTL > 0 {
+		connectionReaper := controller.NewConnectionReaper(connectionManager, controlMessageSender, disconnects,
+			cfg.StaleConnectionTTL, cfg.StaleConnectionReaperInterval, cfg.MqttPongTimeout, controllerMetrics)
+		connectionReaper.Start()
+		stopPublishers = append(stopPublishers, connectionReaper.Stop)
+	}
+
+	connectionQuota := controller.NewConnectionQuota(connectionManager, accountResolver,
+		cfg.ConnectionQuotaMaxPerAccount, cfg.ConnectionQuotaMaxAttemptsPerClient, cfg.ConnectionQuotaWindow, cfg.ConnectionQuotaRetryAfter, controllerMetrics)
+	certRecorder, _ := accountResolver.(controller.CertificateSubjectRecorder)
+	brokerAuthServer := api.NewBrokerAuthServer(connectionQuota, certRecorder, apiMux, cfg)
+	brokerAuthServer.Routes()
+
+	if cfg.ConnectionCountInterval > 0 {
+		connectionCountProducer := startProducer(cfg.KafkaConnectionCountTopic)
+		defer connectionCountProducer.Close()
+
+		connectionCountReporter := controller.NewConnectionCountReporter(connectionManager,
+			forwardingController.Writer(cfg.KafkaConnectionCountTopic, connectionCountProducer),
+			cfg.ConnectionCountInterval)
+		connectionCountReporter.Start()
+		defer connectionCountReporter.Stop()
+
+		// The connection counts are written every interval.  The other topics can go quiet
+		// in a healthy system so their producers do not back the readiness check.
+		if cfg.ReadinessRequireKafkaWrite {
+			monitoringServer.AddReadinessCheck("kafka_"+cfg.KafkaConnectionCountTopic, connectionCountProducer.CheckProduced)
+		}
+	}
+
+	apiSrv := utils.StartHTTPServer(mgmtAddr, "management", apiMux)
+
+	<-shutdownCtx.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HttpShutdownTimeout)
+	defer cancel()
+
+	utils.ShutdownHTTPServer(ctx, "management", apiSrv)
+
+	for i := len(stopPublishers) - 1; i >= 0; i-- {
+		stopPublishers[i]()
+	}
+
+	mqtt.Shutdown(mqttClient, subscriptions, inFlightMessages, cfg.MqttShutdownDrainTimeout, cfg.MqttDisconnectQuiesce)
+
+	logger.Log.Info("Cloud-Connector MQTT message consumer shutting down")
+}
+
+// startAsyncKafkaWriter wraps the writer with an AsyncWriter.  Messages that could
+// not be written are either queued to be retried or logged (and optionally treated
+// as fatal) depending on the configuration.  The returned func must be called to
+// flush the writer and stop retrying.
+func startAsyncKafkaWriter(cfg *config.Config, writer queue.Writer) (*queue.AsyncWriter, func()) {
+	if cfg.KafkaWriteRetryQueue == false {
+		asyncWriter := queue.NewAsyncWriter(writer, cfg.KafkaWriterWorkers, cfg.KafkaWriterBufferSize, cfg.KafkaResponsesBatchSize,
+			queue.NewWriteFailureHandler(cfg.KafkaWriteFailureFatal))
+		return asyncWriter, asyncWriter.Close
+	}
+
+	retryQueue := queue.NewRetryQueue(writer, cfg.KafkaWriteRetryQueueSize, cfg.KafkaWriteRetryInitialBackoff, cfg.KafkaWriteRetryMaxBackoff)
+	retryQueue.Start()
+
+	asyncWriter := queue.NewAsyncWriter(writer, cfg.KafkaWriterWorkers, cfg.KafkaWriterBufferSize, cfg.KafkaResponsesBatchSize,
+		retryQueue.FailureHandler())
+
+	return asyncWriter, func() {
+		asyncWriter.Close()
+		retryQueue.Stop()
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/mqtt"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sendMessage connects to the broker, publishes a single data message to the client
+// and exits.  It allows operators to send work to a client without standing up a
+// service that produces jobs.
+func sendMessage(broker string, certFile string, keyFile string, clientID string, directive string, payloadOption string) {
+
+	cfg := config.GetConfig()
+
+	if err := logger.Configure(cfg.LogFormat, cfg.LogLevel); err != nil {
+		logger.Log.Fatal("Unable to configure the logger: ", err)
+	}
+
+	if clientID == "" || directive == "" || payloadOption == "" {
+		logger.Log.Fatal("The -client-id, -directive and -payload options are required")
+	}
+
+	if err := verifyBrokerUrls(broker); err != nil {
+		logger.Log.Fatal("Configuration error: ", err)
+	}
+
+	if err := mqtt.VerifyChunkSize(cfg.MqttDataMessageChunkSize, cfg.MqttBrokerMaxMessageSize); err != nil {
+		logger.Log.Fatal("Configuration error: ", err)
+	}
+
+	payload, err := readPayload(payloadOption)
+	if err != nil {
+		logger.Log.Fatal("Unable to read the payload: ", err)
+	}
+
+	tlsConfig, err := newBrokerTlsConfig(cfg, certFile, keyFile)
+	if err != nil {
+		logger.Log.Fatal("Unable to configure TLS for the MQTT broker connection: ", err)
+	}
+
+	// The command does not serve its metrics so they are not registered globally
+	mqttMetrics := mqtt.NewMetrics(prometheus.NewRegistry())
+
+	messageSizeLimits, err := mqtt.NewMessageSizeLimits(cfg.MaxMessageSizeBytes, cfg.MaxMessageSizeBytesPerDirective, mqttMetrics)
+	if err != nil {
+		logger.Log.Fatal("Unable to configure the message size limits: ", err)
+	}
+
+	shutdownCtx, stopListeningForShutdown := newShutdownContext()
+	defer stopListeningForShutdown()
+
+	mqttClient, err := mqtt.NewPublishOnlyConnection(shutdownCtx, cfg, mqtt.ParseBrokerUrls(broker), tlsConfig, mqttMetrics)
+	if err != nil {
+		logger.Log.Fatal("Failed to connect to MQTT broker: ", err)
+	}
+	defer mqttClient.Disconnect(250)
+
+	ctx := shutdownCtx
+	if cfg.MqttPublishAckTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.MqttPublishAckTimeout)
+		defer cancel()
+	}
+
+	sender := mqtt.NewDataMessageSender(mqttClient, mqtt.NewTopicBuilder(), cfg.MqttDataMessageChunkSize,
+		mqtt.WithMessageSizeLimits(messageSizeLimits))
+
+	messageID, err := sender.SendDataMessage(ctx, domain.ClientID(clientID), directive, payload)
+	if err != nil {
+		logger.Log.Fatal("Unable to send the message: ", err)
+	}
+
+	fmt.Println(messageID)
+}
+
+// readPayload returns the payload given on the command line.  A value starting with @
+// names a file to read the payload from.  Payloads that are valid json are sent as json,
+// anything else is sent as a string.
+func readPayload(option string) (interface{}, error) {
+	raw := []byte(option)
+
+	if strings.HasPrefix(option, "@") {
+		fileName := strings.TrimPrefix(option, "@")
+		if fileName == "" {
+			return nil, errors.New("A file name is required after @")
+		}
+
+		var err error
+		raw, err = ioutil.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var payload interface{}
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return strings.TrimSpace(string(raw)), nil
+	}
+
+	return payload, nil
+}
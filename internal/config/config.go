@@ -11,40 +11,470 @@ import (
 const (
 	ENV_PREFIX = "CLOUD_CONNECTOR"
 
-	HTTP_SHUTDOWN_TIMEOUT          = "HTTP_Shutdown_Timeout"
-	SERVICE_TO_SERVICE_CREDENTIALS = "Service_To_Service_Credentials"
-	PROFILE                        = "Enable_Profile"
-	BROKERS                        = "Kafka_Brokers"
-	JOBS_TOPIC                     = "Kafka_Jobs_Topic"
-	JOBS_GROUP_ID                  = "Kafka_Jobs_Group_Id"
-	RESPONSES_TOPIC                = "Kafka_Responses_Topic"
-	RESPONSES_BATCH_SIZE           = "Kafka_Responses_Batch_Size"
-	RESPONSES_BATCH_BYTES          = "Kafka_Responses_Batch_Bytes"
-	DEFAULT_BROKER_ADDRESS         = "kafka:29092"
+	HTTP_SHUTDOWN_TIMEOUT                    = "HTTP_Shutdown_Timeout"
+	READINESS_CHECK_TIMEOUT_MS               = "Readiness_Check_Timeout_Ms"
+	READINESS_REQUIRE_KAFKA_WRITE            = "Readiness_Require_Kafka_Write"
+	MQTT_CONNECTIVITY_CHECK_INTERVAL         = "MQTT_Connectivity_Check_Interval"
+	SERVICE_TO_SERVICE_CREDENTIALS           = "Service_To_Service_Credentials"
+	PROFILE                                  = "Enable_Profile"
+	LOG_FORMAT                               = "Log_Format"
+	LOG_LEVEL                                = "Log_Level"
+	BROKERS                                  = "Kafka_Brokers"
+	JOBS_TOPIC                               = "Kafka_Jobs_Topic"
+	JOBS_GROUP_ID                            = "Kafka_Jobs_Group_Id"
+	JOBS_CONSUMER_ENABLED                    = "Kafka_Jobs_Consumer_Enabled"
+	JOBS_SEND_TIMEOUT                        = "Kafka_Jobs_Send_Timeout"
+	JOBS_RETRY_INTERVAL                      = "Kafka_Jobs_Retry_Interval"
+	JOBS_MAX_ATTEMPTS                        = "Kafka_Jobs_Max_Attempts"
+	RESPONSES_TOPIC                          = "Kafka_Responses_Topic"
+	RESPONSES_BATCH_SIZE                     = "Kafka_Responses_Batch_Size"
+	RESPONSES_BATCH_BYTES                    = "Kafka_Responses_Batch_Bytes"
+	PAUSED_TOPIC_MODE                        = "Kafka_Paused_Topic_Mode"
+	PAUSED_TOPIC_BUFFER_SIZE                 = "Kafka_Paused_Topic_Buffer_Size"
+	PAUSED_TOPIC_RESUME_TIMEOUT              = "Kafka_Paused_Topic_Resume_Timeout"
+	REQUIRED_ACKS                            = "Kafka_Required_Acks"
+	LOG_WRITE_OUTCOMES                       = "Kafka_Log_Write_Outcomes"
+	WRITER_WORKERS                           = "Kafka_Writer_Workers"
+	WRITER_BUFFER_SIZE                       = "Kafka_Writer_Buffer_Size"
+	WRITE_FAILURE_FATAL                      = "Kafka_Write_Failure_Fatal"
+	WRITE_RETRY_QUEUE                        = "Kafka_Write_Retry_Queue"
+	WRITE_RETRY_QUEUE_SIZE                   = "Kafka_Write_Retry_Queue_Size"
+	WRITE_RETRY_INITIAL_BACKOFF_MS           = "Kafka_Write_Retry_Initial_Backoff_Ms"
+	WRITE_RETRY_MAX_BACKOFF                  = "Kafka_Write_Retry_Max_Backoff"
+	COMPRESS_MESSAGE_VALUES                  = "Kafka_Compress_Message_Values"
+	COMPRESSION_THRESHOLD                    = "Kafka_Compression_Threshold"
+	MAX_DECOMPRESSED_SIZE                    = "Kafka_Max_Decompressed_Size"
+	INVALID_HANDSHAKE_RECONNECT_DELAY        = "Invalid_Handshake_Reconnect_Delay"
+	RECONNECT_DELAY_MIN                      = "Reconnect_Delay_Min"
+	RECONNECT_DELAY_MAX                      = "Reconnect_Delay_Max"
+	PENDING_COMMAND_TTL                      = "Pending_Command_TTL"
+	PENDING_COMMAND_MAX                      = "Pending_Command_Max"
+	DEFAULT_DATA_DIRECTIVE                   = "Default_Data_Directive"
+	LAST_ERROR_MAX_CLIENTS                   = "Last_Error_Max_Clients"
+	LAST_ERROR_TTL                           = "Last_Error_TTL"
+	MQTT_BROKER_TLS_SESSION_CACHE_SIZE       = "MQTT_Broker_Tls_Session_Cache_Size"
+	MQTT_BROKER_TLS_DISABLE_SESSION_TICKETS  = "MQTT_Broker_Tls_Disable_Session_Tickets"
+	MQTT_BROKER_TLS_RENEGOTIATION            = "MQTT_Broker_Tls_Renegotiation"
+	MQTT_BROKER_MAX_MESSAGE_SIZE             = "MQTT_Broker_Max_Message_Size"
+	MQTT_BROKER_RESUME_SUBS                  = "MQTT_Broker_Resume_Subs"
+	MQTT_BROKER_ORDER_MATTERS                = "MQTT_Broker_Order_Matters"
+	MQTT_CONNECT_RETRY                       = "MQTT_Connect_Retry"
+	MQTT_CONNECT_RETRY_INTERVAL              = "MQTT_Connect_Retry_Interval"
+	MQTT_CONNECT_MAX_ATTEMPTS                = "MQTT_Connect_Max_Attempts"
+	MQTT_CONNECT_BACKOFF_INITIAL_INTERVAL    = "MQTT_Connect_Backoff_Initial_Interval"
+	MQTT_CONNECT_BACKOFF_MAX_INTERVAL        = "MQTT_Connect_Backoff_Max_Interval"
+	MQTT_KEEP_ALIVE                          = "MQTT_Keep_Alive"
+	MQTT_PING_TIMEOUT                        = "MQTT_Ping_Timeout"
+	MQTT_MAX_RECONNECT_INTERVAL              = "MQTT_Max_Reconnect_Interval"
+	MQTT_DISCONNECT_QUIESCE_MS               = "MQTT_Disconnect_Quiesce_Ms"
+	MQTT_SHUTDOWN_DRAIN_TIMEOUT              = "MQTT_Shutdown_Drain_Timeout"
+	MQTT_RECONNECT_MESSAGE_QOS               = "MQTT_Reconnect_Message_Qos"
+	MQTT_PUBLISH_ACK_TIMEOUT                 = "MQTT_Publish_Ack_Timeout"
+	MQTT_PONG_TIMEOUT                        = "MQTT_Pong_Timeout"
+	MQTT_DATA_MESSAGE_CHUNK_SIZE             = "MQTT_Data_Message_Chunk_Size"
+	MAX_MESSAGE_SIZE_BYTES                   = "Max_Message_Size_Bytes"
+	MAX_MESSAGE_SIZE_BYTES_PER_DIRECTIVE     = "Max_Message_Size_Bytes_Per_Directive"
+	SOURCES_DISPATCHERS                      = "Sources_Dispatchers"
+	SOURCES_IDENTITY_HEADER_VERSION          = "Sources_Identity_Header_Version"
+	SOURCES_RECORDER_IMPL                    = "Sources_Recorder_Impl"
+	SOURCES_BASE_URL                         = "Sources_Base_Url"
+	SOURCES_HTTP_TIMEOUT                     = "Sources_Http_Timeout"
+	SOURCES_HTTP_MAX_RETRIES                 = "Sources_Http_Max_Retries"
+	SOURCES_HTTP_RETRY_DELAY                 = "Sources_Http_Retry_Delay"
+	DISPATCHER_CHANGE_HANDLING               = "Dispatcher_Change_Handling"
+	DISPATCHER_CHANGE_RETENTION              = "Dispatcher_Change_Retention"
+	DUPLICATE_CONNECTION_HANDLING            = "Duplicate_Connection_Handling"
+	MAX_CONTROL_MESSAGE_AGE                  = "Max_Control_Message_Age"
+	CONTROL_MESSAGE_PROCESSING_TIMEOUT       = "Control_Message_Processing_Timeout"
+	MAX_CONTROL_MESSAGE_SIZE                 = "Max_Control_Message_Size"
+	OVERSIZED_CONTROL_MESSAGE_DISCONNECT     = "Oversized_Control_Message_Disconnect"
+	CONTROL_MESSAGE_TIMESTAMP_FORMAT         = "Control_Message_Timestamp_Format"
+	CONTROL_MESSAGE_SIGNING                  = "Control_Message_Signing"
+	CONTROL_MESSAGE_SIGNING_KEY_FILE         = "Control_Message_Signing_Key_File"
+	CONTROL_MESSAGE_REQUIRE_SIGNATURE        = "Control_Message_Require_Signature"
+	CONTROL_MESSAGE_REPLAY_WINDOW            = "Control_Message_Replay_Window"
+	MQTT_CLIENT_ID                           = "MQTT_Client_Id"
+	MQTT_CLIENT_ID_UNIQUE_SUFFIX             = "MQTT_Client_Id_Unique_Suffix"
+	FACTS_ENRICHER_IMPL                      = "Facts_Enricher_Impl"
+	STATIC_FACTS                             = "Static_Facts"
+	CLIENT_ID_TO_ACCOUNT_ID_IMPL             = "Client_Id_To_Account_Id_Impl"
+	CLIENT_ID_TO_ACCOUNT_ID_CACHE_MAX_SIZE   = "Client_Id_To_Account_Id_Cache_Max_Size"
+	CLIENT_ID_TO_ACCOUNT_ID_CACHE_TTL        = "Client_Id_To_Account_Id_Cache_Ttl"
+	DEAD_LETTER_TOPIC                        = "Kafka_Dead_Letter_Topic"
+	CLIENT_EVENTS_TOPIC                      = "Kafka_Client_Events_Topic"
+	INVENTORY_TOPIC                          = "Kafka_Inventory_Topic"
+	CLIENT_EVENT_FORWARDING                  = "Client_Event_Forwarding"
+	CONNECTION_COUNT_TOPIC                   = "Kafka_Connection_Count_Topic"
+	DELIVERY_CONFIRMATION                    = "Data_Message_Delivery_Confirmation"
+	DELIVERY_CONFIRMATION_TOPIC              = "Kafka_Delivery_Confirmation_Topic"
+	CONNECTION_COUNT_INTERVAL                = "Connection_Count_Interval"
+	CLIENT_COUNT_CACHE_INTERVAL              = "Client_Count_Cache_Interval"
+	CONSISTENCY_CHECK_INTERVAL               = "Consistency_Check_Interval"
+	CONSISTENCY_CHECK_SAMPLE_SIZE            = "Consistency_Check_Sample_Size"
+	CONSISTENCY_CHECK_PING_TIMEOUT           = "Consistency_Check_Ping_Timeout"
+	CONSISTENCY_CHECK_REPAIR                 = "Consistency_Check_Repair"
+	STALE_CONNECTION_TTL                     = "Stale_Connection_TTL"
+	STALE_CONNECTION_REAPER_INTERVAL         = "Stale_Connection_Reaper_Interval"
+	CONNECTION_REGISTRAR_IMPL                = "Connection_Registrar_Impl"
+	REDIS_ADDRESS                            = "Redis_Address"
+	REDIS_PASSWORD                           = "Redis_Password"
+	REDIS_DB                                 = "Redis_DB"
+	REDIS_CONNECTION_TTL                     = "Redis_Connection_TTL"
+	UNVERIFIABLE_TOPIC_HANDLING              = "Unverifiable_Topic_Handling"
+	REQUIRE_COMMAND_CAPABILITY               = "Require_Command_Capability"
+	BACKPRESSURE_MESSAGE_THRESHOLD           = "Backpressure_Message_Threshold"
+	BACKPRESSURE_WINDOW                      = "Backpressure_Window"
+	BACKPRESSURE_MAX_THROTTLED_CLIENTS       = "Backpressure_Max_Throttled_Clients"
+	BACKPRESSURE_THROTTLE_INTERVAL           = "Backpressure_Throttle_Interval"
+	ONLINE_MESSAGE_DEBOUNCE_WINDOW_MS        = "Online_Message_Debounce_Window_Ms"
+	ONLINE_MESSAGE_DEBOUNCE_MAX_CLIENTS      = "Online_Message_Debounce_Max_Clients"
+	HANDSHAKE_REDACT_PII                     = "Handshake_Redact_PII"
+	HANDSHAKE_DEBUG_MAX_SIZE                 = "Handshake_Debug_Max_Size"
+	CONNECTION_EVENT_PUBLISHER_IMPL          = "Connection_Event_Publisher_Impl"
+	CONNECTION_EVENT_WEBHOOK_URL             = "Connection_Event_Webhook_Url"
+	CONNECTION_EVENT_WEBHOOK_SECRET          = "Connection_Event_Webhook_Secret"
+	CONNECTION_EVENT_WEBHOOK_QUEUE_SIZE      = "Connection_Event_Webhook_Queue_Size"
+	CONNECTION_EVENT_WEBHOOK_MAX_RETRIES     = "Connection_Event_Webhook_Max_Retries"
+	CONNECTION_EVENT_WEBHOOK_RETRY_DELAY     = "Connection_Event_Webhook_Retry_Delay"
+	CONNECTION_EVENT_WEBHOOK_TIMEOUT         = "Connection_Event_Webhook_Timeout"
+	REQUIRE_ORG_ID                           = "Require_Org_Id"
+	SLOW_CONSUMER_WINDOW                     = "Slow_Consumer_Window"
+	SLOW_CONSUMER_DURATION                   = "Slow_Consumer_Duration"
+	SLOW_CONSUMER_MAX_LAG                    = "Slow_Consumer_Max_Lag"
+	INVENTORY_REPORTER                       = "Inventory_Reporter"
+	INVENTORY_REQUIRED_FACTS                 = "Inventory_Required_Facts"
+	INVENTORY_INCLUDED_FACTS                 = "Inventory_Included_Facts"
+	INVENTORY_OMITTED_FACTS                  = "Inventory_Omitted_Facts"
+	DISPLAY_NAME_FACTS                       = "Display_Name_Facts"
+	INVENTORY_IDENTITY_HEADER_VERSION        = "Inventory_Identity_Header_Version"
+	INVENTORY_DELETE_EPHEMERAL_HOSTS         = "Inventory_Delete_Ephemeral_Hosts"
+	INVENTORY_REGISTER_HOSTS                 = "Inventory_Register_Hosts"
+	INVENTORY_EPHEMERAL_ACCOUNTS             = "Inventory_Ephemeral_Accounts"
+	INVENTORY_EPHEMERAL_DELETE_GRACE_PERIOD  = "Inventory_Ephemeral_Delete_Grace_Period"
+	FACTS_HASH_ALGORITHM                     = "Facts_Hash_Algorithm"
+	ONLINE_MESSAGE_DEDUP_TTL                 = "Online_Message_Dedup_Ttl"
+	PROCESSED_MESSAGE_STORE_IMPL             = "Processed_Message_Store_Impl"
+	ONLINE_MESSAGE_DUPLICATE_WINDOW          = "Online_Message_Duplicate_Window"
+	CLEAR_RETAINED_CONNECTION_STATUS         = "Clear_Retained_Connection_Status"
+	MQTT_MESSAGE_HANDLER_MIDDLEWARES         = "Mqtt_Message_Handler_Middlewares"
+	MQTT_MESSAGE_WORKERS                     = "Mqtt_Message_Workers"
+	MQTT_MESSAGE_WORKERS_PER_CPU             = "Mqtt_Message_Workers_Per_Cpu"
+	MQTT_MESSAGE_WORKER_QUEUE_SIZE           = "Mqtt_Message_Worker_Queue_Size"
+	CONNECTION_QUOTA_MAX_PER_ACCOUNT         = "Connection_Quota_Max_Per_Account"
+	CONNECTION_QUOTA_MAX_ATTEMPTS_PER_CLIENT = "Connection_Quota_Max_Attempts_Per_Client"
+	CONNECTION_QUOTA_WINDOW                  = "Connection_Quota_Window"
+	CONNECTION_QUOTA_RETRY_AFTER             = "Connection_Quota_Retry_After"
+	DEFAULT_BROKER_ADDRESS                   = "kafka:29092"
 )
 
 type Config struct {
-	HttpShutdownTimeout         time.Duration
-	ServiceToServiceCredentials map[string]interface{}
-	Profile                     bool
-	KafkaBrokers                []string
-	KafkaJobsTopic              string
-	KafkaResponsesTopic         string
-	KafkaResponsesBatchSize     int
-	KafkaResponsesBatchBytes    int
-	KafkaGroupID                string
+	HttpShutdownTimeout                 time.Duration
+	ReadinessCheckTimeout               time.Duration
+	ReadinessRequireKafkaWrite          bool
+	MqttConnectivityCheckInterval       time.Duration
+	ServiceToServiceCredentials         map[string]interface{}
+	Profile                             bool
+	LogFormat                           string
+	LogLevel                            string
+	KafkaBrokers                        []string
+	KafkaJobsTopic                      string
+	KafkaResponsesTopic                 string
+	KafkaResponsesBatchSize             int
+	KafkaResponsesBatchBytes            int
+	KafkaGroupID                        string
+	KafkaJobsConsumerEnabled            bool
+	KafkaJobsSendTimeout                time.Duration
+	KafkaJobsRetryInterval              time.Duration
+	KafkaJobsMaxAttempts                int
+	KafkaPausedTopicMode                string
+	KafkaPausedTopicBufferSize          int
+	KafkaPausedTopicResumeTimeout       time.Duration
+	KafkaRequiredAcks                   string
+	KafkaLogWriteOutcomes               bool
+	KafkaWriterWorkers                  int
+	KafkaWriterBufferSize               int
+	KafkaWriteFailureFatal              bool
+	KafkaWriteRetryQueue                bool
+	KafkaWriteRetryQueueSize            int
+	KafkaWriteRetryInitialBackoff       time.Duration
+	KafkaWriteRetryMaxBackoff           time.Duration
+	KafkaCompressMessageValues          bool
+	KafkaCompressionThreshold           int
+	KafkaMaxDecompressedSize            int
+	InvalidHandshakeReconnectDelay      int
+	ReconnectDelayMin                   int
+	ReconnectDelayMax                   int
+	PendingCommandTTL                   time.Duration
+	PendingCommandMax                   int
+	DefaultDataDirective                string
+	LastErrorMaxClients                 int
+	LastErrorTTL                        time.Duration
+	MqttBrokerTlsSessionCacheSize       int
+	MqttBrokerTlsSessionTicketsDisabled bool
+	MqttBrokerTlsRenegotiation          string
+	MqttBrokerMaxMessageSize            int
+	MqttBrokerResumeSubs                bool
+	MqttBrokerOrderMatters              bool
+	MqttConnectRetry                    bool
+	MqttConnectRetryInterval            time.Duration
+	MqttConnectMaxAttempts              int
+	MqttConnectBackoffInitialInterval   time.Duration
+	MqttConnectBackoffMaxInterval       time.Duration
+	MqttKeepAlive                       time.Duration
+	MqttPingTimeout                     time.Duration
+	MqttMaxReconnectInterval            time.Duration
+	MqttDisconnectQuiesce               time.Duration
+	MqttShutdownDrainTimeout            time.Duration
+	MqttReconnectMessageQos             byte
+	MqttPublishAckTimeout               time.Duration
+	MqttPongTimeout                     time.Duration
+	MqttDataMessageChunkSize            int
+	MaxMessageSizeBytes                 int
+	MaxMessageSizeBytesPerDirective     map[string]string
+	SourcesDispatchers                  map[string][]string
+	SourcesIdentityHeaderVersion        string
+	SourcesRecorderImpl                 string
+	SourcesBaseUrl                      string
+	SourcesHttpTimeout                  time.Duration
+	SourcesHttpMaxRetries               int
+	SourcesHttpRetryDelay               time.Duration
+	DispatcherChangeHandling            string
+	DispatcherChangeRetention           time.Duration
+	DuplicateConnectionHandling         string
+	MaxControlMessageAge                time.Duration
+	ControlMessageProcessingTimeout     time.Duration
+	MaxControlMessageSize               int
+	OversizedControlMessageDisconnect   bool
+	ControlMessageTimestampFormat       string
+	ControlMessageSigning               string
+	ControlMessageSigningKeyFile        string
+	ControlMessageRequireSignature      bool
+	ControlMessageReplayWindow          time.Duration
+	MqttClientId                        string
+	MqttClientIdUniqueSuffix            bool
+	FactsEnricherImpl                   string
+	StaticFacts                         map[string]string
+	ClientIdToAccountIdImpl             string
+	ClientIdToAccountIdCacheMaxSize     int
+	ClientIdToAccountIdCacheTTL         time.Duration
+	KafkaDeadLetterTopic                string
+	KafkaClientEventsTopic              string
+	KafkaInventoryTopic                 string
+	ClientEventForwarding               bool
+	KafkaConnectionCountTopic           string
+	DataMessageDeliveryConfirmation     bool
+	KafkaDeliveryConfirmationTopic      string
+	ConnectionCountInterval             time.Duration
+	ClientCountCacheInterval            time.Duration
+	ConsistencyCheckInterval            time.Duration
+	ConsistencyCheckSampleSize          int
+	ConsistencyCheckPingTimeout         time.Duration
+	ConsistencyCheckRepair              bool
+	StaleConnectionTTL                  time.Duration
+	StaleConnectionReaperInterval       time.Duration
+	ConnectionRegistrarImpl             string
+	RedisAddress                        string
+	RedisPassword                       string
+	RedisDB                             int
+	RedisConnectionTTL                  time.Duration
+	UnverifiableTopicHandling           string
+	RequireCommandCapability            bool
+	BackpressureMessageThreshold        int
+	BackpressureWindow                  time.Duration
+	BackpressureMaxThrottledClients     int
+	BackpressureThrottleInterval        int
+	OnlineMessageDebounceWindow         time.Duration
+	OnlineMessageDebounceMaxClients     int
+	HandshakeRedactPII                  bool
+	HandshakeDebugMaxSize               int
+	ConnectionEventPublisherImpl        string
+	ConnectionEventWebhookUrl           string
+	ConnectionEventWebhookSecret        string
+	ConnectionEventWebhookQueueSize     int
+	ConnectionEventWebhookMaxRetries    int
+	ConnectionEventWebhookRetryDelay    time.Duration
+	ConnectionEventWebhookTimeout       time.Duration
+	RequireOrgId                        bool
+	SlowConsumerWindow                  time.Duration
+	SlowConsumerDuration                time.Duration
+	SlowConsumerMaxLag                  time.Duration
+	InventoryReporter                   string
+	InventoryRequiredFacts              map[string][]string
+	InventoryIncludedFacts              []string
+	InventoryOmittedFacts               []string
+	DisplayNameFacts                    []string
+	InventoryIdentityHeaderVersion      string
+	InventoryDeleteEphemeralHosts       bool
+	InventoryRegisterHosts              bool
+	InventoryEphemeralAccounts          []string
+	InventoryEphemeralDeleteGracePeriod time.Duration
+	FactsHashAlgorithm                  string
+	OnlineMessageDedupTTL               time.Duration
+	ProcessedMessageStoreImpl           string
+	OnlineMessageDuplicateWindow        time.Duration
+	ClearRetainedConnectionStatus       bool
+	MqttMessageHandlerMiddlewares       []string
+	MqttMessageWorkers                  int
+	MqttMessageWorkersPerCpu            int
+	MqttMessageWorkerQueueSize          int
+	ConnectionQuotaMaxPerAccount        int
+	ConnectionQuotaMaxAttemptsPerClient int
+	ConnectionQuotaWindow               time.Duration
+	ConnectionQuotaRetryAfter           int
 }
 
 func (c Config) String() string {
 	var b strings.Builder
 	fmt.Fprintf(&b, "%s: %s\n", HTTP_SHUTDOWN_TIMEOUT, c.HttpShutdownTimeout)
+	fmt.Fprintf(&b, "%s: %s\n", READINESS_CHECK_TIMEOUT_MS, c.ReadinessCheckTimeout)
+	fmt.Fprintf(&b, "%s: %t\n", READINESS_REQUIRE_KAFKA_WRITE, c.ReadinessRequireKafkaWrite)
+	fmt.Fprintf(&b, "%s: %s\n", MQTT_CONNECTIVITY_CHECK_INTERVAL, c.MqttConnectivityCheckInterval)
 	fmt.Fprintf(&b, "%s: %t\n", PROFILE, c.Profile)
+	fmt.Fprintf(&b, "%s: %s\n", LOG_FORMAT, c.LogFormat)
+	fmt.Fprintf(&b, "%s: %s\n", LOG_LEVEL, c.LogLevel)
 	fmt.Fprintf(&b, "%s: %s\n", BROKERS, c.KafkaBrokers)
 	fmt.Fprintf(&b, "%s: %s\n", JOBS_TOPIC, c.KafkaJobsTopic)
 	fmt.Fprintf(&b, "%s: %s\n", RESPONSES_TOPIC, c.KafkaResponsesTopic)
 	fmt.Fprintf(&b, "%s: %d\n", RESPONSES_BATCH_SIZE, c.KafkaResponsesBatchSize)
 	fmt.Fprintf(&b, "%s: %d\n", RESPONSES_BATCH_BYTES, c.KafkaResponsesBatchBytes)
 	fmt.Fprintf(&b, "%s: %s\n", JOBS_GROUP_ID, c.KafkaGroupID)
+	fmt.Fprintf(&b, "%s: %t\n", JOBS_CONSUMER_ENABLED, c.KafkaJobsConsumerEnabled)
+	fmt.Fprintf(&b, "%s: %s\n", JOBS_SEND_TIMEOUT, c.KafkaJobsSendTimeout)
+	fmt.Fprintf(&b, "%s: %s\n", JOBS_RETRY_INTERVAL, c.KafkaJobsRetryInterval)
+	fmt.Fprintf(&b, "%s: %d\n", JOBS_MAX_ATTEMPTS, c.KafkaJobsMaxAttempts)
+	fmt.Fprintf(&b, "%s: %s\n", PAUSED_TOPIC_MODE, c.KafkaPausedTopicMode)
+	fmt.Fprintf(&b, "%s: %d\n", PAUSED_TOPIC_BUFFER_SIZE, c.KafkaPausedTopicBufferSize)
+	fmt.Fprintf(&b, "%s: %s\n", PAUSED_TOPIC_RESUME_TIMEOUT, c.KafkaPausedTopicResumeTimeout)
+	fmt.Fprintf(&b, "%s: %s\n", REQUIRED_ACKS, c.KafkaRequiredAcks)
+	fmt.Fprintf(&b, "%s: %t\n", LOG_WRITE_OUTCOMES, c.KafkaLogWriteOutcomes)
+	fmt.Fprintf(&b, "%s: %d\n", WRITER_WORKERS, c.KafkaWriterWorkers)
+	fmt.Fprintf(&b, "%s: %d\n", WRITER_BUFFER_SIZE, c.KafkaWriterBufferSize)
+	fmt.Fprintf(&b, "%s: %t\n", WRITE_FAILURE_FATAL, c.KafkaWriteFailureFatal)
+	fmt.Fprintf(&b, "%s: %t\n", WRITE_RETRY_QUEUE, c.KafkaWriteRetryQueue)
+	fmt.Fprintf(&b, "%s: %d\n", WRITE_RETRY_QUEUE_SIZE, c.KafkaWriteRetryQueueSize)
+	fmt.Fprintf(&b, "%s: %t\n", COMPRESS_MESSAGE_VALUES, c.KafkaCompressMessageValues)
+	fmt.Fprintf(&b, "%s: %d\n", COMPRESSION_THRESHOLD, c.KafkaCompressionThreshold)
+	fmt.Fprintf(&b, "%s: %d\n", MAX_DECOMPRESSED_SIZE, c.KafkaMaxDecompressedSize)
+	fmt.Fprintf(&b, "%s: %s\n", WRITE_RETRY_INITIAL_BACKOFF_MS, c.KafkaWriteRetryInitialBackoff)
+	fmt.Fprintf(&b, "%s: %s\n", WRITE_RETRY_MAX_BACKOFF, c.KafkaWriteRetryMaxBackoff)
+	fmt.Fprintf(&b, "%s: %d\n", INVALID_HANDSHAKE_RECONNECT_DELAY, c.InvalidHandshakeReconnectDelay)
+	fmt.Fprintf(&b, "%s: %d\n", RECONNECT_DELAY_MIN, c.ReconnectDelayMin)
+	fmt.Fprintf(&b, "%s: %d\n", RECONNECT_DELAY_MAX, c.ReconnectDelayMax)
+	fmt.Fprintf(&b, "%s: %s\n", PENDING_COMMAND_TTL, c.PendingCommandTTL)
+	fmt.Fprintf(&b, "%s: %d\n", PENDING_COMMAND_MAX, c.PendingCommandMax)
+	fmt.Fprintf(&b, "%s: %s\n", DEFAULT_DATA_DIRECTIVE, c.DefaultDataDirective)
+	fmt.Fprintf(&b, "%s: %d\n", LAST_ERROR_MAX_CLIENTS, c.LastErrorMaxClients)
+	fmt.Fprintf(&b, "%s: %s\n", LAST_ERROR_TTL, c.LastErrorTTL)
+	fmt.Fprintf(&b, "%s: %d\n", MQTT_BROKER_TLS_SESSION_CACHE_SIZE, c.MqttBrokerTlsSessionCacheSize)
+	fmt.Fprintf(&b, "%s: %t\n", MQTT_BROKER_TLS_DISABLE_SESSION_TICKETS, c.MqttBrokerTlsSessionTicketsDisabled)
+	fmt.Fprintf(&b, "%s: %s\n", MQTT_BROKER_TLS_RENEGOTIATION, c.MqttBrokerTlsRenegotiation)
+	fmt.Fprintf(&b, "%s: %d\n", MQTT_BROKER_MAX_MESSAGE_SIZE, c.MqttBrokerMaxMessageSize)
+	fmt.Fprintf(&b, "%s: %t\n", MQTT_BROKER_RESUME_SUBS, c.MqttBrokerResumeSubs)
+	fmt.Fprintf(&b, "%s: %t\n", MQTT_BROKER_ORDER_MATTERS, c.MqttBrokerOrderMatters)
+	fmt.Fprintf(&b, "%s: %t\n", MQTT_CONNECT_RETRY, c.MqttConnectRetry)
+	fmt.Fprintf(&b, "%s: %s\n", MQTT_CONNECT_RETRY_INTERVAL, c.MqttConnectRetryInterval)
+	fmt.Fprintf(&b, "%s: %d\n", MQTT_CONNECT_MAX_ATTEMPTS, c.MqttConnectMaxAttempts)
+	fmt.Fprintf(&b, "%s: %s\n", MQTT_CONNECT_BACKOFF_INITIAL_INTERVAL, c.MqttConnectBackoffInitialInterval)
+	fmt.Fprintf(&b, "%s: %s\n", MQTT_CONNECT_BACKOFF_MAX_INTERVAL, c.MqttConnectBackoffMaxInterval)
+	fmt.Fprintf(&b, "%s: %s\n", MQTT_KEEP_ALIVE, c.MqttKeepAlive)
+	fmt.Fprintf(&b, "%s: %s\n", MQTT_PING_TIMEOUT, c.MqttPingTimeout)
+	fmt.Fprintf(&b, "%s: %s\n", MQTT_MAX_RECONNECT_INTERVAL, c.MqttMaxReconnectInterval)
+	fmt.Fprintf(&b, "%s: %s\n", MQTT_DISCONNECT_QUIESCE_MS, c.MqttDisconnectQuiesce)
+	fmt.Fprintf(&b, "%s: %s\n", MQTT_SHUTDOWN_DRAIN_TIMEOUT, c.MqttShutdownDrainTimeout)
+	fmt.Fprintf(&b, "%s: %d\n", MQTT_RECONNECT_MESSAGE_QOS, c.MqttReconnectMessageQos)
+	fmt.Fprintf(&b, "%s: %s\n", MQTT_PUBLISH_ACK_TIMEOUT, c.MqttPublishAckTimeout)
+	fmt.Fprintf(&b, "%s: %s\n", MQTT_PONG_TIMEOUT, c.MqttPongTimeout)
+	fmt.Fprintf(&b, "%s: %d\n", MQTT_DATA_MESSAGE_CHUNK_SIZE, c.MqttDataMessageChunkSize)
+	fmt.Fprintf(&b, "%s: %d\n", MAX_MESSAGE_SIZE_BYTES, c.MaxMessageSizeBytes)
+	fmt.Fprintf(&b, "%s: %v\n", MAX_MESSAGE_SIZE_BYTES_PER_DIRECTIVE, c.MaxMessageSizeBytesPerDirective)
+	fmt.Fprintf(&b, "%s: %s\n", SOURCES_DISPATCHERS, c.SourcesDispatchers)
+	fmt.Fprintf(&b, "%s: %s\n", SOURCES_IDENTITY_HEADER_VERSION, c.SourcesIdentityHeaderVersion)
+	fmt.Fprintf(&b, "%s: %s\n", SOURCES_RECORDER_IMPL, c.SourcesRecorderImpl)
+	fmt.Fprintf(&b, "%s: %s\n", SOURCES_BASE_URL, c.SourcesBaseUrl)
+	fmt.Fprintf(&b, "%s: %s\n", SOURCES_HTTP_TIMEOUT, c.SourcesHttpTimeout)
+	fmt.Fprintf(&b, "%s: %d\n", SOURCES_HTTP_MAX_RETRIES, c.SourcesHttpMaxRetries)
+	fmt.Fprintf(&b, "%s: %s\n", SOURCES_HTTP_RETRY_DELAY, c.SourcesHttpRetryDelay)
+	fmt.Fprintf(&b, "%s: %s\n", DISPATCHER_CHANGE_HANDLING, c.DispatcherChangeHandling)
+	fmt.Fprintf(&b, "%s: %s\n", DISPATCHER_CHANGE_RETENTION, c.DispatcherChangeRetention)
+	fmt.Fprintf(&b, "%s: %s\n", DUPLICATE_CONNECTION_HANDLING, c.DuplicateConnectionHandling)
+	fmt.Fprintf(&b, "%s: %s\n", MAX_CONTROL_MESSAGE_AGE, c.MaxControlMessageAge)
+	fmt.Fprintf(&b, "%s: %s\n", CONTROL_MESSAGE_PROCESSING_TIMEOUT, c.ControlMessageProcessingTimeout)
+	fmt.Fprintf(&b, "%s: %d\n", MAX_CONTROL_MESSAGE_SIZE, c.MaxControlMessageSize)
+	fmt.Fprintf(&b, "%s: %t\n", OVERSIZED_CONTROL_MESSAGE_DISCONNECT, c.OversizedControlMessageDisconnect)
+	fmt.Fprintf(&b, "%s: %s\n", CONTROL_MESSAGE_TIMESTAMP_FORMAT, c.ControlMessageTimestampFormat)
+	fmt.Fprintf(&b, "%s: %s\n", CONTROL_MESSAGE_SIGNING, c.ControlMessageSigning)
+	fmt.Fprintf(&b, "%s: %s\n", CONTROL_MESSAGE_SIGNING_KEY_FILE, c.ControlMessageSigningKeyFile)
+	fmt.Fprintf(&b, "%s: %t\n", CONTROL_MESSAGE_REQUIRE_SIGNATURE, c.ControlMessageRequireSignature)
+	fmt.Fprintf(&b, "%s: %s\n", CONTROL_MESSAGE_REPLAY_WINDOW, c.ControlMessageReplayWindow)
+	fmt.Fprintf(&b, "%s: %s\n", MQTT_CLIENT_ID, c.MqttClientId)
+	fmt.Fprintf(&b, "%s: %t\n", MQTT_CLIENT_ID_UNIQUE_SUFFIX, c.MqttClientIdUniqueSuffix)
+	fmt.Fprintf(&b, "%s: %s\n", FACTS_ENRICHER_IMPL, c.FactsEnricherImpl)
+	fmt.Fprintf(&b, "%s: %s\n", STATIC_FACTS, c.StaticFacts)
+	fmt.Fprintf(&b, "%s: %s\n", CLIENT_ID_TO_ACCOUNT_ID_IMPL, c.ClientIdToAccountIdImpl)
+	fmt.Fprintf(&b, "%s: %d\n", CLIENT_ID_TO_ACCOUNT_ID_CACHE_MAX_SIZE, c.ClientIdToAccountIdCacheMaxSize)
+	fmt.Fprintf(&b, "%s: %s\n", CLIENT_ID_TO_ACCOUNT_ID_CACHE_TTL, c.ClientIdToAccountIdCacheTTL)
+	fmt.Fprintf(&b, "%s: %s\n", DEAD_LETTER_TOPIC, c.KafkaDeadLetterTopic)
+	fmt.Fprintf(&b, "%s: %s\n", CLIENT_EVENTS_TOPIC, c.KafkaClientEventsTopic)
+	fmt.Fprintf(&b, "%s: %s\n", INVENTORY_TOPIC, c.KafkaInventoryTopic)
+	fmt.Fprintf(&b, "%s: %t\n", CLIENT_EVENT_FORWARDING, c.ClientEventForwarding)
+	fmt.Fprintf(&b, "%s: %s\n", CONNECTION_COUNT_TOPIC, c.KafkaConnectionCountTopic)
+	fmt.Fprintf(&b, "%s: %t\n", DELIVERY_CONFIRMATION, c.DataMessageDeliveryConfirmation)
+	fmt.Fprintf(&b, "%s: %s\n", DELIVERY_CONFIRMATION_TOPIC, c.KafkaDeliveryConfirmationTopic)
+	fmt.Fprintf(&b, "%s: %s\n", CONNECTION_COUNT_INTERVAL, c.ConnectionCountInterval)
+	fmt.Fprintf(&b, "%s: %s\n", CLIENT_COUNT_CACHE_INTERVAL, c.ClientCountCacheInterval)
+	fmt.Fprintf(&b, "%s: %s\n", CONSISTENCY_CHECK_INTERVAL, c.ConsistencyCheckInterval)
+	fmt.Fprintf(&b, "%s: %d\n", CONSISTENCY_CHECK_SAMPLE_SIZE, c.ConsistencyCheckSampleSize)
+	fmt.Fprintf(&b, "%s: %s\n", CONSISTENCY_CHECK_PING_TIMEOUT, c.ConsistencyCheckPingTimeout)
+	fmt.Fprintf(&b, "%s: %t\n", CONSISTENCY_CHECK_REPAIR, c.ConsistencyCheckRepair)
+	fmt.Fprintf(&b, "%s: %s\n", STALE_CONNECTION_TTL, c.StaleConnectionTTL)
+	fmt.Fprintf(&b, "%s: %s\n", STALE_CONNECTION_REAPER_INTERVAL, c.StaleConnectionReaperInterval)
+	fmt.Fprintf(&b, "%s: %s\n", CONNECTION_REGISTRAR_IMPL, c.ConnectionRegistrarImpl)
+	fmt.Fprintf(&b, "%s: %s\n", REDIS_ADDRESS, c.RedisAddress)
+	fmt.Fprintf(&b, "%s: %d\n", REDIS_DB, c.RedisDB)
+	fmt.Fprintf(&b, "%s: %s\n", REDIS_CONNECTION_TTL, c.RedisConnectionTTL)
+	fmt.Fprintf(&b, "%s: %s\n", UNVERIFIABLE_TOPIC_HANDLING, c.UnverifiableTopicHandling)
+	fmt.Fprintf(&b, "%s: %t\n", REQUIRE_COMMAND_CAPABILITY, c.RequireCommandCapability)
+	fmt.Fprintf(&b, "%s: %d\n", BACKPRESSURE_MESSAGE_THRESHOLD, c.BackpressureMessageThreshold)
+	fmt.Fprintf(&b, "%s: %s\n", BACKPRESSURE_WINDOW, c.BackpressureWindow)
+	fmt.Fprintf(&b, "%s: %d\n", BACKPRESSURE_MAX_THROTTLED_CLIENTS, c.BackpressureMaxThrottledClients)
+	fmt.Fprintf(&b, "%s: %d\n", BACKPRESSURE_THROTTLE_INTERVAL, c.BackpressureThrottleInterval)
+	fmt.Fprintf(&b, "%s: %s\n", ONLINE_MESSAGE_DEBOUNCE_WINDOW_MS, c.OnlineMessageDebounceWindow)
+	fmt.Fprintf(&b, "%s: %d\n", ONLINE_MESSAGE_DEBOUNCE_MAX_CLIENTS, c.OnlineMessageDebounceMaxClients)
+	fmt.Fprintf(&b, "%s: %t\n", HANDSHAKE_REDACT_PII, c.HandshakeRedactPII)
+	fmt.Fprintf(&b, "%s: %d\n", HANDSHAKE_DEBUG_MAX_SIZE, c.HandshakeDebugMaxSize)
+	fmt.Fprintf(&b, "%s: %s\n", CONNECTION_EVENT_PUBLISHER_IMPL, c.ConnectionEventPublisherImpl)
+	fmt.Fprintf(&b, "%s: %s\n", CONNECTION_EVENT_WEBHOOK_URL, c.ConnectionEventWebhookUrl)
+	fmt.Fprintf(&b, "%s: %d\n", CONNECTION_EVENT_WEBHOOK_QUEUE_SIZE, c.ConnectionEventWebhookQueueSize)
+	fmt.Fprintf(&b, "%s: %d\n", CONNECTION_EVENT_WEBHOOK_MAX_RETRIES, c.ConnectionEventWebhookMaxRetries)
+	fmt.Fprintf(&b, "%s: %s\n", CONNECTION_EVENT_WEBHOOK_RETRY_DELAY, c.ConnectionEventWebhookRetryDelay)
+	fmt.Fprintf(&b, "%s: %s\n", CONNECTION_EVENT_WEBHOOK_TIMEOUT, c.ConnectionEventWebhookTimeout)
+	fmt.Fprintf(&b, "%s: %t\n", REQUIRE_ORG_ID, c.RequireOrgId)
+	fmt.Fprintf(&b, "%s: %s\n", SLOW_CONSUMER_WINDOW, c.SlowConsumerWindow)
+	fmt.Fprintf(&b, "%s: %s\n", SLOW_CONSUMER_DURATION, c.SlowConsumerDuration)
+	fmt.Fprintf(&b, "%s: %s\n", SLOW_CONSUMER_MAX_LAG, c.SlowConsumerMaxLag)
+	fmt.Fprintf(&b, "%s: %s\n", INVENTORY_REPORTER, c.InventoryReporter)
+	fmt.Fprintf(&b, "%s: %s\n", INVENTORY_REQUIRED_FACTS, c.InventoryRequiredFacts)
+	fmt.Fprintf(&b, "%s: %s\n", INVENTORY_INCLUDED_FACTS, c.InventoryIncludedFacts)
+	fmt.Fprintf(&b, "%s: %s\n", INVENTORY_OMITTED_FACTS, c.InventoryOmittedFacts)
+	fmt.Fprintf(&b, "%s: %s\n", DISPLAY_NAME_FACTS, c.DisplayNameFacts)
+	fmt.Fprintf(&b, "%s: %s\n", INVENTORY_IDENTITY_HEADER_VERSION, c.InventoryIdentityHeaderVersion)
+	fmt.Fprintf(&b, "%s: %t\n", INVENTORY_DELETE_EPHEMERAL_HOSTS, c.InventoryDeleteEphemeralHosts)
+	fmt.Fprintf(&b, "%s: %t\n", INVENTORY_REGISTER_HOSTS, c.InventoryRegisterHosts)
+	fmt.Fprintf(&b, "%s: %s\n", INVENTORY_EPHEMERAL_ACCOUNTS, c.InventoryEphemeralAccounts)
+	fmt.Fprintf(&b, "%s: %s\n", INVENTORY_EPHEMERAL_DELETE_GRACE_PERIOD, c.InventoryEphemeralDeleteGracePeriod)
+	fmt.Fprintf(&b, "%s: %s\n", FACTS_HASH_ALGORITHM, c.FactsHashAlgorithm)
+	fmt.Fprintf(&b, "%s: %s\n", ONLINE_MESSAGE_DEDUP_TTL, c.OnlineMessageDedupTTL)
+	fmt.Fprintf(&b, "%s: %s\n", PROCESSED_MESSAGE_STORE_IMPL, c.ProcessedMessageStoreImpl)
+	fmt.Fprintf(&b, "%s: %s\n", ONLINE_MESSAGE_DUPLICATE_WINDOW, c.OnlineMessageDuplicateWindow)
+	fmt.Fprintf(&b, "%s: %t\n", CLEAR_RETAINED_CONNECTION_STATUS, c.ClearRetainedConnectionStatus)
+	fmt.Fprintf(&b, "%s: %s\n", MQTT_MESSAGE_HANDLER_MIDDLEWARES, c.MqttMessageHandlerMiddlewares)
+	fmt.Fprintf(&b, "%s: %d\n", MQTT_MESSAGE_WORKERS, c.MqttMessageWorkers)
+	fmt.Fprintf(&b, "%s: %d\n", MQTT_MESSAGE_WORKERS_PER_CPU, c.MqttMessageWorkersPerCpu)
+	fmt.Fprintf(&b, "%s: %d\n", MQTT_MESSAGE_WORKER_QUEUE_SIZE, c.MqttMessageWorkerQueueSize)
+	fmt.Fprintf(&b, "%s: %d\n", CONNECTION_QUOTA_MAX_PER_ACCOUNT, c.ConnectionQuotaMaxPerAccount)
+	fmt.Fprintf(&b, "%s: %d\n", CONNECTION_QUOTA_MAX_ATTEMPTS_PER_CLIENT, c.ConnectionQuotaMaxAttemptsPerClient)
+	fmt.Fprintf(&b, "%s: %s\n", CONNECTION_QUOTA_WINDOW, c.ConnectionQuotaWindow)
+	fmt.Fprintf(&b, "%s: %d\n", CONNECTION_QUOTA_RETRY_AFTER, c.ConnectionQuotaRetryAfter)
 	return b.String()
 }
 
@@ -52,26 +482,317 @@ func GetConfig() *Config {
 	options := viper.New()
 
 	options.SetDefault(HTTP_SHUTDOWN_TIMEOUT, 2)
+	options.SetDefault(READINESS_CHECK_TIMEOUT_MS, 500)
+	options.SetDefault(READINESS_REQUIRE_KAFKA_WRITE, false)
+	options.SetDefault(MQTT_CONNECTIVITY_CHECK_INTERVAL, 10)
 	options.SetDefault(SERVICE_TO_SERVICE_CREDENTIALS, "")
 	options.SetDefault(PROFILE, false)
+	// An empty log format or level keeps the logger's own (RECEPTOR_CONTROLLER_LOG_*) settings
+	options.SetDefault(LOG_FORMAT, "")
+	options.SetDefault(LOG_LEVEL, "")
 	options.SetDefault(BROKERS, []string{DEFAULT_BROKER_ADDRESS})
 	options.SetDefault(JOBS_TOPIC, "platform.receptor-controller.jobs")
 	options.SetDefault(RESPONSES_TOPIC, "platform.receptor-controller.responses")
 	options.SetDefault(RESPONSES_BATCH_SIZE, 100)
 	options.SetDefault(RESPONSES_BATCH_BYTES, 1048576)
 	options.SetDefault(JOBS_GROUP_ID, "cloud-connector-consumer")
+	options.SetDefault(JOBS_CONSUMER_ENABLED, false)
+	options.SetDefault(JOBS_SEND_TIMEOUT, 10)
+	options.SetDefault(JOBS_RETRY_INTERVAL, 5)
+	options.SetDefault(JOBS_MAX_ATTEMPTS, 5)
+	options.SetDefault(PAUSED_TOPIC_MODE, "buffer")
+	options.SetDefault(PAUSED_TOPIC_BUFFER_SIZE, 1000)
+	options.SetDefault(PAUSED_TOPIC_RESUME_TIMEOUT, 30)
+	options.SetDefault(REQUIRED_ACKS, "all")
+	options.SetDefault(LOG_WRITE_OUTCOMES, false)
+	options.SetDefault(WRITER_WORKERS, 4)
+	options.SetDefault(WRITER_BUFFER_SIZE, 1000)
+	options.SetDefault(WRITE_FAILURE_FATAL, false)
+	options.SetDefault(WRITE_RETRY_QUEUE, false)
+	options.SetDefault(WRITE_RETRY_QUEUE_SIZE, 10000)
+	options.SetDefault(COMPRESS_MESSAGE_VALUES, false)
+	options.SetDefault(COMPRESSION_THRESHOLD, 1024)
+	options.SetDefault(MAX_DECOMPRESSED_SIZE, 16777216)
+	options.SetDefault(WRITE_RETRY_INITIAL_BACKOFF_MS, 500)
+	options.SetDefault(WRITE_RETRY_MAX_BACKOFF, 60)
+	options.SetDefault(INVALID_HANDSHAKE_RECONNECT_DELAY, 30)
+	options.SetDefault(RECONNECT_DELAY_MIN, 0)
+	options.SetDefault(RECONNECT_DELAY_MAX, 0)
+	options.SetDefault(PENDING_COMMAND_TTL, 600)
+	options.SetDefault(PENDING_COMMAND_MAX, 10000)
+	options.SetDefault(DEFAULT_DATA_DIRECTIVE, "")
+	options.SetDefault(LAST_ERROR_MAX_CLIENTS, 10000)
+	options.SetDefault(LAST_ERROR_TTL, 86400)
+	options.SetDefault(MQTT_BROKER_TLS_SESSION_CACHE_SIZE, 0)
+	options.SetDefault(MQTT_BROKER_TLS_DISABLE_SESSION_TICKETS, false)
+	options.SetDefault(MQTT_BROKER_TLS_RENEGOTIATION, "never")
+	options.SetDefault(MQTT_BROKER_MAX_MESSAGE_SIZE, 131072)
+	options.SetDefault(MQTT_BROKER_RESUME_SUBS, false)
+	options.SetDefault(MQTT_BROKER_ORDER_MATTERS, true)
+	options.SetDefault(MQTT_CONNECT_RETRY, false)
+	options.SetDefault(MQTT_CONNECT_RETRY_INTERVAL, 30)
+	options.SetDefault(MQTT_CONNECT_MAX_ATTEMPTS, 5)
+	options.SetDefault(MQTT_CONNECT_BACKOFF_INITIAL_INTERVAL, 1)
+	options.SetDefault(MQTT_CONNECT_BACKOFF_MAX_INTERVAL, 30)
+	options.SetDefault(MQTT_KEEP_ALIVE, 30)
+	options.SetDefault(MQTT_PING_TIMEOUT, 10)
+	options.SetDefault(MQTT_MAX_RECONNECT_INTERVAL, 120)
+	options.SetDefault(MQTT_DISCONNECT_QUIESCE_MS, 250)
+	options.SetDefault(MQTT_SHUTDOWN_DRAIN_TIMEOUT, 10)
+	options.SetDefault(MQTT_RECONNECT_MESSAGE_QOS, 0)
+	options.SetDefault(MQTT_PUBLISH_ACK_TIMEOUT, 0)
+	options.SetDefault(MQTT_PONG_TIMEOUT, 5)
+	options.SetDefault(MQTT_DATA_MESSAGE_CHUNK_SIZE, 0)
+	options.SetDefault(MAX_MESSAGE_SIZE_BYTES, 0)
+	options.SetDefault(MAX_MESSAGE_SIZE_BYTES_PER_DIRECTIVE, map[string]string{})
+	options.SetDefault(SOURCES_DISPATCHERS, map[string][]string{"catalog": []string{"sources_type", "application_type"}})
+	options.SetDefault(SOURCES_IDENTITY_HEADER_VERSION, "v1")
+	options.SetDefault(SOURCES_RECORDER_IMPL, "fake")
+	options.SetDefault(SOURCES_BASE_URL, "http://sources-api:8000/api/sources/v3.1")
+	options.SetDefault(SOURCES_HTTP_TIMEOUT, 5)
+	options.SetDefault(SOURCES_HTTP_MAX_RETRIES, 3)
+	options.SetDefault(SOURCES_HTTP_RETRY_DELAY, 1)
+	options.SetDefault(DISPATCHER_CHANGE_HANDLING, "sync")
+	options.SetDefault(DISPATCHER_CHANGE_RETENTION, 3600)
+	options.SetDefault(DUPLICATE_CONNECTION_HANDLING, "keep")
+	options.SetDefault(MAX_CONTROL_MESSAGE_AGE, 0)
+	options.SetDefault(CONTROL_MESSAGE_PROCESSING_TIMEOUT, 10)
+	options.SetDefault(MAX_CONTROL_MESSAGE_SIZE, 1048576)
+	options.SetDefault(OVERSIZED_CONTROL_MESSAGE_DISCONNECT, false)
+	options.SetDefault(CONTROL_MESSAGE_TIMESTAMP_FORMAT, "rfc3339")
+	options.SetDefault(CONTROL_MESSAGE_SIGNING, "none")
+	options.SetDefault(CONTROL_MESSAGE_SIGNING_KEY_FILE, "")
+	options.SetDefault(CONTROL_MESSAGE_REQUIRE_SIGNATURE, false)
+	options.SetDefault(CONTROL_MESSAGE_REPLAY_WINDOW, 300)
+	options.SetDefault(MQTT_CLIENT_ID, "")
+	options.SetDefault(MQTT_CLIENT_ID_UNIQUE_SUFFIX, false)
+	options.SetDefault(FACTS_ENRICHER_IMPL, "none")
+	options.SetDefault(STATIC_FACTS, "")
+	options.SetDefault(CLIENT_ID_TO_ACCOUNT_ID_IMPL, "config")
+	options.SetDefault(CLIENT_ID_TO_ACCOUNT_ID_CACHE_MAX_SIZE, 10000)
+	options.SetDefault(CLIENT_ID_TO_ACCOUNT_ID_CACHE_TTL, 600)
+	options.SetDefault(DEAD_LETTER_TOPIC, "platform.cloud-connector.dead-letter")
+	options.SetDefault(CLIENT_EVENTS_TOPIC, "platform.cloud-connector.client-events")
+	options.SetDefault(INVENTORY_TOPIC, "platform.inventory.host-ingress-p1")
+	options.SetDefault(CLIENT_EVENT_FORWARDING, false)
+	options.SetDefault(CONNECTION_COUNT_TOPIC, "platform.cloud-connector.connection-counts")
+	options.SetDefault(DELIVERY_CONFIRMATION, false)
+	options.SetDefault(DELIVERY_CONFIRMATION_TOPIC, "platform.receptor-controller.responses")
+	options.SetDefault(CONNECTION_COUNT_INTERVAL, 0)
+	options.SetDefault(CLIENT_COUNT_CACHE_INTERVAL, 30)
+	options.SetDefault(CONSISTENCY_CHECK_INTERVAL, 0)
+	options.SetDefault(CONSISTENCY_CHECK_SAMPLE_SIZE, 10)
+	options.SetDefault(CONSISTENCY_CHECK_PING_TIMEOUT, 5)
+	options.SetDefault(CONSISTENCY_CHECK_REPAIR, false)
+	options.SetDefault(STALE_CONNECTION_TTL, 0)
+	options.SetDefault(STALE_CONNECTION_REAPER_INTERVAL, 60)
+	options.SetDefault(CONNECTION_REGISTRAR_IMPL, "local")
+	options.SetDefault(REDIS_ADDRESS, "localhost:6379")
+	options.SetDefault(REDIS_PASSWORD, "")
+	options.SetDefault(REDIS_DB, 0)
+	options.SetDefault(REDIS_CONNECTION_TTL, 86400)
+	options.SetDefault(UNVERIFIABLE_TOPIC_HANDLING, "drop")
+	options.SetDefault(REQUIRE_COMMAND_CAPABILITY, false)
+	options.SetDefault(BACKPRESSURE_MESSAGE_THRESHOLD, 0)
+	options.SetDefault(BACKPRESSURE_WINDOW, 60)
+	options.SetDefault(BACKPRESSURE_MAX_THROTTLED_CLIENTS, 10)
+	options.SetDefault(BACKPRESSURE_THROTTLE_INTERVAL, 300)
+	options.SetDefault(ONLINE_MESSAGE_DEBOUNCE_WINDOW_MS, 0)
+	options.SetDefault(ONLINE_MESSAGE_DEBOUNCE_MAX_CLIENTS, 10000)
+	options.SetDefault(HANDSHAKE_REDACT_PII, true)
+	options.SetDefault(HANDSHAKE_DEBUG_MAX_SIZE, 16384)
+	options.SetDefault(CONNECTION_EVENT_PUBLISHER_IMPL, "none")
+	options.SetDefault(CONNECTION_EVENT_WEBHOOK_URL, "")
+	options.SetDefault(CONNECTION_EVENT_WEBHOOK_SECRET, "")
+	options.SetDefault(CONNECTION_EVENT_WEBHOOK_QUEUE_SIZE, 1000)
+	options.SetDefault(CONNECTION_EVENT_WEBHOOK_MAX_RETRIES, 3)
+	options.SetDefault(CONNECTION_EVENT_WEBHOOK_RETRY_DELAY, 1)
+	options.SetDefault(CONNECTION_EVENT_WEBHOOK_TIMEOUT, 5)
+	options.SetDefault(REQUIRE_ORG_ID, false)
+	options.SetDefault(SLOW_CONSUMER_WINDOW, 10)
+	options.SetDefault(SLOW_CONSUMER_DURATION, 0)
+	options.SetDefault(SLOW_CONSUMER_MAX_LAG, 30)
+	options.SetDefault(INVENTORY_REPORTER, "cloud-connector")
+	options.SetDefault(INVENTORY_REQUIRED_FACTS, "")
+	options.SetDefault(INVENTORY_INCLUDED_FACTS, []string{})
+	options.SetDefault(INVENTORY_OMITTED_FACTS, []string{})
+	options.SetDefault(DISPLAY_NAME_FACTS, []string{"fqdn", "subscription_manager_id", "insights_id"})
+	options.SetDefault(INVENTORY_IDENTITY_HEADER_VERSION, "v1")
+	options.SetDefault(INVENTORY_DELETE_EPHEMERAL_HOSTS, false)
+	options.SetDefault(INVENTORY_REGISTER_HOSTS, false)
+	options.SetDefault(INVENTORY_EPHEMERAL_ACCOUNTS, []string{})
+	options.SetDefault(INVENTORY_EPHEMERAL_DELETE_GRACE_PERIOD, 60)
+	options.SetDefault(FACTS_HASH_ALGORITHM, "sha256")
+	options.SetDefault(ONLINE_MESSAGE_DEDUP_TTL, 60)
+	options.SetDefault(PROCESSED_MESSAGE_STORE_IMPL, "local")
+	options.SetDefault(ONLINE_MESSAGE_DUPLICATE_WINDOW, 10)
+	options.SetDefault(CLEAR_RETAINED_CONNECTION_STATUS, true)
+	// The worker pool runs the handler on its own goroutines, so the handler is wrapped
+	// by the recover middleware again inside of the pool
+	options.SetDefault(MQTT_MESSAGE_HANDLER_MIDDLEWARES, []string{"recover", "backpressure", "worker_pool", "recover"})
+	options.SetDefault(MQTT_MESSAGE_WORKERS, 0)
+	options.SetDefault(MQTT_MESSAGE_WORKERS_PER_CPU, 4)
+	options.SetDefault(MQTT_MESSAGE_WORKER_QUEUE_SIZE, 100)
+	options.SetDefault(CONNECTION_QUOTA_MAX_PER_ACCOUNT, 0)
+	options.SetDefault(CONNECTION_QUOTA_MAX_ATTEMPTS_PER_CLIENT, 0)
+	options.SetDefault(CONNECTION_QUOTA_WINDOW, 60)
+	options.SetDefault(CONNECTION_QUOTA_RETRY_AFTER, 300)
 	options.SetEnvPrefix(ENV_PREFIX)
 	options.AutomaticEnv()
 
 	return &Config{
-		HttpShutdownTimeout:         options.GetDuration(HTTP_SHUTDOWN_TIMEOUT) * time.Second,
-		ServiceToServiceCredentials: options.GetStringMap(SERVICE_TO_SERVICE_CREDENTIALS),
-		Profile:                     options.GetBool(PROFILE),
-		KafkaBrokers:                options.GetStringSlice(BROKERS),
-		KafkaJobsTopic:              options.GetString(JOBS_TOPIC),
-		KafkaResponsesTopic:         options.GetString(RESPONSES_TOPIC),
-		KafkaResponsesBatchSize:     options.GetInt(RESPONSES_BATCH_SIZE),
-		KafkaResponsesBatchBytes:    options.GetInt(RESPONSES_BATCH_BYTES),
-		KafkaGroupID:                options.GetString(JOBS_GROUP_ID),
+		HttpShutdownTimeout:                 options.GetDuration(HTTP_SHUTDOWN_TIMEOUT) * time.Second,
+		ReadinessCheckTimeout:               options.GetDuration(READINESS_CHECK_TIMEOUT_MS) * time.Millisecond,
+		ReadinessRequireKafkaWrite:          options.GetBool(READINESS_REQUIRE_KAFKA_WRITE),
+		MqttConnectivityCheckInterval:       options.GetDuration(MQTT_CONNECTIVITY_CHECK_INTERVAL) * time.Second,
+		ServiceToServiceCredentials:         options.GetStringMap(SERVICE_TO_SERVICE_CREDENTIALS),
+		Profile:                             options.GetBool(PROFILE),
+		LogFormat:                           options.GetString(LOG_FORMAT),
+		LogLevel:                            options.GetString(LOG_LEVEL),
+		KafkaBrokers:                        options.GetStringSlice(BROKERS),
+		KafkaJobsTopic:                      options.GetString(JOBS_TOPIC),
+		KafkaResponsesTopic:                 options.GetString(RESPONSES_TOPIC),
+		KafkaResponsesBatchSize:             options.GetInt(RESPONSES_BATCH_SIZE),
+		KafkaResponsesBatchBytes:            options.GetInt(RESPONSES_BATCH_BYTES),
+		KafkaGroupID:                        options.GetString(JOBS_GROUP_ID),
+		KafkaJobsConsumerEnabled:            options.GetBool(JOBS_CONSUMER_ENABLED),
+		KafkaJobsSendTimeout:                options.GetDuration(JOBS_SEND_TIMEOUT) * time.Second,
+		KafkaJobsRetryInterval:              options.GetDuration(JOBS_RETRY_INTERVAL) * time.Second,
+		KafkaJobsMaxAttempts:                options.GetInt(JOBS_MAX_ATTEMPTS),
+		KafkaPausedTopicMode:                options.GetString(PAUSED_TOPIC_MODE),
+		KafkaPausedTopicBufferSize:          options.GetInt(PAUSED_TOPIC_BUFFER_SIZE),
+		KafkaPausedTopicResumeTimeout:       options.GetDuration(PAUSED_TOPIC_RESUME_TIMEOUT) * time.Second,
+		KafkaRequiredAcks:                   options.GetString(REQUIRED_ACKS),
+		KafkaLogWriteOutcomes:               options.GetBool(LOG_WRITE_OUTCOMES),
+		KafkaWriterWorkers:                  options.GetInt(WRITER_WORKERS),
+		KafkaWriterBufferSize:               options.GetInt(WRITER_BUFFER_SIZE),
+		KafkaWriteFailureFatal:              options.GetBool(WRITE_FAILURE_FATAL),
+		KafkaWriteRetryQueue:                options.GetBool(WRITE_RETRY_QUEUE),
+		KafkaWriteRetryQueueSize:            options.GetInt(WRITE_RETRY_QUEUE_SIZE),
+		KafkaCompressMessageValues:          options.GetBool(COMPRESS_MESSAGE_VALUES),
+		KafkaCompressionThreshold:           options.GetInt(COMPRESSION_THRESHOLD),
+		KafkaMaxDecompressedSize:            options.GetInt(MAX_DECOMPRESSED_SIZE),
+		KafkaWriteRetryInitialBackoff:       options.GetDuration(WRITE_RETRY_INITIAL_BACKOFF_MS) * time.Millisecond,
+		KafkaWriteRetryMaxBackoff:           options.GetDuration(WRITE_RETRY_MAX_BACKOFF) * time.Second,
+		InvalidHandshakeReconnectDelay:      options.GetInt(INVALID_HANDSHAKE_RECONNECT_DELAY),
+		ReconnectDelayMin:                   options.GetInt(RECONNECT_DELAY_MIN),
+		ReconnectDelayMax:                   options.GetInt(RECONNECT_DELAY_MAX),
+		PendingCommandTTL:                   options.GetDuration(PENDING_COMMAND_TTL) * time.Second,
+		PendingCommandMax:                   options.GetInt(PENDING_COMMAND_MAX),
+		DefaultDataDirective:                options.GetString(DEFAULT_DATA_DIRECTIVE),
+		LastErrorMaxClients:                 options.GetInt(LAST_ERROR_MAX_CLIENTS),
+		LastErrorTTL:                        options.GetDuration(LAST_ERROR_TTL) * time.Second,
+		MqttBrokerTlsSessionCacheSize:       options.GetInt(MQTT_BROKER_TLS_SESSION_CACHE_SIZE),
+		MqttBrokerTlsSessionTicketsDisabled: options.GetBool(MQTT_BROKER_TLS_DISABLE_SESSION_TICKETS),
+		MqttBrokerTlsRenegotiation:          options.GetString(MQTT_BROKER_TLS_RENEGOTIATION),
+		MqttBrokerMaxMessageSize:            options.GetInt(MQTT_BROKER_MAX_MESSAGE_SIZE),
+		MqttBrokerResumeSubs:                options.GetBool(MQTT_BROKER_RESUME_SUBS),
+		MqttBrokerOrderMatters:              options.GetBool(MQTT_BROKER_ORDER_MATTERS),
+		MqttConnectRetry:                    options.GetBool(MQTT_CONNECT_RETRY),
+		MqttConnectRetryInterval:            options.GetDuration(MQTT_CONNECT_RETRY_INTERVAL) * time.Second,
+		MqttConnectMaxAttempts:              options.GetInt(MQTT_CONNECT_MAX_ATTEMPTS),
+		MqttConnectBackoffInitialInterval:   options.GetDuration(MQTT_CONNECT_BACKOFF_INITIAL_INTERVAL) * time.Second,
+		MqttConnectBackoffMaxInterval:       options.GetDuration(MQTT_CONNECT_BACKOFF_MAX_INTERVAL) * time.Second,
+		MqttKeepAlive:                       options.GetDuration(MQTT_KEEP_ALIVE) * time.Second,
+		MqttPingTimeout:                     options.GetDuration(MQTT_PING_TIMEOUT) * time.Second,
+		MqttMaxReconnectInterval:            options.GetDuration(MQTT_MAX_RECONNECT_INTERVAL) * time.Second,
+		MqttDisconnectQuiesce:               options.GetDuration(MQTT_DISCONNECT_QUIESCE_MS) * time.Millisecond,
+		MqttShutdownDrainTimeout:            options.GetDuration(MQTT_SHUTDOWN_DRAIN_TIMEOUT) * time.Second,
+		MqttReconnectMessageQos:             byte(options.GetUint(MQTT_RECONNECT_MESSAGE_QOS)),
+		MqttPublishAckTimeout:               options.GetDuration(MQTT_PUBLISH_ACK_TIMEOUT) * time.Second,
+		MqttPongTimeout:                     options.GetDuration(MQTT_PONG_TIMEOUT) * time.Second,
+		MqttDataMessageChunkSize:            options.GetInt(MQTT_DATA_MESSAGE_CHUNK_SIZE),
+		MaxMessageSizeBytes:                 options.GetInt(MAX_MESSAGE_SIZE_BYTES),
+		MaxMessageSizeBytesPerDirective:     options.GetStringMapString(MAX_MESSAGE_SIZE_BYTES_PER_DIRECTIVE),
+		SourcesDispatchers:                  options.GetStringMapStringSlice(SOURCES_DISPATCHERS),
+		SourcesIdentityHeaderVersion:        options.GetString(SOURCES_IDENTITY_HEADER_VERSION),
+		SourcesRecorderImpl:                 options.GetString(SOURCES_RECORDER_IMPL),
+		SourcesBaseUrl:                      options.GetString(SOURCES_BASE_URL),
+		SourcesHttpTimeout:                  options.GetDuration(SOURCES_HTTP_TIMEOUT) * time.Second,
+		SourcesHttpMaxRetries:               options.GetInt(SOURCES_HTTP_MAX_RETRIES),
+		SourcesHttpRetryDelay:               options.GetDuration(SOURCES_HTTP_RETRY_DELAY) * time.Second,
+		DispatcherChangeHandling:            options.GetString(DISPATCHER_CHANGE_HANDLING),
+		DispatcherChangeRetention:           options.GetDuration(DISPATCHER_CHANGE_RETENTION) * time.Second,
+		DuplicateConnectionHandling:         options.GetString(DUPLICATE_CONNECTION_HANDLING),
+		MaxControlMessageAge:                options.GetDuration(MAX_CONTROL_MESSAGE_AGE) * time.Second,
+		ControlMessageProcessingTimeout:     options.GetDuration(CONTROL_MESSAGE_PROCESSING_TIMEOUT) * time.Second,
+		MaxControlMessageSize:               options.GetInt(MAX_CONTROL_MESSAGE_SIZE),
+		OversizedControlMessageDisconnect:   options.GetBool(OVERSIZED_CONTROL_MESSAGE_DISCONNECT),
+		ControlMessageTimestampFormat:       options.GetString(CONTROL_MESSAGE_TIMESTAMP_FORMAT),
+		ControlMessageSigning:               options.GetString(CONTROL_MESSAGE_SIGNING),
+		ControlMessageSigningKeyFile:        options.GetString(CONTROL_MESSAGE_SIGNING_KEY_FILE),
+		ControlMessageRequireSignature:      options.GetBool(CONTROL_MESSAGE_REQUIRE_SIGNATURE),
+		ControlMessageReplayWindow:          options.GetDuration(CONTROL_MESSAGE_REPLAY_WINDOW) * time.Second,
+		MqttClientId:                        options.GetString(MQTT_CLIENT_ID),
+		MqttClientIdUniqueSuffix:            options.GetBool(MQTT_CLIENT_ID_UNIQUE_SUFFIX),
+		FactsEnricherImpl:                   options.GetString(FACTS_ENRICHER_IMPL),
+		StaticFacts:                         options.GetStringMapString(STATIC_FACTS),
+		ClientIdToAccountIdImpl:             options.GetString(CLIENT_ID_TO_ACCOUNT_ID_IMPL),
+		ClientIdToAccountIdCacheMaxSize:     options.GetInt(CLIENT_ID_TO_ACCOUNT_ID_CACHE_MAX_SIZE),
+		ClientIdToAccountIdCacheTTL:         options.GetDuration(CLIENT_ID_TO_ACCOUNT_ID_CACHE_TTL) * time.Second,
+		KafkaDeadLetterTopic:                options.GetString(DEAD_LETTER_TOPIC),
+		KafkaClientEventsTopic:              options.GetString(CLIENT_EVENTS_TOPIC),
+		KafkaInventoryTopic:                 options.GetString(INVENTORY_TOPIC),
+		ClientEventForwarding:               options.GetBool(CLIENT_EVENT_FORWARDING),
+		KafkaConnectionCountTopic:           options.GetString(CONNECTION_COUNT_TOPIC),
+		DataMessageDeliveryConfirmation:     options.GetBool(DELIVERY_CONFIRMATION),
+		KafkaDeliveryConfirmationTopic:      options.GetString(DELIVERY_CONFIRMATION_TOPIC),
+		ConnectionCountInterval:             options.GetDuration(CONNECTION_COUNT_INTERVAL) * time.Second,
+		ClientCountCacheInterval:            options.GetDuration(CLIENT_COUNT_CACHE_INTERVAL) * time.Second,
+		ConsistencyCheckInterval:            options.GetDuration(CONSISTENCY_CHECK_INTERVAL) * time.Second,
+		ConsistencyCheckSampleSize:          options.GetInt(CONSISTENCY_CHECK_SAMPLE_SIZE),
+		ConsistencyCheckPingTimeout:         options.GetDuration(CONSISTENCY_CHECK_PING_TIMEOUT) * time.Second,
+		ConsistencyCheckRepair:              options.GetBool(CONSISTENCY_CHECK_REPAIR),
+		StaleConnectionTTL:                  options.GetDuration(STALE_CONNECTION_TTL) * time.Second,
+		StaleConnectionReaperInterval:       options.GetDuration(STALE_CONNECTION_REAPER_INTERVAL) * time.Second,
+		ConnectionRegistrarImpl:             options.GetString(CONNECTION_REGISTRAR_IMPL),
+		RedisAddress:                        options.GetString(REDIS_ADDRESS),
+		RedisPassword:                       options.GetString(REDIS_PASSWORD),
+		RedisDB:                             options.GetInt(REDIS_DB),
+		RedisConnectionTTL:                  options.GetDuration(REDIS_CONNECTION_TTL) * time.Second,
+		UnverifiableTopicHandling:           options.GetString(UNVERIFIABLE_TOPIC_HANDLING),
+		RequireCommandCapability:            options.GetBool(REQUIRE_COMMAND_CAPABILITY),
+		BackpressureMessageThreshold:        options.GetInt(BACKPRESSURE_MESSAGE_THRESHOLD),
+		BackpressureWindow:                  options.GetDuration(BACKPRESSURE_WINDOW) * time.Second,
+		BackpressureMaxThrottledClients:     options.GetInt(BACKPRESSURE_MAX_THROTTLED_CLIENTS),
+		BackpressureThrottleInterval:        options.GetInt(BACKPRESSURE_THROTTLE_INTERVAL),
+		OnlineMessageDebounceWindow:         options.GetDuration(ONLINE_MESSAGE_DEBOUNCE_WINDOW_MS) * time.Millisecond,
+		OnlineMessageDebounceMaxClients:     options.GetInt(ONLINE_MESSAGE_DEBOUNCE_MAX_CLIENTS),
+		HandshakeRedactPII:                  options.GetBool(HANDSHAKE_REDACT_PII),
+		HandshakeDebugMaxSize:               options.GetInt(HANDSHAKE_DEBUG_MAX_SIZE),
+		ConnectionEventPublisherImpl:        options.GetString(CONNECTION_EVENT_PUBLISHER_IMPL),
+		ConnectionEventWebhookUrl:           options.GetString(CONNECTION_EVENT_WEBHOOK_URL),
+		ConnectionEventWebhookSecret:        options.GetString(CONNECTION_EVENT_WEBHOOK_SECRET),
+		ConnectionEventWebhookQueueSize:     options.GetInt(CONNECTION_EVENT_WEBHOOK_QUEUE_SIZE),
+		ConnectionEventWebhookMaxRetries:    options.GetInt(CONNECTION_EVENT_WEBHOOK_MAX_RETRIES),
+		ConnectionEventWebhookRetryDelay:    options.GetDuration(CONNECTION_EVENT_WEBHOOK_RETRY_DELAY) * time.Second,
+		ConnectionEventWebhookTimeout:       options.GetDuration(CONNECTION_EVENT_WEBHOOK_TIMEOUT) * time.Second,
+		RequireOrgId:                        options.GetBool(REQUIRE_ORG_ID),
+		SlowConsumerWindow:                  options.GetDuration(SLOW_CONSUMER_WINDOW) * time.Second,
+		SlowConsumerDuration:                options.GetDuration(SLOW_CONSUMER_DURATION) * time.Second,
+		SlowConsumerMaxLag:                  options.GetDuration(SLOW_CONSUMER_MAX_LAG) * time.Second,
+		InventoryReporter:                   options.GetString(INVENTORY_REPORTER),
+		InventoryRequiredFacts:              options.GetStringMapStringSlice(INVENTORY_REQUIRED_FACTS),
+		InventoryIncludedFacts:              options.GetStringSlice(INVENTORY_INCLUDED_FACTS),
+		InventoryOmittedFacts:               options.GetStringSlice(INVENTORY_OMITTED_FACTS),
+		DisplayNameFacts:                    options.GetStringSlice(DISPLAY_NAME_FACTS),
+		InventoryIdentityHeaderVersion:      options.GetString(INVENTORY_IDENTITY_HEADER_VERSION),
+		InventoryDeleteEphemeralHosts:       options.GetBool(INVENTORY_DELETE_EPHEMERAL_HOSTS),
+		InventoryRegisterHosts:              options.GetBool(INVENTORY_REGISTER_HOSTS),
+		InventoryEphemeralAccounts:          options.GetStringSlice(INVENTORY_EPHEMERAL_ACCOUNTS),
+		InventoryEphemeralDeleteGracePeriod: options.GetDuration(INVENTORY_EPHEMERAL_DELETE_GRACE_PERIOD) * time.Second,
+		FactsHashAlgorithm:                  options.GetString(FACTS_HASH_ALGORITHM),
+		OnlineMessageDedupTTL:               options.GetDuration(ONLINE_MESSAGE_DEDUP_TTL) * time.Second,
+		ProcessedMessageStoreImpl:           options.GetString(PROCESSED_MESSAGE_STORE_IMPL),
+		OnlineMessageDuplicateWindow:        options.GetDuration(ONLINE_MESSAGE_DUPLICATE_WINDOW) * time.Second,
+		ClearRetainedConnectionStatus:       options.GetBool(CLEAR_RETAINED_CONNECTION_STATUS),
+		MqttMessageHandlerMiddlewares:       options.GetStringSlice(MQTT_MESSAGE_HANDLER_MIDDLEWARES),
+		MqttMessageWorkers:                  options.GetInt(MQTT_MESSAGE_WORKERS),
+		MqttMessageWorkersPerCpu:            options.GetInt(MQTT_MESSAGE_WORKERS_PER_CPU),
+		MqttMessageWorkerQueueSize:          options.GetInt(MQTT_MESSAGE_WORKER_QUEUE_SIZE),
+		ConnectionQuotaMaxPerAccount:        options.GetInt(CONNECTION_QUOTA_MAX_PER_ACCOUNT),
+		ConnectionQuotaMaxAttemptsPerClient: options.GetInt(CONNECTION_QUOTA_MAX_ATTEMPTS_PER_CLIENT),
+		ConnectionQuotaWindow:               options.GetDuration(CONNECTION_QUOTA_WINDOW) * time.Second,
+		ConnectionQuotaRetryAfter:           options.GetInt(CONNECTION_QUOTA_RETRY_AFTER),
 	}
 }
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ValidationError lists all of the problems found with the configuration so that
+// they can be fixed at once instead of one restart at a time
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "Invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks the options (and the combinations of options) that would otherwise
+// cause hard to diagnose failures at runtime
+func (c *Config) Validate() error {
+	var problems []string
+
+	invalid := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if len(c.KafkaBrokers) == 0 {
+		invalid("%s must contain at least one broker", BROKERS)
+	}
+
+	for _, broker := range c.KafkaBrokers {
+		if host, port, err := net.SplitHostPort(broker); err != nil || host == "" || port == "" {
+			invalid("%s contains an invalid broker address (%s), expected host:port", BROKERS, broker)
+		}
+	}
+
+	if c.KafkaResponsesBatchSize <= 0 {
+		invalid("%s must be greater than 0", RESPONSES_BATCH_SIZE)
+	}
+
+	if c.KafkaResponsesBatchBytes <= 0 {
+		invalid("%s must be greater than 0", RESPONSES_BATCH_BYTES)
+	}
+
+	if c.KafkaWriterWorkers <= 0 {
+		invalid("%s must be greater than 0", WRITER_WORKERS)
+	}
+
+	if c.MqttMessageWorkerQueueSize <= 0 {
+		invalid("%s must be greater than 0", MQTT_MESSAGE_WORKER_QUEUE_SIZE)
+	}
+
+	if c.PendingCommandMax < 0 {
+		invalid("%s must not be negative", PENDING_COMMAND_MAX)
+	}
+
+	if c.KafkaWriterBufferSize < 0 {
+		invalid("%s must not be negative", WRITER_BUFFER_SIZE)
+	}
+
+	if c.KafkaDeadLetterTopic == "" {
+		invalid("%s is required", DEAD_LETTER_TOPIC)
+	}
+
+	if c.KafkaJobsConsumerEnabled && (c.KafkaJobsTopic == "" || c.KafkaResponsesTopic == "" || c.KafkaGroupID == "") {
+		invalid("%s, %s and %s are required when %s is enabled", JOBS_TOPIC, RESPONSES_TOPIC, JOBS_GROUP_ID, JOBS_CONSUMER_ENABLED)
+	}
+
+	if c.KafkaJobsConsumerEnabled && c.KafkaJobsMaxAttempts <= 0 {
+		invalid("%s must be greater than 0 when %s is enabled", JOBS_MAX_ATTEMPTS, JOBS_CONSUMER_ENABLED)
+	}
+
+	if c.ClientEventForwarding && c.KafkaClientEventsTopic == "" {
+		invalid("%s is required when %s is enabled", CLIENT_EVENTS_TOPIC, CLIENT_EVENT_FORWARDING)
+	}
+
+	if c.InventoryDeleteEphemeralHosts && c.KafkaInventoryTopic == "" {
+		invalid("%s is required when %s is enabled", INVENTORY_TOPIC, INVENTORY_DELETE_EPHEMERAL_HOSTS)
+	}
+
+	if c.InventoryRegisterHosts && c.KafkaInventoryTopic == "" {
+		invalid("%s is required when %s is enabled", INVENTORY_TOPIC, INVENTORY_REGISTER_HOSTS)
+	}
+
+	if c.InventoryEphemeralDeleteGracePeriod < 0 {
+		invalid("%s must not be negative", INVENTORY_EPHEMERAL_DELETE_GRACE_PERIOD)
+	}
+
+	if c.ConnectionCountInterval > 0 && c.KafkaConnectionCountTopic == "" {
+		invalid("%s is required when %s is set", CONNECTION_COUNT_TOPIC, CONNECTION_COUNT_INTERVAL)
+	}
+
+	if c.DataMessageDeliveryConfirmation && c.KafkaDeliveryConfirmationTopic == "" {
+		invalid("%s is required when %s is enabled", DELIVERY_CONFIRMATION_TOPIC, DELIVERY_CONFIRMATION)
+	}
+
+	if c.KafkaWriteRetryQueue && c.KafkaWriteRetryQueueSize <= 0 {
+		invalid("%s must be greater than 0 when %s is enabled", WRITE_RETRY_QUEUE_SIZE, WRITE_RETRY_QUEUE)
+	}
+
+	if c.KafkaCompressionThreshold < 0 {
+		invalid("%s must not be negative", COMPRESSION_THRESHOLD)
+	}
+
+	if c.KafkaMaxDecompressedSize <= 0 {
+		invalid("%s must be greater than 0", MAX_DECOMPRESSED_SIZE)
+	}
+
+	if c.MqttKeepAlive > 0 && c.MqttPingTimeout >= c.MqttKeepAlive {
+		invalid("%s must be less than %s", MQTT_PING_TIMEOUT, MQTT_KEEP_ALIVE)
+	}
+
+	if c.MqttPongTimeout <= 0 {
+		invalid("%s must be greater than 0", MQTT_PONG_TIMEOUT)
+	}
+
+	if c.ControlMessageRequireSignature && c.ControlMessageReplayWindow <= 0 {
+		invalid("%s must be greater than 0 when %s is enabled", CONTROL_MESSAGE_REPLAY_WINDOW, CONTROL_MESSAGE_REQUIRE_SIGNATURE)
+	}
+
+	if c.ClientCountCacheInterval <= 0 {
+		invalid("%s must be greater than 0", CLIENT_COUNT_CACHE_INTERVAL)
+	}
+
+	if c.ConnectionRegistrarImpl != "local" && c.ConnectionRegistrarImpl != "redis" {
+		invalid("%s must be local or redis", CONNECTION_REGISTRAR_IMPL)
+	}
+
+	if c.ProcessedMessageStoreImpl != "local" && c.ProcessedMessageStoreImpl != "redis" {
+		invalid("%s must be local or redis", PROCESSED_MESSAGE_STORE_IMPL)
+	}
+
+	// The redis connection registrar, the redis processed message store and the cert
+	// account resolver share the redis config
+	if c.ConnectionRegistrarImpl == "redis" || c.ProcessedMessageStoreImpl == "redis" || c.ClientIdToAccountIdImpl == "cert" {
+		if c.RedisAddress == "" {
+			invalid("%s is required when %s or %s is redis or %s is cert", REDIS_ADDRESS, CONNECTION_REGISTRAR_IMPL, PROCESSED_MESSAGE_STORE_IMPL, CLIENT_ID_TO_ACCOUNT_ID_IMPL)
+		}
+		if c.RedisConnectionTTL <= 0 {
+			invalid("%s must be greater than 0", REDIS_CONNECTION_TTL)
+		}
+	}
+
+	if c.StaleConnectionTTL > 0 && c.StaleConnectionReaperInterval <= 0 {
+		invalid("%s must be greater than 0 when %s is set", STALE_CONNECTION_REAPER_INTERVAL, STALE_CONNECTION_TTL)
+	}
+
+	if c.MqttConnectMaxAttempts < 1 {
+		invalid("%s must be at least 1", MQTT_CONNECT_MAX_ATTEMPTS)
+	}
+
+	// paho retries the connection on its own until it succeeds when MQTT_Connect_Retry
+	// is enabled, so the connection attempts would never be counted against the max
+	if c.MqttConnectRetry && c.MqttConnectMaxAttempts > 1 {
+		invalid("%s cannot be enabled when %s is greater than 1, use one or the other", MQTT_CONNECT_RETRY, MQTT_CONNECT_MAX_ATTEMPTS)
+	}
+
+	if c.MqttConnectBackoffMaxInterval < c.MqttConnectBackoffInitialInterval {
+		invalid("%s must not be less than %s", MQTT_CONNECT_BACKOFF_MAX_INTERVAL, MQTT_CONNECT_BACKOFF_INITIAL_INTERVAL)
+	}
+
+	if c.SourcesRecorderImpl == "http" && c.SourcesBaseUrl == "" {
+		invalid("%s is required when %s is http", SOURCES_BASE_URL, SOURCES_RECORDER_IMPL)
+	}
+
+	if c.SourcesRecorderImpl == "http" && c.SourcesHttpTimeout <= 0 {
+		invalid("%s must be greater than 0 when %s is http", SOURCES_HTTP_TIMEOUT, SOURCES_RECORDER_IMPL)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
@@ -0,0 +1,232 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultConfigIsValid(t *testing.T) {
+	if err := GetConfig().Validate(); err != nil {
+		t.Fatalf("Expected the default configuration to be valid, but got %s", err)
+	}
+}
+
+func TestValidateAggregatesProblems(t *testing.T) {
+	cfg := GetConfig()
+	cfg.KafkaBrokers = []string{"kafka:9092", "kafka"}
+	cfg.KafkaResponsesBatchSize = 0
+	cfg.KafkaResponsesBatchBytes = -1
+	cfg.ClientEventForwarding = true
+	cfg.KafkaClientEventsTopic = ""
+
+	err := cfg.Validate()
+
+	validationErr, ok := err.(*ValidationError)
+	if ok == false {
+		t.Fatalf("Expected a ValidationError, but got %v", err)
+	}
+
+	if len(validationErr.Problems) != 4 {
+		t.Fatalf("Expected 4 problems, but got %d: %s", len(validationErr.Problems), err)
+	}
+
+	for _, option := range []string{BROKERS, RESPONSES_BATCH_SIZE, RESPONSES_BATCH_BYTES, CLIENT_EVENTS_TOPIC} {
+		if strings.Contains(err.Error(), option) == false {
+			t.Fatalf("Expected the error to mention %s, but got %s", option, err)
+		}
+	}
+}
+
+func TestValidateRequiresBrokers(t *testing.T) {
+	cfg := GetConfig()
+	cfg.KafkaBrokers = nil
+
+	if err := cfg.Validate(); err == nil || strings.Contains(err.Error(), BROKERS) == false {
+		t.Fatalf("Expected an error about the missing brokers, but got %v", err)
+	}
+}
+
+func TestValidateRequiresSourcesBaseUrl(t *testing.T) {
+	cfg := GetConfig()
+	cfg.SourcesRecorderImpl = "http"
+	cfg.SourcesBaseUrl = ""
+
+	if err := cfg.Validate(); err == nil || strings.Contains(err.Error(), SOURCES_BASE_URL) == false {
+		t.Fatalf("Expected an error about the missing sources base url, but got %v", err)
+	}
+}
+
+func TestValidateRequiresSourcesHttpTimeout(t *testing.T) {
+	cfg := GetConfig()
+	cfg.SourcesRecorderImpl = "http"
+	cfg.SourcesHttpTimeout = 0
+
+	if err := cfg.Validate(); err == nil || strings.Contains(err.Error(), SOURCES_HTTP_TIMEOUT) == false {
+		t.Fatalf("Expected an error about the sources http timeout, but got %v", err)
+	}
+}
+
+func TestValidateRequiresJobsMaxAttempts(t *testing.T) {
+	cfg := GetConfig()
+	cfg.KafkaJobsConsumerEnabled = true
+	cfg.KafkaJobsMaxAttempts = 0
+
+	if err := cfg.Validate(); err == nil || strings.Contains(err.Error(), JOBS_MAX_ATTEMPTS) == false {
+		t.Fatalf("Expected an error about the jobs max attempts, but got %v", err)
+	}
+}
+
+func TestValidatePingTimeoutShorterThanKeepAlive(t *testing.T) {
+	cfg := GetConfig()
+	cfg.MqttKeepAlive = 10 * time.Second
+	cfg.MqttPingTimeout = 10 * time.Second
+
+	if err := cfg.Validate(); err == nil || strings.Contains(err.Error(), MQTT_PING_TIMEOUT) == false {
+		t.Fatalf("Expected an error about the ping timeout, but got %v", err)
+	}
+}
+
+func TestValidateRequiresReplayWindowForSignatures(t *testing.T) {
+	cfg := GetConfig()
+	cfg.ControlMessageReplayWindow = 0
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected the replay window to be ignored without signatures, but got %v", err)
+	}
+
+	cfg.ControlMessageRequireSignature = true
+
+	if err := cfg.Validate(); err == nil || strings.Contains(err.Error(), CONTROL_MESSAGE_REPLAY_WINDOW) == false {
+		t.Fatalf("Expected an error about the replay window, but got %v", err)
+	}
+}
+
+func TestValidateRequiresPongTimeout(t *testing.T) {
+	cfg := GetConfig()
+	cfg.MqttPongTimeout = 0
+
+	if err := cfg.Validate(); err == nil || strings.Contains(err.Error(), MQTT_PONG_TIMEOUT) == false {
+		t.Fatalf("Expected an error about the pong timeout, but got %v", err)
+	}
+}
+
+func TestValidateConnectBackoff(t *testing.T) {
+	cfg := GetConfig()
+	cfg.MqttConnectMaxAttempts = 0
+	cfg.MqttConnectBackoffInitialInterval = 10 * time.Second
+	cfg.MqttConnectBackoffMaxInterval = 5 * time.Second
+
+	err := cfg.Validate()
+
+	for _, option := range []string{MQTT_CONNECT_MAX_ATTEMPTS, MQTT_CONNECT_BACKOFF_MAX_INTERVAL} {
+		if err == nil || strings.Contains(err.Error(), option) == false {
+			t.Fatalf("Expected the error to mention %s, but got %v", option, err)
+		}
+	}
+}
+
+func TestValidateStaleConnectionReaperInterval(t *testing.T) {
+	cfg := GetConfig()
+	cfg.StaleConnectionReaperInterval = 0
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected the interval to be ignored while reaping is disabled, but got %s", err)
+	}
+
+	cfg.StaleConnectionTTL = 5 * time.Minute
+
+	if err := cfg.Validate(); err == nil || strings.Contains(err.Error(), STALE_CONNECTION_REAPER_INTERVAL) == false {
+		t.Fatalf("Expected an error about the reaper interval, but got %v", err)
+	}
+}
+
+func TestValidateRedisConfig(t *testing.T) {
+	cfg := GetConfig()
+	cfg.ConnectionRegistrarImpl = "sql"
+
+	if err := cfg.Validate(); err == nil || strings.Contains(err.Error(), CONNECTION_REGISTRAR_IMPL) == false {
+		t.Fatalf("Expected an error about the connection registrar, but got %v", err)
+	}
+
+	cfg.ConnectionRegistrarImpl = "local"
+	cfg.ClientIdToAccountIdImpl = "cert"
+	cfg.RedisAddress = ""
+	cfg.RedisConnectionTTL = 0
+
+	err := cfg.Validate()
+
+	for _, option := range []string{REDIS_ADDRESS, REDIS_CONNECTION_TTL} {
+		if err == nil || strings.Contains(err.Error(), option) == false {
+			t.Fatalf("Expected the error to mention %s, but got %v", option, err)
+		}
+	}
+}
+
+func TestValidateProcessedMessageStoreConfig(t *testing.T) {
+	cfg := GetConfig()
+	cfg.ProcessedMessageStoreImpl = "memcached"
+
+	if err := cfg.Validate(); err == nil || strings.Contains(err.Error(), PROCESSED_MESSAGE_STORE_IMPL) == false {
+		t.Fatalf("Expected an error about the processed message store, but got %v", err)
+	}
+
+	cfg.ProcessedMessageStoreImpl = "redis"
+	cfg.RedisAddress = ""
+
+	if err := cfg.Validate(); err == nil || strings.Contains(err.Error(), REDIS_ADDRESS) == false {
+		t.Fatalf("Expected an error about the redis address, but got %v", err)
+	}
+}
+
+func TestValidateRejectsConflictingConnectRetries(t *testing.T) {
+	cfg := GetConfig()
+	cfg.MqttConnectRetry = true
+	cfg.MqttConnectMaxAttempts = 5
+
+	if err := cfg.Validate(); err == nil || strings.Contains(err.Error(), MQTT_CONNECT_RETRY) == false {
+		t.Fatalf("Expected an error about the conflicting connect retries, but got %v", err)
+	}
+
+	cfg.MqttConnectMaxAttempts = 1
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Unexpected error when only paho retries the connection: %v", err)
+	}
+}
+
+func TestValidateEphemeralHostConfig(t *testing.T) {
+	cfg := GetConfig()
+	cfg.InventoryDeleteEphemeralHosts = true
+	cfg.KafkaInventoryTopic = ""
+	cfg.InventoryEphemeralDeleteGracePeriod = -1 * time.Second
+
+	err := cfg.Validate()
+
+	for _, option := range []string{INVENTORY_TOPIC, INVENTORY_EPHEMERAL_DELETE_GRACE_PERIOD} {
+		if err == nil || strings.Contains(err.Error(), option) == false {
+			t.Fatalf("Expected the error to mention %s, but got %v", option, err)
+		}
+	}
+}
+
+func TestValidateRequiresInventoryTopicToRegisterHosts(t *testing.T) {
+	cfg := GetConfig()
+	cfg.InventoryRegisterHosts = true
+	cfg.KafkaInventoryTopic = ""
+
+	err := cfg.Validate()
+	if err == nil || strings.Contains(err.Error(), INVENTORY_REGISTER_HOSTS) == false {
+		t.Fatalf("Expected the error to mention %s, but got %v", INVENTORY_REGISTER_HOSTS, err)
+	}
+}
+
+func TestValidateRequiresDeliveryConfirmationTopic(t *testing.T) {
+	cfg := GetConfig()
+	cfg.DataMessageDeliveryConfirmation = true
+	cfg.KafkaDeliveryConfirmationTopic = ""
+
+	if err := cfg.Validate(); err == nil || strings.Contains(err.Error(), DELIVERY_CONFIRMATION_TOPIC) == false {
+		t.Fatalf("Expected an error about the missing delivery confirmation topic, but got %v", err)
+	}
+}
@@ -2,19 +2,28 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/RedHatInsights/cloud-connector/internal/domain"
 )
 
+var ErrInvalidAccountIdResolver = errors.New("Invalid account id resolver")
+
+const cachedAccountIdResolverPrefix = "cached-"
+
+// AccountIdResolver looks up the account and the org id that the client belongs to.
+// The org id is empty if the client's identity does not include one.
 type AccountIdResolver interface {
-	MapClientIdToAccountId(context.Context, domain.ClientID) (domain.AccountID, error)
+	MapClientIdToAccountId(context.Context, domain.ClientID) (domain.AccountID, domain.OrgID, error)
 }
 
 type BOPAccountIdResolver struct {
 }
 
-func (bar *BOPAccountIdResolver) MapClientIdToAccountId(ctx context.Context, clientID domain.ClientID) (domain.AccountID, error) {
+func (bar *BOPAccountIdResolver) MapClientIdToAccountId(ctx context.Context, clientID domain.ClientID) (domain.AccountID, domain.OrgID, error) {
 	// FIXME: need to lookup the account number for the connected client
 	fmt.Println("FIXME: looking up the connection's account number in BOP")
 
@@ -37,20 +46,50 @@ func (bar *BOPAccountIdResolver) MapClientIdToAccountId(ctx context.Context, cli
 
 	*/
 
-	return "010101", nil
+	return "010101", "", nil
 }
 
 type ConfigurableAccountIdResolver struct {
 }
 
-func (bar *ConfigurableAccountIdResolver) MapClientIdToAccountId(ctx context.Context, clientID domain.ClientID) (domain.AccountID, error) {
+func (bar *ConfigurableAccountIdResolver) MapClientIdToAccountId(ctx context.Context, clientID domain.ClientID) (domain.AccountID, domain.OrgID, error) {
 	// FIXME:  Make this configurable...this should be helpful in testing until we can get BOP / 3scale wired up correctly
 	switch clientID {
 	case "client-0":
-		return domain.AccountID("010101"), nil
+		return domain.AccountID("010101"), domain.OrgID("1010101"), nil
 	case "client-1":
-		return domain.AccountID("010102"), nil
+		return domain.AccountID("010102"), domain.OrgID("1010102"), nil
+	default:
+		return domain.AccountID("0000001"), "", nil
+	}
+}
+
+// NewAccountIdResolver creates the account id resolver.  Prefixing the implementation
+// with "cached-" (cached-bop for example) caches the accounts that the resolver returns.
+// The cert resolver cannot be cached.  It keeps the client identities in redis.
+func NewAccountIdResolver(impl string, cacheMaxSize int, cacheTTL time.Duration, redisCfg RedisConfig, metrics *Metrics) (AccountIdResolver, error) {
+	cached := strings.HasPrefix(impl, cachedAccountIdResolverPrefix)
+
+	var resolver AccountIdResolver
+	switch strings.TrimPrefix(impl, cachedAccountIdResolverPrefix) {
+	case "config":
+		resolver = &ConfigurableAccountIdResolver{}
+	case "bop":
+		resolver = &BOPAccountIdResolver{}
+	case "cert":
+		if cached {
+			// The identity is recorded again each time the client connects, so a
+			// cached identity could be out of date
+			return nil, ErrInvalidAccountIdResolver
+		}
+		return NewCertBasedAccountIdResolver(NewRedisClient(redisCfg.Address, redisCfg.Password, redisCfg.DB), redisCfg.TTL, metrics), nil
 	default:
-		return domain.AccountID("0000001"), nil
+		return nil, ErrInvalidAccountIdResolver
 	}
+
+	if cached {
+		return NewCachingAccountIdResolver(resolver, cacheMaxSize, cacheTTL, metrics), nil
+	}
+
+	return resolver, nil
 }
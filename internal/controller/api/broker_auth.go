@@ -0,0 +1,141 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/middlewares"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+	"github.com/redhatinsights/platform-go-middlewares/request_id"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	BROKER_AUTH_ALLOW = "allow"
+	BROKER_AUTH_DENY  = "deny"
+
+	BROKER_AUTH_REASON_INVALID_CERTIFICATE = "invalid_certificate"
+)
+
+// BrokerAuthServer provides the callback that the broker's auth plugin invokes before
+// it accepts a client's connection
+type BrokerAuthServer struct {
+	quota        *controller.ConnectionQuota
+	certRecorder controller.CertificateSubjectRecorder
+	router       *mux.Router
+	config       *config.Config
+}
+
+// NewBrokerAuthServer creates the broker auth server.  The certificate subject recorder
+// is optional.  When it is provided, the subject of the client's certificate is recorded
+// before the client's quota is checked.
+func NewBrokerAuthServer(quota *controller.ConnectionQuota, certRecorder controller.CertificateSubjectRecorder, r *mux.Router, cfg *config.Config) *BrokerAuthServer {
+	return &BrokerAuthServer{
+		quota:        quota,
+		certRecorder: certRecorder,
+		router:       r,
+		config:       cfg,
+	}
+}
+
+func (s *BrokerAuthServer) Routes() {
+	mmw := &middlewares.MetricsMiddleware{}
+	amw := &middlewares.AuthMiddleware{Secrets: s.config.ServiceToServiceCredentials}
+
+	securedSubRouter := s.router.PathPrefix("/broker/auth").Subrouter()
+	securedSubRouter.Use(logger.AccessLoggerMiddleware,
+		mmw.RecordHTTPMetrics,
+		amw.AuthenticateServiceToService)
+
+	securedSubRouter.HandleFunc("/connect", s.handleConnect()).Methods(http.MethodPost)
+}
+
+type brokerConnectRequest struct {
+	ClientID    domain.ClientID `json:"client_id" validate:"required"`
+	CertSubject string          `json:"cert_subject"`
+}
+
+type brokerConnectResponse struct {
+	Result     string `json:"result"`
+	Reason     string `json:"reason,omitempty"`
+	Detail     string `json:"detail,omitempty"`
+	RetryAfter int    `json:"retry_after,omitempty"`
+}
+
+func (s *BrokerAuthServer) handleConnect() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		principal, _ := middlewares.GetPrincipal(req.Context())
+		requestId := request_id.GetReqID(req.Context())
+		logger := logger.Log.WithFields(logrus.Fields{
+			"account":    principal.GetAccount(),
+			"request_id": requestId})
+
+		body := http.MaxBytesReader(w, req.Body, 1048576)
+
+		var connectReq brokerConnectRequest
+
+		if err := decodeJSON(body, &connectReq); err != nil {
+			errorResponse := errorResponse{Title: "Unable to process json input",
+				Status: http.StatusBadRequest,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		logger = logger.WithFields(logrus.Fields{"client_id": connectReq.ClientID})
+
+		if s.certRecorder != nil && connectReq.CertSubject != "" {
+			err := s.certRecorder.RecordCertificateSubject(req.Context(), connectReq.ClientID, connectReq.CertSubject)
+			if err != nil && errors.Is(err, controller.ErrInvalidCertificateSubject) == false {
+				logger.WithFields(logrus.Fields{"error": err}).Error("Unable to record the client's certificate subject")
+				errorResponse := errorResponse{Title: "Unable to record the client's certificate subject",
+					Status: http.StatusInternalServerError,
+					Detail: err.Error()}
+				writeJSONResponse(w, errorResponse.Status, errorResponse)
+				return
+			} else if err != nil {
+				logger.WithFields(logrus.Fields{"cert_subject": connectReq.CertSubject, "error": err}).Info("Rejecting the client's connection")
+				writeJSONResponse(w, http.StatusForbidden, brokerConnectResponse{
+					Result: BROKER_AUTH_DENY,
+					Reason: BROKER_AUTH_REASON_INVALID_CERTIFICATE,
+					Detail: err.Error(),
+				})
+				return
+			}
+		}
+
+		decision, err := s.quota.Check(req.Context(), connectReq.ClientID)
+		if err != nil {
+			logger.WithFields(logrus.Fields{"error": err}).Error("Unable to check the client's connection quota")
+			errorResponse := errorResponse{Title: "Unable to check the client's connection quota",
+				Status: http.StatusInternalServerError,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		if decision.Allowed == false {
+			logger.WithFields(logrus.Fields{"reason": decision.Reason}).Info("Rejecting the client's connection")
+
+			// The retry hint tells the client not to reconnect immediately
+			w.Header().Set("Retry-After", strconv.Itoa(decision.RetryAfter))
+			writeJSONResponse(w, http.StatusForbidden, brokerConnectResponse{
+				Result:     BROKER_AUTH_DENY,
+				Reason:     decision.Reason,
+				Detail:     decision.Detail,
+				RetryAfter: decision.RetryAfter,
+			})
+			return
+		}
+
+		writeJSONResponse(w, http.StatusOK, brokerConnectResponse{Result: BROKER_AUTH_ALLOW})
+	}
+}
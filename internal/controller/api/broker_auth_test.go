@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+
+	"github.com/alicebob/miniredis"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	BROKER_AUTH_CONNECT_ENDPOINT = "/broker/auth/connect"
+)
+
+func brokerCredentials(req *http.Request) {
+	req.Header.Add(TOKEN_HEADER_CLIENT_NAME, "broker")
+	req.Header.Add(TOKEN_HEADER_ACCOUNT_NAME, "0000001")
+	req.Header.Add(TOKEN_HEADER_PSK_NAME, "12345")
+}
+
+var _ = Describe("BrokerAuth", func() {
+
+	var (
+		apiMux              *mux.Router
+		validIdentityHeader string
+	)
+
+	BeforeEach(func() {
+		apiMux = mux.NewRouter()
+		cfg := config.GetConfig()
+		cfg.ServiceToServiceCredentials["broker"] = "12345"
+
+		// The configurable resolver maps these clients to account 0000001
+		cm := controller.NewLocalConnectionManager()
+		cm.Register(context.TODO(), "0000001", "client-a", MockClient{})
+
+		quota := controller.NewConnectionQuota(cm, &controller.ConfigurableAccountIdResolver{}, 1, 0, time.Minute, 300, controller.NewMetrics(prometheus.NewRegistry()))
+
+		bas := NewBrokerAuthServer(quota, nil, apiMux, cfg)
+		bas.Routes()
+
+		identity := `{ "identity": {"account_number": "540155", "type": "User", "internal": { "org_id": "1979710" } } }`
+		validIdentityHeader = base64.StdEncoding.EncodeToString([]byte(identity))
+	})
+
+	postConnect := func(body string, authenticate func(*http.Request)) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", BROKER_AUTH_CONNECT_ENDPOINT, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+
+		authenticate(req)
+
+		rr := httptest.NewRecorder()
+		apiMux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	Describe("Connecting to the broker auth connect endpoint", func() {
+		Context("With the broker's service to service credentials", func() {
+			It("Should allow a client that is within the quota", func() {
+				rr := postConnect(`{"client_id": "client-a"}`, brokerCredentials)
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+
+				var m map[string]interface{}
+				json.Unmarshal(rr.Body.Bytes(), &m)
+				Expect(m).Should(HaveKeyWithValue("result", BROKER_AUTH_ALLOW))
+			})
+
+			It("Should reject a client that is over the quota", func() {
+				rr := postConnect(`{"client_id": "client-b"}`, brokerCredentials)
+
+				Expect(rr.Code).To(Equal(http.StatusForbidden))
+				Expect(rr.Header().Get("Retry-After")).To(Equal("300"))
+
+				var m map[string]interface{}
+				json.Unmarshal(rr.Body.Bytes(), &m)
+				Expect(m).Should(HaveKeyWithValue("result", BROKER_AUTH_DENY))
+				Expect(m).Should(HaveKeyWithValue("reason", controller.QuotaReasonAccountConnections))
+				Expect(m).Should(HaveKeyWithValue("retry_after", 300.0))
+			})
+
+			It("Should not accept a request without a client id", func() {
+				rr := postConnect(`{}`, brokerCredentials)
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+
+			It("Should not accept a request with a blank client id", func() {
+				rr := postConnect(`{"client_id": "   "}`, brokerCredentials)
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Context("With an identity header", func() {
+			It("Should not accept a customer's identity", func() {
+				rr := postConnect(`{"client_id": "client-a"}`, func(req *http.Request) {
+					req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+				})
+
+				Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+			})
+		})
+
+		Context("Without credentials", func() {
+			It("Should fail to check the client's quota", func() {
+				rr := postConnect(`{"client_id": "client-a"}`, func(*http.Request) {})
+
+				Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+			})
+		})
+	})
+})
+
+var _ = Describe("BrokerAuth with the cert account id resolver", func() {
+
+	var (
+		apiMux      *mux.Router
+		resolver    *controller.CertBasedAccountIdResolver
+		redisServer *miniredis.Miniredis
+	)
+
+	BeforeEach(func() {
+		apiMux = mux.NewRouter()
+		cfg := config.GetConfig()
+		cfg.ServiceToServiceCredentials["broker"] = "12345"
+
+		var err error
+		redisServer, err = miniredis.Run()
+		Expect(err).NotTo(HaveOccurred())
+
+		resolver = controller.NewCertBasedAccountIdResolver(controller.NewRedisClient(redisServer.Addr(), "", 0), time.Hour, controller.NewMetrics(prometheus.NewRegistry()))
+		quota := controller.NewConnectionQuota(controller.NewLocalConnectionManager(), resolver, 1, 0, time.Minute, 300, controller.NewMetrics(prometheus.NewRegistry()))
+
+		bas := NewBrokerAuthServer(quota, resolver, apiMux, cfg)
+		bas.Routes()
+	})
+
+	AfterEach(func() {
+		redisServer.Close()
+	})
+
+	postConnect := func(body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", BROKER_AUTH_CONNECT_ENDPOINT, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+
+		brokerCredentials(req)
+
+		rr := httptest.NewRecorder()
+		apiMux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	It("Should record the identity from the client's certificate", func() {
+		rr := postConnect(`{"client_id": "client-a", "cert_subject": "CN=client-a,O=1010101,OU=540155"}`)
+
+		Expect(rr.Code).To(Equal(http.StatusOK))
+
+		account, orgID, err := resolver.MapClientIdToAccountId(context.TODO(), "client-a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(account)).To(Equal("540155"))
+		Expect(string(orgID)).To(Equal("1010101"))
+	})
+
+	It("Should reject a certificate that was issued to a different client", func() {
+		rr := postConnect(`{"client_id": "client-a", "cert_subject": "CN=client-b,O=1010101,OU=540155"}`)
+
+		Expect(rr.Code).To(Equal(http.StatusForbidden))
+
+		var m map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &m)
+		Expect(m).Should(HaveKeyWithValue("result", BROKER_AUTH_DENY))
+		Expect(m).Should(HaveKeyWithValue("reason", BROKER_AUTH_REASON_INVALID_CERTIFICATE))
+	})
+
+	It("Should fail to record the identity when redis is unavailable", func() {
+		redisServer.Close()
+
+		rr := postConnect(`{"client_id": "client-a", "cert_subject": "CN=client-a,O=1010101,OU=540155"}`)
+
+		Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+	})
+
+	It("Should fail to check the quota of a client without a certificate subject", func() {
+		rr := postConnect(`{"client_id": "client-a"}`)
+
+		Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+	})
+})
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/middlewares"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+	"github.com/redhatinsights/platform-go-middlewares/request_id"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+type ClientMessageServer struct {
+	sender              controller.DataMessageSender
+	connectionRegistrar controller.ConnectionRegistrar
+	router              *mux.Router
+	config              *config.Config
+}
+
+func NewClientMessageServer(sender controller.DataMessageSender, cr controller.ConnectionRegistrar, r *mux.Router, cfg *config.Config) *ClientMessageServer {
+	return &ClientMessageServer{
+		sender:              sender,
+		connectionRegistrar: cr,
+		router:              r,
+		config:              cfg,
+	}
+}
+
+func (s *ClientMessageServer) Routes() {
+	mmw := &middlewares.MetricsMiddleware{}
+	amw := &middlewares.AuthMiddleware{Secrets: s.config.ServiceToServiceCredentials}
+
+	securedSubRouter := s.router.PathPrefix("/connections/{account}/{client_id}").Subrouter()
+	securedSubRouter.Use(logger.AccessLoggerMiddleware,
+		mmw.RecordHTTPMetrics,
+		amw.Authenticate)
+
+	securedSubRouter.HandleFunc("/message", s.handleClientMessage()).Methods(http.MethodPost)
+}
+
+type clientMessageRequest struct {
+	Payload   interface{} `json:"payload" validate:"required"`
+	Directive string      `json:"directive"`
+}
+
+type clientMessageResponse struct {
+	MessageID string `json:"message_id"`
+}
+
+func (s *ClientMessageServer) handleClientMessage() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		principal, _ := middlewares.GetPrincipal(req.Context())
+		requestId := request_id.GetReqID(req.Context())
+		account := mux.Vars(req)["account"]
+		clientID := domain.ClientID(mux.Vars(req)["client_id"])
+		logger := logger.Log.WithFields(logrus.Fields{
+			"account":    principal.GetAccount(),
+			"request_id": requestId,
+			"client_id":  clientID})
+
+		if verifyAccountAccess(w, principal, account) == false {
+			logger.Debugf("Rejecting the message for account:%s", account)
+			return
+		}
+
+		var msgRequest clientMessageRequest
+
+		body := http.MaxBytesReader(w, req.Body, 1048576)
+
+		if err := decodeJSON(body, &msgRequest); err != nil {
+			errMsg := "Unable to process json input"
+			logger.WithFields(logrus.Fields{"error": err}).Debug(errMsg)
+			errorResponse := errorResponse{Title: errMsg,
+				Status: http.StatusBadRequest,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		if msgRequest.Directive == "" {
+			msgRequest.Directive = s.config.DefaultDataDirective
+		}
+
+		if msgRequest.Directive == "" {
+			errMsg := "A directive must be provided"
+			logger.Debug(errMsg)
+			errorResponse := errorResponse{Title: errMsg,
+				Status: http.StatusBadRequest,
+				Detail: errMsg}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		client, err := s.connectionRegistrar.FindConnection(req.Context(), clientID)
+		if err == controller.ErrConnectionNotFound || (err == nil && string(client.Account) != account) {
+			errMsg := "No connection found for the client"
+			logger.Info(errMsg)
+			errorResponse := errorResponse{Title: errMsg,
+				Status: http.StatusNotFound,
+				Detail: errMsg}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		if err != nil {
+			logger.WithFields(logrus.Fields{"error": err}).Error("Unable to look up the client's connection")
+			errorResponse := errorResponse{Title: "Unable to look up the client's connection",
+				Status: http.StatusInternalServerError,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		logger = logger.WithFields(logrus.Fields{"directive": msgRequest.Directive})
+
+		logger.Info("Sending a message")
+
+		messageID, err := s.sender.SendDataMessage(req.Context(), clientID, msgRequest.Directive, msgRequest.Payload)
+		if tooLarge, isTooLarge := err.(*controller.MessageTooLargeError); isTooLarge {
+			writeMessageTooLargeResponse(logger, w, tooLarge)
+			return
+		}
+
+		if errors.Is(err, controller.ErrCapabilityNotSupported) {
+			writeCapabilityNotSupportedResponse(logger, w, err)
+			return
+		}
+
+		if err != nil {
+			logger.WithFields(logrus.Fields{"error": err}).Error("Unable to send the message to the client")
+			errorResponse := errorResponse{Title: "Unable to send the message to the client",
+				Status: http.StatusInternalServerError,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		logger.WithFields(logrus.Fields{"message_id": messageID}).Info("Message sent")
+
+		writeJSONResponse(w, http.StatusCreated, clientMessageResponse{MessageID: messageID.String()})
+	}
+}
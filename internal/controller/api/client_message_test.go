@@ -0,0 +1,199 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type sentDataMessage struct {
+	clientID  domain.ClientID
+	directive string
+	payload   interface{}
+}
+
+type recordingDataMessageSender struct {
+	sent []sentDataMessage
+	err  error
+}
+
+func (s *recordingDataMessageSender) SendDataMessage(ctx context.Context, clientID domain.ClientID, directive string, payload interface{}) (*uuid.UUID, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	s.sent = append(s.sent, sentDataMessage{clientID: clientID, directive: directive, payload: payload})
+	messageID := uuid.New()
+	return &messageID, nil
+}
+
+var _ = Describe("ClientMessage", func() {
+
+	var (
+		apiMux              *mux.Router
+		sender              *recordingDataMessageSender
+		validIdentityHeader string
+	)
+
+	BeforeEach(func() {
+		apiMux = mux.NewRouter()
+		cfg := config.GetConfig()
+		cfg.ServiceToServiceCredentials["test_client_1"] = "12345"
+
+		cm := controller.NewLocalConnectionManager()
+		cm.Register(context.TODO(), DETAILED_ACCOUNT_NUMBER, "client-1", DetailedMockClient{details: domain.RhcClient{
+			ClientID: "client-1",
+			Account:  DETAILED_ACCOUNT_NUMBER,
+		}})
+
+		sender = &recordingDataMessageSender{}
+
+		// The connections query routes share the /connections prefix
+		cqs := NewConnectionQueryServer(cm, apiMux, cfg)
+		cqs.Routes()
+
+		cms := NewClientMessageServer(sender, cm, apiMux, cfg)
+		cms.Routes()
+
+		identity := `{ "identity": {"account_number": "5678", "type": "User", "internal": { "org_id": "1979710" } } }`
+		validIdentityHeader = base64.StdEncoding.EncodeToString([]byte(identity))
+	})
+
+	sendRequest := func(url string, body string, identityHeader string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", url, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+
+		if identityHeader != "" {
+			req.Header.Add(IDENTITY_HEADER_NAME, identityHeader)
+		}
+
+		rr := httptest.NewRecorder()
+		apiMux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	sendServiceToServiceRequest := func(url string, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", url, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+
+		req.Header.Add(TOKEN_HEADER_CLIENT_NAME, "test_client_1")
+		req.Header.Add(TOKEN_HEADER_ACCOUNT_NAME, "0000001")
+		req.Header.Add(TOKEN_HEADER_PSK_NAME, "12345")
+
+		rr := httptest.NewRecorder()
+		apiMux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	clientMessageEndpoint := func(account string, clientID string) string {
+		return "/connections/" + account + "/" + clientID + "/message"
+	}
+
+	Describe("Connecting to the client message endpoint", func() {
+		Context("With a valid identity header", func() {
+			It("Should send the message to a connected client", func() {
+				rr := sendRequest(clientMessageEndpoint(DETAILED_ACCOUNT_NUMBER, "client-1"),
+					`{"directive": "playbook", "payload": {"url": "http://example.com"}}`, validIdentityHeader)
+
+				Expect(rr.Code).To(Equal(http.StatusCreated))
+
+				var response clientMessageResponse
+				json.Unmarshal(rr.Body.Bytes(), &response)
+				Expect(response.MessageID).NotTo(BeEmpty())
+
+				Expect(sender.sent).To(HaveLen(1))
+				Expect(string(sender.sent[0].clientID)).To(Equal("client-1"))
+				Expect(sender.sent[0].directive).To(Equal("playbook"))
+			})
+
+			It("Should return a 404 if the client is not connected", func() {
+				rr := sendRequest(clientMessageEndpoint(DETAILED_ACCOUNT_NUMBER, "client-2"),
+					`{"directive": "playbook", "payload": "hi"}`, validIdentityHeader)
+
+				Expect(rr.Code).To(Equal(http.StatusNotFound))
+				Expect(sender.sent).To(BeEmpty())
+			})
+
+			It("Should return a 403 if the account does not match the caller's account", func() {
+				rr := sendRequest(clientMessageEndpoint(CONNECTED_ACCOUNT_NUMBER, "client-1"),
+					`{"directive": "playbook", "payload": "hi"}`, validIdentityHeader)
+
+				Expect(rr.Code).To(Equal(http.StatusForbidden))
+				Expect(sender.sent).To(BeEmpty())
+			})
+
+			It("Should return a 400 if the body is malformed", func() {
+				rr := sendRequest(clientMessageEndpoint(DETAILED_ACCOUNT_NUMBER, "client-1"),
+					`{"directive": "playbook", `, validIdentityHeader)
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+
+			It("Should return a 400 if the payload is missing", func() {
+				rr := sendRequest(clientMessageEndpoint(DETAILED_ACCOUNT_NUMBER, "client-1"),
+					`{"directive": "playbook"}`, validIdentityHeader)
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+
+			It("Should return a 500 if the message could not be sent", func() {
+				sender.err = errors.New("broker is down")
+
+				rr := sendRequest(clientMessageEndpoint(DETAILED_ACCOUNT_NUMBER, "client-1"),
+					`{"directive": "playbook", "payload": "hi"}`, validIdentityHeader)
+
+				Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+			})
+
+			It("Should return a 413 if the payload is too large", func() {
+				sender.err = &controller.MessageTooLargeError{Directive: "playbook", Size: 100, Limit: 10}
+
+				rr := sendRequest(clientMessageEndpoint(DETAILED_ACCOUNT_NUMBER, "client-1"),
+					`{"directive": "playbook", "payload": "hi"}`, validIdentityHeader)
+
+				Expect(rr.Code).To(Equal(http.StatusRequestEntityTooLarge))
+			})
+		})
+
+		Context("With service to service credentials", func() {
+			It("Should send the message to a client of any account", func() {
+				rr := sendServiceToServiceRequest(clientMessageEndpoint(DETAILED_ACCOUNT_NUMBER, "client-1"),
+					`{"directive": "playbook", "payload": "hi"}`)
+
+				Expect(rr.Code).To(Equal(http.StatusCreated))
+				Expect(sender.sent).To(HaveLen(1))
+			})
+
+			It("Should return a 404 if the client is connected to a different account", func() {
+				rr := sendServiceToServiceRequest(clientMessageEndpoint(CONNECTED_ACCOUNT_NUMBER, "client-1"),
+					`{"directive": "playbook", "payload": "hi"}`)
+
+				Expect(rr.Code).To(Equal(http.StatusNotFound))
+				Expect(sender.sent).To(BeEmpty())
+			})
+		})
+
+		Context("Without an identity header", func() {
+			It("Should fail to send the message", func() {
+				rr := sendRequest(clientMessageEndpoint(DETAILED_ACCOUNT_NUMBER, "client-1"),
+					`{"directive": "playbook", "payload": "hi"}`, "")
+
+				Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+			})
+		})
+	})
+})
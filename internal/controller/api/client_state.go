@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/middlewares"
+	"github.com/RedHatInsights/cloud-connector/internal/mqtt"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+	"github.com/redhatinsights/platform-go-middlewares/request_id"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+type ClientStateServer struct {
+	clientStates *mqtt.ClientStateManager
+	router       *mux.Router
+	config       *config.Config
+}
+
+func NewClientStateServer(csm *mqtt.ClientStateManager, r *mux.Router, cfg *config.Config) *ClientStateServer {
+	return &ClientStateServer{
+		clientStates: csm,
+		router:       r,
+		config:       cfg,
+	}
+}
+
+func (s *ClientStateServer) Routes() {
+	mmw := &middlewares.MetricsMiddleware{}
+	amw := &middlewares.AuthMiddleware{Secrets: s.config.ServiceToServiceCredentials}
+
+	securedSubRouter := s.router.PathPrefix("/admin/clients").Subrouter()
+	securedSubRouter.Use(logger.AccessLoggerMiddleware,
+		mmw.RecordHTTPMetrics,
+		amw.AuthenticateServiceToService)
+
+	securedSubRouter.HandleFunc("/{client_id}/state", s.handleClientState()).Methods(http.MethodGet)
+	securedSubRouter.HandleFunc("/{client_id}/state/reset", s.handleClientStateReset()).Methods(http.MethodPost)
+}
+
+func (s *ClientStateServer) handleClientState() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		clientID := domain.ClientID(mux.Vars(req)["client_id"])
+
+		writeJSONResponse(w, http.StatusOK, s.clientStates.ClientState(clientID))
+	}
+}
+
+func (s *ClientStateServer) handleClientStateReset() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		principal, _ := middlewares.GetPrincipal(req.Context())
+		requestId := request_id.GetReqID(req.Context())
+		clientID := domain.ClientID(mux.Vars(req)["client_id"])
+		logger := logger.Log.WithFields(logrus.Fields{
+			"account":    principal.GetAccount(),
+			"request_id": requestId,
+			"client_id":  clientID})
+
+		logger.Info("Resetting the client's state")
+
+		s.clientStates.Reset(clientID)
+
+		writeJSONResponse(w, http.StatusOK, s.clientStates.ClientState(clientID))
+	}
+}
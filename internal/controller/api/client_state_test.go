@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/mqtt"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	CLIENT_STATE_ENDPOINT = "/admin/clients/client-1/state"
+)
+
+var _ = Describe("ClientState", func() {
+
+	var (
+		apiMux              *mux.Router
+		lastErrors          *controller.LastErrorTracker
+		validIdentityHeader string
+	)
+
+	BeforeEach(func() {
+		apiMux = mux.NewRouter()
+		cfg := config.GetConfig()
+		cfg.ServiceToServiceCredentials["test_client_1"] = "12345"
+
+		lastErrors = controller.NewLastErrorTracker(10, time.Minute)
+		lastErrors.RecordError("client-1", "Unable to resolve the client's account")
+
+		css := NewClientStateServer(mqtt.NewClientStateManager(lastErrors), apiMux, cfg)
+		css.Routes()
+
+		identity := `{ "identity": {"account_number": "540155", "type": "User", "internal": { "org_id": "1979710" } } }`
+		validIdentityHeader = base64.StdEncoding.EncodeToString([]byte(identity))
+	})
+
+	sendRequest := func(method string, url string, identityHeader string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		if identityHeader != "" {
+			req.Header.Add(IDENTITY_HEADER_NAME, identityHeader)
+		}
+
+		rr := httptest.NewRecorder()
+		apiMux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	sendServiceToServiceRequest := func(method string, url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		req.Header.Add(TOKEN_HEADER_CLIENT_NAME, "test_client_1")
+		req.Header.Add(TOKEN_HEADER_ACCOUNT_NAME, "0000001")
+		req.Header.Add(TOKEN_HEADER_PSK_NAME, "12345")
+
+		rr := httptest.NewRecorder()
+		apiMux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	Describe("Connecting to the client state endpoint", func() {
+		Context("With service to service credentials", func() {
+			It("Should return the client's state", func() {
+				rr := sendServiceToServiceRequest("GET", CLIENT_STATE_ENDPOINT)
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+
+				var state mqtt.ClientState
+				json.Unmarshal(rr.Body.Bytes(), &state)
+				Expect(string(state.ClientID)).To(Equal("client-1"))
+				Expect(state.LastError).NotTo(BeNil())
+				Expect(state.LastError.Reason).To(Equal("Unable to resolve the client's account"))
+			})
+
+			It("Should reset the client's state", func() {
+				rr := sendServiceToServiceRequest("POST", CLIENT_STATE_ENDPOINT+"/reset")
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+
+				var state mqtt.ClientState
+				json.Unmarshal(rr.Body.Bytes(), &state)
+				Expect(state.LastError).To(BeNil())
+
+				Expect(lastErrors.GetLastError("client-1")).To(BeNil())
+			})
+
+			It("Should not reset the client's state with a GET", func() {
+				rr := sendServiceToServiceRequest("GET", CLIENT_STATE_ENDPOINT+"/reset")
+
+				Expect(rr.Code).To(Equal(http.StatusMethodNotAllowed))
+				Expect(lastErrors.GetLastError("client-1")).NotTo(BeNil())
+			})
+		})
+
+		Context("With a valid identity header", func() {
+			It("Should not return the client's state", func() {
+				rr := sendRequest("GET", CLIENT_STATE_ENDPOINT, validIdentityHeader)
+
+				Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+			})
+
+			It("Should not reset the client's state", func() {
+				rr := sendRequest("POST", CLIENT_STATE_ENDPOINT+"/reset", validIdentityHeader)
+
+				Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+				Expect(lastErrors.GetLastError("client-1")).NotTo(BeNil())
+			})
+		})
+
+		Context("Without credentials", func() {
+			It("Should fail to authenticate", func() {
+				rr := sendRequest("POST", CLIENT_STATE_ENDPOINT+"/reset", "")
+
+				Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+				Expect(lastErrors.GetLastError("client-1")).NotTo(BeNil())
+			})
+		})
+	})
+})
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/middlewares"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+	"github.com/redhatinsights/platform-go-middlewares/request_id"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	IMPORT_STATUS_IMPORTED = "imported"
+	IMPORT_STATUS_CONFLICT = "conflict"
+	IMPORT_STATUS_INVALID  = "invalid"
+	IMPORT_STATUS_FAILED   = "failed"
+
+	maxImportBodySize = 10 * 1048576
+)
+
+type ConnectionImportServer struct {
+	connectionRegistrar controller.ConnectionRegistrar
+	receptorFactory     controller.ReceptorFactory
+	router              *mux.Router
+	config              *config.Config
+}
+
+func NewConnectionImportServer(cr controller.ConnectionRegistrar, rf controller.ReceptorFactory, r *mux.Router, cfg *config.Config) *ConnectionImportServer {
+	return &ConnectionImportServer{
+		connectionRegistrar: cr,
+		receptorFactory:     rf,
+		router:              r,
+		config:              cfg,
+	}
+}
+
+func (s *ConnectionImportServer) Routes() {
+	mmw := &middlewares.MetricsMiddleware{}
+	amw := &middlewares.AuthMiddleware{Secrets: s.config.ServiceToServiceCredentials}
+
+	securedSubRouter := s.router.PathPrefix("/admin/connections").Subrouter()
+	securedSubRouter.Use(logger.AccessLoggerMiddleware,
+		mmw.RecordHTTPMetrics,
+		amw.AuthenticateServiceToService)
+
+	securedSubRouter.HandleFunc("/import", s.handleImport()).Methods(http.MethodPost)
+}
+
+type connectionImportRequest struct {
+	Connections []connectionID `json:"connections"`
+}
+
+type connectionImportResult struct {
+	Index   int    `json:"index"`
+	Account string `json:"account"`
+	NodeID  string `json:"node_id"`
+	Status  string `json:"status"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+type connectionImportResponse struct {
+	Imported int                      `json:"imported"`
+	Skipped  int                      `json:"skipped"`
+	Results  []connectionImportResult `json:"results"`
+}
+
+func (s *ConnectionImportServer) handleImport() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		principal, _ := middlewares.GetPrincipal(req.Context())
+		requestId := request_id.GetReqID(req.Context())
+		logger := logger.Log.WithFields(logrus.Fields{
+			"account":    principal.GetAccount(),
+			"request_id": requestId})
+
+		body := http.MaxBytesReader(w, req.Body, maxImportBodySize)
+
+		records, err := decodeConnectionRecords(req.Header.Get("Content-Type"), body)
+		if err != nil {
+			errorResponse := errorResponse{Title: "Unable to process connection records",
+				Status: http.StatusBadRequest,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		logger.Infof("Importing %d connection records", len(records))
+
+		response := connectionImportResponse{Results: make([]connectionImportResult, len(records))}
+
+		v := validator.New()
+
+		for i, record := range records {
+			result := connectionImportResult{Index: i, Account: record.Account, NodeID: record.NodeID}
+
+			if err := v.Struct(record); err != nil {
+				result.Status = IMPORT_STATUS_INVALID
+				result.Detail = "Record is missing required fields"
+			} else if err := validateConnectionRecord(record); err != nil {
+				result.Status = IMPORT_STATUS_INVALID
+				result.Detail = err.Error()
+			} else {
+				receptor := s.receptorFactory(record.Account, record.NodeID)
+				err := s.connectionRegistrar.Register(req.Context(), record.Account, record.NodeID, receptor)
+				if errors.Is(err, controller.ErrRegistrationConflict) {
+					result.Status = IMPORT_STATUS_CONFLICT
+					result.Detail = err.Error()
+				} else if err != nil {
+					result.Status = IMPORT_STATUS_FAILED
+					result.Detail = err.Error()
+				} else {
+					result.Status = IMPORT_STATUS_IMPORTED
+				}
+			}
+
+			if result.Status == IMPORT_STATUS_IMPORTED {
+				response.Imported++
+			} else {
+				response.Skipped++
+			}
+
+			response.Results[i] = result
+		}
+
+		logger.Infof("Imported %d connection records, skipped %d connection records", response.Imported, response.Skipped)
+
+		writeJSONResponse(w, http.StatusOK, response)
+	}
+}
+
+func validateConnectionRecord(record connectionID) error {
+	if err := domain.AccountID(record.Account).Validate(); err != nil {
+		return err
+	}
+
+	return domain.ClientID(record.NodeID).Validate()
+}
+
+func decodeConnectionRecords(contentType string, body io.Reader) ([]connectionID, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch mediaType {
+	case "text/csv":
+		return decodeCSVConnectionRecords(body)
+	default:
+		return decodeJSONConnectionRecords(body)
+	}
+}
+
+func decodeJSONConnectionRecords(body io.Reader) ([]connectionID, error) {
+	var importRequest connectionImportRequest
+
+	dec := json.NewDecoder(body)
+	if err := dec.Decode(&importRequest); err != nil {
+		return nil, errors.New("Request body includes malformed json")
+	} else if dec.More() {
+		return nil, errors.New("Request body must only contain one json object")
+	}
+
+	return importRequest.Connections, nil
+}
+
+// decodeCSVConnectionRecords reads records in the form of "account,node_id".  An optional
+// header row is skipped.
+func decodeCSVConnectionRecords(body io.Reader) ([]connectionID, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Request body includes malformed csv: %s", err)
+	}
+
+	records := make([]connectionID, 0, len(rows))
+	for i, row := range rows {
+		if i == 0 && strings.EqualFold(row[0], "account") && strings.EqualFold(row[1], "node_id") {
+			continue
+		}
+		records = append(records, connectionID{Account: row[0], NodeID: row[1]})
+	}
+
+	return records, nil
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	CONNECTION_IMPORT_ENDPOINT = "/admin/connections/import"
+)
+
+var _ = Describe("ConnectionImport", func() {
+
+	var (
+		cm                  *controller.LocalConnectionManager
+		cis                 *ConnectionImportServer
+		validIdentityHeader string
+	)
+
+	BeforeEach(func() {
+		apiMux := mux.NewRouter()
+		cm = controller.NewLocalConnectionManager()
+		cm.Register(context.TODO(), CONNECTED_ACCOUNT_NUMBER, CONNECTED_NODE_ID, MockClient{})
+		receptorFactory := func(account string, nodeID string) controller.Receptor {
+			return MockClient{}
+		}
+		cfg := config.GetConfig()
+		cfg.ServiceToServiceCredentials["test_client_1"] = "12345"
+		cis = NewConnectionImportServer(cm, receptorFactory, apiMux, cfg)
+		cis.Routes()
+
+		identity := `{ "identity": {"account_number": "540155", "type": "User", "internal": { "org_id": "1979710" } } }`
+		validIdentityHeader = base64.StdEncoding.EncodeToString([]byte(identity))
+	})
+
+	postImport := func(contentType string, body string) (*httptest.ResponseRecorder, connectionImportResponse) {
+		req, err := http.NewRequest("POST", CONNECTION_IMPORT_ENDPOINT, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+
+		req.Header.Add(TOKEN_HEADER_CLIENT_NAME, "test_client_1")
+		req.Header.Add(TOKEN_HEADER_ACCOUNT_NAME, "0000001")
+		req.Header.Add(TOKEN_HEADER_PSK_NAME, "12345")
+		req.Header.Add("Content-Type", contentType)
+
+		rr := httptest.NewRecorder()
+
+		cis.router.ServeHTTP(rr, req)
+
+		var response connectionImportResponse
+		json.Unmarshal(rr.Body.Bytes(), &response)
+
+		return rr, response
+	}
+
+	Describe("Importing connections", func() {
+		Context("With a json body", func() {
+			It("Should report the status of each record", func() {
+
+				body := `{"connections": [
+					{"account": "5678", "node_id": "new-node"},
+					{"account": "5678", "node_id": ""},
+					{"account": "` + CONNECTED_ACCOUNT_NUMBER + `", "node_id": "` + CONNECTED_NODE_ID + `"}
+				]}`
+
+				rr, response := postImport("application/json", body)
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+				Expect(response.Imported).To(Equal(1))
+				Expect(response.Skipped).To(Equal(2))
+				Expect(response.Results).To(HaveLen(3))
+				Expect(response.Results[0].Status).To(Equal(IMPORT_STATUS_IMPORTED))
+				Expect(response.Results[1].Status).To(Equal(IMPORT_STATUS_INVALID))
+				Expect(response.Results[2].Status).To(Equal(IMPORT_STATUS_CONFLICT))
+
+				Expect(cm.GetConnection(context.TODO(), "5678", "new-node")).ShouldNot(BeNil())
+			})
+
+			It("Should not import records with invalid ids", func() {
+
+				body := `{"connections": [
+					{"account": " 5678", "node_id": "padded-account"},
+					{"account": "5678", "node_id": "` + strings.Repeat("x", domain.MaxClientIDLength+1) + `"}
+				]}`
+
+				rr, response := postImport("application/json", body)
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+				Expect(response.Imported).To(Equal(0))
+				Expect(response.Results[0].Status).To(Equal(IMPORT_STATUS_INVALID))
+				Expect(response.Results[1].Status).To(Equal(IMPORT_STATUS_INVALID))
+
+				Expect(cm.GetConnectionsByAccount(context.TODO(), " 5678")).To(BeEmpty())
+				Expect(cm.GetConnectionsByAccount(context.TODO(), "5678")).To(BeEmpty())
+			})
+
+			It("Should reject malformed json", func() {
+
+				rr, _ := postImport("application/json", `{"connections": [`)
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Context("With a csv body", func() {
+			It("Should import the records and skip the header row", func() {
+
+				body := "account,node_id\n5678,csv-node-1\n5678,csv-node-2\n"
+
+				rr, response := postImport("text/csv", body)
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+				Expect(response.Imported).To(Equal(2))
+				Expect(response.Skipped).To(Equal(0))
+
+				Expect(cm.GetConnectionsByAccount(context.TODO(), "5678")).To(HaveLen(2))
+			})
+
+			It("Should reject rows with the wrong number of fields", func() {
+
+				rr, _ := postImport("text/csv", "5678,csv-node-1,extra\n")
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+	})
+
+	Describe("Connecting to the import endpoint with an identity header", func() {
+		It("Should fail to import the connections", func() {
+			req, err := http.NewRequest("POST", CONNECTION_IMPORT_ENDPOINT, strings.NewReader(`{"connections": [{"account": "5678", "node_id": "new-node"}]}`))
+			Expect(err).NotTo(HaveOccurred())
+
+			req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+			rr := httptest.NewRecorder()
+
+			cis.router.ServeHTTP(rr, req)
+
+			Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+			Expect(cm.GetConnection(context.TODO(), "5678", "new-node")).Should(BeNil())
+		})
+	})
+
+	Describe("Connecting to the import endpoint without credentials", func() {
+		It("Should fail to import the connections", func() {
+
+			req, err := http.NewRequest("POST", CONNECTION_IMPORT_ENDPOINT, strings.NewReader(`{"connections": []}`))
+			Expect(err).NotTo(HaveOccurred())
+
+			rr := httptest.NewRecorder()
+
+			cis.router.ServeHTTP(rr, req)
+
+			Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+})
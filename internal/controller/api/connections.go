@@ -0,0 +1,103 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/middlewares"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+	"github.com/redhatinsights/platform-go-middlewares/request_id"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultConnectionsPageSize = 100
+	maxConnectionsPageSize     = 1000
+)
+
+type ConnectionQueryServer struct {
+	connectionRegistrar controller.ConnectionRegistrar
+	router              *mux.Router
+	config              *config.Config
+}
+
+func NewConnectionQueryServer(cr controller.ConnectionRegistrar, r *mux.Router, cfg *config.Config) *ConnectionQueryServer {
+	return &ConnectionQueryServer{
+		connectionRegistrar: cr,
+		router:              r,
+		config:              cfg,
+	}
+}
+
+func (s *ConnectionQueryServer) Routes() {
+	mmw := &middlewares.MetricsMiddleware{}
+	amw := &middlewares.AuthMiddleware{Secrets: s.config.ServiceToServiceCredentials}
+
+	securedSubRouter := s.router.PathPrefix("/connections").Subrouter()
+	securedSubRouter.Use(logger.AccessLoggerMiddleware,
+		mmw.RecordHTTPMetrics,
+		amw.Authenticate)
+
+	securedSubRouter.HandleFunc("/{account}", s.handleConnectionsByAccount()).Methods(http.MethodGet)
+}
+
+type connectionsPageResponse struct {
+	Connections []domain.RhcClient `json:"connections"`
+	Total       int                `json:"total"`
+	Offset      int                `json:"offset"`
+	Limit       int                `json:"limit"`
+}
+
+func (s *ConnectionQueryServer) handleConnectionsByAccount() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		principal, _ := middlewares.GetPrincipal(req.Context())
+		requestId := request_id.GetReqID(req.Context())
+		account := mux.Vars(req)["account"]
+		logger := logger.Log.WithFields(logrus.Fields{
+			"account":    principal.GetAccount(),
+			"request_id": requestId})
+
+		if verifyAccountAccess(w, principal, account) == false {
+			logger.Debugf("Rejecting the request for the connections of account:%s", account)
+			return
+		}
+
+		offset, limit, err := getPaginationParams(req, defaultConnectionsPageSize, maxConnectionsPageSize)
+		if err != nil {
+			errorResponse := errorResponse{Title: err.Error(),
+				Status: http.StatusBadRequest,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		logger.Debugf("Getting connections for account:%s - offset:%d - limit:%d", account, offset, limit)
+
+		connections, total, err := s.connectionRegistrar.FindConnectionsByAccount(req.Context(), account, offset, limit)
+		if err != nil {
+			logger.WithFields(logrus.Fields{"error": err}).Error("Unable to look up the account's connections")
+			errorResponse := errorResponse{Title: "Unable to look up the account's connections",
+				Status: http.StatusInternalServerError,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		if connections == nil {
+			connections = []domain.RhcClient{}
+		}
+
+		writeJSONResponse(w, http.StatusOK, connectionsPageResponse{
+			Connections: connections,
+			Total:       total,
+			Offset:      offset,
+			Limit:       limit,
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	CONNECTIONS_ENDPOINT = "/connections/"
+)
+
+var _ = Describe("Connections", func() {
+
+	var (
+		apiMux              *mux.Router
+		validIdentityHeader string
+	)
+
+	BeforeEach(func() {
+		apiMux = mux.NewRouter()
+		cfg := config.GetConfig()
+		cfg.ServiceToServiceCredentials["test_client_1"] = "12345"
+
+		cm := controller.NewLocalConnectionManager()
+		for _, clientID := range []string{"client-3", "client-1", "client-2"} {
+			cm.Register(context.TODO(), DETAILED_ACCOUNT_NUMBER, clientID, DetailedMockClient{details: domain.RhcClient{
+				ClientID:       domain.ClientID(clientID),
+				Account:        DETAILED_ACCOUNT_NUMBER,
+				CanonicalFacts: map[string]interface{}{"fqdn": clientID + ".example.com"},
+			}})
+		}
+
+		cqs := NewConnectionQueryServer(cm, apiMux, cfg)
+		cqs.Routes()
+
+		identity := `{ "identity": {"account_number": "5678", "type": "User", "internal": { "org_id": "1979710" } } }`
+		validIdentityHeader = base64.StdEncoding.EncodeToString([]byte(identity))
+	})
+
+	sendRequest := func(url string, identityHeader string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", url, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		if identityHeader != "" {
+			req.Header.Add(IDENTITY_HEADER_NAME, identityHeader)
+		}
+
+		rr := httptest.NewRecorder()
+		apiMux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	sendServiceToServiceRequest := func(url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", url, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		req.Header.Add(TOKEN_HEADER_CLIENT_NAME, "test_client_1")
+		req.Header.Add(TOKEN_HEADER_ACCOUNT_NAME, "0000001")
+		req.Header.Add(TOKEN_HEADER_PSK_NAME, "12345")
+
+		rr := httptest.NewRecorder()
+		apiMux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	Describe("Connecting to the connections endpoint", func() {
+		Context("With a valid identity header", func() {
+			It("Should return the account's connections and their canonical facts", func() {
+				rr := sendRequest(CONNECTIONS_ENDPOINT+DETAILED_ACCOUNT_NUMBER, validIdentityHeader)
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+
+				var page connectionsPageResponse
+				json.Unmarshal(rr.Body.Bytes(), &page)
+				Expect(page.Total).To(Equal(3))
+				Expect(page.Offset).To(Equal(0))
+				Expect(page.Limit).To(Equal(defaultConnectionsPageSize))
+				Expect(page.Connections).To(HaveLen(3))
+				Expect(string(page.Connections[0].ClientID)).To(Equal("client-1"))
+				Expect(page.Connections[0].CanonicalFacts).To(Equal(domain.CanonicalFacts{"fqdn": "client-1.example.com"}))
+			})
+
+			It("Should page through the account's connections", func() {
+				rr := sendRequest(CONNECTIONS_ENDPOINT+DETAILED_ACCOUNT_NUMBER+"?offset=1&limit=1", validIdentityHeader)
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+
+				var page connectionsPageResponse
+				json.Unmarshal(rr.Body.Bytes(), &page)
+				Expect(page.Total).To(Equal(3))
+				Expect(page.Connections).To(HaveLen(1))
+				Expect(string(page.Connections[0].ClientID)).To(Equal("client-2"))
+			})
+
+			It("Should not list the connections of another account", func() {
+				rr := sendRequest(CONNECTIONS_ENDPOINT+"0000", validIdentityHeader)
+
+				Expect(rr.Code).To(Equal(http.StatusForbidden))
+			})
+
+			It("Should reject an invalid limit", func() {
+				rr := sendRequest(CONNECTIONS_ENDPOINT+DETAILED_ACCOUNT_NUMBER+"?limit=fred", validIdentityHeader)
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+
+			It("Should reject a negative offset", func() {
+				rr := sendRequest(CONNECTIONS_ENDPOINT+DETAILED_ACCOUNT_NUMBER+"?offset=-1", validIdentityHeader)
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Context("With service to service credentials", func() {
+			It("Should list the connections of any account", func() {
+				rr := sendServiceToServiceRequest(CONNECTIONS_ENDPOINT + DETAILED_ACCOUNT_NUMBER)
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+
+				var page connectionsPageResponse
+				json.Unmarshal(rr.Body.Bytes(), &page)
+				Expect(page.Total).To(Equal(3))
+			})
+
+			It("Should return an empty list for an account without connections", func() {
+				rr := sendServiceToServiceRequest(CONNECTIONS_ENDPOINT + "0000")
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+				Expect(rr.Body.String()).To(ContainSubstring(`"connections":[]`))
+			})
+		})
+
+		Context("Without an identity header", func() {
+			It("Should fail to list the connections", func() {
+				rr := sendRequest(CONNECTIONS_ENDPOINT+DETAILED_ACCOUNT_NUMBER, "")
+
+				Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+			})
+		})
+	})
+})
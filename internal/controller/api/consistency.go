@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/middlewares"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/gorilla/mux"
+)
+
+// ConsistencyServer exposes the results of the connection registration
+// consistency checks
+type ConsistencyServer struct {
+	checker *controller.ConsistencyChecker
+	router  *mux.Router
+	config  *config.Config
+}
+
+func NewConsistencyServer(checker *controller.ConsistencyChecker, r *mux.Router, cfg *config.Config) *ConsistencyServer {
+	return &ConsistencyServer{
+		checker: checker,
+		router:  r,
+		config:  cfg,
+	}
+}
+
+func (s *ConsistencyServer) Routes() {
+	mmw := &middlewares.MetricsMiddleware{}
+	amw := &middlewares.AuthMiddleware{Secrets: s.config.ServiceToServiceCredentials}
+
+	securedSubRouter := s.router.PathPrefix("/consistency").Subrouter()
+	securedSubRouter.Use(logger.AccessLoggerMiddleware,
+		mmw.RecordHTTPMetrics,
+		amw.AuthenticateServiceToService)
+
+	securedSubRouter.HandleFunc("", s.handleConsistencyReport()).Methods(http.MethodGet)
+}
+
+func (s *ConsistencyServer) handleConsistencyReport() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		report, found := s.checker.LastReport()
+		if found == false {
+			errorResponse := errorResponse{Title: "No consistency check has completed",
+				Status: http.StatusNotFound,
+				Detail: "No consistency check has completed"}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		writeJSONResponse(w, http.StatusOK, report)
+	}
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	CONSISTENCY_ENDPOINT = "/consistency"
+)
+
+type unreachablePinger struct{}
+
+func (p unreachablePinger) Ping(ctx context.Context, clientID domain.ClientID) error {
+	return controller.ErrClientUnreachable
+}
+
+var _ = Describe("Consistency", func() {
+
+	var (
+		apiMux              *mux.Router
+		checker             *controller.ConsistencyChecker
+		validIdentityHeader string
+	)
+
+	BeforeEach(func() {
+		apiMux = mux.NewRouter()
+		cfg := config.GetConfig()
+		cfg.ServiceToServiceCredentials["test_client_1"] = "12345"
+
+		cm := controller.NewLocalConnectionManager()
+		cm.Register(context.TODO(), "1234", "stale-client", MockClient{})
+
+		checker = controller.NewConsistencyChecker(cm, unreachablePinger{}, nil, controller.ConsistencyCheckerConfig{PingTimeout: time.Second}, controller.NewMetrics(prometheus.NewRegistry()))
+
+		cs := NewConsistencyServer(checker, apiMux, cfg)
+		cs.Routes()
+
+		identity := `{ "identity": {"account_number": "540155", "type": "User", "internal": { "org_id": "1979710" } } }`
+		validIdentityHeader = base64.StdEncoding.EncodeToString([]byte(identity))
+	})
+
+	getReport := func(identityHeader string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", CONSISTENCY_ENDPOINT, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		if identityHeader != "" {
+			req.Header.Add(IDENTITY_HEADER_NAME, identityHeader)
+		}
+
+		rr := httptest.NewRecorder()
+		apiMux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	getReportAsService := func() *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", CONSISTENCY_ENDPOINT, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		req.Header.Add(TOKEN_HEADER_CLIENT_NAME, "test_client_1")
+		req.Header.Add(TOKEN_HEADER_ACCOUNT_NAME, "0000001")
+		req.Header.Add(TOKEN_HEADER_PSK_NAME, "12345")
+
+		rr := httptest.NewRecorder()
+		apiMux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	Describe("Connecting to the consistency endpoint", func() {
+		Context("With service to service credentials", func() {
+			It("Should return not found before a check has completed", func() {
+				rr := getReportAsService()
+
+				Expect(rr.Code).To(Equal(http.StatusNotFound))
+			})
+
+			It("Should return the most recent report", func() {
+				checker.Check(context.TODO())
+
+				rr := getReportAsService()
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+
+				var report controller.ConsistencyReport
+				json.Unmarshal(rr.Body.Bytes(), &report)
+				Expect(report.Sampled).To(Equal(1))
+				Expect(report.Inconsistencies).To(HaveLen(1))
+				Expect(report.Inconsistencies[0].ClientID).To(Equal("stale-client"))
+				Expect(report.Inconsistencies[0].Kind).To(Equal(controller.InconsistencyUnreachableClient))
+			})
+		})
+
+		Context("With a valid identity header", func() {
+			It("Should not return the report", func() {
+				checker.Check(context.TODO())
+
+				rr := getReport(validIdentityHeader)
+
+				Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+			})
+		})
+
+		Context("Without credentials", func() {
+			It("Should fail to authenticate", func() {
+				rr := getReport("")
+
+				Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+			})
+		})
+	})
+})
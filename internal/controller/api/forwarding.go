@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/middlewares"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/queue"
+	"github.com/redhatinsights/platform-go-middlewares/request_id"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+type ForwardingServer struct {
+	forwardingController *queue.ForwardingController
+	router               *mux.Router
+	config               *config.Config
+}
+
+func NewForwardingServer(fc *queue.ForwardingController, r *mux.Router, cfg *config.Config) *ForwardingServer {
+	return &ForwardingServer{
+		forwardingController: fc,
+		router:               r,
+		config:               cfg,
+	}
+}
+
+func (s *ForwardingServer) Routes() {
+	mmw := &middlewares.MetricsMiddleware{}
+	amw := &middlewares.AuthMiddleware{Secrets: s.config.ServiceToServiceCredentials}
+
+	securedSubRouter := s.router.PathPrefix("/admin/forwarding").Subrouter()
+	securedSubRouter.Use(logger.AccessLoggerMiddleware,
+		mmw.RecordHTTPMetrics,
+		amw.AuthenticateServiceToService)
+
+	securedSubRouter.HandleFunc("", s.handlePausedTopicListing()).Methods(http.MethodGet)
+	securedSubRouter.HandleFunc("/{topic}/pause", s.handlePause()).Methods(http.MethodPost)
+	securedSubRouter.HandleFunc("/{topic}/resume", s.handleResume()).Methods(http.MethodPost)
+}
+
+type pausedTopicsResponse struct {
+	PausedTopics []string `json:"paused_topics"`
+}
+
+func (s *ForwardingServer) handlePausedTopicListing() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		writeJSONResponse(w, http.StatusOK, pausedTopicsResponse{PausedTopics: s.forwardingController.PausedTopics()})
+	}
+}
+
+func (s *ForwardingServer) handlePause() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		principal, _ := middlewares.GetPrincipal(req.Context())
+		requestId := request_id.GetReqID(req.Context())
+		topic := mux.Vars(req)["topic"]
+		logger := logger.Log.WithFields(logrus.Fields{
+			"account":    principal.GetAccount(),
+			"request_id": requestId,
+			"topic":      topic})
+
+		logger.Info("Pausing forwarding to kafka topic")
+
+		s.forwardingController.Pause(topic)
+
+		writeJSONResponse(w, http.StatusOK, pausedTopicsResponse{PausedTopics: s.forwardingController.PausedTopics()})
+	}
+}
+
+func (s *ForwardingServer) handleResume() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		principal, _ := middlewares.GetPrincipal(req.Context())
+		requestId := request_id.GetReqID(req.Context())
+		topic := mux.Vars(req)["topic"]
+		logger := logger.Log.WithFields(logrus.Fields{
+			"account":    principal.GetAccount(),
+			"request_id": requestId,
+			"topic":      topic})
+
+		logger.Info("Resuming forwarding to kafka topic")
+
+		// The buffered messages are written using a context that is not tied to the
+		// request so that a client that goes away does not abort the write part way through
+		ctx, cancel := context.WithTimeout(context.Background(), s.config.KafkaPausedTopicResumeTimeout)
+		defer cancel()
+
+		if err := s.forwardingController.Resume(ctx, topic); err != nil {
+			status := http.StatusInternalServerError
+			if err == queue.ErrResumeInProgress {
+				status = http.StatusConflict
+			}
+
+			errorResponse := errorResponse{Title: "Unable to resume forwarding to kafka topic",
+				Status: status,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		writeJSONResponse(w, http.StatusOK, pausedTopicsResponse{PausedTopics: s.forwardingController.PausedTopics()})
+	}
+}
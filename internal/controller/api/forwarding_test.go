@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/queue"
+
+	"github.com/gorilla/mux"
+	kafka "github.com/segmentio/kafka-go"
+)
+
+const (
+	FORWARDING_ENDPOINT = "/admin/forwarding"
+)
+
+type recordingKafkaWriter struct {
+	messages      []kafka.Message
+	requestCtxErr error
+	returnAnError bool
+}
+
+func (w *recordingKafkaWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.requestCtxErr = ctx.Err()
+	if w.returnAnError {
+		return errors.New("ImaError")
+	}
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+var _ = Describe("Forwarding", func() {
+
+	var (
+		apiMux               *mux.Router
+		forwardingController *queue.ForwardingController
+		kafkaWriter          *recordingKafkaWriter
+		topicWriter          queue.Writer
+	)
+
+	BeforeEach(func() {
+		apiMux = mux.NewRouter()
+		cfg := config.GetConfig()
+		cfg.ServiceToServiceCredentials["test_client_1"] = "12345"
+
+		var err error
+		forwardingController, err = queue.NewForwardingController(queue.PausedTopicModeBuffer, 10)
+		Expect(err).NotTo(HaveOccurred())
+
+		kafkaWriter = &recordingKafkaWriter{}
+		topicWriter = forwardingController.Writer("responses", kafkaWriter)
+
+		fs := NewForwardingServer(forwardingController, apiMux, cfg)
+		fs.Routes()
+	})
+
+	sendRequest := func(method string, url string, ctx context.Context) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		req.Header.Add(TOKEN_HEADER_CLIENT_NAME, "test_client_1")
+		req.Header.Add(TOKEN_HEADER_ACCOUNT_NAME, "0000001")
+		req.Header.Add(TOKEN_HEADER_PSK_NAME, "12345")
+
+		rr := httptest.NewRecorder()
+		apiMux.ServeHTTP(rr, req.WithContext(ctx))
+		return rr
+	}
+
+	pausedTopics := func(rr *httptest.ResponseRecorder) []string {
+		var response pausedTopicsResponse
+		Expect(json.Unmarshal(rr.Body.Bytes(), &response)).To(Succeed())
+		return response.PausedTopics
+	}
+
+	Describe("Pausing a topic", func() {
+		It("Should list the topic as paused", func() {
+			rr := sendRequest("POST", FORWARDING_ENDPOINT+"/responses/pause", context.TODO())
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(pausedTopics(rr)).To(Equal([]string{"responses"}))
+
+			rr = sendRequest("GET", FORWARDING_ENDPOINT, context.TODO())
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(pausedTopics(rr)).To(Equal([]string{"responses"}))
+		})
+
+		It("Should require authentication", func() {
+			req, err := http.NewRequest("POST", FORWARDING_ENDPOINT+"/responses/pause", nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			rr := httptest.NewRecorder()
+			apiMux.ServeHTTP(rr, req)
+
+			Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+			Expect(forwardingController.PausedTopics()).To(BeEmpty())
+		})
+
+		It("Should not allow an identity header", func() {
+			req, err := http.NewRequest("POST", FORWARDING_ENDPOINT+"/responses/pause", nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			identity := `{ "identity": {"account_number": "540155", "type": "User", "internal": { "org_id": "1979710" } } }`
+			req.Header.Add(IDENTITY_HEADER_NAME, base64.StdEncoding.EncodeToString([]byte(identity)))
+
+			rr := httptest.NewRecorder()
+			apiMux.ServeHTTP(rr, req)
+
+			Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+			Expect(forwardingController.PausedTopics()).To(BeEmpty())
+		})
+	})
+
+	Describe("Resuming a topic", func() {
+		BeforeEach(func() {
+			forwardingController.Pause("responses")
+			topicWriter.WriteMessages(context.TODO(), kafka.Message{Value: []byte("1")})
+		})
+
+		It("Should write the buffered messages and unpause the topic", func() {
+			rr := sendRequest("POST", FORWARDING_ENDPOINT+"/responses/resume", context.TODO())
+
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(pausedTopics(rr)).To(BeEmpty())
+			Expect(kafkaWriter.messages).To(HaveLen(1))
+		})
+
+		It("Should write the buffered messages after the request is canceled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			rr := sendRequest("POST", FORWARDING_ENDPOINT+"/responses/resume", ctx)
+
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(kafkaWriter.requestCtxErr).To(BeNil())
+			Expect(kafkaWriter.messages).To(HaveLen(1))
+		})
+
+		It("Should keep the topic paused when the buffered messages cannot be written", func() {
+			kafkaWriter.returnAnError = true
+
+			rr := sendRequest("POST", FORWARDING_ENDPOINT+"/responses/resume", context.TODO())
+
+			Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+			Expect(forwardingController.PausedTopics()).To(Equal([]string{"responses"}))
+
+			kafkaWriter.returnAnError = false
+
+			rr = sendRequest("POST", FORWARDING_ENDPOINT+"/responses/resume", context.TODO())
+
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(kafkaWriter.messages).To(HaveLen(1))
+		})
+	})
+})
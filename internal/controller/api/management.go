@@ -1,11 +1,13 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 
 	"github.com/RedHatInsights/cloud-connector/internal/config"
 	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
 	"github.com/RedHatInsights/cloud-connector/internal/middlewares"
 	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
 	"github.com/redhatinsights/platform-go-middlewares/request_id"
@@ -21,13 +23,15 @@ const (
 
 type ManagementServer struct {
 	connectionMgr controller.ConnectionLocator
+	lastErrors    *controller.LastErrorTracker
 	router        *mux.Router
 	config        *config.Config
 }
 
-func NewManagementServer(cm controller.ConnectionLocator, r *mux.Router, cfg *config.Config) *ManagementServer {
+func NewManagementServer(cm controller.ConnectionLocator, lastErrors *controller.LastErrorTracker, r *mux.Router, cfg *config.Config) *ManagementServer {
 	return &ManagementServer{
 		connectionMgr: cm,
+		lastErrors:    lastErrors,
 		router:        r,
 		config:        cfg,
 	}
@@ -46,6 +50,7 @@ func (s *ManagementServer) Routes() {
 	securedSubRouter.HandleFunc("/{id:[0-9]+}", s.handleConnectionListingByAccount()).Methods(http.MethodGet)
 	securedSubRouter.HandleFunc("/disconnect", s.handleDisconnect()).Methods(http.MethodPost)
 	securedSubRouter.HandleFunc("/status", s.handleConnectionStatus()).Methods(http.MethodPost)
+	securedSubRouter.HandleFunc("/handshake", s.handleConnectionHandshake()).Methods(http.MethodPost)
 }
 
 type connectionID struct {
@@ -54,7 +59,9 @@ type connectionID struct {
 }
 
 type connectionStatusResponse struct {
-	Status string `json:"status"`
+	Status    string                  `json:"status"`
+	LastError *controller.ClientError `json:"last_error,omitempty"`
+	Client    *domain.RhcClient       `json:"client,omitempty"`
 }
 
 func (s *ManagementServer) handleDisconnect() http.HandlerFunc {
@@ -121,6 +128,11 @@ func (s *ManagementServer) handleConnectionStatus() http.HandlerFunc {
 			return
 		}
 
+		if verifyAccountAccess(w, principal, connID.Account) == false {
+			logger.Debugf("Rejecting the request for the connection status of account:%s", connID.Account)
+			return
+		}
+
 		logger.Infof("Checking connection status for account:%s - node id:%s",
 			connID.Account, connID.NodeID)
 
@@ -129,8 +141,15 @@ func (s *ManagementServer) handleConnectionStatus() http.HandlerFunc {
 		client := s.connectionMgr.GetConnection(req.Context(), connID.Account, connID.NodeID)
 		if client != nil {
 			connectionStatus.Status = CONNECTED_STATUS
+
+			if detailer, ok := client.(controller.ClientDetailer); ok {
+				clientDetails := detailer.ClientDetails()
+				connectionStatus.Client = &clientDetails
+			}
 		}
 
+		connectionStatus.LastError = s.lastErrors.GetLastError(domain.ClientID(connID.NodeID))
+
 		logger.Infof("Connection status for account:%s - node id:%s => %s\n",
 			connID.Account, connID.NodeID, connectionStatus.Status)
 
@@ -138,6 +157,70 @@ func (s *ManagementServer) handleConnectionStatus() http.HandlerFunc {
 	}
 }
 
+type connectionHandshakeResponse struct {
+	Handshake json.RawMessage `json:"handshake"`
+}
+
+func (s *ManagementServer) handleConnectionHandshake() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		principal, _ := middlewares.GetPrincipal(req.Context())
+		requestId := request_id.GetReqID(req.Context())
+		logger := logger.Log.WithFields(logrus.Fields{
+			"account":    principal.GetAccount(),
+			"request_id": requestId})
+
+		body := http.MaxBytesReader(w, req.Body, 1048576)
+
+		var connID connectionID
+
+		if err := decodeJSON(body, &connID); err != nil {
+			errorResponse := errorResponse{Title: "Unable to process json input",
+				Status: http.StatusBadRequest,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		if verifyAccountAccess(w, principal, connID.Account) == false {
+			logger.Debugf("Rejecting the request for the handshake of account:%s", connID.Account)
+			return
+		}
+
+		logger.Infof("Getting the handshake for account:%s - node id:%s",
+			connID.Account, connID.NodeID)
+
+		client := s.connectionMgr.GetConnection(req.Context(), connID.Account, connID.NodeID)
+		if client == nil {
+			errMsg := fmt.Sprintf("No connection found for node (%s:%s)", connID.Account, connID.NodeID)
+			logger.Info(errMsg)
+			errorResponse := errorResponse{Title: errMsg,
+				Status: http.StatusBadRequest,
+				Detail: errMsg}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		var handshake []byte
+		if recorder, ok := client.(controller.HandshakeRecorder); ok {
+			handshake = recorder.RawHandshake()
+		}
+
+		if len(handshake) == 0 {
+			errMsg := fmt.Sprintf("No handshake stored for node (%s:%s)", connID.Account, connID.NodeID)
+			logger.Info(errMsg)
+			errorResponse := errorResponse{Title: errMsg,
+				Status: http.StatusNotFound,
+				Detail: errMsg}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		writeJSONResponse(w, http.StatusOK, connectionHandshakeResponse{Handshake: handshake})
+	}
+}
+
 func (s *ManagementServer) handleConnectionListing() http.HandlerFunc {
 
 	type ConnectionsPerAccount struct {
@@ -9,12 +9,14 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
 	"github.com/RedHatInsights/cloud-connector/internal/config"
 	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
 	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
 
 	"github.com/gorilla/mux"
@@ -24,11 +26,27 @@ const (
 	CONNECTION_LIST_ENDPOINT       = "/connection"
 	CONNECTION_STATUS_ENDPOINT     = "/connection/status"
 	CONNECTION_DISCONNECT_ENDPOINT = "/connection/disconnect"
+	CONNECTION_HANDSHAKE_ENDPOINT  = "/connection/handshake"
 
 	CONNECTED_ACCOUNT_NUMBER = "1234"
 	CONNECTED_NODE_ID        = "345"
+	DETAILED_ACCOUNT_NUMBER  = "5678"
 )
 
+type DetailedMockClient struct {
+	MockClient
+	details   domain.RhcClient
+	handshake []byte
+}
+
+func (dmc DetailedMockClient) ClientDetails() domain.RhcClient {
+	return dmc.details
+}
+
+func (dmc DetailedMockClient) RawHandshake() []byte {
+	return dmc.handshake
+}
+
 func init() {
 	logger.InitLogger()
 }
@@ -38,10 +56,16 @@ func createConnectionStatusPostBody(account_number string, node_id string) io.Re
 	return strings.NewReader(jsonString)
 }
 
+func createIdentityHeader(account string) string {
+	identity := fmt.Sprintf(`{ "identity": {"account_number": "%s", "type": "User", "internal": { "org_id": "1979710" } } }`, account)
+	return base64.StdEncoding.EncodeToString([]byte(identity))
+}
+
 var _ = Describe("Management", func() {
 
 	var (
 		cm                  *controller.LocalConnectionManager
+		lastErrors          *controller.LastErrorTracker
 		ms                  *ManagementServer
 		validIdentityHeader string
 	)
@@ -51,8 +75,20 @@ var _ = Describe("Management", func() {
 		cm = controller.NewLocalConnectionManager()
 		mc := MockClient{}
 		cm.Register(context.TODO(), CONNECTED_ACCOUNT_NUMBER, CONNECTED_NODE_ID, mc)
+		dmc := DetailedMockClient{details: domain.RhcClient{
+			ClientID: "detailed-node",
+			Account:  DETAILED_ACCOUNT_NUMBER,
+			DispatchersResult: &domain.DispatchersResult{
+				Dispatchers:         []string{"catalog"},
+				SourcesRegistration: domain.SourcesRegistrationRegistered,
+			},
+		},
+			handshake: []byte(`{"type":"connection-status","content":{"state":"online"}}`),
+		}
+		cm.Register(context.TODO(), DETAILED_ACCOUNT_NUMBER, "detailed-node", dmc)
 		cfg := config.GetConfig()
-		ms = NewManagementServer(cm, apiMux, cfg)
+		lastErrors = controller.NewLastErrorTracker(10, time.Minute)
+		ms = NewManagementServer(cm, lastErrors, apiMux, cfg)
 		ms.Routes()
 
 		identity := `{ "identity": {"account_number": "540155", "type": "User", "internal": { "org_id": "1979710" } } }`
@@ -68,7 +104,7 @@ var _ = Describe("Management", func() {
 				req, err := http.NewRequest("POST", CONNECTION_STATUS_ENDPOINT, postBody)
 				Expect(err).NotTo(HaveOccurred())
 
-				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+				req.Header.Add(IDENTITY_HEADER_NAME, createIdentityHeader(CONNECTED_ACCOUNT_NUMBER))
 
 				rr := httptest.NewRecorder()
 
@@ -88,7 +124,7 @@ var _ = Describe("Management", func() {
 				req, err := http.NewRequest("POST", CONNECTION_STATUS_ENDPOINT, postBody)
 				Expect(err).NotTo(HaveOccurred())
 
-				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+				req.Header.Add(IDENTITY_HEADER_NAME, createIdentityHeader("1234-not-here"))
 
 				rr := httptest.NewRecorder()
 
@@ -101,6 +137,71 @@ var _ = Describe("Management", func() {
 				Expect(rr.Code).To(Equal(http.StatusOK))
 			})
 
+			It("Should include the last error recorded for the customer", func() {
+
+				lastErrors.RecordError("node-with-error", "Unable to resolve the client's account")
+
+				postBody := createConnectionStatusPostBody(CONNECTED_ACCOUNT_NUMBER, "node-with-error")
+
+				req, err := http.NewRequest("POST", CONNECTION_STATUS_ENDPOINT, postBody)
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, createIdentityHeader(CONNECTED_ACCOUNT_NUMBER))
+
+				rr := httptest.NewRecorder()
+
+				ms.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+
+				var m map[string]interface{}
+				json.Unmarshal(rr.Body.Bytes(), &m)
+				Expect(m).Should(HaveKeyWithValue("status", DISCONNECTED_STATUS))
+				Expect(m).Should(HaveKey("last_error"))
+				Expect(m["last_error"]).Should(HaveKeyWithValue("reason", "Unable to resolve the client's account"))
+			})
+
+			It("Should include the details of the connected client", func() {
+
+				postBody := createConnectionStatusPostBody(DETAILED_ACCOUNT_NUMBER, "detailed-node")
+
+				req, err := http.NewRequest("POST", CONNECTION_STATUS_ENDPOINT, postBody)
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, createIdentityHeader(DETAILED_ACCOUNT_NUMBER))
+
+				rr := httptest.NewRecorder()
+
+				ms.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+
+				var response connectionStatusResponse
+				json.Unmarshal(rr.Body.Bytes(), &response)
+				Expect(response.Status).Should(Equal(CONNECTED_STATUS))
+				Expect(response.Client).ShouldNot(BeNil())
+				Expect(response.Client.DispatchersResult.Dispatchers).Should(Equal([]string{"catalog"}))
+				Expect(response.Client.DispatchersResult.SourcesRegistration).Should(Equal(domain.SourcesRegistrationRegistered))
+			})
+
+			It("Should not include a last error when no error has been recorded", func() {
+
+				postBody := createConnectionStatusPostBody(CONNECTED_ACCOUNT_NUMBER, CONNECTED_NODE_ID)
+
+				req, err := http.NewRequest("POST", CONNECTION_STATUS_ENDPOINT, postBody)
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, createIdentityHeader(CONNECTED_ACCOUNT_NUMBER))
+
+				rr := httptest.NewRecorder()
+
+				ms.router.ServeHTTP(rr, req)
+
+				var m map[string]interface{}
+				json.Unmarshal(rr.Body.Bytes(), &m)
+				Expect(m).ShouldNot(HaveKey("last_error"))
+			})
+
 			It("Should not be able get the status of a connected customer without providing account number", func() {
 
 				postBody := createConnectionStatusPostBody("", CONNECTED_NODE_ID)
@@ -124,7 +225,7 @@ var _ = Describe("Management", func() {
 				req, err := http.NewRequest("POST", CONNECTION_STATUS_ENDPOINT, postBody)
 				Expect(err).NotTo(HaveOccurred())
 
-				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+				req.Header.Add(IDENTITY_HEADER_NAME, createIdentityHeader(CONNECTED_ACCOUNT_NUMBER))
 
 				rr := httptest.NewRecorder()
 
@@ -135,6 +236,31 @@ var _ = Describe("Management", func() {
 
 		})
 
+		Context("With an identity header for another account", func() {
+			It("Should not be able to get the status of a connected customer", func() {
+
+				lastErrors.RecordError("detailed-node", "Unable to resolve the client's account")
+
+				postBody := createConnectionStatusPostBody(DETAILED_ACCOUNT_NUMBER, "detailed-node")
+
+				req, err := http.NewRequest("POST", CONNECTION_STATUS_ENDPOINT, postBody)
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				ms.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusForbidden))
+
+				var m map[string]interface{}
+				json.Unmarshal(rr.Body.Bytes(), &m)
+				Expect(m).ShouldNot(HaveKey("client"))
+				Expect(m).ShouldNot(HaveKey("last_error"))
+			})
+		})
+
 		Context("With valid service to service credentials", func() {
 			It("Should be able to get the status of a connected customer", func() {
 				ms.config.ServiceToServiceCredentials["test_client_1"] = "12345"
@@ -311,6 +437,96 @@ var _ = Describe("Management", func() {
 
 	})
 
+	Describe("Connecting to the connection/handshake endpoint", func() {
+		Context("With a valid identity header", func() {
+			It("Should be able to get the handshake of a connected customer", func() {
+
+				postBody := createConnectionStatusPostBody(DETAILED_ACCOUNT_NUMBER, "detailed-node")
+
+				req, err := http.NewRequest("POST", CONNECTION_HANDSHAKE_ENDPOINT, postBody)
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, createIdentityHeader(DETAILED_ACCOUNT_NUMBER))
+
+				rr := httptest.NewRecorder()
+
+				ms.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+
+				var m map[string]map[string]interface{}
+				json.Unmarshal(rr.Body.Bytes(), &m)
+				Expect(m["handshake"]).Should(HaveKeyWithValue("type", "connection-status"))
+				Expect(m["handshake"]).Should(HaveKeyWithValue("content", map[string]interface{}{"state": "online"}))
+			})
+
+			It("Should not find a handshake for a client that did not store one", func() {
+
+				postBody := createConnectionStatusPostBody(CONNECTED_ACCOUNT_NUMBER, CONNECTED_NODE_ID)
+
+				req, err := http.NewRequest("POST", CONNECTION_HANDSHAKE_ENDPOINT, postBody)
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, createIdentityHeader(CONNECTED_ACCOUNT_NUMBER))
+
+				rr := httptest.NewRecorder()
+
+				ms.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusNotFound))
+			})
+
+			It("Should not be able to get the handshake of a disconnected customer", func() {
+
+				postBody := createConnectionStatusPostBody("1234-not-here", CONNECTED_NODE_ID)
+
+				req, err := http.NewRequest("POST", CONNECTION_HANDSHAKE_ENDPOINT, postBody)
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, createIdentityHeader("1234-not-here"))
+
+				rr := httptest.NewRecorder()
+
+				ms.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+
+			It("Should not be able to get the handshake of another account's customer", func() {
+
+				postBody := createConnectionStatusPostBody(DETAILED_ACCOUNT_NUMBER, "detailed-node")
+
+				req, err := http.NewRequest("POST", CONNECTION_HANDSHAKE_ENDPOINT, postBody)
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				ms.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusForbidden))
+				Expect(rr.Body.String()).ShouldNot(ContainSubstring("connection-status"))
+			})
+		})
+
+		Context("Without an identity header or service to service credentials", func() {
+			It("Should fail to get the handshake of a connected customer", func() {
+
+				postBody := createConnectionStatusPostBody(DETAILED_ACCOUNT_NUMBER, "detailed-node")
+
+				req, err := http.NewRequest("POST", CONNECTION_HANDSHAKE_ENDPOINT, postBody)
+				Expect(err).NotTo(HaveOccurred())
+
+				rr := httptest.NewRecorder()
+
+				ms.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+			})
+		})
+	})
+
 	Describe("Connecting to the connection list endpoint", func() {
 		Context("With a valid identity header", func() {
 			It("Should be able to get a list of open connections", func() {
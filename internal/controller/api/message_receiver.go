@@ -43,13 +43,18 @@ type messageRequest struct {
 	Account   string      `json:"account" validate:"required"`
 	Recipient string      `json:"recipient" validate:"required"`
 	Payload   interface{} `json:"payload" validate:"required"`
-	Directive string      `json:"directive" validate:"required"`
+	Directive string      `json:"directive"`
 }
 
 type messageResponse struct {
 	JobID string `json:"id"`
 }
 
+type dryRunResponse struct {
+	ID       string                      `json:"id,omitempty"`
+	Messages []controller.MessagePreview `json:"messages"`
+}
+
 func (jr *MessageReceiver) handleJob() http.HandlerFunc {
 
 	return func(w http.ResponseWriter, req *http.Request) {
@@ -60,6 +65,16 @@ func (jr *MessageReceiver) handleJob() http.HandlerFunc {
 			"account":    principal.GetAccount(),
 			"request_id": requestId})
 
+		dryRun, err := isDryRun(req)
+		if err != nil {
+			logger.Debug(err.Error())
+			errorResponse := errorResponse{Title: err.Error(),
+				Status: http.StatusBadRequest,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
 		var msgRequest messageRequest
 
 		body := http.MaxBytesReader(w, req.Body, 1048576)
@@ -74,6 +89,20 @@ func (jr *MessageReceiver) handleJob() http.HandlerFunc {
 			return
 		}
 
+		if msgRequest.Directive == "" {
+			msgRequest.Directive = jr.config.DefaultDataDirective
+		}
+
+		if msgRequest.Directive == "" {
+			errMsg := "A directive must be provided"
+			logger.Debug(errMsg)
+			errorResponse := errorResponse{Title: errMsg,
+				Status: http.StatusBadRequest,
+				Detail: errMsg}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
 		var client controller.Receptor
 		client = jr.connectionMgr.GetConnection(req.Context(), msgRequest.Account, msgRequest.Recipient)
 		if client == nil {
@@ -83,6 +112,12 @@ func (jr *MessageReceiver) handleJob() http.HandlerFunc {
 
 		logger = logger.WithFields(logrus.Fields{"recipient": msgRequest.Recipient,
 			"directive": msgRequest.Directive})
+
+		if dryRun {
+			jr.previewMessage(req, w, logger, client, msgRequest)
+			return
+		}
+
 		logger.Info("Sending a message")
 
 		jobID, err := client.SendMessage(req.Context(), msgRequest.Account, msgRequest.Recipient,
@@ -94,6 +129,11 @@ func (jr *MessageReceiver) handleJob() http.HandlerFunc {
 			return
 		}
 
+		if tooLarge, isTooLarge := err.(*controller.MessageTooLargeError); isTooLarge {
+			writeMessageTooLargeResponse(logger, w, tooLarge)
+			return
+		}
+
 		if err != nil {
 			logger.WithFields(logrus.Fields{"error": err}).Info("Error passing message to receptor")
 			errorResponse := errorResponse{Title: "Error passing message to receptor",
@@ -111,6 +151,41 @@ func (jr *MessageReceiver) handleJob() http.HandlerFunc {
 	}
 }
 
+// previewMessage responds with the messages that would be sent to the client
+func (jr *MessageReceiver) previewMessage(req *http.Request, w http.ResponseWriter, logger *logrus.Entry, client controller.Receptor, msgRequest messageRequest) {
+	previewer, ok := client.(controller.MessagePreviewer)
+	if ok == false {
+		errMsg := "Dry run is not supported for the connection"
+		logger.Info(errMsg)
+		errorResponse := errorResponse{Title: errMsg,
+			Status: http.StatusBadRequest,
+			Detail: errMsg}
+		writeJSONResponse(w, errorResponse.Status, errorResponse)
+		return
+	}
+
+	messageID, messages, err := previewer.PreviewMessage(req.Context(), msgRequest.Account, msgRequest.Recipient,
+		msgRequest.Payload,
+		msgRequest.Directive)
+	if tooLarge, isTooLarge := err.(*controller.MessageTooLargeError); isTooLarge {
+		writeMessageTooLargeResponse(logger, w, tooLarge)
+		return
+	}
+
+	if err != nil {
+		logger.WithFields(logrus.Fields{"error": err}).Info("Error building the message")
+		errorResponse := errorResponse{Title: "Error building the message",
+			Status: http.StatusInternalServerError,
+			Detail: err.Error()}
+		writeJSONResponse(w, errorResponse.Status, errorResponse)
+		return
+	}
+
+	logger.WithFields(logrus.Fields{"message_id": messageID}).Info("Built a message without sending it (dry run)")
+
+	writeJSONResponse(w, http.StatusOK, dryRunResponse{ID: messageID.String(), Messages: messages})
+}
+
 func writeConnectionFailureResponse(logger *logrus.Entry, w http.ResponseWriter) {
 	// The connection to the customer's receptor node was not available
 	errMsg := "No connection to the receptor node"
@@ -120,3 +195,21 @@ func writeConnectionFailureResponse(logger *logrus.Entry, w http.ResponseWriter)
 		Detail: errMsg}
 	writeJSONResponse(w, errorResponse.Status, errorResponse)
 }
+
+// writeCapabilityNotSupportedResponse responds to a request to send a client a command or
+// directive that the client did not advertise support for
+func writeCapabilityNotSupportedResponse(logger *logrus.Entry, w http.ResponseWriter, err error) {
+	logger.WithFields(logrus.Fields{"error": err}).Info("The client does not support the command")
+	errorResponse := errorResponse{Title: "The client does not support the command",
+		Status: http.StatusBadRequest,
+		Detail: err.Error()}
+	writeJSONResponse(w, errorResponse.Status, errorResponse)
+}
+
+func writeMessageTooLargeResponse(logger *logrus.Entry, w http.ResponseWriter, err *controller.MessageTooLargeError) {
+	logger.WithFields(logrus.Fields{"size": err.Size, "limit": err.Limit}).Info("Message payload is too large")
+	errorResponse := errorResponse{Title: "Message payload is too large",
+		Status: http.StatusRequestEntityTooLarge,
+		Detail: err.Error()}
+	writeJSONResponse(w, errorResponse.Status, errorResponse)
+}
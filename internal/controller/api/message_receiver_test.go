@@ -14,8 +14,10 @@ import (
 
 	"github.com/RedHatInsights/cloud-connector/internal/config"
 	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/mqtt"
 	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
 
+	MQTT "github.com/eclipse/paho.mqtt.golang"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
@@ -44,6 +46,38 @@ func (mc MockClient) Close(context.Context) error {
 	return nil
 }
 
+type DirectiveRecordingClient struct {
+	directive string
+}
+
+func (drc *DirectiveRecordingClient) SendMessage(ctx context.Context, account string, recipient string, payload interface{}, directive string) (*uuid.UUID, error) {
+	drc.directive = directive
+	myUUID, _ := uuid.NewRandom()
+	return &myUUID, nil
+}
+
+func (drc *DirectiveRecordingClient) Close(context.Context) error {
+	return nil
+}
+
+type publishedMessage struct {
+	topic   string
+	payload map[string]interface{}
+}
+
+// PublishRecordingMqttClient records the messages that are published to the broker
+type PublishRecordingMqttClient struct {
+	MQTT.Client
+	published []publishedMessage
+}
+
+func (c *PublishRecordingMqttClient) Publish(topic string, qos byte, retained bool, payload interface{}) MQTT.Token {
+	var m map[string]interface{}
+	json.Unmarshal(payload.([]byte), &m)
+	c.published = append(c.published, publishedMessage{topic: topic, payload: m})
+	return completedToken{}
+}
+
 func init() {
 	logger.InitLogger()
 }
@@ -52,6 +86,8 @@ var _ = Describe("MessageReceiver", func() {
 
 	var (
 		jr                  *MessageReceiver
+		recordingClient     *DirectiveRecordingClient
+		mqttClient          *PublishRecordingMqttClient
 		validIdentityHeader string
 	)
 
@@ -62,6 +98,10 @@ var _ = Describe("MessageReceiver", func() {
 		cm.Register(context.TODO(), "1234", "345", mc)
 		errorMC := MockClient{returnAnError: true}
 		cm.Register(context.TODO(), "1234", "error-client", errorMC)
+		recordingClient = &DirectiveRecordingClient{}
+		cm.Register(context.TODO(), "1234", "recording-client", recordingClient)
+		mqttClient = &PublishRecordingMqttClient{}
+		cm.Register(context.TODO(), "1234", "mqtt-client", &mqtt.ReceptorMQTTProxy{ClientID: "mqtt-client", Client: mqttClient})
 		cfg := config.GetConfig()
 		jr = NewMessageReceiver(cm, apiMux, cfg)
 		jr.Routes()
@@ -212,6 +252,46 @@ var _ = Describe("MessageReceiver", func() {
 
 		})
 
+		Context("With a default directive configured", func() {
+			BeforeEach(func() {
+				jr.config.DefaultDataDirective = "default:directive"
+			})
+
+			It("Should use the default directive when the directive is omitted", func() {
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"recording-client\", \"payload\": [\"678\"]}"
+
+				req, err := http.NewRequest("POST", MESSAGE_ENDPOINT, strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusCreated))
+				Expect(recordingClient.directive).To(Equal("default:directive"))
+			})
+
+			It("Should use the directive from the request when it is provided", func() {
+
+				postBody := "{\"account\": \"1234\", \"recipient\": \"recording-client\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}"
+
+				req, err := http.NewRequest("POST", MESSAGE_ENDPOINT, strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusCreated))
+				Expect(recordingClient.directive).To(Equal("fred:flintstone"))
+			})
+		})
+
 		Context("Without an identity header or pre shared key", func() {
 			It("Should fail to send a job to a connected customer", func() {
 
@@ -296,5 +376,82 @@ var _ = Describe("MessageReceiver", func() {
 			})
 		})
 
+		Context("With the dry_run query parameter", func() {
+
+			postMessage := func(url string, recipient string) *httptest.ResponseRecorder {
+				postBody := "{\"account\": \"1234\", \"recipient\": \"" + recipient + "\", \"payload\": [\"678\"], \"directive\": \"fred:flintstone\"}"
+
+				req, err := http.NewRequest("POST", url, strings.NewReader(postBody))
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				jr.router.ServeHTTP(rr, req)
+
+				return rr
+			}
+
+			It("Should return the message without publishing it", func() {
+
+				rr := postMessage(MESSAGE_ENDPOINT+"?dry_run=true", "mqtt-client")
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+				Expect(mqttClient.published).To(BeEmpty())
+
+				var preview struct {
+					ID       string `json:"id"`
+					Messages []struct {
+						Topic   string                 `json:"topic"`
+						Message map[string]interface{} `json:"message"`
+					} `json:"messages"`
+				}
+				json.Unmarshal(rr.Body.Bytes(), &preview)
+
+				Expect(preview.Messages).To(HaveLen(1))
+				Expect(preview.Messages[0].Message["message_id"]).To(Equal(preview.ID))
+
+				// The previewed message should match the message that is published,
+				// other than the message id and the time it was sent
+				rr = postMessage(MESSAGE_ENDPOINT, "mqtt-client")
+
+				Expect(rr.Code).To(Equal(http.StatusCreated))
+				Expect(mqttClient.published).To(HaveLen(1))
+
+				for _, m := range []map[string]interface{}{preview.Messages[0].Message, mqttClient.published[0].payload} {
+					delete(m, "message_id")
+					delete(m, "sent")
+				}
+
+				Expect(preview.Messages[0].Topic).To(Equal(mqttClient.published[0].topic))
+				Expect(preview.Messages[0].Message).To(Equal(mqttClient.published[0].payload))
+			})
+
+			It("Should send the message when dry_run is false", func() {
+
+				rr := postMessage(MESSAGE_ENDPOINT+"?dry_run=false", "mqtt-client")
+
+				Expect(rr.Code).To(Equal(http.StatusCreated))
+				Expect(mqttClient.published).To(HaveLen(1))
+			})
+
+			It("Should reject an invalid dry_run value", func() {
+
+				rr := postMessage(MESSAGE_ENDPOINT+"?dry_run=maybe", "mqtt-client")
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+				Expect(mqttClient.published).To(BeEmpty())
+			})
+
+			It("Should reject a dry run for a connection that does not support it", func() {
+
+				rr := postMessage(MESSAGE_ENDPOINT+"?dry_run=true", "recording-client")
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+				Expect(recordingClient.directive).To(BeEmpty())
+			})
+		})
+
 	})
 })
@@ -1,32 +1,70 @@
 package api
 
 import (
+	"context"
 	"net/http"
 	_ "net/http/pprof"
 
 	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
 	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
 
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
 )
 
+// ReadinessCheck returns an error if the dependency that it checks is not ready
+type ReadinessCheck func() error
+
+type namedReadinessCheck struct {
+	name  string
+	check ReadinessCheck
+}
+
 type MonitoringServer struct {
-	router *mux.Router
-	config *config.Config
+	connectionRegistrar controller.ConnectionRegistrar
+	readinessChecks     []namedReadinessCheck
+	clientCounter       *controller.ClientCounter
+	router              *mux.Router
+	config              *config.Config
 }
 
-func NewMonitoringServer(r *mux.Router, cfg *config.Config) *MonitoringServer {
+// NewMonitoringServer creates the monitoring server.  The connection registrar is
+// optional.  When it is provided, the pod is only ready if the registrar is reachable.
+func NewMonitoringServer(cr controller.ConnectionRegistrar, r *mux.Router, cfg *config.Config) *MonitoringServer {
 	return &MonitoringServer{
-		router: r,
-		config: cfg,
+		connectionRegistrar: cr,
+		router:              r,
+		config:              cfg,
 	}
 }
 
+// AddReadinessCheck adds a check that has to pass before the pod is ready
+func (s *MonitoringServer) AddReadinessCheck(name string, check ReadinessCheck) {
+	s.readinessChecks = append(s.readinessChecks, namedReadinessCheck{name: name, check: check})
+}
+
+// SetClientCounter enables the endpoint that reports the number of connected clients
+func (s *MonitoringServer) SetClientCounter(cc *controller.ClientCounter) {
+	s.clientCounter = cc
+}
+
 func (s *MonitoringServer) Routes() {
 	s.router.Handle("/metrics", promhttp.Handler()).Methods(http.MethodGet)
-	s.router.HandleFunc("/liveness", s.handleLiveness()).Methods(http.MethodGet)
-	s.router.HandleFunc("/readiness", s.handleReadiness()).Methods(http.MethodGet)
+
+	// livez only reports that the process is up.  readyz also checks that the dependencies
+	// are reachable.  /liveness and /readiness are kept for existing deployments.
+	for _, path := range []string{"/livez", "/liveness"} {
+		s.router.HandleFunc(path, s.handleLiveness()).Methods(http.MethodGet)
+	}
+	for _, path := range []string{"/readyz", "/readiness"} {
+		s.router.HandleFunc(path, s.handleReadiness()).Methods(http.MethodGet)
+	}
+
+	if s.clientCounter != nil {
+		s.router.HandleFunc("/connection_count", s.handleConnectionCount()).Methods(http.MethodGet)
+	}
 
 	if s.config.Profile {
 		logger.Log.Warn("WARNING: Enabling the profiler endpoint!!")
@@ -40,8 +78,43 @@ func (s *MonitoringServer) handleLiveness() http.HandlerFunc {
 	}
 }
 
+func (s *MonitoringServer) handleConnectionCount() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		count, err := s.clientCounter.Count(req.Context())
+		if err != nil {
+			logger.Log.WithFields(logrus.Fields{"error": err}).Error("Unable to count the connected clients")
+			errorResponse := errorResponse{Title: "Unable to count the connected clients",
+				Status: http.StatusInternalServerError,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		writeJSONResponse(w, http.StatusOK, count)
+	}
+}
+
 func (s *MonitoringServer) handleReadiness() http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
+		if s.connectionRegistrar != nil {
+			ctx, cancel := context.WithTimeout(req.Context(), s.config.ReadinessCheckTimeout)
+			defer cancel()
+
+			if err := s.connectionRegistrar.Ping(ctx); err != nil {
+				logger.Log.WithFields(logrus.Fields{"error": err}).Warn("Connection registrar is not reachable")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		for _, readinessCheck := range s.readinessChecks {
+			if err := readinessCheck.check(); err != nil {
+				logger.Log.WithFields(logrus.Fields{"check": readinessCheck.name, "error": err}).Warn("Readiness check failed")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}
+
 		w.WriteHeader(http.StatusOK)
 	}
 }
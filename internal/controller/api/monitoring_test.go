@@ -1,14 +1,21 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
 
 	"github.com/go-playground/assert/v2"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func TestMonitoringEndpoints(t *testing.T) {
@@ -47,6 +54,21 @@ func TestMonitoringEndpoints(t *testing.T) {
 			httpMethod:     "POST",
 			expectedStatus: http.StatusMethodNotAllowed,
 		},
+		{
+			endpoint:       "/livez",
+			httpMethod:     "GET",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			endpoint:       "/readyz",
+			httpMethod:     "GET",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			endpoint:       "/readyz",
+			httpMethod:     "POST",
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
 	}
 
 	for _, tc := range tests {
@@ -58,7 +80,7 @@ func TestMonitoringEndpoints(t *testing.T) {
 
 			cfg := config.GetConfig()
 			apiMux := mux.NewRouter()
-			apiSpecServer := NewMonitoringServer(apiMux, cfg)
+			apiSpecServer := NewMonitoringServer(nil, apiMux, cfg)
 			apiSpecServer.Routes()
 
 			apiSpecServer.router.ServeHTTP(rr, req)
@@ -67,3 +89,111 @@ func TestMonitoringEndpoints(t *testing.T) {
 		})
 	}
 }
+
+type pingingRegistrar struct {
+	controller.ConnectionRegistrar
+	err   error
+	delay time.Duration
+}
+
+func (pr pingingRegistrar) Ping(ctx context.Context) error {
+	select {
+	case <-time.After(pr.delay):
+		return pr.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestReadinessIncludesConnectionRegistrar(t *testing.T) {
+	tests := []struct {
+		name           string
+		registrar      pingingRegistrar
+		expectedStatus int
+	}{
+		{"healthy registrar", pingingRegistrar{}, http.StatusOK},
+		{"failing registrar", pingingRegistrar{err: errors.New("connection refused")}, http.StatusServiceUnavailable},
+		{"unresponsive registrar", pingingRegistrar{delay: time.Minute}, http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/readiness", nil)
+			assert.Equal(t, err, nil)
+
+			rr := httptest.NewRecorder()
+
+			cfg := config.GetConfig()
+			cfg.ReadinessCheckTimeout = 10 * time.Millisecond
+			apiMux := mux.NewRouter()
+			monitoringServer := NewMonitoringServer(tc.registrar, apiMux, cfg)
+			monitoringServer.Routes()
+
+			start := time.Now()
+			monitoringServer.router.ServeHTTP(rr, req)
+
+			assert.Equal(t, rr.Code, tc.expectedStatus)
+			assert.Equal(t, time.Since(start) < time.Second, true)
+		})
+	}
+}
+
+func TestReadinessChecks(t *testing.T) {
+	notReady := errors.New("not ready")
+
+	tests := []struct {
+		name                   string
+		checks                 []ReadinessCheck
+		expectedLivenessStatus int
+		expectedStatus         int
+	}{
+		{"no checks", nil, http.StatusOK, http.StatusOK},
+		{"passing checks", []ReadinessCheck{func() error { return nil }, func() error { return nil }}, http.StatusOK, http.StatusOK},
+		{"failing check", []ReadinessCheck{func() error { return nil }, func() error { return notReady }}, http.StatusOK, http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := config.GetConfig()
+			apiMux := mux.NewRouter()
+			monitoringServer := NewMonitoringServer(nil, apiMux, cfg)
+			for i, check := range tc.checks {
+				monitoringServer.AddReadinessCheck(fmt.Sprintf("check-%d", i), check)
+			}
+			monitoringServer.Routes()
+
+			for endpoint, expectedStatus := range map[string]int{"/livez": tc.expectedLivenessStatus, "/readyz": tc.expectedStatus, "/readiness": tc.expectedStatus} {
+				req, err := http.NewRequest("GET", endpoint, nil)
+				assert.Equal(t, err, nil)
+
+				rr := httptest.NewRecorder()
+				monitoringServer.router.ServeHTTP(rr, req)
+
+				assert.Equal(t, rr.Code, expectedStatus)
+			}
+		})
+	}
+}
+
+func TestConnectionCountEndpoint(t *testing.T) {
+	cm := controller.NewLocalConnectionManager()
+	cm.Register(context.TODO(), "1234", "client-1", MockClient{})
+
+	cfg := config.GetConfig()
+	apiMux := mux.NewRouter()
+	monitoringServer := NewMonitoringServer(cm, apiMux, cfg)
+	monitoringServer.SetClientCounter(controller.NewClientCounter(cm, time.Minute, controller.NewMetrics(prometheus.NewRegistry())))
+	monitoringServer.Routes()
+
+	req, err := http.NewRequest("GET", "/connection_count", nil)
+	assert.Equal(t, err, nil)
+
+	rr := httptest.NewRecorder()
+	monitoringServer.router.ServeHTTP(rr, req)
+
+	assert.Equal(t, rr.Code, http.StatusOK)
+
+	var count controller.ClientCount
+	assert.Equal(t, json.Unmarshal(rr.Body.Bytes(), &count), nil)
+	assert.Equal(t, count.Count, 1)
+}
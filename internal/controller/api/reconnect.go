@@ -0,0 +1,140 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/middlewares"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+	"github.com/redhatinsights/platform-go-middlewares/request_id"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+type ReconnectServer struct {
+	reconnector controller.ClientReconnector
+	router      *mux.Router
+	config      *config.Config
+}
+
+func NewReconnectServer(cr controller.ClientReconnector, r *mux.Router, cfg *config.Config) *ReconnectServer {
+	return &ReconnectServer{
+		reconnector: cr,
+		router:      r,
+		config:      cfg,
+	}
+}
+
+func (s *ReconnectServer) Routes() {
+	mmw := &middlewares.MetricsMiddleware{}
+	amw := &middlewares.AuthMiddleware{Secrets: s.config.ServiceToServiceCredentials}
+
+	securedSubRouter := s.router.PathPrefix("/connection/reconnect").Subrouter()
+	securedSubRouter.Use(logger.AccessLoggerMiddleware,
+		mmw.RecordHTTPMetrics,
+		amw.Authenticate)
+
+	securedSubRouter.HandleFunc("", s.handleReconnect()).Methods(http.MethodPost)
+}
+
+type reconnectRequest struct {
+	Account string `json:"account" validate:"required"`
+	NodeID  string `json:"node_id" validate:"required"`
+	Delay   int    `json:"delay" validate:"min=0"`
+}
+
+func (s *ReconnectServer) handleReconnect() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		principal, _ := middlewares.GetPrincipal(req.Context())
+		requestId := request_id.GetReqID(req.Context())
+		logger := logger.Log.WithFields(logrus.Fields{
+			"account":    principal.GetAccount(),
+			"request_id": requestId})
+
+		dryRun, err := isDryRun(req)
+		if err != nil {
+			errorResponse := errorResponse{Title: err.Error(),
+				Status: http.StatusBadRequest,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		body := http.MaxBytesReader(w, req.Body, 1048576)
+
+		var reconnectReq reconnectRequest
+
+		if err := decodeJSON(body, &reconnectReq); err != nil {
+			errorResponse := errorResponse{Title: "Unable to process json input",
+				Status: http.StatusBadRequest,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		if dryRun {
+			s.previewReconnect(req, w, logger, reconnectReq)
+			return
+		}
+
+		logger.Infof("Sending reconnect command to account:%s - node id:%s - delay:%d",
+			reconnectReq.Account, reconnectReq.NodeID, reconnectReq.Delay)
+
+		err = s.reconnector.Reconnect(req.Context(), domain.ClientID(reconnectReq.NodeID), reconnectReq.Delay)
+		if errors.Is(err, controller.ErrCapabilityNotSupported) {
+			writeCapabilityNotSupportedResponse(logger, w, err)
+			return
+		}
+
+		if err != nil {
+			logger.WithFields(logrus.Fields{"error": err}).Error("Unable to send reconnect command")
+			errorResponse := errorResponse{Title: "Unable to send reconnect command",
+				Status: http.StatusInternalServerError,
+				Detail: err.Error()}
+			writeJSONResponse(w, errorResponse.Status, errorResponse)
+			return
+		}
+
+		writeJSONResponse(w, http.StatusOK, struct{}{})
+	}
+}
+
+// previewReconnect responds with the reconnect command that would be sent to the client
+func (s *ReconnectServer) previewReconnect(req *http.Request, w http.ResponseWriter, logger *logrus.Entry, reconnectReq reconnectRequest) {
+	previewer, ok := s.reconnector.(controller.ReconnectPreviewer)
+	if ok == false {
+		errMsg := "Dry run is not supported for the reconnect command"
+		logger.Info(errMsg)
+		errorResponse := errorResponse{Title: errMsg,
+			Status: http.StatusBadRequest,
+			Detail: errMsg}
+		writeJSONResponse(w, errorResponse.Status, errorResponse)
+		return
+	}
+
+	message, err := previewer.PreviewReconnect(req.Context(), domain.ClientID(reconnectReq.NodeID), reconnectReq.Delay)
+	if errors.Is(err, controller.ErrCapabilityNotSupported) {
+		writeCapabilityNotSupportedResponse(logger, w, err)
+		return
+	}
+
+	if err != nil {
+		logger.WithFields(logrus.Fields{"error": err}).Error("Unable to build reconnect command")
+		errorResponse := errorResponse{Title: "Unable to build reconnect command",
+			Status: http.StatusInternalServerError,
+			Detail: err.Error()}
+		writeJSONResponse(w, errorResponse.Status, errorResponse)
+		return
+	}
+
+	logger.Infof("Built reconnect command without sending it (dry run) for account:%s - node id:%s - delay:%d",
+		reconnectReq.Account, reconnectReq.NodeID, reconnectReq.Delay)
+
+	writeJSONResponse(w, http.StatusOK, dryRunResponse{Messages: []controller.MessagePreview{message}})
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/mqtt"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	CONNECTION_RECONNECT_ENDPOINT = "/connection/reconnect"
+)
+
+type RecordingReconnector struct {
+	clientID      domain.ClientID
+	delay         int
+	returnAnError bool
+}
+
+func (rr *RecordingReconnector) Reconnect(ctx context.Context, clientID domain.ClientID, delay int) error {
+	if rr.returnAnError {
+		return errors.New("ImaError")
+	}
+	rr.clientID = clientID
+	rr.delay = delay
+	return nil
+}
+
+var _ = Describe("Reconnect", func() {
+
+	var (
+		apiMux              *mux.Router
+		cfg                 *config.Config
+		cm                  *controller.LocalConnectionManager
+		reconnector         *RecordingReconnector
+		validIdentityHeader string
+	)
+
+	BeforeEach(func() {
+		apiMux = mux.NewRouter()
+		cfg = config.GetConfig()
+
+		cm = controller.NewLocalConnectionManager()
+		cm.Register(context.TODO(), "1234", "capable-node", DetailedMockClient{details: domain.RhcClient{
+			ClientID:     "capable-node",
+			Capabilities: []string{"reconnect"},
+		}})
+		cm.Register(context.TODO(), "1234", "incapable-node", DetailedMockClient{details: domain.RhcClient{
+			ClientID: "incapable-node",
+		}})
+
+		// The management server shares the /connection prefix
+		ms := NewManagementServer(cm, controller.NewLastErrorTracker(10, time.Minute), apiMux, cfg)
+		ms.Routes()
+
+		reconnector = &RecordingReconnector{}
+		rs := NewReconnectServer(reconnector, apiMux, cfg)
+		rs.Routes()
+
+		identity := `{ "identity": {"account_number": "540155", "type": "User", "internal": { "org_id": "1979710" } } }`
+		validIdentityHeader = base64.StdEncoding.EncodeToString([]byte(identity))
+	})
+
+	postReconnectWithQuery := func(body string, query string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", CONNECTION_RECONNECT_ENDPOINT+query, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+
+		req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+		rr := httptest.NewRecorder()
+
+		apiMux.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	postReconnect := func(body string) *httptest.ResponseRecorder {
+		return postReconnectWithQuery(body, "")
+	}
+
+	Describe("Connecting to the connection/reconnect endpoint", func() {
+		Context("With a valid identity header", func() {
+			It("Should send a reconnect command to the client", func() {
+
+				rr := postReconnect(`{"account": "1234", "node_id": "345", "delay": 30}`)
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+				Expect(reconnector.clientID).To(Equal(domain.ClientID("345")))
+				Expect(reconnector.delay).To(Equal(30))
+			})
+
+			It("Should reject a negative delay", func() {
+
+				rr := postReconnect(`{"account": "1234", "node_id": "345", "delay": -1}`)
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+
+			It("Should reject a request without a node id", func() {
+
+				rr := postReconnect(`{"account": "1234", "delay": 30}`)
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+
+			It("Should return an error when the command cannot be sent", func() {
+
+				reconnector.returnAnError = true
+
+				rr := postReconnect(`{"account": "1234", "node_id": "345", "delay": 30}`)
+
+				Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+			})
+		})
+
+		Context("With a sender that requires the command capabilities", func() {
+
+			var mqttClient *PublishRecordingMqttClient
+
+			BeforeEach(func() {
+				apiMux = mux.NewRouter()
+				mqttClient = &PublishRecordingMqttClient{}
+				sender := mqtt.NewControlMessageSender(mqttClient, mqtt.NewTopicBuilder(), mqtt.WithCapabilityGate(mqtt.NewCapabilityGate(cm)))
+				rs := NewReconnectServer(sender, apiMux, cfg)
+				rs.Routes()
+			})
+
+			It("Should send the command to a client that advertises support for it", func() {
+
+				rr := postReconnect(`{"account": "1234", "node_id": "capable-node", "delay": 30}`)
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+				Expect(mqttClient.published).To(HaveLen(1))
+			})
+
+			It("Should reject sending the command to a client that does not advertise support for it", func() {
+
+				rr := postReconnect(`{"account": "1234", "node_id": "incapable-node", "delay": 30}`)
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+				Expect(mqttClient.published).To(BeEmpty())
+			})
+
+			It("Should reject previewing the command for a client that does not advertise support for it", func() {
+
+				rr := postReconnectWithQuery(`{"account": "1234", "node_id": "incapable-node", "delay": 30}`, "?dry_run=true")
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Context("With the dry_run query parameter", func() {
+
+			var mqttClient *PublishRecordingMqttClient
+
+			BeforeEach(func() {
+				// Use a reconnector that builds real reconnect commands
+				apiMux = mux.NewRouter()
+				mqttClient = &PublishRecordingMqttClient{}
+				rs := NewReconnectServer(mqtt.NewControlMessageSender(mqttClient, mqtt.NewTopicBuilder()), apiMux, cfg)
+				rs.Routes()
+			})
+
+			It("Should return the reconnect command without publishing it", func() {
+
+				rr := postReconnectWithQuery(`{"account": "1234", "node_id": "345", "delay": 30}`, "?dry_run=true")
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+				Expect(mqttClient.published).To(BeEmpty())
+
+				var preview struct {
+					Messages []struct {
+						Topic   string                 `json:"topic"`
+						Message map[string]interface{} `json:"message"`
+					} `json:"messages"`
+				}
+				json.Unmarshal(rr.Body.Bytes(), &preview)
+
+				Expect(preview.Messages).To(HaveLen(1))
+
+				// The previewed command should match the command that is published,
+				// other than the message id, the correlation id that defaults to the
+				// message id and the time it was sent
+				rr = postReconnect(`{"account": "1234", "node_id": "345", "delay": 30}`)
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+				Expect(mqttClient.published).To(HaveLen(1))
+
+				for _, m := range []map[string]interface{}{preview.Messages[0].Message, mqttClient.published[0].payload} {
+					delete(m, "message_id")
+					delete(m, "correlation_id")
+					delete(m, "sent")
+				}
+
+				Expect(preview.Messages[0].Topic).To(Equal("redhat/insights/345/control/in"))
+				Expect(preview.Messages[0].Topic).To(Equal(mqttClient.published[0].topic))
+				Expect(preview.Messages[0].Message).To(Equal(mqttClient.published[0].payload))
+			})
+		})
+
+		Context("With a reconnector that does not support dry runs", func() {
+
+			It("Should reject the dry run without sending the command", func() {
+
+				rr := postReconnectWithQuery(`{"account": "1234", "node_id": "345", "delay": 30}`, "?dry_run=true")
+
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+				Expect(reconnector.clientID).To(BeEmpty())
+			})
+		})
+	})
+})
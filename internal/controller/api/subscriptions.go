@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/middlewares"
+	"github.com/RedHatInsights/cloud-connector/internal/mqtt"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/gorilla/mux"
+)
+
+type SubscriptionServer struct {
+	subscriptions *mqtt.SubscriptionTracker
+	router        *mux.Router
+	config        *config.Config
+}
+
+func NewSubscriptionServer(st *mqtt.SubscriptionTracker, r *mux.Router, cfg *config.Config) *SubscriptionServer {
+	return &SubscriptionServer{
+		subscriptions: st,
+		router:        r,
+		config:        cfg,
+	}
+}
+
+func (s *SubscriptionServer) Routes() {
+	mmw := &middlewares.MetricsMiddleware{}
+	amw := &middlewares.AuthMiddleware{Secrets: s.config.ServiceToServiceCredentials}
+
+	securedSubRouter := s.router.PathPrefix("/subscriptions").Subrouter()
+	securedSubRouter.Use(logger.AccessLoggerMiddleware,
+		mmw.RecordHTTPMetrics,
+		amw.AuthenticateServiceToService)
+
+	securedSubRouter.HandleFunc("", s.handleSubscriptionListing()).Methods(http.MethodGet)
+}
+
+type subscriptionsResponse struct {
+	Subscriptions []mqtt.Subscription `json:"subscriptions"`
+}
+
+func (s *SubscriptionServer) handleSubscriptionListing() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		writeJSONResponse(w, http.StatusOK, subscriptionsResponse{Subscriptions: s.subscriptions.Subscriptions()})
+	}
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/mqtt"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	SUBSCRIPTIONS_ENDPOINT = "/subscriptions"
+)
+
+type completedToken struct{}
+
+func (t completedToken) Wait() bool                     { return true }
+func (t completedToken) WaitTimeout(time.Duration) bool { return true }
+func (t completedToken) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+func (t completedToken) Error() error { return nil }
+
+type subscribingClient struct {
+	MQTT.Client
+}
+
+func (c subscribingClient) Subscribe(topic string, qos byte, callback MQTT.MessageHandler) MQTT.Token {
+	return completedToken{}
+}
+
+var _ = Describe("Subscriptions", func() {
+
+	var (
+		ss                  *SubscriptionServer
+		validIdentityHeader string
+	)
+
+	BeforeEach(func() {
+		apiMux := mux.NewRouter()
+		cfg := config.GetConfig()
+		cfg.ServiceToServiceCredentials["test_client_1"] = "12345"
+
+		tracker := mqtt.NewSubscriptionTracker(mqtt.NewMetrics(prometheus.NewRegistry()))
+		subscribers := []mqtt.Subscriber{
+			mqtt.Subscriber{Topic: "redhat/insights/+/control/out", Qos: 1},
+			mqtt.Subscriber{Topic: "redhat/insights/+/data/out", Qos: 0},
+		}
+		onConnect := mqtt.RegisterSubscribers(subscribers, tracker)
+		onConnect(subscribingClient{})
+
+		ss = NewSubscriptionServer(tracker, apiMux, cfg)
+		ss.Routes()
+
+		identity := `{ "identity": {"account_number": "540155", "type": "User", "internal": { "org_id": "1979710" } } }`
+		validIdentityHeader = base64.StdEncoding.EncodeToString([]byte(identity))
+	})
+
+	Describe("Connecting to the subscriptions endpoint", func() {
+		Context("With service to service credentials", func() {
+			It("Should list the registered subscriptions", func() {
+
+				req, err := http.NewRequest("GET", SUBSCRIPTIONS_ENDPOINT, nil)
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(TOKEN_HEADER_CLIENT_NAME, "test_client_1")
+				req.Header.Add(TOKEN_HEADER_ACCOUNT_NAME, "0000001")
+				req.Header.Add(TOKEN_HEADER_PSK_NAME, "12345")
+
+				rr := httptest.NewRecorder()
+
+				ss.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusOK))
+
+				var response subscriptionsResponse
+				json.Unmarshal(rr.Body.Bytes(), &response)
+
+				Expect(response.Subscriptions).To(Equal([]mqtt.Subscription{
+					mqtt.Subscription{Topic: "redhat/insights/+/control/out", Qos: 1},
+					mqtt.Subscription{Topic: "redhat/insights/+/data/out", Qos: 0},
+				}))
+			})
+		})
+
+		Context("With a valid identity header", func() {
+			It("Should fail to list the subscriptions", func() {
+
+				req, err := http.NewRequest("GET", SUBSCRIPTIONS_ENDPOINT, nil)
+				Expect(err).NotTo(HaveOccurred())
+
+				req.Header.Add(IDENTITY_HEADER_NAME, validIdentityHeader)
+
+				rr := httptest.NewRecorder()
+
+				ss.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+			})
+		})
+
+		Context("Without credentials", func() {
+			It("Should fail to list the subscriptions", func() {
+
+				req, err := http.NewRequest("GET", SUBSCRIPTIONS_ENDPOINT, nil)
+				Expect(err).NotTo(HaveOccurred())
+
+				rr := httptest.NewRecorder()
+
+				ss.router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+			})
+		})
+	})
+})
@@ -6,10 +6,15 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"strconv"
+
+	"github.com/RedHatInsights/cloud-connector/internal/middlewares"
 
 	"github.com/go-playground/validator/v10"
 )
 
+const dryRunQueryParam = "dry_run"
+
 type errorResponse struct {
 	Title  string `json:"title"`
 	Status int    `json:"status"`
@@ -44,3 +49,63 @@ func decodeJSON(body io.ReadCloser, data interface{}) error {
 
 	return nil
 }
+
+// isDryRun determines if the request asked for the messages to be built, but not published
+func isDryRun(req *http.Request) (bool, error) {
+	value := req.URL.Query().Get(dryRunQueryParam)
+	if value == "" {
+		return false, nil
+	}
+
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.New("Invalid dry_run query parameter")
+	}
+
+	return dryRun, nil
+}
+
+const (
+	limitQueryParam  = "limit"
+	offsetQueryParam = "offset"
+)
+
+// getPaginationParams reads the limit and offset query parameters.  The limit defaults to
+// defaultLimit and is capped at maxLimit.
+func getPaginationParams(req *http.Request, defaultLimit int, maxLimit int) (offset int, limit int, err error) {
+	limit = defaultLimit
+
+	if value := req.URL.Query().Get(limitQueryParam); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return 0, 0, errors.New("Invalid limit query parameter")
+		}
+	}
+
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	if value := req.URL.Query().Get(offsetQueryParam); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("Invalid offset query parameter")
+		}
+	}
+
+	return offset, limit, nil
+}
+
+// verifyAccountAccess makes sure the caller is allowed to act on the account.  Service to service
+// callers can act on any account, everyone else is limited to their own account.
+func verifyAccountAccess(w http.ResponseWriter, principal middlewares.Principal, account string) bool {
+	if middlewares.IsServiceToService(principal) || principal.GetAccount() == account {
+		return true
+	}
+
+	errorResponse := errorResponse{Title: "Account does not match the caller's account",
+		Status: http.StatusForbidden,
+		Detail: "Account does not match the caller's account"}
+	writeJSONResponse(w, errorResponse.Status, errorResponse)
+	return false
+}
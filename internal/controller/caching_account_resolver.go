@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+var errAccountLookupPanicked = errors.New("The account lookup panicked")
+
+type cachedAccount struct {
+	clientID domain.ClientID
+	account  domain.AccountID
+	orgID    domain.OrgID
+	expires  time.Time
+}
+
+// accountLookup is a lookup that is in progress.  Concurrent lookups of the same
+// client wait for the lookup that is in progress instead of calling the wrapped
+// resolver again.
+type accountLookup struct {
+	done    chan struct{}
+	account domain.AccountID
+	orgID   domain.OrgID
+	err     error
+}
+
+// CachingAccountIdResolver caches the accounts that the wrapped resolver returns.  The
+// cache holds up to maxSize clients and evicts the least recently used client when it
+// is full.  The accounts expire after the ttl.  Failed lookups are not cached.
+type CachingAccountIdResolver struct {
+	wrapped AccountIdResolver
+	maxSize int
+	ttl     time.Duration
+	entries map[domain.ClientID]*list.Element
+	lru     *list.List
+	lookups map[domain.ClientID]*accountLookup
+	now     func() time.Time
+	metrics *Metrics
+	sync.Mutex
+}
+
+func NewCachingAccountIdResolver(wrapped AccountIdResolver, maxSize int, ttl time.Duration, metrics *Metrics) *CachingAccountIdResolver {
+	return &CachingAccountIdResolver{
+		wrapped: wrapped,
+		maxSize: maxSize,
+		ttl:     ttl,
+		entries: make(map[domain.ClientID]*list.Element),
+		lru:     list.New(),
+		lookups: make(map[domain.ClientID]*accountLookup),
+		now:     time.Now,
+		metrics: metrics,
+	}
+}
+
+func (car *CachingAccountIdResolver) MapClientIdToAccountId(ctx context.Context, clientID domain.ClientID) (domain.AccountID, domain.OrgID, error) {
+	car.Lock()
+
+	if cached, found := car.get(clientID); found {
+		car.Unlock()
+		car.metrics.accountResolverCacheCounter.WithLabelValues("hit").Inc()
+		return cached.account, cached.orgID, nil
+	}
+
+	car.metrics.accountResolverCacheCounter.WithLabelValues("miss").Inc()
+
+	lookup, inProgress := car.lookups[clientID]
+	if inProgress == false {
+		lookup = &accountLookup{done: make(chan struct{})}
+		car.lookups[clientID] = lookup
+
+		// The lookup is shared by every caller that is waiting for it, so it must not
+		// fail because the caller that happened to start it gave up
+		go car.lookup(detachedContext{parent: ctx}, clientID, lookup)
+	}
+
+	car.Unlock()
+
+	select {
+	case <-lookup.done:
+		return lookup.account, lookup.orgID, lookup.err
+	case <-ctx.Done():
+		return "", "", ctx.Err()
+	}
+}
+
+func (car *CachingAccountIdResolver) lookup(ctx context.Context, clientID domain.ClientID, lookup *accountLookup) {
+	// The lookup runs outside of the message handler's panic recovery, so a panic in
+	// the wrapped resolver is turned into an error for the waiters
+	defer func() {
+		if r := recover(); r != nil {
+			lookup.err = fmt.Errorf("%w: %v", errAccountLookupPanicked, r)
+		}
+
+		car.Lock()
+		delete(car.lookups, clientID)
+		if lookup.err == nil {
+			car.add(clientID, lookup.account, lookup.orgID)
+		}
+		car.Unlock()
+
+		close(lookup.done)
+	}()
+
+	lookup.account, lookup.orgID, lookup.err = car.wrapped.MapClientIdToAccountId(ctx, clientID)
+}
+
+// detachedContext keeps the values of its parent (the request id, for example) without
+// being cancelled along with it
+type detachedContext struct {
+	parent context.Context
+}
+
+func (dc detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (dc detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (dc detachedContext) Err() error {
+	return nil
+}
+
+func (dc detachedContext) Value(key interface{}) interface{} {
+	return dc.parent.Value(key)
+}
+
+func (car *CachingAccountIdResolver) get(clientID domain.ClientID) (*cachedAccount, bool) {
+	element, found := car.entries[clientID]
+	if found == false {
+		return nil, false
+	}
+
+	cached := element.Value.(*cachedAccount)
+	if car.now().After(cached.expires) {
+		car.lru.Remove(element)
+		delete(car.entries, clientID)
+		return nil, false
+	}
+
+	car.lru.MoveToFront(element)
+
+	return cached, true
+}
+
+func (car *CachingAccountIdResolver) add(clientID domain.ClientID, account domain.AccountID, orgID domain.OrgID) {
+	if car.maxSize <= 0 {
+		return
+	}
+
+	if element, found := car.entries[clientID]; found {
+		car.lru.Remove(element)
+	}
+
+	for car.lru.Len() >= car.maxSize {
+		oldest := car.lru.Back()
+		car.lru.Remove(oldest)
+		delete(car.entries, oldest.Value.(*cachedAccount).clientID)
+	}
+
+	car.entries[clientID] = car.lru.PushFront(&cachedAccount{
+		clientID: clientID,
+		account:  account,
+		orgID:    orgID,
+		expires:  car.now().Add(car.ttl),
+	})
+}
@@ -0,0 +1,227 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type countingAccountResolver struct {
+	lookups int
+	err     error
+	release chan struct{}
+	sync.Mutex
+}
+
+func (car *countingAccountResolver) MapClientIdToAccountId(ctx context.Context, clientID domain.ClientID) (domain.AccountID, domain.OrgID, error) {
+	if car.release != nil {
+		<-car.release
+	}
+
+	car.Lock()
+	defer car.Unlock()
+	car.lookups++
+
+	return domain.AccountID("account-" + clientID), domain.OrgID("org-" + clientID), car.err
+}
+
+func TestCachingAccountIdResolverHitsAndMisses(t *testing.T) {
+	wrapped := &countingAccountResolver{}
+	resolver := NewCachingAccountIdResolver(wrapped, 10, time.Minute, metrics)
+
+	hits := testutil.ToFloat64(metrics.accountResolverCacheCounter.WithLabelValues("hit"))
+	misses := testutil.ToFloat64(metrics.accountResolverCacheCounter.WithLabelValues("miss"))
+
+	for i := 0; i < 3; i++ {
+		account, orgID, err := resolver.MapClientIdToAccountId(context.TODO(), "client-1")
+		if err != nil || account != "account-client-1" || orgID != "org-client-1" {
+			t.Fatalf("Unexpected lookup result: %s %s %v", account, orgID, err)
+		}
+	}
+
+	if wrapped.lookups != 1 {
+		t.Fatalf("Expected the account to be looked up once, got %d lookups", wrapped.lookups)
+	}
+
+	if testutil.ToFloat64(metrics.accountResolverCacheCounter.WithLabelValues("hit")) != hits+2 {
+		t.Fatalf("Expected 2 cache hits to be counted")
+	}
+
+	if testutil.ToFloat64(metrics.accountResolverCacheCounter.WithLabelValues("miss")) != misses+1 {
+		t.Fatalf("Expected 1 cache miss to be counted")
+	}
+}
+
+func TestCachingAccountIdResolverExpires(t *testing.T) {
+	wrapped := &countingAccountResolver{}
+	resolver := NewCachingAccountIdResolver(wrapped, 10, time.Minute, metrics)
+
+	now := time.Now()
+	resolver.now = func() time.Time { return now }
+
+	resolver.MapClientIdToAccountId(context.TODO(), "client-1")
+
+	now = now.Add(2 * time.Minute)
+	resolver.MapClientIdToAccountId(context.TODO(), "client-1")
+
+	if wrapped.lookups != 2 {
+		t.Fatalf("Expected the expired account to be looked up again, got %d lookups", wrapped.lookups)
+	}
+}
+
+func TestCachingAccountIdResolverEvictsLeastRecentlyUsed(t *testing.T) {
+	wrapped := &countingAccountResolver{}
+	resolver := NewCachingAccountIdResolver(wrapped, 2, time.Minute, metrics)
+
+	resolver.MapClientIdToAccountId(context.TODO(), "client-1")
+	resolver.MapClientIdToAccountId(context.TODO(), "client-2")
+	resolver.MapClientIdToAccountId(context.TODO(), "client-1")
+	resolver.MapClientIdToAccountId(context.TODO(), "client-3")
+
+	if _, found := resolver.entries["client-2"]; found {
+		t.Fatalf("Expected the least recently used client to be evicted")
+	}
+
+	if len(resolver.entries) != 2 || resolver.lru.Len() != 2 {
+		t.Fatalf("Expected the cache to hold 2 clients, got %d", len(resolver.entries))
+	}
+
+	resolver.MapClientIdToAccountId(context.TODO(), "client-1")
+	if wrapped.lookups != 3 {
+		t.Fatalf("Expected the recently used client to still be cached, got %d lookups", wrapped.lookups)
+	}
+}
+
+func TestCachingAccountIdResolverDoesNotCacheErrors(t *testing.T) {
+	wrapped := &countingAccountResolver{err: errors.New("unable to reach the account service")}
+	resolver := NewCachingAccountIdResolver(wrapped, 10, time.Minute, metrics)
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := resolver.MapClientIdToAccountId(context.TODO(), "client-1"); err != wrapped.err {
+			t.Fatalf("Expected the lookup error to be returned, got %v", err)
+		}
+	}
+
+	if wrapped.lookups != 2 {
+		t.Fatalf("Expected the failed lookup to be retried, got %d lookups", wrapped.lookups)
+	}
+}
+
+func TestCachingAccountIdResolverDedupsConcurrentLookups(t *testing.T) {
+	wrapped := &countingAccountResolver{release: make(chan struct{})}
+	resolver := NewCachingAccountIdResolver(wrapped, 10, time.Minute, metrics)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if account, _, err := resolver.MapClientIdToAccountId(context.TODO(), "client-1"); err != nil || account != "account-client-1" {
+				t.Errorf("Unexpected lookup result: %s %v", account, err)
+			}
+		}()
+	}
+
+	// Give the lookups a chance to pile up behind the first one
+	time.Sleep(10 * time.Millisecond)
+	close(wrapped.release)
+	wg.Wait()
+
+	if wrapped.lookups != 1 {
+		t.Fatalf("Expected the concurrent lookups to share a single lookup, got %d lookups", wrapped.lookups)
+	}
+}
+
+func TestNewAccountIdResolver(t *testing.T) {
+	var tests = []struct {
+		impl           string
+		expectedCached bool
+		expectedErr    error
+	}{
+		{"config", false, nil},
+		{"bop", false, nil},
+		{"cached-config", true, nil},
+		{"cached-bop", true, nil},
+		{"cert", false, nil},
+		{"cached-cert", false, ErrInvalidAccountIdResolver},
+		{"cached-", false, ErrInvalidAccountIdResolver},
+		{"fred", false, ErrInvalidAccountIdResolver},
+	}
+
+	for _, tc := range tests {
+		resolver, err := NewAccountIdResolver(tc.impl, 10, time.Minute, RedisConfig{Address: "localhost:6379", TTL: time.Hour}, metrics)
+		if err != tc.expectedErr {
+			t.Fatalf("Expected %v creating the %s resolver, got %v", tc.expectedErr, tc.impl, err)
+		}
+
+		if _, cached := resolver.(*CachingAccountIdResolver); cached != tc.expectedCached {
+			t.Fatalf("Expected the %s resolver to be cached=%t", tc.impl, tc.expectedCached)
+		}
+	}
+}
+
+type panickingAccountResolver struct{}
+
+func (par *panickingAccountResolver) MapClientIdToAccountId(ctx context.Context, clientID domain.ClientID) (domain.AccountID, domain.OrgID, error) {
+	panic("lookup failed")
+}
+
+func TestCachingAccountIdResolverSharedLookupOutlivesTheCaller(t *testing.T) {
+	wrapped := &countingAccountResolver{release: make(chan struct{})}
+	resolver := NewCachingAccountIdResolver(wrapped, 10, time.Minute, metrics)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	firstResult := make(chan error)
+	go func() {
+		_, _, err := resolver.MapClientIdToAccountId(ctx, "client-1")
+		firstResult <- err
+	}()
+
+	secondResult := make(chan error)
+	go func() {
+		// Wait for the first caller to start the lookup
+		time.Sleep(10 * time.Millisecond)
+		_, _, err := resolver.MapClientIdToAccountId(context.TODO(), "client-1")
+		secondResult <- err
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+
+	// The caller that started the lookup gives up
+	cancel()
+	if err := <-firstResult; err != context.Canceled {
+		t.Fatalf("Expected the canceled caller to get %v, got %v", context.Canceled, err)
+	}
+
+	close(wrapped.release)
+
+	if err := <-secondResult; err != nil {
+		t.Fatalf("Expected the waiting caller to get the account, got %v", err)
+	}
+
+	if wrapped.lookups != 1 {
+		t.Fatalf("Expected a single lookup, got %d lookups", wrapped.lookups)
+	}
+}
+
+func TestCachingAccountIdResolverReleasesWaitersWhenTheLookupPanics(t *testing.T) {
+	resolver := NewCachingAccountIdResolver(&panickingAccountResolver{}, 10, time.Minute, metrics)
+
+	_, _, err := resolver.MapClientIdToAccountId(context.TODO(), "client-1")
+	if errors.Is(err, errAccountLookupPanicked) == false {
+		t.Fatalf("Expected %v, got %v", errAccountLookupPanicked, err)
+	}
+
+	// The failed lookup must not be left in progress
+	_, _, err = resolver.MapClientIdToAccountId(context.TODO(), "client-1")
+	if errors.Is(err, errAccountLookupPanicked) == false {
+		t.Fatalf("Expected the second lookup to fail the same way, got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+
+	"github.com/go-redis/redis"
+)
+
+var (
+	ErrInvalidCertificateSubject = errors.New("Invalid client certificate subject")
+	ErrUnknownClientCertificate  = fmt.Errorf("%w: the client's certificate has not been presented to the broker", ErrAccountNotFound)
+)
+
+// CertificateSubjectRecorder is implemented by account resolvers that derive the
+// client's identity from the certificate that the client presented to the broker
+type CertificateSubjectRecorder interface {
+	RecordCertificateSubject(ctx context.Context, clientID domain.ClientID, subject string) error
+}
+
+const (
+	redisCertIdentityKeyPrefix = "cloud-connector:cert_identity:"
+
+	redisCertAccountField = "account"
+	redisCertOrgIDField   = "org_id"
+)
+
+// CertBasedAccountIdResolver resolves the client's account from the subject of the
+// certificate that the client used to connect to the broker instead of calling an
+// external service.
+//
+// The broker does not pass the certificate along with the client's messages.  Instead,
+// the broker's auth plugin includes the certificate's subject (cert_subject) in the
+// connect request that it sends to the /broker/auth/connect endpoint, which records
+// it here.  The subject is a comma separated distinguished name, for example
+// "CN=<client id>,O=<org id>,OU=<account number>".  The CN has to match the client
+// id.  The connect endpoint only accepts the broker's service to service credentials.
+//
+// The identities are kept in redis so that the connect request and the client's
+// control messages can be handled by different cloud-connector instances.  They
+// expire after the ttl and are recorded again each time the client connects.
+type CertBasedAccountIdResolver struct {
+	client  *redis.Client
+	ttl     time.Duration
+	metrics *Metrics
+}
+
+func NewCertBasedAccountIdResolver(client *redis.Client, ttl time.Duration, metrics *Metrics) *CertBasedAccountIdResolver {
+	return &CertBasedAccountIdResolver{
+		client:  client,
+		ttl:     ttl,
+		metrics: metrics,
+	}
+}
+
+func redisCertIdentityKey(clientID domain.ClientID) string {
+	return redisCertIdentityKeyPrefix + string(clientID)
+}
+
+func (r *CertBasedAccountIdResolver) RecordCertificateSubject(ctx context.Context, clientID domain.ClientID, subject string) error {
+	attributes := parseCertificateSubject(subject)
+
+	if attributes["CN"] != string(clientID) || attributes["OU"] == "" {
+		return ErrInvalidCertificateSubject
+	}
+
+	key := redisCertIdentityKey(clientID)
+
+	pipe := r.client.WithContext(ctx).TxPipeline()
+	pipe.Del(key)
+	pipe.HMSet(key, map[string]interface{}{
+		redisCertAccountField: attributes["OU"],
+		redisCertOrgIDField:   attributes["O"],
+	})
+	pipe.Expire(key, r.ttl)
+
+	if _, err := pipe.Exec(); err != nil {
+		r.metrics.redisConnectionError.Inc()
+		return fmt.Errorf("%w: unable to record the client's identity: %s", ErrDownstreamUnavailable, err)
+	}
+
+	return nil
+}
+
+func (r *CertBasedAccountIdResolver) MapClientIdToAccountId(ctx context.Context, clientID domain.ClientID) (domain.AccountID, domain.OrgID, error) {
+	identity, err := r.client.WithContext(ctx).HGetAll(redisCertIdentityKey(clientID)).Result()
+	if err != nil {
+		r.metrics.redisConnectionError.Inc()
+		return "", "", fmt.Errorf("%w: unable to look up the client's identity: %s", ErrDownstreamUnavailable, err)
+	}
+
+	account, exists := identity[redisCertAccountField]
+	if exists == false {
+		return "", "", ErrUnknownClientCertificate
+	}
+
+	return domain.AccountID(account), domain.OrgID(identity[redisCertOrgIDField]), nil
+}
+
+// parseCertificateSubject splits the distinguished name into its attributes.  Both the
+// "CN=a,O=b" and the openssl "/CN=a/O=b" formats are accepted.  Escaped separators are
+// not supported.
+func parseCertificateSubject(subject string) map[string]string {
+	separator := ","
+	if strings.HasPrefix(subject, "/") {
+		separator = "/"
+	}
+
+	attributes := make(map[string]string)
+
+	for _, rdn := range strings.Split(subject, separator) {
+		parts := strings.SplitN(strings.TrimSpace(rdn), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		key := strings.ToUpper(strings.TrimSpace(parts[0]))
+		if _, exists := attributes[key]; exists == false {
+			attributes[key] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	return attributes
+}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+
+	"github.com/alicebob/miniredis"
+)
+
+func TestCertBasedAccountIdResolver(t *testing.T) {
+	var tests = []struct {
+		name            string
+		subject         string
+		expectedErr     error
+		expectedAccount domain.AccountID
+		expectedOrgID   domain.OrgID
+	}{
+		{"comma separated", "CN=client-1,O=1010101,OU=540155", nil, "540155", "1010101"},
+		{"openssl format", "/CN=client-1/O=1010101/OU=540155", nil, "540155", "1010101"},
+		{"whitespace and case", "cn = client-1, o = 1010101, ou = 540155", nil, "540155", "1010101"},
+		{"no org id", "CN=client-1,OU=540155", nil, "540155", ""},
+		{"no account", "CN=client-1,O=1010101", ErrInvalidCertificateSubject, "", ""},
+		{"different client", "CN=client-2,O=1010101,OU=540155", ErrInvalidCertificateSubject, "", ""},
+		{"not a subject", "client-1", ErrInvalidCertificateSubject, "", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server, err := miniredis.Run()
+			if err != nil {
+				t.Fatalf("Unable to start miniredis: %s", err)
+			}
+			defer server.Close()
+
+			resolver := NewCertBasedAccountIdResolver(NewRedisClient(server.Addr(), "", 0), time.Minute, metrics)
+
+			err = resolver.RecordCertificateSubject(context.TODO(), "client-1", tc.subject)
+			if err != tc.expectedErr {
+				t.Fatalf("Expected %v recording the subject, got %v", tc.expectedErr, err)
+			}
+
+			account, orgID, err := resolver.MapClientIdToAccountId(context.TODO(), "client-1")
+			if tc.expectedErr != nil {
+				if err != ErrUnknownClientCertificate {
+					t.Fatalf("Expected %v, got %v", ErrUnknownClientCertificate, err)
+				}
+				return
+			}
+
+			if err != nil || account != tc.expectedAccount || orgID != tc.expectedOrgID {
+				t.Fatalf("Expected (%s, %s), got (%s, %s, %v)", tc.expectedAccount, tc.expectedOrgID, account, orgID, err)
+			}
+		})
+	}
+}
+
+func TestCertBasedAccountIdResolverIsSharedBetweenInstances(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Unable to start miniredis: %s", err)
+	}
+	defer server.Close()
+
+	recorder := NewCertBasedAccountIdResolver(NewRedisClient(server.Addr(), "", 0), time.Minute, metrics)
+	resolver := NewCertBasedAccountIdResolver(NewRedisClient(server.Addr(), "", 0), time.Minute, metrics)
+
+	if err := recorder.RecordCertificateSubject(context.TODO(), "client-1", "CN=client-1,OU=540155"); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if account, _, err := resolver.MapClientIdToAccountId(context.TODO(), "client-1"); err != nil || account != "540155" {
+		t.Fatalf("Expected the identity recorded by another instance to be resolved, got (%s, %v)", account, err)
+	}
+
+	server.FastForward(2 * time.Minute)
+
+	if _, _, err := resolver.MapClientIdToAccountId(context.TODO(), "client-1"); err != ErrUnknownClientCertificate {
+		t.Fatalf("Expected the identity to expire, got %v", err)
+	}
+}
+
+func TestCertBasedAccountIdResolverRedisUnavailable(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Unable to start miniredis: %s", err)
+	}
+	resolver := NewCertBasedAccountIdResolver(NewRedisClient(server.Addr(), "", 0), time.Minute, metrics)
+	server.Close()
+
+	if _, _, err := resolver.MapClientIdToAccountId(context.TODO(), "client-1"); IsTransientError(err) == false {
+		t.Fatalf("Expected a transient error when redis is unavailable, got %v", err)
+	}
+}
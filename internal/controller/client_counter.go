@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ClientCount is the number of connected clients and when they were counted
+type ClientCount struct {
+	Count     int       `json:"count"`
+	CountedAt time.Time `json:"counted_at"`
+}
+
+// ClientCounter counts the connected clients.  The count is cached for the cache
+// interval so that asking for it often does not put load on the connection registrar.
+// While it is started, the count is refreshed every cache interval to keep the
+// connected clients gauge up to date.
+type ClientCounter struct {
+	connectionRegistrar ConnectionRegistrar
+	cacheInterval       time.Duration
+	count               *ClientCount
+	now                 func() time.Time
+	metrics             *Metrics
+	cancel              context.CancelFunc
+	done                sync.WaitGroup
+	sync.Mutex
+}
+
+func NewClientCounter(cr ConnectionRegistrar, cacheInterval time.Duration, metrics *Metrics) *ClientCounter {
+	return &ClientCounter{
+		connectionRegistrar: cr,
+		cacheInterval:       cacheInterval,
+		now:                 time.Now,
+		metrics:             metrics,
+	}
+}
+
+// Count returns the cached count, counting the clients again if the cached count is
+// older than the cache interval
+func (cc *ClientCounter) Count(ctx context.Context) (ClientCount, error) {
+	cc.Lock()
+	defer cc.Unlock()
+
+	now := cc.now()
+
+	if cc.count != nil && now.Sub(cc.count.CountedAt) < cc.cacheInterval {
+		return *cc.count, nil
+	}
+
+	count, err := cc.connectionRegistrar.CountConnections(ctx)
+	if err != nil {
+		return ClientCount{}, err
+	}
+
+	cc.count = &ClientCount{Count: count, CountedAt: now}
+
+	cc.metrics.connectedClientsGauge.Set(float64(count))
+
+	return *cc.count, nil
+}
+
+func (cc *ClientCounter) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cc.cancel = cancel
+
+	cc.done.Add(1)
+	go func() {
+		defer cc.done.Done()
+
+		ticker := time.NewTicker(cc.cacheInterval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := cc.Count(ctx); err != nil {
+				logger.Log.WithFields(logrus.Fields{"error": err}).Warn("Unable to count the connected clients")
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops refreshing the count and waits for an in-progress count to finish
+func (cc *ClientCounter) Stop() {
+	cc.cancel()
+	cc.done.Wait()
+}
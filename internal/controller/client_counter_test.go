@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// countingConnectionManager counts the calls to CountConnections
+type countingConnectionManager struct {
+	*LocalConnectionManager
+	calls int
+	err   error
+}
+
+func (ccm *countingConnectionManager) CountConnections(ctx context.Context) (int, error) {
+	ccm.calls++
+	if ccm.err != nil {
+		return 0, ccm.err
+	}
+	return ccm.LocalConnectionManager.CountConnections(ctx)
+}
+
+func TestClientCounterCachesCount(t *testing.T) {
+	cm := &countingConnectionManager{LocalConnectionManager: NewLocalConnectionManager()}
+	cm.Register(context.TODO(), "1234", "client-1", &MockReceptor{})
+	cm.Register(context.TODO(), "1234", "client-2", &MockReceptor{})
+	cm.Register(context.TODO(), "5678", "client-3", &MockReceptor{})
+
+	now := time.Date(2021, 1, 12, 15, 30, 0, 0, time.UTC)
+
+	counter := NewClientCounter(cm, time.Minute, metrics)
+	counter.now = func() time.Time { return now }
+
+	count, err := counter.Count(context.TODO())
+	if err != nil {
+		t.Fatalf("Unexpected error counting the clients: %s", err)
+	}
+
+	if count.Count != 3 || count.CountedAt != now {
+		t.Fatalf("Expected 3 clients counted at %s, got %+v", now, count)
+	}
+
+	if gauge := testutil.ToFloat64(metrics.connectedClientsGauge); gauge != 3 {
+		t.Fatalf("Expected the connected clients gauge to be 3, got %v", gauge)
+	}
+
+	cm.Unregister(context.TODO(), "5678", "client-3")
+
+	now = now.Add(30 * time.Second)
+	if count, _ := counter.Count(context.TODO()); count.Count != 3 || cm.calls != 1 {
+		t.Fatalf("Expected the cached count to be used, got %+v after %d counts", count, cm.calls)
+	}
+
+	now = now.Add(30 * time.Second)
+	if count, _ := counter.Count(context.TODO()); count.Count != 2 || cm.calls != 2 {
+		t.Fatalf("Expected the clients to be counted again, got %+v after %d counts", count, cm.calls)
+	}
+}
+
+func TestClientCounterError(t *testing.T) {
+	cm := &countingConnectionManager{LocalConnectionManager: NewLocalConnectionManager(), err: errors.New("registrar is down")}
+
+	if _, err := NewClientCounter(cm, time.Minute, metrics).Count(context.TODO()); err != cm.err {
+		t.Fatalf("Expected the registrar's error, got %v", err)
+	}
+}
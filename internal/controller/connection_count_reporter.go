@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/queue"
+
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+)
+
+type ConnectionCounts struct {
+	Timestamp     string         `json:"timestamp"`
+	Total         int            `json:"total"`
+	Accounts      int            `json:"accounts"`
+	PerDispatcher map[string]int `json:"per_dispatcher"`
+}
+
+// ConnectionCountReporter periodically publishes the aggregate connection counts
+// to a kafka topic
+type ConnectionCountReporter struct {
+	connectionLocator ConnectionLocator
+	writer            queue.Writer
+	interval          time.Duration
+	cancel            context.CancelFunc
+	done              sync.WaitGroup
+}
+
+func NewConnectionCountReporter(cl ConnectionLocator, writer queue.Writer, interval time.Duration) *ConnectionCountReporter {
+	return &ConnectionCountReporter{
+		connectionLocator: cl,
+		writer:            writer,
+		interval:          interval,
+	}
+}
+
+func (ccr *ConnectionCountReporter) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	ccr.cancel = cancel
+
+	ccr.done.Add(1)
+	go func() {
+		defer ccr.done.Done()
+
+		ticker := time.NewTicker(ccr.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				ccr.report(ctx)
+			}
+		}
+	}()
+}
+
+// Stop stops the reporter and waits for an in-progress report to finish
+func (ccr *ConnectionCountReporter) Stop() {
+	ccr.cancel()
+	ccr.done.Wait()
+}
+
+func (ccr *ConnectionCountReporter) report(ctx context.Context) {
+	counts := countConnections(ctx, ccr.connectionLocator)
+
+	countsBytes, err := json.Marshal(counts)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{"error": err}).Error("Unable to marshal the connection counts")
+		return
+	}
+
+	if err := ccr.writer.WriteMessages(ctx, kafka.Message{Value: countsBytes}); err != nil {
+		logger.Log.WithFields(logrus.Fields{"error": err}).Error("Unable to publish the connection counts")
+		return
+	}
+
+	logger.Log.WithFields(logrus.Fields{"total": counts.Total, "accounts": counts.Accounts}).Debug("Published the connection counts")
+}
+
+func countConnections(ctx context.Context, cl ConnectionLocator) ConnectionCounts {
+	counts := ConnectionCounts{
+		Timestamp:     time.Now().UTC().Format(time.RFC3339),
+		PerDispatcher: make(map[string]int),
+	}
+
+	for _, connections := range cl.GetAllConnections(ctx) {
+		counts.Accounts++
+
+		for _, connection := range connections {
+			counts.Total++
+
+			detailer, ok := connection.(ClientDetailer)
+			if ok == false {
+				continue
+			}
+
+			if details := detailer.ClientDetails(); details.DispatchersResult != nil {
+				for _, dispatcher := range details.DispatchersResult.Dispatchers {
+					counts.PerDispatcher[dispatcher]++
+				}
+			}
+		}
+	}
+
+	return counts
+}
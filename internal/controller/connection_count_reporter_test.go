@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+type DetailedMockReceptor struct {
+	MockReceptor
+	details domain.RhcClient
+}
+
+func (dmr *DetailedMockReceptor) ClientDetails() domain.RhcClient {
+	return dmr.details
+}
+
+type recordingWriter struct {
+	messages []kafka.Message
+	sync.Mutex
+}
+
+func (rw *recordingWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	rw.Lock()
+	defer rw.Unlock()
+	rw.messages = append(rw.messages, msgs...)
+	return nil
+}
+
+func (rw *recordingWriter) count() int {
+	rw.Lock()
+	defer rw.Unlock()
+	return len(rw.messages)
+}
+
+func newDetailedMockReceptor(dispatchers ...string) *DetailedMockReceptor {
+	return &DetailedMockReceptor{
+		details: domain.RhcClient{DispatchersResult: &domain.DispatchersResult{Dispatchers: dispatchers}},
+	}
+}
+
+func TestConnectionCountReport(t *testing.T) {
+	cm := NewLocalConnectionManager()
+	cm.Register(context.TODO(), "1234", "node-1", newDetailedMockReceptor("rhc-worker-playbook"))
+	cm.Register(context.TODO(), "1234", "node-2", newDetailedMockReceptor("rhc-worker-playbook", "catalog"))
+	cm.Register(context.TODO(), "5678", "node-3", &MockReceptor{})
+
+	writer := &recordingWriter{}
+	reporter := NewConnectionCountReporter(cm, writer, time.Minute)
+
+	reporter.report(context.TODO())
+
+	if len(writer.messages) != 1 {
+		t.Fatalf("Expected one connection count message, got %d", len(writer.messages))
+	}
+
+	var counts ConnectionCounts
+	if err := json.Unmarshal(writer.messages[0].Value, &counts); err != nil {
+		t.Fatalf("Unable to unmarshal the connection count message: %s", err)
+	}
+
+	if counts.Total != 3 || counts.Accounts != 2 {
+		t.Fatalf("Expected 3 connections in 2 accounts, got %d connections in %d accounts", counts.Total, counts.Accounts)
+	}
+
+	if counts.PerDispatcher["rhc-worker-playbook"] != 2 || counts.PerDispatcher["catalog"] != 1 {
+		t.Fatalf("Unexpected per dispatcher counts: %v", counts.PerDispatcher)
+	}
+
+	if _, err := time.Parse(time.RFC3339, counts.Timestamp); err != nil {
+		t.Fatalf("Expected a valid timestamp, got %s", counts.Timestamp)
+	}
+}
+
+func TestConnectionCountReporterStops(t *testing.T) {
+	writer := &recordingWriter{}
+	reporter := NewConnectionCountReporter(NewLocalConnectionManager(), writer, 10*time.Millisecond)
+
+	reporter.Start()
+
+	deadline := time.Now().Add(time.Second)
+	for writer.count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	reporter.Stop()
+
+	published := writer.count()
+	if published == 0 {
+		t.Fatalf("Expected the connection counts to be published periodically")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	if writer.count() != published {
+		t.Fatalf("Expected no connection counts to be published after the reporter was stopped")
+	}
+}
@@ -0,0 +1,222 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ConnectedEvent    = "connected"
+	DisconnectedEvent = "disconnected"
+
+	WebhookSignatureHeader = "X-Cloud-Connector-Signature"
+)
+
+var (
+	ErrInvalidConnectionEventPublisher = errors.New("Invalid connection event publisher")
+	ErrMissingWebhookURL               = errors.New("The webhook url is required")
+)
+
+type ConnectionEvent struct {
+	Event          string           `json:"event"`
+	Account        domain.AccountID `json:"account"`
+	ClientID       domain.ClientID  `json:"client_id"`
+	Timestamp      string           `json:"timestamp"`
+	CanonicalFacts interface{}      `json:"canonical_facts,omitempty"`
+}
+
+func NewConnectionEvent(event string, account domain.AccountID, clientID domain.ClientID, canonicalFacts interface{}) ConnectionEvent {
+	return ConnectionEvent{
+		Event:          event,
+		Account:        account,
+		ClientID:       clientID,
+		Timestamp:      time.Now().UTC().Format(time.RFC3339),
+		CanonicalFacts: canonicalFacts,
+	}
+}
+
+// ConnectionEventPublisher notifies other services when a client connects or
+// disconnects.  Publish must not block the processing of the client's handshake.
+type ConnectionEventPublisher interface {
+	Publish(ConnectionEvent)
+}
+
+type NoopConnectionEventPublisher struct {
+}
+
+func (ncep *NoopConnectionEventPublisher) Publish(event ConnectionEvent) {
+}
+
+type WebhookConfig struct {
+	URL        string
+	Secret     string
+	QueueSize  int
+	MaxRetries int
+	RetryDelay time.Duration
+	Timeout    time.Duration
+}
+
+// WebhookConnectionEventPublisher POSTs the connection events to a webhook.  The
+// events are queued and delivered in the background.  Events are dropped when
+// the queue is full or the publisher has been closed.  Only transient failures (the
+// webhook could not be reached, returned a 5xx or asked us to slow down with a 429)
+// are retried.  If a secret is configured, the body of the request is signed
+// using HMAC-SHA256 and the signature is passed in the X-Cloud-Connector-Signature
+// header.
+type WebhookConnectionEventPublisher struct {
+	config     WebhookConfig
+	httpClient *http.Client
+	events     chan ConnectionEvent
+	closed     bool
+	metrics    *Metrics
+	done       sync.WaitGroup
+	sync.RWMutex
+}
+
+func NewWebhookConnectionEventPublisher(cfg WebhookConfig, metrics *Metrics) (*WebhookConnectionEventPublisher, error) {
+	if cfg.URL == "" {
+		return nil, ErrMissingWebhookURL
+	}
+
+	wcep := &WebhookConnectionEventPublisher{
+		config:     cfg,
+		httpClient: &http.Client{Timeout: cfg.Timeout},
+		events:     make(chan ConnectionEvent, cfg.QueueSize),
+		metrics:    metrics,
+	}
+
+	wcep.done.Add(1)
+	go wcep.deliverEvents()
+
+	return wcep, nil
+}
+
+func (wcep *WebhookConnectionEventPublisher) Publish(event ConnectionEvent) {
+	wcep.RLock()
+	defer wcep.RUnlock()
+
+	if wcep.closed {
+		logger.Log.WithFields(logrus.Fields{"event": event.Event, "clientID": event.ClientID}).Warn("Webhook publisher is closed, dropping connection event")
+		wcep.metrics.webhookEventCounter.WithLabelValues("dropped").Inc()
+		return
+	}
+
+	select {
+	case wcep.events <- event:
+	default:
+		logger.Log.WithFields(logrus.Fields{"event": event.Event, "clientID": event.ClientID}).Warn("Webhook queue is full, dropping connection event")
+		wcep.metrics.webhookEventCounter.WithLabelValues("dropped").Inc()
+	}
+}
+
+// Close stops accepting events and waits for the queued events to be delivered
+func (wcep *WebhookConnectionEventPublisher) Close() {
+	wcep.Lock()
+	if wcep.closed == false {
+		wcep.closed = true
+		close(wcep.events)
+	}
+	wcep.Unlock()
+
+	wcep.done.Wait()
+}
+
+func (wcep *WebhookConnectionEventPublisher) deliverEvents() {
+	defer wcep.done.Done()
+
+	for event := range wcep.events {
+		logger := logger.Log.WithFields(logrus.Fields{"event": event.Event, "clientID": event.ClientID, "account": event.Account})
+
+		if err := wcep.deliver(event); err != nil {
+			logger.WithFields(logrus.Fields{"error": err}).Error("Unable to deliver the connection event to the webhook")
+			wcep.metrics.webhookEventCounter.WithLabelValues("failed").Inc()
+			continue
+		}
+
+		logger.Debug("Delivered the connection event to the webhook")
+		wcep.metrics.webhookEventCounter.WithLabelValues("delivered").Inc()
+	}
+}
+
+func (wcep *WebhookConnectionEventPublisher) deliver(event ConnectionEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = wcep.post(body)
+		if err == nil || IsTransientError(err) == false || attempt >= wcep.config.MaxRetries {
+			return err
+		}
+
+		time.Sleep(wcep.config.RetryDelay)
+	}
+}
+
+func (wcep *WebhookConnectionEventPublisher) post(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), wcep.httpClient.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wcep.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if wcep.config.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhookPayload(wcep.config.Secret, body))
+	}
+
+	resp, err := wcep.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrDownstreamUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("%w: webhook returned status code %d", ErrDownstreamUnavailable, resp.StatusCode)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return fmt.Errorf("Webhook returned status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// SignWebhookPayload returns the hex encoded HMAC-SHA256 signature of the payload
+func SignWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func NewConnectionEventPublisher(impl string, webhookCfg WebhookConfig, metrics *Metrics) (ConnectionEventPublisher, error) {
+	switch impl {
+	case "none":
+		return &NoopConnectionEventPublisher{}, nil
+	case "webhook":
+		publisher, err := NewWebhookConnectionEventPublisher(webhookCfg, metrics)
+		if err != nil {
+			return nil, err
+		}
+		return publisher, nil
+	default:
+		return nil, ErrInvalidConnectionEventPublisher
+	}
+}
@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type webhookReceiver struct {
+	server        *httptest.Server
+	failures      int
+	failureStatus int
+	bodies        [][]byte
+	signatures    []string
+	sync.Mutex
+}
+
+func startWebhookReceiver(failures int) *webhookReceiver {
+	return startWebhookReceiverWithStatus(failures, http.StatusServiceUnavailable)
+}
+
+func startWebhookReceiverWithStatus(failures int, failureStatus int) *webhookReceiver {
+	wr := &webhookReceiver{failures: failures, failureStatus: failureStatus}
+	wr.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		wr.Lock()
+		defer wr.Unlock()
+
+		if wr.failures > 0 {
+			wr.failures--
+			w.WriteHeader(wr.failureStatus)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(req.Body)
+		wr.bodies = append(wr.bodies, body)
+		wr.signatures = append(wr.signatures, req.Header.Get(WebhookSignatureHeader))
+	}))
+	return wr
+}
+
+func newTestWebhookPublisher(t *testing.T, url string) *WebhookConnectionEventPublisher {
+	publisher, err := NewWebhookConnectionEventPublisher(WebhookConfig{
+		URL:        url,
+		Secret:     "s3cr3t",
+		QueueSize:  10,
+		MaxRetries: 3,
+		RetryDelay: time.Millisecond,
+		Timeout:    time.Second,
+	}, metrics)
+	if err != nil {
+		t.Fatalf("Unexpected error creating the webhook publisher: %s", err)
+	}
+	return publisher
+}
+
+func TestWebhookDeliversSignedEvents(t *testing.T) {
+	receiver := startWebhookReceiver(0)
+	defer receiver.server.Close()
+
+	publisher := newTestWebhookPublisher(t, receiver.server.URL)
+	publisher.Publish(NewConnectionEvent(ConnectedEvent, "1234", "client-1", map[string]interface{}{"insights_id": "abcd"}))
+	publisher.Publish(NewConnectionEvent(DisconnectedEvent, "1234", "client-1", nil))
+	publisher.Close()
+
+	if len(receiver.bodies) != 2 {
+		t.Fatalf("Expected 2 events to be delivered, got %d", len(receiver.bodies))
+	}
+
+	for i, expectedEvent := range []string{ConnectedEvent, DisconnectedEvent} {
+		var event ConnectionEvent
+		if err := json.Unmarshal(receiver.bodies[i], &event); err != nil {
+			t.Fatalf("Unable to unmarshal the delivered event: %s", err)
+		}
+
+		if event.Event != expectedEvent || event.ClientID != "client-1" || event.Account != "1234" {
+			t.Fatalf("Expected a %s event for client-1, got %+v", expectedEvent, event)
+		}
+
+		expectedSignature := "sha256=" + SignWebhookPayload("s3cr3t", receiver.bodies[i])
+		if receiver.signatures[i] != expectedSignature {
+			t.Fatalf("Expected signature %s, got %s", expectedSignature, receiver.signatures[i])
+		}
+	}
+}
+
+func TestWebhookRetriesFailedDeliveries(t *testing.T) {
+	receiver := startWebhookReceiver(2)
+	defer receiver.server.Close()
+
+	publisher := newTestWebhookPublisher(t, receiver.server.URL)
+	publisher.Publish(NewConnectionEvent(ConnectedEvent, "1234", "client-1", nil))
+	publisher.Close()
+
+	if len(receiver.bodies) != 1 {
+		t.Fatalf("Expected the event to be delivered after retrying, got %d deliveries", len(receiver.bodies))
+	}
+}
+
+func TestWebhookGivesUpAfterMaxRetries(t *testing.T) {
+	receiver := startWebhookReceiver(10)
+	defer receiver.server.Close()
+
+	publisher := newTestWebhookPublisher(t, receiver.server.URL)
+	publisher.Publish(NewConnectionEvent(ConnectedEvent, "1234", "client-1", nil))
+	publisher.Close()
+
+	if len(receiver.bodies) != 0 || receiver.failures != 6 {
+		t.Fatalf("Expected 4 failed attempts, got %d remaining failures and %d deliveries", receiver.failures, len(receiver.bodies))
+	}
+}
+
+func TestWebhookOnlyRetriesTransientStatusCodes(t *testing.T) {
+	var tests = []struct {
+		status            int
+		expectedDelivered int
+	}{
+		{http.StatusBadRequest, 0},
+		{http.StatusNotFound, 0},
+		{http.StatusTooManyRequests, 1},
+		{http.StatusBadGateway, 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(http.StatusText(tc.status), func(t *testing.T) {
+			receiver := startWebhookReceiverWithStatus(1, tc.status)
+			defer receiver.server.Close()
+
+			publisher := newTestWebhookPublisher(t, receiver.server.URL)
+			publisher.Publish(NewConnectionEvent(ConnectedEvent, "1234", "client-1", nil))
+			publisher.Close()
+
+			if len(receiver.bodies) != tc.expectedDelivered {
+				t.Fatalf("Expected %d deliveries after a %d, got %d", tc.expectedDelivered, tc.status, len(receiver.bodies))
+			}
+		})
+	}
+}
+
+func TestWebhookDropsEventsPublishedAfterClose(t *testing.T) {
+	receiver := startWebhookReceiver(0)
+	defer receiver.server.Close()
+
+	publisher := newTestWebhookPublisher(t, receiver.server.URL)
+	publisher.Close()
+
+	// Closing again and publishing after closing must not panic
+	publisher.Close()
+	publisher.Publish(NewConnectionEvent(ConnectedEvent, "1234", "client-1", nil))
+
+	if len(receiver.bodies) != 0 {
+		t.Fatalf("Expected the event published after closing to be dropped, got %d deliveries", len(receiver.bodies))
+	}
+}
+
+func TestWebhookDropsEventsWhenQueueIsFull(t *testing.T) {
+	// No worker is started so the queued events are never consumed
+	publisher := &WebhookConnectionEventPublisher{events: make(chan ConnectionEvent, 1), metrics: metrics}
+
+	publisher.Publish(NewConnectionEvent(ConnectedEvent, "1234", "client-1", nil))
+	publisher.Publish(NewConnectionEvent(ConnectedEvent, "1234", "client-2", nil))
+
+	if len(publisher.events) != 1 {
+		t.Fatalf("Expected the queue to be bounded to 1 event, got %d", len(publisher.events))
+	}
+}
+
+func TestInvalidConnectionEventPublisher(t *testing.T) {
+	if _, err := NewConnectionEventPublisher("fred", WebhookConfig{}, metrics); err != ErrInvalidConnectionEventPublisher {
+		t.Fatalf("Expected an invalid publisher error, got %v", err)
+	}
+
+	if _, err := NewConnectionEventPublisher("webhook", WebhookConfig{}, metrics); err != ErrMissingWebhookURL {
+		t.Fatalf("Expected a missing webhook url error, got %v", err)
+	}
+}
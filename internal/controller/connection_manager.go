@@ -2,8 +2,12 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
 	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
 
 	"github.com/sirupsen/logrus"
@@ -16,9 +20,41 @@ func (d DuplicateConnectionError) Error() string {
 	return "duplicate node id"
 }
 
+func (d DuplicateConnectionError) Is(target error) bool {
+	return target == ErrRegistrationConflict
+}
+
+var ErrConnectionNotFound = errors.New("connection not found")
+
 type ConnectionRegistrar interface {
 	Register(ctx context.Context, account string, node_id string, client Receptor) error
 	Unregister(ctx context.Context, account string, node_id string)
+
+	// Replace registers the connection in place of any existing registration of the
+	// client.  The swap is atomic so a concurrent Register or Unregister cannot observe
+	// (or act on) the client while it is not registered.
+	Replace(ctx context.Context, account string, node_id string, client Receptor) error
+
+	Ping(ctx context.Context) error
+
+	// FindConnection returns the details of the connected client.  ErrConnectionNotFound
+	// is returned if the client is not connected.
+	FindConnection(ctx context.Context, clientID domain.ClientID) (domain.RhcClient, error)
+
+	// FindConnectionsByAccount returns a page of the account's connections ordered by
+	// client id along with the total number of connections for the account.  A negative
+	// limit returns all of the connections after the offset.
+	FindConnectionsByAccount(ctx context.Context, account string, offset int, limit int) ([]domain.RhcClient, int, error)
+
+	// CountConnections returns the number of connected clients across all of the accounts
+	CountConnections(ctx context.Context) (int, error)
+
+	// UpdateLastSeen records when a control message was last received from the client.
+	// ErrConnectionNotFound is returned if the client is not connected.
+	UpdateLastSeen(ctx context.Context, clientID domain.ClientID, seenAt time.Time) error
+
+	// FindStaleConnections returns the connections that have not been seen since seenBefore
+	FindStaleConnections(ctx context.Context, seenBefore time.Time) ([]domain.RhcClient, error)
 }
 
 type ConnectionLocator interface {
@@ -27,18 +63,85 @@ type ConnectionLocator interface {
 	GetAllConnections(ctx context.Context) map[string]map[string]Receptor
 }
 
+var (
+	ErrInvalidConnectionRegistrar = errors.New("Invalid connection registrar")
+	ErrReceptorFactoryRequired    = errors.New("A receptor factory is required")
+)
+
+type RedisConfig struct {
+	Address  string
+	Password string
+	DB       int
+	TTL      time.Duration
+}
+
+// DeferredReceptorFactory is a receptor factory for the receptors that cannot be
+// created until a dependency (usually the MQTT client) is available.  No receptors
+// are created until the factory that creates them has been attached.
+type DeferredReceptorFactory struct {
+	factory ReceptorFactory
+	sync.RWMutex
+}
+
+func NewDeferredReceptorFactory() *DeferredReceptorFactory {
+	return &DeferredReceptorFactory{}
+}
+
+func (drf *DeferredReceptorFactory) Attach(factory ReceptorFactory) {
+	drf.Lock()
+	defer drf.Unlock()
+
+	drf.factory = factory
+}
+
+// Create returns nil until a factory has been attached
+func (drf *DeferredReceptorFactory) Create(account string, nodeID string) Receptor {
+	drf.RLock()
+	defer drf.RUnlock()
+
+	if drf.factory == nil {
+		return nil
+	}
+
+	return drf.factory(account, nodeID)
+}
+
+// NewConnectionManager creates the connection manager.  The "local" connection manager
+// keeps the connections in memory.  The "redis" connection manager shares them between
+// the cloud-connector instances.  It does not hold on to the registered receptors so it
+// recreates them with the receptor factory.
+func NewConnectionManager(impl string, redisCfg RedisConfig, receptorFactory ReceptorFactory, metrics *Metrics) (ConnectionManager, error) {
+	switch impl {
+	case "local":
+		return NewLocalConnectionManager(), nil
+	case "redis":
+		return NewRedisConnectionManager(NewRedisClient(redisCfg.Address, redisCfg.Password, redisCfg.DB), redisCfg.TTL, receptorFactory, metrics)
+	default:
+		return nil, ErrInvalidConnectionRegistrar
+	}
+}
+
 type LocalConnectionManager struct {
 	connections map[string]map[string]Receptor
+
+	// lastSeen records when each client was last seen.  It is indexed by client id and
+	// then by account so that the client can be found without searching every account.
+	lastSeen map[string]map[string]time.Time
 	sync.RWMutex
 }
 
 func NewLocalConnectionManager() *LocalConnectionManager {
 	return &LocalConnectionManager{
 		connections: make(map[string]map[string]Receptor),
+		lastSeen:    make(map[string]map[string]time.Time),
 	}
 }
 
 func (cm *LocalConnectionManager) Register(ctx context.Context, account string, node_id string, client Receptor) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	cm.Lock()
 	defer cm.Unlock()
 	_, exists := cm.connections[account]
@@ -55,6 +158,11 @@ func (cm *LocalConnectionManager) Register(ctx context.Context, account string,
 		cm.connections[account][node_id] = client
 	}
 
+	if _, exists := cm.lastSeen[node_id]; exists == false {
+		cm.lastSeen[node_id] = make(map[string]time.Time)
+	}
+	cm.lastSeen[node_id][account] = time.Now()
+
 	logger.Log.Printf("Registered a connection (%s, %s)", account, node_id)
 	return nil
 }
@@ -62,12 +170,16 @@ func (cm *LocalConnectionManager) Register(ctx context.Context, account string,
 func (cm *LocalConnectionManager) Unregister(ctx context.Context, account string, node_id string) {
 	cm.Lock()
 	defer cm.Unlock()
-	_, exists := cm.connections[account]
-	if exists == false {
+	if _, exists := cm.connections[account][node_id]; exists == false {
 		return
 	}
 	delete(cm.connections[account], node_id)
 
+	delete(cm.lastSeen[node_id], account)
+	if len(cm.lastSeen[node_id]) == 0 {
+		delete(cm.lastSeen, node_id)
+	}
+
 	if len(cm.connections[account]) == 0 {
 		delete(cm.connections, account)
 	}
@@ -75,6 +187,159 @@ func (cm *LocalConnectionManager) Unregister(ctx context.Context, account string
 	logger.Log.Printf("Unregistered a connection (%s, %s)", account, node_id)
 }
 
+func (cm *LocalConnectionManager) Replace(ctx context.Context, account string, node_id string, client Receptor) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	cm.Lock()
+	defer cm.Unlock()
+
+	// The client might have been registered under a different account
+	for previousAccount := range cm.lastSeen[node_id] {
+		delete(cm.connections[previousAccount], node_id)
+		if len(cm.connections[previousAccount]) == 0 {
+			delete(cm.connections, previousAccount)
+		}
+	}
+
+	if _, exists := cm.connections[account]; exists == false {
+		cm.connections[account] = make(map[string]Receptor)
+	}
+	cm.connections[account][node_id] = client
+
+	cm.lastSeen[node_id] = map[string]time.Time{account: time.Now()}
+
+	logger.Log.Printf("Replaced a connection (%s, %s)", account, node_id)
+	return nil
+}
+
+// Ping always succeeds because the connections are stored in memory
+func (cm *LocalConnectionManager) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (cm *LocalConnectionManager) CountConnections(ctx context.Context) (int, error) {
+	cm.RLock()
+	defer cm.RUnlock()
+
+	count := 0
+	for _, accountMap := range cm.connections {
+		count += len(accountMap)
+	}
+
+	return count, nil
+}
+
+func (cm *LocalConnectionManager) UpdateLastSeen(ctx context.Context, clientID domain.ClientID, seenAt time.Time) error {
+	cm.Lock()
+	defer cm.Unlock()
+
+	accounts, exists := cm.lastSeen[string(clientID)]
+	if exists == false {
+		return ErrConnectionNotFound
+	}
+
+	for account := range accounts {
+		accounts[account] = seenAt
+	}
+
+	return nil
+}
+
+func (cm *LocalConnectionManager) FindStaleConnections(ctx context.Context, seenBefore time.Time) ([]domain.RhcClient, error) {
+	cm.RLock()
+	defer cm.RUnlock()
+
+	var stale []domain.RhcClient
+
+	for clientID, accounts := range cm.lastSeen {
+		for account, seenAt := range accounts {
+			if seenAt.Before(seenBefore) {
+				stale = append(stale, connectionDetails(account, clientID, cm.connections[account][clientID]))
+			}
+		}
+	}
+
+	sortClients(stale)
+
+	return stale, nil
+}
+
+// sortClients orders the clients by account and then by client id
+func sortClients(clients []domain.RhcClient) {
+	sort.Slice(clients, func(i, j int) bool {
+		if clients[i].Account == clients[j].Account {
+			return clients[i].ClientID < clients[j].ClientID
+		}
+		return clients[i].Account < clients[j].Account
+	})
+}
+
+func (cm *LocalConnectionManager) FindConnection(ctx context.Context, clientID domain.ClientID) (domain.RhcClient, error) {
+	cm.RLock()
+	defer cm.RUnlock()
+
+	for account := range cm.lastSeen[string(clientID)] {
+		return connectionDetails(account, string(clientID), cm.connections[account][string(clientID)]), nil
+	}
+
+	return domain.RhcClient{}, ErrConnectionNotFound
+}
+
+func (cm *LocalConnectionManager) FindConnectionsByAccount(ctx context.Context, account string, offset int, limit int) ([]domain.RhcClient, int, error) {
+	cm.RLock()
+	defer cm.RUnlock()
+
+	accountMap := cm.connections[account]
+
+	clientIDs := make([]string, 0, len(accountMap))
+	for clientID := range accountMap {
+		clientIDs = append(clientIDs, clientID)
+	}
+
+	sort.Strings(clientIDs)
+
+	total := len(clientIDs)
+	start, end := pageBounds(total, offset, limit)
+
+	connections := make([]domain.RhcClient, 0, end-start)
+	for _, clientID := range clientIDs[start:end] {
+		connections = append(connections, connectionDetails(account, clientID, accountMap[clientID]))
+	}
+
+	return connections, total, nil
+}
+
+// pageBounds returns the start and the end of the page of the total items.  A negative
+// limit includes all of the items after the offset.  A negative offset is treated as 0.
+func pageBounds(total int, offset int, limit int) (int, int) {
+	if offset < 0 {
+		offset = 0
+	}
+
+	if offset > total {
+		offset = total
+	}
+
+	end := total
+	if limit >= 0 && offset+limit < total {
+		end = offset + limit
+	}
+
+	return offset, end
+}
+
+// connectionDetails returns the details that the client reported when it connected.
+// Only the account and client id are known for connections that do not keep the details.
+func connectionDetails(account string, clientID string, conn Receptor) domain.RhcClient {
+	if detailer, ok := conn.(ClientDetailer); ok {
+		return detailer.ClientDetails()
+	}
+
+	return domain.RhcClient{ClientID: domain.ClientID(clientID), Account: domain.AccountID(account)}
+}
+
 func (cm *LocalConnectionManager) GetConnection(ctx context.Context, account string, node_id string) Receptor {
 	var conn Receptor
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
 	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
 
 	"github.com/google/go-cmp/cmp"
@@ -183,3 +184,122 @@ func TestRegisterLocalConnectionsWithDuplicateNodeIDs(t *testing.T) {
 		t.Fatalf("Expected to find the connection that was registered first")
 	}
 }
+
+func TestReplaceLocalConnection(t *testing.T) {
+	cm := NewLocalConnectionManager()
+	first := new(MockReceptor)
+	second := new(MockReceptor)
+
+	cm.Register(context.TODO(), "123", "456", first)
+
+	if err := cm.Replace(context.TODO(), "789", "456", second); err != nil {
+		t.Fatalf("Unexpected error replacing the connection: %s", err)
+	}
+
+	if cm.GetConnection(context.TODO(), "123", "456") != nil {
+		t.Fatalf("Expected the registration under the previous account to be removed")
+	}
+
+	if cm.GetConnection(context.TODO(), "789", "456") != second {
+		t.Fatalf("Expected the replacement to be registered")
+	}
+
+	if count, _ := cm.CountConnections(context.TODO()); count != 1 {
+		t.Fatalf("Expected one connection, got %d", count)
+	}
+
+	if err := cm.Replace(context.TODO(), "789", "999", first); err != nil {
+		t.Fatalf("Unexpected error replacing a connection that was not registered: %s", err)
+	}
+
+	if cm.GetConnection(context.TODO(), "789", "999") != first {
+		t.Fatalf("Expected the connection to be registered")
+	}
+}
+
+func TestFindConnection(t *testing.T) {
+	cm := NewLocalConnectionManager()
+	cm.Register(context.TODO(), "123", "456", &DetailedMockReceptor{details: domain.RhcClient{ClientID: "456", Account: "123", Capabilities: []string{"reconnect"}}})
+	cm.Register(context.TODO(), "123", "789", &MockReceptor{})
+
+	client, err := cm.FindConnection(context.TODO(), "456")
+	if err != nil {
+		t.Fatalf("Unexpected error finding the connection: %s", err)
+	}
+
+	if client.HasCapability("reconnect") == false {
+		t.Fatalf("Expected the client's details to be returned, got %+v", client)
+	}
+
+	client, err = cm.FindConnection(context.TODO(), "789")
+	if err != nil || client.ClientID != "789" || client.Account != "123" {
+		t.Fatalf("Expected the account and client id of a connection without details, got %+v (%v)", client, err)
+	}
+
+	if _, err := cm.FindConnection(context.TODO(), "not gonna find me"); err != ErrConnectionNotFound {
+		t.Fatalf("Expected ErrConnectionNotFound, got %v", err)
+	}
+}
+
+func TestFindConnectionsByAccount(t *testing.T) {
+	cm := NewLocalConnectionManager()
+	for _, clientID := range []string{"c", "a", "d", "b"} {
+		cm.Register(context.TODO(), "123", clientID, &MockReceptor{})
+	}
+	cm.Register(context.TODO(), "456", "e", &MockReceptor{})
+
+	var tests = []struct {
+		name     string
+		account  string
+		offset   int
+		limit    int
+		expected []domain.ClientID
+	}{
+		{"first page", "123", 0, 2, []domain.ClientID{"a", "b"}},
+		{"last page", "123", 2, 2, []domain.ClientID{"c", "d"}},
+		{"partial page", "123", 3, 2, []domain.ClientID{"d"}},
+		{"offset past the end", "123", 10, 2, []domain.ClientID{}},
+		{"negative offset", "123", -1, 2, []domain.ClientID{"a", "b"}},
+		{"no limit", "123", 1, -1, []domain.ClientID{"b", "c", "d"}},
+		{"unknown account", "789", 0, 10, []domain.ClientID{}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			clients, total, err := cm.FindConnectionsByAccount(context.TODO(), tc.account, tc.offset, tc.limit)
+			if err != nil {
+				t.Fatalf("Unexpected error finding the connections: %s", err)
+			}
+
+			expectedTotal := len(cm.GetConnectionsByAccount(context.TODO(), tc.account))
+			if total != expectedTotal {
+				t.Fatalf("Expected a total of %d connections, got %d", expectedTotal, total)
+			}
+
+			clientIDs := []domain.ClientID{}
+			for _, client := range clients {
+				clientIDs = append(clientIDs, client.ClientID)
+			}
+
+			if diff := cmp.Diff(tc.expected, clientIDs); diff != "" {
+				t.Fatalf("Unexpected page of connections: %s", diff)
+			}
+		})
+	}
+}
+
+func TestRegisterLocalConnectionWithCancelledContext(t *testing.T) {
+	cm := NewLocalConnectionManager()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := cm.Register(ctx, "123", "456", new(MockReceptor))
+	if err != context.Canceled {
+		t.Fatalf("Expected the registration to be cancelled, got %v", err)
+	}
+
+	if cm.GetConnection(context.TODO(), "123", "456") != nil {
+		t.Fatalf("Expected the connection to not be registered")
+	}
+}
@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+const (
+	QuotaReasonAccountConnections = "account_connection_quota_exceeded"
+	QuotaReasonClientAttempts     = "client_connection_attempt_quota_exceeded"
+)
+
+type QuotaDecision struct {
+	Allowed    bool
+	Reason     string
+	Detail     string
+	RetryAfter int
+}
+
+// ConnectionQuota decides if a client is allowed to connect to the broker.  An account
+// is limited to maxPerAccount concurrent connections.  A client is limited to
+// maxAttemptsPerClient connection attempts within the window.  A limit of zero
+// disables the corresponding check.  Clients that are already connected are not
+// counted against their account's limit when they reconnect.
+//
+// The account limit is checked against the connection locator, so it is enforced
+// across the instances when the connections are shared (i.e. kept in redis).  The
+// connection attempts are only counted by the instance that handles the broker's auth
+// request.  When the auth requests are spread across N instances, a client can make up
+// to N times maxAttemptsPerClient attempts within the window.
+//
+// The attempts are counted with a sliding window that is approximated from the counts
+// of the current and the previous window, so recording an attempt does not require
+// looking at the attempts of the other clients.
+type ConnectionQuota struct {
+	connectionLocator    ConnectionLocator
+	accountResolver      AccountIdResolver
+	maxPerAccount        int
+	maxAttemptsPerClient int
+	window               time.Duration
+	retryAfter           int
+	windowStart          time.Time
+	attempts             map[domain.ClientID]int
+	previousAttempts     map[domain.ClientID]int
+	metrics              *Metrics
+	sync.Mutex
+}
+
+func NewConnectionQuota(cl ConnectionLocator, ar AccountIdResolver, maxPerAccount int, maxAttemptsPerClient int, window time.Duration, retryAfter int, metrics *Metrics) *ConnectionQuota {
+	return &ConnectionQuota{
+		connectionLocator:    cl,
+		accountResolver:      ar,
+		maxPerAccount:        maxPerAccount,
+		maxAttemptsPerClient: maxAttemptsPerClient,
+		window:               window,
+		retryAfter:           retryAfter,
+		attempts:             make(map[domain.ClientID]int),
+		previousAttempts:     make(map[domain.ClientID]int),
+		metrics:              metrics,
+	}
+}
+
+func (cq *ConnectionQuota) Check(ctx context.Context, clientID domain.ClientID) (QuotaDecision, error) {
+	if cq.recordAttempt(clientID, time.Now()) == false {
+		cq.metrics.connectionQuotaRejectionCounter.WithLabelValues(QuotaReasonClientAttempts).Inc()
+		return QuotaDecision{
+			Reason:     QuotaReasonClientAttempts,
+			Detail:     fmt.Sprintf("The client exceeded %d connection attempts within %s", cq.maxAttemptsPerClient, cq.window),
+			RetryAfter: cq.retryAfter,
+		}, nil
+	}
+
+	if cq.maxPerAccount <= 0 {
+		return QuotaDecision{Allowed: true}, nil
+	}
+
+	account, _, err := cq.accountResolver.MapClientIdToAccountId(ctx, clientID)
+	if err != nil {
+		return QuotaDecision{}, err
+	}
+
+	connections := cq.connectionLocator.GetConnectionsByAccount(ctx, string(account))
+
+	if _, alreadyConnected := connections[string(clientID)]; alreadyConnected == false && len(connections) >= cq.maxPerAccount {
+		cq.metrics.connectionQuotaRejectionCounter.WithLabelValues(QuotaReasonAccountConnections).Inc()
+		return QuotaDecision{
+			Reason:     QuotaReasonAccountConnections,
+			Detail:     fmt.Sprintf("Account %s has reached its limit of %d connections", account, cq.maxPerAccount),
+			RetryAfter: cq.retryAfter,
+		}, nil
+	}
+
+	return QuotaDecision{Allowed: true}, nil
+}
+
+// recordAttempt counts the client's connection attempt and returns false if the client
+// has exceeded the number of attempts allowed within the window
+func (cq *ConnectionQuota) recordAttempt(clientID domain.ClientID, now time.Time) bool {
+	if cq.maxAttemptsPerClient <= 0 {
+		return true
+	}
+
+	cq.Lock()
+	defer cq.Unlock()
+
+	cq.advanceWindow(now)
+
+	cq.attempts[clientID]++
+
+	// The previous window's attempts are weighted by how much of the sliding window
+	// still overlaps the previous window
+	overlap := 1 - float64(now.Sub(cq.windowStart))/float64(cq.window)
+	attempts := float64(cq.attempts[clientID]) + float64(cq.previousAttempts[clientID])*overlap
+
+	return attempts <= float64(cq.maxAttemptsPerClient)
+}
+
+// advanceWindow starts a new window once the current window has passed.  The
+// attempts from before the previous window are discarded.
+func (cq *ConnectionQuota) advanceWindow(now time.Time) {
+	if cq.windowStart.IsZero() || now.Before(cq.windowStart) {
+		cq.windowStart = now
+		return
+	}
+
+	elapsed := now.Sub(cq.windowStart)
+	if elapsed < cq.window {
+		return
+	}
+
+	if elapsed < 2*cq.window {
+		cq.previousAttempts = cq.attempts
+		cq.windowStart = cq.windowStart.Add(cq.window)
+	} else {
+		cq.previousAttempts = make(map[domain.ClientID]int)
+		cq.windowStart = now
+	}
+
+	cq.attempts = make(map[domain.ClientID]int)
+}
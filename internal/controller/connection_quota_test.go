@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+func TestConnectionQuotaPerAccount(t *testing.T) {
+	// The configurable resolver maps the clients used below to account 0000001
+	cm := NewLocalConnectionManager()
+	cm.Register(context.TODO(), "0000001", "client-a", &MockReceptor{})
+	cm.Register(context.TODO(), "0000001", "client-b", &MockReceptor{})
+
+	var tests = []struct {
+		name            string
+		maxPerAccount   int
+		clientID        string
+		expectedAllowed bool
+	}{
+		{"within quota", 3, "client-c", true},
+		{"over quota", 2, "client-c", false},
+		{"already connected client reconnecting", 2, "client-a", true},
+		{"quota disabled", 0, "client-c", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			quota := NewConnectionQuota(cm, &ConfigurableAccountIdResolver{}, tc.maxPerAccount, 0, time.Minute, 300, metrics)
+
+			decision, err := quota.Check(context.TODO(), domain.ClientID(tc.clientID))
+			if err != nil {
+				t.Fatalf("Unexpected error checking the quota: %s", err)
+			}
+
+			if decision.Allowed != tc.expectedAllowed {
+				t.Fatalf("Expected allowed=%t, got %+v", tc.expectedAllowed, decision)
+			}
+
+			if decision.Allowed == false && (decision.Reason != QuotaReasonAccountConnections || decision.RetryAfter != 300) {
+				t.Fatalf("Expected the account quota rejection to include the reason and retry hint, got %+v", decision)
+			}
+		})
+	}
+}
+
+func TestConnectionQuotaPerClientAttempts(t *testing.T) {
+	quota := NewConnectionQuota(NewLocalConnectionManager(), &ConfigurableAccountIdResolver{}, 0, 2, time.Minute, 300, metrics)
+
+	for i := 0; i < 2; i++ {
+		decision, _ := quota.Check(context.TODO(), "client-a")
+		if decision.Allowed == false {
+			t.Fatalf("Expected attempt %d to be within the quota", i+1)
+		}
+	}
+
+	decision, _ := quota.Check(context.TODO(), "client-a")
+	if decision.Allowed || decision.Reason != QuotaReasonClientAttempts {
+		t.Fatalf("Expected the third attempt to exceed the quota, got %+v", decision)
+	}
+
+	decision, _ = quota.Check(context.TODO(), "client-b")
+	if decision.Allowed == false {
+		t.Fatalf("Expected the other clients to be unaffected")
+	}
+}
+
+func TestConnectionQuotaAttemptWindowExpires(t *testing.T) {
+	quota := NewConnectionQuota(NewLocalConnectionManager(), &ConfigurableAccountIdResolver{}, 0, 1, time.Minute, 300, metrics)
+
+	now := time.Now()
+	if quota.recordAttempt("client-a", now.Add(-2*time.Minute)) == false {
+		t.Fatalf("Expected the first attempt to be allowed")
+	}
+
+	if quota.recordAttempt("client-a", now) == false {
+		t.Fatalf("Expected the attempts to be reset once the window has passed")
+	}
+}
+
+func TestConnectionQuotaAttemptsSlideAcrossWindows(t *testing.T) {
+	quota := NewConnectionQuota(NewLocalConnectionManager(), &ConfigurableAccountIdResolver{}, 0, 2, time.Minute, 300, metrics)
+
+	start := time.Now()
+	quota.recordAttempt("client-a", start)
+	quota.recordAttempt("client-a", start)
+
+	// Half of the sliding window still overlaps the previous window, so half of the
+	// previous window's attempts still count
+	halfway := start.Add(90 * time.Second)
+	if quota.recordAttempt("client-a", halfway) == false {
+		t.Fatalf("Expected the attempt to be allowed once half of the previous attempts slid out of the window")
+	}
+
+	if quota.recordAttempt("client-a", halfway) {
+		t.Fatalf("Expected the attempt to exceed the quota")
+	}
+
+	if len(quota.attempts) != 1 || len(quota.previousAttempts) != 1 {
+		t.Fatalf("Expected only the current and the previous window to be kept, got %v and %v", quota.attempts, quota.previousAttempts)
+	}
+}
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ClientDisconnector cleans up after a client that went away without sending an offline
+// message.  It does the same work as handling the client's offline message.
+type ClientDisconnector interface {
+	Disconnect(ctx context.Context, client domain.RhcClient)
+}
+
+// ConnectionReaper unregisters the connections of clients that went away without
+// sending an offline message.  A connection is considered stale once no control
+// message has been received from the client within the ttl.  Stale clients are
+// pinged before they are reaped so that idle clients that are still connected are
+// left alone.  Only the clients that do not answer the ping are reaped.
+type ConnectionReaper struct {
+	connectionRegistrar ConnectionRegistrar
+	pinger              ClientPinger
+	disconnector        ClientDisconnector
+	ttl                 time.Duration
+	interval            time.Duration
+	pingTimeout         time.Duration
+	now                 func() time.Time
+	metrics             *Metrics
+	cancel              context.CancelFunc
+	done                sync.WaitGroup
+}
+
+func NewConnectionReaper(cr ConnectionRegistrar, pinger ClientPinger, disconnector ClientDisconnector, ttl time.Duration, interval time.Duration, pingTimeout time.Duration, metrics *Metrics) *ConnectionReaper {
+	return &ConnectionReaper{
+		connectionRegistrar: cr,
+		pinger:              pinger,
+		disconnector:        disconnector,
+		ttl:                 ttl,
+		interval:            interval,
+		pingTimeout:         pingTimeout,
+		now:                 time.Now,
+		metrics:             metrics,
+	}
+}
+
+// Reap disconnects the stale connections whose clients do not respond to a ping and
+// returns the number that were disconnected
+func (cr *ConnectionReaper) Reap(ctx context.Context) (int, error) {
+	stale, err := cr.connectionRegistrar.FindStaleConnections(ctx, cr.now().Add(-cr.ttl))
+	if err != nil {
+		return 0, err
+	}
+
+	reaped := 0
+
+	for _, client := range stale {
+		if ctx.Err() != nil {
+			break
+		}
+
+		logger := logger.Log.WithFields(logrus.Fields{"account": client.Account, "client_id": client.ClientID})
+
+		err := cr.ping(ctx, client.ClientID)
+		if err == nil {
+			// The client is idle, but still connected
+			logger.Debug("Stale connection responded to a ping")
+			cr.connectionRegistrar.UpdateLastSeen(ctx, client.ClientID, cr.now())
+			continue
+		}
+
+		if errors.Is(err, ErrClientUnreachable) == false {
+			logger.WithFields(logrus.Fields{"error": err}).Warn("Unable to ping the client of a stale connection")
+			continue
+		}
+
+		logger.Info("Reaping stale connection")
+
+		cr.disconnector.Disconnect(ctx, client)
+		reaped++
+	}
+
+	cr.metrics.reapedConnectionCounter.Add(float64(reaped))
+
+	return reaped, nil
+}
+
+func (cr *ConnectionReaper) ping(ctx context.Context, clientID domain.ClientID) error {
+	pingCtx, cancel := context.WithTimeout(ctx, cr.pingTimeout)
+	defer cancel()
+
+	return cr.pinger.Ping(pingCtx, clientID)
+}
+
+func (cr *ConnectionReaper) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cr.cancel = cancel
+
+	cr.done.Add(1)
+	go func() {
+		defer cr.done.Done()
+
+		ticker := time.NewTicker(cr.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := cr.Reap(ctx); err != nil {
+					logger.Log.WithFields(logrus.Fields{"error": err}).Warn("Unable to reap the stale connections")
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops the reaper and waits for an in-progress reaping to finish
+func (cr *ConnectionReaper) Stop() {
+	cr.cancel()
+	cr.done.Wait()
+}
@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// unregisteringDisconnector records the disconnected clients and unregisters them
+type unregisteringDisconnector struct {
+	cm           ConnectionRegistrar
+	disconnected []domain.ClientID
+}
+
+func (ud *unregisteringDisconnector) Disconnect(ctx context.Context, client domain.RhcClient) {
+	ud.disconnected = append(ud.disconnected, client.ClientID)
+	ud.cm.Unregister(ctx, string(client.Account), string(client.ClientID))
+}
+
+func TestConnectionReaperUnregistersStaleConnections(t *testing.T) {
+	cm := NewLocalConnectionManager()
+	cm.Register(context.TODO(), "1234", "client-1", &MockReceptor{})
+	cm.Register(context.TODO(), "1234", "client-2", &MockReceptor{})
+	cm.Register(context.TODO(), "5678", "client-3", &MockReceptor{})
+	cm.Register(context.TODO(), "5678", "client-4", &MockReceptor{})
+
+	now := time.Date(2021, 1, 12, 15, 30, 0, 0, time.UTC)
+
+	cm.UpdateLastSeen(context.TODO(), "client-1", now.Add(-10*time.Minute))
+	cm.UpdateLastSeen(context.TODO(), "client-2", now.Add(-time.Minute))
+	cm.UpdateLastSeen(context.TODO(), "client-3", now.Add(-6*time.Minute))
+	cm.UpdateLastSeen(context.TODO(), "client-4", now.Add(-7*time.Minute))
+
+	// client-4 is idle, but still responds to pings
+	broker := &mockBroker{unreachable: map[domain.ClientID]bool{"client-1": true, "client-3": true}}
+	disconnector := &unregisteringDisconnector{cm: cm}
+
+	reaper := NewConnectionReaper(cm, broker, disconnector, 5*time.Minute, time.Minute, time.Second, metrics)
+	reaper.now = func() time.Time { return now }
+
+	reapedBefore := testutil.ToFloat64(metrics.reapedConnectionCounter)
+
+	reaped, err := reaper.Reap(context.TODO())
+	if err != nil {
+		t.Fatalf("Unexpected error reaping the connections: %s", err)
+	}
+
+	if reaped != 2 {
+		t.Fatalf("Expected 2 connections to be reaped, got %d", reaped)
+	}
+
+	if len(broker.pinged) != 3 {
+		t.Fatalf("Expected the 3 stale clients to be pinged, got %v", broker.pinged)
+	}
+
+	if len(disconnector.disconnected) != 2 || disconnector.disconnected[0] != "client-1" || disconnector.disconnected[1] != "client-3" {
+		t.Fatalf("Expected the unreachable clients to be disconnected, got %v", disconnector.disconnected)
+	}
+
+	if cm.GetConnection(context.TODO(), "1234", "client-1") != nil || cm.GetConnection(context.TODO(), "5678", "client-3") != nil {
+		t.Fatalf("Expected the stale connections to be unregistered")
+	}
+
+	if cm.GetConnection(context.TODO(), "1234", "client-2") == nil || cm.GetConnection(context.TODO(), "5678", "client-4") == nil {
+		t.Fatalf("Expected the recently seen and the idle connections to remain registered")
+	}
+
+	if counted := testutil.ToFloat64(metrics.reapedConnectionCounter) - reapedBefore; counted != 2 {
+		t.Fatalf("Expected the reaped connection counter to increase by 2, got %v", counted)
+	}
+
+	if reaped, _ := reaper.Reap(context.TODO()); reaped != 0 {
+		t.Fatalf("Expected nothing to be reaped on the second pass, got %d", reaped)
+	}
+
+	if len(broker.pinged) != 3 {
+		t.Fatalf("Expected the idle client not to be pinged again once it responded, got %v", broker.pinged)
+	}
+}
+
+func TestConnectionReaperKeepsConnectionsOnBrokerErrors(t *testing.T) {
+	cm := NewLocalConnectionManager()
+	cm.Register(context.TODO(), "1234", "client-1", &MockReceptor{})
+
+	broker := &mockBroker{brokerErr: errors.New("connection lost")}
+	disconnector := &unregisteringDisconnector{cm: cm}
+
+	reaper := NewConnectionReaper(cm, broker, disconnector, 5*time.Minute, time.Minute, time.Second, metrics)
+	reaper.now = func() time.Time { return time.Now().Add(time.Hour) }
+
+	if reaped, _ := reaper.Reap(context.TODO()); reaped != 0 {
+		t.Fatalf("Expected nothing to be reaped when the broker is unavailable, got %d", reaped)
+	}
+
+	if len(disconnector.disconnected) != 0 || cm.GetConnection(context.TODO(), "1234", "client-1") == nil {
+		t.Fatalf("Expected the connection to remain registered")
+	}
+}
+
+func TestUpdateLastSeenOfUnknownConnection(t *testing.T) {
+	cm := NewLocalConnectionManager()
+
+	if err := cm.UpdateLastSeen(context.TODO(), "client-1", time.Now()); err != ErrConnectionNotFound {
+		t.Fatalf("Expected ErrConnectionNotFound, got %v", err)
+	}
+}
+
+func TestRegisterMarksConnectionAsSeen(t *testing.T) {
+	cm := NewLocalConnectionManager()
+	cm.Register(context.TODO(), "1234", "client-1", &MockReceptor{})
+
+	stale, _ := cm.FindStaleConnections(context.TODO(), time.Now().Add(-time.Minute))
+	if len(stale) != 0 {
+		t.Fatalf("Expected a newly registered connection not to be stale, got %+v", stale)
+	}
+
+	stale, _ = cm.FindStaleConnections(context.TODO(), time.Now().Add(time.Minute))
+	if len(stale) != 1 || stale[0].ClientID != "client-1" || stale[0].Account != "1234" {
+		t.Fatalf("Expected the connection to be stale, got %+v", stale)
+	}
+}
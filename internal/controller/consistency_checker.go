@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	InconsistencyUnreachableClient = "unreachable_client"
+	InconsistencyMissingFacts      = "missing_canonical_facts"
+)
+
+// ClientPinger checks if a registered client can still be reached.  Ping returns an
+// error wrapping ErrClientUnreachable when the client did not respond.  Any other
+// error means that the client could not be checked.
+type ClientPinger interface {
+	Ping(context.Context, domain.ClientID) error
+}
+
+type Inconsistency struct {
+	Account  string `json:"account"`
+	ClientID string `json:"client_id"`
+	Kind     string `json:"kind"`
+	Detail   string `json:"detail,omitempty"`
+	Repaired bool   `json:"repaired"`
+}
+
+type ConsistencyReport struct {
+	Timestamp       string          `json:"timestamp"`
+	Registered      int             `json:"registered"`
+	Sampled         int             `json:"sampled"`
+	Inconsistencies []Inconsistency `json:"inconsistencies"`
+}
+
+type ConsistencyCheckerConfig struct {
+	Interval    time.Duration
+	SampleSize  int
+	PingTimeout time.Duration
+	Repair      bool
+}
+
+// ConsistencyChecker periodically samples the registered connections and looks
+// for registrations that no longer match reality.  Clients that cannot be pinged
+// are reported as unreachable and clients that did not report any canonical facts
+// are reported as missing facts.  When repair is enabled, unreachable clients are
+// unregistered and clients with missing facts are asked to reconnect so that
+// they send a new handshake.
+type ConsistencyChecker struct {
+	connectionManager ConnectionManager
+	pinger            ClientPinger
+	reconnector       ClientReconnector
+	config            ConsistencyCheckerConfig
+	lastReport        *ConsistencyReport
+	metrics           *Metrics
+	cancel            context.CancelFunc
+	done              sync.WaitGroup
+	sync.RWMutex
+}
+
+func NewConsistencyChecker(cm ConnectionManager, pinger ClientPinger, reconnector ClientReconnector, cfg ConsistencyCheckerConfig, metrics *Metrics) *ConsistencyChecker {
+	return &ConsistencyChecker{
+		connectionManager: cm,
+		pinger:            pinger,
+		reconnector:       reconnector,
+		config:            cfg,
+		metrics:           metrics,
+	}
+}
+
+func (cc *ConsistencyChecker) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cc.cancel = cancel
+
+	cc.done.Add(1)
+	go func() {
+		defer cc.done.Done()
+
+		ticker := time.NewTicker(cc.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				cc.Check(ctx)
+			}
+		}
+	}()
+}
+
+// Stop stops the checker and waits for an in-progress check to finish
+func (cc *ConsistencyChecker) Stop() {
+	cc.cancel()
+	cc.done.Wait()
+}
+
+// LastReport returns the report of the most recent check.  The second return
+// value is false if no check has completed yet.
+func (cc *ConsistencyChecker) LastReport() (ConsistencyReport, bool) {
+	cc.RLock()
+	defer cc.RUnlock()
+
+	if cc.lastReport == nil {
+		return ConsistencyReport{}, false
+	}
+
+	return *cc.lastReport, true
+}
+
+type sampledConnection struct {
+	account  string
+	clientID string
+	receptor Receptor
+}
+
+// Check verifies a sample of the registered connections and records the report
+func (cc *ConsistencyChecker) Check(ctx context.Context) ConsistencyReport {
+	registered, sampled := cc.sampleConnections(ctx)
+
+	report := ConsistencyReport{
+		Timestamp:       time.Now().UTC().Format(time.RFC3339),
+		Inconsistencies: []Inconsistency{},
+	}
+
+	for _, connection := range sampled {
+		inconsistency := cc.checkConnection(ctx, connection)
+		if inconsistency == nil {
+			continue
+		}
+
+		if cc.config.Repair {
+			inconsistency.Repaired = cc.repair(ctx, connection, inconsistency.Kind)
+		}
+
+		cc.metrics.consistencyCheckInconsistencyCounter.WithLabelValues(inconsistency.Kind, strconv.FormatBool(inconsistency.Repaired)).Inc()
+
+		logger.Log.WithFields(logrus.Fields{"account": connection.account, "client_id": connection.clientID,
+			"kind": inconsistency.Kind, "repaired": inconsistency.Repaired}).Warn("Found an inconsistent connection registration")
+
+		report.Inconsistencies = append(report.Inconsistencies, *inconsistency)
+	}
+
+	report.Registered = registered
+	report.Sampled = len(sampled)
+
+	cc.Lock()
+	cc.lastReport = &report
+	cc.Unlock()
+
+	return report
+}
+
+// sampleConnections returns the number of registered connections and a random
+// sample of at most SampleSize of them.  A SampleSize of zero samples everything.
+func (cc *ConsistencyChecker) sampleConnections(ctx context.Context) (int, []sampledConnection) {
+	var all []sampledConnection
+
+	for account, connections := range cc.connectionManager.GetAllConnections(ctx) {
+		for clientID, receptor := range connections {
+			all = append(all, sampledConnection{account: account, clientID: clientID, receptor: receptor})
+		}
+	}
+
+	registered := len(all)
+
+	if cc.config.SampleSize > 0 && len(all) > cc.config.SampleSize {
+		rand.Shuffle(len(all), func(i, j int) { all[i], all[j] = all[j], all[i] })
+		all = all[:cc.config.SampleSize]
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].account == all[j].account {
+			return all[i].clientID < all[j].clientID
+		}
+		return all[i].account < all[j].account
+	})
+
+	return registered, all
+}
+
+func (cc *ConsistencyChecker) checkConnection(ctx context.Context, connection sampledConnection) *Inconsistency {
+	pingCtx, cancel := context.WithTimeout(ctx, cc.config.PingTimeout)
+	defer cancel()
+
+	if err := cc.pinger.Ping(pingCtx, domain.ClientID(connection.clientID)); err != nil {
+		if errors.Is(err, ErrClientUnreachable) == false {
+			// The broker could not be reached, which says nothing about the client
+			logger.Log.WithFields(logrus.Fields{"account": connection.account, "client_id": connection.clientID,
+				"error": err}).Warn("Unable to ping the client")
+			return nil
+		}
+
+		return &Inconsistency{
+			Account:  connection.account,
+			ClientID: connection.clientID,
+			Kind:     InconsistencyUnreachableClient,
+			Detail:   err.Error(),
+		}
+	}
+
+	detailer, ok := connection.receptor.(ClientDetailer)
+	if ok == false {
+		return nil
+	}
+
+	if detailer.ClientDetails().CanonicalFacts == nil {
+		return &Inconsistency{
+			Account:  connection.account,
+			ClientID: connection.clientID,
+			Kind:     InconsistencyMissingFacts,
+		}
+	}
+
+	return nil
+}
+
+func (cc *ConsistencyChecker) repair(ctx context.Context, connection sampledConnection, kind string) bool {
+	switch kind {
+	case InconsistencyUnreachableClient:
+		cc.connectionManager.Unregister(ctx, connection.account, connection.clientID)
+		return true
+	case InconsistencyMissingFacts:
+		if cc.reconnector == nil {
+			return false
+		}
+
+		if err := cc.reconnector.Reconnect(ctx, domain.ClientID(connection.clientID), 0); err != nil {
+			logger.Log.WithFields(logrus.Fields{"client_id": connection.clientID, "error": err}).Error("Unable to ask the client to reconnect")
+			return false
+		}
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+type mockBroker struct {
+	unreachable map[domain.ClientID]bool
+	brokerErr   error
+	pinged      []domain.ClientID
+	reconnected []domain.ClientID
+}
+
+func (mb *mockBroker) Ping(ctx context.Context, clientID domain.ClientID) error {
+	mb.pinged = append(mb.pinged, clientID)
+	if mb.brokerErr != nil {
+		return mb.brokerErr
+	}
+	if mb.unreachable[clientID] {
+		return ErrClientUnreachable
+	}
+	return nil
+}
+
+func (mb *mockBroker) Reconnect(ctx context.Context, clientID domain.ClientID, delay int) error {
+	mb.reconnected = append(mb.reconnected, clientID)
+	return nil
+}
+
+func newConsistencyTestConnections() *LocalConnectionManager {
+	facts := map[string]interface{}{"fqdn": "node.example.com"}
+
+	cm := NewLocalConnectionManager()
+	cm.Register(context.TODO(), "1234", "healthy", &DetailedMockReceptor{details: domain.RhcClient{CanonicalFacts: facts}})
+	cm.Register(context.TODO(), "1234", "stale", &DetailedMockReceptor{details: domain.RhcClient{CanonicalFacts: facts}})
+	cm.Register(context.TODO(), "5678", "factless", &DetailedMockReceptor{})
+	return cm
+}
+
+func TestConsistencyCheckReportsInconsistencies(t *testing.T) {
+	cm := newConsistencyTestConnections()
+	broker := &mockBroker{unreachable: map[domain.ClientID]bool{"stale": true}}
+
+	checker := NewConsistencyChecker(cm, broker, broker, ConsistencyCheckerConfig{PingTimeout: time.Second}, metrics)
+
+	if _, found := checker.LastReport(); found {
+		t.Fatalf("Expected no report before the first check")
+	}
+
+	report := checker.Check(context.TODO())
+
+	if report.Registered != 3 || report.Sampled != 3 {
+		t.Fatalf("Expected 3 registered and 3 sampled connections, got %d and %d", report.Registered, report.Sampled)
+	}
+
+	expected := []Inconsistency{
+		{Account: "1234", ClientID: "stale", Kind: InconsistencyUnreachableClient, Detail: ErrClientUnreachable.Error()},
+		{Account: "5678", ClientID: "factless", Kind: InconsistencyMissingFacts},
+	}
+
+	if len(report.Inconsistencies) != len(expected) {
+		t.Fatalf("Expected %d inconsistencies, got %+v", len(expected), report.Inconsistencies)
+	}
+
+	for i := range expected {
+		if report.Inconsistencies[i] != expected[i] {
+			t.Fatalf("Expected inconsistency %+v, got %+v", expected[i], report.Inconsistencies[i])
+		}
+	}
+
+	if cm.GetConnection(context.TODO(), "1234", "stale") == nil {
+		t.Fatalf("Expected the stale connection to remain registered when repair is disabled")
+	}
+
+	if len(broker.reconnected) != 0 {
+		t.Fatalf("Expected no reconnects when repair is disabled, got %v", broker.reconnected)
+	}
+
+	lastReport, found := checker.LastReport()
+	if found == false || len(lastReport.Inconsistencies) != len(expected) {
+		t.Fatalf("Expected the last report to be recorded, got %+v", lastReport)
+	}
+}
+
+func TestConsistencyCheckRepairsInconsistencies(t *testing.T) {
+	cm := newConsistencyTestConnections()
+	broker := &mockBroker{unreachable: map[domain.ClientID]bool{"stale": true}}
+
+	checker := NewConsistencyChecker(cm, broker, broker, ConsistencyCheckerConfig{PingTimeout: time.Second, Repair: true}, metrics)
+
+	report := checker.Check(context.TODO())
+
+	for _, inconsistency := range report.Inconsistencies {
+		if inconsistency.Repaired == false {
+			t.Fatalf("Expected the inconsistency to be repaired: %+v", inconsistency)
+		}
+	}
+
+	if cm.GetConnection(context.TODO(), "1234", "stale") != nil {
+		t.Fatalf("Expected the stale connection to be unregistered")
+	}
+
+	if cm.GetConnection(context.TODO(), "1234", "healthy") == nil {
+		t.Fatalf("Expected the healthy connection to remain registered")
+	}
+
+	if len(broker.reconnected) != 1 || broker.reconnected[0] != "factless" {
+		t.Fatalf("Expected the client with missing facts to be asked to reconnect, got %v", broker.reconnected)
+	}
+}
+
+func TestConsistencyCheckDoesNotRepairOnBrokerErrors(t *testing.T) {
+	cm := newConsistencyTestConnections()
+	broker := &mockBroker{brokerErr: errors.New("connection lost")}
+
+	checker := NewConsistencyChecker(cm, broker, broker, ConsistencyCheckerConfig{PingTimeout: time.Second, Repair: true}, metrics)
+
+	report := checker.Check(context.TODO())
+
+	if len(report.Inconsistencies) != 0 {
+		t.Fatalf("Expected a broker failure not to be reported as an inconsistency, got %+v", report.Inconsistencies)
+	}
+
+	if count, _ := cm.CountConnections(context.TODO()); count != 3 {
+		t.Fatalf("Expected the connections to remain registered, got %d", count)
+	}
+}
+
+func TestConsistencyCheckSampling(t *testing.T) {
+	cm := newConsistencyTestConnections()
+	broker := &mockBroker{}
+
+	checker := NewConsistencyChecker(cm, broker, broker, ConsistencyCheckerConfig{PingTimeout: time.Second, SampleSize: 2}, metrics)
+
+	report := checker.Check(context.TODO())
+
+	if report.Registered != 3 || report.Sampled != 2 {
+		t.Fatalf("Expected 3 registered and 2 sampled connections, got %d and %d", report.Registered, report.Sampled)
+	}
+
+	if len(broker.pinged) != 2 {
+		t.Fatalf("Expected only the sampled clients to be pinged, got %v", broker.pinged)
+	}
+}
@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"context"
+	"errors"
+)
+
+// The errors returned by the controller package wrap one of these errors when the
+// caller needs to know what kind of failure it was.  Use errors.Is to check for them.
+var (
+	// ErrAccountNotFound means that the client's account could not be determined.  It
+	// is a genuine authentication failure so retrying does not help.
+	ErrAccountNotFound = errors.New("The client's account was not found")
+
+	// ErrRegistrationConflict means that the client is already registered
+	ErrRegistrationConflict = errors.New("The client is already registered")
+
+	// ErrDownstreamUnavailable means that a downstream service could not be reached
+	// or failed.  The failure is expected to be transient.
+	ErrDownstreamUnavailable = errors.New("A downstream service is unavailable")
+
+	// ErrClientUnreachable means that the command was delivered to the broker, but the
+	// client did not respond to it in time.  It is not returned for broker failures.
+	ErrClientUnreachable = errors.New("The client did not respond")
+
+	// ErrCapabilityNotSupported means that the client did not advertise support for the
+	// command or directive in its handshake.  Retrying does not help.
+	ErrCapabilityNotSupported = errors.New("The client does not support the command")
+)
+
+// IsTransientError determines if the operation might succeed if it is tried again later
+func IsTransientError(err error) bool {
+	return errors.Is(err, ErrDownstreamUnavailable) || errors.Is(err, context.DeadlineExceeded)
+}
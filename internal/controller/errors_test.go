@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestIsTransientError(t *testing.T) {
+	var tests = []struct {
+		err       error
+		transient bool
+	}{
+		{fmt.Errorf("%w: connection refused", ErrDownstreamUnavailable), true},
+		{fmt.Errorf("lookup failed: %w", context.DeadlineExceeded), true},
+		{ErrUnknownClientCertificate, false},
+		{DuplicateConnectionError{}, false},
+		{errors.New("something else"), false},
+	}
+
+	for _, tc := range tests {
+		if transient := IsTransientError(tc.err); transient != tc.transient {
+			t.Fatalf("Expected IsTransientError(%v) to be %t", tc.err, tc.transient)
+		}
+	}
+}
+
+func TestErrorsWrapSentinels(t *testing.T) {
+	if errors.Is(ErrUnknownClientCertificate, ErrAccountNotFound) == false {
+		t.Fatalf("Expected an unknown certificate to be an account not found error")
+	}
+
+	if errors.Is(DuplicateConnectionError{}, ErrRegistrationConflict) == false {
+		t.Fatalf("Expected a duplicate connection to be a registration conflict")
+	}
+
+	if errors.Is(sourcesStatusError(503), ErrDownstreamUnavailable) == false || errors.Is(sourcesStatusError(400), ErrDownstreamUnavailable) {
+		t.Fatalf("Expected only server errors from sources to be treated as sources being unavailable")
+	}
+}
@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+var ErrInvalidFactsEnricher = errors.New("Invalid facts enricher")
+
+// FactsEnricher allows deployment specific facts to be added to the canonical
+// facts that a client reported before the facts are recorded.  The context
+// is the one the control message is being handled with.
+type FactsEnricher interface {
+	EnrichFacts(context.Context, domain.AccountID, domain.ClientID, map[string]interface{}) map[string]interface{}
+}
+
+type NoopFactsEnricher struct {
+}
+
+func (nfe *NoopFactsEnricher) EnrichFacts(ctx context.Context, account domain.AccountID, clientID domain.ClientID, facts map[string]interface{}) map[string]interface{} {
+	return facts
+}
+
+// StaticFactsEnricher adds a fixed set of facts (region, cluster, etc) to the
+// client's facts.  The static facts take precedence over the facts reported by
+// the client.
+type StaticFactsEnricher struct {
+	StaticFacts map[string]interface{}
+}
+
+func (sfe *StaticFactsEnricher) EnrichFacts(ctx context.Context, account domain.AccountID, clientID domain.ClientID, facts map[string]interface{}) map[string]interface{} {
+	enrichedFacts := make(map[string]interface{}, len(facts)+len(sfe.StaticFacts))
+
+	for k, v := range facts {
+		enrichedFacts[k] = v
+	}
+
+	for k, v := range sfe.StaticFacts {
+		enrichedFacts[k] = v
+	}
+
+	return enrichedFacts
+}
+
+// NormalizingFactsEnricher normalizes the facts reported by the client so that
+// the same host is always reported to inventory in the same way.  The fqdn is
+// trimmed and lowercased.  The ip and mac addresses are trimmed, sorted and
+// deduplicated (mac addresses are lowercased too).  Facts that are not in the
+// expected format are left as they were reported.
+type NormalizingFactsEnricher struct {
+}
+
+func (nfe *NormalizingFactsEnricher) EnrichFacts(ctx context.Context, account domain.AccountID, clientID domain.ClientID, facts map[string]interface{}) map[string]interface{} {
+	normalizedFacts := make(map[string]interface{}, len(facts))
+
+	for k, v := range facts {
+		normalizedFacts[k] = v
+	}
+
+	if fqdn, ok := facts["fqdn"].(string); ok {
+		normalizedFacts["fqdn"] = strings.ToLower(strings.TrimSpace(fqdn))
+	}
+
+	if ipAddresses, ok := normalizeAddresses(facts["ip_addresses"], strings.TrimSpace); ok {
+		normalizedFacts["ip_addresses"] = ipAddresses
+	}
+
+	if macAddresses, ok := normalizeAddresses(facts["mac_addresses"], func(s string) string {
+		return strings.ToLower(strings.TrimSpace(s))
+	}); ok {
+		normalizedFacts["mac_addresses"] = macAddresses
+	}
+
+	return normalizedFacts
+}
+
+func normalizeAddresses(value interface{}, normalize func(string) string) ([]interface{}, bool) {
+	var addresses []string
+
+	switch v := value.(type) {
+	case []string:
+		addresses = v
+	case []interface{}:
+		addresses = make([]string, 0, len(v))
+		for _, a := range v {
+			address, ok := a.(string)
+			if ok == false {
+				return nil, false
+			}
+			addresses = append(addresses, address)
+		}
+	default:
+		return nil, false
+	}
+
+	seen := make(map[string]bool, len(addresses))
+	unique := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		address = normalize(address)
+		if address == "" || seen[address] {
+			continue
+		}
+		seen[address] = true
+		unique = append(unique, address)
+	}
+
+	sort.Strings(unique)
+
+	// Keep the same type that a json decoded handshake would have
+	normalized := make([]interface{}, len(unique))
+	for i, address := range unique {
+		normalized[i] = address
+	}
+
+	return normalized, true
+}
+
+func NewFactsEnricher(impl string, staticFacts map[string]string) (FactsEnricher, error) {
+	switch impl {
+	case "none":
+		return &NoopFactsEnricher{}, nil
+	case "static":
+		facts := make(map[string]interface{}, len(staticFacts))
+		for k, v := range staticFacts {
+			facts[k] = v
+		}
+		return &StaticFactsEnricher{StaticFacts: facts}, nil
+	case "normalize":
+		return &NormalizingFactsEnricher{}, nil
+	default:
+		return nil, ErrInvalidFactsEnricher
+	}
+}
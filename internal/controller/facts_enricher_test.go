@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestStaticFactsEnricher(t *testing.T) {
+	enricher, err := NewFactsEnricher("static", map[string]string{"region": "us-east-1", "fqdn": "static.example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected error creating the facts enricher: %s", err)
+	}
+
+	facts := map[string]interface{}{"insights_id": "1234", "fqdn": "client.example.com"}
+
+	enrichedFacts := enricher.EnrichFacts(context.TODO(), "010101", "client-1", facts)
+
+	expectedFacts := map[string]interface{}{
+		"insights_id": "1234",
+		"fqdn":        "static.example.com",
+		"region":      "us-east-1",
+	}
+
+	if reflect.DeepEqual(enrichedFacts, expectedFacts) == false {
+		t.Fatalf("Expected facts %v, but got %v", expectedFacts, enrichedFacts)
+	}
+
+	if _, exists := facts["region"]; exists {
+		t.Fatalf("Expected the client's facts to not be modified")
+	}
+}
+
+func TestNoopFactsEnricher(t *testing.T) {
+	enricher, err := NewFactsEnricher("none", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error creating the facts enricher: %s", err)
+	}
+
+	facts := map[string]interface{}{"insights_id": "1234"}
+
+	enrichedFacts := enricher.EnrichFacts(context.TODO(), "010101", "client-1", facts)
+
+	if reflect.DeepEqual(enrichedFacts, facts) == false {
+		t.Fatalf("Expected facts to be unchanged, but got %v", enrichedFacts)
+	}
+}
+
+func TestInvalidFactsEnricher(t *testing.T) {
+	_, err := NewFactsEnricher("fred", nil)
+	if err != ErrInvalidFactsEnricher {
+		t.Fatalf("Expected ErrInvalidFactsEnricher, but got %v", err)
+	}
+}
+
+func TestNormalizingFactsEnricher(t *testing.T) {
+	enricher, err := NewFactsEnricher("normalize", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error creating the facts enricher: %s", err)
+	}
+
+	facts := map[string]interface{}{
+		"insights_id":   "1234",
+		"fqdn":          "  Client.Example.COM ",
+		"ip_addresses":  []interface{}{"192.168.1.2", " 10.0.0.1", "192.168.1.2", ""},
+		"mac_addresses": []string{"AA:BB:CC:DD:EE:FF", "11:22:33:44:55:66", "aa:bb:cc:dd:ee:ff"},
+	}
+
+	enrichedFacts := enricher.EnrichFacts(context.TODO(), "010101", "client-1", facts)
+
+	expectedFacts := map[string]interface{}{
+		"insights_id":   "1234",
+		"fqdn":          "client.example.com",
+		"ip_addresses":  []interface{}{"10.0.0.1", "192.168.1.2"},
+		"mac_addresses": []interface{}{"11:22:33:44:55:66", "aa:bb:cc:dd:ee:ff"},
+	}
+
+	if reflect.DeepEqual(enrichedFacts, expectedFacts) == false {
+		t.Fatalf("Expected facts %v, but got %v", expectedFacts, enrichedFacts)
+	}
+
+	if facts["fqdn"] != "  Client.Example.COM " {
+		t.Fatalf("Expected the client's facts to not be modified")
+	}
+}
+
+func TestNormalizingFactsEnricherLeavesUnexpectedFacts(t *testing.T) {
+	enricher := &NormalizingFactsEnricher{}
+
+	facts := map[string]interface{}{
+		"fqdn":         1234,
+		"ip_addresses": []interface{}{"10.0.0.1", 42},
+	}
+
+	enrichedFacts := enricher.EnrichFacts(context.TODO(), "010101", "client-1", facts)
+
+	if reflect.DeepEqual(enrichedFacts, facts) == false {
+		t.Fatalf("Expected facts in an unexpected format to be unchanged, but got %v", enrichedFacts)
+	}
+}
@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+var ErrInvalidIdentityHeaderVersion = errors.New("Invalid identity header version")
+
+// IdentityHeaderBuilder builds the base64 encoded identity header that is sent to a
+// downstream service.  Downstream services can expect different versions of the
+// identity so the builder is selected per downstream.
+type IdentityHeaderBuilder interface {
+	BuildIdentityHeader(domain.Identity) (string, error)
+}
+
+type identityInternal struct {
+	OrgID string `json:"org_id"`
+}
+
+// IdentityHeaderV1Builder builds the original identity shape where the org id
+// is only included in the internal section
+type IdentityHeaderV1Builder struct {
+}
+
+type identityV1 struct {
+	Identity struct {
+		AccountNumber string           `json:"account_number"`
+		Type          string           `json:"type"`
+		Internal      identityInternal `json:"internal"`
+	} `json:"identity"`
+}
+
+func (b *IdentityHeaderV1Builder) BuildIdentityHeader(identity domain.Identity) (string, error) {
+	var id identityV1
+	id.Identity.AccountNumber = string(identity.AccountNumber)
+	id.Identity.Type = identity.Type
+	id.Identity.Internal.OrgID = string(identity.OrgID)
+
+	return encodeIdentityHeader(id)
+}
+
+// IdentityHeaderV2Builder builds the identity shape where the org id is the
+// primary tenant identifier and the account number is optional
+type IdentityHeaderV2Builder struct {
+}
+
+type identityV2 struct {
+	Identity struct {
+		OrgID         string           `json:"org_id"`
+		AccountNumber string           `json:"account_number,omitempty"`
+		Type          string           `json:"type"`
+		Internal      identityInternal `json:"internal"`
+	} `json:"identity"`
+}
+
+func (b *IdentityHeaderV2Builder) BuildIdentityHeader(identity domain.Identity) (string, error) {
+	var id identityV2
+	id.Identity.OrgID = string(identity.OrgID)
+	id.Identity.AccountNumber = string(identity.AccountNumber)
+	id.Identity.Type = identity.Type
+	id.Identity.Internal.OrgID = string(identity.OrgID)
+
+	return encodeIdentityHeader(id)
+}
+
+func encodeIdentityHeader(identity interface{}) (string, error) {
+	identityBytes, err := json.Marshal(identity)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(identityBytes), nil
+}
+
+func NewIdentityHeaderBuilder(version string) (IdentityHeaderBuilder, error) {
+	switch version {
+	case "v1":
+		return &IdentityHeaderV1Builder{}, nil
+	case "v2":
+		return &IdentityHeaderV2Builder{}, nil
+	default:
+		return nil, ErrInvalidIdentityHeaderVersion
+	}
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+func TestIdentityHeaderVersions(t *testing.T) {
+	identity := domain.Identity{AccountNumber: "1234", OrgID: "5678", Type: "System"}
+
+	var tests = []struct {
+		version  string
+		identity domain.Identity
+		expected string
+	}{
+		{"v1", identity, `{"identity": {"account_number": "1234", "type": "System", "internal": {"org_id": "5678"}}}`},
+		{"v2", identity, `{"identity": {"org_id": "5678", "account_number": "1234", "type": "System", "internal": {"org_id": "5678"}}}`},
+		{"v2", domain.Identity{OrgID: "5678", Type: "System"}, `{"identity": {"org_id": "5678", "type": "System", "internal": {"org_id": "5678"}}}`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.version, func(t *testing.T) {
+			builder, err := NewIdentityHeaderBuilder(tc.version)
+			if err != nil {
+				t.Fatalf("Unexpected error creating the identity header builder: %s", err)
+			}
+
+			header, err := builder.BuildIdentityHeader(tc.identity)
+			if err != nil {
+				t.Fatalf("Unexpected error building the identity header: %s", err)
+			}
+
+			decoded, err := base64.StdEncoding.DecodeString(header)
+			if err != nil {
+				t.Fatalf("Unable to decode the identity header: %s", err)
+			}
+
+			var actual, expected map[string]interface{}
+			json.Unmarshal(decoded, &actual)
+			json.Unmarshal([]byte(tc.expected), &expected)
+
+			if reflect.DeepEqual(actual, expected) == false {
+				t.Fatalf("Expected identity %v, got %v", expected, actual)
+			}
+		})
+	}
+}
+
+func TestInvalidIdentityHeaderVersion(t *testing.T) {
+	_, err := NewIdentityHeaderBuilder("v3")
+	if err != ErrInvalidIdentityHeaderVersion {
+		t.Fatalf("Expected ErrInvalidIdentityHeaderVersion, but got %v", err)
+	}
+}
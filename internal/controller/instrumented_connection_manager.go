@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+type ConnectionManager interface {
+	ConnectionRegistrar
+	ConnectionLocator
+}
+
+// InstrumentedConnectionManager records the latency and the errors of the
+// operations performed by the wrapped connection manager
+type InstrumentedConnectionManager struct {
+	wrapped ConnectionManager
+	metrics *Metrics
+}
+
+func NewInstrumentedConnectionManager(cm ConnectionManager, metrics *Metrics) *InstrumentedConnectionManager {
+	return &InstrumentedConnectionManager{wrapped: cm, metrics: metrics}
+}
+
+func (icm *InstrumentedConnectionManager) observe(operation string, start time.Time) {
+	icm.metrics.connectionManagerOperationDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+func (icm *InstrumentedConnectionManager) Register(ctx context.Context, account string, node_id string, client Receptor) error {
+	defer icm.observe("register", time.Now())
+
+	err := icm.wrapped.Register(ctx, account, node_id, client)
+	if err != nil {
+		icm.metrics.connectionManagerOperationErrorCounter.WithLabelValues("register").Inc()
+	}
+
+	return err
+}
+
+func (icm *InstrumentedConnectionManager) Unregister(ctx context.Context, account string, node_id string) {
+	defer icm.observe("unregister", time.Now())
+
+	icm.wrapped.Unregister(ctx, account, node_id)
+}
+
+func (icm *InstrumentedConnectionManager) Replace(ctx context.Context, account string, node_id string, client Receptor) error {
+	defer icm.observe("replace", time.Now())
+
+	err := icm.wrapped.Replace(ctx, account, node_id, client)
+	if err != nil {
+		icm.metrics.connectionManagerOperationErrorCounter.WithLabelValues("replace").Inc()
+	}
+
+	return err
+}
+
+func (icm *InstrumentedConnectionManager) Ping(ctx context.Context) error {
+	defer icm.observe("ping", time.Now())
+
+	err := icm.wrapped.Ping(ctx)
+	if err != nil {
+		icm.metrics.connectionManagerOperationErrorCounter.WithLabelValues("ping").Inc()
+	}
+
+	return err
+}
+
+func (icm *InstrumentedConnectionManager) FindConnection(ctx context.Context, clientID domain.ClientID) (domain.RhcClient, error) {
+	defer icm.observe("find_by_client_id", time.Now())
+
+	client, err := icm.wrapped.FindConnection(ctx, clientID)
+	if err != nil && err != ErrConnectionNotFound {
+		icm.metrics.connectionManagerOperationErrorCounter.WithLabelValues("find_by_client_id").Inc()
+	}
+
+	return client, err
+}
+
+func (icm *InstrumentedConnectionManager) FindConnectionsByAccount(ctx context.Context, account string, offset int, limit int) ([]domain.RhcClient, int, error) {
+	defer icm.observe("find_page_by_account", time.Now())
+
+	clients, total, err := icm.wrapped.FindConnectionsByAccount(ctx, account, offset, limit)
+	if err != nil {
+		icm.metrics.connectionManagerOperationErrorCounter.WithLabelValues("find_page_by_account").Inc()
+	}
+
+	return clients, total, err
+}
+
+func (icm *InstrumentedConnectionManager) CountConnections(ctx context.Context) (int, error) {
+	defer icm.observe("count", time.Now())
+
+	count, err := icm.wrapped.CountConnections(ctx)
+	if err != nil {
+		icm.metrics.connectionManagerOperationErrorCounter.WithLabelValues("count").Inc()
+	}
+
+	return count, err
+}
+
+func (icm *InstrumentedConnectionManager) UpdateLastSeen(ctx context.Context, clientID domain.ClientID, seenAt time.Time) error {
+	defer icm.observe("update_last_seen", time.Now())
+
+	err := icm.wrapped.UpdateLastSeen(ctx, clientID, seenAt)
+	if err != nil && err != ErrConnectionNotFound {
+		icm.metrics.connectionManagerOperationErrorCounter.WithLabelValues("update_last_seen").Inc()
+	}
+
+	return err
+}
+
+func (icm *InstrumentedConnectionManager) FindStaleConnections(ctx context.Context, seenBefore time.Time) ([]domain.RhcClient, error) {
+	defer icm.observe("find_stale", time.Now())
+
+	clients, err := icm.wrapped.FindStaleConnections(ctx, seenBefore)
+	if err != nil {
+		icm.metrics.connectionManagerOperationErrorCounter.WithLabelValues("find_stale").Inc()
+	}
+
+	return clients, err
+}
+
+func (icm *InstrumentedConnectionManager) GetConnection(ctx context.Context, account string, node_id string) Receptor {
+	defer icm.observe("find", time.Now())
+
+	return icm.wrapped.GetConnection(ctx, account, node_id)
+}
+
+func (icm *InstrumentedConnectionManager) GetConnectionsByAccount(ctx context.Context, account string) map[string]Receptor {
+	defer icm.observe("find_by_account", time.Now())
+
+	return icm.wrapped.GetConnectionsByAccount(ctx, account)
+}
+
+func (icm *InstrumentedConnectionManager) GetAllConnections(ctx context.Context) map[string]map[string]Receptor {
+	defer icm.observe("find_all", time.Now())
+
+	return icm.wrapped.GetAllConnections(ctx)
+}
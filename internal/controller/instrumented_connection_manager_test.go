@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func operationCount(t *testing.T, operation string) uint64 {
+	var m dto.Metric
+	histogram := metrics.connectionManagerOperationDuration.WithLabelValues(operation).(prometheus.Metric)
+	if err := histogram.Write(&m); err != nil {
+		t.Fatalf("Unable to read the operation duration metric: %s", err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestInstrumentedRegisterSuccess(t *testing.T) {
+	icm := NewInstrumentedConnectionManager(NewLocalConnectionManager(), metrics)
+
+	registerCount := operationCount(t, "register")
+	registerErrors := testutil.ToFloat64(metrics.connectionManagerOperationErrorCounter.WithLabelValues("register"))
+
+	if err := icm.Register(context.TODO(), "1234", "345", &MockReceptor{}); err != nil {
+		t.Fatalf("Unexpected error registering the connection: %s", err)
+	}
+
+	if operationCount(t, "register") != registerCount+1 {
+		t.Fatalf("Expected the register operation to be observed")
+	}
+
+	if testutil.ToFloat64(metrics.connectionManagerOperationErrorCounter.WithLabelValues("register")) != registerErrors {
+		t.Fatalf("Expected the register error count to be unchanged")
+	}
+
+	findCount := operationCount(t, "find")
+
+	if icm.GetConnection(context.TODO(), "1234", "345") == nil {
+		t.Fatalf("Expected to find the registered connection")
+	}
+
+	if operationCount(t, "find") != findCount+1 {
+		t.Fatalf("Expected the find operation to be observed")
+	}
+}
+
+func TestInstrumentedRegisterFailure(t *testing.T) {
+	icm := NewInstrumentedConnectionManager(NewLocalConnectionManager(), metrics)
+
+	icm.Register(context.TODO(), "1234", "345", &MockReceptor{})
+
+	registerCount := operationCount(t, "register")
+	registerErrors := testutil.ToFloat64(metrics.connectionManagerOperationErrorCounter.WithLabelValues("register"))
+
+	if err := icm.Register(context.TODO(), "1234", "345", &MockReceptor{}); err == nil {
+		t.Fatalf("Expected an error registering a duplicate connection")
+	}
+
+	if operationCount(t, "register") != registerCount+1 {
+		t.Fatalf("Expected the failed register operation to be observed")
+	}
+
+	if testutil.ToFloat64(metrics.connectionManagerOperationErrorCounter.WithLabelValues("register")) != registerErrors+1 {
+		t.Fatalf("Expected the register error count to be incremented")
+	}
+}
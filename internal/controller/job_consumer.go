@@ -0,0 +1,260 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/queue"
+
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	jobResponseNotDelivered = "not_delivered"
+)
+
+var ErrInvalidJobMessage = errors.New("Invalid job message")
+
+// JobMessage is the work that is read from the jobs topic and sent to the recipient
+type JobMessage struct {
+	MessageID string           `json:"message_id"`
+	Account   domain.AccountID `json:"account"`
+	Recipient domain.ClientID  `json:"recipient"`
+	Directive string           `json:"directive"`
+	Payload   interface{}      `json:"payload"`
+}
+
+// JobResponse is written to the responses topic when a job could not be delivered
+type JobResponse struct {
+	InResponseTo string           `json:"in_response_to"`
+	Account      domain.AccountID `json:"account"`
+	Recipient    domain.ClientID  `json:"recipient"`
+	Status       string           `json:"status"`
+	Detail       string           `json:"detail"`
+}
+
+// JobConsumer reads jobs from the jobs topic and sends them to the connected clients
+// as data messages.  A job's offset is only committed once the job has been published
+// to the client or a non-delivery response has been written.  The sender must publish
+// with QoS 1 and wait for the broker's acknowledgement, otherwise a job could be
+// committed before it reached the broker.
+//
+// A job that could not be sent after maxAttempts attempts is answered with a
+// non-delivery response so that one unreachable recipient cannot stall the topic.
+type JobConsumer struct {
+	reader            queue.Reader
+	connectionLocator ConnectionLocator
+	sender            DataMessageSender
+	responseWriter    queue.Writer
+	defaultDirective  string
+	sendTimeout       time.Duration
+	retryInterval     time.Duration
+	maxAttempts       int
+	maxValueSize      int
+	metrics           *Metrics
+	cancel            context.CancelFunc
+	done              sync.WaitGroup
+}
+
+func NewJobConsumer(reader queue.Reader, cl ConnectionLocator, sender DataMessageSender, responseWriter queue.Writer, defaultDirective string, sendTimeout time.Duration, retryInterval time.Duration, maxAttempts int, maxValueSize int, metrics *Metrics) *JobConsumer {
+	return &JobConsumer{
+		reader:            reader,
+		connectionLocator: cl,
+		sender:            sender,
+		responseWriter:    responseWriter,
+		defaultDirective:  defaultDirective,
+		sendTimeout:       sendTimeout,
+		retryInterval:     retryInterval,
+		maxAttempts:       maxAttempts,
+		maxValueSize:      maxValueSize,
+		metrics:           metrics,
+	}
+}
+
+func (jc *JobConsumer) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	jc.cancel = cancel
+
+	jc.done.Add(1)
+	go func() {
+		defer jc.done.Done()
+
+		for {
+			msg, err := jc.reader.FetchMessage(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+
+				logger.Log.WithFields(logrus.Fields{"error": err}).Error("Unable to read from the jobs topic")
+				if jc.wait(ctx) == false {
+					return
+				}
+				continue
+			}
+
+			if jc.processUntilHandled(ctx, msg) == false {
+				return
+			}
+
+			if err := jc.reader.CommitMessages(ctx, msg); err != nil {
+				logger.Log.WithFields(logrus.Fields{"error": err, "offset": msg.Offset}).Error("Unable to commit the job's offset")
+			}
+		}
+	}()
+}
+
+// Stop stops reading jobs and waits for the job that is being processed to finish.
+// A job that has not been published when the consumer is stopped is not committed.
+func (jc *JobConsumer) Stop() {
+	jc.cancel()
+	jc.done.Wait()
+}
+
+// processUntilHandled retries the job until it has been handled.  false is returned if
+// the consumer was stopped before the job could be handled.
+func (jc *JobConsumer) processUntilHandled(ctx context.Context, msg kafka.Message) bool {
+	for attempt := 1; ; attempt++ {
+		err := jc.process(ctx, msg, attempt >= jc.maxAttempts)
+		if err == nil {
+			return true
+		}
+
+		if ctx.Err() != nil {
+			return false
+		}
+
+		logger.Log.WithFields(logrus.Fields{"error": err, "offset": msg.Offset}).Warn("Unable to handle the job, retrying")
+
+		if jc.wait(ctx) == false {
+			return false
+		}
+	}
+}
+
+// process sends the job to its recipient.  An error is only returned if processing the
+// job should be retried.  A non-delivery response is written instead of retrying a
+// failed send when lastAttempt is true.
+func (jc *JobConsumer) process(ctx context.Context, msg kafka.Message, lastAttempt bool) error {
+	job, err := jc.parseJob(msg)
+	if err != nil {
+		// Retrying will not fix a malformed job so skip it
+		logger.Log.WithFields(logrus.Fields{"error": err, "offset": msg.Offset}).Warn("Skipping an invalid job")
+		jc.metrics.jobCounter.WithLabelValues("invalid").Inc()
+		return nil
+	}
+
+	logger := logger.Log.WithFields(logrus.Fields{"message_id": job.MessageID, "account": job.Account, "client_id": job.Recipient})
+
+	if jc.connectionLocator.GetConnection(ctx, string(job.Account), string(job.Recipient)) == nil {
+		logger.Info("Recipient of the job is not connected")
+		if err := jc.writeNotDeliveredResponse(ctx, job, "The recipient is not connected"); err != nil {
+			return err
+		}
+		jc.metrics.jobCounter.WithLabelValues(jobResponseNotDelivered).Inc()
+		return nil
+	}
+
+	directive := job.Directive
+	if directive == "" {
+		directive = jc.defaultDirective
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, jc.sendTimeout)
+	defer cancel()
+
+	messageID, err := jc.sender.SendDataMessage(sendCtx, job.Recipient, directive, job.Payload)
+	if tooLarge, isTooLarge := err.(*MessageTooLargeError); isTooLarge {
+		// Retrying will not make the job any smaller
+		logger.Info("Job is too large to send to the recipient")
+		if err := jc.writeNotDeliveredResponse(ctx, job, tooLarge.Error()); err != nil {
+			return err
+		}
+		jc.metrics.jobCounter.WithLabelValues(jobResponseNotDelivered).Inc()
+		return nil
+	} else if errors.Is(err, ErrCapabilityNotSupported) {
+		// Retrying will not make the recipient support the directive
+		logger.WithFields(logrus.Fields{"directive": directive}).Info("Recipient of the job does not support the directive")
+		if err := jc.writeNotDeliveredResponse(ctx, job, err.Error()); err != nil {
+			return err
+		}
+		jc.metrics.jobCounter.WithLabelValues(jobResponseNotDelivered).Inc()
+		return nil
+	} else if err != nil && lastAttempt && ctx.Err() == nil {
+		logger.WithFields(logrus.Fields{"error": err}).Warn("Giving up on sending the job to the recipient")
+		jc.metrics.jobCounter.WithLabelValues("failed").Inc()
+		if err := jc.writeNotDeliveredResponse(ctx, job, "Unable to send the job to the recipient: "+err.Error()); err != nil {
+			return err
+		}
+		jc.metrics.jobCounter.WithLabelValues(jobResponseNotDelivered).Inc()
+		return nil
+	} else if err != nil {
+		jc.metrics.jobCounter.WithLabelValues("failed").Inc()
+		return err
+	}
+
+	logger.WithFields(logrus.Fields{"data_message_id": messageID}).Debug("Sent the job to the recipient")
+	jc.metrics.jobCounter.WithLabelValues("delivered").Inc()
+
+	return nil
+}
+
+// parseJob decompresses the job if it was written compressed and parses it
+func (jc *JobConsumer) parseJob(msg kafka.Message) (*JobMessage, error) {
+	value, err := queue.DecompressValue(msg, jc.maxValueSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseJobMessage(value)
+}
+
+func (jc *JobConsumer) writeNotDeliveredResponse(ctx context.Context, job *JobMessage, detail string) error {
+	response := JobResponse{
+		InResponseTo: job.MessageID,
+		Account:      job.Account,
+		Recipient:    job.Recipient,
+		Status:       jobResponseNotDelivered,
+		Detail:       detail,
+	}
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	return jc.responseWriter.WriteMessages(ctx, kafka.Message{Key: []byte(job.Recipient), Value: responseBytes})
+}
+
+// wait sleeps for the retry interval.  false is returned if the consumer was stopped.
+func (jc *JobConsumer) wait(ctx context.Context) bool {
+	timer := time.NewTimer(jc.retryInterval)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func parseJobMessage(value []byte) (*JobMessage, error) {
+	var job JobMessage
+
+	if err := json.Unmarshal(value, &job); err != nil {
+		return nil, err
+	}
+
+	if job.MessageID == "" || job.Account == "" || job.Recipient == "" || job.Payload == nil {
+		return nil, ErrInvalidJobMessage
+	}
+
+	return &job, nil
+}
@@ -0,0 +1,324 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/queue"
+
+	"github.com/google/uuid"
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// fakeJobReader hands out the queued messages and records the committed offsets
+type fakeJobReader struct {
+	messages  chan kafka.Message
+	committed []int64
+	sync.Mutex
+}
+
+func newFakeJobReader(values ...string) *fakeJobReader {
+	reader := &fakeJobReader{messages: make(chan kafka.Message, len(values))}
+	for i, value := range values {
+		reader.messages <- kafka.Message{Offset: int64(i), Value: []byte(value)}
+	}
+	return reader
+}
+
+func (fjr *fakeJobReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case msg := <-fjr.messages:
+		return msg, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+func (fjr *fakeJobReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	fjr.Lock()
+	defer fjr.Unlock()
+	for _, msg := range msgs {
+		fjr.committed = append(fjr.committed, msg.Offset)
+	}
+	return nil
+}
+
+func (fjr *fakeJobReader) committedOffsets() []int64 {
+	fjr.Lock()
+	defer fjr.Unlock()
+	return append([]int64{}, fjr.committed...)
+}
+
+type sentDataMessage struct {
+	clientID  domain.ClientID
+	directive string
+	payload   interface{}
+}
+
+// flakyDataMessageSender fails the first failures sends and records the rest
+type flakyDataMessageSender struct {
+	failures int
+	sent     []sentDataMessage
+	sync.Mutex
+}
+
+func (fdms *flakyDataMessageSender) SendDataMessage(ctx context.Context, clientID domain.ClientID, directive string, payload interface{}) (*uuid.UUID, error) {
+	fdms.Lock()
+	defer fdms.Unlock()
+
+	if fdms.failures > 0 {
+		fdms.failures--
+		return nil, errors.New("publish failed")
+	}
+
+	fdms.sent = append(fdms.sent, sentDataMessage{clientID, directive, payload})
+	messageID := uuid.New()
+	return &messageID, nil
+}
+
+func (fdms *flakyDataMessageSender) sentMessages() []sentDataMessage {
+	fdms.Lock()
+	defer fdms.Unlock()
+	return append([]sentDataMessage{}, fdms.sent...)
+}
+
+func waitForCommits(t *testing.T, reader *fakeJobReader, count int) []int64 {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if committed := reader.committedOffsets(); len(committed) >= count {
+			return committed
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Expected %d commits, got %v", count, reader.committedOffsets())
+	return nil
+}
+
+func TestJobConsumerSendsJobsToConnectedClients(t *testing.T) {
+	cm := NewLocalConnectionManager()
+	cm.Register(context.TODO(), "1234", "client-1", &MockReceptor{})
+
+	reader := newFakeJobReader(`{"message_id": "job-1", "account": "1234", "recipient": "client-1", "directive": "playbook", "payload": "run"}`,
+		`{"message_id": "job-2", "account": "1234", "recipient": "client-1", "payload": {"a": 1}}`)
+	sender := &flakyDataMessageSender{}
+	writer := &recordingWriter{}
+
+	consumer := NewJobConsumer(reader, cm, sender, writer, "default-directive", time.Second, time.Millisecond, 5, 1048576, metrics)
+	consumer.Start()
+	defer consumer.Stop()
+
+	waitForCommits(t, reader, 2)
+
+	sent := sender.sentMessages()
+	if len(sent) != 2 {
+		t.Fatalf("Expected 2 data messages, got %d", len(sent))
+	}
+
+	if sent[0].clientID != "client-1" || sent[0].directive != "playbook" || sent[0].payload != "run" {
+		t.Fatalf("Unexpected data message: %+v", sent[0])
+	}
+
+	if sent[1].directive != "default-directive" {
+		t.Fatalf("Expected the default directive to be used, got %q", sent[1].directive)
+	}
+
+	if writer.count() != 0 {
+		t.Fatalf("Expected no responses for delivered jobs, got %d", writer.count())
+	}
+}
+
+func TestJobConsumerDecompressesJobs(t *testing.T) {
+	cm := NewLocalConnectionManager()
+	cm.Register(context.TODO(), "1234", "client-1", &MockReceptor{})
+
+	compressed := &recordingWriter{}
+	queue.NewCompressingWriter(compressed, 0).WriteMessages(context.TODO(),
+		kafka.Message{Value: []byte(`{"message_id": "job-1", "account": "1234", "recipient": "client-1", "directive": "playbook", "payload": "run"}`)})
+
+	reader := &fakeJobReader{messages: make(chan kafka.Message, 1)}
+	reader.messages <- compressed.messages[0]
+
+	sender := &flakyDataMessageSender{}
+
+	consumer := NewJobConsumer(reader, cm, sender, &recordingWriter{}, "", time.Second, time.Millisecond, 5, 1048576, metrics)
+	consumer.Start()
+	defer consumer.Stop()
+
+	waitForCommits(t, reader, 1)
+
+	if sent := sender.sentMessages(); len(sent) != 1 || sent[0].payload != "run" {
+		t.Fatalf("Expected the decompressed job to be sent, got %+v", sent)
+	}
+}
+
+func TestJobConsumerRespondsWhenTheClientIsNotConnected(t *testing.T) {
+	cm := NewLocalConnectionManager()
+	cm.Register(context.TODO(), "5678", "client-1", &MockReceptor{})
+
+	// The client is connected, but not as part of the job's account
+	reader := newFakeJobReader(`{"message_id": "job-1", "account": "1234", "recipient": "client-1", "payload": "run"}`)
+	sender := &flakyDataMessageSender{}
+	writer := &recordingWriter{}
+
+	consumer := NewJobConsumer(reader, cm, sender, writer, "", time.Second, time.Millisecond, 5, 1048576, metrics)
+	consumer.Start()
+	defer consumer.Stop()
+
+	waitForCommits(t, reader, 1)
+
+	if len(sender.sentMessages()) != 0 {
+		t.Fatal("Expected the job to not be sent")
+	}
+
+	if writer.count() != 1 {
+		t.Fatalf("Expected a non-delivery response, got %d responses", writer.count())
+	}
+
+	var response JobResponse
+	if err := json.Unmarshal(writer.messages[0].Value, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.InResponseTo != "job-1" || response.Status != jobResponseNotDelivered || response.Recipient != "client-1" {
+		t.Fatalf("Unexpected response: %+v", response)
+	}
+}
+
+func TestJobConsumerRetriesFailedPublishesBeforeCommitting(t *testing.T) {
+	cm := NewLocalConnectionManager()
+	cm.Register(context.TODO(), "1234", "client-1", &MockReceptor{})
+
+	reader := newFakeJobReader(`{"message_id": "job-1", "account": "1234", "recipient": "client-1", "payload": "run"}`)
+	sender := &flakyDataMessageSender{failures: 2}
+
+	consumer := NewJobConsumer(reader, cm, sender, &recordingWriter{}, "", time.Second, time.Millisecond, 5, 1048576, metrics)
+	consumer.Start()
+	defer consumer.Stop()
+
+	waitForCommits(t, reader, 1)
+
+	if len(sender.sentMessages()) != 1 {
+		t.Fatalf("Expected the job to be sent once the publish succeeded, got %d", len(sender.sentMessages()))
+	}
+}
+
+func TestJobConsumerRespondsAfterTheMaxAttempts(t *testing.T) {
+	cm := NewLocalConnectionManager()
+	cm.Register(context.TODO(), "1234", "client-1", &MockReceptor{})
+
+	reader := newFakeJobReader(`{"message_id": "job-1", "account": "1234", "recipient": "client-1", "payload": "run"}`,
+		`{"message_id": "job-2", "account": "1234", "recipient": "client-1", "payload": "run"}`)
+	sender := &flakyDataMessageSender{failures: 3}
+	writer := &recordingWriter{}
+
+	consumer := NewJobConsumer(reader, cm, sender, writer, "", time.Second, time.Millisecond, 3, 1048576, metrics)
+	consumer.Start()
+	defer consumer.Stop()
+
+	waitForCommits(t, reader, 2)
+
+	if writer.count() != 1 {
+		t.Fatalf("Expected a non-delivery response for the first job, got %d responses", writer.count())
+	}
+
+	var response JobResponse
+	if err := json.Unmarshal(writer.messages[0].Value, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.InResponseTo != "job-1" || response.Status != jobResponseNotDelivered {
+		t.Fatalf("Unexpected response: %+v", response)
+	}
+
+	if len(sender.sentMessages()) != 1 {
+		t.Fatalf("Expected the second job to be sent, got %d", len(sender.sentMessages()))
+	}
+}
+
+func TestJobConsumerDoesNotCommitUnpublishedJobsOnStop(t *testing.T) {
+	cm := NewLocalConnectionManager()
+	cm.Register(context.TODO(), "1234", "client-1", &MockReceptor{})
+
+	reader := newFakeJobReader(`{"message_id": "job-1", "account": "1234", "recipient": "client-1", "payload": "run"}`)
+	sender := &flakyDataMessageSender{failures: 1000000}
+
+	consumer := NewJobConsumer(reader, cm, sender, &recordingWriter{}, "", time.Second, time.Millisecond, 1000, 1048576, metrics)
+	consumer.Start()
+	time.Sleep(10 * time.Millisecond)
+	consumer.Stop()
+
+	if len(reader.committedOffsets()) != 0 {
+		t.Fatalf("Expected the unpublished job to not be committed, got %v", reader.committedOffsets())
+	}
+}
+
+func TestJobConsumerSkipsInvalidJobs(t *testing.T) {
+	reader := newFakeJobReader(`not json`, `{"message_id": "job-1", "account": "1234", "payload": "run"}`)
+	sender := &flakyDataMessageSender{}
+	writer := &recordingWriter{}
+
+	consumer := NewJobConsumer(reader, NewLocalConnectionManager(), sender, writer, "", time.Second, time.Millisecond, 5, 1048576, metrics)
+	consumer.Start()
+	defer consumer.Stop()
+
+	waitForCommits(t, reader, 2)
+
+	if len(sender.sentMessages()) != 0 || writer.count() != 0 {
+		t.Fatal("Expected the invalid jobs to be skipped")
+	}
+}
+
+// tooLargeDataMessageSender rejects every message
+type tooLargeDataMessageSender struct{}
+
+func (s *tooLargeDataMessageSender) SendDataMessage(ctx context.Context, clientID domain.ClientID, directive string, payload interface{}) (*uuid.UUID, error) {
+	return nil, &MessageTooLargeError{Directive: directive, Size: 100, Limit: 10}
+}
+
+func TestJobConsumerRespondsWhenTheJobIsTooLarge(t *testing.T) {
+	cm := NewLocalConnectionManager()
+	cm.Register(context.TODO(), "1234", "client-1", &MockReceptor{})
+
+	reader := newFakeJobReader(`{"message_id": "job-1", "account": "1234", "recipient": "client-1", "payload": "run"}`)
+	writer := &recordingWriter{}
+
+	consumer := NewJobConsumer(reader, cm, &tooLargeDataMessageSender{}, writer, "", time.Second, time.Millisecond, 5, 1048576, metrics)
+	consumer.Start()
+	defer consumer.Stop()
+
+	waitForCommits(t, reader, 1)
+
+	if writer.count() != 1 {
+		t.Fatalf("Expected a non-delivery response, got %d responses", writer.count())
+	}
+}
+
+type unsupportedDirectiveDataMessageSender struct{}
+
+func (s *unsupportedDirectiveDataMessageSender) SendDataMessage(ctx context.Context, clientID domain.ClientID, directive string, payload interface{}) (*uuid.UUID, error) {
+	return nil, fmt.Errorf("%w: %s does not support %s", ErrCapabilityNotSupported, clientID, directive)
+}
+
+func TestJobConsumerRespondsWhenTheDirectiveIsNotSupported(t *testing.T) {
+	cm := NewLocalConnectionManager()
+	cm.Register(context.TODO(), "1234", "client-1", &MockReceptor{})
+
+	reader := newFakeJobReader(`{"message_id": "job-1", "account": "1234", "recipient": "client-1", "payload": "run"}`)
+	writer := &recordingWriter{}
+
+	consumer := NewJobConsumer(reader, cm, &unsupportedDirectiveDataMessageSender{}, writer, "", time.Second, time.Millisecond, 5, 1048576, metrics)
+	consumer.Start()
+	defer consumer.Stop()
+
+	waitForCommits(t, reader, 1)
+
+	if writer.count() != 1 {
+		t.Fatalf("Expected a non-delivery response, got %d responses", writer.count())
+	}
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+type ClientError struct {
+	Reason    string    `json:"reason"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// LastErrorTracker keeps track of the most recent handshake / registration failure
+// for each client.  The number of clients tracked is bounded by maxClients (the oldest
+// entry is evicted when the limit is reached) and entries expire after the ttl.
+type LastErrorTracker struct {
+	lastErrors map[domain.ClientID]ClientError
+	maxClients int
+	ttl        time.Duration
+	sync.Mutex
+}
+
+func NewLastErrorTracker(maxClients int, ttl time.Duration) *LastErrorTracker {
+	return &LastErrorTracker{
+		lastErrors: make(map[domain.ClientID]ClientError),
+		maxClients: maxClients,
+		ttl:        ttl,
+	}
+}
+
+func (let *LastErrorTracker) RecordError(clientID domain.ClientID, reason string) {
+	let.Lock()
+	defer let.Unlock()
+
+	if let.maxClients <= 0 {
+		return
+	}
+
+	_, exists := let.lastErrors[clientID]
+	if exists == false && len(let.lastErrors) >= let.maxClients {
+		let.evictOldest()
+	}
+
+	let.lastErrors[clientID] = ClientError{Reason: reason, Timestamp: time.Now()}
+}
+
+func (let *LastErrorTracker) ClearError(clientID domain.ClientID) {
+	let.Lock()
+	defer let.Unlock()
+
+	delete(let.lastErrors, clientID)
+}
+
+func (let *LastErrorTracker) GetLastError(clientID domain.ClientID) *ClientError {
+	let.Lock()
+	defer let.Unlock()
+
+	lastError, exists := let.lastErrors[clientID]
+	if exists == false {
+		return nil
+	}
+
+	if time.Since(lastError.Timestamp) > let.ttl {
+		delete(let.lastErrors, clientID)
+		return nil
+	}
+
+	return &lastError
+}
+
+func (let *LastErrorTracker) evictOldest() {
+	var oldestClientID domain.ClientID
+	var oldestTimestamp time.Time
+
+	for clientID, lastError := range let.lastErrors {
+		if oldestTimestamp.IsZero() || lastError.Timestamp.Before(oldestTimestamp) {
+			oldestClientID = clientID
+			oldestTimestamp = lastError.Timestamp
+		}
+	}
+
+	delete(let.lastErrors, oldestClientID)
+}
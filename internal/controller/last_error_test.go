@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+func TestRecordAndGetLastError(t *testing.T) {
+	let := NewLastErrorTracker(10, time.Minute)
+	let.RecordError("client-1", "first failure")
+	let.RecordError("client-1", "second failure")
+
+	lastError := let.GetLastError("client-1")
+	if lastError == nil {
+		t.Fatalf("Expected to find the last error, but did not find it")
+	}
+
+	if lastError.Reason != "second failure" {
+		t.Fatalf("Expected the most recent error to be returned, but got %s", lastError.Reason)
+	}
+
+	if let.GetLastError("client-2") != nil {
+		t.Fatalf("Expected to not find an error for a client without errors")
+	}
+}
+
+func TestClearLastError(t *testing.T) {
+	let := NewLastErrorTracker(10, time.Minute)
+	let.RecordError("client-1", "failure")
+	let.ClearError("client-1")
+
+	if let.GetLastError("client-1") != nil {
+		t.Fatalf("Expected the last error to have been cleared")
+	}
+}
+
+func TestLastErrorExpires(t *testing.T) {
+	let := NewLastErrorTracker(10, time.Minute)
+	let.RecordError("client-1", "failure")
+	let.lastErrors["client-1"] = ClientError{Reason: "failure", Timestamp: time.Now().Add(-2 * time.Minute)}
+
+	if let.GetLastError("client-1") != nil {
+		t.Fatalf("Expected the last error to have expired")
+	}
+}
+
+func TestLastErrorTrackerIsBounded(t *testing.T) {
+	let := NewLastErrorTracker(2, time.Minute)
+	for _, clientID := range []domain.ClientID{"client-1", "client-2", "client-3"} {
+		let.RecordError(clientID, "failure")
+		time.Sleep(time.Millisecond)
+	}
+
+	if len(let.lastErrors) != 2 {
+		t.Fatalf("Expected 2 errors to be tracked, but %d errors are tracked", len(let.lastErrors))
+	}
+
+	if let.GetLastError("client-1") != nil {
+		t.Fatalf("Expected the oldest error to have been evicted")
+	}
+
+	if let.GetLastError("client-3") == nil {
+		t.Fatalf("Expected the newest error to be tracked")
+	}
+}
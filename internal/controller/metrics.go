@@ -6,44 +6,102 @@ import (
 )
 
 type Metrics struct {
-	responseKafkaWriterGoRoutineGauge prometheus.Gauge
-	responseKafkaWriterSuccessCounter prometheus.Counter
-	responseKafkaWriterFailureCounter prometheus.Counter
-	messageDirectiveCounter           *prometheus.CounterVec
-	redisConnectionError              prometheus.Counter
+	responseKafkaWriterGoRoutineGauge      prometheus.Gauge
+	responseKafkaWriterSuccessCounter      prometheus.Counter
+	responseKafkaWriterFailureCounter      prometheus.Counter
+	messageDirectiveCounter                *prometheus.CounterVec
+	redisConnectionError                   prometheus.Counter
+	connectionManagerOperationDuration     *prometheus.HistogramVec
+	connectionManagerOperationErrorCounter *prometheus.CounterVec
+	webhookEventCounter                    *prometheus.CounterVec
+	connectionQuotaRejectionCounter        *prometheus.CounterVec
+	consistencyCheckInconsistencyCounter   *prometheus.CounterVec
+	accountResolverCacheCounter            *prometheus.CounterVec
+	jobCounter                             *prometheus.CounterVec
+	sourcesRequestCounter                  *prometheus.CounterVec
+	connectedClientsGauge                  prometheus.Gauge
+	reapedConnectionCounter                prometheus.Counter
 }
 
-func NewMetrics() *Metrics {
+// NewMetrics creates the metrics and registers them with reg
+func NewMetrics(reg prometheus.Registerer) *Metrics {
 	metrics := new(Metrics)
+	factory := promauto.With(reg)
 
-	metrics.responseKafkaWriterGoRoutineGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	metrics.responseKafkaWriterGoRoutineGauge = factory.NewGauge(prometheus.GaugeOpts{
 		Name: "cloud_connector_kafka_response_writer_go_routine_count",
 		Help: "The total number of active kakfa response writer go routines",
 	})
 
-	metrics.responseKafkaWriterSuccessCounter = promauto.NewCounter(prometheus.CounterOpts{
+	metrics.responseKafkaWriterSuccessCounter = factory.NewCounter(prometheus.CounterOpts{
 		Name: "cloud_connector_kafka_response_writer_success_count",
 		Help: "The number of responses were sent to the kafka topic",
 	})
 
-	metrics.responseKafkaWriterFailureCounter = promauto.NewCounter(prometheus.CounterOpts{
+	metrics.responseKafkaWriterFailureCounter = factory.NewCounter(prometheus.CounterOpts{
 		Name: "cloud_connector_kafka_response_writer_failure_count",
 		Help: "The number of responses that failed to get produced to kafka topic",
 	})
 
-	metrics.redisConnectionError = promauto.NewCounter(prometheus.CounterOpts{
+	metrics.redisConnectionError = factory.NewCounter(prometheus.CounterOpts{
 		Name: "cloud_connector_redis_connection_error_count",
 		Help: "The number of times a redis connection error has occurred",
 	})
 
-	metrics.messageDirectiveCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	metrics.messageDirectiveCounter = factory.NewCounterVec(prometheus.CounterOpts{
 		Name: "cloud_connector_message_directive_count",
 		Help: "The number of messages recieved by the receptor controller per directive",
 	}, []string{"directive"})
 
+	metrics.connectionManagerOperationDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "cloud_connector_connection_manager_operation_duration_seconds",
+		Help: "The amount of time the connection manager operations took",
+	}, []string{"operation"})
+
+	metrics.connectionManagerOperationErrorCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_connection_manager_operation_error_count",
+		Help: "The number of connection manager operations that failed",
+	}, []string{"operation"})
+
+	metrics.webhookEventCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_webhook_connection_event_count",
+		Help: "The number of connection events handled by the webhook publisher",
+	}, []string{"result"})
+
+	metrics.connectionQuotaRejectionCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_connection_quota_rejection_count",
+		Help: "The number of broker connections rejected because a connection quota was exceeded",
+	}, []string{"reason"})
+
+	metrics.consistencyCheckInconsistencyCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_consistency_check_inconsistency_count",
+		Help: "The number of inconsistent connection registrations found by the consistency checker",
+	}, []string{"kind", "repaired"})
+
+	metrics.accountResolverCacheCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_account_resolver_cache_count",
+		Help: "The number of account lookups that were found (hit) or not found (miss) in the cache",
+	}, []string{"result"})
+
+	metrics.jobCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_job_count",
+		Help: "The number of jobs read from the jobs topic by outcome",
+	}, []string{"outcome"})
+
+	metrics.sourcesRequestCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_sources_request_count",
+		Help: "The number of registrations and unregistrations sent to the sources service by result",
+	}, []string{"operation", "result"})
+
+	metrics.connectedClientsGauge = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "cloud_connector_connected_clients",
+		Help: "The number of clients connected across all of the accounts",
+	})
+
+	metrics.reapedConnectionCounter = factory.NewCounter(prometheus.CounterOpts{
+		Name: "cloud_connector_reaped_connection_count",
+		Help: "The number of stale connections that were unregistered because the client had not been seen within the ttl",
+	})
+
 	return metrics
 }
-
-var (
-	metrics = NewMetrics()
-)
@@ -0,0 +1,9 @@
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metrics is the instance that the tests pass to the controller types.  It is
+// registered with its own registry so that the tests do not share the default one.
+var metrics = NewMetrics(prometheus.NewRegistry())
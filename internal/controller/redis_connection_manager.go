@@ -0,0 +1,504 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/go-redis/redis"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	redisConnectionKeyPrefix = "cloud-connector:connection:"
+	redisAccountKeyPrefix    = "cloud-connector:account:"
+
+	redisAccountField  = "account"
+	redisDetailsField  = "details"
+	redisLastSeenField = "last_seen"
+)
+
+// RedisConnectionManager keeps the connection registrations in redis so that every
+// cloud-connector instance sees the same connections.  Each connection is stored as a
+// hash (keyed by client id) holding the account, the details that the client reported
+// and when the client was last seen.  The connections of an account are indexed by a
+// set of client ids.
+//
+// The hash expires after the ttl unless it is refreshed by UpdateLastSeen.  This keeps
+// connections that were never unregistered (an instance that crashed, for example) from
+// living forever.
+//
+// Receptors cannot be stored in redis, so the connection locator methods create them
+// with the receptor factory.  A connection is left out when the factory does not
+// create a receptor for it.
+type RedisConnectionManager struct {
+	client          *redis.Client
+	ttl             time.Duration
+	receptorFactory ReceptorFactory
+	metrics         *Metrics
+}
+
+func NewRedisClient(addr string, password string, db int) *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       db,
+	})
+}
+
+func NewRedisConnectionManager(client *redis.Client, ttl time.Duration, receptorFactory ReceptorFactory, metrics *Metrics) (*RedisConnectionManager, error) {
+	if receptorFactory == nil {
+		return nil, ErrReceptorFactoryRequired
+	}
+
+	return &RedisConnectionManager{
+		client:          client,
+		ttl:             ttl,
+		receptorFactory: receptorFactory,
+		metrics:         metrics,
+	}, nil
+}
+
+func redisConnectionKey(clientID string) string {
+	return redisConnectionKeyPrefix + clientID
+}
+
+func redisAccountKey(account string) string {
+	return redisAccountKeyPrefix + account
+}
+
+func (rcm *RedisConnectionManager) recordError(operation string, err error) {
+	rcm.metrics.redisConnectionError.Inc()
+	logger.Log.WithFields(logrus.Fields{"operation": operation, "error": err}).Error("Redis operation failed")
+}
+
+func (rcm *RedisConnectionManager) Register(ctx context.Context, account string, node_id string, client Receptor) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	details, err := json.Marshal(connectionDetails(account, node_id, client))
+	if err != nil {
+		return err
+	}
+
+	c := rcm.client.WithContext(ctx)
+	key := redisConnectionKey(node_id)
+
+	// Watching the connection's hash makes the duplicate check and the writes atomic.  The
+	// hash is written along with its ttl, so a failed registration cannot leave behind a
+	// hash that never expires.
+	err = c.Watch(func(tx *redis.Tx) error {
+		exists, err := tx.Exists(key).Result()
+		if err != nil {
+			return err
+		}
+
+		if exists > 0 {
+			return DuplicateConnectionError{}
+		}
+
+		_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+			pipe.HMSet(key, map[string]interface{}{
+				redisAccountField:  account,
+				redisDetailsField:  details,
+				redisLastSeenField: time.Now().UnixNano(),
+			})
+			pipe.Expire(key, rcm.ttl)
+			pipe.SAdd(redisAccountKey(account), node_id)
+			pipe.Expire(redisAccountKey(account), rcm.ttl)
+			return nil
+		})
+
+		return err
+	}, key)
+
+	// The hash changed while it was being watched, so another registration won the race
+	if err == redis.TxFailedErr {
+		err = DuplicateConnectionError{}
+	}
+
+	if errors.Is(err, ErrRegistrationConflict) {
+		logger.Log.WithFields(logrus.Fields{"account": account, "node_id": node_id}).Warn("Attempting to register duplicate connection")
+		return err
+	} else if err != nil {
+		rcm.recordError("register", err)
+		return err
+	}
+
+	logger.Log.Printf("Registered a connection (%s, %s)", account, node_id)
+	return nil
+}
+
+func (rcm *RedisConnectionManager) Unregister(ctx context.Context, account string, node_id string) {
+	pipe := rcm.client.WithContext(ctx).TxPipeline()
+	pipe.Del(redisConnectionKey(node_id))
+	pipe.SRem(redisAccountKey(account), node_id)
+
+	if _, err := pipe.Exec(); err != nil {
+		rcm.recordError("unregister", err)
+		return
+	}
+
+	logger.Log.Printf("Unregistered a connection (%s, %s)", account, node_id)
+}
+
+// Replace watches the connection's hash so that the swap is retried, and fails, rather
+// than overwriting a registration that changed while the new one was being written
+func (rcm *RedisConnectionManager) Replace(ctx context.Context, account string, node_id string, client Receptor) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	details, err := json.Marshal(connectionDetails(account, node_id, client))
+	if err != nil {
+		return err
+	}
+
+	c := rcm.client.WithContext(ctx)
+	key := redisConnectionKey(node_id)
+
+	err = c.Watch(func(tx *redis.Tx) error {
+		previousAccount, err := tx.HGet(key, redisAccountField).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+
+		_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+			if previousAccount != "" {
+				pipe.SRem(redisAccountKey(previousAccount), node_id)
+			}
+			pipe.Del(key)
+			pipe.HMSet(key, map[string]interface{}{
+				redisAccountField:  account,
+				redisDetailsField:  details,
+				redisLastSeenField: time.Now().UnixNano(),
+			})
+			pipe.Expire(key, rcm.ttl)
+			pipe.SAdd(redisAccountKey(account), node_id)
+			pipe.Expire(redisAccountKey(account), rcm.ttl)
+			return nil
+		})
+
+		return err
+	}, key)
+
+	if err != nil {
+		rcm.recordError("replace", err)
+		return err
+	}
+
+	logger.Log.Printf("Replaced a connection (%s, %s)", account, node_id)
+	return nil
+}
+
+func (rcm *RedisConnectionManager) Ping(ctx context.Context) error {
+	err := rcm.client.WithContext(ctx).Ping().Err()
+	if err != nil {
+		rcm.recordError("ping", err)
+	}
+	return err
+}
+
+// UpdateLastSeen also refreshes the ttl of the connection
+func (rcm *RedisConnectionManager) UpdateLastSeen(ctx context.Context, clientID domain.ClientID, seenAt time.Time) error {
+	c := rcm.client.WithContext(ctx)
+	key := redisConnectionKey(string(clientID))
+
+	account, err := c.HGet(key, redisAccountField).Result()
+	if err == redis.Nil {
+		return ErrConnectionNotFound
+	} else if err != nil {
+		rcm.recordError("update_last_seen", err)
+		return err
+	}
+
+	pipe := c.TxPipeline()
+	pipe.HSet(key, redisLastSeenField, seenAt.UnixNano())
+	pipe.Expire(key, rcm.ttl)
+	pipe.Expire(redisAccountKey(account), rcm.ttl)
+
+	if _, err := pipe.Exec(); err != nil {
+		rcm.recordError("update_last_seen", err)
+		return err
+	}
+
+	return nil
+}
+
+type redisConnection struct {
+	account  string
+	details  domain.RhcClient
+	lastSeen time.Time
+}
+
+// storedRhcClient reads the stored details without validating the account.  The
+// account is empty for the clients that only belong to an org, which the account id's
+// validation rejects.
+type storedRhcClient struct {
+	domain.RhcClient
+	Account string `json:"account"`
+}
+
+func parseRedisConnection(clientID string, fields map[string]string) (redisConnection, bool) {
+	account, exists := fields[redisAccountField]
+	if exists == false {
+		return redisConnection{}, false
+	}
+
+	connection := redisConnection{
+		account: account,
+		details: domain.RhcClient{ClientID: domain.ClientID(clientID), Account: domain.AccountID(account)},
+	}
+
+	if details, exists := fields[redisDetailsField]; exists {
+		var stored storedRhcClient
+		if err := json.Unmarshal([]byte(details), &stored); err != nil {
+			logger.Log.WithFields(logrus.Fields{"client_id": clientID, "error": err}).Warn("Unable to read the stored connection details")
+		} else {
+			connection.details = stored.RhcClient
+			connection.details.Account = domain.AccountID(stored.Account)
+		}
+	}
+
+	if lastSeen, err := strconv.ParseInt(fields[redisLastSeenField], 10, 64); err == nil {
+		connection.lastSeen = time.Unix(0, lastSeen)
+	}
+
+	return connection, true
+}
+
+// loadConnections reads the connections of the clients.  Clients whose connection has
+// expired or has been unregistered are left out.
+func (rcm *RedisConnectionManager) loadConnections(ctx context.Context, clientIDs []string) (map[string]redisConnection, error) {
+	pipe := rcm.client.WithContext(ctx).Pipeline()
+
+	cmds := make([]*redis.StringStringMapCmd, len(clientIDs))
+	for i, clientID := range clientIDs {
+		cmds[i] = pipe.HGetAll(redisConnectionKey(clientID))
+	}
+
+	if len(clientIDs) > 0 {
+		if _, err := pipe.Exec(); err != nil {
+			return nil, err
+		}
+	}
+
+	connections := make(map[string]redisConnection, len(clientIDs))
+	for i, clientID := range clientIDs {
+		if connection, exists := parseRedisConnection(clientID, cmds[i].Val()); exists {
+			connections[clientID] = connection
+		}
+	}
+
+	return connections, nil
+}
+
+// scanClientIDs returns the ids of all of the registered clients
+func (rcm *RedisConnectionManager) scanClientIDs(ctx context.Context) ([]string, error) {
+	c := rcm.client.WithContext(ctx)
+
+	var clientIDs []string
+	var cursor uint64
+
+	for {
+		keys, next, err := c.Scan(cursor, redisConnectionKeyPrefix+"*", 1000).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			clientIDs = append(clientIDs, key[len(redisConnectionKeyPrefix):])
+		}
+
+		if next == 0 {
+			return clientIDs, nil
+		}
+		cursor = next
+	}
+}
+
+func (rcm *RedisConnectionManager) accountConnections(ctx context.Context, account string) ([]string, map[string]redisConnection, error) {
+	c := rcm.client.WithContext(ctx)
+
+	members, err := c.SMembers(redisAccountKey(account)).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	connections, err := rcm.loadConnections(ctx, members)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clientIDs := make([]string, 0, len(connections))
+	for _, clientID := range members {
+		connection, exists := connections[clientID]
+		if exists == false || connection.account != account {
+			// The connection expired or moved to another account
+			c.SRem(redisAccountKey(account), clientID)
+			continue
+		}
+		clientIDs = append(clientIDs, clientID)
+	}
+
+	sort.Strings(clientIDs)
+
+	return clientIDs, connections, nil
+}
+
+func (rcm *RedisConnectionManager) FindConnection(ctx context.Context, clientID domain.ClientID) (domain.RhcClient, error) {
+	fields, err := rcm.client.WithContext(ctx).HGetAll(redisConnectionKey(string(clientID))).Result()
+	if err != nil {
+		rcm.recordError("find_by_client_id", err)
+		return domain.RhcClient{}, err
+	}
+
+	connection, exists := parseRedisConnection(string(clientID), fields)
+	if exists == false {
+		return domain.RhcClient{}, ErrConnectionNotFound
+	}
+
+	return connection.details, nil
+}
+
+func (rcm *RedisConnectionManager) FindConnectionsByAccount(ctx context.Context, account string, offset int, limit int) ([]domain.RhcClient, int, error) {
+	clientIDs, connections, err := rcm.accountConnections(ctx, account)
+	if err != nil {
+		rcm.recordError("find_page_by_account", err)
+		return nil, 0, err
+	}
+
+	total := len(clientIDs)
+	start, end := pageBounds(total, offset, limit)
+
+	page := make([]domain.RhcClient, 0, end-start)
+	for _, clientID := range clientIDs[start:end] {
+		page = append(page, connections[clientID].details)
+	}
+
+	return page, total, nil
+}
+
+func (rcm *RedisConnectionManager) CountConnections(ctx context.Context) (int, error) {
+	clientIDs, err := rcm.scanClientIDs(ctx)
+	if err != nil {
+		rcm.recordError("count", err)
+		return 0, err
+	}
+
+	return len(clientIDs), nil
+}
+
+func (rcm *RedisConnectionManager) FindStaleConnections(ctx context.Context, seenBefore time.Time) ([]domain.RhcClient, error) {
+	clientIDs, err := rcm.scanClientIDs(ctx)
+	if err == nil {
+		var connections map[string]redisConnection
+		connections, err = rcm.loadConnections(ctx, clientIDs)
+		if err == nil {
+			var stale []domain.RhcClient
+			for _, connection := range connections {
+				if connection.lastSeen.Before(seenBefore) {
+					stale = append(stale, connection.details)
+				}
+			}
+
+			sortClients(stale)
+
+			return stale, nil
+		}
+	}
+
+	rcm.recordError("find_stale", err)
+	return nil, err
+}
+
+// redisReceptor is a receptor created by the receptor factory along with the details
+// that were stored when the client registered
+type redisReceptor struct {
+	Receptor
+	details domain.RhcClient
+}
+
+func (rr *redisReceptor) ClientDetails() domain.RhcClient {
+	return rr.details
+}
+
+// newReceptor returns nil if the factory did not create a receptor for the connection
+func (rcm *RedisConnectionManager) newReceptor(clientID string, connection redisConnection) Receptor {
+	receptor := rcm.receptorFactory(connection.account, clientID)
+	if receptor == nil {
+		return nil
+	}
+
+	return &redisReceptor{Receptor: receptor, details: connection.details}
+}
+
+func (rcm *RedisConnectionManager) GetConnection(ctx context.Context, account string, node_id string) Receptor {
+	fields, err := rcm.client.WithContext(ctx).HGetAll(redisConnectionKey(node_id)).Result()
+	if err != nil {
+		rcm.recordError("find", err)
+		return nil
+	}
+
+	connection, exists := parseRedisConnection(node_id, fields)
+	if exists == false || connection.account != account {
+		return nil
+	}
+
+	return rcm.newReceptor(node_id, connection)
+}
+
+func (rcm *RedisConnectionManager) GetConnectionsByAccount(ctx context.Context, account string) map[string]Receptor {
+	connectionsPerAccount := make(map[string]Receptor)
+
+	clientIDs, connections, err := rcm.accountConnections(ctx, account)
+	if err != nil {
+		rcm.recordError("find_by_account", err)
+		return connectionsPerAccount
+	}
+
+	for _, clientID := range clientIDs {
+		if receptor := rcm.newReceptor(clientID, connections[clientID]); receptor != nil {
+			connectionsPerAccount[clientID] = receptor
+		}
+	}
+
+	return connectionsPerAccount
+}
+
+func (rcm *RedisConnectionManager) GetAllConnections(ctx context.Context) map[string]map[string]Receptor {
+	connectionMap := make(map[string]map[string]Receptor)
+
+	clientIDs, err := rcm.scanClientIDs(ctx)
+	if err != nil {
+		rcm.recordError("find_all", err)
+		return connectionMap
+	}
+
+	connections, err := rcm.loadConnections(ctx, clientIDs)
+	if err != nil {
+		rcm.recordError("find_all", err)
+		return connectionMap
+	}
+
+	for clientID, connection := range connections {
+		receptor := rcm.newReceptor(clientID, connection)
+		if receptor == nil {
+			continue
+		}
+
+		if _, exists := connectionMap[connection.account]; exists == false {
+			connectionMap[connection.account] = make(map[string]Receptor)
+		}
+		connectionMap[connection.account][clientID] = receptor
+	}
+
+	return connectionMap
+}
@@ -0,0 +1,301 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+
+	"github.com/alicebob/miniredis"
+)
+
+func newTestRedisConnectionManager(t *testing.T, ttl time.Duration) (*RedisConnectionManager, *miniredis.Miniredis) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Unable to start miniredis: %s", err)
+	}
+
+	cm, err := NewRedisConnectionManager(NewRedisClient(server.Addr(), "", 0), ttl, mockReceptorFactory, metrics)
+	if err != nil {
+		t.Fatalf("Unable to create the connection manager: %s", err)
+	}
+
+	return cm, server
+}
+
+func mockReceptorFactory(account string, nodeID string) Receptor {
+	return &MockReceptor{NodeID: nodeID}
+}
+
+func TestRedisConnectionManagerRequiresAReceptorFactory(t *testing.T) {
+	if _, err := NewRedisConnectionManager(NewRedisClient("localhost:6379", "", 0), time.Hour, nil, metrics); err != ErrReceptorFactoryRequired {
+		t.Fatalf("Expected ErrReceptorFactoryRequired, got %v", err)
+	}
+}
+
+func TestRedisRegisterAndFindConnection(t *testing.T) {
+	cm, server := newTestRedisConnectionManager(t, time.Hour)
+	defer server.Close()
+
+	details := domain.RhcClient{ClientID: "456", Account: "123", Capabilities: []string{"reconnect"}}
+
+	if err := cm.Register(context.TODO(), "123", "456", &DetailedMockReceptor{details: details}); err != nil {
+		t.Fatalf("Unexpected error registering the connection: %s", err)
+	}
+
+	client, err := cm.FindConnection(context.TODO(), "456")
+	if err != nil {
+		t.Fatalf("Unexpected error finding the connection: %s", err)
+	}
+
+	if client.Account != "123" || client.HasCapability("reconnect") == false {
+		t.Fatalf("Expected the stored details to be returned, got %+v", client)
+	}
+
+	if _, err := cm.FindConnection(context.TODO(), "789"); err != ErrConnectionNotFound {
+		t.Fatalf("Expected ErrConnectionNotFound, got %v", err)
+	}
+
+	if ttl := server.TTL(redisConnectionKey("456")); ttl != time.Hour {
+		t.Fatalf("Expected the connection to expire after an hour, got %s", ttl)
+	}
+}
+
+func TestRedisRegisterDuplicateConnection(t *testing.T) {
+	cm, server := newTestRedisConnectionManager(t, time.Hour)
+	defer server.Close()
+
+	cm.Register(context.TODO(), "123", "456", &MockReceptor{})
+
+	if err := cm.Register(context.TODO(), "123", "456", &MockReceptor{}); err != (DuplicateConnectionError{}) {
+		t.Fatalf("Expected a DuplicateConnectionError, got %v", err)
+	}
+}
+
+func TestRedisReplaceConnection(t *testing.T) {
+	cm, server := newTestRedisConnectionManager(t, time.Hour)
+	defer server.Close()
+
+	cm.Register(context.TODO(), "123", "456", &DetailedMockReceptor{details: domain.RhcClient{ClientID: "456", Account: "123"}})
+
+	replacement := domain.RhcClient{ClientID: "456", Account: "789", Capabilities: []string{"reconnect"}}
+	if err := cm.Replace(context.TODO(), "789", "456", &DetailedMockReceptor{details: replacement}); err != nil {
+		t.Fatalf("Unexpected error replacing the connection: %s", err)
+	}
+
+	client, err := cm.FindConnection(context.TODO(), "456")
+	if err != nil {
+		t.Fatalf("Unexpected error finding the connection: %s", err)
+	}
+
+	if client.Account != "789" || client.HasCapability("reconnect") == false {
+		t.Fatalf("Expected the replacement's details, got %+v", client)
+	}
+
+	if members, _ := server.Members(redisAccountKey("123")); len(members) != 0 {
+		t.Fatalf("Expected the connection to be removed from the previous account, got %v", members)
+	}
+
+	if members, _ := server.Members(redisAccountKey("789")); len(members) != 1 {
+		t.Fatalf("Expected the connection to be added to the new account, got %v", members)
+	}
+}
+
+func TestRedisUnregisterDeletesConnection(t *testing.T) {
+	cm, server := newTestRedisConnectionManager(t, time.Hour)
+	defer server.Close()
+
+	cm.Register(context.TODO(), "123", "456", &MockReceptor{})
+	cm.Unregister(context.TODO(), "123", "456")
+
+	if server.Exists(redisConnectionKey("456")) {
+		t.Fatalf("Expected the connection's key to be deleted")
+	}
+
+	if count, _ := cm.CountConnections(context.TODO()); count != 0 {
+		t.Fatalf("Expected no connections, got %d", count)
+	}
+
+	if err := cm.Register(context.TODO(), "123", "456", &MockReceptor{}); err != nil {
+		t.Fatalf("Expected the client to be able to register again, got %s", err)
+	}
+}
+
+func TestRedisConnectionExpiresUnlessSeen(t *testing.T) {
+	cm, server := newTestRedisConnectionManager(t, time.Minute)
+	defer server.Close()
+
+	cm.Register(context.TODO(), "123", "456", &MockReceptor{})
+	cm.Register(context.TODO(), "123", "789", &MockReceptor{})
+
+	server.FastForward(30 * time.Second)
+
+	if err := cm.UpdateLastSeen(context.TODO(), "456", time.Now()); err != nil {
+		t.Fatalf("Unexpected error updating when the client was last seen: %s", err)
+	}
+
+	server.FastForward(45 * time.Second)
+
+	connections, total, err := cm.FindConnectionsByAccount(context.TODO(), "123", 0, -1)
+	if err != nil {
+		t.Fatalf("Unexpected error finding the account's connections: %s", err)
+	}
+
+	if total != 1 || connections[0].ClientID != "456" {
+		t.Fatalf("Expected only the client that was seen to remain registered, got %+v", connections)
+	}
+
+	if err := cm.UpdateLastSeen(context.TODO(), "789", time.Now()); err != ErrConnectionNotFound {
+		t.Fatalf("Expected ErrConnectionNotFound for the expired connection, got %v", err)
+	}
+}
+
+func TestRedisFindConnectionsByAccount(t *testing.T) {
+	cm, server := newTestRedisConnectionManager(t, time.Hour)
+	defer server.Close()
+
+	for _, clientID := range []string{"c", "a", "b"} {
+		cm.Register(context.TODO(), "123", clientID, &MockReceptor{})
+	}
+	cm.Register(context.TODO(), "456", "d", &MockReceptor{})
+
+	connections, total, err := cm.FindConnectionsByAccount(context.TODO(), "123", 1, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error finding the account's connections: %s", err)
+	}
+
+	if total != 3 || len(connections) != 1 || connections[0].ClientID != "b" {
+		t.Fatalf("Expected the second of 3 connections, got %+v of %d", connections, total)
+	}
+
+	if count, _ := cm.CountConnections(context.TODO()); count != 4 {
+		t.Fatalf("Expected 4 connections, got %d", count)
+	}
+
+	all := cm.GetAllConnections(context.TODO())
+	if len(all["123"]) != 3 || len(all["456"]) != 1 {
+		t.Fatalf("Expected the connections to be grouped by account, got %+v", all)
+	}
+}
+
+func TestRedisFindStaleConnections(t *testing.T) {
+	cm, server := newTestRedisConnectionManager(t, time.Hour)
+	defer server.Close()
+
+	now := time.Now()
+
+	cm.Register(context.TODO(), "123", "456", &MockReceptor{})
+	cm.Register(context.TODO(), "123", "789", &MockReceptor{})
+	cm.UpdateLastSeen(context.TODO(), "456", now.Add(-10*time.Minute))
+
+	stale, err := cm.FindStaleConnections(context.TODO(), now.Add(-5*time.Minute))
+	if err != nil {
+		t.Fatalf("Unexpected error finding the stale connections: %s", err)
+	}
+
+	if len(stale) != 1 || stale[0].ClientID != "456" {
+		t.Fatalf("Expected only the connection that has not been seen to be stale, got %+v", stale)
+	}
+}
+
+func TestRedisGetConnectionUsesReceptorFactory(t *testing.T) {
+	cm, server := newTestRedisConnectionManager(t, time.Hour)
+	defer server.Close()
+
+	cm.Register(context.TODO(), "123", "456", &DetailedMockReceptor{details: domain.RhcClient{ClientID: "456", Account: "123", DisplayName: "host"}})
+
+	if cm.GetConnection(context.TODO(), "999", "456") != nil {
+		t.Fatalf("Expected the connection of another account not to be found")
+	}
+
+	receptor := cm.GetConnection(context.TODO(), "123", "456")
+	if receptor == nil {
+		t.Fatalf("Expected the connection to be found")
+	}
+
+	if details := receptor.(ClientDetailer).ClientDetails(); details.DisplayName != "host" {
+		t.Fatalf("Expected the stored details, got %+v", details)
+	}
+
+	if receptor.(*redisReceptor).Receptor.(*MockReceptor).NodeID != "456" {
+		t.Fatalf("Expected the receptor to be created by the factory")
+	}
+}
+
+func TestRedisRegisterFailsWhenRedisIsUnavailable(t *testing.T) {
+	cm, server := newTestRedisConnectionManager(t, time.Hour)
+	server.Close()
+
+	if err := cm.Register(context.TODO(), "123", "456", &MockReceptor{}); err == nil {
+		t.Fatalf("Expected an error when redis is unavailable")
+	}
+
+	if err := cm.Ping(context.TODO()); err == nil {
+		t.Fatalf("Expected the ping to fail when redis is unavailable")
+	}
+}
+
+func TestRedisConnectionsAreLeftOutUntilTheReceptorFactoryIsAttached(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Unable to start miniredis: %s", err)
+	}
+	defer server.Close()
+
+	receptorFactory := NewDeferredReceptorFactory()
+
+	cm, err := NewRedisConnectionManager(NewRedisClient(server.Addr(), "", 0), time.Hour, receptorFactory.Create, metrics)
+	if err != nil {
+		t.Fatalf("Unable to create the connection manager: %s", err)
+	}
+
+	cm.Register(context.TODO(), "123", "456", &MockReceptor{})
+
+	if cm.GetConnection(context.TODO(), "123", "456") != nil {
+		t.Fatalf("Expected no receptor before the factory is attached")
+	}
+
+	if len(cm.GetConnectionsByAccount(context.TODO(), "123")) != 0 || len(cm.GetAllConnections(context.TODO())) != 0 {
+		t.Fatalf("Expected no receptors before the factory is attached")
+	}
+
+	receptorFactory.Attach(mockReceptorFactory)
+
+	if cm.GetConnection(context.TODO(), "123", "456") == nil {
+		t.Fatalf("Expected the connection to be found once the factory is attached")
+	}
+}
+
+func TestRedisDuplicateRegistrationKeepsTheTTL(t *testing.T) {
+	cm, server := newTestRedisConnectionManager(t, time.Hour)
+	defer server.Close()
+
+	cm.Register(context.TODO(), "123", "456", &MockReceptor{})
+	cm.Register(context.TODO(), "123", "456", &MockReceptor{})
+
+	if ttl := server.TTL(redisConnectionKey("456")); ttl != time.Hour {
+		t.Fatalf("Expected the connection to expire after an hour, got %s", ttl)
+	}
+
+}
+
+func TestRedisFindConnectionOfAnOrgOnlyClient(t *testing.T) {
+	cm, server := newTestRedisConnectionManager(t, time.Hour)
+	defer server.Close()
+
+	details := domain.RhcClient{ClientID: "456", OrgID: "5678", DisplayName: "host"}
+
+	if err := cm.Register(context.TODO(), "", "456", &DetailedMockReceptor{details: details}); err != nil {
+		t.Fatalf("Unexpected error registering the connection: %s", err)
+	}
+
+	client, err := cm.FindConnection(context.TODO(), "456")
+	if err != nil {
+		t.Fatalf("Unexpected error finding the connection: %s", err)
+	}
+
+	if client.OrgID != "5678" || client.DisplayName != "host" {
+		t.Fatalf("Expected the stored details to be returned, got %+v", client)
+	}
+}
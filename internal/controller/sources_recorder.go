@@ -0,0 +1,444 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrInvalidSourcesRecorder = errors.New("Invalid sources recorder")
+var ErrMissingSourcesBaseURL = errors.New("The sources base url is required")
+var ErrInvalidSourcesTimeout = errors.New("The sources http timeout must be greater than 0")
+
+// maxSourcesResponseSize limits how much of a response from the sources service is read
+const maxSourcesResponseSize = 1024 * 1024
+
+// SourceRegistration describes the source that is created for a connected client and
+// the application that is created for one of the client's dispatchers.  Each client has
+// a single source.  Each dispatcher that is registered with sources adds an application
+// to the client's source.
+type SourceRegistration struct {
+	SourceRef       string
+	Name            string
+	SourceType      string
+	ApplicationType string
+}
+
+// SourcesRecorder registers (and unregisters) the dispatchers of connected clients with
+// the Sources service.  Registering a dispatcher that is already registered is not an
+// error.  Unregistering a dispatcher removes only the dispatcher's application.  The
+// client's source is removed along with its last application.
+type SourcesRecorder interface {
+	RegisterWithSources(ctx context.Context, identityHeader string, account domain.AccountID, source SourceRegistration) error
+	UnregisterFromSources(ctx context.Context, identityHeader string, account domain.AccountID, source SourceRegistration) error
+}
+
+// FakeSourcesRecorder keeps the registered sources in memory instead of calling
+// the Sources service
+type FakeSourcesRecorder struct {
+	sources map[string]map[string]SourceRegistration // source ref -> application type
+	sync.Mutex
+}
+
+func NewFakeSourcesRecorder() *FakeSourcesRecorder {
+	return &FakeSourcesRecorder{sources: make(map[string]map[string]SourceRegistration)}
+}
+
+func (fsr *FakeSourcesRecorder) RegisterWithSources(ctx context.Context, identityHeader string, account domain.AccountID, source SourceRegistration) error {
+	fsr.Lock()
+	defer fsr.Unlock()
+
+	logger.Log.WithFields(logrus.Fields{"account": account, "source_ref": source.SourceRef, "application_type": source.ApplicationType}).Debug("Registering the source with the fake sources recorder")
+
+	applications, exists := fsr.sources[source.SourceRef]
+	if exists == false {
+		applications = make(map[string]SourceRegistration)
+		fsr.sources[source.SourceRef] = applications
+	}
+
+	applications[source.ApplicationType] = source
+
+	return nil
+}
+
+func (fsr *FakeSourcesRecorder) UnregisterFromSources(ctx context.Context, identityHeader string, account domain.AccountID, source SourceRegistration) error {
+	fsr.Lock()
+	defer fsr.Unlock()
+
+	logger.Log.WithFields(logrus.Fields{"account": account, "source_ref": source.SourceRef, "application_type": source.ApplicationType}).Debug("Unregistering the source from the fake sources recorder")
+
+	applications := fsr.sources[source.SourceRef]
+
+	delete(applications, source.ApplicationType)
+
+	if len(applications) == 0 {
+		delete(fsr.sources, source.SourceRef)
+	}
+
+	return nil
+}
+
+// Registered returns the source registered with the source ref and application type
+func (fsr *FakeSourcesRecorder) Registered(sourceRef string, applicationType string) (SourceRegistration, bool) {
+	fsr.Lock()
+	defer fsr.Unlock()
+
+	source, found := fsr.sources[sourceRef][applicationType]
+	return source, found
+}
+
+type HttpSourcesConfig struct {
+	BaseURL    string
+	Timeout    time.Duration
+	MaxRetries int
+	RetryDelay time.Duration
+}
+
+// HttpSourcesRecorder registers the sources using the Sources service's REST api.
+// Requests that fail with a 5xx status code (or that do not get a response at all)
+// are retried.  A source (or application) that already exists is left as it is, so
+// re-registering a client that reconnects is harmless.  Unregistering a source that
+// does not exist is not an error either.
+type HttpSourcesRecorder struct {
+	config     HttpSourcesConfig
+	httpClient *http.Client
+	metrics    *Metrics
+}
+
+func NewHttpSourcesRecorder(cfg HttpSourcesConfig, metrics *Metrics) (*HttpSourcesRecorder, error) {
+	if cfg.BaseURL == "" {
+		return nil, ErrMissingSourcesBaseURL
+	}
+
+	if cfg.Timeout <= 0 {
+		return nil, ErrInvalidSourcesTimeout
+	}
+
+	return &HttpSourcesRecorder{
+		config:     cfg,
+		httpClient: &http.Client{},
+		metrics:    metrics,
+	}, nil
+}
+
+type sourcesBulkCreateRequest struct {
+	Sources      []sourcesBulkCreateSource      `json:"sources"`
+	Applications []sourcesBulkCreateApplication `json:"applications"`
+}
+
+type sourcesBulkCreateSource struct {
+	Name           string `json:"name"`
+	SourceRef      string `json:"source_ref"`
+	SourceTypeName string `json:"source_type_name"`
+}
+
+type sourcesBulkCreateApplication struct {
+	SourceName          string `json:"source_name"`
+	ApplicationTypeName string `json:"application_type_name"`
+}
+
+type sourcesCreateApplicationRequest struct {
+	SourceID          string `json:"source_id"`
+	ApplicationTypeID string `json:"application_type_id"`
+}
+
+type sourcesListResponse struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+func (hsr *HttpSourcesRecorder) RegisterWithSources(ctx context.Context, identityHeader string, account domain.AccountID, source SourceRegistration) error {
+	logger := logger.Log.WithFields(logrus.Fields{"account": account, "source_ref": source.SourceRef, "application_type": source.ApplicationType})
+
+	sourceIDs, err := hsr.findSources(ctx, identityHeader, source.SourceRef)
+	if err != nil {
+		hsr.metrics.sourcesRequestCounter.WithLabelValues("register", "failed").Inc()
+		return err
+	}
+
+	var statusCode int
+	if len(sourceIDs) == 0 {
+		statusCode, err = hsr.createSource(ctx, identityHeader, source)
+	} else {
+		statusCode, err = hsr.createApplication(ctx, identityHeader, sourceIDs[0], source.ApplicationType)
+	}
+
+	if err != nil {
+		hsr.metrics.sourcesRequestCounter.WithLabelValues("register", "failed").Inc()
+		return err
+	}
+
+	switch {
+	case statusCode == http.StatusConflict:
+		// The application already exists or another replica registered the source
+		// between the lookup and the create
+		logger.Debug("The source is already registered with sources")
+		hsr.metrics.sourcesRequestCounter.WithLabelValues("register", "already_registered").Inc()
+		return nil
+	case statusCode < 200 || statusCode > 299:
+		hsr.metrics.sourcesRequestCounter.WithLabelValues("register", "failed").Inc()
+		return sourcesStatusError(statusCode)
+	}
+
+	logger.Debug("Registered the source with sources")
+	hsr.metrics.sourcesRequestCounter.WithLabelValues("register", "registered").Inc()
+
+	return nil
+}
+
+// createSource creates the client's source along with the dispatcher's application
+func (hsr *HttpSourcesRecorder) createSource(ctx context.Context, identityHeader string, source SourceRegistration) (int, error) {
+	body, err := json.Marshal(sourcesBulkCreateRequest{
+		Sources: []sourcesBulkCreateSource{
+			{Name: source.Name, SourceRef: source.SourceRef, SourceTypeName: source.SourceType},
+		},
+		Applications: []sourcesBulkCreateApplication{
+			{SourceName: source.Name, ApplicationTypeName: source.ApplicationType},
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	statusCode, _, err := hsr.do(ctx, http.MethodPost, "/bulk_create", identityHeader, body)
+	return statusCode, err
+}
+
+// createApplication adds the dispatcher's application to the client's existing source.
+// http.StatusConflict is returned if the source already has the application.
+func (hsr *HttpSourcesRecorder) createApplication(ctx context.Context, identityHeader string, sourceID string, applicationType string) (int, error) {
+	applicationTypeID, err := hsr.findApplicationType(ctx, identityHeader, applicationType)
+	if err != nil {
+		return 0, err
+	}
+
+	applicationIDs, err := hsr.findApplications(ctx, identityHeader, sourceID, applicationTypeID)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(applicationIDs) > 0 {
+		return http.StatusConflict, nil
+	}
+
+	body, err := json.Marshal(sourcesCreateApplicationRequest{SourceID: sourceID, ApplicationTypeID: applicationTypeID})
+	if err != nil {
+		return 0, err
+	}
+
+	statusCode, _, err := hsr.do(ctx, http.MethodPost, "/applications", identityHeader, body)
+	return statusCode, err
+}
+
+func (hsr *HttpSourcesRecorder) UnregisterFromSources(ctx context.Context, identityHeader string, account domain.AccountID, source SourceRegistration) error {
+	sourceIDs, err := hsr.findSources(ctx, identityHeader, source.SourceRef)
+	if err != nil {
+		hsr.metrics.sourcesRequestCounter.WithLabelValues("unregister", "failed").Inc()
+		return err
+	}
+
+	for _, sourceID := range sourceIDs {
+		if err := hsr.removeApplication(ctx, identityHeader, sourceID, source.ApplicationType); err != nil {
+			hsr.metrics.sourcesRequestCounter.WithLabelValues("unregister", "failed").Inc()
+			return err
+		}
+	}
+
+	logger.Log.WithFields(logrus.Fields{"account": account, "source_ref": source.SourceRef, "application_type": source.ApplicationType}).Debug("Unregistered the source from sources")
+	hsr.metrics.sourcesRequestCounter.WithLabelValues("unregister", "unregistered").Inc()
+
+	return nil
+}
+
+// removeApplication deletes the dispatcher's application from the source.  The source
+// is deleted once none of the client's dispatchers have an application left.
+func (hsr *HttpSourcesRecorder) removeApplication(ctx context.Context, identityHeader string, sourceID string, applicationType string) error {
+	if applicationType != "" {
+		applicationTypeID, err := hsr.findApplicationType(ctx, identityHeader, applicationType)
+		if err != nil {
+			return err
+		}
+
+		applicationIDs, err := hsr.findApplications(ctx, identityHeader, sourceID, applicationTypeID)
+		if err != nil {
+			return err
+		}
+
+		for _, applicationID := range applicationIDs {
+			if err := hsr.delete(ctx, identityHeader, "/applications/"+url.PathEscape(applicationID)); err != nil {
+				return err
+			}
+		}
+	}
+
+	remaining, err := hsr.findApplications(ctx, identityHeader, sourceID, "")
+	if err != nil {
+		return err
+	}
+
+	if len(remaining) > 0 {
+		return nil
+	}
+
+	return hsr.delete(ctx, identityHeader, "/sources/"+url.PathEscape(sourceID))
+}
+
+func (hsr *HttpSourcesRecorder) delete(ctx context.Context, identityHeader string, path string) error {
+	statusCode, _, err := hsr.do(ctx, http.MethodDelete, path, identityHeader, nil)
+	if err != nil {
+		return err
+	}
+
+	if statusCode != http.StatusNotFound && (statusCode < 200 || statusCode > 299) {
+		return sourcesStatusError(statusCode)
+	}
+
+	return nil
+}
+
+func (hsr *HttpSourcesRecorder) findSources(ctx context.Context, identityHeader string, sourceRef string) ([]string, error) {
+	query := url.Values{}
+	query.Set("filter[source_ref][eq]", sourceRef)
+
+	return hsr.list(ctx, identityHeader, "/sources?"+query.Encode())
+}
+
+func (hsr *HttpSourcesRecorder) findApplicationType(ctx context.Context, identityHeader string, applicationType string) (string, error) {
+	query := url.Values{}
+	query.Set("filter[name][eq]", applicationType)
+
+	applicationTypeIDs, err := hsr.list(ctx, identityHeader, "/application_types?"+query.Encode())
+	if err != nil {
+		return "", err
+	}
+
+	if len(applicationTypeIDs) == 0 {
+		return "", fmt.Errorf("Sources does not have the %s application type", applicationType)
+	}
+
+	return applicationTypeIDs[0], nil
+}
+
+// findApplications lists the source's applications.  All of the source's applications
+// are listed when the application type id is empty.
+func (hsr *HttpSourcesRecorder) findApplications(ctx context.Context, identityHeader string, sourceID string, applicationTypeID string) ([]string, error) {
+	query := url.Values{}
+	query.Set("filter[source_id][eq]", sourceID)
+	if applicationTypeID != "" {
+		query.Set("filter[application_type_id][eq]", applicationTypeID)
+	}
+
+	return hsr.list(ctx, identityHeader, "/applications?"+query.Encode())
+}
+
+// list returns the ids of the resources returned by a GET request
+func (hsr *HttpSourcesRecorder) list(ctx context.Context, identityHeader string, path string) ([]string, error) {
+	statusCode, body, err := hsr.do(ctx, http.MethodGet, path, identityHeader, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode < 200 || statusCode > 299 {
+		return nil, sourcesStatusError(statusCode)
+	}
+
+	var response sourcesListResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(response.Data))
+	for _, resource := range response.Data {
+		ids = append(ids, resource.ID)
+	}
+
+	return ids, nil
+}
+
+// do sends the request, retrying the request if it fails with a 5xx status code.  The
+// status code and body of the last response is returned.  The retries stop when the
+// context is done.
+func (hsr *HttpSourcesRecorder) do(ctx context.Context, method string, path string, identityHeader string, body []byte) (int, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		statusCode, responseBody, err := hsr.send(ctx, method, path, identityHeader, body)
+		if err == nil && (statusCode < 500 || attempt >= hsr.config.MaxRetries) {
+			return statusCode, responseBody, nil
+		}
+
+		if err != nil && attempt >= hsr.config.MaxRetries {
+			return 0, nil, fmt.Errorf("%w: %s", ErrDownstreamUnavailable, err)
+		}
+
+		timer := time.NewTimer(hsr.config.RetryDelay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return 0, nil, fmt.Errorf("%w: %s", ErrDownstreamUnavailable, ctx.Err())
+		}
+	}
+}
+
+// sourcesStatusError builds the error for an unexpected status code.  Server errors
+// are treated as the sources service being unavailable.
+func sourcesStatusError(statusCode int) error {
+	if statusCode >= 500 {
+		return fmt.Errorf("%w: sources returned status code %d", ErrDownstreamUnavailable, statusCode)
+	}
+	return fmt.Errorf("Sources returned status code %d", statusCode)
+}
+
+func (hsr *HttpSourcesRecorder) send(ctx context.Context, method string, path string, identityHeader string, body []byte) (int, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, hsr.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, hsr.config.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-rh-identity", identityHeader)
+
+	resp, err := hsr.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSourcesResponseSize))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return resp.StatusCode, responseBody, nil
+}
+
+func NewSourcesRecorder(impl string, httpCfg HttpSourcesConfig, metrics *Metrics) (SourcesRecorder, error) {
+	switch impl {
+	case "fake":
+		return NewFakeSourcesRecorder(), nil
+	case "http":
+		recorder, err := NewHttpSourcesRecorder(httpCfg, metrics)
+		if err != nil {
+			return nil, err
+		}
+		return recorder, nil
+	default:
+		return nil, ErrInvalidSourcesRecorder
+	}
+}
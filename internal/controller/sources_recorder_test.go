@@ -0,0 +1,360 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeSourcesApplication struct {
+	sourceID          string
+	applicationTypeID string
+}
+
+// fakeSourcesService implements just enough of the sources api to register
+// and unregister sources and their applications
+type fakeSourcesService struct {
+	server              *httptest.Server
+	failures            int
+	nextID              int
+	sources             map[string]string
+	applications        map[string]fakeSourcesApplication
+	applicationTypes    map[string]string
+	created             []sourcesBulkCreateRequest
+	createdApplications []sourcesCreateApplicationRequest
+	deleted             []string
+	identityHeaders     []string
+	sync.Mutex
+}
+
+func (fss *fakeSourcesService) newID() string {
+	fss.nextID++
+	return fmt.Sprintf("%d", fss.nextID)
+}
+
+func writeSourcesList(w http.ResponseWriter, ids []string) {
+	var response sourcesListResponse
+	for _, id := range ids {
+		response.Data = append(response.Data, struct {
+			ID string `json:"id"`
+		}{ID: id})
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func startFakeSourcesService(failures int) *fakeSourcesService {
+	fss := &fakeSourcesService{
+		failures:         failures,
+		sources:          make(map[string]string),
+		applications:     make(map[string]fakeSourcesApplication),
+		applicationTypes: map[string]string{"/insights/platform/catalog": "100", "/insights/platform/remediations": "101"},
+	}
+	fss.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fss.Lock()
+		defer fss.Unlock()
+
+		fss.identityHeaders = append(fss.identityHeaders, req.Header.Get("x-rh-identity"))
+
+		if fss.failures > 0 {
+			fss.failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		query := req.URL.Query()
+
+		switch {
+		case req.Method == http.MethodGet && req.URL.Path == "/sources":
+			var ids []string
+			if id, exists := fss.sources[query.Get("filter[source_ref][eq]")]; exists {
+				ids = append(ids, id)
+			}
+			writeSourcesList(w, ids)
+		case req.Method == http.MethodGet && req.URL.Path == "/application_types":
+			var ids []string
+			if id, exists := fss.applicationTypes[query.Get("filter[name][eq]")]; exists {
+				ids = append(ids, id)
+			}
+			writeSourcesList(w, ids)
+		case req.Method == http.MethodGet && req.URL.Path == "/applications":
+			var ids []string
+			for id, application := range fss.applications {
+				if application.sourceID == query.Get("filter[source_id][eq]") &&
+					(query.Get("filter[application_type_id][eq]") == "" || application.applicationTypeID == query.Get("filter[application_type_id][eq]")) {
+					ids = append(ids, id)
+				}
+			}
+			writeSourcesList(w, ids)
+		case req.Method == http.MethodPost && req.URL.Path == "/bulk_create":
+			body, _ := ioutil.ReadAll(req.Body)
+			var request sourcesBulkCreateRequest
+			json.Unmarshal(body, &request)
+			fss.created = append(fss.created, request)
+			for i, source := range request.Sources {
+				sourceID := fss.newID()
+				fss.sources[source.SourceRef] = sourceID
+				fss.applications[fss.newID()] = fakeSourcesApplication{sourceID: sourceID, applicationTypeID: fss.applicationTypes[request.Applications[i].ApplicationTypeName]}
+			}
+			w.WriteHeader(http.StatusCreated)
+		case req.Method == http.MethodPost && req.URL.Path == "/applications":
+			body, _ := ioutil.ReadAll(req.Body)
+			var request sourcesCreateApplicationRequest
+			json.Unmarshal(body, &request)
+			fss.createdApplications = append(fss.createdApplications, request)
+			fss.applications[fss.newID()] = fakeSourcesApplication{sourceID: request.SourceID, applicationTypeID: request.ApplicationTypeID}
+			w.WriteHeader(http.StatusCreated)
+		case req.Method == http.MethodDelete && strings.HasPrefix(req.URL.Path, "/applications/"):
+			fss.deleted = append(fss.deleted, req.URL.Path)
+			delete(fss.applications, strings.TrimPrefix(req.URL.Path, "/applications/"))
+			w.WriteHeader(http.StatusNoContent)
+		case req.Method == http.MethodDelete && strings.HasPrefix(req.URL.Path, "/sources/"):
+			fss.deleted = append(fss.deleted, req.URL.Path)
+			for ref, id := range fss.sources {
+				if "/sources/"+id == req.URL.Path {
+					delete(fss.sources, ref)
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return fss
+}
+
+func newTestHttpSourcesRecorder(t *testing.T, url string) *HttpSourcesRecorder {
+	recorder, err := NewHttpSourcesRecorder(HttpSourcesConfig{
+		BaseURL:    url,
+		Timeout:    time.Second,
+		MaxRetries: 3,
+		RetryDelay: time.Millisecond,
+	}, metrics)
+	if err != nil {
+		t.Fatalf("Unexpected error creating the sources recorder: %s", err)
+	}
+	return recorder
+}
+
+var testSource = SourceRegistration{
+	SourceRef:       "client-1",
+	Name:            "client-1",
+	SourceType:      "ansible-tower",
+	ApplicationType: "/insights/platform/catalog",
+}
+
+func TestHttpSourcesRecorderRegistersSource(t *testing.T) {
+	service := startFakeSourcesService(0)
+	defer service.server.Close()
+
+	recorder := newTestHttpSourcesRecorder(t, service.server.URL)
+
+	if err := recorder.RegisterWithSources(context.TODO(), "identity", "1234", testSource); err != nil {
+		t.Fatalf("Unexpected error registering the source: %s", err)
+	}
+
+	if len(service.created) != 1 {
+		t.Fatalf("Expected the source to be created, got %d creates", len(service.created))
+	}
+
+	created := service.created[0]
+	if created.Sources[0].SourceRef != "client-1" || created.Sources[0].SourceTypeName != "ansible-tower" ||
+		created.Applications[0].SourceName != "client-1" || created.Applications[0].ApplicationTypeName != "/insights/platform/catalog" {
+		t.Fatalf("Unexpected source created: %+v", created)
+	}
+
+	for _, identityHeader := range service.identityHeaders {
+		if identityHeader != "identity" {
+			t.Fatalf("Expected the identity header to be passed to sources, got %s", identityHeader)
+		}
+	}
+}
+
+func TestHttpSourcesRecorderReRegistrationIsIdempotent(t *testing.T) {
+	service := startFakeSourcesService(0)
+	defer service.server.Close()
+
+	recorder := newTestHttpSourcesRecorder(t, service.server.URL)
+
+	for i := 0; i < 2; i++ {
+		if err := recorder.RegisterWithSources(context.TODO(), "identity", "1234", testSource); err != nil {
+			t.Fatalf("Unexpected error registering the source: %s", err)
+		}
+	}
+
+	if len(service.created) != 1 || len(service.createdApplications) != 0 {
+		t.Fatalf("Expected the source to be created once, got %d creates", len(service.created))
+	}
+}
+
+func TestHttpSourcesRecorderTreatsConflictAsRegistered(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet {
+			w.Write([]byte(`{"data": []}`))
+			return
+		}
+		w.WriteHeader(http.StatusConflict)
+	}))
+	defer server.Close()
+
+	recorder := newTestHttpSourcesRecorder(t, server.URL)
+
+	if err := recorder.RegisterWithSources(context.TODO(), "identity", "1234", testSource); err != nil {
+		t.Fatalf("Expected a conflict to be treated as already registered, got %s", err)
+	}
+}
+
+func TestHttpSourcesRecorderRetriesServerErrors(t *testing.T) {
+	service := startFakeSourcesService(2)
+	defer service.server.Close()
+
+	recorder := newTestHttpSourcesRecorder(t, service.server.URL)
+
+	if err := recorder.RegisterWithSources(context.TODO(), "identity", "1234", testSource); err != nil {
+		t.Fatalf("Expected the registration to succeed after retrying, got %s", err)
+	}
+
+	if len(service.created) != 1 {
+		t.Fatalf("Expected the source to be created, got %d creates", len(service.created))
+	}
+}
+
+func TestHttpSourcesRecorderGivesUpAfterMaxRetries(t *testing.T) {
+	service := startFakeSourcesService(10)
+	defer service.server.Close()
+
+	recorder := newTestHttpSourcesRecorder(t, service.server.URL)
+
+	if err := recorder.RegisterWithSources(context.TODO(), "identity", "1234", testSource); errors.Is(err, ErrDownstreamUnavailable) == false {
+		t.Fatalf("Expected ErrDownstreamUnavailable after the retries were exhausted, got %v", err)
+	}
+
+	if len(service.identityHeaders) != 4 {
+		t.Fatalf("Expected 4 attempts, got %d", len(service.identityHeaders))
+	}
+}
+
+func TestHttpSourcesRecorderUnregistersSource(t *testing.T) {
+	service := startFakeSourcesService(0)
+	defer service.server.Close()
+
+	recorder := newTestHttpSourcesRecorder(t, service.server.URL)
+
+	if err := recorder.UnregisterFromSources(context.TODO(), "identity", "1234", testSource); err != nil {
+		t.Fatalf("Expected unregistering an unknown source to succeed, got %s", err)
+	}
+
+	if len(service.deleted) != 0 {
+		t.Fatalf("Expected nothing to be deleted, got %v", service.deleted)
+	}
+
+	recorder.RegisterWithSources(context.TODO(), "identity", "1234", testSource)
+
+	if err := recorder.UnregisterFromSources(context.TODO(), "identity", "1234", testSource); err != nil {
+		t.Fatalf("Unexpected error unregistering the source: %s", err)
+	}
+
+	if reflect.DeepEqual(service.deleted, []string{"/applications/2", "/sources/1"}) == false {
+		t.Fatalf("Expected the application and the source to be deleted, got %v", service.deleted)
+	}
+}
+
+var testRemediationsSource = SourceRegistration{
+	SourceRef:       "client-1",
+	Name:            "client-1",
+	SourceType:      "ansible-tower",
+	ApplicationType: "/insights/platform/remediations",
+}
+
+func TestHttpSourcesRecorderKeepsTheSourceOfTheRemainingDispatchers(t *testing.T) {
+	service := startFakeSourcesService(0)
+	defer service.server.Close()
+
+	recorder := newTestHttpSourcesRecorder(t, service.server.URL)
+
+	for _, source := range []SourceRegistration{testSource, testRemediationsSource} {
+		if err := recorder.RegisterWithSources(context.TODO(), "identity", "1234", source); err != nil {
+			t.Fatalf("Unexpected error registering the source: %s", err)
+		}
+	}
+
+	if len(service.created) != 1 || len(service.createdApplications) != 1 || service.createdApplications[0].ApplicationTypeID != "101" {
+		t.Fatalf("Expected the second dispatcher to add an application to the source, got %+v", service.createdApplications)
+	}
+
+	if err := recorder.UnregisterFromSources(context.TODO(), "identity", "1234", testSource); err != nil {
+		t.Fatalf("Unexpected error unregistering the source: %s", err)
+	}
+
+	if reflect.DeepEqual(service.deleted, []string{"/applications/2"}) == false {
+		t.Fatalf("Expected only the lost dispatcher's application to be deleted, got %v", service.deleted)
+	}
+
+	if err := recorder.UnregisterFromSources(context.TODO(), "identity", "1234", testRemediationsSource); err != nil {
+		t.Fatalf("Unexpected error unregistering the source: %s", err)
+	}
+
+	if reflect.DeepEqual(service.deleted, []string{"/applications/2", "/applications/3", "/sources/1"}) == false {
+		t.Fatalf("Expected the source to be deleted with its last application, got %v", service.deleted)
+	}
+}
+
+func TestHttpSourcesRecorderStopsRetryingWhenTheContextIsDone(t *testing.T) {
+	service := startFakeSourcesService(10)
+	defer service.server.Close()
+
+	recorder, _ := NewHttpSourcesRecorder(HttpSourcesConfig{
+		BaseURL:    service.server.URL,
+		Timeout:    time.Second,
+		MaxRetries: 3,
+		RetryDelay: time.Hour,
+	}, metrics)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := recorder.RegisterWithSources(ctx, "identity", "1234", testSource); errors.Is(err, ErrDownstreamUnavailable) == false {
+		t.Fatalf("Expected ErrDownstreamUnavailable once the context was done, got %v", err)
+	}
+}
+
+func TestFakeSourcesRecorder(t *testing.T) {
+	recorder, err := NewSourcesRecorder("fake", HttpSourcesConfig{}, metrics)
+	if err != nil {
+		t.Fatalf("Unexpected error creating the sources recorder: %s", err)
+	}
+
+	fake := recorder.(*FakeSourcesRecorder)
+
+	fake.RegisterWithSources(context.TODO(), "identity", "1234", testSource)
+	if source, found := fake.Registered("client-1", testSource.ApplicationType); found == false || source != testSource {
+		t.Fatalf("Expected the source to be registered, got %+v", source)
+	}
+
+	fake.UnregisterFromSources(context.TODO(), "identity", "1234", testSource)
+	if _, found := fake.Registered("client-1", testSource.ApplicationType); found {
+		t.Fatalf("Expected the source to be unregistered")
+	}
+}
+
+func TestInvalidSourcesRecorder(t *testing.T) {
+	if _, err := NewSourcesRecorder("fred", HttpSourcesConfig{}, metrics); err != ErrInvalidSourcesRecorder {
+		t.Fatalf("Expected ErrInvalidSourcesRecorder, but got %v", err)
+	}
+
+	if _, err := NewSourcesRecorder("http", HttpSourcesConfig{}, metrics); err != ErrMissingSourcesBaseURL {
+		t.Fatalf("Expected ErrMissingSourcesBaseURL, but got %v", err)
+	}
+
+	if _, err := NewSourcesRecorder("http", HttpSourcesConfig{BaseURL: "http://sources"}, metrics); err != ErrInvalidSourcesTimeout {
+		t.Fatalf("Expected ErrInvalidSourcesTimeout, but got %v", err)
+	}
+}
@@ -3,6 +3,9 @@ package controller
 import (
 	"context"
 	"errors"
+	"fmt"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
 
 	"github.com/google/uuid"
 )
@@ -12,7 +15,66 @@ var (
 	ErrDisconnectedNode    = errors.New("disconnected node")
 )
 
+// MessageTooLargeError is returned when a message is not sent to a client because its
+// payload is larger than the size limit for the message's directive
+type MessageTooLargeError struct {
+	Directive string
+	Size      int
+	Limit     int
+}
+
+func (e *MessageTooLargeError) Error() string {
+	return fmt.Sprintf("message payload for directive %q is %d bytes, which exceeds the limit of %d bytes", e.Directive, e.Size, e.Limit)
+}
+
 type Receptor interface {
 	SendMessage(context.Context, string, string, interface{}, string) (*uuid.UUID, error)
 	Close(context.Context) error
 }
+
+// ReceptorFactory creates a Receptor that can be used to communicate with a
+// connected client
+type ReceptorFactory func(account string, nodeID string) Receptor
+
+// ClientDetailer is implemented by Receptors that are able to provide the
+// details that the client reported when it connected
+type ClientDetailer interface {
+	ClientDetails() domain.RhcClient
+}
+
+// HandshakeRecorder is implemented by Receptors that keep a copy of the handshake
+// that the client sent when it connected
+type HandshakeRecorder interface {
+	RawHandshake() []byte
+}
+
+// ClientReconnector asks a connected client to disconnect and reconnect after
+// the delay (in seconds) has passed
+type ClientReconnector interface {
+	Reconnect(context.Context, domain.ClientID, int) error
+}
+
+// MessagePreview is a message that would be published to a client along with the
+// topic that it would be published to
+type MessagePreview struct {
+	Topic   string      `json:"topic"`
+	Message interface{} `json:"message"`
+}
+
+// MessagePreviewer is implemented by Receptors that are able to build the messages
+// that SendMessage would publish without publishing them
+type MessagePreviewer interface {
+	PreviewMessage(context.Context, string, string, interface{}, string) (*uuid.UUID, []MessagePreview, error)
+}
+
+// ReconnectPreviewer is implemented by ClientReconnectors that are able to build the
+// reconnect command without publishing it
+type ReconnectPreviewer interface {
+	PreviewReconnect(context.Context, domain.ClientID, int) (MessagePreview, error)
+}
+
+// DataMessageSender publishes a data message, containing the payload for the
+// directive, to the connected client
+type DataMessageSender interface {
+	SendDataMessage(context.Context, domain.ClientID, string, interface{}) (*uuid.UUID, error)
+}
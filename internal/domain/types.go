@@ -1,13 +1,148 @@
 package domain
 
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	MaxClientIDLength  = 128
+	MaxAccountIDLength = 64
+)
+
+var (
+	ErrInvalidClientID  = errors.New("Invalid client id")
+	ErrInvalidAccountID = errors.New("Invalid account id")
+)
+
 type ClientID string
 
 func (cid ClientID) String() string {
 	return string(cid)
 }
 
+// Validate rejects client ids that are empty, padded with whitespace or longer than
+// MaxClientIDLength
+func (cid ClientID) Validate() error {
+	return validateID(string(cid), MaxClientIDLength, ErrInvalidClientID)
+}
+
+// UnmarshalJSON rejects client ids that are empty (after trimming whitespace) or
+// longer than MaxClientIDLength
+func (cid *ClientID) UnmarshalJSON(data []byte) error {
+	value, err := unmarshalID(data, MaxClientIDLength, ErrInvalidClientID)
+	if err != nil {
+		return err
+	}
+
+	*cid = ClientID(value)
+	return nil
+}
+
 type AccountID string
 
 func (aid AccountID) String() string {
 	return string(aid)
 }
+
+// Validate rejects account ids that are empty, padded with whitespace or longer than
+// MaxAccountIDLength
+func (aid AccountID) Validate() error {
+	return validateID(string(aid), MaxAccountIDLength, ErrInvalidAccountID)
+}
+
+// UnmarshalJSON rejects account ids that are empty (after trimming whitespace) or
+// longer than MaxAccountIDLength
+func (aid *AccountID) UnmarshalJSON(data []byte) error {
+	value, err := unmarshalID(data, MaxAccountIDLength, ErrInvalidAccountID)
+	if err != nil {
+		return err
+	}
+
+	*aid = AccountID(value)
+	return nil
+}
+
+func unmarshalID(data []byte, maxLength int, errInvalid error) (string, error) {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return "", errInvalid
+	}
+
+	value = strings.TrimSpace(value)
+
+	if err := validateID(value, maxLength, errInvalid); err != nil {
+		return "", err
+	}
+
+	return value, nil
+}
+
+func validateID(value string, maxLength int, errInvalid error) error {
+	if value == "" || value != strings.TrimSpace(value) || len(value) > maxLength {
+		return errInvalid
+	}
+	return nil
+}
+
+type OrgID string
+
+func (oid OrgID) String() string {
+	return string(oid)
+}
+
+// CanonicalFacts are the facts that a client reports to identify the host that it is running on
+type CanonicalFacts map[string]interface{}
+
+// Identity describes the tenant on whose behalf a request is made to a
+// downstream service
+type Identity struct {
+	AccountNumber AccountID
+	OrgID         OrgID
+	Type          string
+}
+
+const (
+	SourcesRegistrationRegistered   = "registered"
+	SourcesRegistrationUnregistered = "unregistered"
+	SourcesRegistrationFailed       = "failed"
+	SourcesRegistrationSkipped      = "skipped"
+)
+
+// DispatchersResult describes the outcome of processing the dispatchers that a
+// client reported during its handshake
+type DispatchersResult struct {
+	Dispatchers         []string `json:"dispatchers"`
+	Gained              []string `json:"gained,omitempty"`
+	Lost                []string `json:"lost,omitempty"`
+	SourcesRegistration string   `json:"sources_registration"`
+	Detail              string   `json:"detail,omitempty"`
+}
+
+type RhcClient struct {
+	ClientID           ClientID           `json:"client_id"`
+	Account            AccountID          `json:"account"`
+	OrgID              OrgID              `json:"org_id,omitempty"`
+	CanonicalFacts     CanonicalFacts     `json:"canonical_facts,omitempty"`
+	CanonicalFactsHash string             `json:"canonical_facts_hash,omitempty"`
+	DisplayName        string             `json:"display_name,omitempty"`
+	Dispatchers        interface{}        `json:"dispatchers,omitempty"`
+	DispatchersResult  *DispatchersResult `json:"dispatchers_result,omitempty"`
+	Capabilities       []string           `json:"capabilities,omitempty"`
+
+	// ConnectedAt is when the client sent the online message of its current session.
+	// It tells a late offline message from a previous session apart from the current
+	// session's offline message.
+	ConnectedAt *time.Time `json:"connected_at,omitempty"`
+}
+
+func (c RhcClient) HasCapability(capability string) bool {
+	for _, advertised := range c.Capabilities {
+		if advertised == capability {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package domain
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshalClientID(t *testing.T) {
+	var tests = []struct {
+		input    string
+		expected ClientID
+		err      error
+	}{
+		{`"client-1"`, "client-1", nil},
+		{`"  client-1 "`, "client-1", nil},
+		{`""`, "", ErrInvalidClientID},
+		{`"   "`, "", ErrInvalidClientID},
+		{`"` + strings.Repeat("a", MaxClientIDLength) + `"`, ClientID(strings.Repeat("a", MaxClientIDLength)), nil},
+		{`"` + strings.Repeat("a", MaxClientIDLength+1) + `"`, "", ErrInvalidClientID},
+		{`5`, "", ErrInvalidClientID},
+		{`null`, "", ErrInvalidClientID},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			var clientID ClientID
+			err := json.Unmarshal([]byte(tc.input), &clientID)
+			if err != tc.err {
+				t.Fatalf("Expected error %v, but got %v", tc.err, err)
+			}
+
+			if clientID != tc.expected {
+				t.Fatalf("Expected client id %s, but got %s", tc.expected, clientID)
+			}
+		})
+	}
+}
+
+func TestUnmarshalAccountID(t *testing.T) {
+	var tests = []struct {
+		input    string
+		expected AccountID
+		err      error
+	}{
+		{`"540155"`, "540155", nil},
+		{`" 540155\n"`, "540155", nil},
+		{`""`, "", ErrInvalidAccountID},
+		{`"` + strings.Repeat("1", MaxAccountIDLength+1) + `"`, "", ErrInvalidAccountID},
+		{`{}`, "", ErrInvalidAccountID},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			var account AccountID
+			err := json.Unmarshal([]byte(tc.input), &account)
+			if err != tc.err {
+				t.Fatalf("Expected error %v, but got %v", tc.err, err)
+			}
+
+			if account != tc.expected {
+				t.Fatalf("Expected account %s, but got %s", tc.expected, account)
+			}
+		})
+	}
+}
+
+func TestUnmarshalRhcClientWithInvalidClientID(t *testing.T) {
+	var client RhcClient
+	if err := json.Unmarshal([]byte(`{"client_id": " ", "account": "540155"}`), &client); err == nil {
+		t.Fatalf("Expected the blank client id to be rejected")
+	}
+}
+
+func TestMarshalIDsLeavesValuesUnchanged(t *testing.T) {
+	client := RhcClient{ClientID: " client-1 ", Account: "540155 "}
+
+	data, err := json.Marshal(client)
+	if err != nil {
+		t.Fatalf("Unexpected error marshalling the client: %s", err)
+	}
+
+	if strings.Contains(string(data), `"client_id":" client-1 "`) == false || strings.Contains(string(data), `"account":"540155 "`) == false {
+		t.Fatalf("Expected the ids to be marshalled as they are, but got %s", data)
+	}
+}
+
+func TestValidateIDs(t *testing.T) {
+	var tests = []struct {
+		name     string
+		id       interface{ Validate() error }
+		expected error
+	}{
+		{"valid client id", ClientID("client-1"), nil},
+		{"empty client id", ClientID(""), ErrInvalidClientID},
+		{"padded client id", ClientID(" client-1"), ErrInvalidClientID},
+		{"long client id", ClientID(strings.Repeat("a", MaxClientIDLength+1)), ErrInvalidClientID},
+		{"valid account id", AccountID("540155"), nil},
+		{"empty account id", AccountID(""), ErrInvalidAccountID},
+		{"padded account id", AccountID("540155\t"), ErrInvalidAccountID},
+		{"long account id", AccountID(strings.Repeat("1", MaxAccountIDLength+1)), ErrInvalidAccountID},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.id.Validate(); err != tc.expected {
+				t.Fatalf("Expected %v, but got %v", tc.expected, err)
+			}
+		})
+	}
+}
@@ -109,28 +109,48 @@ func (amw *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 		if r.Header.Get(identityHeader) != "" { // identity header auth
 			identity.EnforceIdentity(next).ServeHTTP(w, r)
 		} else { // token auth
-			sr, err := newServiceCredentials(
-				r.Header.Get(clientHeader),
-				r.Header.Get(accountHeader),
-				r.Header.Get(pskHeader),
-			)
-			if err != nil {
-				logger.Log.WithFields(logrus.Fields{"error": err}).Debug("Authentication failure")
-				http.Error(w, authErrorMessage, 401)
-				return
-			}
-			logger.Log.Debugf("Received service to service request from %v using account:%v", sr.clientID, sr.account)
-			validator := serviceCredentialsValidator{knownServiceCredentials: amw.Secrets}
-			if err := validator.validate(sr); err != nil {
-				logger.Log.WithFields(logrus.Fields{"error": err}).Debug("Authentication failure")
-				http.Error(w, authErrorMessage, 401)
-				return
-			}
-
-			principal := serviceToServicePrincipal{account: sr.account, clientID: sr.clientID}
-
-			ctx := context.WithValue(r.Context(), principalKey, principal)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			amw.authenticateServiceToService(w, r, next)
 		}
 	})
 }
+
+// AuthenticateServiceToService only accepts service to service credentials.  It is used
+// for the endpoints that are called by other services (the broker, for example) and
+// that must not be reachable with a customer's identity header.
+func (amw *AuthMiddleware) AuthenticateServiceToService(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		amw.authenticateServiceToService(w, r, next)
+	})
+}
+
+func (amw *AuthMiddleware) authenticateServiceToService(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	sr, err := newServiceCredentials(
+		r.Header.Get(clientHeader),
+		r.Header.Get(accountHeader),
+		r.Header.Get(pskHeader),
+	)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{"error": err}).Debug("Authentication failure")
+		http.Error(w, authErrorMessage, 401)
+		return
+	}
+	logger.Log.Debugf("Received service to service request from %v using account:%v", sr.clientID, sr.account)
+	validator := serviceCredentialsValidator{knownServiceCredentials: amw.Secrets}
+	if err := validator.validate(sr); err != nil {
+		logger.Log.WithFields(logrus.Fields{"error": err}).Debug("Authentication failure")
+		http.Error(w, authErrorMessage, 401)
+		return
+	}
+
+	principal := serviceToServicePrincipal{account: sr.account, clientID: sr.clientID}
+
+	ctx := context.WithValue(r.Context(), principalKey, principal)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// IsServiceToService returns true if the principal was authenticated with service to
+// service credentials rather than a customer's identity header
+func IsServiceToService(p Principal) bool {
+	_, ok := p.(serviceToServicePrincipal)
+	return ok
+}
@@ -120,4 +120,31 @@ var _ = Describe("Auth", func() {
 
 	})
 
+	Describe("Requiring service to service authentication", func() {
+		serviceToService := func(req *http.Request) *httptest.ResponseRecorder {
+			rr := httptest.NewRecorder()
+			handler := amw.AuthenticateServiceToService(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				principal, ok := middlewares.GetPrincipal(req.Context())
+				Expect(ok).To(Equal(true))
+				Expect(middlewares.IsServiceToService(principal)).To(Equal(true))
+			}))
+			handler.ServeHTTP(rr, req)
+			return rr
+		}
+
+		It("Should return 200 when the key is correct", func() {
+			req.Header.Add(TOKEN_HEADER_CLIENT_NAME, "test_client_1")
+			req.Header.Add(TOKEN_HEADER_ACCOUNT_NAME, EXPECTED_ACCOUNT_FROM_TOKEN)
+			req.Header.Add(TOKEN_HEADER_PSK_NAME, "12345")
+
+			Expect(serviceToService(req).Code).To(Equal(200))
+		})
+
+		It("Should return 401 for an identity header", func() {
+			req.Header.Add(IDENTITY_HEADER_NAME, VALID_IDENTITY_HEADER)
+
+			Expect(serviceToService(req).Code).To(Equal(401))
+		})
+	})
+
 })
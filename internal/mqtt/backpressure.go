@@ -0,0 +1,121 @@
+package mqtt
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+// backpressureMonitor counts the messages received from each client within a
+// window.  When the number of messages received within the window exceeds the
+// threshold, the noisiest clients are selected to be throttled.  Clients are
+// selected at most once per window and the counts are discarded when the window
+// ends, which bounds the amount of state that is kept.
+type backpressureMonitor struct {
+	threshold           int
+	window              time.Duration
+	maxClients          int
+	windowStart         time.Time
+	total               int
+	counts              map[domain.ClientID]int
+	throttledThisWindow bool
+	sync.Mutex
+}
+
+func newBackpressureMonitor(threshold int, window time.Duration, maxClients int) *backpressureMonitor {
+	return &backpressureMonitor{
+		threshold:  threshold,
+		window:     window,
+		maxClients: maxClients,
+		counts:     make(map[domain.ClientID]int),
+	}
+}
+
+func (bm *backpressureMonitor) enabled() bool {
+	return bm.threshold > 0 && bm.maxClients > 0
+}
+
+// recordMessage counts the message and returns the clients that should be
+// throttled.  The returned list is empty unless the threshold was just exceeded.
+func (bm *backpressureMonitor) recordMessage(clientID domain.ClientID, now time.Time) []domain.ClientID {
+	if bm.enabled() == false {
+		return nil
+	}
+
+	bm.Lock()
+	defer bm.Unlock()
+
+	if now.Sub(bm.windowStart) > bm.window {
+		bm.windowStart = now
+		bm.total = 0
+		bm.counts = make(map[domain.ClientID]int)
+		bm.throttledThisWindow = false
+	}
+
+	bm.total++
+	bm.counts[clientID]++
+
+	if bm.total <= bm.threshold || bm.throttledThisWindow {
+		return nil
+	}
+
+	bm.throttledThisWindow = true
+
+	return bm.noisiestClients()
+}
+
+// messageCount returns the number of messages received from the client in the current window
+func (bm *backpressureMonitor) messageCount(clientID domain.ClientID) int {
+	bm.Lock()
+	defer bm.Unlock()
+
+	return bm.counts[clientID]
+}
+
+// reset discards the messages received from the client in the current window
+func (bm *backpressureMonitor) reset(clientID domain.ClientID) {
+	bm.Lock()
+	defer bm.Unlock()
+
+	bm.total -= bm.counts[clientID]
+	delete(bm.counts, clientID)
+}
+
+func (bm *backpressureMonitor) noisiestClients() []domain.ClientID {
+	clients := make([]domain.ClientID, 0, len(bm.counts))
+	for clientID := range bm.counts {
+		clients = append(clients, clientID)
+	}
+
+	sort.Slice(clients, func(i, j int) bool {
+		if bm.counts[clients[i]] == bm.counts[clients[j]] {
+			return clients[i] < clients[j]
+		}
+		return bm.counts[clients[i]] > bm.counts[clients[j]]
+	})
+
+	if len(clients) > bm.maxClients {
+		clients = clients[:bm.maxClients]
+	}
+
+	return clients
+}
+
+func throttleClients(client MQTT.Client, topicBuilder *TopicBuilder, signer MessageSigner, timestampFormat string, clientIDs []domain.ClientID, interval int, metrics *Metrics) {
+	for _, clientID := range clientIDs {
+		_, err := sendThrottleMessageToClient(client, topicBuilder, signer, timestampFormat, clientID, interval)
+		if err != nil {
+			logger.Log.WithFields(logrus.Fields{"clientID": clientID, "error": err}).Error("Unable to send throttle message to client")
+			continue
+		}
+
+		metrics.throttleCommandCounter.Inc()
+	}
+}
@@ -0,0 +1,130 @@
+package mqtt
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+type completedToken struct{}
+
+func (t completedToken) Wait() bool                     { return true }
+func (t completedToken) WaitTimeout(time.Duration) bool { return true }
+func (t completedToken) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+func (t completedToken) Error() error { return nil }
+
+type publishedMessage struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  []byte
+}
+
+type publishRecordingClient struct {
+	MQTT.Client
+	published []publishedMessage
+}
+
+func (c *publishRecordingClient) Publish(topic string, qos byte, retained bool, payload interface{}) MQTT.Token {
+	// Retained messages are cleared by publishing an empty string
+	var payloadBytes []byte
+	switch p := payload.(type) {
+	case []byte:
+		payloadBytes = p
+	case string:
+		payloadBytes = []byte(p)
+	}
+
+	c.published = append(c.published, publishedMessage{topic: topic, qos: qos, retained: retained, payload: payloadBytes})
+	return completedToken{}
+}
+
+func TestBuildThrottleMessage(t *testing.T) {
+	_, msg, err := buildThrottleMessage(300, TimestampFormatRFC3339)
+	if err != nil {
+		t.Fatalf("Unexpected error building the throttle message: %s", err)
+	}
+
+	content := msg.Content.(CommandMessageContent)
+	args := content.Arguments.(map[string]interface{})
+
+	if msg.MessageType != "command" || content.Command != throttleCommand || args["interval"] != 300 {
+		t.Fatalf("Unexpected throttle message: %+v", msg)
+	}
+}
+
+func TestBackpressureTargetsNoisiestClients(t *testing.T) {
+	bm := newBackpressureMonitor(5, time.Minute, 2)
+	now := time.Now()
+
+	var throttled []domain.ClientID
+	for _, clientID := range []domain.ClientID{"quiet", "noisy", "noisier", "noisy", "noisier", "noisier"} {
+		throttled = bm.recordMessage(clientID, now)
+	}
+
+	expected := []domain.ClientID{"noisier", "noisy"}
+	if reflect.DeepEqual(throttled, expected) == false {
+		t.Fatalf("Expected %v to be throttled, but got %v", expected, throttled)
+	}
+
+	if throttled = bm.recordMessage("noisier", now); len(throttled) != 0 {
+		t.Fatalf("Expected clients to only be throttled once per window, but got %v", throttled)
+	}
+}
+
+func TestBackpressureBelowThreshold(t *testing.T) {
+	bm := newBackpressureMonitor(5, time.Minute, 2)
+	now := time.Now()
+
+	for i := 0; i < 5; i++ {
+		if throttled := bm.recordMessage("client-1", now); len(throttled) != 0 {
+			t.Fatalf("Expected no clients to be throttled below the threshold, but got %v", throttled)
+		}
+	}
+
+	// The counts are reset once the window has passed
+	for i := 0; i < 5; i++ {
+		if throttled := bm.recordMessage("client-1", now.Add(2*time.Minute)); len(throttled) != 0 {
+			t.Fatalf("Expected no clients to be throttled in a new window, but got %v", throttled)
+		}
+	}
+}
+
+func TestBackpressureDisabled(t *testing.T) {
+	bm := newBackpressureMonitor(0, time.Minute, 2)
+
+	if throttled := bm.recordMessage("client-1", time.Now()); throttled != nil {
+		t.Fatalf("Expected backpressure to be disabled, but got %v", throttled)
+	}
+}
+
+func TestThrottleClients(t *testing.T) {
+	client := &publishRecordingClient{}
+
+	throttleClients(client, NewTopicBuilder(), nil, TimestampFormatRFC3339, []domain.ClientID{"client-1", "client-2"}, 300, metrics)
+
+	if len(client.published) != 2 {
+		t.Fatalf("Expected 2 throttle messages to be published, but got %d", len(client.published))
+	}
+
+	for i, clientID := range []string{"client-1", "client-2"} {
+		expectedTopic := "redhat/insights/" + clientID + "/control/in"
+		if client.published[i].topic != expectedTopic {
+			t.Fatalf("Expected the throttle message to be published to %s, but got %s", expectedTopic, client.published[i].topic)
+		}
+
+		msg := unmarshalControlMessage(t, string(client.published[i].payload))
+		content := msg.Content.(map[string]interface{})
+		if content["command"] != throttleCommand || content["arguments"].(map[string]interface{})["interval"] != float64(300) {
+			t.Fatalf("Unexpected throttle message: %s", client.published[i].payload)
+		}
+	}
+}
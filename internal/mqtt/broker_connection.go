@@ -0,0 +1,260 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"strings"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+type MqttClientOptionsFunc func(*MQTT.ClientOptions)
+
+func WithTlsConfig(tlsConfig *tls.Config) MqttClientOptionsFunc {
+	return func(opts *MQTT.ClientOptions) {
+		opts.SetTLSConfig(tlsConfig)
+	}
+}
+
+func WithClientID(clientID string) MqttClientOptionsFunc {
+	return func(opts *MQTT.ClientOptions) {
+		opts.SetClientID(clientID)
+	}
+}
+
+func WithConnectionLostHandler(connectionLostHandler MQTT.ConnectionLostHandler) MqttClientOptionsFunc {
+	return func(opts *MQTT.ClientOptions) {
+		opts.SetConnectionLostHandler(connectionLostHandler)
+	}
+}
+
+// WithReconnectingHandler sets the handler that is called before each attempt to
+// reconnect after the connection to the broker was lost
+func WithReconnectingHandler(reconnectingHandler MQTT.ReconnectHandler) MqttClientOptionsFunc {
+	return func(opts *MQTT.ClientOptions) {
+		opts.SetReconnectingHandler(reconnectingHandler)
+	}
+}
+
+// WithResumeSubs controls whether subscriptions that were in flight when the
+// connection was lost are resumed from the session store on reconnect
+func WithResumeSubs(resumeSubs bool) MqttClientOptionsFunc {
+	return func(opts *MQTT.ClientOptions) {
+		opts.SetResumeSubs(resumeSubs)
+	}
+}
+
+// WithOrderMatters controls whether messages are handed to the message handlers
+// in the order they were received.  When disabled, each message is handled in
+// its own goroutine.
+func WithOrderMatters(orderMatters bool) MqttClientOptionsFunc {
+	return func(opts *MQTT.ClientOptions) {
+		opts.SetOrderMatters(orderMatters)
+	}
+}
+
+// WithConnectRetry controls whether the initial connection to the broker is retried
+// (every retryInterval) instead of failing when none of the brokers can be reached.
+// paho keeps retrying until it connects, so it must not be combined with a
+// ConnectBackoff that makes more than one attempt.
+func WithConnectRetry(connectRetry bool, retryInterval time.Duration) MqttClientOptionsFunc {
+	return func(opts *MQTT.ClientOptions) {
+		opts.SetConnectRetry(connectRetry)
+		if retryInterval > 0 {
+			opts.SetConnectRetryInterval(retryInterval)
+		}
+	}
+}
+
+// WithKeepAlive sets how often the client pings the broker when the connection is idle
+// and how long the client waits for the broker to answer the ping before considering
+// the connection lost.  The keep alive is sent to the broker in the CONNECT packet and
+// the broker disconnects the client if it does not hear from the client within 1.5 times
+// the keep alive (some brokers cap the keep alive that a client can ask for).  Load
+// balancers between the client and the broker drop connections that are idle for longer
+// than their own idle timeout, so the keep alive must be shorter than that timeout.  A
+// zero keep alive leaves paho's default in place.
+func WithKeepAlive(keepAlive time.Duration, pingTimeout time.Duration) MqttClientOptionsFunc {
+	return func(opts *MQTT.ClientOptions) {
+		if keepAlive > 0 {
+			opts.SetKeepAlive(keepAlive)
+		}
+		if pingTimeout > 0 {
+			opts.SetPingTimeout(pingTimeout)
+		}
+	}
+}
+
+// WithMaxReconnectInterval caps the delay between the attempts to reconnect after the
+// connection to the broker was lost.  The delay starts at one second and doubles after
+// every failed attempt.
+func WithMaxReconnectInterval(maxReconnectInterval time.Duration) MqttClientOptionsFunc {
+	return func(opts *MQTT.ClientOptions) {
+		if maxReconnectInterval > 0 {
+			opts.SetMaxReconnectInterval(maxReconnectInterval)
+		}
+	}
+}
+
+// ParseBrokerUrls splits a comma separated list of broker urls
+func ParseBrokerUrls(brokerUrls string) []string {
+	urls := make([]string, 0)
+	for _, url := range strings.Split(brokerUrls, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+func NewBrokerOptions(brokerUrl string, opts ...MqttClientOptionsFunc) *MQTT.ClientOptions {
+	return NewMultiBrokerOptions([]string{brokerUrl}, opts...)
+}
+
+// NewMultiBrokerOptions builds the options for connecting to a cluster of brokers.  The
+// client tries the brokers in order when connecting and when reconnecting.
+func NewMultiBrokerOptions(brokerUrls []string, opts ...MqttClientOptionsFunc) *MQTT.ClientOptions {
+	connOpts := MQTT.NewClientOptions()
+
+	for _, brokerUrl := range brokerUrls {
+		connOpts.AddBroker(brokerUrl)
+	}
+
+	for _, opt := range opts {
+		opt(connOpts)
+	}
+
+	return connOpts
+}
+
+// ConnectBackoff controls how the initial connection to the broker is retried.  The
+// interval between attempts starts at InitialInterval and doubles after each failed
+// attempt, up to MaxInterval.
+type ConnectBackoff struct {
+	MaxAttempts     int
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+}
+
+func newConnectBackoff(cfg *config.Config) ConnectBackoff {
+	return ConnectBackoff{
+		MaxAttempts:     cfg.MqttConnectMaxAttempts,
+		InitialInterval: cfg.MqttConnectBackoffInitialInterval,
+		MaxInterval:     cfg.MqttConnectBackoffMaxInterval,
+	}
+}
+
+// interval returns how long to wait after the failed attempt (starting at 1) before
+// trying again
+func (cb ConnectBackoff) interval(attempt int) time.Duration {
+	interval := cb.InitialInterval
+	for i := 1; i < attempt && interval < cb.MaxInterval; i++ {
+		interval *= 2
+	}
+
+	if cb.MaxInterval > 0 && interval > cb.MaxInterval {
+		interval = cb.MaxInterval
+	}
+
+	return interval
+}
+
+// CreateBrokerConnection connects to the broker.  The onConnectHandler is optional
+// and can be nil for connections that are only used for publishing messages.
+func CreateBrokerConnection(connOpts *MQTT.ClientOptions, onConnectHandler MQTT.OnConnectHandler) (MQTT.Client, error) {
+	return CreateBrokerConnectionWithRetry(context.Background(), connOpts, onConnectHandler, ConnectBackoff{MaxAttempts: 1})
+}
+
+// CreateBrokerConnectionWithRetry connects to the broker, retrying failed attempts so
+// that a broker that is restarting does not stop us from starting up.  An error is
+// returned once all of the attempts have failed or when the context is cancelled.
+func CreateBrokerConnectionWithRetry(ctx context.Context, connOpts *MQTT.ClientOptions, onConnectHandler MQTT.OnConnectHandler, backoff ConnectBackoff) (MQTT.Client, error) {
+
+	if onConnectHandler != nil {
+		connOpts.SetOnConnectHandler(onConnectHandler)
+	}
+
+	brokers := make([]string, 0, len(connOpts.Servers))
+	for _, server := range connOpts.Servers {
+		brokers = append(brokers, server.String())
+	}
+
+	logger := logger.Log.WithFields(logrus.Fields{"client_id": connOpts.ClientID, "brokers": brokers})
+
+	for attempt := 1; ; attempt++ {
+		attemptLogger := logger.WithFields(logrus.Fields{"attempt": attempt, "max_attempts": backoff.MaxAttempts})
+
+		attemptLogger.Debug("Connecting to broker")
+
+		client, err := connectToBroker(ctx, connOpts)
+		if err == nil {
+			attemptLogger.Info("Connected to broker")
+			return client, nil
+		}
+
+		if ctx.Err() != nil {
+			attemptLogger.Info("Stopped connecting to MQTT broker")
+			return nil, ctx.Err()
+		}
+
+		if attempt >= backoff.MaxAttempts {
+			attemptLogger.WithFields(logrus.Fields{"error": err}).Error("Unable to connect to MQTT broker")
+			return nil, err
+		}
+
+		retryIn := backoff.interval(attempt)
+
+		attemptLogger.WithFields(logrus.Fields{"error": err, "retry_in": retryIn}).Warn("Unable to connect to MQTT broker, retrying")
+
+		select {
+		case <-time.After(retryIn):
+		case <-ctx.Done():
+			attemptLogger.Info("Stopped connecting to MQTT broker")
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func connectToBroker(ctx context.Context, connOpts *MQTT.ClientOptions) (MQTT.Client, error) {
+	client := MQTT.NewClient(connOpts)
+
+	token := client.Connect()
+
+	select {
+	case <-token.Done():
+		if token.Error() != nil {
+			return nil, token.Error()
+		}
+		return client, nil
+	case <-ctx.Done():
+		// Stop the client from retrying the connection in the background
+		client.Disconnect(0)
+		return nil, ctx.Err()
+	}
+}
+
+// NewPublishOnlyConnection connects to the broker without subscribing to any
+// topics.  The connection can be used to send commands to the clients.
+func NewPublishOnlyConnection(ctx context.Context, cfg *config.Config, brokerUrls []string, tlsConfig *tls.Config, metrics *Metrics) (MQTT.Client, error) {
+
+	clientID := buildClientID(cfg.MqttClientId, cfg.MqttClientIdUniqueSuffix, generateClientIDSuffix)
+
+	monitor := newConnectionMonitor(clientID, metrics)
+
+	connOpts := NewMultiBrokerOptions(brokerUrls,
+		WithTlsConfig(tlsConfig),
+		WithClientID(clientID),
+		WithConnectionLostHandler(monitor.onConnectionLost),
+		WithReconnectingHandler(monitor.onReconnecting),
+		WithConnectRetry(cfg.MqttConnectRetry, cfg.MqttConnectRetryInterval),
+		WithKeepAlive(cfg.MqttKeepAlive, cfg.MqttPingTimeout),
+		WithMaxReconnectInterval(cfg.MqttMaxReconnectInterval))
+
+	return CreateBrokerConnectionWithRetry(ctx, connOpts, monitor.onConnect, newConnectBackoff(cfg))
+}
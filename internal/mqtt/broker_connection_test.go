@@ -0,0 +1,432 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type fakeBroker struct {
+	url      string
+	listener net.Listener
+	received chan packets.ControlPacket
+	conns    []net.Conn
+	sync.Mutex
+}
+
+// startFakeBroker starts a minimal broker that accepts connections, answers
+// CONNECT, PINGREQ and SUBSCRIBE packets and records the PUBLISH and SUBSCRIBE packets
+// that it receives
+func startFakeBroker(t *testing.T) *fakeBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start the fake broker: %s", err)
+	}
+
+	return serveFakeBroker(listener)
+}
+
+func serveFakeBroker(listener net.Listener) *fakeBroker {
+	broker := &fakeBroker{
+		url:      "tcp://" + listener.Addr().String(),
+		listener: listener,
+		received: make(chan packets.ControlPacket, 100),
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			broker.Lock()
+			broker.conns = append(broker.conns, conn)
+			broker.Unlock()
+
+			go broker.handleConnection(conn)
+		}
+	}()
+
+	return broker
+}
+
+func (fb *fakeBroker) stop() {
+	fb.listener.Close()
+}
+
+// dropConnections closes the connections of all connected clients
+func (fb *fakeBroker) dropConnections() {
+	fb.Lock()
+	defer fb.Unlock()
+
+	for _, conn := range fb.conns {
+		conn.Close()
+	}
+	fb.conns = nil
+}
+
+func (fb *fakeBroker) handleConnection(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		packet, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+
+		switch packet.(type) {
+		case *packets.ConnectPacket:
+			connack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+			connack.ReturnCode = packets.Accepted
+			connack.Write(conn)
+		case *packets.PingreqPacket:
+			packets.NewControlPacket(packets.Pingresp).Write(conn)
+		case *packets.SubscribePacket:
+			subscribe := packet.(*packets.SubscribePacket)
+			suback := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			suback.MessageID = subscribe.MessageID
+			suback.ReturnCodes = subscribe.Qoss
+			suback.Write(conn)
+			fb.received <- packet
+		case *packets.PublishPacket:
+			fb.received <- packet
+		case *packets.DisconnectPacket:
+			return
+		}
+	}
+}
+
+func TestCreateBrokerConnectionWithNilOnConnectHandler(t *testing.T) {
+	broker := startFakeBroker(t)
+	defer broker.stop()
+
+	connOpts := NewBrokerOptions(broker.url, WithClientID("publish-only"))
+
+	client, err := CreateBrokerConnection(connOpts, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error connecting to the broker: %s", err)
+	}
+	defer client.Disconnect(0)
+
+	if client.IsConnected() == false {
+		t.Fatalf("Expected the client to be connected")
+	}
+}
+
+func TestCreateBrokerConnectionWithOnConnectHandler(t *testing.T) {
+	broker := startFakeBroker(t)
+	defer broker.stop()
+
+	connected := make(chan struct{})
+
+	connOpts := NewBrokerOptions(broker.url)
+
+	client, err := CreateBrokerConnection(connOpts, func(MQTT.Client) {
+		close(connected)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error connecting to the broker: %s", err)
+	}
+	defer client.Disconnect(0)
+
+	select {
+	case <-connected:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the OnConnect handler to be called")
+	}
+}
+
+func TestPublishOnlyConnectionSendsReconnect(t *testing.T) {
+	broker := startFakeBroker(t)
+	defer broker.stop()
+
+	cfg := config.GetConfig()
+
+	client, err := NewPublishOnlyConnection(context.Background(), cfg, []string{broker.url}, nil, metrics)
+	if err != nil {
+		t.Fatalf("Unexpected error connecting to the broker: %s", err)
+	}
+	defer client.Disconnect(0)
+
+	sender := NewControlMessageSender(client, NewTopicBuilder())
+
+	if err := sender.Reconnect(context.TODO(), "client-1", 30); err != nil {
+		t.Fatalf("Unexpected error sending the reconnect command: %s", err)
+	}
+
+	select {
+	case packet := <-broker.received:
+		publish, isPublish := packet.(*packets.PublishPacket)
+		if isPublish == false {
+			t.Fatalf("Expected the reconnect command to be published, but got %s", packet)
+		}
+
+		if publish.TopicName != "redhat/insights/client-1/control/in" {
+			t.Fatalf("Unexpected topic: %s", publish.TopicName)
+		}
+
+		msg := unmarshalControlMessage(t, string(publish.Payload))
+		content := msg.Content.(map[string]interface{})
+		if msg.MessageType != "command" || content["command"] != reconnectCommand {
+			t.Fatalf("Expected a reconnect command, but got %s", publish.Payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the reconnect command to be published")
+	}
+
+	select {
+	case packet := <-broker.received:
+		t.Fatalf("Expected the publish-only connection to not send anything else, but got %s", packet)
+	default:
+	}
+}
+
+func TestSubscriptionsAreReissuedOnReconnect(t *testing.T) {
+	broker := startFakeBroker(t)
+	defer broker.stop()
+
+	subscribers := []Subscriber{
+		Subscriber{
+			Topic:      "redhat/insights/+/control/out",
+			EntryPoint: func(MQTT.Client, MQTT.Message) {},
+			Qos:        1,
+		},
+	}
+
+	connOpts := NewBrokerOptions(broker.url, WithResumeSubs(false), WithOrderMatters(true), WithMaxReconnectInterval(100*time.Millisecond))
+	connOpts.SetCleanSession(true)
+
+	client, err := CreateBrokerConnection(connOpts, RegisterSubscribers(subscribers, NewSubscriptionTracker(metrics)))
+	if err != nil {
+		t.Fatalf("Unexpected error connecting to the broker: %s", err)
+	}
+	defer client.Disconnect(0)
+
+	verifySubscribe := func() {
+		t.Helper()
+
+		select {
+		case packet := <-broker.received:
+			subscribe, isSubscribe := packet.(*packets.SubscribePacket)
+			if isSubscribe == false {
+				t.Fatalf("Expected a subscribe packet, but got %s", packet)
+			}
+
+			if len(subscribe.Topics) != 1 || subscribe.Topics[0] != "redhat/insights/+/control/out" || subscribe.Qoss[0] != 1 {
+				t.Fatalf("Unexpected subscription: %v %v", subscribe.Topics, subscribe.Qoss)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected the client to subscribe to the control topic")
+		}
+	}
+
+	verifySubscribe()
+
+	broker.dropConnections()
+
+	// The broker discarded the subscriptions along with the clean session, so they
+	// need to be re-issued when the client reconnects
+	verifySubscribe()
+}
+
+func TestParseBrokerUrls(t *testing.T) {
+	var tests = []struct {
+		brokerUrls string
+		expected   []string
+	}{
+		{"ssl://broker-1:8883", []string{"ssl://broker-1:8883"}},
+		{"ssl://broker-1:8883, ssl://broker-2:8883", []string{"ssl://broker-1:8883", "ssl://broker-2:8883"}},
+		{"ssl://broker-1:8883,,", []string{"ssl://broker-1:8883"}},
+		{"", []string{}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.brokerUrls, func(t *testing.T) {
+			if actual := ParseBrokerUrls(tc.brokerUrls); reflect.DeepEqual(actual, tc.expected) == false {
+				t.Fatalf("Expected %v, but got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCreateBrokerConnectionFailsOver(t *testing.T) {
+	unavailableUrl := unavailableBrokerUrl(t)
+
+	broker := startFakeBroker(t)
+	defer broker.stop()
+
+	connOpts := NewMultiBrokerOptions([]string{unavailableUrl, broker.url}, WithConnectRetry(false, time.Second))
+	connOpts.SetConnectTimeout(time.Second)
+
+	if len(connOpts.Servers) != 2 {
+		t.Fatalf("Expected 2 brokers to be configured, but got %d", len(connOpts.Servers))
+	}
+
+	client, err := CreateBrokerConnection(connOpts, nil)
+	if err != nil {
+		t.Fatalf("Expected to fail over to the available broker, but got %s", err)
+	}
+	defer client.Disconnect(0)
+
+	if client.IsConnected() == false {
+		t.Fatalf("Expected the client to be connected")
+	}
+}
+
+// unavailableBrokerUrl returns the url of an address that nothing is listening on
+func unavailableBrokerUrl(t *testing.T) string {
+	unavailable, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to reserve an address: %s", err)
+	}
+	unavailable.Close()
+
+	return "tcp://" + unavailable.Addr().String()
+}
+
+func TestConnectBackoffInterval(t *testing.T) {
+	backoff := ConnectBackoff{MaxAttempts: 10, InitialInterval: time.Second, MaxInterval: 10 * time.Second}
+
+	var tests = []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{9, 10 * time.Second},
+	}
+
+	for _, tc := range tests {
+		if interval := backoff.interval(tc.attempt); interval != tc.expected {
+			t.Fatalf("Expected attempt %d to wait %s, got %s", tc.attempt, tc.expected, interval)
+		}
+	}
+}
+
+func TestCreateBrokerConnectionRetriesUntilBrokerIsAvailable(t *testing.T) {
+	brokerUrl := unavailableBrokerUrl(t)
+
+	started := make(chan *fakeBroker, 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		listener, err := net.Listen("tcp", brokerUrl[len("tcp://"):])
+		if err != nil {
+			close(started)
+			return
+		}
+		started <- serveFakeBroker(listener)
+	}()
+
+	backoff := ConnectBackoff{MaxAttempts: 50, InitialInterval: 10 * time.Millisecond, MaxInterval: 20 * time.Millisecond}
+
+	client, err := CreateBrokerConnectionWithRetry(context.Background(), NewBrokerOptions(brokerUrl), nil, backoff)
+
+	broker := <-started
+	if broker == nil {
+		t.Fatalf("Unable to start the fake broker")
+	}
+	defer broker.stop()
+
+	if err != nil {
+		t.Fatalf("Expected to connect once the broker was available, but got %s", err)
+	}
+	defer client.Disconnect(0)
+
+	if client.IsConnected() == false {
+		t.Fatalf("Expected the client to be connected")
+	}
+}
+
+func TestCreateBrokerConnectionGivesUpAfterMaxAttempts(t *testing.T) {
+	backoff := ConnectBackoff{MaxAttempts: 3, InitialInterval: time.Millisecond, MaxInterval: time.Millisecond}
+
+	client, err := CreateBrokerConnectionWithRetry(context.Background(), NewBrokerOptions(unavailableBrokerUrl(t)), nil, backoff)
+	if err == nil || err == context.Canceled {
+		t.Fatalf("Expected the connection to fail, but got %v", err)
+	}
+
+	if client != nil {
+		t.Fatalf("Expected no client to be returned")
+	}
+}
+
+func TestCreateBrokerConnectionStopsWhenCancelled(t *testing.T) {
+	backoff := ConnectBackoff{MaxAttempts: 10, InitialInterval: time.Hour, MaxInterval: time.Hour}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := CreateBrokerConnectionWithRetry(ctx, NewBrokerOptions(unavailableBrokerUrl(t)), nil, backoff)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("Expected the retries to be cancelled, but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the retries to stop when the context was cancelled")
+	}
+}
+
+func TestSubscriptionTrackerUpdatesSubscriptionGauge(t *testing.T) {
+	tracker := NewSubscriptionTracker(metrics)
+
+	tracker.add(Subscription{Topic: "redhat/insights/+/control/out", Qos: 1})
+	tracker.add(Subscription{Topic: "redhat/insights/broadcast/control/in", Qos: 0})
+	tracker.add(Subscription{Topic: "redhat/insights/+/control/out", Qos: 1})
+
+	if subscriptions := testutil.ToFloat64(metrics.subscriptionGauge); subscriptions != 2 {
+		t.Fatalf("Expected the subscription gauge to be 2, got %v", subscriptions)
+	}
+}
+
+func TestKeepAliveOptions(t *testing.T) {
+	connOpts := NewBrokerOptions("tcp://localhost:1883", WithKeepAlive(45*time.Second, 5*time.Second), WithMaxReconnectInterval(2*time.Minute))
+
+	if connOpts.KeepAlive != 45 || connOpts.PingTimeout != 5*time.Second || connOpts.MaxReconnectInterval != 2*time.Minute {
+		t.Fatalf("Unexpected options: keep alive %d, ping timeout %s, max reconnect interval %s",
+			connOpts.KeepAlive, connOpts.PingTimeout, connOpts.MaxReconnectInterval)
+	}
+
+	defaults := MQTT.NewClientOptions()
+	connOpts = NewBrokerOptions("tcp://localhost:1883", WithKeepAlive(0, 0), WithMaxReconnectInterval(0))
+
+	if connOpts.KeepAlive != defaults.KeepAlive || connOpts.PingTimeout != defaults.PingTimeout || connOpts.MaxReconnectInterval != defaults.MaxReconnectInterval {
+		t.Fatalf("Expected zero values to leave the defaults in place")
+	}
+}
+
+func TestSubscriptionTrackerResetsWhenTheConnectionIsLost(t *testing.T) {
+	tracker := NewSubscriptionTracker(metrics)
+
+	tracker.add(Subscription{Topic: "redhat/insights/+/control/out", Qos: 1})
+
+	tracker.onConnectionLost(nil, errors.New("connection reset"))
+
+	if subscriptions := tracker.Subscriptions(); len(subscriptions) != 0 {
+		t.Fatalf("Expected the subscriptions to be forgotten, got %v", subscriptions)
+	}
+
+	if subscriptions := testutil.ToFloat64(metrics.subscriptionGauge); subscriptions != 0 {
+		t.Fatalf("Expected the subscription gauge to be 0, got %v", subscriptions)
+	}
+}
@@ -0,0 +1,90 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+var ErrBrokerNotConnected = errors.New("Not connected to the MQTT broker")
+
+// BrokerConnectivityChecker periodically checks whether the MQTT client is connected to
+// the broker.  The result of the latest check backs the readiness probe so that the
+// probe does not have to wait on the MQTT client.  The broker connected gauge is left
+// to the connection monitor, which sees each change as it happens.
+type BrokerConnectivityChecker struct {
+	client    MQTT.Client
+	interval  time.Duration
+	connected int32
+	cancel    context.CancelFunc
+	done      sync.WaitGroup
+}
+
+func NewBrokerConnectivityChecker(client MQTT.Client, interval time.Duration) *BrokerConnectivityChecker {
+	return &BrokerConnectivityChecker{
+		client:   client,
+		interval: interval,
+	}
+}
+
+// Start checks the connection immediately and then once every interval
+func (bcc *BrokerConnectivityChecker) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	bcc.cancel = cancel
+
+	bcc.check()
+
+	bcc.done.Add(1)
+	go func() {
+		defer bcc.done.Done()
+
+		ticker := time.NewTicker(bcc.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				bcc.check()
+			}
+		}
+	}()
+}
+
+func (bcc *BrokerConnectivityChecker) Stop() {
+	bcc.cancel()
+	bcc.done.Wait()
+}
+
+// Ready returns ErrBrokerNotConnected if the client was not connected to the broker
+// when it was last checked
+func (bcc *BrokerConnectivityChecker) Ready() error {
+	if atomic.LoadInt32(&bcc.connected) == 0 {
+		return ErrBrokerNotConnected
+	}
+	return nil
+}
+
+func (bcc *BrokerConnectivityChecker) check() {
+	var connected int32
+	if bcc.client.IsConnected() {
+		connected = 1
+	}
+
+	previous := atomic.SwapInt32(&bcc.connected, connected)
+
+	if previous != connected {
+		if connected == 1 {
+			logger.Log.Info("Connected to the MQTT broker")
+		} else {
+			logger.Log.Warn("Not connected to the MQTT broker")
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package mqtt
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+type connectivityClient struct {
+	MQTT.Client
+	connected int32
+}
+
+func (c *connectivityClient) IsConnected() bool {
+	return atomic.LoadInt32(&c.connected) == 1
+}
+
+func (c *connectivityClient) setConnected(connected bool) {
+	var value int32
+	if connected {
+		value = 1
+	}
+	atomic.StoreInt32(&c.connected, value)
+}
+
+func TestBrokerConnectivityChecker(t *testing.T) {
+	client := &connectivityClient{}
+
+	checker := NewBrokerConnectivityChecker(client, time.Millisecond)
+	checker.Start()
+	defer checker.Stop()
+
+	if err := checker.Ready(); err != ErrBrokerNotConnected {
+		t.Fatalf("Expected %v before the client connected, got %v", ErrBrokerNotConnected, err)
+	}
+
+	client.setConnected(true)
+	waitForReadiness(t, checker, nil)
+
+	client.setConnected(false)
+	waitForReadiness(t, checker, ErrBrokerNotConnected)
+}
+
+func TestBrokerConnectivityCheckerChecksOnStart(t *testing.T) {
+	client := &connectivityClient{}
+	client.setConnected(true)
+
+	checker := NewBrokerConnectivityChecker(client, time.Hour)
+	checker.Start()
+	defer checker.Stop()
+
+	if err := checker.Ready(); err != nil {
+		t.Fatalf("Expected the client to be ready as soon as the checker started, got %v", err)
+	}
+}
+
+func waitForReadiness(t *testing.T, checker *BrokerConnectivityChecker, expected error) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if checker.Ready() == expected {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Expected readiness to be %v, got %v", expected, checker.Ready())
+}
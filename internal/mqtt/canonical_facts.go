@@ -0,0 +1,250 @@
+package mqtt
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+// identifyingCanonicalFacts are the canonical facts that inventory can use to identify a host
+var identifyingCanonicalFacts = []string{
+	"insights_id",
+	"subscription_manager_id",
+	"satellite_id",
+	"bios_uuid",
+	"provider_id",
+	"fqdn",
+	"ip_addresses",
+	"mac_addresses",
+}
+
+// stringCanonicalFacts and listCanonicalFacts are the canonical facts whose types are
+// checked before the facts are recorded
+var stringCanonicalFacts = []string{
+	"insights_id",
+	"subscription_manager_id",
+	"satellite_id",
+	"bios_uuid",
+	"provider_id",
+	"provider_type",
+	"machine_id",
+	"fqdn",
+}
+
+var listCanonicalFacts = []string{
+	"ip_addresses",
+	"mac_addresses",
+}
+
+// ParseCanonicalFacts makes sure that the canonical facts reported by a client have the
+// expected types.  The string facts must be strings and the ip_addresses / mac_addresses
+// must be lists of valid addresses.  Facts that are not known are passed through as is.
+// The returned error describes every fact that is invalid.
+func ParseCanonicalFacts(raw interface{}) (domain.CanonicalFacts, error) {
+	facts, problems, err := parseCanonicalFacts(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("Invalid canonical facts: %s", strings.Join(problems, "; "))
+	}
+
+	return facts, nil
+}
+
+// StripInvalidCanonicalFacts returns the canonical facts without the facts that do not
+// have the expected types.  The returned error describes the facts that were removed.
+func StripInvalidCanonicalFacts(raw interface{}) (domain.CanonicalFacts, error) {
+	facts, problems, err := parseCanonicalFacts(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(problems) > 0 {
+		return facts, fmt.Errorf("Removed invalid canonical facts: %s", strings.Join(problems, "; "))
+	}
+
+	return facts, nil
+}
+
+// parseCanonicalFacts returns a copy of the facts without the invalid facts along with
+// a description of each invalid fact
+func parseCanonicalFacts(raw interface{}) (domain.CanonicalFacts, []string, error) {
+	var reported map[string]interface{}
+	switch value := raw.(type) {
+	case map[string]interface{}:
+		reported = value
+	case domain.CanonicalFacts:
+		reported = value
+	default:
+		return nil, nil, fmt.Errorf("The canonical facts must be an object, got %T", raw)
+	}
+
+	facts := make(domain.CanonicalFacts, len(reported))
+	for fact, value := range reported {
+		facts[fact] = value
+	}
+
+	var problems []string
+
+	invalid := func(fact string, format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+		delete(facts, fact)
+	}
+
+	for _, fact := range stringCanonicalFacts {
+		if value, found := facts[fact]; found && value != nil {
+			if _, isString := value.(string); isString == false {
+				invalid(fact, "%s must be a string, got %T", fact, value)
+			}
+		}
+	}
+
+	for _, fact := range listCanonicalFacts {
+		value, found := facts[fact]
+		if found == false || value == nil {
+			continue
+		}
+
+		values, isList := value.([]interface{})
+		if isList == false {
+			invalid(fact, "%s must be a list, got %T", fact, value)
+			continue
+		}
+
+		for _, v := range values {
+			address, isString := v.(string)
+			if isString == false {
+				invalid(fact, "%s must only contain strings, got %T", fact, v)
+				break
+			}
+
+			if isValidAddress(fact, address) == false {
+				invalid(fact, "%s contains an invalid address %q", fact, address)
+				break
+			}
+		}
+	}
+
+	return facts, problems, nil
+}
+
+func isValidAddress(fact string, address string) bool {
+	if fact == "mac_addresses" {
+		_, err := net.ParseMAC(address)
+		return err == nil
+	}
+	return net.ParseIP(address) != nil
+}
+
+// requiredCanonicalFacts returns the canonical facts that the reporter requires.  A nil
+// list means that the reporter only requires one of the identifying facts.
+func requiredCanonicalFacts(reporter string, requirements map[string][]string) []string {
+	return requirements[strings.ToLower(reporter)]
+}
+
+// verifyCanonicalFacts makes sure that the canonical facts meet the reporter's minimum
+// requirements before they are recorded.  If no facts are required, at least one of the
+// identifying facts must be present.
+func verifyCanonicalFacts(canonicalFacts map[string]interface{}, requiredFacts []string) error {
+	if len(requiredFacts) == 0 {
+		for _, fact := range identifyingCanonicalFacts {
+			if hasCanonicalFact(canonicalFacts, fact) {
+				return nil
+			}
+		}
+		return fmt.Errorf("The canonical facts do not include any identifying facts")
+	}
+
+	var missing []string
+	for _, fact := range requiredFacts {
+		if hasCanonicalFact(canonicalFacts, fact) == false {
+			missing = append(missing, fact)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("The canonical facts are missing required facts: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+func hasCanonicalFact(canonicalFacts map[string]interface{}, fact string) bool {
+	switch value := canonicalFacts[fact].(type) {
+	case nil:
+		return false
+	case string:
+		return value != ""
+	case []interface{}:
+		return len(value) > 0
+	default:
+		return true
+	}
+}
+
+// inventoryCanonicalFacts returns the canonical facts that are included in the inventory
+// message.  Empty facts are never included.  When the include list is not empty, only the
+// listed facts are included.  Facts in the omit list are left out.  The facts that the
+// reporter requires are always included.
+func inventoryCanonicalFacts(canonicalFacts map[string]interface{}, requiredFacts []string, include []string, omit []string) map[string]interface{} {
+	included := make(map[string]interface{})
+
+	for fact, value := range canonicalFacts {
+		if hasCanonicalFact(canonicalFacts, fact) == false {
+			continue
+		}
+
+		if containsFact(requiredFacts, fact) == false {
+			if len(include) > 0 && containsFact(include, fact) == false {
+				continue
+			}
+
+			if containsFact(omit, fact) {
+				continue
+			}
+		}
+
+		included[fact] = value
+	}
+
+	return included
+}
+
+// displayName returns the value of the first fact in the priority list that is not empty.
+// The first value is used for facts that are lists (ip_addresses for example).  An empty
+// string is returned if none of the facts are populated.
+func displayName(canonicalFacts map[string]interface{}, priority []string) string {
+	for _, fact := range priority {
+		if hasCanonicalFact(canonicalFacts, fact) == false {
+			continue
+		}
+
+		value := canonicalFacts[fact]
+		if values, isList := value.([]interface{}); isList {
+			value = values[0]
+		}
+
+		if value == nil {
+			continue
+		}
+
+		if name := fmt.Sprint(value); name != "" {
+			return name
+		}
+	}
+
+	return ""
+}
+
+func containsFact(facts []string, fact string) bool {
+	for _, f := range facts {
+		if f == fact {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,239 @@
+package mqtt
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestVerifyCanonicalFacts(t *testing.T) {
+	requirements := map[string][]string{
+		"rhsm":     []string{"subscription_manager_id"},
+		"insights": []string{"insights_id"},
+		"strict":   []string{"insights_id", "subscription_manager_id"},
+	}
+
+	var tests = []struct {
+		name          string
+		reporter      string
+		facts         map[string]interface{}
+		expectedValid bool
+	}{
+		{"default with an identifying fact", "cloud-connector", map[string]interface{}{"fqdn": "host.example.com"}, true},
+		{"default without identifying facts", "cloud-connector", map[string]interface{}{"rhel_version": "8.3"}, false},
+		{"default with empty identifying facts", "cloud-connector", map[string]interface{}{"fqdn": "", "ip_addresses": []interface{}{}}, false},
+		{"rhsm with subscription_manager_id", "rhsm", map[string]interface{}{"subscription_manager_id": "1234"}, true},
+		{"rhsm with only insights_id", "rhsm", map[string]interface{}{"insights_id": "abcd"}, false},
+		{"insights with insights_id", "insights", map[string]interface{}{"insights_id": "abcd"}, true},
+		{"reporter name is case insensitive", "Insights", map[string]interface{}{"insights_id": "abcd"}, true},
+		{"strict with all facts", "strict", map[string]interface{}{"insights_id": "abcd", "subscription_manager_id": "1234"}, true},
+		{"strict with some facts", "strict", map[string]interface{}{"insights_id": "abcd"}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := verifyCanonicalFacts(tc.facts, requiredCanonicalFacts(tc.reporter, requirements))
+			if (err == nil) != tc.expectedValid {
+				t.Fatalf("Expected the facts to be valid=%t, got error %v", tc.expectedValid, err)
+			}
+		})
+	}
+}
+
+func TestOnlineMessageSkipsInventoryRecord(t *testing.T) {
+	cfg := config.GetConfig()
+	cfg.InventoryReporter = "rhsm"
+	cfg.InventoryRequiredFacts = map[string][]string{"rhsm": []string{"subscription_manager_id"}}
+
+	dispatcherChanges, _ := newTestDispatcherChangeHandler(t, "ignore")
+	cm := controller.NewLocalConnectionManager()
+
+	skipped := testutil.ToFloat64(metrics.inventoryRecordSkippedCounter.WithLabelValues("rhsm"))
+
+	deps := newTestControlMessageDeps(cm, nil, dispatcherChanges)
+	err := handleOnlineMessage(context.Background(), nil, "1234", "", "client-1", unmarshalControlMessage(t, onlineHandshake), cfg, deps, metrics)
+	if err != nil {
+		t.Fatalf("Unexpected error handling the online message: %s", err)
+	}
+
+	if testutil.ToFloat64(metrics.inventoryRecordSkippedCounter.WithLabelValues("rhsm")) != skipped+1 {
+		t.Fatalf("Expected the skipped inventory record to be counted")
+	}
+}
+
+func TestInventoryCanonicalFacts(t *testing.T) {
+	canonicalFacts := map[string]interface{}{
+		"insights_id":             "abcd",
+		"subscription_manager_id": "1234",
+		"bios_uuid":               "5678",
+		"fqdn":                    "",
+		"ip_addresses":            []interface{}{},
+	}
+
+	var tests = []struct {
+		name     string
+		required []string
+		include  []string
+		omit     []string
+		expected []string
+	}{
+		{"default includes all non-empty facts", nil, nil, nil, []string{"insights_id", "subscription_manager_id", "bios_uuid"}},
+		{"omit bios_uuid", nil, nil, []string{"bios_uuid"}, []string{"insights_id", "subscription_manager_id"}},
+		{"include list", nil, []string{"insights_id", "fqdn"}, nil, []string{"insights_id"}},
+		{"include and omit lists", nil, []string{"insights_id", "bios_uuid"}, []string{"bios_uuid"}, []string{"insights_id"}},
+		{"required facts are never omitted", []string{"bios_uuid"}, []string{"insights_id"}, []string{"bios_uuid"}, []string{"insights_id", "bios_uuid"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := inventoryCanonicalFacts(canonicalFacts, tc.required, tc.include, tc.omit)
+
+			if len(actual) != len(tc.expected) {
+				t.Fatalf("Expected facts %v, got %v", tc.expected, actual)
+			}
+
+			for _, fact := range tc.expected {
+				if actual[fact] != canonicalFacts[fact] {
+					t.Fatalf("Expected fact %s to be included, got %v", fact, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestDisplayName(t *testing.T) {
+	priority := []string{"fqdn", "subscription_manager_id", "ip_addresses"}
+
+	var tests = []struct {
+		name     string
+		facts    map[string]interface{}
+		expected string
+	}{
+		{"preferred fact is populated", map[string]interface{}{"fqdn": "host.example.com", "subscription_manager_id": "1234"}, "host.example.com"},
+		{"preferred fact is empty", map[string]interface{}{"fqdn": "", "subscription_manager_id": "1234"}, "1234"},
+		{"preferred fact is missing", map[string]interface{}{"subscription_manager_id": "1234", "ip_addresses": []interface{}{"10.0.0.1"}}, "1234"},
+		{"list fact uses the first value", map[string]interface{}{"fqdn": "", "ip_addresses": []interface{}{"10.0.0.1", "10.0.0.2"}}, "10.0.0.1"},
+		{"empty list fact is skipped", map[string]interface{}{"ip_addresses": []interface{}{}}, ""},
+		{"null list value is skipped", map[string]interface{}{"fqdn": "", "ip_addresses": []interface{}{nil}}, ""},
+		{"facts outside the priority list are ignored", map[string]interface{}{"insights_id": "abcd"}, ""},
+		{"no facts", map[string]interface{}{}, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := displayName(tc.facts, priority); actual != tc.expected {
+				t.Fatalf("Expected the display name to be %q, got %q", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseCanonicalFacts(t *testing.T) {
+	var tests = []struct {
+		name          string
+		raw           interface{}
+		expectedValid bool
+	}{
+		{"valid facts", map[string]interface{}{"fqdn": "host.example.com", "ip_addresses": []interface{}{"10.0.0.1", "fe80::1"}, "mac_addresses": []interface{}{"52:54:00:12:34:56"}, "machine_id": "1234"}, true},
+		{"unknown facts are passed through", map[string]interface{}{"rhel_version": 8.3}, true},
+		{"null facts are ignored", map[string]interface{}{"fqdn": nil, "ip_addresses": nil}, true},
+		{"empty lists", map[string]interface{}{"ip_addresses": []interface{}{}}, true},
+		{"not an object", "fqdn=host.example.com", false},
+		{"ip_addresses is a string", map[string]interface{}{"ip_addresses": "10.0.0.1"}, false},
+		{"ip_addresses contains a number", map[string]interface{}{"ip_addresses": []interface{}{10}}, false},
+		{"ip_addresses contains an invalid address", map[string]interface{}{"ip_addresses": []interface{}{"10.0.0.256"}}, false},
+		{"mac_addresses contains an invalid address", map[string]interface{}{"mac_addresses": []interface{}{"52:54:00"}}, false},
+		{"fqdn is a list", map[string]interface{}{"fqdn": []interface{}{"host.example.com"}}, false},
+		{"machine_id is a number", map[string]interface{}{"machine_id": 1234}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			facts, err := ParseCanonicalFacts(tc.raw)
+			if (err == nil) != tc.expectedValid {
+				t.Fatalf("Expected the facts to be valid=%t, got error %v", tc.expectedValid, err)
+			}
+
+			if tc.expectedValid && len(facts) != len(tc.raw.(map[string]interface{})) {
+				t.Fatalf("Expected all of the facts to be returned, got %v", facts)
+			}
+		})
+	}
+}
+
+func TestParseCanonicalFactsDescribesEveryProblem(t *testing.T) {
+	_, err := ParseCanonicalFacts(map[string]interface{}{"fqdn": 1, "ip_addresses": "10.0.0.1"})
+	if err == nil {
+		t.Fatalf("Expected the facts to be invalid")
+	}
+
+	for _, fact := range []string{"fqdn", "ip_addresses"} {
+		if strings.Contains(err.Error(), fact) == false {
+			t.Fatalf("Expected the error to describe the invalid %s, got %s", fact, err)
+		}
+	}
+}
+
+func TestOnlineMessageWithInvalidCanonicalFacts(t *testing.T) {
+	cfg := config.GetConfig()
+
+	dispatcherChanges, _ := newTestDispatcherChangeHandler(t, "ignore")
+	cm := controller.NewLocalConnectionManager()
+
+	invalid := testutil.ToFloat64(metrics.invalidCanonicalFactsCounter)
+	skipped := testutil.ToFloat64(metrics.inventoryRecordSkippedCounter.WithLabelValues(cfg.InventoryReporter))
+
+	handshake := `{"type": "connection-status", "message_id": "1234", "content": {"state": "online",
+	"canonical_facts": {"fqdn": "host.example.com", "ip_addresses": "10.0.0.1"}}}`
+
+	deps := newTestControlMessageDeps(cm, nil, dispatcherChanges)
+	err := handleOnlineMessage(context.Background(), nil, "1234", "", "client-1", unmarshalControlMessage(t, handshake), cfg, deps, metrics)
+	if err != nil {
+		t.Fatalf("Unexpected error handling the online message: %s", err)
+	}
+
+	if testutil.ToFloat64(metrics.invalidCanonicalFactsCounter) != invalid+1 {
+		t.Fatalf("Expected the invalid canonical facts to be counted")
+	}
+
+	// The remaining facts still identify the host
+	if testutil.ToFloat64(metrics.inventoryRecordSkippedCounter.WithLabelValues(cfg.InventoryReporter)) != skipped {
+		t.Fatalf("Expected the client to be recorded without the invalid facts")
+	}
+
+	connection := cm.GetConnection(context.TODO(), "1234", "client-1")
+	if connection == nil {
+		t.Fatalf("Expected the client to be registered")
+	}
+
+	facts := connection.(*ReceptorMQTTProxy).Details.CanonicalFacts
+	if _, found := facts["ip_addresses"]; found || facts["fqdn"] != "host.example.com" {
+		t.Fatalf("Expected the invalid facts to be removed, got %v", facts)
+	}
+}
+
+func TestStripInvalidCanonicalFacts(t *testing.T) {
+	reported := map[string]interface{}{"fqdn": "host.example.com", "ip_addresses": []interface{}{"10.0.0.1", "fred"}, "custom": 1}
+
+	facts, err := StripInvalidCanonicalFacts(reported)
+	if err == nil || strings.Contains(err.Error(), "ip_addresses") == false {
+		t.Fatalf("Expected the error to describe the removed ip_addresses, got %v", err)
+	}
+
+	if len(facts) != 2 || facts["fqdn"] != "host.example.com" || facts["custom"] != 1 {
+		t.Fatalf("Expected only the invalid facts to be removed, got %v", facts)
+	}
+
+	if _, found := reported["ip_addresses"]; found == false {
+		t.Fatalf("Expected the reported facts to be left as they are")
+	}
+
+	if _, err := StripInvalidCanonicalFacts("fred"); err == nil {
+		t.Fatalf("Expected facts that are not an object to be rejected")
+	}
+}
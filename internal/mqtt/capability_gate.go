@@ -0,0 +1,56 @@
+package mqtt
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+// clientLookup finds the details of a connected client
+type clientLookup interface {
+	FindConnection(ctx context.Context, clientID domain.ClientID) (domain.RhcClient, error)
+}
+
+// CapabilityGate stops the commands and data messages from being sent to the clients
+// that did not advertise support for them in their handshake.  A command is gated on
+// its name and a data message on its directive.  A nil gate lets everything through.
+type CapabilityGate struct {
+	clients clientLookup
+}
+
+func NewCapabilityGate(clients clientLookup) *CapabilityGate {
+	return &CapabilityGate{clients: clients}
+}
+
+// check returns an error wrapping controller.ErrCapabilityNotSupported if the client did
+// not advertise the capability.  A client whose details cannot be found is let through
+// as there is nothing to check.
+func (g *CapabilityGate) check(ctx context.Context, clientID domain.ClientID, capability string) error {
+	if g == nil {
+		return nil
+	}
+
+	client, err := g.clients.FindConnection(ctx, clientID)
+	if err != nil {
+		return nil
+	}
+
+	if client.HasCapability(capability) == false {
+		return fmt.Errorf("%w: %s does not support %s", controller.ErrCapabilityNotSupported, clientID, capability)
+	}
+
+	return nil
+}
+
+// checkBroadcast returns an error wrapping controller.ErrCapabilityNotSupported while the
+// gate is enabled.  The clients that receive a broadcast are not known so their
+// capabilities cannot be checked.
+func (g *CapabilityGate) checkBroadcast(capability string) error {
+	if g == nil {
+		return nil
+	}
+
+	return fmt.Errorf("%w: unable to verify that every client supports %s", controller.ErrCapabilityNotSupported, capability)
+}
@@ -0,0 +1,73 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+func newCapabilityGateForTest() *CapabilityGate {
+	cm := controller.NewLocalConnectionManager()
+	cm.Register(context.TODO(), "1234", "capable", &ReceptorMQTTProxy{ClientID: "capable", Details: &domain.RhcClient{
+		ClientID:     "capable",
+		Capabilities: []string{"playbook", reconnectCommand},
+	}})
+	cm.Register(context.TODO(), "1234", "incapable", &ReceptorMQTTProxy{ClientID: "incapable", Details: &domain.RhcClient{
+		ClientID: "incapable",
+	}})
+
+	return NewCapabilityGate(cm)
+}
+
+func TestDataMessageSenderChecksTheDirectiveCapability(t *testing.T) {
+	client := &publishRecordingClient{}
+	sender := NewDataMessageSender(client, NewTopicBuilder(), 0, WithDataMessageCapabilityGate(newCapabilityGateForTest()))
+
+	if _, err := sender.SendDataMessage(context.TODO(), "capable", "playbook", "run"); err != nil {
+		t.Fatalf("Unexpected error sending the data message: %s", err)
+	}
+
+	if _, err := sender.SendDataMessage(context.TODO(), "incapable", "playbook", "run"); errors.Is(err, controller.ErrCapabilityNotSupported) == false {
+		t.Fatalf("Expected %v, got %v", controller.ErrCapabilityNotSupported, err)
+	}
+
+	// There is nothing to check for a client whose details are not known
+	if _, err := sender.SendDataMessage(context.TODO(), "unknown", "playbook", "run"); err != nil {
+		t.Fatalf("Unexpected error sending the data message: %s", err)
+	}
+
+	if len(client.published) != 2 {
+		t.Fatalf("Expected 2 published messages, got %d", len(client.published))
+	}
+}
+
+func TestControlMessageSendersCheckTheCommandCapability(t *testing.T) {
+	gate := newCapabilityGateForTest()
+	client := &publishRecordingClient{}
+	sender := NewControlMessageSender(client, NewTopicBuilder(), WithCapabilityGate(gate))
+
+	if err := sender.Reconnect(context.TODO(), "capable", 30); err != nil {
+		t.Fatalf("Unexpected error sending the reconnect message: %s", err)
+	}
+
+	if err := sender.Reconnect(context.TODO(), "incapable", 30); errors.Is(err, controller.ErrCapabilityNotSupported) == false {
+		t.Fatalf("Expected %v, got %v", controller.ErrCapabilityNotSupported, err)
+	}
+
+	content := &CommandMessageContent{Command: reconnectCommand}
+
+	if _, err := SendControlMessageToClient(context.TODO(), client, NewTopicBuilder(), nil, TimestampFormatRFC3339, gate, 1, "incapable", content); errors.Is(err, controller.ErrCapabilityNotSupported) == false {
+		t.Fatalf("Expected %v, got %v", controller.ErrCapabilityNotSupported, err)
+	}
+
+	if _, err := SendControlMessageToAll(context.TODO(), client, NewTopicBuilder(), nil, TimestampFormatRFC3339, gate, 1, content); errors.Is(err, controller.ErrCapabilityNotSupported) == false {
+		t.Fatalf("Expected the broadcast to be refused, got %v", err)
+	}
+
+	if len(client.published) != 1 {
+		t.Fatalf("Expected only the supported command to be published, got %d messages", len(client.published))
+	}
+}
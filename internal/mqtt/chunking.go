@@ -0,0 +1,93 @@
+package mqtt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// dataMessageChunkOverhead is the space reserved for the data message envelope
+// (type, ids, version and chunk metadata) of each chunk
+const dataMessageChunkOverhead = 512
+
+var ErrInvalidChunkSize = errors.New("Invalid data message chunk size")
+
+// VerifyChunkSize makes sure that a chunk of the given size, once encoded and
+// wrapped in a data message, fits within the broker's maximum message size.  A
+// chunk size of zero disables chunking.
+func VerifyChunkSize(chunkSize int, maxMessageSize int) error {
+	if chunkSize == 0 {
+		return nil
+	}
+
+	if chunkSize < 0 || base64.StdEncoding.EncodedLen(chunkSize)+dataMessageChunkOverhead > maxMessageSize {
+		return ErrInvalidChunkSize
+	}
+
+	return nil
+}
+
+// buildDataMessages builds the data messages that deliver the payload to a client.
+// A payload whose JSON encoding fits within chunkSize bytes (or any payload when
+// chunkSize is zero) is sent as a single data message.
+//
+// Larger payloads are split into sequenced data messages.  Each chunk has its own
+// message_id and a chunk object that contains the message_id of the original
+// message, the zero based index of the chunk and the total number of chunks.  The
+// content of each chunk is a base64 encoded slice of the JSON encoded payload.
+// Clients reassemble the payload by collecting the chunks that share a chunk
+// message_id, concatenating their decoded content in index order and decoding the
+// result as JSON.
+func buildDataMessages(messageID uuid.UUID, payload interface{}, chunkSize int) ([]DataMessage, error) {
+	message := DataMessage{
+		MessageType: "data",
+		MessageID:   messageID.String(),
+		Version:     1,
+		Content:     payload,
+	}
+
+	if chunkSize <= 0 {
+		return []DataMessage{message}, nil
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(payloadBytes) <= chunkSize {
+		return []DataMessage{message}, nil
+	}
+
+	total := (len(payloadBytes) + chunkSize - 1) / chunkSize
+	chunks := make([]DataMessage, 0, total)
+
+	for index := 0; index < total; index++ {
+		chunkID, err := uuid.NewRandom()
+		if err != nil {
+			return nil, err
+		}
+
+		start := index * chunkSize
+		end := start + chunkSize
+		if end > len(payloadBytes) {
+			end = len(payloadBytes)
+		}
+
+		chunks = append(chunks, DataMessage{
+			MessageType: "data",
+			MessageID:   chunkID.String(),
+			Version:     1,
+			Content:     payloadBytes[start:end],
+			Chunk: &DataMessageChunk{
+				MessageID: messageID.String(),
+				Index:     index,
+				Total:     total,
+			},
+		})
+	}
+
+	return chunks, nil
+}
@@ -0,0 +1,136 @@
+package mqtt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestBuildDataMessagesChunkBoundaries(t *testing.T) {
+	// The JSON encoding of the payload is 100 bytes:  98 characters plus the quotes
+	payload := strings.Repeat("a", 98)
+
+	var tests = []struct {
+		name           string
+		chunkSize      int
+		expectedChunks int
+	}{
+		{"chunking disabled", 0, 1},
+		{"payload smaller than the chunk size", 101, 1},
+		{"payload equal to the chunk size", 100, 1},
+		{"payload one byte larger than the chunk size", 99, 2},
+		{"payload evenly divided", 25, 4},
+		{"payload not evenly divided", 30, 4},
+		{"one byte chunks", 1, 100},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			messages, err := buildDataMessages(uuid.New(), payload, tc.chunkSize)
+			if err != nil {
+				t.Fatalf("Unexpected error building the data messages: %s", err)
+			}
+
+			if len(messages) != tc.expectedChunks {
+				t.Fatalf("Expected %d data messages, got %d", tc.expectedChunks, len(messages))
+			}
+
+			if tc.expectedChunks == 1 {
+				if messages[0].Chunk != nil || messages[0].Content != payload {
+					t.Fatalf("Expected an unchunked data message, got %+v", messages[0])
+				}
+				return
+			}
+
+			for _, message := range messages[:len(messages)-1] {
+				if len(message.Content.([]byte)) != tc.chunkSize {
+					t.Fatalf("Expected every chunk except the last to contain %d bytes, got %d", tc.chunkSize, len(message.Content.([]byte)))
+				}
+			}
+		})
+	}
+}
+
+func TestBuildDataMessagesReassembly(t *testing.T) {
+	messageID := uuid.New()
+	payload := map[string]interface{}{"url": "https://cloud.redhat.com/api/v1/remediations/1234/playbook", "size": 4096.0}
+
+	messages, err := buildDataMessages(messageID, payload, 16)
+	if err != nil {
+		t.Fatalf("Unexpected error building the data messages: %s", err)
+	}
+
+	seenMessageIDs := make(map[string]bool)
+	var reassembled []byte
+
+	for i, message := range messages {
+		// Verify the chunk metadata using the serialized message that the client receives
+		messageBytes, err := json.Marshal(message)
+		if err != nil {
+			t.Fatalf("Unexpected error marshalling the data message: %s", err)
+		}
+
+		var received struct {
+			MessageID string           `json:"message_id"`
+			Content   string           `json:"content"`
+			Chunk     DataMessageChunk `json:"chunk"`
+		}
+		if err := json.Unmarshal(messageBytes, &received); err != nil {
+			t.Fatalf("Unexpected error unmarshalling the data message: %s", err)
+		}
+
+		if received.Chunk.MessageID != messageID.String() {
+			t.Fatalf("Expected the chunk to reference message %s, got %s", messageID, received.Chunk.MessageID)
+		}
+
+		if received.Chunk.Index != i || received.Chunk.Total != len(messages) {
+			t.Fatalf("Expected chunk %d of %d, got chunk %d of %d", i, len(messages), received.Chunk.Index, received.Chunk.Total)
+		}
+
+		if received.MessageID == messageID.String() || seenMessageIDs[received.MessageID] {
+			t.Fatalf("Expected each chunk to have a unique message id, got %s", received.MessageID)
+		}
+		seenMessageIDs[received.MessageID] = true
+
+		content, err := base64.StdEncoding.DecodeString(received.Content)
+		if err != nil {
+			t.Fatalf("Unexpected error decoding the chunk content: %s", err)
+		}
+
+		reassembled = append(reassembled, content...)
+	}
+
+	var actual map[string]interface{}
+	if err := json.Unmarshal(reassembled, &actual); err != nil {
+		t.Fatalf("Unable to decode the reassembled payload: %s", err)
+	}
+
+	if actual["url"] != payload["url"] || actual["size"] != payload["size"] {
+		t.Fatalf("Expected the reassembled payload to be %v, got %v", payload, actual)
+	}
+}
+
+func TestVerifyChunkSize(t *testing.T) {
+	var tests = []struct {
+		name           string
+		chunkSize      int
+		maxMessageSize int
+		expectedErr    error
+	}{
+		{"chunking disabled", 0, 1024, nil},
+		{"chunk fits", 65536, 131072, nil},
+		{"encoded chunk does not fit", 131072, 131072, ErrInvalidChunkSize},
+		{"negative chunk size", -1, 131072, ErrInvalidChunkSize},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := VerifyChunkSize(tc.chunkSize, tc.maxMessageSize); err != tc.expectedErr {
+				t.Fatalf("Expected %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
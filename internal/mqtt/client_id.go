@@ -0,0 +1,96 @@
+package mqtt
+
+import (
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
+
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Losing the connection to the broker within this window after connecting is
+// a strong hint that another process is connecting with the same client id
+const clientIdCollisionWindow = 60 * time.Second
+
+func buildClientID(baseClientID string, appendUniqueSuffix bool, suffixGenerator func() string) string {
+	if appendUniqueSuffix == false {
+		return baseClientID
+	}
+
+	suffix := suffixGenerator()
+
+	if baseClientID == "" {
+		return suffix
+	}
+
+	return baseClientID + "-" + suffix
+}
+
+func generateClientIDSuffix() string {
+	return uuid.New().String()[:8]
+}
+
+// connectionMonitor logs and records the changes to the state of the connection
+// to the broker.  The time the connection was last lost is kept so that the
+// reconnect can report how long the client was disconnected.  The monitor is the
+// only writer of the client's broker connected gauge.
+type connectionMonitor struct {
+	clientID       string
+	connectedAt    time.Time
+	disconnectedAt time.Time
+	metrics        *Metrics
+	sync.Mutex
+}
+
+func newConnectionMonitor(clientID string, metrics *Metrics) *connectionMonitor {
+	metrics.brokerConnectedGauge.WithLabelValues(clientID).Set(0)
+
+	return &connectionMonitor{clientID: clientID, metrics: metrics}
+}
+
+func (cm *connectionMonitor) onConnect(client MQTT.Client) {
+	cm.Lock()
+	defer cm.Unlock()
+
+	cm.connectedAt = time.Now()
+
+	cm.metrics.brokerConnectedGauge.WithLabelValues(cm.clientID).Set(1)
+
+	if cm.disconnectedAt.IsZero() == false {
+		logger.Log.WithFields(logrus.Fields{"client_id": cm.clientID, "disconnected_for": cm.connectedAt.Sub(cm.disconnectedAt)}).Info("Reconnected to the MQTT broker")
+	}
+}
+
+func (cm *connectionMonitor) onReconnecting(client MQTT.Client, opts *MQTT.ClientOptions) {
+	cm.Lock()
+	disconnectedFor := time.Since(cm.disconnectedAt)
+	cm.Unlock()
+
+	logger.Log.WithFields(logrus.Fields{"client_id": cm.clientID, "disconnected_for": disconnectedFor}).Info("Reconnecting to the MQTT broker")
+}
+
+func (cm *connectionMonitor) onConnectionLost(client MQTT.Client, err error) {
+	cm.Lock()
+	cm.disconnectedAt = time.Now()
+	disconnectedAt := cm.disconnectedAt
+	connectedFor := disconnectedAt.Sub(cm.connectedAt)
+	cm.Unlock()
+
+	cm.metrics.unexpectedConnectionLostCounter.Inc()
+	cm.metrics.brokerConnectedGauge.WithLabelValues(cm.clientID).Set(0)
+	cm.metrics.lastConnectionLostTimestamp.Set(float64(disconnectedAt.UnixNano()) / 1e9)
+
+	logger := logger.Log.WithFields(logrus.Fields{"client_id": cm.clientID, "connected_for": connectedFor, "error": err})
+
+	if connectedFor < clientIdCollisionWindow {
+		logger.Warn("Lost connection to the MQTT broker shortly after connecting.  " +
+			"This can be caused by another process connecting with the same client id.")
+		return
+	}
+
+	logger.Warn("Lost connection to the MQTT broker")
+}
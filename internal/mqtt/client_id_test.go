@@ -0,0 +1,85 @@
+package mqtt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestBuildClientID(t *testing.T) {
+	suffixGenerator := func() string { return "abcd1234" }
+
+	var tests = []struct {
+		name         string
+		baseClientID string
+		appendSuffix bool
+		expected     string
+	}{
+		{"fixed client id", "connector-service", false, "connector-service"},
+		{"suffixed client id", "connector-service", true, "connector-service-abcd1234"},
+		{"empty client id", "", false, ""},
+		{"suffix without a base client id", "", true, "abcd1234"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := buildClientID(tc.baseClientID, tc.appendSuffix, suffixGenerator)
+			if actual != tc.expected {
+				t.Fatalf("Expected client id %s, but got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestGeneratedClientIDsAreUnique(t *testing.T) {
+	first := buildClientID("connector-service", true, generateClientIDSuffix)
+	second := buildClientID("connector-service", true, generateClientIDSuffix)
+
+	if first == second {
+		t.Fatalf("Expected unique client ids, but got %s twice", first)
+	}
+
+	if strings.HasPrefix(first, "connector-service-") == false {
+		t.Fatalf("Expected the client id to start with the base client id, but got %s", first)
+	}
+}
+
+func TestConnectionMonitorUpdatesBrokerConnectedGauge(t *testing.T) {
+	monitor := newConnectionMonitor("connector-1", metrics)
+
+	monitor.onConnect(nil)
+	if connected := testutil.ToFloat64(metrics.brokerConnectedGauge.WithLabelValues("connector-1")); connected != 1 {
+		t.Fatalf("Expected the broker connected gauge to be 1 after connecting, got %v", connected)
+	}
+
+	monitor.onConnectionLost(nil, errors.New("connection reset"))
+	if connected := testutil.ToFloat64(metrics.brokerConnectedGauge.WithLabelValues("connector-1")); connected != 0 {
+		t.Fatalf("Expected the broker connected gauge to be 0 after the connection was lost, got %v", connected)
+	}
+}
+
+func TestConnectionMonitorRecordsConnectionLost(t *testing.T) {
+	monitor := newConnectionMonitor("connector-1", metrics)
+
+	lostBefore := testutil.ToFloat64(metrics.unexpectedConnectionLostCounter)
+
+	monitor.onConnect(nil)
+	monitor.onConnectionLost(nil, errors.New("connection reset"))
+
+	if delta := testutil.ToFloat64(metrics.unexpectedConnectionLostCounter) - lostBefore; delta != 1 {
+		t.Fatalf("Expected the lost connection to be counted, got %v", delta)
+	}
+
+	if monitor.disconnectedAt.IsZero() {
+		t.Fatalf("Expected the time the connection was lost to be recorded")
+	}
+
+	if lostAt := testutil.ToFloat64(metrics.lastConnectionLostTimestamp); int64(lostAt) != monitor.disconnectedAt.Unix() {
+		t.Fatalf("Expected the connection lost timestamp to be %d, got %v", monitor.disconnectedAt.Unix(), lostAt)
+	}
+
+	monitor.onReconnecting(nil, nil)
+	monitor.onConnect(nil)
+}
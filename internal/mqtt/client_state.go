@@ -0,0 +1,87 @@
+package mqtt
+
+import (
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+type ClientState struct {
+	ClientID                 domain.ClientID         `json:"client_id"`
+	MessagesInWindow         int                     `json:"messages_in_window"`
+	LastOnlineMessageID      string                  `json:"last_online_message_id,omitempty"`
+	LastOnlineMessageHandled *time.Time              `json:"last_online_message_handled,omitempty"`
+	LastError                *controller.ClientError `json:"last_error,omitempty"`
+}
+
+// ClientStateManager provides access to the state that the consumer keeps for each
+// client:  the number of messages counted against the client by the backpressure
+// monitor, the last online message that was handled (redeliveries of the message are
+// ignored) and the client's last handshake / registration failure.  Resetting the
+// state allows the client to be handled as if it had just connected for the first time.
+//
+// The manager is created before the connection to the broker so that it can be shared
+// with the api.  The consumer's state is attached once the connection is created.
+type ClientStateManager struct {
+	lastErrors   *controller.LastErrorTracker
+	backpressure *backpressureMonitor
+	onlineGuard  *onlineMessageGuard
+	sync.RWMutex
+}
+
+func NewClientStateManager(lastErrors *controller.LastErrorTracker) *ClientStateManager {
+	return &ClientStateManager{
+		lastErrors: lastErrors,
+	}
+}
+
+func (csm *ClientStateManager) attach(backpressure *backpressureMonitor, onlineGuard *onlineMessageGuard) {
+	csm.Lock()
+	defer csm.Unlock()
+
+	csm.backpressure = backpressure
+	csm.onlineGuard = onlineGuard
+}
+
+func (csm *ClientStateManager) ClientState(clientID domain.ClientID) ClientState {
+	csm.RLock()
+	defer csm.RUnlock()
+
+	state := ClientState{ClientID: clientID}
+
+	if csm.backpressure != nil {
+		state.MessagesInWindow = csm.backpressure.messageCount(clientID)
+	}
+
+	if csm.onlineGuard != nil {
+		if last, found := csm.onlineGuard.lastHandled(clientID, time.Now()); found {
+			state.LastOnlineMessageID = last.MessageID
+			state.LastOnlineMessageHandled = &last.Processed
+		}
+	}
+
+	if csm.lastErrors != nil {
+		state.LastError = csm.lastErrors.GetLastError(clientID)
+	}
+
+	return state
+}
+
+func (csm *ClientStateManager) Reset(clientID domain.ClientID) {
+	csm.RLock()
+	defer csm.RUnlock()
+
+	if csm.backpressure != nil {
+		csm.backpressure.reset(clientID)
+	}
+
+	if csm.onlineGuard != nil {
+		csm.onlineGuard.forget(clientID)
+	}
+
+	if csm.lastErrors != nil {
+		csm.lastErrors.ClearError(clientID)
+	}
+}
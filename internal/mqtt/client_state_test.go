@@ -0,0 +1,60 @@
+package mqtt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+)
+
+func TestClientStateReset(t *testing.T) {
+	lastErrors := controller.NewLastErrorTracker(10, time.Minute)
+	backpressure := newBackpressureMonitor(100, time.Minute, 1)
+	onlineGuard := newOnlineMessageGuard(NewLocalProcessedMessageStore(time.Minute), 0, metrics)
+
+	clientStates := NewClientStateManager(lastErrors)
+	clientStates.attach(backpressure, onlineGuard)
+
+	now := time.Now()
+	backpressure.recordMessage("client-1", now)
+	backpressure.recordMessage("client-1", now)
+	backpressure.recordMessage("client-2", now)
+	onlineGuard.handle("client-1", "1234", "", func() error { return nil })
+	lastErrors.RecordError("client-1", "Invalid handshake")
+
+	state := clientStates.ClientState("client-1")
+	if state.MessagesInWindow != 2 || state.LastOnlineMessageID != "1234" || state.LastOnlineMessageHandled == nil || state.LastError == nil {
+		t.Fatalf("Unexpected client state: %+v", state)
+	}
+
+	clientStates.Reset("client-1")
+
+	state = clientStates.ClientState("client-1")
+	if state.MessagesInWindow != 0 || state.LastOnlineMessageID != "" || state.LastOnlineMessageHandled != nil || state.LastError != nil {
+		t.Fatalf("Expected the client's state to be reset, got %+v", state)
+	}
+
+	// A redelivery of the online message is handled again once the state is reset
+	if handled, _ := onlineGuard.handle("client-1", "1234", "", func() error { return nil }); handled == false {
+		t.Fatalf("Expected the online message to be handled after the reset")
+	}
+
+	// The other clients are not affected
+	if clientStates.ClientState("client-2").MessagesInWindow != 1 {
+		t.Fatalf("Expected the state of the other clients to not be reset")
+	}
+
+	if backpressure.total != 1 {
+		t.Fatalf("Expected the reset client's messages to be removed from the total, got %d", backpressure.total)
+	}
+}
+
+func TestClientStateBeforeAttach(t *testing.T) {
+	clientStates := NewClientStateManager(nil)
+
+	clientStates.Reset("client-1")
+
+	if state := clientStates.ClientState("client-1"); state.ClientID != "client-1" || state.MessagesInWindow != 0 {
+		t.Fatalf("Unexpected client state: %+v", state)
+	}
+}
@@ -3,18 +3,23 @@ package mqtt
 import (
 	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"regexp"
+	"runtime"
 	"strings"
+	"time"
 
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 
+	"github.com/RedHatInsights/cloud-connector/internal/config"
 	"github.com/RedHatInsights/cloud-connector/internal/controller"
 	"github.com/RedHatInsights/cloud-connector/internal/domain"
 	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/queue"
 
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
@@ -23,99 +28,270 @@ const (
 	CONTROL_MESSAGE_OUTGOING_TOPIC string = "redhat/insights/%s/control/in"
 	DATA_MESSAGE_INCOMING_TOPIC    string = "redhat/insights/+/data/out"
 	DATA_MESSAGE_OUTGOING_TOPIC    string = "redhat/insights/%s/data/in"
+
+	// BROADCAST_CONTROL_TOPIC is subscribed to by all of the clients.  BROADCAST_CLIENT_ID
+	// is reserved so that a client cannot publish on, or receive, another client's
+	// behalf using the broadcast topic.
+	BROADCAST_CLIENT_ID     string = "broadcast"
+	BROADCAST_CONTROL_TOPIC string = "redhat/insights/" + BROADCAST_CLIENT_ID + "/control/in"
+)
+
+const (
+	rejectionReasonMissingOrgID     = "missing_org_id"
+	rejectionReasonInvalidAccountID = "invalid_account_id"
+
+	// downstreamIdentityType is the identity type used when recording a client's
+	// connection with the downstream services
+	downstreamIdentityType = "System"
+
+	// connectionStatusLockCount is the number of locks that the clients' connection
+	// status messages are serialized on
+	connectionStatusLockCount = 256
+)
+
+const (
+	DuplicateConnectionHandlingKeep    = "keep"
+	DuplicateConnectionHandlingReplace = "replace"
 )
 
-func NewTLSConfig(certFilePath string, keyFilePath string) (*tls.Config, error) {
-	// Import trusted certificates from CAfile.pem.
-	// Alternatively, manually add CA certificates to
-	// default openssl CA bundle.
-	/*
-	   certpool := x509.NewCertPool()
-	   pemCerts, err := ioutil.ReadFile("samplecerts/CAfile.pem")
-	   if err == nil {
-	       certpool.AppendCertsFromPEM(pemCerts)
-	   }
-	*/
-
-	// Import client certificate/key pair
-	cert, err := tls.LoadX509KeyPair(certFilePath, keyFilePath)
+var ErrMissingOrgID = errors.New("The client's identity does not include an org id")
+
+var ErrInvalidControlMessageContent = errors.New("The control message content is not a JSON object")
+
+var ErrInvalidDuplicateConnectionHandling = errors.New("Invalid duplicate connection handling mode")
+
+// VerifyDuplicateConnectionHandling makes sure the mode is one of the supported modes.
+//
+// A duplicate connection is found when a client sends an online message while a connection
+// for the client is already registered.  This happens when the client's previous offline
+// message was lost or, when multiple consumers share a connection registrar, when the
+// client reconnects and its online message is handled by a different consumer.  In "keep"
+// mode, the existing registration is kept.  In "replace" mode, the existing registration is
+// replaced with one that reflects the client's latest handshake.
+func VerifyDuplicateConnectionHandling(mode string) error {
+	if mode != DuplicateConnectionHandlingKeep && mode != DuplicateConnectionHandlingReplace {
+		return ErrInvalidDuplicateConnectionHandling
+	}
+	return nil
+}
+
+type ConnectionRegistrar struct {
+	connectionRegistrar controller.ConnectionRegistrar
+	accountResolver     controller.AccountIdResolver
+}
+
+// ConnectionRegistrarDeps are the collaborators that the connection registrar uses to
+// handle the clients' control messages
+type ConnectionRegistrarDeps struct {
+	ConnectionRegistrar      controller.ConnectionRegistrar
+	AccountResolver          controller.AccountIdResolver
+	FactsEnricher            controller.FactsEnricher
+	SourcesRecorder          controller.SourcesRecorder
+	LastErrors               *controller.LastErrorTracker
+	Subscriptions            *SubscriptionTracker
+	ClientStates             *ClientStateManager
+	ProcessedMessages        ProcessedMessageStore
+	InFlight                 *InFlightMessageTracker
+	UnverifiableTopicHandler UnverifiableTopicHandler
+	EventPublisher           controller.ConnectionEventPublisher
+	EventForwarder           EventForwarder
+	InventoryKafkaWriter     queue.Writer
+	Pongs                    *PongTracker
+	Disconnects              *DisconnectHandler
+	Signer                   MessageSigner
+	Confirmer                *DeliveryConfirmer
+	SizeLimits               *MessageSizeLimits
+}
+
+// controlMessageDeps are the collaborators used while handling a control message
+type controlMessageDeps struct {
+	topicBuilder             *TopicBuilder
+	signer                   MessageSigner
+	replays                  *replayWindow
+	connectionRegistrar      controller.ConnectionRegistrar
+	accountResolver          controller.AccountIdResolver
+	factsEnricher            controller.FactsEnricher
+	pendingCommands          *pendingCommandStore
+	pongs                    *PongTracker
+	dispatcherChanges        *dispatcherChangeHandler
+	debouncer                *onlineMessageDebouncer
+	slowConsumer             *slowConsumerDetector
+	onlineGuard              *onlineMessageGuard
+	ephemeralHosts           *ephemeralHostTracker
+	lastErrors               *controller.LastErrorTracker
+	lastSeen                 *lastSeenThrottle
+	unverifiableTopicHandler UnverifiableTopicHandler
+	eventPublisher           controller.ConnectionEventPublisher
+	eventForwarder           EventForwarder
+	inventory                *inventoryWriter
+	confirmer                *DeliveryConfirmer
+	sizeLimits               *MessageSizeLimits
+}
+
+func NewConnectionRegistrar(ctx context.Context, cfg *config.Config, brokerUrls []string, tlsConfig *tls.Config, deps ConnectionRegistrarDeps, metrics *Metrics) (MQTT.Client, error) {
+
+	clientID := buildClientID(cfg.MqttClientId, cfg.MqttClientIdUniqueSuffix, generateClientIDSuffix)
+	if clientID != "" && cfg.MqttClientIdUniqueSuffix == false {
+		logger.Log.WithFields(logrus.Fields{"client_id": clientID}).Warn("Connecting to the MQTT broker with a fixed client id.  " +
+			"Running multiple consumers with the same client id will cause the broker to disconnect them.")
+	}
+
+	monitor := newConnectionMonitor(clientID, metrics)
+
+	connOpts := NewMultiBrokerOptions(brokerUrls,
+		WithTlsConfig(tlsConfig),
+		WithClientID(clientID),
+		WithConnectionLostHandler(func(client MQTT.Client, err error) {
+			monitor.onConnectionLost(client, err)
+			deps.Subscriptions.onConnectionLost(client, err)
+		}),
+		WithReconnectingHandler(monitor.onReconnecting),
+		WithResumeSubs(cfg.MqttBrokerResumeSubs),
+		WithOrderMatters(cfg.MqttBrokerOrderMatters),
+		WithConnectRetry(cfg.MqttConnectRetry, cfg.MqttConnectRetryInterval),
+		WithKeepAlive(cfg.MqttKeepAlive, cfg.MqttPingTimeout),
+		WithMaxReconnectInterval(cfg.MqttMaxReconnectInterval))
+
+	if err := VerifyDuplicateConnectionHandling(cfg.DuplicateConnectionHandling); err != nil {
+		return nil, err
+	}
+
+	pendingCommands := newPendingCommandStore(cfg.PendingCommandTTL, cfg.PendingCommandMax, metrics)
+
+	sourcesIdentityHeader, err := controller.NewIdentityHeaderBuilder(cfg.SourcesIdentityHeaderVersion)
 	if err != nil {
 		return nil, err
 	}
 
-	// Just to print out the client certificate..
-	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	dispatcherChanges, err := newDispatcherChangeHandler(cfg.SourcesDispatchers, cfg.DispatcherChangeHandling, sourcesIdentityHeader, deps.SourcesRecorder, cfg.DispatcherChangeRetention, metrics)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create tls.Config with desired tls properties
-	tlsConfig := &tls.Config{
-		// RootCAs = certs used to verify server cert.
-		//RootCAs: certpool,
-		// ClientAuth = whether to request cert from server.
-		// Since the server is set up for SSL, this happens
-		// anyways.
-		//ClientAuth: tls.NoClientCert,
-		// ClientCAs = certs used to validate client cert.
-		//ClientCAs: nil,
-		// InsecureSkipVerify = verify that cert contents
-		// match server. IP matches what is in cert etc.
-		InsecureSkipVerify: true,
-		// Certificates = list of certs client sends to server.
-		Certificates: []tls.Certificate{cert},
-	}
-
-	return tlsConfig, nil
-}
+	topicBuilder := NewTopicBuilder()
 
-type ConnectionRegistrar struct {
-	connectionRegistrar controller.ConnectionRegistrar
-	accountResolver     controller.AccountIdResolver
-}
+	backpressure := newBackpressureMonitor(cfg.BackpressureMessageThreshold, cfg.BackpressureWindow, cfg.BackpressureMaxThrottledClients)
+
+	debouncer := newOnlineMessageDebouncer(cfg.OnlineMessageDebounceWindow, cfg.OnlineMessageDebounceMaxClients, deps.InFlight, metrics)
+
+	slowConsumer := newSlowConsumerDetector(cfg.SlowConsumerWindow, cfg.SlowConsumerDuration, cfg.SlowConsumerMaxLag, metrics)
 
-func NewConnectionRegistrar(brokerUri string, certFilePath string, certKeyPath string, connectionRegistrar controller.ConnectionRegistrar, accountResolver controller.AccountIdResolver) error {
+	onlineGuard := newOnlineMessageGuard(deps.ProcessedMessages, cfg.OnlineMessageDuplicateWindow, metrics)
 
-	tlsconfig, err := NewTLSConfig(certFilePath, certKeyPath)
+	deps.ClientStates.attach(backpressure, onlineGuard)
+
+	inventoryIdentityHeader, err := controller.NewIdentityHeaderBuilder(cfg.InventoryIdentityHeaderVersion)
 	if err != nil {
-		logger.Log.WithFields(logrus.Fields{"error": err}).Error("Unable to config TLS for the MQTT broker connection")
-		return err
+		return nil, err
 	}
 
-	connOpts := MQTT.NewClientOptions()
+	inventory := newInventoryWriter(deps.InventoryKafkaWriter, inventoryIdentityHeader, cfg.InventoryReporter)
+
+	ephemeralHosts := newEphemeralHostTracker(cfg.InventoryDeleteEphemeralHosts, cfg.InventoryEphemeralAccounts, cfg.InventoryEphemeralDeleteGracePeriod,
+		func(identity domain.Identity, clientID domain.ClientID) error {
+			return inventory.deleteHost(context.Background(), identity, clientID)
+		}, metrics)
+
+	middlewares, err := buildMessageHandlerChain(cfg.MqttMessageHandlerMiddlewares, map[string]MessageHandlerMiddleware{
+		RecoverMiddleware:      recoverMiddleware(metrics),
+		BackpressureMiddleware: backpressureMiddleware(backpressure, topicBuilder, deps.Signer, cfg.ControlMessageTimestampFormat, cfg.BackpressureThrottleInterval, metrics),
+		WorkerPoolMiddleware:   workerPoolMiddleware(messageWorkerCount(cfg.MqttMessageWorkers, cfg.MqttMessageWorkersPerCpu, runtime.NumCPU()), cfg.MqttMessageWorkerQueueSize, deps.InFlight),
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	connOpts.AddBroker(brokerUri)
+	logger.Log.WithFields(logrus.Fields{"middlewares": cfg.MqttMessageHandlerMiddlewares}).Info("Handling messages with the middleware chain")
+
+	handlerDeps := &controlMessageDeps{
+		topicBuilder:             topicBuilder,
+		signer:                   deps.Signer,
+		replays:                  newReplayWindow(cfg.ControlMessageReplayWindow),
+		connectionRegistrar:      deps.ConnectionRegistrar,
+		accountResolver:          deps.AccountResolver,
+		factsEnricher:            deps.FactsEnricher,
+		pendingCommands:          pendingCommands,
+		pongs:                    deps.Pongs,
+		dispatcherChanges:        dispatcherChanges,
+		debouncer:                debouncer,
+		slowConsumer:             slowConsumer,
+		onlineGuard:              onlineGuard,
+		ephemeralHosts:           ephemeralHosts,
+		lastErrors:               deps.LastErrors,
+		lastSeen:                 newLastSeenThrottle(lastSeenUpdateInterval(cfg)),
+		unverifiableTopicHandler: deps.UnverifiableTopicHandler,
+		eventPublisher:           deps.EventPublisher,
+		eventForwarder:           deps.EventForwarder,
+		inventory:                inventory,
+		confirmer:                deps.Confirmer,
+		sizeLimits:               deps.SizeLimits,
+	}
 
-	connOpts.SetTLSConfig(tlsconfig)
+	// The in-flight tracker wraps the handler directly so that it counts the messages that
+	// are being processed rather than the messages that are queued by the middlewares
+	recordConnection := ChainMessageHandler(
+		deps.InFlight.middleware(controlMessageHandler(cfg, handlerDeps, metrics)),
+		middlewares...)
 
-	recordConnection := controlMessageHandler(connectionRegistrar, accountResolver)
+	debouncer.attach(recordConnection)
 
-	connOpts.OnConnect = func(c MQTT.Client) {
-		topic := CONTROL_MESSAGE_INCOMING_TOPIC
-		logger.Log.Info("Subscribing to topic: ", topic)
-		if token := c.Subscribe(topic, 0, recordConnection); token.Wait() && token.Error() != nil {
-			logger.Log.WithFields(logrus.Fields{"error": token.Error()}).Fatalf("Subscribing to topic (%s) failed", topic)
-		}
+	subscribers := []Subscriber{
+		Subscriber{
+			Topic:      topicBuilder.BuildIncomingWildcardControlTopic(),
+			EntryPoint: recordConnection,
+			Qos:        0,
+		},
 	}
 
-	client := MQTT.NewClient(connOpts)
-	if token := client.Connect(); token.Wait() && token.Error() != nil {
-		logger.Log.WithFields(logrus.Fields{"error": token.Error()}).Error("Unable to connect to MQTT broker")
-		return token.Error()
+	registerSubscribers := RegisterSubscribers(subscribers, deps.Subscriptions)
+
+	mqttClient, err := CreateBrokerConnectionWithRetry(ctx, connOpts, func(c MQTT.Client) {
+		monitor.onConnect(c)
+		registerSubscribers(c)
+	}, newConnectBackoff(cfg))
+	if err != nil {
+		return nil, err
 	}
 
-	logger.Log.Info("Connected to broker: ", brokerUri)
+	deps.Disconnects.attach(func(ctx context.Context, rhcClient domain.RhcClient) {
+		logger := logger.Log.WithFields(logrus.Fields{"clientID": rhcClient.ClientID, "account": rhcClient.Account})
+		disconnectClient(ctx, mqttClient, rhcClient.Account, rhcClient.OrgID, rhcClient.ClientID, cfg, handlerDeps, metrics, logger)
+	})
 
-	return nil
+	return mqttClient, nil
 }
 
-func controlMessageHandler(connectionRegistrar controller.ConnectionRegistrar, accountResolver controller.AccountIdResolver) func(MQTT.Client, MQTT.Message) {
+func controlMessageHandler(cfg *config.Config, deps *controlMessageDeps, metrics *Metrics) MQTT.MessageHandler {
+	statusLocks := newClientLocks(connectionStatusLockCount)
+
+	handleStatus := func(client MQTT.Client, clientID domain.ClientID, msg ControlMessage) {
+		unlock := statusLocks.lock(clientID)
+		defer unlock()
+
+		ctx, cancel := newControlMessageContext(cfg)
+		defer cancel()
+
+		start := time.Now()
+		err := handleConnectionStatusMessage(ctx, client, clientID, msg, cfg, deps, metrics)
+		observeControlMessageProcessing(msg.MessageType, start, err, metrics)
+	}
+
 	return func(client MQTT.Client, message MQTT.Message) {
+		if debounced, ok := message.(*debouncedMessage); ok {
+			if clientID, err := verifyTopic(message.Topic()); err == nil {
+				handleStatus(client, clientID, debounced.msg)
+			}
+			return
+		}
+
 		logger.Log.Debugf("Received message on topic: %s\nMessage: %s\n", message.Topic(), message.Payload())
 
 		clientID, err := verifyTopic(message.Topic())
+		if err == nil {
+			err = clientID.Validate()
+		}
 		if err != nil {
-			logger.Log.WithFields(logrus.Fields{"error": err}).Error("Failed to verify topic")
+			deps.unverifiableTopicHandler(message.Topic(), message.Payload(), err)
 			return
 		}
 
@@ -127,145 +303,651 @@ func controlMessageHandler(connectionRegistrar controller.ConnectionRegistrar, a
 			return
 		}
 
-		var controlMsg ControlMessage
+		if isControlMessageOversized(message.Payload(), cfg.MaxControlMessageSize) {
+			logger.WithFields(logrus.Fields{"size": len(message.Payload()), "max_size": cfg.MaxControlMessageSize}).Warn("Dropping oversized control message")
+			metrics.oversizedControlMessageCounter.Inc()
+
+			if cfg.OversizedControlMessageDisconnect {
+				sendReconnectMessageToClient(client, deps.topicBuilder, deps.signer, cfg.ControlMessageTimestampFormat, clientID, deps.pendingCommands, invalidHandshakeReconnectDelay(cfg), "")
+			}
+			return
+		}
 
-		if err := json.Unmarshal(message.Payload(), &controlMsg); err != nil {
+		controlMsg, err := parseControlMessage(message.Payload(), metrics)
+		if errors.Is(err, ErrUnsupportedControlMessageVersion) {
+			logger.WithFields(logrus.Fields{"error": err}).Warn("Dropping control message with an unsupported version")
+			return
+		} else if err != nil {
 			logger.WithFields(logrus.Fields{"error": err}).Error("Failed to unmarshal control message")
 			return
 		}
 
+		if cfg.ControlMessageRequireSignature && deps.signer != nil {
+			if err := verifySignedControlMessage(deps.signer, deps.replays, clientID, controlMsg, time.Now()); err != nil {
+				logger.WithFields(logrus.Fields{"type": controlMsg.MessageType, "message_id": controlMsg.MessageID, "error": err}).Warn("Dropping control message with an unverified signature")
+				metrics.unverifiedControlMessageCounter.WithLabelValues(unverifiedSignatureReason(err)).Inc()
+				return
+			}
+		}
+
+		deps.slowConsumer.recordMessage(controlMsg.Sent.Time, time.Now())
+
+		ensureCorrelationID(&controlMsg)
+
+		logger = logger.WithFields(logrus.Fields{"correlation_id": controlMsg.CorrelationID})
+
 		logger.Debug("Got a control message:", controlMsg)
 
+		if isControlMessageStale(controlMsg, cfg.MaxControlMessageAge, time.Now()) {
+			logger.WithFields(logrus.Fields{"type": controlMsg.MessageType, "sent": controlMsg.Sent}).Info("Dropping stale control message")
+			metrics.staleControlMessageCounter.WithLabelValues(controlMessageTypeLabel(controlMsg.MessageType)).Inc()
+			return
+		}
+
+		recordClientSeen(cfg, deps.connectionRegistrar, deps.lastSeen, clientID, logger)
+
 		switch controlMsg.MessageType {
 		case "connection-status":
-			handleConnectionStatusMessage(client, clientID, controlMsg, connectionRegistrar, accountResolver)
+			if isOnlineMessage(controlMsg) {
+				if deps.debouncer.submit(client, message, clientID, controlMsg) {
+					return
+				}
+			} else {
+				deps.debouncer.cancel(clientID)
+			}
+
+			handleStatus(client, clientID, controlMsg)
 		case "event":
-			handleEventMessage(client, clientID, controlMsg)
+			ctx, cancel := newControlMessageContext(cfg)
+			start := time.Now()
+			err := handleEventMessage(ctx, client, clientID, controlMsg, deps.connectionRegistrar, deps.pendingCommands, deps.pongs, deps.eventForwarder, metrics)
+			observeControlMessageProcessing(controlMsg.MessageType, start, err, metrics)
+			cancel()
 		default:
 			logger.Debug("Received an invalid message type:", controlMsg.MessageType)
 		}
 	}
 }
 
-func handleConnectionStatusMessage(client MQTT.Client, clientID domain.ClientID, msg ControlMessage, connectionRegistrar controller.ConnectionRegistrar, accountResolver controller.AccountIdResolver) error {
+// verifySignedControlMessage checks that the message was signed with the client's key
+// and that it is not a replay of a message that has already been received
+func verifySignedControlMessage(signer MessageSigner, replays *replayWindow, clientID domain.ClientID, msg ControlMessage, now time.Time) error {
+	if err := VerifyControlMessage(signer, clientSigningKeyID(clientID), &msg); err != nil {
+		return err
+	}
+
+	return replays.check(msg, now)
+}
+
+// recordClientSeen updates when the client was last seen so that the connection is
+// not reaped.  The update is throttled so that a chatty client does not cause a write
+// to the connection registrar for every message.  A client that is not registered yet
+// (i.e. one sending its online message) is expected and ignored.
+func recordClientSeen(cfg *config.Config, connectionRegistrar controller.ConnectionRegistrar, lastSeen *lastSeenThrottle, clientID domain.ClientID, logger *logrus.Entry) {
+	if lastSeen.shouldRecord(clientID, time.Now()) == false {
+		return
+	}
+
+	ctx, cancel := newControlMessageContext(cfg)
+	defer cancel()
+
+	err := connectionRegistrar.UpdateLastSeen(ctx, clientID, time.Now())
+	if err != nil {
+		lastSeen.forget(clientID)
+
+		if err != controller.ErrConnectionNotFound {
+			logger.WithFields(logrus.Fields{"error": err}).Warn("Unable to record when the client was last seen")
+		}
+	}
+}
+
+// newControlMessageContext creates the context that is passed to the downstream calls
+// made while handling a control message.  The context is cancelled once the processing
+// timeout is exceeded so that a slow downstream service cannot hang the handler.  A
+// timeout of zero disables the timeout.
+func newControlMessageContext(cfg *config.Config) (context.Context, context.CancelFunc) {
+	if cfg.ControlMessageProcessingTimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+
+	return context.WithTimeout(context.Background(), cfg.ControlMessageProcessingTimeout)
+}
+
+// recordDownstreamTimeout logs and counts the downstream call if it was cancelled because
+// the control message processing timeout was exceeded
+func recordDownstreamTimeout(ctx context.Context, logger *logrus.Entry, call string, metrics *Metrics) {
+	if ctx.Err() != context.DeadlineExceeded {
+		return
+	}
+
+	logger.WithFields(logrus.Fields{"call": call}).Warn("Control message processing timeout exceeded")
+	metrics.downstreamTimeoutCounter.WithLabelValues(call).Inc()
+}
+
+// decodeControlMessage builds a version 1 control message from its top level fields.
+// Fields that are not part of the ControlMessage are ignored so that clients can add
+// fields without breaking older versions of cloud-connector, but they are logged and
+// counted so that they are noticed.
+func decodeControlMessage(fields map[string]json.RawMessage, metrics *Metrics) (ControlMessage, error) {
+	var controlMsg ControlMessage
+
+	knownFields := map[string]interface{}{
+		"type":           &controlMsg.MessageType,
+		"message_id":     &controlMsg.MessageID,
+		"response_to":    &controlMsg.ResponseTo,
+		"version":        &controlMsg.Version,
+		"sent":           &controlMsg.Sent,
+		"content":        &controlMsg.Content,
+		"signature":      &controlMsg.Signature,
+		"correlation_id": &controlMsg.CorrelationID,
+	}
+
+	var unexpectedFields []string
+
+	for name, value := range fields {
+		field, known := knownFields[name]
+		if known == false {
+			unexpectedFields = append(unexpectedFields, name)
+			continue
+		}
+
+		if err := json.Unmarshal(value, field); err != nil {
+			return ControlMessage{}, fmt.Errorf("invalid control message field %s: %w", name, err)
+		}
+	}
+
+	if len(unexpectedFields) > 0 {
+		logger.Log.WithFields(logrus.Fields{"type": controlMsg.MessageType, "message_id": controlMsg.MessageID, "fields": unexpectedFields}).Debug("Control message contains unexpected content")
+		metrics.unexpectedControlMessageContentCounter.WithLabelValues(controlMessageTypeLabel(controlMsg.MessageType)).Inc()
+	}
+
+	return controlMsg, nil
+}
+
+// ensureCorrelationID makes sure the message has a correlation id.  The id provided by
+// the client is used when there is one so that the client's logs can be matched up with
+// ours.  Otherwise a new id is generated.
+func ensureCorrelationID(msg *ControlMessage) {
+	if msg.CorrelationID != "" {
+		return
+	}
+
+	correlationID, err := uuid.NewRandom()
+	if err != nil {
+		// Fall back to the message id, it is still useful for tying things together
+		msg.CorrelationID = msg.MessageID
+		return
+	}
+
+	msg.CorrelationID = correlationID.String()
+}
+
+// observeControlMessageProcessing records how long it took to handle the control message.
+// The time includes the calls to the account resolver and the downstream services.
+func observeControlMessageProcessing(messageType string, start time.Time, err error, metrics *Metrics) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+
+	metrics.controlMessageProcessingDuration.WithLabelValues(messageType, outcome).Observe(time.Since(start).Seconds())
+}
+
+// isControlMessageOversized determines if the payload is larger than maxSize bytes.  The
+// size is checked before the payload is unmarshalled so that large payloads do not
+// consume memory.  A maxSize of zero disables the check.
+func isControlMessageOversized(payload []byte, maxSize int) bool {
+	return maxSize > 0 && len(payload) > maxSize
+}
+
+// isControlMessageStale determines if the message was sent longer than maxAge ago.  Messages
+// that do not include a valid sent timestamp are never considered stale.  A maxAge of zero
+// disables the check.
+func isControlMessageStale(msg ControlMessage, maxAge time.Duration, now time.Time) bool {
+	if maxAge <= 0 || msg.Sent.IsZero() {
+		return false
+	}
+
+	return now.Sub(msg.Sent.Time) > maxAge
+}
+
+func handleConnectionStatusMessage(ctx context.Context, client MQTT.Client, clientID domain.ClientID, msg ControlMessage, cfg *config.Config, deps *controlMessageDeps, metrics *Metrics) error {
 
 	// FIXME: pass the logger around
-	logger := logger.Log.WithFields(logrus.Fields{"clientID": clientID})
+	logger := logger.Log.WithFields(logrus.Fields{"clientID": clientID, "correlation_id": msg.CorrelationID})
 
 	logger.Debug("handling connection status control message")
 
-	account, err := accountResolver.MapClientIdToAccountId(context.Background(), clientID)
+	account, orgID, err := deps.accountResolver.MapClientIdToAccountId(ctx, clientID)
 	if err != nil {
-		// FIXME:  tell the client to disconnect
+		recordDownstreamTimeout(ctx, logger, "account_resolver", metrics)
+		logger.WithFields(logrus.Fields{"error": err}).Error("Unable to resolve the client's account")
+		deps.lastErrors.RecordError(clientID, fmt.Sprintf("Unable to resolve the client's account: %s", err))
+		reconnectAfterResolveError(client, deps.topicBuilder, deps.signer, clientID, deps.pendingCommands, cfg, msg, err, logger)
 		return err
 	}
 
-	logger = logger.WithFields(logrus.Fields{"account": account})
+	logger = logger.WithFields(logrus.Fields{"account": account, "org_id": orgID})
 
-	handshakePayload := msg.Content.(map[string]interface{})
+	handshakePayload, ok := msg.Content.(map[string]interface{})
+	if ok == false {
+		logger.WithFields(logrus.Fields{"message_id": msg.MessageID}).Warn("Connection-status message content is not a JSON object")
+		deps.lastErrors.RecordError(clientID, ErrInvalidControlMessageContent.Error())
+		return ErrInvalidControlMessageContent
+	}
 
 	connectionState, gotConnectionState := handshakePayload["state"]
 
 	if gotConnectionState == false {
 		// FIXME: Close down the connection
+		deps.lastErrors.RecordError(clientID, "Missing connection state")
 		return errors.New("Invalid connection state")
 	}
 
 	if connectionState == "online" {
-		return handleOnlineMessage(client, account, clientID, msg, connectionRegistrar)
+		// The client is only rejected when it comes online.  An offline message from a
+		// rejected client still cleans up whatever was recorded for the client.
+
+		// Clients that belong to an org without an account number are resolved to an
+		// empty account
+		if account != "" {
+			if err := account.Validate(); err != nil {
+				logger.WithFields(logrus.Fields{"reason": rejectionReasonInvalidAccountID}).Warn("Rejecting client with an invalid account id")
+				metrics.rejectedClientCounter.WithLabelValues(rejectionReasonInvalidAccountID).Inc()
+				deps.lastErrors.RecordError(clientID, fmt.Sprintf("Client rejected (%s): the client's account id is invalid", rejectionReasonInvalidAccountID))
+				return err
+			}
+		}
+
+		if cfg.RequireOrgId && orgID == "" {
+			logger.WithFields(logrus.Fields{"reason": rejectionReasonMissingOrgID}).Warn("Rejecting client without an org id")
+			metrics.rejectedClientCounter.WithLabelValues(rejectionReasonMissingOrgID).Inc()
+			deps.lastErrors.RecordError(clientID, fmt.Sprintf("Client rejected (%s): the client's identity does not include an org id", rejectionReasonMissingOrgID))
+			sendReconnectMessageToClient(client, deps.topicBuilder, deps.signer, cfg.ControlMessageTimestampFormat, clientID, deps.pendingCommands, invalidHandshakeReconnectDelay(cfg), msg.CorrelationID)
+			return ErrMissingOrgID
+		}
+
+		handled, err := deps.onlineGuard.handle(clientID, msg.MessageID, hashControlMessageContent(msg.Content), func() error {
+			return handleOnlineMessage(ctx, client, account, orgID, clientID, msg, cfg, deps, metrics)
+		})
+		if handled == false {
+			logger.WithFields(logrus.Fields{"message_id": msg.MessageID}).Debug("Online message has already been handled")
+			return nil
+		}
+		if err != nil {
+			deps.lastErrors.RecordError(clientID, err.Error())
+			return err
+		}
+		deps.ephemeralHosts.recordOnline(account, clientID, handshakePayload)
+		deps.lastErrors.ClearError(clientID)
+		return nil
 	} else if connectionState == "offline" {
-		return handleOfflineMessage(client, account, clientID, msg, connectionRegistrar)
+		deps.onlineGuard.clearContent(clientID)
+		return handleOfflineMessage(ctx, client, account, orgID, clientID, msg, cfg, deps, metrics)
 	} else {
+		deps.lastErrors.RecordError(clientID, fmt.Sprintf("Invalid connection state: %v", connectionState))
 		return errors.New("Invalid connection state")
 	}
+}
 
-	return nil
+// reconnectAfterResolveError asks the client to reconnect after its account could not be
+// resolved because of a transient failure so that the client's handshake is handled
+// again.  Other failures, like the account not being found, would fail the same way
+// again so the client is left alone.
+func reconnectAfterResolveError(client MQTT.Client, topicBuilder *TopicBuilder, signer MessageSigner, clientID domain.ClientID, pendingCommands *pendingCommandStore, cfg *config.Config, msg ControlMessage, err error, logger *logrus.Entry) {
+	if controller.IsTransientError(err) == false {
+		logger.WithFields(logrus.Fields{"error": err}).Debug("Not asking the client to reconnect because the account lookup would fail again")
+		return
+	}
+
+	sendReconnectMessageToClient(client, topicBuilder, signer, cfg.ControlMessageTimestampFormat, clientID, pendingCommands, invalidHandshakeReconnectDelay(cfg), msg.CorrelationID)
 }
 
-func handleOnlineMessage(client MQTT.Client, account domain.AccountID, clientID domain.ClientID, msg ControlMessage, connectionRegistrar controller.ConnectionRegistrar) error {
+func handleOnlineMessage(ctx context.Context, client MQTT.Client, account domain.AccountID, orgID domain.OrgID, clientID domain.ClientID, msg ControlMessage, cfg *config.Config, deps *controlMessageDeps, metrics *Metrics) error {
 
 	// FIXME: pass the logger around
-	logger := logger.Log.WithFields(logrus.Fields{"clientID": clientID, "account": account})
+	logger := logger.Log.WithFields(logrus.Fields{"clientID": clientID, "account": account, "correlation_id": msg.CorrelationID})
 
 	logger.Debug("handling online connection-status message")
 
-	handshakePayload := msg.Content.(map[string]interface{}) // FIXME:
+	handshakePayload, ok := msg.Content.(map[string]interface{})
+	if ok == false {
+		logger.WithFields(logrus.Fields{"message_id": msg.MessageID}).Warn("Online message content is not a JSON object")
+		return ErrInvalidControlMessageContent
+	}
 
-	canonicalFacts, gotCanonicalFacts := handshakePayload["canonical_facts"]
+	reportedCanonicalFacts, gotCanonicalFacts := handshakePayload["canonical_facts"].(map[string]interface{})
 
 	if gotCanonicalFacts == false {
 		fmt.Println("FIXME: error!  hangup")
 		return errors.New("Invalid handshake")
 	}
 
-	err := registerConnectionInInventory(account, clientID, canonicalFacts)
+	// The malformed facts are removed so that they are not recorded or passed along to
+	// the downstream services.  The connection is still usable without them.
+	canonicalFacts, err := StripInvalidCanonicalFacts(deps.factsEnricher.EnrichFacts(ctx, account, clientID, reportedCanonicalFacts))
 	if err != nil {
-		// FIXME:  If we cannot "register" the connection with inventory, then send a disconnect message
-		return err
+		logger.WithFields(logrus.Fields{"error": err}).Warn("The client reported invalid canonical facts")
+		metrics.invalidCanonicalFactsCounter.Inc()
 	}
 
-	connectionEvent(account, clientID, msg.Content)
+	identity := domain.Identity{AccountNumber: account, OrgID: orgID, Type: downstreamIdentityType}
+
+	requiredFacts := requiredCanonicalFacts(cfg.InventoryReporter, cfg.InventoryRequiredFacts)
+
+	if err := verifyCanonicalFacts(canonicalFacts, requiredFacts); err != nil {
+		// The connection is still usable, it just cannot be recorded in inventory
+		logger.WithFields(logrus.Fields{"reporter": cfg.InventoryReporter, "error": err}).Warn("Skipping the inventory record")
+		metrics.inventoryRecordSkippedCounter.WithLabelValues(cfg.InventoryReporter).Inc()
+	} else {
+		inventoryFacts := inventoryCanonicalFacts(canonicalFacts, requiredFacts, cfg.InventoryIncludedFacts, cfg.InventoryOmittedFacts)
+
+		err = registerConnectionInInventory(ctx, cfg, deps.inventory, identity, clientID, inventoryFacts)
+		if err != nil {
+			// FIXME:  If we cannot "register" the connection with inventory, then send a disconnect message
+			return err
+		}
+	}
+
+	var dispatchersResult domain.DispatchersResult
+
+	dispatchers, validDispatchers := getDispatchers(handshakePayload)
+	if validDispatchers {
+		dispatchersResult = deps.dispatcherChanges.processDispatchers(ctx, identity, clientID, dispatchers)
+	} else {
+		// Leave the client's sources registration as it is rather than treating the
+		// malformed dispatchers as the client having lost all of its dispatchers
+		logger.WithFields(logrus.Fields{"dispatchers": handshakePayload["dispatchers"]}).Warn("The client's dispatchers are not a JSON object")
+		dispatchers = make(map[string]interface{})
+		dispatchersResult = domain.DispatchersResult{
+			SourcesRegistration: domain.SourcesRegistrationSkipped,
+			Detail:              "The reported dispatchers are invalid",
+		}
+	}
 
-	proxy := ReceptorMQTTProxy{ClientID: string(clientID), Client: client}
+	metrics.sourcesRegistrationCounter.WithLabelValues(dispatchersResult.SourcesRegistration).Inc()
 
-	connectionRegistrar.Register(context.Background(), string(account), string(clientID), &proxy)
-	// FIXME: check for error, but ignore duplicate registration errors
+	logger.WithFields(logrus.Fields{
+		"dispatchers":          dispatchersResult.Dispatchers,
+		"gained":               dispatchersResult.Gained,
+		"lost":                 dispatchersResult.Lost,
+		"sources_registration": dispatchersResult.SourcesRegistration,
+		"detail":               dispatchersResult.Detail,
+	}).Info("Processed the client's dispatchers")
+
+	deps.eventPublisher.Publish(controller.NewConnectionEvent(controller.ConnectedEvent, account, clientID, canonicalFacts))
+
+	canonicalFactsHash, err := hashCanonicalFacts(cfg.FactsHashAlgorithm, canonicalFacts)
+	if err != nil {
+		logger.WithFields(logrus.Fields{"error": err}).Warn("Unable to hash the client's canonical facts")
+	}
+
+	debugHandshake, err := buildDebugHandshake(msg, cfg.HandshakeRedactPII, cfg.HandshakeDebugMaxSize)
+	if err != nil {
+		// The handshake is only kept for debugging so do not fail the registration
+		logger.WithFields(logrus.Fields{"error": err}).Warn("Unable to store the client's handshake")
+	}
+
+	proxy := ReceptorMQTTProxy{
+		ClientID:          string(clientID),
+		Client:            client,
+		Signer:            deps.signer,
+		TimestampFormat:   cfg.ControlMessageTimestampFormat,
+		DeliveryConfirmer: deps.confirmer,
+		SizeLimits:        deps.sizeLimits,
+		Details: &domain.RhcClient{
+			ClientID:           clientID,
+			Account:            account,
+			OrgID:              orgID,
+			CanonicalFacts:     canonicalFacts,
+			CanonicalFactsHash: canonicalFactsHash,
+			DisplayName:        displayName(canonicalFacts, cfg.DisplayNameFacts),
+			Dispatchers:        dispatchers,
+			DispatchersResult:  &dispatchersResult,
+			Capabilities:       getCapabilities(handshakePayload),
+			ConnectedAt:        sessionStart(msg),
+		},
+		Handshake: debugHandshake,
+		ChunkSize: cfg.MqttDataMessageChunkSize,
+	}
+
+	err = deps.connectionRegistrar.Register(ctx, string(account), string(clientID), &proxy)
+	if errors.Is(err, controller.ErrRegistrationConflict) && cfg.DuplicateConnectionHandling == DuplicateConnectionHandlingReplace {
+		logger.Info("Replacing the existing registration of the connection")
+		err = deps.connectionRegistrar.Replace(ctx, string(account), string(clientID), &proxy)
+	}
+
+	if err != nil {
+		if errors.Is(err, controller.ErrRegistrationConflict) == false {
+			recordDownstreamTimeout(ctx, logger, "connection_registrar", metrics)
+			logger.WithFields(logrus.Fields{"error": err}).Error("Unable to register the connection")
+			return err
+		}
+	}
 
 	return nil
 }
 
-func handleOfflineMessage(client MQTT.Client, account domain.AccountID, clientID domain.ClientID, msg ControlMessage, connectionRegistrar controller.ConnectionRegistrar) error {
+func handleOfflineMessage(ctx context.Context, client MQTT.Client, account domain.AccountID, orgID domain.OrgID, clientID domain.ClientID, msg ControlMessage, cfg *config.Config, deps *controlMessageDeps, metrics *Metrics) error {
 
 	// FIXME: pass the logger around
-	logger := logger.Log.WithFields(logrus.Fields{"clientID": clientID, "account": account})
+	logger := logger.Log.WithFields(logrus.Fields{"clientID": clientID, "account": account, "correlation_id": msg.CorrelationID})
 
 	logger.Debug("handling offline connection-status message")
 
-	connectionRegistrar.Unregister(context.Background(), string(account), string(clientID))
+	if isFromPreviousSession(ctx, deps.connectionRegistrar, clientID, msg) {
+		logger.WithFields(logrus.Fields{"sent": msg.Sent}).Info("Ignoring an offline message from a previous session of the client")
+		return nil
+	}
+
+	disconnectClient(ctx, client, account, orgID, clientID, cfg, deps, metrics, logger)
+
+	return nil
+}
+
+// sessionStart is when the session that the online message starts began.  Clients that
+// do not send the time that the message was sent do not have one.
+func sessionStart(msg ControlMessage) *time.Time {
+	if msg.Sent.IsZero() {
+		return nil
+	}
+
+	started := msg.Sent.Time
+	return &started
+}
+
+// isFromPreviousSession checks if the offline message was sent before the client's
+// current session started.  The broker can deliver the will message of a session that
+// was replaced after the online message of the new session, and handling it would
+// disconnect the new session.
+func isFromPreviousSession(ctx context.Context, connectionRegistrar controller.ConnectionRegistrar, clientID domain.ClientID, msg ControlMessage) bool {
+	if msg.Sent.IsZero() {
+		return false
+	}
+
+	current, err := connectionRegistrar.FindConnection(ctx, clientID)
+	if err != nil || current.ConnectedAt == nil {
+		return false
+	}
+
+	return msg.Sent.Before(*current.ConnectedAt)
+}
+
+// disconnectClient cleans up after a client that is no longer connected.  The connection
+// is unregistered, the disconnected event is published, the host of an ephemeral client
+// is deleted from inventory and the client's retained connection-status is cleared.
+func disconnectClient(ctx context.Context, client MQTT.Client, account domain.AccountID, orgID domain.OrgID, clientID domain.ClientID, cfg *config.Config, deps *controlMessageDeps, metrics *Metrics, logger *logrus.Entry) {
+
+	deps.connectionRegistrar.Unregister(ctx, string(account), string(clientID))
+	recordDownstreamTimeout(ctx, logger, "connection_registrar", metrics)
+
+	deps.eventPublisher.Publish(controller.NewConnectionEvent(controller.DisconnectedEvent, account, clientID, nil))
+
+	identity := domain.Identity{AccountNumber: account, OrgID: orgID, Type: downstreamIdentityType}
 
-	disconnectionEvent(account, clientID)
+	deps.ephemeralHosts.recordOffline(identity, clientID)
+
+	deps.dispatcherChanges.forget(clientID)
+
+	if cfg.ClearRetainedConnectionStatus {
+		clearRetainedConnectionStatus(client, deps.topicBuilder, clientID, logger)
+	}
+}
 
+// clearRetainedConnectionStatus removes the client's retained connection-status message
+// from the broker by publishing an empty retained message to the client's control topic.
+// Otherwise the broker would hand the stale online message to cloud-connector when it
+// resubscribes.
+func clearRetainedConnectionStatus(client MQTT.Client, topicBuilder *TopicBuilder, clientID domain.ClientID, logger *logrus.Entry) {
 	logger.Debug("Removing client's retained connection-status message")
-	// FIXME:
-	clientTopic := fmt.Sprintf("redhat/insights/%s/control/out", clientID)
-	client.Publish(clientTopic, byte(0), true, "")
 
-	return nil
+	t := client.Publish(topicBuilder.BuildIncomingControlTopic(clientID), byte(0), true, "")
+	go func() {
+		if t.Wait() && t.Error() != nil {
+			logger.WithFields(logrus.Fields{"error": t.Error()}).Warn("Unable to remove the client's retained connection-status message")
+		}
+	}()
 }
 
+var (
+	ErrInvalidTopic         = errors.New("MQTT topic needs to be redhat/insights/<clientID>/control/out or redhat/insights/<clientID>/data/out")
+	ErrInvalidTopicClientID = errors.New("MQTT topic contains an invalid clientID")
+)
+
+// validClientID limits client ids to the characters that can be safely passed along
+// in kafka headers, urls and queries.  This covers uuids as well as the ids that the
+// older clients generate.
+var validClientID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// verifyTopic extracts the client id from a topic that a client publishes to.  The
+// returned error is ErrInvalidTopic if the topic does not have the expected shape and
+// ErrInvalidTopicClientID if the client id segment is not a legitimate client id.
 func verifyTopic(topic string) (domain.ClientID, error) {
 	items := strings.Split(topic, "/")
 	if len(items) != 5 {
-		return "", errors.New("MQTT topic requires 4 sections: redhat, insights, <clientID>, control, in")
+		return "", ErrInvalidTopic
 	}
 
 	if items[0] != "redhat" || items[1] != "insights" || items[4] != "out" {
-		fmt.Println("topic: ", topic)
-		return "", errors.New("MQTT topic needs to be redhat/insights/<clientID>/control/out")
+		return "", ErrInvalidTopic
+	}
+
+	if items[3] != "control" && items[3] != "data" {
+		return "", ErrInvalidTopic
+	}
+
+	if validClientID.MatchString(items[2]) == false || items[2] == BROADCAST_CLIENT_ID {
+		return "", ErrInvalidTopicClientID
 	}
 
 	return domain.ClientID(items[2]), nil
 }
 
-func registerConnectionInInventory(account domain.AccountID, clientID domain.ClientID, canonicalFacts interface{}) error {
-	fmt.Println("FIXME: send inventory kafka message - ", account, clientID, canonicalFacts)
-	return nil
+// registerConnectionInInventory records the client's host in inventory.  The host is
+// only sent when registering hosts is enabled.
+func registerConnectionInInventory(ctx context.Context, cfg *config.Config, inventory *inventoryWriter, identity domain.Identity, clientID domain.ClientID, canonicalFacts map[string]interface{}) error {
+	if cfg.InventoryRegisterHosts == false {
+		return nil
+	}
+
+	return inventory.addHost(ctx, identity, clientID, canonicalFacts)
 }
 
-func registerConnectionInSources(account domain.AccountID, clientID domain.ClientID, catalogServiceFacts interface{}) error {
-	fmt.Println("FIXME: adding entry to sources - ", account, clientID, catalogServiceFacts)
-	return nil
+func handleEventMessage(ctx context.Context, client MQTT.Client, clientID domain.ClientID, msg ControlMessage, connectionRegistrar controller.ConnectionRegistrar, pendingCommands *pendingCommandStore, pongs *PongTracker, eventForwarder EventForwarder, metrics *Metrics) error {
+
+	logger := logger.Log.WithFields(logrus.Fields{"clientID": clientID, "correlation_id": msg.CorrelationID})
+
+	if isPongEvent(msg.Content) {
+		// Pongs are only of interest to the ping that is waiting for them.  The other
+		// consumers receive the pong as well, so an unknown pong is not an error.
+		resolved := pongs.resolve(clientID, msg.ResponseTo)
+		logger.WithFields(logrus.Fields{"response_to": msg.ResponseTo, "resolved": resolved}).Debug("Received pong")
+		return nil
+	}
+
+	if content, ok := msg.Content.(map[string]interface{}); ok && content["event"] == reconnectScheduledEvent {
+		return handleReconnectScheduledEvent(clientID, msg, pendingCommands, metrics)
+	}
+
+	event, err := parseEventMessageContent(msg.Content)
+	if err != nil {
+		// Malformed events are dropped so that a misbehaving client cannot hold up the other messages
+		logger.WithFields(describeEventContent(msg.Content)).WithFields(logrus.Fields{"error": err}).Warn("Dropping malformed event")
+		metrics.clientEventCounter.WithLabelValues("malformed").Inc()
+		return err
+	}
+
+	var account domain.AccountID
+	var orgID domain.OrgID
+
+	connection, err := connectionRegistrar.FindConnection(ctx, clientID)
+	if err == nil {
+		account, orgID = connection.Account, connection.OrgID
+	} else {
+		logger.WithFields(logrus.Fields{"error": err}).Debug("Unable to find the connection of the client that sent the event")
+	}
+
+	return eventForwarder(clientID, account, orgID, msg, event)
 }
 
-func handleEventMessage(client MQTT.Client, clientID domain.ClientID, msg ControlMessage) error {
-	fmt.Printf("FIXME: Got an event: %+v\n", msg.Content)
+func handleReconnectScheduledEvent(clientID domain.ClientID, msg ControlMessage, pendingCommands *pendingCommandStore, metrics *Metrics) error {
+
+	logger := logger.Log.WithFields(logrus.Fields{"clientID": clientID, "response_to": msg.ResponseTo})
+
+	event, err := parseReconnectScheduledEvent(msg.Content)
+	if err != nil {
+		logger.WithFields(logrus.Fields{"error": err}).Warn("Unable to parse reconnect-scheduled event")
+		return err
+	}
+
+	honored := verifyReconnectDelayHonored(clientID, msg.ResponseTo, *event.Delay, pendingCommands)
+
+	metrics.reconnectScheduledDelay.Observe(float64(*event.Delay))
+	metrics.reconnectScheduledEventCounter.WithLabelValues(honored).Inc()
+
+	logger.WithFields(logrus.Fields{"delay": *event.Delay, "honored": honored}).Info("Client scheduled a reconnect")
+
 	return nil
 }
 
-func connectionEvent(account domain.AccountID, clientID domain.ClientID, canonicalFacts interface{}) {
-	fmt.Println("FIXME: send new connection kafka message")
+func parseReconnectScheduledEvent(content interface{}) (*ReconnectScheduledEventContent, error) {
+
+	contentBytes, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var event ReconnectScheduledEventContent
+	if err := json.Unmarshal(contentBytes, &event); err != nil {
+		return nil, err
+	}
+
+	if event.Event != reconnectScheduledEvent {
+		return nil, errors.New("Invalid event type")
+	}
+
+	if event.Delay == nil || *event.Delay < 0 {
+		return nil, errors.New("Invalid reconnect delay")
+	}
+
+	return &event, nil
 }
 
-func disconnectionEvent(account domain.AccountID, clientID domain.ClientID) {
-	fmt.Println("FIXME: send lost connection kafka message")
+// verifyReconnectDelayHonored correlates the reconnect-scheduled event with the reconnect
+// command that was sent to the client.  It returns "true" if the client is honoring (at least)
+// the delay that was requested, "false" if the client is not honoring the delay and "unknown"
+// if the event could not be correlated with a reconnect command.
+func verifyReconnectDelayHonored(clientID domain.ClientID, responseTo string, delay int, pendingCommands *pendingCommandStore) string {
+
+	command, found := pendingCommands.resolve(responseTo)
+	if found == false || command.Command != reconnectCommand || command.ClientID != clientID {
+		return "unknown"
+	}
+
+	if delay < command.Delay {
+		logger.Log.WithFields(logrus.Fields{"clientID": clientID, "requested_delay": command.Delay, "delay": delay}).Warn("Client is not honoring the requested reconnect delay")
+		return "false"
+	}
+
+	return "true"
 }
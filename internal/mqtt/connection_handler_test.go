@@ -0,0 +1,867 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func init() {
+	logger.InitLogger()
+}
+
+func unmarshalControlMessage(t *testing.T, payload string) ControlMessage {
+	var msg ControlMessage
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+		t.Fatalf("Unable to unmarshal control message: %s", err)
+	}
+	return msg
+}
+
+// newTestControlMessageDeps creates the collaborators used to handle the control messages
+// with the optional features disabled.  The tests replace the ones they are interested in.
+func newTestControlMessageDeps(connectionRegistrar controller.ConnectionRegistrar, accountResolver controller.AccountIdResolver, dispatcherChanges *dispatcherChangeHandler) *controlMessageDeps {
+	return &controlMessageDeps{
+		topicBuilder:        NewTopicBuilder(),
+		connectionRegistrar: connectionRegistrar,
+		accountResolver:     accountResolver,
+		factsEnricher:       &controller.NoopFactsEnricher{},
+		pendingCommands:     newPendingCommandStore(time.Minute, 0, metrics),
+		pongs:               NewPongTracker(),
+		dispatcherChanges:   dispatcherChanges,
+		debouncer:           newOnlineMessageDebouncer(0, 0, nil, metrics),
+		slowConsumer:        newSlowConsumerDetector(0, 0, 0, metrics),
+		onlineGuard:         newOnlineMessageGuard(NewLocalProcessedMessageStore(time.Minute), 0, metrics),
+		ephemeralHosts:      newEphemeralHostTracker(false, nil, 0, nil, metrics),
+		lastErrors:          controller.NewLastErrorTracker(10, time.Minute),
+		lastSeen:            newLastSeenThrottle(0),
+		eventPublisher:      &controller.NoopConnectionEventPublisher{},
+		eventForwarder:      NewEventForwarder(nil, metrics),
+	}
+}
+
+func TestParseReconnectScheduledEvent(t *testing.T) {
+	msg := unmarshalControlMessage(t, `{"type": "event", "message_id": "1234", "response_to": "5678", "version": 1, "content": {"event": "reconnect-scheduled", "delay": 30}}`)
+
+	event, err := parseReconnectScheduledEvent(msg.Content)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing reconnect-scheduled event: %s", err)
+	}
+
+	if *event.Delay != 30 {
+		t.Fatalf("Expected a delay of 30, but got %d", *event.Delay)
+	}
+}
+
+func TestParseInvalidReconnectScheduledEvent(t *testing.T) {
+	var tests = []struct {
+		name    string
+		content string
+	}{
+		{"missing delay", `{"event": "reconnect-scheduled"}`},
+		{"negative delay", `{"event": "reconnect-scheduled", "delay": -1}`},
+		{"invalid delay type", `{"event": "reconnect-scheduled", "delay": "thirty"}`},
+		{"wrong event", `{"event": "disconnect", "delay": 30}`},
+		{"string content", `"reconnect-scheduled"`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var content interface{}
+			json.Unmarshal([]byte(tc.content), &content)
+
+			_, err := parseReconnectScheduledEvent(content)
+			if err == nil {
+				t.Fatalf("Expected an error parsing the reconnect-scheduled event")
+			}
+		})
+	}
+}
+
+func TestVerifyReconnectDelayHonored(t *testing.T) {
+	clientID := domain.ClientID("client-1")
+
+	var tests = []struct {
+		name           string
+		pendingID      string
+		pendingClient  domain.ClientID
+		requestedDelay int
+		responseTo     string
+		delay          int
+		expected       string
+	}{
+		{"delay honored", "1234", clientID, 30, "1234", 30, "true"},
+		{"longer delay honored", "1234", clientID, 30, "1234", 60, "true"},
+		{"delay not honored", "1234", clientID, 30, "1234", 5, "false"},
+		{"unknown command", "1234", clientID, 30, "5678", 30, "unknown"},
+		{"command sent to a different client", "1234", "client-2", 30, "1234", 30, "unknown"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pendingCommands := newPendingCommandStore(time.Minute, 0, metrics)
+			pendingCommands.add(tc.pendingID, pendingCommand{ClientID: tc.pendingClient, Command: reconnectCommand, Delay: tc.requestedDelay})
+
+			actual := verifyReconnectDelayHonored(clientID, tc.responseTo, tc.delay, pendingCommands)
+			if actual != tc.expected {
+				t.Fatalf("Expected %s, but got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestReconnectScheduledEventResolvesPendingCommand(t *testing.T) {
+	clientID := domain.ClientID("client-1")
+	pendingCommands := newPendingCommandStore(time.Minute, 0, metrics)
+	pendingCommands.add("5678", pendingCommand{ClientID: clientID, Command: reconnectCommand, Delay: 30})
+
+	msg := unmarshalControlMessage(t, `{"type": "event", "message_id": "1234", "response_to": "5678", "version": 1, "content": {"event": "reconnect-scheduled", "delay": 30}}`)
+
+	if err := handleEventMessage(context.TODO(), nil, clientID, msg, controller.NewLocalConnectionManager(), pendingCommands, NewPongTracker(), NewEventForwarder(nil, metrics), metrics); err != nil {
+		t.Fatalf("Unexpected error handling the event: %s", err)
+	}
+
+	if _, found := pendingCommands.resolve("5678"); found {
+		t.Fatalf("Expected the pending reconnect command to be resolved by the event")
+	}
+}
+
+func TestPendingCommandsExpire(t *testing.T) {
+	pendingCommands := newPendingCommandStore(time.Minute, 0, metrics)
+	pendingCommands.add("1234", pendingCommand{Command: reconnectCommand, Sent: time.Now().Add(-2 * time.Minute)})
+
+	if _, found := pendingCommands.resolve("1234"); found {
+		t.Fatalf("Expected the pending command to have expired")
+	}
+}
+
+func TestControlMessageStaleness(t *testing.T) {
+	now := time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		name     string
+		sent     string
+		maxAge   time.Duration
+		expected bool
+	}{
+		{"fresh message", "2021-03-01T11:59:30Z", time.Minute, false},
+		{"stale message", "2021-03-01T11:50:00Z", time.Minute, true},
+		{"stale message with timezone offset", "2021-03-01T06:50:00-05:00", time.Minute, true},
+		{"check disabled", "2021-03-01T11:50:00Z", 0, false},
+		{"missing sent timestamp", "", time.Minute, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := unmarshalControlMessage(t, `{"type": "connection-status", "sent": "`+tc.sent+`"}`)
+
+			actual := isControlMessageStale(msg, tc.maxAge, now)
+			if actual != tc.expected {
+				t.Fatalf("Expected stale to be %t, but got %t", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestControlMessageSizeBoundary(t *testing.T) {
+	var tests = []struct {
+		name     string
+		size     int
+		maxSize  int
+		expected bool
+	}{
+		{"smaller than the max size", 99, 100, false},
+		{"equal to the max size", 100, 100, false},
+		{"one byte larger than the max size", 101, 100, true},
+		{"check disabled", 101, 0, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := isControlMessageOversized(make([]byte, tc.size), tc.maxSize)
+			if actual != tc.expected {
+				t.Fatalf("Expected oversized to be %t, but got %t", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestOversizedControlMessageIsDropped(t *testing.T) {
+	var tests = []struct {
+		name               string
+		disconnect         bool
+		expectedReconnects int
+	}{
+		{"drop", false, 0},
+		{"drop and disconnect", true, 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := config.GetConfig()
+			cfg.MaxControlMessageSize = len(onlineHandshake) - 1
+			cfg.OversizedControlMessageDisconnect = tc.disconnect
+
+			dispatcherChanges, _ := newTestDispatcherChangeHandler(t, "ignore")
+			cm := controller.NewLocalConnectionManager()
+			client := &publishRecordingClient{}
+			topicBuilder := NewTopicBuilder()
+			metrics := NewMetrics(prometheus.NewRegistry())
+
+			deps := newTestControlMessageDeps(cm, &staticAccountResolver{account: "1234"}, dispatcherChanges)
+			deps.topicBuilder = topicBuilder
+			handler := controlMessageHandler(cfg, deps, metrics)
+
+			handler(client, testMessage{topic: "redhat/insights/client-1/control/out", payload: []byte(onlineHandshake)})
+
+			if testutil.ToFloat64(metrics.oversizedControlMessageCounter) != 1 {
+				t.Fatalf("Expected the oversized control message to be counted")
+			}
+
+			if cm.GetConnection(context.TODO(), "1234", "client-1") != nil {
+				t.Fatalf("Expected the oversized control message to not be processed")
+			}
+
+			if len(client.published) != tc.expectedReconnects {
+				t.Fatalf("Expected %d reconnect messages, got %d", tc.expectedReconnects, len(client.published))
+			}
+
+			if tc.expectedReconnects > 0 && client.published[0].topic != topicBuilder.BuildOutgoingControlTopic("client-1") {
+				t.Fatalf("Expected the reconnect message to be sent to the client, got %s", client.published[0].topic)
+			}
+		})
+	}
+}
+
+type staticAccountResolver struct {
+	account domain.AccountID
+	orgID   domain.OrgID
+}
+
+func (sar *staticAccountResolver) MapClientIdToAccountId(ctx context.Context, clientID domain.ClientID) (domain.AccountID, domain.OrgID, error) {
+	return sar.account, sar.orgID, nil
+}
+
+// slowAccountResolver blocks until the context is cancelled
+type slowAccountResolver struct{}
+
+func (sar *slowAccountResolver) MapClientIdToAccountId(ctx context.Context, clientID domain.ClientID) (domain.AccountID, domain.OrgID, error) {
+	<-ctx.Done()
+	return "", "", ctx.Err()
+}
+
+func TestControlMessageProcessingTimeout(t *testing.T) {
+	cfg := config.GetConfig()
+	cfg.ControlMessageProcessingTimeout = 10 * time.Millisecond
+
+	client := &publishRecordingClient{}
+	cm := controller.NewLocalConnectionManager()
+	dispatcherChanges, _ := newTestDispatcherChangeHandler(t, "ignore")
+
+	timeouts := testutil.ToFloat64(metrics.downstreamTimeoutCounter.WithLabelValues("account_resolver"))
+
+	ctx, cancel := newControlMessageContext(cfg)
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		deps := newTestControlMessageDeps(cm, &slowAccountResolver{}, dispatcherChanges)
+		done <- handleConnectionStatusMessage(ctx, client, "client-1", unmarshalControlMessage(t, onlineHandshake), cfg, deps, metrics)
+	}()
+
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("Expected the account lookup to time out, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the handler to return once the processing timeout was exceeded")
+	}
+
+	if testutil.ToFloat64(metrics.downstreamTimeoutCounter.WithLabelValues("account_resolver")) != timeouts+1 {
+		t.Fatal("Expected the timeout to be counted")
+	}
+
+	if cm.GetConnection(context.TODO(), "1234", "client-1") != nil {
+		t.Fatal("Expected the client to not be registered")
+	}
+}
+
+func TestNewControlMessageContextWithoutTimeout(t *testing.T) {
+	cfg := config.GetConfig()
+	cfg.ControlMessageProcessingTimeout = 0
+
+	ctx, cancel := newControlMessageContext(cfg)
+	defer cancel()
+
+	if _, hasDeadline := ctx.Deadline(); hasDeadline {
+		t.Fatal("Expected a timeout of zero to disable the deadline")
+	}
+}
+
+func TestRequireOrgID(t *testing.T) {
+	var tests = []struct {
+		name             string
+		requireOrgID     bool
+		orgID            domain.OrgID
+		expectedRejected bool
+	}{
+		{"org id present, not required", false, "1010101", false},
+		{"org id missing, not required", false, "", false},
+		{"org id present, required", true, "1010101", false},
+		{"org id missing, required", true, "", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := config.GetConfig()
+			cfg.RequireOrgId = tc.requireOrgID
+
+			client := &publishRecordingClient{}
+			cm := controller.NewLocalConnectionManager()
+			lastErrors := controller.NewLastErrorTracker(10, time.Minute)
+			dispatcherChanges, _ := newTestDispatcherChangeHandler(t, "ignore")
+			resolver := &staticAccountResolver{account: "1234", orgID: tc.orgID}
+
+			msg := unmarshalControlMessage(t, onlineHandshake)
+
+			deps := newTestControlMessageDeps(cm, resolver, dispatcherChanges)
+			deps.lastErrors = lastErrors
+			err := handleConnectionStatusMessage(context.Background(), client, "client-1", msg, cfg, deps, metrics)
+
+			connection := cm.GetConnection(context.TODO(), "1234", "client-1")
+
+			if tc.expectedRejected {
+				if err != ErrMissingOrgID {
+					t.Fatalf("Expected the client to be rejected, got %v", err)
+				}
+
+				if connection != nil {
+					t.Fatalf("Expected the rejected client to not be registered")
+				}
+
+				if len(client.published) != 1 || client.published[0].topic != "redhat/insights/client-1/control/in" {
+					t.Fatalf("Expected a reconnect command to be sent to the rejected client, got %+v", client.published)
+				}
+
+				if lastErrors.GetLastError("client-1") == nil {
+					t.Fatalf("Expected the rejection to be recorded")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error handling the online message: %s", err)
+			}
+
+			detailer, ok := connection.(controller.ClientDetailer)
+			if ok == false {
+				t.Fatalf("Expected the client to be registered")
+			}
+
+			if detailer.ClientDetails().OrgID != tc.orgID {
+				t.Fatalf("Expected the client's org id to be %q, got %q", tc.orgID, detailer.ClientDetails().OrgID)
+			}
+
+			if len(client.published) != 0 {
+				t.Fatalf("Expected no commands to be sent to the client, got %+v", client.published)
+			}
+		})
+	}
+}
+
+// consumerReplica handles connection-status messages the way a single consumer
+// does, but shares the connection registrar with the other replicas
+type consumerReplica struct {
+	client            *publishRecordingClient
+	dispatcherChanges *dispatcherChangeHandler
+	onlineGuard       *onlineMessageGuard
+}
+
+func newConsumerReplica(t *testing.T) *consumerReplica {
+	dispatcherChanges, _ := newTestDispatcherChangeHandler(t, "ignore")
+	return &consumerReplica{
+		client:            &publishRecordingClient{},
+		dispatcherChanges: dispatcherChanges,
+		onlineGuard:       newOnlineMessageGuard(NewLocalProcessedMessageStore(time.Minute), 0, metrics),
+	}
+}
+
+func (r *consumerReplica) handle(t *testing.T, cfg *config.Config, cm controller.ConnectionRegistrar, msg string) {
+	deps := newTestControlMessageDeps(cm, &staticAccountResolver{account: "1234"}, r.dispatcherChanges)
+	deps.onlineGuard = r.onlineGuard
+	err := handleConnectionStatusMessage(context.Background(), r.client, "client-1", unmarshalControlMessage(t, msg), cfg, deps, metrics)
+	if err != nil {
+		t.Fatalf("Unexpected error handling the connection-status message: %s", err)
+	}
+}
+
+func TestConnectionStatusHandledByDifferentReplicas(t *testing.T) {
+	const reconnectHandshake = `{"type": "connection-status", "message_id": "5678", "content": {"state": "online",
+	"canonical_facts": {"fqdn": "host.example.com", "ip_addresses": ["10.0.0.1"], "insights_id": "abcd"}, "capabilities": ["reconnect"]}}`
+
+	var tests = []struct {
+		name                 string
+		handling             string
+		expectedCapabilities []string
+	}{
+		{"keep the existing registration", DuplicateConnectionHandlingKeep, nil},
+		{"replace the existing registration", DuplicateConnectionHandlingReplace, []string{"reconnect"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := config.GetConfig()
+			cfg.DuplicateConnectionHandling = tc.handling
+
+			cm := controller.NewLocalConnectionManager()
+			replicaA := newConsumerReplica(t)
+			replicaB := newConsumerReplica(t)
+
+			// The client connects and its online message is handled by replica A
+			replicaA.handle(t, cfg, cm, onlineHandshake)
+
+			// The client reconnects without going offline and its online message is
+			// handled by replica B
+			replicaB.handle(t, cfg, cm, reconnectHandshake)
+
+			connection := cm.GetConnection(context.TODO(), "1234", "client-1")
+			if connection == nil {
+				t.Fatalf("Expected the client to be registered")
+			}
+
+			details := connection.(controller.ClientDetailer).ClientDetails()
+			if reflect.DeepEqual(details.Capabilities, tc.expectedCapabilities) == false {
+				t.Fatalf("Expected the registration to have capabilities %v, got %v", tc.expectedCapabilities, details.Capabilities)
+			}
+
+			// The client goes offline and its offline message is handled by replica A,
+			// which did not handle the latest online message
+			replicaA.handle(t, cfg, cm, offlineMessage)
+
+			if cm.GetConnection(context.TODO(), "1234", "client-1") != nil {
+				t.Fatalf("Expected the client to be unregistered by the other replica")
+			}
+
+			// The client comes back and its online message is handled by replica B
+			replicaB.handle(t, cfg, cm, `{"type": "connection-status", "message_id": "9012", "content": {"state": "online",
+	"canonical_facts": {"fqdn": "host.example.com", "ip_addresses": ["10.0.0.1"], "insights_id": "abcd"}}}`)
+
+			if cm.GetConnection(context.TODO(), "1234", "client-1") == nil {
+				t.Fatalf("Expected the client to be registered again")
+			}
+		})
+	}
+}
+
+func TestLateOfflineMessageFromReplacedSessionIsIgnored(t *testing.T) {
+	const (
+		firstSession = `{"type": "connection-status", "message_id": "1234", "sent": "2021-01-01T10:00:00Z", "content": {"state": "online",
+	"canonical_facts": {"fqdn": "host.example.com", "ip_addresses": ["10.0.0.1"], "insights_id": "abcd"}}}`
+		secondSession = `{"type": "connection-status", "message_id": "5678", "sent": "2021-01-01T10:05:00Z", "content": {"state": "online",
+	"canonical_facts": {"fqdn": "host.example.com", "ip_addresses": ["10.0.0.1"], "insights_id": "abcd"}, "capabilities": ["reconnect"]}}`
+		firstSessionWill     = `{"type": "connection-status", "message_id": "9012", "sent": "2021-01-01T10:00:00Z", "content": {"state": "offline"}}`
+		secondSessionOffline = `{"type": "connection-status", "message_id": "3456", "sent": "2021-01-01T10:10:00Z", "content": {"state": "offline"}}`
+	)
+
+	cfg := config.GetConfig()
+	cfg.DuplicateConnectionHandling = DuplicateConnectionHandlingReplace
+
+	cm := controller.NewLocalConnectionManager()
+	replicaA := newConsumerReplica(t)
+	replicaB := newConsumerReplica(t)
+
+	replicaA.handle(t, cfg, cm, firstSession)
+	replicaB.handle(t, cfg, cm, secondSession)
+
+	// The broker delivers the will message of the replaced session late
+	replicaA.handle(t, cfg, cm, firstSessionWill)
+
+	connection := cm.GetConnection(context.TODO(), "1234", "client-1")
+	if connection == nil {
+		t.Fatalf("Expected the offline message of the previous session to be ignored")
+	}
+
+	if details := connection.(controller.ClientDetailer).ClientDetails(); details.HasCapability("reconnect") == false {
+		t.Fatalf("Expected the second session to be registered, got %+v", details)
+	}
+
+	replicaB.handle(t, cfg, cm, secondSessionOffline)
+
+	if cm.GetConnection(context.TODO(), "1234", "client-1") != nil {
+		t.Fatalf("Expected the offline message of the current session to unregister the client")
+	}
+}
+
+func TestVerifyDuplicateConnectionHandling(t *testing.T) {
+	for _, mode := range []string{DuplicateConnectionHandlingKeep, DuplicateConnectionHandlingReplace} {
+		if err := VerifyDuplicateConnectionHandling(mode); err != nil {
+			t.Fatalf("Unexpected error verifying %s: %s", mode, err)
+		}
+	}
+
+	if err := VerifyDuplicateConnectionHandling("fred"); err != ErrInvalidDuplicateConnectionHandling {
+		t.Fatalf("Expected ErrInvalidDuplicateConnectionHandling, but got %v", err)
+	}
+}
+
+func controlMessageProcessingCount(t *testing.T, messageType string, outcome string) uint64 {
+	var m dto.Metric
+	histogram := metrics.controlMessageProcessingDuration.WithLabelValues(messageType, outcome).(prometheus.Metric)
+	if err := histogram.Write(&m); err != nil {
+		t.Fatalf("Unable to read the control message processing duration metric: %s", err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestControlMessageProcessingDuration(t *testing.T) {
+	var tests = []struct {
+		name            string
+		payload         string
+		expectedOutcome string
+	}{
+		{"successful online message", onlineHandshake, "success"},
+		{"missing connection state", `{"type": "connection-status", "message_id": "1234", "content": {}}`, "error"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := config.GetConfig()
+
+			dispatcherChanges, _ := newTestDispatcherChangeHandler(t, "ignore")
+
+			deps := newTestControlMessageDeps(controller.NewLocalConnectionManager(), &staticAccountResolver{account: "1234"}, dispatcherChanges)
+			handler := controlMessageHandler(cfg, deps, metrics)
+
+			before := controlMessageProcessingCount(t, "connection-status", tc.expectedOutcome)
+
+			handler(&publishRecordingClient{}, testMessage{topic: "redhat/insights/client-1/control/out", payload: []byte(tc.payload)})
+
+			if controlMessageProcessingCount(t, "connection-status", tc.expectedOutcome) != before+1 {
+				t.Fatalf("Expected the processing time to be recorded with the %s outcome", tc.expectedOutcome)
+			}
+		})
+	}
+}
+
+func TestDecodeControlMessage(t *testing.T) {
+	var tests = []struct {
+		name               string
+		payload            string
+		expectedError      bool
+		expectedUnexpected bool
+	}{
+		{"known fields", `{"type": "connection-status", "message_id": "1234", "version": 1, "content": {"state": "online"}}`, false, false},
+		{"unknown fields", `{"type": "connection-status", "message_id": "1234", "content": {}, "priority": "high"}`, false, true},
+		{"string content", `{"type": "connection-status", "message_id": "1234", "content": "online"}`, false, false},
+		{"mismatched type", `{"type": "connection-status", "message_id": "1234", "version": "one"}`, true, false},
+		{"invalid json", `{"type": "connection-status"`, true, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			unexpected := testutil.ToFloat64(metrics.unexpectedControlMessageContentCounter.WithLabelValues("connection-status"))
+
+			msg, err := parseControlMessage([]byte(tc.payload), metrics)
+
+			if tc.expectedError {
+				if err == nil {
+					t.Fatalf("Expected the message to fail to decode")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error decoding the message: %s", err)
+			}
+
+			if msg.MessageType != "connection-status" || msg.MessageID != "1234" {
+				t.Fatalf("Unexpected message: %+v", msg)
+			}
+
+			counted := testutil.ToFloat64(metrics.unexpectedControlMessageContentCounter.WithLabelValues("connection-status")) - unexpected
+			if tc.expectedUnexpected != (counted == 1) {
+				t.Fatalf("Expected unexpected content to be counted: %t, but the count changed by %f", tc.expectedUnexpected, counted)
+			}
+		})
+	}
+}
+
+func TestConnectionStatusMessageWithNonObjectContent(t *testing.T) {
+	cfg := config.GetConfig()
+	cm := controller.NewLocalConnectionManager()
+	dispatcherChanges, _ := newTestDispatcherChangeHandler(t, "ignore")
+	lastErrors := controller.NewLastErrorTracker(10, time.Minute)
+
+	for _, content := range []string{`"online"`, `["online"]`, `42`, `null`} {
+		t.Run(content, func(t *testing.T) {
+			msg := unmarshalControlMessage(t, `{"type": "connection-status", "message_id": "1234", "content": `+content+`}`)
+
+			deps := newTestControlMessageDeps(cm, &staticAccountResolver{account: "1234"}, dispatcherChanges)
+			deps.lastErrors = lastErrors
+			err := handleConnectionStatusMessage(context.Background(), &publishRecordingClient{}, "client-1", msg, cfg, deps, metrics)
+			if err != ErrInvalidControlMessageContent {
+				t.Fatalf("Expected %v, got %v", ErrInvalidControlMessageContent, err)
+			}
+
+			err = handleOnlineMessage(context.Background(), nil, "1234", "", "client-1", msg, cfg, deps, metrics)
+			if err != ErrInvalidControlMessageContent {
+				t.Fatalf("Expected %v, got %v", ErrInvalidControlMessageContent, err)
+			}
+
+			if cm.GetConnection(context.TODO(), "1234", "client-1") != nil {
+				t.Fatalf("Expected the client to not be registered")
+			}
+		})
+	}
+}
+
+func TestOnlineMessageWithMalformedDispatchers(t *testing.T) {
+	cfg := config.GetConfig()
+	cm := controller.NewLocalConnectionManager()
+	dispatcherChanges, recorder := newTestDispatcherChangeHandler(t, DispatcherChangeHandlingSync)
+
+	handle := func(dispatchers string) {
+		msg := unmarshalControlMessage(t, `{"type": "connection-status", "message_id": "1234", "content": {"state": "online",
+			"canonical_facts": {"fqdn": "host.example.com", "insights_id": "abcd"}, "dispatchers": `+dispatchers+`}}`)
+
+		deps := newTestControlMessageDeps(cm, nil, dispatcherChanges)
+		err := handleOnlineMessage(context.Background(), &publishRecordingClient{}, "1234", "", "client-1", msg, cfg, deps, metrics)
+		if err != nil {
+			t.Fatalf("Unexpected error handling the online message: %s", err)
+		}
+	}
+
+	for _, dispatchers := range []string{`["catalog"]`, `"catalog"`, `42`} {
+		handle(dispatchers)
+	}
+
+	if recorder.registered != 0 || recorder.unregistered != 0 {
+		t.Fatalf("Expected nothing to be recorded with sources")
+	}
+
+	if cm.GetConnection(context.TODO(), "1234", "client-1") == nil {
+		t.Fatalf("Expected the client to be registered")
+	}
+
+	// Malformed dispatchers must not be mistaken for the client losing its dispatchers
+	handle(`{"catalog": {"sources_type": "ansible-tower", "application_type": "/insights/platform/catalog"}}`)
+	handle(`["catalog"]`)
+
+	if recorder.registered != 1 || recorder.unregistered != 0 {
+		t.Fatalf("Expected the client to stay registered with sources, got %d registrations and %d unregistrations", recorder.registered, recorder.unregistered)
+	}
+}
+
+func TestOfflineMessageClearsRetainedConnectionStatus(t *testing.T) {
+	for _, clearRetained := range []bool{true, false} {
+		t.Run(fmt.Sprintf("clear=%t", clearRetained), func(t *testing.T) {
+			cfg := config.GetConfig()
+			cfg.ClearRetainedConnectionStatus = clearRetained
+
+			client := &publishRecordingClient{}
+			dispatcherChanges, _ := newTestDispatcherChangeHandler(t, "ignore")
+
+			deps := newTestControlMessageDeps(controller.NewLocalConnectionManager(), &staticAccountResolver{account: "1234"}, dispatcherChanges)
+			err := handleConnectionStatusMessage(context.Background(), client, "client-1", unmarshalControlMessage(t, offlineMessage), cfg, deps, metrics)
+			if err != nil {
+				t.Fatalf("Unexpected error handling the offline message: %s", err)
+			}
+
+			if clearRetained == false {
+				if len(client.published) != 0 {
+					t.Fatalf("Expected nothing to be published, got %d messages", len(client.published))
+				}
+				return
+			}
+
+			if len(client.published) != 1 {
+				t.Fatalf("Expected the retained message to be cleared, got %d messages", len(client.published))
+			}
+
+			published := client.published[0]
+			if published.topic != "redhat/insights/client-1/control/out" || published.retained == false || len(published.payload) != 0 {
+				t.Fatalf("Expected an empty retained message on the client's control topic, got %+v", published)
+			}
+		})
+	}
+}
+
+func TestOfflineMessageFromRejectedClientIsHandled(t *testing.T) {
+	var tests = []struct {
+		name     string
+		resolver *staticAccountResolver
+	}{
+		{"org id missing", &staticAccountResolver{account: "1234"}},
+		{"invalid account id", &staticAccountResolver{account: " 1234", orgID: "5678"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := config.GetConfig()
+			cfg.RequireOrgId = true
+
+			cm := controller.NewLocalConnectionManager()
+			cm.Register(context.TODO(), string(tc.resolver.account), "client-1", &ReceptorMQTTProxy{ClientID: "client-1"})
+
+			dispatcherChanges, _ := newTestDispatcherChangeHandler(t, "ignore")
+
+			deps := newTestControlMessageDeps(cm, tc.resolver, dispatcherChanges)
+			err := handleConnectionStatusMessage(context.Background(), &publishRecordingClient{}, "client-1", unmarshalControlMessage(t, offlineMessage), cfg, deps, metrics)
+			if err != nil {
+				t.Fatalf("Unexpected error handling the offline message: %s", err)
+			}
+
+			if cm.GetConnection(context.TODO(), string(tc.resolver.account), "client-1") != nil {
+				t.Fatalf("Expected the offline message to unregister the client")
+			}
+		})
+	}
+}
+
+func TestRejectionReplyIncludesCorrelationID(t *testing.T) {
+	cfg := config.GetConfig()
+	cfg.RequireOrgId = true
+
+	client := &publishRecordingClient{}
+	dispatcherChanges, _ := newTestDispatcherChangeHandler(t, "ignore")
+
+	msg := unmarshalControlMessage(t, onlineHandshake)
+	msg.CorrelationID = "abcd"
+
+	deps := newTestControlMessageDeps(controller.NewLocalConnectionManager(), &staticAccountResolver{account: "1234"}, dispatcherChanges)
+	handleConnectionStatusMessage(context.Background(), client, "client-1", msg, cfg, deps, metrics)
+
+	if len(client.published) != 1 {
+		t.Fatalf("Expected a reconnect command to be sent to the rejected client, got %d messages", len(client.published))
+	}
+
+	reply := unmarshalControlMessage(t, string(client.published[0].payload))
+	if reply.CorrelationID != "abcd" {
+		t.Fatalf("Expected the reply to carry the correlation id, got %q", reply.CorrelationID)
+	}
+}
+
+func TestClientWithInvalidAccountIDIsRejected(t *testing.T) {
+	cfg := config.GetConfig()
+	cm := controller.NewLocalConnectionManager()
+	dispatcherChanges, _ := newTestDispatcherChangeHandler(t, "ignore")
+
+	rejected := testutil.ToFloat64(metrics.rejectedClientCounter.WithLabelValues(rejectionReasonInvalidAccountID))
+
+	msg := unmarshalControlMessage(t, onlineHandshake)
+
+	deps := newTestControlMessageDeps(cm, &staticAccountResolver{account: " 1234"}, dispatcherChanges)
+	err := handleConnectionStatusMessage(context.Background(), &publishRecordingClient{}, "client-1", msg, cfg, deps, metrics)
+	if err != domain.ErrInvalidAccountID {
+		t.Fatalf("Expected %s, but got %v", domain.ErrInvalidAccountID, err)
+	}
+
+	if cm.GetConnection(context.TODO(), " 1234", "client-1") != nil {
+		t.Fatalf("Expected the client with the invalid account id not to be registered")
+	}
+
+	if delta := testutil.ToFloat64(metrics.rejectedClientCounter.WithLabelValues(rejectionReasonInvalidAccountID)) - rejected; delta != 1 {
+		t.Fatalf("Expected the rejection to be counted, but got %v", delta)
+	}
+}
+
+type failingAccountResolver struct {
+	err error
+}
+
+func (far *failingAccountResolver) MapClientIdToAccountId(ctx context.Context, clientID domain.ClientID) (domain.AccountID, domain.OrgID, error) {
+	return "", "", far.err
+}
+
+func TestReconnectUnlessTheAccountWasNotFound(t *testing.T) {
+	var tests = []struct {
+		name               string
+		err                error
+		expectedReconnects int
+	}{
+		{"downstream unavailable", fmt.Errorf("%w: connection refused", controller.ErrDownstreamUnavailable), 1},
+		{"account not found", controller.ErrUnknownClientCertificate, 0},
+		{"unclassified error", errors.New("unexpected response"), 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := config.GetConfig()
+			client := &publishRecordingClient{}
+			dispatcherChanges, _ := newTestDispatcherChangeHandler(t, "ignore")
+
+			deps := newTestControlMessageDeps(controller.NewLocalConnectionManager(), &failingAccountResolver{err: tc.err}, dispatcherChanges)
+			err := handleConnectionStatusMessage(context.Background(), client, "client-1", unmarshalControlMessage(t, onlineHandshake), cfg, deps, metrics)
+			if err != tc.err {
+				t.Fatalf("Expected the account resolver's error, got %v", err)
+			}
+
+			if len(client.published) != tc.expectedReconnects {
+				t.Fatalf("Expected %d reconnect messages, got %d", tc.expectedReconnects, len(client.published))
+			}
+		})
+	}
+}
+
+func TestControlMessageUpdatesLastSeen(t *testing.T) {
+	cfg := config.GetConfig()
+	cm := controller.NewLocalConnectionManager()
+	cm.Register(context.Background(), "1234", "client-1", &ReceptorMQTTProxy{ClientID: "client-1"})
+
+	lastSeen := time.Now().Add(-time.Hour)
+	cm.UpdateLastSeen(context.Background(), "client-1", lastSeen)
+
+	dispatcherChanges, _ := newTestDispatcherChangeHandler(t, "ignore")
+
+	deps := newTestControlMessageDeps(cm, &staticAccountResolver{account: "1234"}, dispatcherChanges)
+	handler := controlMessageHandler(cfg, deps, metrics)
+
+	handler(&publishRecordingClient{}, testMessage{topic: "redhat/insights/client-1/control/out",
+		payload: []byte(`{"type": "event", "message_id": "1234", "version": 1, "content": {"event": "job-progress"}}`)})
+
+	stale, _ := cm.FindStaleConnections(context.Background(), lastSeen.Add(time.Minute))
+	if len(stale) != 0 {
+		t.Fatalf("Expected the control message to update when the client was last seen, got stale connections %+v", stale)
+	}
+}
+
+type failingRegistrar struct {
+	controller.ConnectionRegistrar
+	err error
+}
+
+func (fr *failingRegistrar) Register(ctx context.Context, account string, nodeID string, client controller.Receptor) error {
+	return fr.err
+}
+
+func TestNoReconnectAfterOnlineHandlingFailure(t *testing.T) {
+	cfg := config.GetConfig()
+	client := &publishRecordingClient{}
+	dispatcherChanges, _ := newTestDispatcherChangeHandler(t, "ignore")
+	registrar := &failingRegistrar{ConnectionRegistrar: controller.NewLocalConnectionManager(), err: fmt.Errorf("%w: timed out", controller.ErrDownstreamUnavailable)}
+
+	deps := newTestControlMessageDeps(registrar, &staticAccountResolver{account: "1234"}, dispatcherChanges)
+	err := handleConnectionStatusMessage(context.Background(), client, "client-1", unmarshalControlMessage(t, onlineHandshake), cfg, deps, metrics)
+	if errors.Is(err, controller.ErrDownstreamUnavailable) == false {
+		t.Fatalf("Expected the registrar's error, got %v", err)
+	}
+
+	if len(client.published) != 0 {
+		t.Fatalf("Expected the client not to be asked to reconnect, got %d messages", len(client.published))
+	}
+}
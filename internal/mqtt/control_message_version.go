@@ -0,0 +1,101 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var ErrUnsupportedControlMessageVersion = errors.New("unsupported control message version")
+
+// controlMessageParser builds a control message of a specific version from the
+// message's top level fields
+type controlMessageParser func(fields map[string]json.RawMessage, metrics *Metrics) (ControlMessage, error)
+
+// controlMessageParsers holds a parser for each of the supported control message
+// versions.  A new version of the message schema is supported by adding its parser here.
+var controlMessageParsers = map[int]controlMessageParser{
+	1: decodeControlMessage,
+}
+
+// Clients that predate the version field do not send it
+const defaultControlMessageVersion = 1
+
+// controlMessageTypes are the types of control messages that clients send.  Any other
+// type is counted as unknown so that clients cannot grow the metric's cardinality.
+var controlMessageTypes = map[string]bool{
+	"connection-status": true,
+	"event":             true,
+}
+
+// Versions this far past the newest supported version are still counted as is, newer
+// (or nonsensical) versions are counted as unknown
+const controlMessageVersionLabelWindow = 3
+
+const unknownLabelValue = "unknown"
+
+// SupportedControlMessageVersions returns the control message versions that can be parsed
+func SupportedControlMessageVersions() []int {
+	versions := make([]int, 0, len(controlMessageParsers))
+	for version := range controlMessageParsers {
+		versions = append(versions, version)
+	}
+
+	sort.Ints(versions)
+
+	return versions
+}
+
+// parseControlMessage looks at the version of the control message and decodes it with
+// the parser for that version.  ErrUnsupportedControlMessageVersion is returned, and
+// counted, if the version is not one that we know how to parse.
+//
+// The payload is only parsed once, into its top level fields.  The version is read
+// from those fields and they are handed to the version's parser.
+func parseControlMessage(payload []byte, metrics *Metrics) (ControlMessage, error) {
+	var fields map[string]json.RawMessage
+
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return ControlMessage{}, err
+	}
+
+	version := defaultControlMessageVersion
+	if rawVersion, found := fields["version"]; found && string(rawVersion) != "null" {
+		if err := json.Unmarshal(rawVersion, &version); err != nil {
+			return ControlMessage{}, fmt.Errorf("invalid control message version: %w", err)
+		}
+	}
+
+	parser, supported := controlMessageParsers[version]
+	if supported == false {
+		var messageType string
+		json.Unmarshal(fields["type"], &messageType)
+
+		metrics.unsupportedControlMessageVersionCounter.WithLabelValues(controlMessageTypeLabel(messageType), controlMessageVersionLabel(version)).Inc()
+		return ControlMessage{}, fmt.Errorf("%w: %d (supported versions: %v)", ErrUnsupportedControlMessageVersion, version, SupportedControlMessageVersions())
+	}
+
+	return parser(fields, metrics)
+}
+
+// controlMessageTypeLabel limits the type label of the control message metrics to the
+// known message types
+func controlMessageTypeLabel(messageType string) string {
+	if controlMessageTypes[messageType] {
+		return messageType
+	}
+	return unknownLabelValue
+}
+
+// controlMessageVersionLabel limits the version label of the control message metrics to
+// the versions just past the newest supported version
+func controlMessageVersionLabel(version int) string {
+	versions := SupportedControlMessageVersions()
+	newest := versions[len(versions)-1]
+
+	if version < 1 || version > newest+controlMessageVersionLabelWindow {
+		return unknownLabelValue
+	}
+	return fmt.Sprint(version)
+}
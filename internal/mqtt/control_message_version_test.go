@@ -0,0 +1,110 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseControlMessageVersion(t *testing.T) {
+	var tests = []struct {
+		name                string
+		payload             string
+		expectedVersion     int
+		expectedUnsupported bool
+		expectedError       bool
+	}{
+		{"version 1", `{"type": "connection-status", "message_id": "1234", "version": 1, "content": {}}`, 1, false, false},
+		{"no version", `{"type": "connection-status", "message_id": "1234", "content": {}}`, 0, false, false},
+		{"unsupported version", `{"type": "connection-status", "message_id": "1234", "version": 2, "content": {}}`, 0, true, true},
+		{"invalid version", `{"type": "connection-status", "message_id": "1234", "version": "one"}`, 0, false, true},
+		{"invalid json", `{"type": "connection-status"`, 0, false, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			metrics := NewMetrics(prometheus.NewRegistry())
+
+			controlMsg, err := parseControlMessage([]byte(tc.payload), metrics)
+
+			if (err != nil) != tc.expectedError {
+				t.Fatalf("Unexpected error parsing the control message: %v", err)
+			}
+
+			if errors.Is(err, ErrUnsupportedControlMessageVersion) != tc.expectedUnsupported {
+				t.Fatalf("Expected the unsupported version error to be %t, got %v", tc.expectedUnsupported, err)
+			}
+
+			if err == nil && controlMsg.Version != tc.expectedVersion {
+				t.Fatalf("Expected version %d, got %d", tc.expectedVersion, controlMsg.Version)
+			}
+
+			unsupported := testutil.ToFloat64(metrics.unsupportedControlMessageVersionCounter.WithLabelValues("connection-status", "2"))
+			if (unsupported == 1) != tc.expectedUnsupported {
+				t.Fatalf("Expected the unsupported version to be counted only when it is rejected, count is %v", unsupported)
+			}
+		})
+	}
+}
+
+func TestParseControlMessageUsesVersionSpecificParser(t *testing.T) {
+	controlMessageParsers[2] = func(fields map[string]json.RawMessage, metrics *Metrics) (ControlMessage, error) {
+		return ControlMessage{MessageType: "connection-status", Version: 2}, nil
+	}
+	defer delete(controlMessageParsers, 2)
+
+	controlMsg, err := parseControlMessage([]byte(`{"type": "connection-status", "version": 2, "body": {}}`), NewMetrics(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatalf("Unexpected error parsing the control message: %s", err)
+	}
+
+	if controlMsg.Version != 2 {
+		t.Fatalf("Expected the version 2 parser to be used, got %+v", controlMsg)
+	}
+
+	if versions := SupportedControlMessageVersions(); len(versions) != 2 || versions[0] != 1 || versions[1] != 2 {
+		t.Fatalf("Expected versions 1 and 2 to be supported, got %v", versions)
+	}
+}
+
+func TestControlMessageLabelsAreClamped(t *testing.T) {
+	var tests = []struct {
+		messageType     string
+		version         int
+		expectedType    string
+		expectedVersion string
+	}{
+		{"connection-status", 2, "connection-status", "2"},
+		{"event", 4, "event", "4"},
+		{"made-up", 2, "unknown", "2"},
+		{"connection-status", 5, "connection-status", "unknown"},
+		{"connection-status", 0, "connection-status", "unknown"},
+		{"connection-status", -1, "connection-status", "unknown"},
+	}
+
+	for _, tc := range tests {
+		if label := controlMessageTypeLabel(tc.messageType); label != tc.expectedType {
+			t.Fatalf("Expected the type %s to be labeled %s, got %s", tc.messageType, tc.expectedType, label)
+		}
+
+		if label := controlMessageVersionLabel(tc.version); label != tc.expectedVersion {
+			t.Fatalf("Expected the version %d to be labeled %s, got %s", tc.version, tc.expectedVersion, label)
+		}
+	}
+}
+
+func TestUnsupportedVersionOfUnknownTypeIsCountedAsUnknown(t *testing.T) {
+	metrics := NewMetrics(prometheus.NewRegistry())
+
+	_, err := parseControlMessage([]byte(`{"type": "made-up", "version": 12345}`), metrics)
+	if errors.Is(err, ErrUnsupportedControlMessageVersion) == false {
+		t.Fatalf("Expected the unsupported version error, got %v", err)
+	}
+
+	if count := testutil.ToFloat64(metrics.unsupportedControlMessageVersionCounter.WithLabelValues("unknown", "unknown")); count != 1 {
+		t.Fatalf("Expected the unsupported version to be counted with unknown labels, got %v", count)
+	}
+}
@@ -0,0 +1,114 @@
+package mqtt
+
+import (
+	"context"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+// DataMessageSender publishes data messages to the clients' outgoing data topic.  It
+// does not require the MQTT client to be subscribed to any topics.
+type DataMessageSender struct {
+	client       MQTT.Client
+	topicBuilder *TopicBuilder
+	chunkSize    int
+	qos          byte
+	confirmer    *DeliveryConfirmer
+	sizeLimits   *MessageSizeLimits
+	capabilities *CapabilityGate
+}
+
+type DataMessageSenderOptionsFunc func(*DataMessageSender)
+
+// WithDataMessageQos sets the lowest QoS that the data messages are published with.
+// QoS 1 makes SendDataMessage wait for the broker to acknowledge each message.
+func WithDataMessageQos(qos byte) DataMessageSenderOptionsFunc {
+	return func(dms *DataMessageSender) {
+		dms.qos = qos
+	}
+}
+
+// WithDeliveryConfirmer confirms the delivery of each data message once the broker has
+// acknowledged it.  The data messages are published with at least QoS 1.
+func WithDeliveryConfirmer(confirmer *DeliveryConfirmer) DataMessageSenderOptionsFunc {
+	return func(dms *DataMessageSender) {
+		dms.confirmer = confirmer
+	}
+}
+
+// WithMessageSizeLimits rejects the data messages whose payload is larger than the
+// directive's size limit
+func WithMessageSizeLimits(limits *MessageSizeLimits) DataMessageSenderOptionsFunc {
+	return func(dms *DataMessageSender) {
+		dms.sizeLimits = limits
+	}
+}
+
+// WithDataMessageCapabilityGate only sends the data messages to the clients that
+// advertise the directive as one of their capabilities
+func WithDataMessageCapabilityGate(capabilities *CapabilityGate) DataMessageSenderOptionsFunc {
+	return func(dms *DataMessageSender) {
+		dms.capabilities = capabilities
+	}
+}
+
+func NewDataMessageSender(client MQTT.Client, topicBuilder *TopicBuilder, chunkSize int, opts ...DataMessageSenderOptionsFunc) *DataMessageSender {
+	dms := &DataMessageSender{
+		client:       client,
+		topicBuilder: topicBuilder,
+		chunkSize:    chunkSize,
+	}
+
+	for _, opt := range opts {
+		opt(dms)
+	}
+
+	return dms
+}
+
+// SendDataMessage publishes the payload to the client, splitting it into chunks if it
+// is larger than the chunk size.  It waits for each of the messages to be published
+// or for the context to expire.  The delivery is confirmed once all of the messages
+// have been published.
+func (dms *DataMessageSender) SendDataMessage(ctx context.Context, clientID domain.ClientID, directive string, payload interface{}) (*uuid.UUID, error) {
+
+	messageID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := dms.capabilities.check(ctx, clientID, directive); err != nil {
+		return nil, err
+	}
+
+	if err := dms.sizeLimits.check(directive, payload); err != nil {
+		return nil, err
+	}
+
+	messages, err := buildDataMessages(messageID, payload, dms.chunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	topic := dms.topicBuilder.BuildOutgoingDataTopic(clientID)
+
+	tokens := make([]MQTT.Token, 0, len(messages))
+
+	for _, message := range messages {
+		message.Directive = directive
+
+		t, err := publishDataMessage(ctx, dms.client, topic, dms.confirmer.dataMessageQos(dms.qos), message)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, t)
+	}
+
+	dms.confirmer.confirmDelivery(clientID, messageID.String(), directive, tokens)
+
+	return &messageID, nil
+}
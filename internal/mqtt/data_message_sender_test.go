@@ -0,0 +1,80 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestSendDataMessage(t *testing.T) {
+	client := &publishRecordingClient{}
+
+	messageID, err := NewDataMessageSender(client, NewTopicBuilder(), 0).SendDataMessage(context.TODO(), "client-1", "playbook", map[string]string{"url": "http://example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected error sending the data message: %s", err)
+	}
+
+	if len(client.published) != 1 {
+		t.Fatalf("Expected 1 data message to be published, but got %d", len(client.published))
+	}
+
+	if client.published[0].topic != "redhat/insights/client-1/data/in" {
+		t.Fatalf("Expected the data message to be published to the data topic, but got %s", client.published[0].topic)
+	}
+
+	var msg DataMessage
+	if err := json.Unmarshal(client.published[0].payload, &msg); err != nil {
+		t.Fatalf("Unexpected error unmarshalling the data message: %s", err)
+	}
+
+	if msg.MessageType != "data" || msg.MessageID != messageID.String() || msg.Directive != "playbook" {
+		t.Fatalf("Unexpected data message: %s", client.published[0].payload)
+	}
+}
+
+func TestSendChunkedDataMessage(t *testing.T) {
+	client := &publishRecordingClient{}
+
+	_, err := NewDataMessageSender(client, NewTopicBuilder(), 4).SendDataMessage(context.TODO(), "client-1", "playbook", "0123456789")
+	if err != nil {
+		t.Fatalf("Unexpected error sending the data message: %s", err)
+	}
+
+	if len(client.published) < 2 {
+		t.Fatalf("Expected the payload to be chunked, but got %d messages", len(client.published))
+	}
+
+	for _, published := range client.published {
+		var msg DataMessage
+		if err := json.Unmarshal(published.payload, &msg); err != nil {
+			t.Fatalf("Unexpected error unmarshalling the data message: %s", err)
+		}
+
+		if msg.Directive != "playbook" || msg.Chunk == nil {
+			t.Fatalf("Expected each chunk to carry the directive, but got %s", published.payload)
+		}
+	}
+}
+
+func TestSendDataMessageHonorsContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := NewDataMessageSender(incompletePublishClient{}, NewTopicBuilder(), 0).SendDataMessage(ctx, "client-1", "playbook", "payload")
+	if err != context.Canceled {
+		t.Fatalf("Expected the send to be canceled, but got %v", err)
+	}
+}
+
+func TestSendDataMessageWithQos(t *testing.T) {
+	client := &publishRecordingClient{}
+
+	_, err := NewDataMessageSender(client, NewTopicBuilder(), 0, WithDataMessageQos(1)).SendDataMessage(context.TODO(), "client-1", "playbook", "run")
+	if err != nil {
+		t.Fatalf("Unexpected error sending the data message: %s", err)
+	}
+
+	if len(client.published) != 1 || client.published[0].qos != 1 {
+		t.Fatalf("Expected the data message to be published with QoS 1, got %+v", client.published)
+	}
+}
@@ -0,0 +1,168 @@
+package mqtt
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+type pendingOnlineMessage struct {
+	client  MQTT.Client
+	message MQTT.Message
+	msg     ControlMessage
+	timer   *time.Timer
+	// done releases the in flight slot that is held while the message is pending
+	done func()
+}
+
+// onlineMessageDebouncer coalesces the online messages that a client sends within
+// the window into a single processing pass using the latest message.  The number
+// of clients with a pending message is limited to maxClients.  Once the limit is
+// reached, online messages are processed immediately instead of being debounced.
+// A pending message is counted as in flight so that a shutdown waits for it.  Once
+// the window has passed, the latest message is handed back to the message handler
+// chain so that it is handled by the same middlewares as every other message.
+type onlineMessageDebouncer struct {
+	window     time.Duration
+	maxClients int
+	pending    map[domain.ClientID]*pendingOnlineMessage
+	inFlight   *InFlightMessageTracker
+	redeliver  MQTT.MessageHandler
+	metrics    *Metrics
+	sync.Mutex
+}
+
+func newOnlineMessageDebouncer(window time.Duration, maxClients int, inFlight *InFlightMessageTracker, metrics *Metrics) *onlineMessageDebouncer {
+	return &onlineMessageDebouncer{
+		window:     window,
+		maxClients: maxClients,
+		pending:    make(map[domain.ClientID]*pendingOnlineMessage),
+		inFlight:   inFlight,
+		metrics:    metrics,
+	}
+}
+
+// attach sets the handler that the debounced messages are handed back to
+func (d *onlineMessageDebouncer) attach(redeliver MQTT.MessageHandler) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.redeliver = redeliver
+}
+
+// submit schedules the online message to be redelivered once the window has passed.
+// If the client already has a pending message, the pending message is replaced.
+// false is returned if the message was not debounced and has to be processed
+// immediately.
+func (d *onlineMessageDebouncer) submit(client MQTT.Client, message MQTT.Message, clientID domain.ClientID, msg ControlMessage) bool {
+	if d.window <= 0 || d.maxClients <= 0 {
+		return false
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	if d.redeliver == nil {
+		return false
+	}
+
+	if p, found := d.pending[clientID]; found {
+		p.client, p.message, p.msg = client, message, msg
+		d.metrics.debouncedOnlineMessageCounter.Inc()
+		return true
+	}
+
+	if len(d.pending) >= d.maxClients {
+		return false
+	}
+
+	redeliver := d.redeliver
+
+	p := &pendingOnlineMessage{client: client, message: message, msg: msg, done: d.trackInFlight()}
+	p.timer = time.AfterFunc(d.window, func() {
+		if d.take(clientID, p) {
+			redeliver(p.client, &debouncedMessage{Message: p.message, msg: p.msg})
+			p.done()
+		}
+	})
+	d.pending[clientID] = p
+
+	return true
+}
+
+// take removes the pending message.  false is returned if the message is no longer
+// pending (i.e. it was cancelled).  A message that has been taken is not updated
+// by submit anymore.
+func (d *onlineMessageDebouncer) take(clientID domain.ClientID, p *pendingOnlineMessage) bool {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.pending[clientID] != p {
+		return false
+	}
+
+	delete(d.pending, clientID)
+
+	return true
+}
+
+// cancel discards the client's pending online message.  This keeps a pending online
+// message from being processed after the client has gone offline.
+func (d *onlineMessageDebouncer) cancel(clientID domain.ClientID) {
+	d.Lock()
+	defer d.Unlock()
+
+	if p, found := d.pending[clientID]; found {
+		p.timer.Stop()
+		delete(d.pending, clientID)
+		p.done()
+	}
+}
+
+func (d *onlineMessageDebouncer) trackInFlight() func() {
+	if d.inFlight == nil {
+		return func() {}
+	}
+
+	return d.inFlight.track()
+}
+
+// debouncedMessage is an online message that is handed back to the message handler
+// chain once its debounce window has passed.  The message was already parsed and
+// verified when it was received so the handler processes it directly.
+type debouncedMessage struct {
+	MQTT.Message
+	msg ControlMessage
+}
+
+// clientLocks serializes the handling of each client's connection status messages.
+// A debounced online message is handled after its window has passed which would
+// otherwise allow it to be handled at the same time as the client's offline message.
+// The clients are spread over a fixed number of locks to bound the memory used.
+type clientLocks struct {
+	locks []sync.Mutex
+}
+
+func newClientLocks(count int) *clientLocks {
+	return &clientLocks{locks: make([]sync.Mutex, count)}
+}
+
+// lock locks the client's lock and returns the func that unlocks it
+func (cl *clientLocks) lock(clientID domain.ClientID) func() {
+	h := fnv.New32a()
+	h.Write([]byte(clientID))
+
+	l := &cl.locks[h.Sum32()%uint32(len(cl.locks))]
+	l.Lock()
+
+	return l.Unlock
+}
+
+func isOnlineMessage(msg ControlMessage) bool {
+	content, ok := msg.Content.(map[string]interface{})
+	return ok && content["state"] == "online"
+}
@@ -0,0 +1,245 @@
+package mqtt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func connectionStatusMessage(state string, messageID string) ControlMessage {
+	return ControlMessage{
+		MessageType: "connection-status",
+		MessageID:   messageID,
+		Content:     map[string]interface{}{"state": state},
+	}
+}
+
+func controlTopicMessage(clientID domain.ClientID) MQTT.Message {
+	return testMessage{topic: "redhat/insights/" + string(clientID) + "/control/out"}
+}
+
+// newRecordingDebouncer creates a debouncer that records the messages it hands back
+// to the message handler chain
+func newRecordingDebouncer(window time.Duration, maxClients int, inFlight *InFlightMessageTracker) (*onlineMessageDebouncer, chan ControlMessage) {
+	redelivered := make(chan ControlMessage, 10)
+
+	debouncer := newOnlineMessageDebouncer(window, maxClients, inFlight, metrics)
+	debouncer.attach(func(client MQTT.Client, message MQTT.Message) {
+		redelivered <- message.(*debouncedMessage).msg
+	})
+
+	return debouncer, redelivered
+}
+
+func submitOnlineMessage(debouncer *onlineMessageDebouncer, clientID domain.ClientID, messageID string) bool {
+	return debouncer.submit(&publishRecordingClient{}, controlTopicMessage(clientID), clientID, connectionStatusMessage("online", messageID))
+}
+
+func TestOnlineMessageDebounceCoalesces(t *testing.T) {
+	debouncer, redelivered := newRecordingDebouncer(50*time.Millisecond, 10, nil)
+
+	clientID := domain.ClientID("client-1")
+
+	for _, messageID := range []string{"1", "2", "3"} {
+		if submitOnlineMessage(debouncer, clientID, messageID) == false {
+			t.Fatalf("Expected message %s to be debounced", messageID)
+		}
+	}
+
+	select {
+	case msg := <-redelivered:
+		if msg.MessageID != "3" {
+			t.Fatalf("Expected the latest message to be redelivered, got message %s", msg.MessageID)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the debounced message to be redelivered")
+	}
+
+	select {
+	case msg := <-redelivered:
+		t.Fatalf("Expected a single redelivery, got an additional redelivery for message %s", msg.MessageID)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestOnlineMessageDebounceCancel(t *testing.T) {
+	debouncer, redelivered := newRecordingDebouncer(50*time.Millisecond, 10, nil)
+
+	clientID := domain.ClientID("client-1")
+
+	submitOnlineMessage(debouncer, clientID, "1")
+	debouncer.cancel(clientID)
+
+	select {
+	case msg := <-redelivered:
+		t.Fatalf("Expected the pending message to be discarded, got message %s", msg.MessageID)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestOnlineMessageDebounceBypass(t *testing.T) {
+	var tests = []struct {
+		name       string
+		window     time.Duration
+		maxClients int
+		attached   bool
+		pending    []domain.ClientID
+	}{
+		{"disabled", 0, 10, true, nil},
+		{"not attached", time.Minute, 10, false, nil},
+		{"max clients reached", time.Minute, 1, true, []domain.ClientID{"client-2"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			debouncer := newOnlineMessageDebouncer(tc.window, tc.maxClients, nil, metrics)
+			if tc.attached {
+				debouncer.attach(func(MQTT.Client, MQTT.Message) {})
+			}
+
+			for _, clientID := range tc.pending {
+				submitOnlineMessage(debouncer, clientID, "0")
+				defer debouncer.cancel(clientID)
+			}
+
+			if submitOnlineMessage(debouncer, "client-1", "1") {
+				t.Fatalf("Expected the message to be processed immediately")
+			}
+
+			if len(debouncer.pending) != len(tc.pending) {
+				t.Fatalf("Expected %d pending messages, got %d", len(tc.pending), len(debouncer.pending))
+			}
+		})
+	}
+}
+
+func TestIsOnlineMessage(t *testing.T) {
+	var tests = []struct {
+		msg      ControlMessage
+		expected bool
+	}{
+		{connectionStatusMessage("online", "1"), true},
+		{connectionStatusMessage("offline", "1"), false},
+		{ControlMessage{MessageType: "connection-status", Content: "online"}, false},
+	}
+
+	for _, tc := range tests {
+		if isOnlineMessage(tc.msg) != tc.expected {
+			t.Fatalf("Expected isOnlineMessage to return %t for %+v", tc.expected, tc.msg.Content)
+		}
+	}
+}
+
+func TestPendingOnlineMessageIsTrackedInFlight(t *testing.T) {
+	inFlight := NewInFlightMessageTracker()
+	debouncer, redelivered := newRecordingDebouncer(50*time.Millisecond, 10, inFlight)
+
+	submitOnlineMessage(debouncer, "client-1", "1")
+	submitOnlineMessage(debouncer, "client-1", "2")
+
+	if inFlight.InFlight() != 1 {
+		t.Fatalf("Expected the pending message to be in flight, got %d in flight", inFlight.InFlight())
+	}
+
+	if inFlight.Wait(time.Second) == false {
+		t.Fatalf("Expected the pending message to be handled before the timeout")
+	}
+
+	if len(redelivered) != 1 {
+		t.Fatalf("Expected the pending message to be redelivered before the wait returned")
+	}
+
+	submitOnlineMessage(debouncer, "client-2", "3")
+	debouncer.cancel("client-2")
+
+	if inFlight.InFlight() != 0 {
+		t.Fatalf("Expected the cancelled message to no longer be in flight, got %d in flight", inFlight.InFlight())
+	}
+}
+
+func TestDebouncedMessageIsHandledByTheMiddlewares(t *testing.T) {
+	metrics := NewMetrics(prometheus.NewRegistry())
+
+	handled := make(chan struct{})
+	handler := ChainMessageHandler(func(client MQTT.Client, message MQTT.Message) {
+		defer close(handled)
+		panic("unable to handle the message")
+	}, recoverMiddleware(metrics))
+
+	debouncer := newOnlineMessageDebouncer(10*time.Millisecond, 10, nil, metrics)
+	debouncer.attach(handler)
+
+	submitOnlineMessage(debouncer, "client-1", "1")
+
+	select {
+	case <-handled:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the debounced message to be redelivered")
+	}
+
+	if testutil.ToFloat64(metrics.messageHandlerPanicCounter) != 1 {
+		t.Fatalf("Expected the panic to be recovered by the middleware")
+	}
+}
+
+func TestDebouncedOnlineMessageRegistersTheClient(t *testing.T) {
+	cfg := config.GetConfig()
+
+	dispatcherChanges, _ := newTestDispatcherChangeHandler(t, "ignore")
+	cm := controller.NewLocalConnectionManager()
+
+	debouncer := newOnlineMessageDebouncer(50*time.Millisecond, 10, nil, metrics)
+
+	deps := newTestControlMessageDeps(cm, &staticAccountResolver{account: "1234"}, dispatcherChanges)
+	deps.debouncer = debouncer
+	handler := controlMessageHandler(cfg, deps, metrics)
+	debouncer.attach(handler)
+
+	handler(&publishRecordingClient{}, testMessage{topic: "redhat/insights/client-1/control/out", payload: []byte(onlineHandshake)})
+
+	if cm.GetConnection(context.TODO(), "1234", "client-1") != nil {
+		t.Fatalf("Expected the online message to be debounced")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for cm.GetConnection(context.TODO(), "1234", "client-1") == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the debounced online message to register the client")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClientLocksSerializeAClientsMessages(t *testing.T) {
+	locks := newClientLocks(8)
+
+	unlock := locks.lock("client-1")
+
+	locked := make(chan struct{})
+	go func() {
+		defer locks.lock("client-1")()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		t.Fatalf("Expected the client's lock to be held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the client's lock to be released")
+	}
+}
@@ -0,0 +1,126 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/queue"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+)
+
+const deliveryConfirmationType = "delivery-confirmation"
+
+// DeliveryConfirmation is the record that is written to kafka once the broker has
+// acknowledged each of the messages (chunks) that make up a data message
+type DeliveryConfirmation struct {
+	Type      string          `json:"type"`
+	MessageID string          `json:"message_id"`
+	ClientID  domain.ClientID `json:"client_id"`
+	Directive string          `json:"directive"`
+	Delivered Timestamp       `json:"delivered"`
+}
+
+// DeliveryConfirmer writes a delivery confirmation for each data message that the
+// broker acknowledged.  The data messages are published with QoS 1 while delivery
+// confirmations are enabled so that the broker acknowledges them with a PUBACK.
+type DeliveryConfirmer struct {
+	writer          queue.Writer
+	timestampFormat string
+	metrics         *Metrics
+}
+
+func NewDeliveryConfirmer(writer queue.Writer, timestampFormat string, metrics *Metrics) *DeliveryConfirmer {
+	return &DeliveryConfirmer{writer: writer, timestampFormat: timestampFormat, metrics: metrics}
+}
+
+func (dc *DeliveryConfirmer) confirm(clientID domain.ClientID, messageID string, directive string) {
+	logger := logger.Log.WithFields(logrus.Fields{"clientID": clientID, "message_id": messageID})
+
+	value, err := json.Marshal(DeliveryConfirmation{
+		Type:      deliveryConfirmationType,
+		MessageID: messageID,
+		ClientID:  clientID,
+		Directive: directive,
+		Delivered: newTimestamp(time.Now(), dc.timestampFormat),
+	})
+	if err != nil {
+		logger.WithFields(logrus.Fields{"error": err}).Warn("Unable to serialize the delivery confirmation")
+		dc.metrics.deliveryConfirmationCounter.WithLabelValues("failed").Inc()
+		return
+	}
+
+	confirmationMsg := kafka.Message{
+		Key:   []byte(clientID),
+		Value: value,
+		Headers: []kafka.Header{
+			kafka.Header{Key: "type", Value: []byte(deliveryConfirmationType)},
+			kafka.Header{Key: "message_id", Value: []byte(messageID)},
+		},
+	}
+
+	if err := dc.writer.WriteMessages(context.Background(), confirmationMsg); err != nil {
+		logger.WithFields(logrus.Fields{"error": err}).Error("Unable to write the delivery confirmation")
+		dc.metrics.deliveryConfirmationCounter.WithLabelValues("failed").Inc()
+		return
+	}
+
+	logger.Debug("Wrote the delivery confirmation")
+	dc.metrics.deliveryConfirmationCounter.WithLabelValues("confirmed").Inc()
+}
+
+// dataMessageQos returns the QoS that the data messages are published with.  QoS 1 is
+// required while delivery confirmations are enabled because QoS 0 messages are not
+// acknowledged by the broker.  A nil confirmer leaves the QoS unchanged.
+func (dc *DeliveryConfirmer) dataMessageQos(qos byte) byte {
+	if dc != nil && qos < 1 {
+		return 1
+	}
+	return qos
+}
+
+// confirmDelivery waits for the broker to acknowledge each of the tokens and then writes
+// the delivery confirmation.  Nothing is written if any of the messages failed or if
+// the confirmer is nil.
+func (dc *DeliveryConfirmer) confirmDelivery(clientID domain.ClientID, messageID string, directive string, tokens []MQTT.Token) {
+	if dc == nil {
+		return
+	}
+
+	for _, token := range tokens {
+		if token.Wait(); token.Error() != nil {
+			dc.metrics.deliveryConfirmationCounter.WithLabelValues("not_delivered").Inc()
+			return
+		}
+	}
+
+	dc.confirm(clientID, messageID, directive)
+}
+
+// publishDataMessage publishes a single data message and waits for it to be published
+// or for the context to expire.  The data message senders share it so that the
+// messages are published and confirmed the same way.
+func publishDataMessage(ctx context.Context, client MQTT.Client, topic string, qos byte, message interface{}) (MQTT.Token, error) {
+	messageBytes, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	t := client.Publish(topic, qos, false, messageBytes)
+
+	select {
+	case <-t.Done():
+		if t.Error() != nil {
+			return nil, t.Error()
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return t, nil
+}
@@ -0,0 +1,94 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+func TestSendDataMessageConfirmsDelivery(t *testing.T) {
+	writer := &recordingWriter{}
+	confirmer := NewDeliveryConfirmer(writer, TimestampFormatRFC3339, metrics)
+
+	client := &publishRecordingClient{}
+
+	messageID, err := NewDataMessageSender(client, NewTopicBuilder(), 4, WithDeliveryConfirmer(confirmer)).SendDataMessage(context.TODO(), "client-1", "playbook", "0123456789")
+	if err != nil {
+		t.Fatalf("Unexpected error sending the data message: %s", err)
+	}
+
+	for _, published := range client.published {
+		if published.qos != 1 {
+			t.Fatalf("Expected the data messages to be published with QoS 1, got %d", published.qos)
+		}
+	}
+
+	if len(writer.messages) != 1 {
+		t.Fatalf("Expected a single delivery confirmation for the chunked message, got %d", len(writer.messages))
+	}
+
+	var confirmation DeliveryConfirmation
+	if err := json.Unmarshal(writer.messages[0].Value, &confirmation); err != nil {
+		t.Fatalf("Unexpected error unmarshalling the delivery confirmation: %s", err)
+	}
+
+	if confirmation.Type != deliveryConfirmationType || confirmation.MessageID != messageID.String() ||
+		confirmation.ClientID != "client-1" || confirmation.Directive != "playbook" || confirmation.Delivered.IsZero() {
+		t.Fatalf("Unexpected delivery confirmation: %s", writer.messages[0].Value)
+	}
+
+	if string(writer.messages[0].Key) != "client-1" {
+		t.Fatalf("Expected the delivery confirmation to be keyed by the client id, got %s", writer.messages[0].Key)
+	}
+}
+
+func TestDeliveryIsNotConfirmedWhenDisabled(t *testing.T) {
+	client := &publishRecordingClient{}
+
+	_, err := NewDataMessageSender(client, NewTopicBuilder(), 0).SendDataMessage(context.TODO(), "client-1", "playbook", "payload")
+	if err != nil {
+		t.Fatalf("Unexpected error sending the data message: %s", err)
+	}
+
+	if client.published[0].qos != 0 {
+		t.Fatalf("Expected the data message to be published with QoS 0, got %d", client.published[0].qos)
+	}
+}
+
+func TestFailedDeliveryIsNotConfirmed(t *testing.T) {
+	writer := &recordingWriter{}
+	confirmer := NewDeliveryConfirmer(writer, TimestampFormatRFC3339, metrics)
+
+	confirmer.confirmDelivery("client-1", "1234", "playbook", []MQTT.Token{completedToken{}, failedToken{}})
+
+	if len(writer.messages) != 0 {
+		t.Fatalf("Expected the failed delivery to not be confirmed, got %d confirmations", len(writer.messages))
+	}
+}
+
+func TestReceptorProxyConfirmsDelivery(t *testing.T) {
+	writer := &recordingWriter{}
+	confirmer := NewDeliveryConfirmer(writer, TimestampFormatRFC3339, metrics)
+
+	proxy := &ReceptorMQTTProxy{ClientID: "client-1", Client: &publishRecordingClient{}, ChunkSize: 4, DeliveryConfirmer: confirmer}
+
+	messageID, err := proxy.SendMessage(context.TODO(), "1234", "client-1", "0123456789", "playbook")
+	if err != nil {
+		t.Fatalf("Unexpected error sending the data message: %s", err)
+	}
+
+	if len(writer.messages) != 1 {
+		t.Fatalf("Expected a single delivery confirmation for the chunked message, got %d", len(writer.messages))
+	}
+
+	var confirmation DeliveryConfirmation
+	if err := json.Unmarshal(writer.messages[0].Value, &confirmation); err != nil {
+		t.Fatalf("Unexpected error unmarshalling the delivery confirmation: %s", err)
+	}
+
+	if confirmation.MessageID != messageID.String() || confirmation.ClientID != "client-1" || confirmation.Directive != "playbook" {
+		t.Fatalf("Unexpected delivery confirmation: %s", writer.messages[0].Value)
+	}
+}
@@ -0,0 +1,47 @@
+package mqtt
+
+import (
+	"context"
+	"sync"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DisconnectHandler cleans up after the clients that went away without the consumer
+// handling their offline message.  The cleanup is the same as handling the client's
+// offline message.
+//
+// The handler is created before the connection to the broker so that it can be shared
+// with the connection reaper.  The consumer's state is attached once the connection is
+// created.
+type DisconnectHandler struct {
+	disconnect func(context.Context, domain.RhcClient)
+	sync.RWMutex
+}
+
+func NewDisconnectHandler() *DisconnectHandler {
+	return &DisconnectHandler{}
+}
+
+func (dh *DisconnectHandler) attach(disconnect func(context.Context, domain.RhcClient)) {
+	dh.Lock()
+	defer dh.Unlock()
+
+	dh.disconnect = disconnect
+}
+
+func (dh *DisconnectHandler) Disconnect(ctx context.Context, client domain.RhcClient) {
+	dh.RLock()
+	disconnect := dh.disconnect
+	dh.RUnlock()
+
+	if disconnect == nil {
+		logger.Log.WithFields(logrus.Fields{"clientID": client.ClientID, "account": client.Account}).Warn("Unable to disconnect the client before the consumer is connected")
+		return
+	}
+
+	disconnect(ctx, client)
+}
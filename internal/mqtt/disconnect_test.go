@@ -0,0 +1,75 @@
+package mqtt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+)
+
+type recordingConnectionEventPublisher struct {
+	events []controller.ConnectionEvent
+}
+
+func (rcep *recordingConnectionEventPublisher) Publish(event controller.ConnectionEvent) {
+	rcep.events = append(rcep.events, event)
+}
+
+func TestDisconnectHandlerCleansUpLikeAnOfflineMessage(t *testing.T) {
+	cfg := config.GetConfig()
+	cfg.ClearRetainedConnectionStatus = true
+
+	cm := controller.NewLocalConnectionManager()
+	cm.Register(context.TODO(), "1234", "client-1", &ReceptorMQTTProxy{ClientID: "client-1"})
+
+	client := &publishRecordingClient{}
+	events := &recordingConnectionEventPublisher{}
+
+	var deleted []domain.ClientID
+	ephemeralHosts := newEphemeralHostTracker(true, []string{"1234"}, 0, func(identity domain.Identity, clientID domain.ClientID) error {
+		deleted = append(deleted, clientID)
+		return nil
+	}, metrics)
+	ephemeralHosts.recordOnline("1234", "client-1", nil)
+
+	dch, _ := newTestDispatcherChangeHandler(t, DispatcherChangeHandlingSync)
+	dch.processDispatchers(context.TODO(), testIdentity, "client-1", withCatalog)
+
+	disconnects := NewDisconnectHandler()
+	disconnects.attach(func(ctx context.Context, rhcClient domain.RhcClient) {
+		deps := newTestControlMessageDeps(cm, nil, dch)
+		deps.ephemeralHosts = ephemeralHosts
+		deps.eventPublisher = events
+		disconnectClient(ctx, client, rhcClient.Account, rhcClient.OrgID, rhcClient.ClientID, cfg, deps, metrics, logger.Log.WithFields(nil))
+	})
+
+	disconnects.Disconnect(context.TODO(), domain.RhcClient{ClientID: "client-1", Account: "1234"})
+
+	if cm.GetConnection(context.TODO(), "1234", "client-1") != nil {
+		t.Fatalf("Expected the connection to be unregistered")
+	}
+
+	if len(events.events) != 1 || events.events[0].Event != controller.DisconnectedEvent || events.events[0].ClientID != "client-1" {
+		t.Fatalf("Expected a disconnected event to be published, got %+v", events.events)
+	}
+
+	if len(deleted) != 1 {
+		t.Fatalf("Expected the ephemeral host to be deleted from inventory, got %v", deleted)
+	}
+
+	if _, found := dch.dispatchers["client-1"]; found {
+		t.Fatalf("Expected the client's dispatchers to be forgotten")
+	}
+
+	if len(client.published) != 1 || client.published[0].retained == false {
+		t.Fatalf("Expected the retained connection-status to be cleared, got %+v", client.published)
+	}
+}
+
+func TestDisconnectHandlerBeforeAttach(t *testing.T) {
+	// Must not panic when the reaper runs before the consumer is connected
+	NewDisconnectHandler().Disconnect(context.TODO(), domain.RhcClient{ClientID: "client-1", Account: "1234"})
+}
@@ -0,0 +1,367 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+const (
+	DispatcherChangeHandlingSync   = "sync"
+	DispatcherChangeHandlingIgnore = "ignore"
+)
+
+var ErrInvalidDispatcherChangeHandling = errors.New("Invalid dispatcher change handling mode")
+
+// dispatcherChangeHandler remembers the dispatchers that each client reported
+// during its last handshake.  When a client reconnects with a different set of
+// dispatchers, the client's sources registration is updated to match.  In
+// "ignore" mode, the sources registration is only performed on the first
+// connection of a client.
+//
+// sourcesDispatchers maps the name of each dispatcher that is registered with
+// sources to the fields that the dispatcher must report.
+//
+// The dispatchers of a client that disconnected are kept for the retention so that
+// the client's next connection can still be compared with its last one.
+type dispatcherChangeHandler struct {
+	sourcesDispatchers map[string][]string
+	mode               string
+	identityHeader     controller.IdentityHeaderBuilder
+	retention          time.Duration
+	dispatchers        map[domain.ClientID]map[string]interface{}
+	pendingForgets     map[domain.ClientID]*time.Timer
+	metrics            *Metrics
+	sync.Mutex
+
+	registerInSources     func(context.Context, string, domain.AccountID, domain.ClientID, string, interface{}) error
+	unregisterFromSources func(context.Context, string, domain.AccountID, domain.ClientID, string, interface{}) error
+}
+
+func newDispatcherChangeHandler(sourcesDispatchers map[string][]string, mode string, identityHeader controller.IdentityHeaderBuilder, sourcesRecorder controller.SourcesRecorder, retention time.Duration, metrics *Metrics) (*dispatcherChangeHandler, error) {
+	if mode != DispatcherChangeHandlingSync && mode != DispatcherChangeHandlingIgnore {
+		return nil, ErrInvalidDispatcherChangeHandling
+	}
+
+	return &dispatcherChangeHandler{
+		sourcesDispatchers: sourcesDispatchers,
+		mode:               mode,
+		identityHeader:     identityHeader,
+		retention:          retention,
+		dispatchers:        make(map[domain.ClientID]map[string]interface{}),
+		pendingForgets:     make(map[domain.ClientID]*time.Timer),
+		metrics:            metrics,
+		registerInSources: func(ctx context.Context, identityHeader string, account domain.AccountID, clientID domain.ClientID, dispatcher string, dispatcherFacts interface{}) error {
+			return sourcesRecorder.RegisterWithSources(ctx, identityHeader, account, newSourceRegistration(clientID, dispatcherFacts))
+		},
+		unregisterFromSources: func(ctx context.Context, identityHeader string, account domain.AccountID, clientID domain.ClientID, dispatcher string, dispatcherFacts interface{}) error {
+			// Only the lost dispatcher's application is removed, so the facts that the
+			// client reported for it on its previous connection are used
+			return sourcesRecorder.UnregisterFromSources(ctx, identityHeader, account, newSourceRegistration(clientID, dispatcherFacts))
+		},
+	}, nil
+}
+
+// newSourceRegistration builds the source for a client from the facts that the client
+// reported for the dispatcher.  The client id is used as the source ref and, unless the
+// client reported a source name, as the name of the source.
+func newSourceRegistration(clientID domain.ClientID, dispatcherFacts interface{}) controller.SourceRegistration {
+	facts, _ := dispatcherFacts.(map[string]interface{})
+
+	source := controller.SourceRegistration{
+		SourceRef: string(clientID),
+		Name:      string(clientID),
+	}
+
+	if name, ok := facts["source_name"].(string); ok && name != "" {
+		source.Name = name
+	}
+
+	source.SourceType, _ = facts["sources_type"].(string)
+	source.ApplicationType, _ = facts["application_type"].(string)
+
+	return source
+}
+
+// processDispatchers compares the dispatchers that the client reported with the dispatchers
+// the client reported on its previous connection and updates the client's sources
+// registration accordingly.  The outcome is returned so that the caller can log it and
+// make it available via the api.
+func (dch *dispatcherChangeHandler) processDispatchers(ctx context.Context, identity domain.Identity, clientID domain.ClientID, dispatchers map[string]interface{}) domain.DispatchersResult {
+	dch.Lock()
+	defer dch.Unlock()
+
+	// The client reconnected before its dispatchers were forgotten
+	if pendingForget, found := dch.pendingForgets[clientID]; found {
+		pendingForget.Stop()
+		delete(dch.pendingForgets, clientID)
+	}
+
+	previous, reconnect := dch.dispatchers[clientID]
+
+	gained, lost := diffDispatchers(previous, dispatchers)
+
+	result := domain.DispatchersResult{
+		Dispatchers: dispatcherNames(dispatchers),
+	}
+
+	if reconnect {
+		result.Gained = gained
+		result.Lost = lost
+
+		for _, dispatcher := range gained {
+			dch.metrics.dispatcherChangeCounter.WithLabelValues(dch.dispatcherLabel(dispatcher), "gained").Inc()
+		}
+
+		for _, dispatcher := range lost {
+			dch.metrics.dispatcherChangeCounter.WithLabelValues(dch.dispatcherLabel(dispatcher), "lost").Inc()
+		}
+	}
+
+	var failed []string
+
+	if reconnect && dch.mode == DispatcherChangeHandlingIgnore {
+		result.SourcesRegistration = domain.SourcesRegistrationSkipped
+		result.Detail = "Dispatcher changes are ignored"
+	} else {
+		result.SourcesRegistration, result.Detail, failed = dch.syncSourcesRegistrations(ctx, identity, clientID, previous, dispatchers, gained, lost)
+	}
+
+	dch.dispatchers[clientID] = dispatchersToRemember(previous, dispatchers, failed)
+
+	return result
+}
+
+// dispatchersToRemember returns the dispatchers that the next connection of the client
+// is compared with.  The dispatchers whose sources registration failed are remembered
+// as they were before so that the next connection only retries the failed changes.
+func dispatchersToRemember(previous map[string]interface{}, dispatchers map[string]interface{}, failed []string) map[string]interface{} {
+	if len(failed) == 0 {
+		return dispatchers
+	}
+
+	remembered := make(map[string]interface{}, len(dispatchers))
+	for dispatcher, facts := range dispatchers {
+		remembered[dispatcher] = facts
+	}
+
+	for _, dispatcher := range failed {
+		if facts, existed := previous[dispatcher]; existed {
+			remembered[dispatcher] = facts
+		} else {
+			delete(remembered, dispatcher)
+		}
+	}
+
+	return remembered
+}
+
+// forget discards the dispatchers of a client that disconnected once the retention
+// has passed
+func (dch *dispatcherChangeHandler) forget(clientID domain.ClientID) {
+	dch.Lock()
+	defer dch.Unlock()
+
+	if _, found := dch.dispatchers[clientID]; found == false {
+		return
+	}
+
+	if dch.retention <= 0 {
+		delete(dch.dispatchers, clientID)
+		return
+	}
+
+	if pendingForget, found := dch.pendingForgets[clientID]; found {
+		pendingForget.Stop()
+	}
+
+	var pendingForget *time.Timer
+	pendingForget = time.AfterFunc(dch.retention, func() {
+		dch.Lock()
+		defer dch.Unlock()
+
+		// The client reconnected after the timer fired
+		if dch.pendingForgets[clientID] != pendingForget {
+			return
+		}
+
+		delete(dch.pendingForgets, clientID)
+		delete(dch.dispatchers, clientID)
+	})
+
+	dch.pendingForgets[clientID] = pendingForget
+}
+
+// dispatcherLabel keeps the cardinality of the dispatcher label bounded.  The clients
+// can report any dispatcher name so only the names that are mapped to sources are used
+// as is.
+func (dch *dispatcherChangeHandler) dispatcherLabel(dispatcher string) string {
+	if _, known := dch.sourcesDispatchers[dispatcher]; known {
+		return dispatcher
+	}
+	return "other"
+}
+
+// syncSourcesRegistrations updates the sources registration of each dispatcher that is
+// mapped to sources.  A failure does not stop the other dispatchers from being updated,
+// the dispatchers that failed are returned so that only they are retried.  When more than
+// one dispatcher is mapped, the most significant outcome is reported:  a failure, then a
+// registration, then an unregistration.
+func (dch *dispatcherChangeHandler) syncSourcesRegistrations(ctx context.Context, identity domain.Identity, clientID domain.ClientID, previous map[string]interface{}, dispatchers map[string]interface{}, gained []string, lost []string) (string, string, []string) {
+	outcomes := make(map[string][]string)
+
+	var failed []string
+
+	for _, dispatcher := range dch.sourcesDispatcherNames() {
+		registration, detail := dch.syncSourcesRegistration(ctx, identity, clientID, dispatcher, previous, dispatchers, gained, lost)
+		outcomes[registration] = append(outcomes[registration], detail)
+
+		if registration == domain.SourcesRegistrationFailed {
+			failed = append(failed, dispatcher)
+		}
+	}
+
+	for _, registration := range []string{domain.SourcesRegistrationFailed, domain.SourcesRegistrationRegistered,
+		domain.SourcesRegistrationUnregistered, domain.SourcesRegistrationSkipped} {
+		details, exists := outcomes[registration]
+		if exists == false {
+			continue
+		}
+
+		var nonEmptyDetails []string
+		for _, detail := range details {
+			if detail != "" {
+				nonEmptyDetails = append(nonEmptyDetails, detail)
+			}
+		}
+
+		return registration, strings.Join(nonEmptyDetails, "; "), failed
+	}
+
+	return domain.SourcesRegistrationSkipped, "No dispatchers are mapped to sources", failed
+}
+
+func (dch *dispatcherChangeHandler) syncSourcesRegistration(ctx context.Context, identity domain.Identity, clientID domain.ClientID, dispatcher string, previous map[string]interface{}, dispatchers map[string]interface{}, gained []string, lost []string) (string, string) {
+	switch {
+	case containsDispatcher(gained, dispatcher):
+		if err := verifyDispatcherFacts(dispatchers[dispatcher], dch.sourcesDispatchers[dispatcher]); err != nil {
+			return domain.SourcesRegistrationFailed, err.Error()
+		}
+
+		identityHeader, err := dch.identityHeader.BuildIdentityHeader(identity)
+		if err != nil {
+			return domain.SourcesRegistrationFailed, err.Error()
+		}
+
+		if err := dch.registerInSources(ctx, identityHeader, identity.AccountNumber, clientID, dispatcher, dispatchers[dispatcher]); err != nil {
+			return domain.SourcesRegistrationFailed, err.Error()
+		}
+
+		return domain.SourcesRegistrationRegistered, ""
+	case containsDispatcher(lost, dispatcher):
+		identityHeader, err := dch.identityHeader.BuildIdentityHeader(identity)
+		if err != nil {
+			return domain.SourcesRegistrationFailed, err.Error()
+		}
+
+		if err := dch.unregisterFromSources(ctx, identityHeader, identity.AccountNumber, clientID, dispatcher, previous[dispatcher]); err != nil {
+			return domain.SourcesRegistrationFailed, err.Error()
+		}
+
+		return domain.SourcesRegistrationUnregistered, ""
+	default:
+		if _, exists := dispatchers[dispatcher]; exists {
+			return domain.SourcesRegistrationSkipped, fmt.Sprintf("The %s dispatcher has not changed", dispatcher)
+		}
+		return domain.SourcesRegistrationSkipped, fmt.Sprintf("The %s dispatcher is not present", dispatcher)
+	}
+}
+
+func (dch *dispatcherChangeHandler) sourcesDispatcherNames() []string {
+	names := make([]string, 0, len(dch.sourcesDispatchers))
+	for dispatcher := range dch.sourcesDispatchers {
+		names = append(names, dispatcher)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// verifyDispatcherFacts makes sure the dispatcher includes the facts that
+// are required to register the client with sources
+func verifyDispatcherFacts(dispatcherFacts interface{}, requiredFields []string) error {
+	facts, _ := dispatcherFacts.(map[string]interface{})
+
+	var missingFields []string
+	for _, field := range requiredFields {
+		if value, ok := facts[field].(string); ok == false || value == "" {
+			missingFields = append(missingFields, field)
+		}
+	}
+
+	if len(missingFields) > 0 {
+		return fmt.Errorf("Dispatcher is missing required fields: %s", strings.Join(missingFields, ", "))
+	}
+
+	return nil
+}
+
+func dispatcherNames(dispatchers map[string]interface{}) []string {
+	names := make([]string, 0, len(dispatchers))
+	for dispatcher := range dispatchers {
+		names = append(names, dispatcher)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func diffDispatchers(previous map[string]interface{}, current map[string]interface{}) (gained []string, lost []string) {
+	for dispatcher := range current {
+		if _, exists := previous[dispatcher]; exists == false {
+			gained = append(gained, dispatcher)
+		}
+	}
+
+	for dispatcher := range previous {
+		if _, exists := current[dispatcher]; exists == false {
+			lost = append(lost, dispatcher)
+		}
+	}
+
+	sort.Strings(gained)
+	sort.Strings(lost)
+
+	return gained, lost
+}
+
+func containsDispatcher(dispatchers []string, dispatcher string) bool {
+	for _, d := range dispatchers {
+		if d == dispatcher {
+			return true
+		}
+	}
+	return false
+}
+
+// getDispatchers returns the dispatchers reported in the handshake.  A handshake without
+// any dispatchers reports an empty set of dispatchers.  false is returned if the client
+// reported the dispatchers as something other than a JSON object.
+func getDispatchers(handshakePayload map[string]interface{}) (map[string]interface{}, bool) {
+	value, exists := handshakePayload["dispatchers"]
+	if exists == false || value == nil {
+		return make(map[string]interface{}), true
+	}
+
+	dispatchers, ok := value.(map[string]interface{})
+	if ok == false {
+		return nil, false
+	}
+
+	return dispatchers, true
+}
@@ -0,0 +1,470 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type sourcesRecorder struct {
+	registered   int
+	unregistered int
+	err          error
+}
+
+func newTestDispatcherChangeHandler(t *testing.T, mode string) (*dispatcherChangeHandler, *sourcesRecorder) {
+	dch, err := newDispatcherChangeHandler(catalogDispatcherMapping, mode, &controller.IdentityHeaderV1Builder{}, controller.NewFakeSourcesRecorder(), 0, metrics)
+	if err != nil {
+		t.Fatalf("Unexpected error creating the dispatcher change handler: %s", err)
+	}
+
+	recorder := &sourcesRecorder{}
+	dch.registerInSources = func(context.Context, string, domain.AccountID, domain.ClientID, string, interface{}) error {
+		recorder.registered++
+		return recorder.err
+	}
+	dch.unregisterFromSources = func(context.Context, string, domain.AccountID, domain.ClientID, string, interface{}) error {
+		recorder.unregistered++
+		return recorder.err
+	}
+
+	return dch, recorder
+}
+
+var (
+	catalogDispatcherMapping = map[string][]string{"catalog": []string{"sources_type", "application_type"}}
+
+	testIdentity = domain.Identity{AccountNumber: "1234", OrgID: "5678", Type: downstreamIdentityType}
+
+	withoutCatalog = map[string]interface{}{
+		"rhc-worker-playbook": map[string]interface{}{},
+	}
+	withCatalog = map[string]interface{}{
+		"rhc-worker-playbook": map[string]interface{}{},
+		"catalog":             map[string]interface{}{"sources_type": "ansible-tower", "application_type": "/insights/platform/catalog"},
+	}
+	withIncompleteCatalog = map[string]interface{}{
+		"catalog": map[string]interface{}{"sources_type": "ansible-tower"},
+	}
+)
+
+func verifyDispatchersResult(t *testing.T, result domain.DispatchersResult, expected string) {
+	if result.SourcesRegistration != expected {
+		t.Fatalf("Expected sources registration to be %s, but got %s (%s)", expected, result.SourcesRegistration, result.Detail)
+	}
+}
+
+func TestInvalidDispatcherChangeHandling(t *testing.T) {
+	_, err := newDispatcherChangeHandler(catalogDispatcherMapping, "fred", &controller.IdentityHeaderV1Builder{}, controller.NewFakeSourcesRecorder(), 0, metrics)
+	if err != ErrInvalidDispatcherChangeHandling {
+		t.Fatalf("Expected ErrInvalidDispatcherChangeHandling, but got %v", err)
+	}
+}
+
+func TestFirstConnectWithCatalog(t *testing.T) {
+	dch, recorder := newTestDispatcherChangeHandler(t, DispatcherChangeHandlingSync)
+
+	result := dch.processDispatchers(context.TODO(), testIdentity, "client-1", withCatalog)
+	verifyDispatchersResult(t, result, domain.SourcesRegistrationRegistered)
+
+	if len(result.Dispatchers) != 2 || result.Dispatchers[0] != "catalog" || result.Dispatchers[1] != "rhc-worker-playbook" {
+		t.Fatalf("Unexpected dispatchers in result: %v", result.Dispatchers)
+	}
+
+	result = dch.processDispatchers(context.TODO(), testIdentity, "client-1", withCatalog)
+	verifyDispatchersResult(t, result, domain.SourcesRegistrationSkipped)
+
+	if recorder.registered != 1 || recorder.unregistered != 0 {
+		t.Fatalf("Expected a single sources registration, but got %d registrations and %d unregistrations", recorder.registered, recorder.unregistered)
+	}
+}
+
+func TestCatalogMissingFields(t *testing.T) {
+	dch, recorder := newTestDispatcherChangeHandler(t, DispatcherChangeHandlingSync)
+
+	result := dch.processDispatchers(context.TODO(), testIdentity, "client-1", withIncompleteCatalog)
+	verifyDispatchersResult(t, result, domain.SourcesRegistrationFailed)
+
+	if result.Detail != "Dispatcher is missing required fields: application_type" {
+		t.Fatalf("Unexpected detail: %s", result.Detail)
+	}
+
+	if recorder.registered != 0 {
+		t.Fatalf("Expected the connection to not be registered with sources")
+	}
+
+	// The registration should be attempted again when the client reconnects
+	result = dch.processDispatchers(context.TODO(), testIdentity, "client-1", withCatalog)
+	verifyDispatchersResult(t, result, domain.SourcesRegistrationRegistered)
+}
+
+func TestNoDispatchers(t *testing.T) {
+	dch, recorder := newTestDispatcherChangeHandler(t, DispatcherChangeHandlingSync)
+
+	dispatchers, _ := getDispatchers(map[string]interface{}{})
+
+	result := dch.processDispatchers(context.TODO(), testIdentity, "client-1", dispatchers)
+	verifyDispatchersResult(t, result, domain.SourcesRegistrationSkipped)
+
+	if len(result.Dispatchers) != 0 {
+		t.Fatalf("Expected no dispatchers in result, but got %v", result.Dispatchers)
+	}
+
+	if recorder.registered != 0 || recorder.unregistered != 0 {
+		t.Fatalf("Expected sources to not be called")
+	}
+}
+
+func TestSourcesRegistrationFailure(t *testing.T) {
+	dch, recorder := newTestDispatcherChangeHandler(t, DispatcherChangeHandlingSync)
+	recorder.err = errors.New("sources is down")
+
+	result := dch.processDispatchers(context.TODO(), testIdentity, "client-1", withCatalog)
+	verifyDispatchersResult(t, result, domain.SourcesRegistrationFailed)
+
+	if result.Detail != "sources is down" {
+		t.Fatalf("Unexpected detail: %s", result.Detail)
+	}
+}
+
+func TestReconnectWithCatalogGained(t *testing.T) {
+	dch, recorder := newTestDispatcherChangeHandler(t, DispatcherChangeHandlingSync)
+
+	result := dch.processDispatchers(context.TODO(), testIdentity, "client-1", withoutCatalog)
+	verifyDispatchersResult(t, result, domain.SourcesRegistrationSkipped)
+
+	if recorder.registered != 0 {
+		t.Fatalf("Expected no sources registration before the worker was installed")
+	}
+
+	result = dch.processDispatchers(context.TODO(), testIdentity, "client-1", withCatalog)
+	verifyDispatchersResult(t, result, domain.SourcesRegistrationRegistered)
+
+	if len(result.Gained) != 1 || result.Gained[0] != "catalog" {
+		t.Fatalf("Unexpected gained dispatchers in result: %v", result.Gained)
+	}
+
+	if recorder.registered != 1 {
+		t.Fatalf("Expected the connection to be registered with sources when the worker was gained")
+	}
+}
+
+func TestReconnectWithCatalogLost(t *testing.T) {
+	dch, recorder := newTestDispatcherChangeHandler(t, DispatcherChangeHandlingSync)
+
+	dch.processDispatchers(context.TODO(), testIdentity, "client-1", withCatalog)
+	result := dch.processDispatchers(context.TODO(), testIdentity, "client-1", withoutCatalog)
+	verifyDispatchersResult(t, result, domain.SourcesRegistrationUnregistered)
+
+	if recorder.unregistered != 1 {
+		t.Fatalf("Expected the connection to be unregistered from sources when the worker was lost")
+	}
+}
+
+func TestReconnectWithinRetentionKeepsTheDispatchers(t *testing.T) {
+	dch, recorder := newTestDispatcherChangeHandler(t, DispatcherChangeHandlingSync)
+	dch.retention = time.Hour
+
+	dch.processDispatchers(context.TODO(), testIdentity, "client-1", withCatalog)
+	dch.forget("client-1")
+
+	result := dch.processDispatchers(context.TODO(), testIdentity, "client-1", withoutCatalog)
+	verifyDispatchersResult(t, result, domain.SourcesRegistrationUnregistered)
+
+	if recorder.unregistered != 1 {
+		t.Fatalf("Expected the lost worker to be detected across the disconnect")
+	}
+
+	if len(dch.pendingForgets) != 0 {
+		t.Fatalf("Expected the reconnect to cancel the pending forget")
+	}
+}
+
+func TestDispatchersAreForgottenAfterRetention(t *testing.T) {
+	dch, _ := newTestDispatcherChangeHandler(t, DispatcherChangeHandlingSync)
+	dch.retention = 10 * time.Millisecond
+
+	dch.processDispatchers(context.TODO(), testIdentity, "client-1", withCatalog)
+	dch.forget("client-1")
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		dch.Lock()
+		_, found := dch.dispatchers["client-1"]
+		dch.Unlock()
+
+		if found == false {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the client's dispatchers to be forgotten after the retention")
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestUnknownDispatchersAreCountedAsOther(t *testing.T) {
+	dch, _ := newTestDispatcherChangeHandler(t, DispatcherChangeHandlingSync)
+
+	before := testutil.ToFloat64(metrics.dispatcherChangeCounter.WithLabelValues("other", "gained"))
+
+	dch.processDispatchers(context.TODO(), testIdentity, "client-1", map[string]interface{}{})
+	dch.processDispatchers(context.TODO(), testIdentity, "client-1", map[string]interface{}{"made-up-worker": map[string]interface{}{}})
+
+	if after := testutil.ToFloat64(metrics.dispatcherChangeCounter.WithLabelValues("other", "gained")); after != before+1 {
+		t.Fatalf("Expected the unknown dispatcher to be counted as other, got %v", after-before)
+	}
+
+	if dch.dispatcherLabel("catalog") != "catalog" {
+		t.Fatalf("Expected the known dispatcher to keep its name")
+	}
+}
+
+func TestDispatcherChangesIgnored(t *testing.T) {
+	dch, recorder := newTestDispatcherChangeHandler(t, DispatcherChangeHandlingIgnore)
+
+	dch.processDispatchers(context.TODO(), testIdentity, "client-1", withCatalog)
+	dch.processDispatchers(context.TODO(), testIdentity, "client-1", withoutCatalog)
+	result := dch.processDispatchers(context.TODO(), testIdentity, "client-1", withCatalog)
+	verifyDispatchersResult(t, result, domain.SourcesRegistrationSkipped)
+
+	if recorder.registered != 1 || recorder.unregistered != 0 {
+		t.Fatalf("Expected only the first connection to be registered, but got %d registrations and %d unregistrations", recorder.registered, recorder.unregistered)
+	}
+}
+
+func TestDiffDispatchers(t *testing.T) {
+	gained, lost := diffDispatchers(withCatalog, map[string]interface{}{"rhc-worker-playbook": nil, "foreman": nil})
+
+	if len(gained) != 1 || gained[0] != "foreman" {
+		t.Fatalf("Unexpected gained dispatchers: %v", gained)
+	}
+
+	if len(lost) != 1 || lost[0] != "catalog" {
+		t.Fatalf("Unexpected lost dispatchers: %v", lost)
+	}
+}
+
+func TestCustomDispatcherMapping(t *testing.T) {
+	mapping := map[string][]string{
+		"catalog": []string{"sources_type", "application_type"},
+		"foreman": []string{"satellite_instance_id"},
+	}
+
+	dch, err := newDispatcherChangeHandler(mapping, DispatcherChangeHandlingSync, &controller.IdentityHeaderV1Builder{}, controller.NewFakeSourcesRecorder(), 0, metrics)
+	if err != nil {
+		t.Fatalf("Unexpected error creating the dispatcher change handler: %s", err)
+	}
+
+	var registered, unregistered []string
+	dch.registerInSources = func(ctx context.Context, identityHeader string, account domain.AccountID, clientID domain.ClientID, dispatcher string, facts interface{}) error {
+		registered = append(registered, dispatcher)
+		return nil
+	}
+	dch.unregisterFromSources = func(ctx context.Context, identityHeader string, account domain.AccountID, clientID domain.ClientID, dispatcher string, facts interface{}) error {
+		unregistered = append(unregistered, dispatcher)
+		return nil
+	}
+
+	withForeman := map[string]interface{}{
+		"rhc-worker-playbook": map[string]interface{}{},
+		"foreman":             map[string]interface{}{"satellite_instance_id": "1234"},
+	}
+
+	result := dch.processDispatchers(context.TODO(), testIdentity, "client-1", withForeman)
+	verifyDispatchersResult(t, result, domain.SourcesRegistrationRegistered)
+
+	if len(registered) != 1 || registered[0] != "foreman" {
+		t.Fatalf("Expected the foreman dispatcher to be registered with sources, got %v", registered)
+	}
+
+	result = dch.processDispatchers(context.TODO(), testIdentity, "client-1", withoutCatalog)
+	verifyDispatchersResult(t, result, domain.SourcesRegistrationUnregistered)
+
+	if len(unregistered) != 1 || unregistered[0] != "foreman" {
+		t.Fatalf("Expected the foreman dispatcher to be unregistered from sources, got %v", unregistered)
+	}
+
+	result = dch.processDispatchers(context.TODO(), testIdentity, "client-1", map[string]interface{}{"foreman": map[string]interface{}{}})
+	verifyDispatchersResult(t, result, domain.SourcesRegistrationFailed)
+
+	if result.Detail != "Dispatcher is missing required fields: satellite_instance_id" {
+		t.Fatalf("Unexpected detail: %s", result.Detail)
+	}
+}
+
+func TestOnlyFailedDispatchersAreRetried(t *testing.T) {
+	mapping := map[string][]string{
+		"catalog": []string{"sources_type", "application_type"},
+		"foreman": []string{"satellite_instance_id"},
+	}
+
+	dch, err := newDispatcherChangeHandler(mapping, DispatcherChangeHandlingSync, &controller.IdentityHeaderV1Builder{}, controller.NewFakeSourcesRecorder(), 0, metrics)
+	if err != nil {
+		t.Fatalf("Unexpected error creating the dispatcher change handler: %s", err)
+	}
+
+	failForeman := true
+	var registered, unregistered []string
+	dch.registerInSources = func(ctx context.Context, identityHeader string, account domain.AccountID, clientID domain.ClientID, dispatcher string, facts interface{}) error {
+		if dispatcher == "foreman" && failForeman {
+			return errors.New("sources is unavailable")
+		}
+		registered = append(registered, dispatcher)
+		return nil
+	}
+	dch.unregisterFromSources = func(ctx context.Context, identityHeader string, account domain.AccountID, clientID domain.ClientID, dispatcher string, facts interface{}) error {
+		if dispatcher == "foreman" && failForeman {
+			return errors.New("sources is unavailable")
+		}
+		unregistered = append(unregistered, dispatcher)
+		return nil
+	}
+
+	withCatalogAndForeman := map[string]interface{}{
+		"catalog": withCatalog["catalog"],
+		"foreman": map[string]interface{}{"satellite_instance_id": "1234"},
+	}
+
+	// The failure to register foreman does not stop catalog from being registered
+	result := dch.processDispatchers(context.TODO(), testIdentity, "client-1", withCatalogAndForeman)
+	verifyDispatchersResult(t, result, domain.SourcesRegistrationFailed)
+
+	if len(registered) != 1 || registered[0] != "catalog" {
+		t.Fatalf("Expected catalog to be registered despite the foreman failure, got %v", registered)
+	}
+
+	failForeman = false
+
+	result = dch.processDispatchers(context.TODO(), testIdentity, "client-1", withCatalogAndForeman)
+	verifyDispatchersResult(t, result, domain.SourcesRegistrationRegistered)
+
+	if len(registered) != 2 || registered[1] != "foreman" {
+		t.Fatalf("Expected only foreman to be registered again, got %v", registered)
+	}
+
+	// A failed unregistration is retried as well
+	failForeman = true
+
+	result = dch.processDispatchers(context.TODO(), testIdentity, "client-1", map[string]interface{}{})
+	verifyDispatchersResult(t, result, domain.SourcesRegistrationFailed)
+
+	failForeman = false
+
+	dch.processDispatchers(context.TODO(), testIdentity, "client-1", map[string]interface{}{})
+
+	if len(unregistered) != 2 || unregistered[0] != "catalog" || unregistered[1] != "foreman" {
+		t.Fatalf("Expected catalog to be unregistered once and foreman to be retried, got %v", unregistered)
+	}
+}
+
+func TestUnmappedDispatcherIsIgnored(t *testing.T) {
+	dch, recorder := newTestDispatcherChangeHandler(t, DispatcherChangeHandlingSync)
+
+	result := dch.processDispatchers(context.TODO(), testIdentity, "client-1", map[string]interface{}{"foreman": map[string]interface{}{}})
+	verifyDispatchersResult(t, result, domain.SourcesRegistrationSkipped)
+
+	if result.Detail != "The catalog dispatcher is not present" {
+		t.Fatalf("Unexpected detail: %s", result.Detail)
+	}
+
+	if recorder.registered != 0 {
+		t.Fatalf("Expected the unmapped dispatcher to not be registered with sources")
+	}
+}
+
+func TestDispatcherChangesAreRecordedInSources(t *testing.T) {
+	recorder := controller.NewFakeSourcesRecorder()
+
+	dch, err := newDispatcherChangeHandler(catalogDispatcherMapping, DispatcherChangeHandlingSync, &controller.IdentityHeaderV1Builder{}, recorder, 0, metrics)
+	if err != nil {
+		t.Fatalf("Unexpected error creating the dispatcher change handler: %s", err)
+	}
+
+	result := dch.processDispatchers(context.TODO(), testIdentity, "client-1", withCatalog)
+	verifyDispatchersResult(t, result, domain.SourcesRegistrationRegistered)
+
+	expectedSource := controller.SourceRegistration{
+		SourceRef:       "client-1",
+		Name:            "client-1",
+		SourceType:      "ansible-tower",
+		ApplicationType: "/insights/platform/catalog",
+	}
+
+	if source, found := recorder.Registered("client-1", "/insights/platform/catalog"); found == false || source != expectedSource {
+		t.Fatalf("Expected source %+v to be registered, got %+v", expectedSource, source)
+	}
+
+	result = dch.processDispatchers(context.TODO(), testIdentity, "client-1", withoutCatalog)
+	verifyDispatchersResult(t, result, domain.SourcesRegistrationUnregistered)
+
+	if _, found := recorder.Registered("client-1", "/insights/platform/catalog"); found {
+		t.Fatalf("Expected the source to be unregistered")
+	}
+}
+
+func TestLosingOneDispatcherKeepsTheOthersInSources(t *testing.T) {
+	recorder := controller.NewFakeSourcesRecorder()
+	mapping := map[string][]string{"catalog": []string{"sources_type", "application_type"}, "remediations": []string{"sources_type", "application_type"}}
+
+	dch, err := newDispatcherChangeHandler(mapping, DispatcherChangeHandlingSync, &controller.IdentityHeaderV1Builder{}, recorder, 0, metrics)
+	if err != nil {
+		t.Fatalf("Unexpected error creating the dispatcher change handler: %s", err)
+	}
+
+	catalog := map[string]interface{}{"sources_type": "ansible-tower", "application_type": "/insights/platform/catalog"}
+	remediations := map[string]interface{}{"sources_type": "ansible-tower", "application_type": "/insights/platform/remediations"}
+
+	dch.processDispatchers(context.TODO(), testIdentity, "client-1", map[string]interface{}{"catalog": catalog, "remediations": remediations})
+
+	result := dch.processDispatchers(context.TODO(), testIdentity, "client-1", map[string]interface{}{"remediations": remediations})
+	verifyDispatchersResult(t, result, domain.SourcesRegistrationUnregistered)
+
+	if _, found := recorder.Registered("client-1", "/insights/platform/catalog"); found {
+		t.Fatalf("Expected the lost dispatcher to be unregistered")
+	}
+
+	if _, found := recorder.Registered("client-1", "/insights/platform/remediations"); found == false {
+		t.Fatalf("Expected the remaining dispatcher to stay registered")
+	}
+}
+
+func TestSourceRegistrationUsesReportedName(t *testing.T) {
+	source := newSourceRegistration("client-1", map[string]interface{}{"source_name": "my tower", "sources_type": "ansible-tower"})
+
+	if source.Name != "my tower" || source.SourceRef != "client-1" || source.SourceType != "ansible-tower" {
+		t.Fatalf("Unexpected source registration: %+v", source)
+	}
+}
+
+func TestMalformedDispatchers(t *testing.T) {
+	for _, value := range []interface{}{[]interface{}{"catalog"}, "catalog", 42.0} {
+		if _, ok := getDispatchers(map[string]interface{}{"dispatchers": value}); ok {
+			t.Fatalf("Expected dispatchers %v to be rejected", value)
+		}
+	}
+
+	dispatchers, ok := getDispatchers(map[string]interface{}{"dispatchers": nil})
+	if ok == false || len(dispatchers) != 0 {
+		t.Fatalf("Expected null dispatchers to be treated as no dispatchers")
+	}
+}
+
+func TestMalformedCatalogDispatcher(t *testing.T) {
+	dch, recorder := newTestDispatcherChangeHandler(t, DispatcherChangeHandlingSync)
+
+	result := dch.processDispatchers(context.TODO(), testIdentity, "client-1", map[string]interface{}{"catalog": "ansible-tower"})
+	verifyDispatchersResult(t, result, domain.SourcesRegistrationFailed)
+
+	if recorder.registered != 0 || recorder.unregistered != 0 {
+		t.Fatalf("Expected sources to not be called")
+	}
+}
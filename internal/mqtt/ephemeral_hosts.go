@@ -0,0 +1,141 @@
+package mqtt
+
+import (
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+const ephemeralCapability = "ephemeral"
+
+// ephemeralHostTracker keeps track of the connected clients that are ephemeral.  A
+// client is ephemeral if its account is configured as ephemeral or if the client
+// advertised the ephemeral capability in its handshake.  When an ephemeral client
+// goes offline, its host is deleted from inventory instead of being left to go stale.
+//
+// An offline message is also sent by the broker when a client disconnects
+// unexpectedly, so only hosts that are known to be ephemeral are deleted.  A
+// client is only considered ephemeral once its online message has been handled
+// successfully.
+//
+// The host is deleted once the client has been offline for the grace period so that
+// a client that reconnects right away (after a network blip, for example) keeps its
+// host.  A delete that is still pending when cloud-connector stops is not made; the
+// host is culled once it goes stale.
+type ephemeralHostTracker struct {
+	enabled        bool
+	accounts       map[domain.AccountID]bool
+	gracePeriod    time.Duration
+	clients        map[domain.ClientID]bool
+	pendingDeletes map[domain.ClientID]*time.Timer
+	metrics        *Metrics
+	sync.Mutex
+
+	deleteFromInventory func(identity domain.Identity, clientID domain.ClientID) error
+}
+
+func newEphemeralHostTracker(enabled bool, accounts []string, gracePeriod time.Duration, deleteFromInventory func(domain.Identity, domain.ClientID) error, metrics *Metrics) *ephemeralHostTracker {
+	eht := &ephemeralHostTracker{
+		enabled:             enabled,
+		accounts:            make(map[domain.AccountID]bool),
+		gracePeriod:         gracePeriod,
+		clients:             make(map[domain.ClientID]bool),
+		pendingDeletes:      make(map[domain.ClientID]*time.Timer),
+		metrics:             metrics,
+		deleteFromInventory: deleteFromInventory,
+	}
+
+	for _, account := range accounts {
+		eht.accounts[domain.AccountID(account)] = true
+	}
+
+	return eht
+}
+
+func (eht *ephemeralHostTracker) recordOnline(account domain.AccountID, clientID domain.ClientID, handshakePayload map[string]interface{}) {
+	if eht.enabled == false {
+		return
+	}
+
+	eht.Lock()
+	defer eht.Unlock()
+
+	// The client came back before its host was deleted
+	if pendingDelete, found := eht.pendingDeletes[clientID]; found {
+		pendingDelete.Stop()
+		delete(eht.pendingDeletes, clientID)
+	}
+
+	if eht.accounts[account] || containsCapability(getCapabilities(handshakePayload), ephemeralCapability) {
+		eht.clients[clientID] = true
+	} else {
+		delete(eht.clients, clientID)
+	}
+}
+
+// recordOffline deletes the client's host from inventory once the grace period has
+// passed if the client is ephemeral
+func (eht *ephemeralHostTracker) recordOffline(identity domain.Identity, clientID domain.ClientID) {
+	if eht.enabled == false {
+		return
+	}
+
+	eht.Lock()
+	defer eht.Unlock()
+
+	ephemeral := eht.clients[clientID]
+	delete(eht.clients, clientID)
+
+	if ephemeral == false {
+		return
+	}
+
+	if eht.gracePeriod <= 0 {
+		eht.deleteHost(identity, clientID)
+		return
+	}
+
+	var pendingDelete *time.Timer
+	pendingDelete = time.AfterFunc(eht.gracePeriod, func() {
+		eht.Lock()
+		defer eht.Unlock()
+
+		// The delete was canceled after the timer fired
+		if eht.pendingDeletes[clientID] != pendingDelete {
+			return
+		}
+		delete(eht.pendingDeletes, clientID)
+
+		eht.deleteHost(identity, clientID)
+	})
+
+	eht.pendingDeletes[clientID] = pendingDelete
+}
+
+// deleteHost is called with the lock held so that the client cannot come back online
+// while its host is being deleted
+func (eht *ephemeralHostTracker) deleteHost(identity domain.Identity, clientID domain.ClientID) {
+	logger := logger.Log.WithFields(logrus.Fields{"clientID": clientID, "account": identity.AccountNumber, "org_id": identity.OrgID})
+
+	if err := eht.deleteFromInventory(identity, clientID); err != nil {
+		// The host will still be culled once it goes stale
+		logger.WithFields(logrus.Fields{"error": err}).Error("Unable to delete the ephemeral host from inventory")
+		return
+	}
+
+	logger.Info("Deleted the ephemeral host from inventory")
+	eht.metrics.ephemeralHostDeletedCounter.Inc()
+}
+
+func containsCapability(capabilities []string, capability string) bool {
+	for _, c := range capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package mqtt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+const (
+	ephemeralOnlineHandshake = `{"type": "connection-status", "message_id": "1234", "content": {"state": "online",
+	"canonical_facts": {"fqdn": "host.example.com", "ip_addresses": ["10.0.0.1"], "insights_id": "abcd"}, "capabilities": ["ephemeral"]}}`
+	offlineMessage = `{"type": "connection-status", "message_id": "5678", "content": {"state": "offline"}}`
+)
+
+func TestEphemeralHostOfflineHandling(t *testing.T) {
+	var tests = []struct {
+		name              string
+		enabled           bool
+		ephemeralAccounts []string
+		onlineHandshake   string
+		expectedDeleted   bool
+	}{
+		{"normal host", true, nil, onlineHandshake, false},
+		{"client advertised ephemeral", true, nil, ephemeralOnlineHandshake, true},
+		{"ephemeral account", true, []string{"1234"}, onlineHandshake, true},
+		{"other ephemeral account", true, []string{"4321"}, onlineHandshake, false},
+		{"client advertised ephemeral, disabled", false, nil, ephemeralOnlineHandshake, false},
+		{"ephemeral account, disabled", false, []string{"1234"}, onlineHandshake, false},
+		{"offline without an online message", true, []string{"1234"}, "", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := config.GetConfig()
+
+			client := &publishRecordingClient{}
+			cm := controller.NewLocalConnectionManager()
+			dispatcherChanges, _ := newTestDispatcherChangeHandler(t, "ignore")
+			resolver := &staticAccountResolver{account: "1234", orgID: "5678"}
+
+			var deleted []domain.Identity
+			ephemeralHosts := newEphemeralHostTracker(tc.enabled, tc.ephemeralAccounts, 0, func(identity domain.Identity, clientID domain.ClientID) error {
+				deleted = append(deleted, identity)
+				return nil
+			}, metrics)
+
+			handle := func(msg string) {
+				deps := newTestControlMessageDeps(cm, resolver, dispatcherChanges)
+				deps.ephemeralHosts = ephemeralHosts
+				err := handleConnectionStatusMessage(context.Background(), client, "client-1", unmarshalControlMessage(t, msg), cfg, deps, metrics)
+				if err != nil {
+					t.Fatalf("Unexpected error handling the connection-status message: %s", err)
+				}
+			}
+
+			if tc.onlineHandshake != "" {
+				handle(tc.onlineHandshake)
+			}
+
+			handle(offlineMessage)
+
+			if tc.expectedDeleted == false {
+				if len(deleted) != 0 {
+					t.Fatalf("Expected the host to not be deleted from inventory")
+				}
+				return
+			}
+
+			expectedIdentity := domain.Identity{AccountNumber: "1234", OrgID: "5678", Type: downstreamIdentityType}
+			if len(deleted) != 1 || deleted[0] != expectedIdentity {
+				t.Fatalf("Expected the host to be deleted from inventory once, got %v", deleted)
+			}
+
+			// A second offline message must not delete the host again
+			handle(offlineMessage)
+
+			if len(deleted) != 1 {
+				t.Fatalf("Expected the host to be deleted from inventory once, got %d deletes", len(deleted))
+			}
+		})
+	}
+}
+
+func TestEphemeralHostDeletedAfterGracePeriod(t *testing.T) {
+	deleted := make(chan domain.ClientID, 1)
+	ephemeralHosts := newEphemeralHostTracker(true, []string{"1234"}, 50*time.Millisecond, func(identity domain.Identity, clientID domain.ClientID) error {
+		deleted <- clientID
+		return nil
+	}, metrics)
+
+	identity := domain.Identity{AccountNumber: "1234", Type: downstreamIdentityType}
+
+	// The client reconnects within the grace period so its host is kept
+	ephemeralHosts.recordOnline("1234", "client-1", nil)
+	ephemeralHosts.recordOffline(identity, "client-1")
+	ephemeralHosts.recordOnline("1234", "client-1", nil)
+
+	select {
+	case clientID := <-deleted:
+		t.Fatalf("Expected the host of the reconnected client to be kept, but %s was deleted", clientID)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	ephemeralHosts.recordOffline(identity, "client-1")
+
+	select {
+	case clientID := <-deleted:
+		if clientID != "client-1" {
+			t.Fatalf("Expected the host of client-1 to be deleted, got %s", clientID)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the host to be deleted once the grace period passed")
+	}
+}
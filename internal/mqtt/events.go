@@ -0,0 +1,126 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/queue"
+
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+)
+
+var ErrInvalidEventMessage = errors.New("Invalid event message")
+
+// validEventName keeps the client provided event names usable as kafka header values
+var validEventName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// ClientEvent is the record that is written to kafka when a client reports an event
+type ClientEvent struct {
+	ClientID  domain.ClientID  `json:"client_id"`
+	Account   domain.AccountID `json:"account,omitempty"`
+	OrgID     domain.OrgID     `json:"org_id,omitempty"`
+	MessageID string           `json:"message_id"`
+	Sent      Timestamp        `json:"sent"`
+	Event     string           `json:"event"`
+	Payload   interface{}      `json:"payload,omitempty"`
+}
+
+// EventForwarder passes the events that the clients report along to the
+// interested services.  The account and org id are empty if the client is not
+// connected.
+type EventForwarder func(clientID domain.ClientID, account domain.AccountID, orgID domain.OrgID, msg ControlMessage, event *EventMessageContent) error
+
+// NewEventForwarder returns a forwarder that writes the events to kafka.  If
+// the writer is nil, the events are logged and dropped.
+func NewEventForwarder(writer queue.Writer, metrics *Metrics) EventForwarder {
+	if writer == nil {
+		return func(clientID domain.ClientID, account domain.AccountID, orgID domain.OrgID, msg ControlMessage, event *EventMessageContent) error {
+			logger.Log.WithFields(logrus.Fields{"clientID": clientID, "event": event.Event}).Debug("Event forwarding is disabled, dropping event")
+			metrics.clientEventCounter.WithLabelValues("dropped").Inc()
+			return nil
+		}
+	}
+
+	return func(clientID domain.ClientID, account domain.AccountID, orgID domain.OrgID, msg ControlMessage, event *EventMessageContent) error {
+		logger := logger.Log.WithFields(logrus.Fields{"clientID": clientID, "account": account, "org_id": orgID, "event": event.Event, "message_id": msg.MessageID, "correlation_id": msg.CorrelationID})
+
+		value, err := json.Marshal(ClientEvent{
+			ClientID:  clientID,
+			Account:   account,
+			OrgID:     orgID,
+			MessageID: msg.MessageID,
+			Sent:      msg.Sent,
+			Event:     event.Event,
+			Payload:   event.Payload,
+		})
+		if err != nil {
+			logger.WithFields(logrus.Fields{"error": err}).Warn("Unable to serialize event")
+			metrics.clientEventCounter.WithLabelValues("failed").Inc()
+			return err
+		}
+
+		eventMsg := kafka.Message{
+			Key:   []byte(clientID),
+			Value: value,
+			Headers: []kafka.Header{
+				kafka.Header{Key: "client_id", Value: []byte(clientID)},
+				kafka.Header{Key: "account", Value: []byte(account)},
+				kafka.Header{Key: "org_id", Value: []byte(orgID)},
+				kafka.Header{Key: "message_id", Value: []byte(msg.MessageID)},
+				kafka.Header{Key: "event", Value: []byte(event.Event)},
+				kafka.Header{Key: "correlation_id", Value: []byte(msg.CorrelationID)},
+			},
+		}
+
+		if err := writer.WriteMessages(context.Background(), eventMsg); err != nil {
+			logger.WithFields(logrus.Fields{"error": err}).Error("Unable to forward event")
+			metrics.clientEventCounter.WithLabelValues("failed").Inc()
+			return err
+		}
+
+		logger.Debug("Forwarded event")
+		metrics.clientEventCounter.WithLabelValues("forwarded").Inc()
+
+		return nil
+	}
+}
+
+func parseEventMessageContent(content interface{}) (*EventMessageContent, error) {
+
+	if _, ok := content.(map[string]interface{}); ok == false {
+		return nil, ErrInvalidEventMessage
+	}
+
+	contentBytes, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var event EventMessageContent
+	if err := json.Unmarshal(contentBytes, &event); err != nil {
+		return nil, ErrInvalidEventMessage
+	}
+
+	if validEventName.MatchString(event.Event) == false {
+		return nil, ErrInvalidEventMessage
+	}
+
+	return &event, nil
+}
+
+// describeEventContent summarizes the content of an event without including the
+// content itself, which may be large or sensitive
+func describeEventContent(content interface{}) logrus.Fields {
+	size := 0
+	if contentBytes, err := json.Marshal(content); err == nil {
+		size = len(contentBytes)
+	}
+
+	return logrus.Fields{"content_type": fmt.Sprintf("%T", content), "content_size": size}
+}
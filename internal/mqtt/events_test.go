@@ -0,0 +1,186 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	kafka "github.com/segmentio/kafka-go"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+type failingWriter struct{}
+
+func (fw failingWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	return errors.New("kafka is down")
+}
+
+func TestParseEventMessageContent(t *testing.T) {
+	var tests = []struct {
+		content string
+		valid   bool
+	}{
+		{`{"event": "job-progress", "payload": {"percent": 50}}`, true},
+		{`{"event": "job-error"}`, true},
+		{`"job-progress"`, false},
+		{`{"payload": {"percent": 50}}`, false},
+		{`{"event": 5}`, false},
+		{`{"event": "job\nprogress"}`, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.content, func(t *testing.T) {
+			var content interface{}
+			if err := json.Unmarshal([]byte(tc.content), &content); err != nil {
+				t.Fatalf("Unexpected error unmarshalling the content: %s", err)
+			}
+
+			event, err := parseEventMessageContent(content)
+			if tc.valid && (err != nil || event == nil) {
+				t.Fatalf("Expected the event to be parsed, but got %v", err)
+			}
+
+			if tc.valid == false && err != ErrInvalidEventMessage {
+				t.Fatalf("Expected ErrInvalidEventMessage, but got %v", err)
+			}
+		})
+	}
+}
+
+func TestForwardEvent(t *testing.T) {
+	writer := &recordingWriter{}
+	clientID := domain.ClientID("client-1")
+	metrics := NewMetrics(prometheus.NewRegistry())
+
+	msg := unmarshalControlMessage(t, `{"type": "event", "message_id": "1234", "version": 1, "sent": "2021-01-12T15:30:00Z", "content": {"event": "job-progress", "payload": {"percent": 50}}}`)
+
+	cm := controller.NewLocalConnectionManager()
+	cm.Register(context.TODO(), "1234", "client-1", &ReceptorMQTTProxy{ClientID: "client-1", Details: &domain.RhcClient{ClientID: clientID, Account: "1234", OrgID: "5678"}})
+
+	if err := handleEventMessage(context.TODO(), nil, clientID, msg, cm, newPendingCommandStore(time.Minute, 0, metrics), NewPongTracker(), NewEventForwarder(writer, metrics), metrics); err != nil {
+		t.Fatalf("Unexpected error handling the event: %s", err)
+	}
+
+	if len(writer.messages) != 1 {
+		t.Fatalf("Expected 1 forwarded event, but got %d", len(writer.messages))
+	}
+
+	kafkaMsg := writer.messages[0]
+
+	if string(kafkaMsg.Key) != "client-1" {
+		t.Fatalf("Expected the event to be keyed by client id, but got %s", kafkaMsg.Key)
+	}
+
+	headers := make(map[string]string)
+	for _, h := range kafkaMsg.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+
+	if headers["client_id"] != "client-1" || headers["message_id"] != "1234" || headers["event"] != "job-progress" || headers["account"] != "1234" || headers["org_id"] != "5678" {
+		t.Fatalf("Unexpected event headers: %v", headers)
+	}
+
+	var event map[string]interface{}
+	if err := json.Unmarshal(kafkaMsg.Value, &event); err != nil {
+		t.Fatalf("Unexpected error unmarshalling the forwarded event: %s", err)
+	}
+
+	if event["client_id"] != "client-1" || event["account"] != "1234" || event["org_id"] != "5678" || event["event"] != "job-progress" || event["payload"].(map[string]interface{})["percent"] != float64(50) {
+		t.Fatalf("Unexpected forwarded event: %s", kafkaMsg.Value)
+	}
+
+	if count := testutil.ToFloat64(metrics.clientEventCounter.WithLabelValues("forwarded")); count != 1 {
+		t.Fatalf("Expected the forwarded event to be counted, but got %v", count)
+	}
+}
+
+func TestMalformedEventIsDropped(t *testing.T) {
+	writer := &recordingWriter{}
+
+	msg := unmarshalControlMessage(t, `{"type": "event", "message_id": "1234", "version": 1, "content": "job-progress"}`)
+
+	malformed := testutil.ToFloat64(metrics.clientEventCounter.WithLabelValues("malformed"))
+
+	if err := handleEventMessage(context.TODO(), nil, "client-1", msg, controller.NewLocalConnectionManager(), newPendingCommandStore(time.Minute, 0, metrics), NewPongTracker(), NewEventForwarder(writer, metrics), metrics); err != ErrInvalidEventMessage {
+		t.Fatalf("Expected ErrInvalidEventMessage, but got %v", err)
+	}
+
+	if len(writer.messages) != 0 {
+		t.Fatalf("Expected the malformed event to be dropped, but %d were written", len(writer.messages))
+	}
+
+	if delta := testutil.ToFloat64(metrics.clientEventCounter.WithLabelValues("malformed")) - malformed; delta != 1 {
+		t.Fatalf("Expected the malformed event to be counted, but got %v", delta)
+	}
+}
+
+func TestForwardEventFailure(t *testing.T) {
+	msg := unmarshalControlMessage(t, `{"type": "event", "message_id": "1234", "version": 1, "content": {"event": "job-error"}}`)
+
+	if err := handleEventMessage(context.TODO(), nil, "client-1", msg, controller.NewLocalConnectionManager(), newPendingCommandStore(time.Minute, 0, metrics), NewPongTracker(), NewEventForwarder(failingWriter{}, metrics), metrics); err == nil {
+		t.Fatalf("Expected the kafka write failure to be returned")
+	}
+}
+
+func TestForwardedEventIncludesCorrelationID(t *testing.T) {
+	var tests = []struct {
+		name                  string
+		message               string
+		expectedCorrelationID string
+	}{
+		{"provided by the client", `{"type": "event", "message_id": "1234", "version": 1, "correlation_id": "abcd", "content": {"event": "job-progress"}}`, "abcd"},
+		{"generated", `{"type": "event", "message_id": "1234", "version": 1, "content": {"event": "job-progress"}}`, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := config.GetConfig()
+			writer := &recordingWriter{}
+			dispatcherChanges, _ := newTestDispatcherChangeHandler(t, "ignore")
+
+			deps := newTestControlMessageDeps(controller.NewLocalConnectionManager(), &staticAccountResolver{account: "1234"}, dispatcherChanges)
+			deps.eventForwarder = NewEventForwarder(writer, metrics)
+			handler := controlMessageHandler(cfg, deps, metrics)
+
+			handler(&publishRecordingClient{}, testMessage{topic: "redhat/insights/client-1/control/out", payload: []byte(tc.message)})
+
+			if len(writer.messages) != 1 {
+				t.Fatalf("Expected 1 forwarded event, but got %d", len(writer.messages))
+			}
+
+			var correlationID string
+			for _, h := range writer.messages[0].Headers {
+				if h.Key == "correlation_id" {
+					correlationID = string(h.Value)
+				}
+			}
+
+			if correlationID == "" {
+				t.Fatalf("Expected the forwarded event to include a correlation_id header")
+			}
+
+			if tc.expectedCorrelationID != "" && correlationID != tc.expectedCorrelationID {
+				t.Fatalf("Expected the correlation id %s, got %s", tc.expectedCorrelationID, correlationID)
+			}
+		})
+	}
+}
+
+func TestDescribeEventContentOmitsTheContent(t *testing.T) {
+	fields := describeEventContent(map[string]interface{}{"secret": "hunter2"})
+
+	if _, exists := fields["content"]; exists {
+		t.Fatalf("Expected the content to be left out, but got %v", fields)
+	}
+
+	if fields["content_type"] != "map[string]interface {}" || fields["content_size"] != len(`{"secret":"hunter2"}`) {
+		t.Fatalf("Unexpected content description: %v", fields)
+	}
+}
@@ -0,0 +1,98 @@
+package mqtt
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"sort"
+)
+
+const (
+	FactsHashAlgorithmSHA256 = "sha256"
+	FactsHashAlgorithmSHA512 = "sha512"
+)
+
+var ErrInvalidFactsHashAlgorithm = errors.New("Invalid canonical facts hash algorithm")
+
+var factsHashAlgorithms = map[string]func() hash.Hash{
+	FactsHashAlgorithmSHA256: sha256.New,
+	FactsHashAlgorithmSHA512: sha512.New,
+}
+
+// VerifyFactsHashAlgorithm makes sure the canonical facts can be hashed with the algorithm
+func VerifyFactsHashAlgorithm(algorithm string) error {
+	if _, found := factsHashAlgorithms[algorithm]; found == false {
+		return ErrInvalidFactsHashAlgorithm
+	}
+	return nil
+}
+
+// hashCanonicalFacts returns a hash of the canonical facts that does not depend on the
+// order of the facts or the order of the values of multi-valued facts (ip addresses,
+// mac addresses, etc).  The hash is prefixed with the name of the algorithm
+// ("sha256:<hex digest>") so that hashes created with a different algorithm can be
+// recognized if the algorithm is changed.
+func hashCanonicalFacts(algorithm string, canonicalFacts map[string]interface{}) (string, error) {
+	newHash, found := factsHashAlgorithms[algorithm]
+	if found == false {
+		return "", ErrInvalidFactsHashAlgorithm
+	}
+
+	normalized, err := normalizeFactValue(canonicalFacts)
+	if err != nil {
+		return "", err
+	}
+
+	// The keys of a map are sorted when the map is encoded
+	normalizedBytes, err := json.Marshal(normalized)
+	if err != nil {
+		return "", err
+	}
+
+	h := newHash()
+	h.Write(normalizedBytes)
+
+	return algorithm + ":" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// normalizeFactValue sorts the values of the slices within the value by their JSON encoding
+func normalizeFactValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		normalized := make(map[string]interface{}, len(v))
+		for key, fact := range v {
+			normalizedFact, err := normalizeFactValue(fact)
+			if err != nil {
+				return nil, err
+			}
+			normalized[key] = normalizedFact
+		}
+		return normalized, nil
+	case []interface{}:
+		encoded := make([]string, 0, len(v))
+		for _, item := range v {
+			normalizedItem, err := normalizeFactValue(item)
+			if err != nil {
+				return nil, err
+			}
+
+			itemBytes, err := json.Marshal(normalizedItem)
+			if err != nil {
+				return nil, err
+			}
+			encoded = append(encoded, string(itemBytes))
+		}
+		sort.Strings(encoded)
+
+		normalized := make([]json.RawMessage, 0, len(encoded))
+		for _, item := range encoded {
+			normalized = append(normalized, json.RawMessage(item))
+		}
+		return normalized, nil
+	default:
+		return v, nil
+	}
+}
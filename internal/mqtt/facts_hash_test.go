@@ -0,0 +1,84 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func unmarshalCanonicalFacts(t *testing.T, facts string) map[string]interface{} {
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(facts), &m); err != nil {
+		t.Fatalf("Unable to unmarshal the canonical facts: %s", err)
+	}
+	return m
+}
+
+func TestHashCanonicalFactsIsStable(t *testing.T) {
+	var tests = []struct {
+		name   string
+		facts  string
+		equals string
+	}{
+		{"different key order",
+			`{"fqdn": "host.example.com", "insights_id": "abcd", "bios_uuid": "1234"}`,
+			`{"bios_uuid": "1234", "insights_id": "abcd", "fqdn": "host.example.com"}`},
+		{"different slice order",
+			`{"fqdn": "host.example.com", "ip_addresses": ["10.0.0.1", "10.0.0.2", "192.168.1.1"]}`,
+			`{"ip_addresses": ["192.168.1.1", "10.0.0.1", "10.0.0.2"], "fqdn": "host.example.com"}`},
+		{"nested facts",
+			`{"system_profile": {"network": [{"name": "eth0"}, {"name": "eth1"}], "arch": "x86_64"}}`,
+			`{"system_profile": {"arch": "x86_64", "network": [{"name": "eth1"}, {"name": "eth0"}]}}`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, algorithm := range []string{FactsHashAlgorithmSHA256, FactsHashAlgorithmSHA512} {
+				hash, err := hashCanonicalFacts(algorithm, unmarshalCanonicalFacts(t, tc.facts))
+				if err != nil {
+					t.Fatalf("Unexpected error hashing the canonical facts: %s", err)
+				}
+
+				equalHash, err := hashCanonicalFacts(algorithm, unmarshalCanonicalFacts(t, tc.equals))
+				if err != nil {
+					t.Fatalf("Unexpected error hashing the canonical facts: %s", err)
+				}
+
+				if hash != equalHash {
+					t.Fatalf("Expected equal facts to have the same %s hash, got %s and %s", algorithm, hash, equalHash)
+				}
+
+				if strings.HasPrefix(hash, algorithm+":") == false {
+					t.Fatalf("Expected the hash to be prefixed with the algorithm, got %s", hash)
+				}
+			}
+		})
+	}
+}
+
+func TestHashCanonicalFactsDetectsChanges(t *testing.T) {
+	facts := unmarshalCanonicalFacts(t, `{"fqdn": "host.example.com", "ip_addresses": ["10.0.0.1"]}`)
+	changedFacts := unmarshalCanonicalFacts(t, `{"fqdn": "host.example.com", "ip_addresses": ["10.0.0.2"]}`)
+
+	hash, _ := hashCanonicalFacts(FactsHashAlgorithmSHA256, facts)
+	changedHash, _ := hashCanonicalFacts(FactsHashAlgorithmSHA256, changedFacts)
+
+	if hash == changedHash {
+		t.Fatalf("Expected different facts to have different hashes")
+	}
+
+	sha512Hash, _ := hashCanonicalFacts(FactsHashAlgorithmSHA512, facts)
+	if hash == sha512Hash {
+		t.Fatalf("Expected the hash to depend on the algorithm")
+	}
+}
+
+func TestInvalidFactsHashAlgorithm(t *testing.T) {
+	if err := VerifyFactsHashAlgorithm("md5"); err != ErrInvalidFactsHashAlgorithm {
+		t.Fatalf("Expected ErrInvalidFactsHashAlgorithm, but got %v", err)
+	}
+
+	if _, err := hashCanonicalFacts("md5", map[string]interface{}{}); err != ErrInvalidFactsHashAlgorithm {
+		t.Fatalf("Expected ErrInvalidFactsHashAlgorithm, but got %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package mqtt
+
+import (
+	"encoding/json"
+)
+
+// getCapabilities returns the capabilities (supported commands, protocol features, etc)
+// that the client advertised in its handshake.  Entries that are not strings are ignored.
+func getCapabilities(handshakePayload map[string]interface{}) []string {
+	advertised, ok := handshakePayload["capabilities"].([]interface{})
+	if ok == false {
+		return nil
+	}
+
+	capabilities := make([]string, 0, len(advertised))
+	for _, capability := range advertised {
+		if c, ok := capability.(string); ok && c != "" {
+			capabilities = append(capabilities, c)
+		}
+	}
+
+	return capabilities
+}
+
+const redactedValue = "REDACTED"
+
+// handshakePIIFacts are the canonical facts that identify a host or the network that
+// it is on.  These facts are redacted from the handshakes that are kept for debugging.
+var handshakePIIFacts = []string{"fqdn", "ip_addresses", "mac_addresses"}
+
+// buildDebugHandshake serializes the handshake so that it can be stored alongside the
+// connection.  The PII facts are redacted if redact is true.  If the serialized handshake
+// is larger than maxSize, a placeholder that records the size is returned instead.
+func buildDebugHandshake(msg ControlMessage, redact bool, maxSize int) ([]byte, error) {
+
+	msgBytes, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if redact {
+		// Work on a copy so that the message that is being processed is not modified
+		var handshake map[string]interface{}
+		if err := json.Unmarshal(msgBytes, &handshake); err != nil {
+			return nil, err
+		}
+
+		redactHandshake(handshake)
+
+		msgBytes, err = json.Marshal(handshake)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(msgBytes) > maxSize {
+		return json.Marshal(map[string]interface{}{"truncated": true, "size": len(msgBytes)})
+	}
+
+	return msgBytes, nil
+}
+
+func redactHandshake(handshake map[string]interface{}) {
+	content, ok := handshake["content"].(map[string]interface{})
+	if ok == false {
+		return
+	}
+
+	canonicalFacts, ok := content["canonical_facts"].(map[string]interface{})
+	if ok == false {
+		return
+	}
+
+	for _, fact := range handshakePIIFacts {
+		if _, found := canonicalFacts[fact]; found {
+			canonicalFacts[fact] = redactedValue
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+)
+
+func TestGetCapabilities(t *testing.T) {
+	var tests = []struct {
+		name     string
+		payload  string
+		expected []string
+	}{
+		{"capabilities advertised", `{"state": "online", "capabilities": ["reconnect", "ping"]}`, []string{"reconnect", "ping"}},
+		{"invalid entries ignored", `{"state": "online", "capabilities": ["reconnect", 1, "", {"a": "b"}]}`, []string{"reconnect"}},
+		{"no capabilities", `{"state": "online"}`, nil},
+		{"capabilities not a list", `{"state": "online", "capabilities": "reconnect"}`, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := unmarshalControlMessage(t, `{"type": "connection-status", "content": `+tc.payload+`}`)
+
+			actual := getCapabilities(msg.Content.(map[string]interface{}))
+			if reflect.DeepEqual(actual, tc.expected) == false {
+				t.Fatalf("Expected capabilities %v, but got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+const onlineHandshake = `{"type": "connection-status", "message_id": "1234", "content": {"state": "online",
+	"canonical_facts": {"fqdn": "host.example.com", "ip_addresses": ["10.0.0.1"], "insights_id": "abcd"}}}`
+
+func canonicalFactsFromDebugHandshake(t *testing.T, handshake []byte) map[string]interface{} {
+	var m map[string]interface{}
+	if err := json.Unmarshal(handshake, &m); err != nil {
+		t.Fatalf("Unable to unmarshal the stored handshake: %s", err)
+	}
+	return m["content"].(map[string]interface{})["canonical_facts"].(map[string]interface{})
+}
+
+func TestBuildDebugHandshakeRedaction(t *testing.T) {
+	msg := unmarshalControlMessage(t, onlineHandshake)
+
+	handshake, err := buildDebugHandshake(msg, true, 4096)
+	if err != nil {
+		t.Fatalf("Unexpected error building the handshake: %s", err)
+	}
+
+	facts := canonicalFactsFromDebugHandshake(t, handshake)
+	if facts["fqdn"] != redactedValue || facts["ip_addresses"] != redactedValue {
+		t.Fatalf("Expected the PII facts to be redacted, got %v", facts)
+	}
+
+	if facts["insights_id"] != "abcd" {
+		t.Fatalf("Expected the other facts to be kept, got %v", facts)
+	}
+
+	originalFacts := msg.Content.(map[string]interface{})["canonical_facts"].(map[string]interface{})
+	if originalFacts["fqdn"] != "host.example.com" {
+		t.Fatalf("Expected the original message to be unmodified, got %v", originalFacts)
+	}
+}
+
+func TestBuildDebugHandshakeWithoutRedaction(t *testing.T) {
+	handshake, err := buildDebugHandshake(unmarshalControlMessage(t, onlineHandshake), false, 4096)
+	if err != nil {
+		t.Fatalf("Unexpected error building the handshake: %s", err)
+	}
+
+	facts := canonicalFactsFromDebugHandshake(t, handshake)
+	if facts["fqdn"] != "host.example.com" {
+		t.Fatalf("Expected the facts to be unredacted, got %v", facts)
+	}
+}
+
+func TestBuildDebugHandshakeSizeLimit(t *testing.T) {
+	handshake, err := buildDebugHandshake(unmarshalControlMessage(t, onlineHandshake), true, 32)
+	if err != nil {
+		t.Fatalf("Unexpected error building the handshake: %s", err)
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(handshake, &m); err != nil {
+		t.Fatalf("Unable to unmarshal the stored handshake: %s", err)
+	}
+
+	if m["truncated"] != true {
+		t.Fatalf("Expected the handshake to be replaced with a placeholder, got %s", handshake)
+	}
+}
+
+func TestOnlineMessageStoresHandshake(t *testing.T) {
+	cfg := config.GetConfig()
+	cfg.HandshakeRedactPII = true
+	cfg.HandshakeDebugMaxSize = 4096
+
+	dispatcherChanges, _ := newTestDispatcherChangeHandler(t, "ignore")
+	cm := controller.NewLocalConnectionManager()
+
+	msg := unmarshalControlMessage(t, onlineHandshake)
+
+	deps := newTestControlMessageDeps(cm, nil, dispatcherChanges)
+	err := handleOnlineMessage(context.Background(), nil, "1234", "", "client-1", msg, cfg, deps, metrics)
+	if err != nil {
+		t.Fatalf("Unexpected error handling the online message: %s", err)
+	}
+
+	recorder, ok := cm.GetConnection(context.TODO(), "1234", "client-1").(controller.HandshakeRecorder)
+	if ok == false {
+		t.Fatalf("Expected the registered connection to keep the handshake")
+	}
+
+	facts := canonicalFactsFromDebugHandshake(t, recorder.RawHandshake())
+	if facts["fqdn"] != redactedValue || facts["insights_id"] != "abcd" {
+		t.Fatalf("Expected the stored handshake to be redacted, got %v", facts)
+	}
+}
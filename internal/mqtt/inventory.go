@@ -0,0 +1,103 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/queue"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+const (
+	inventoryAddHostOperation    = "add_host"
+	inventoryDeleteHostOperation = "delete_host"
+)
+
+var ErrInventoryWriterNotConfigured = errors.New("The inventory kafka writer has not been configured")
+
+type inventoryPlatformMetadata struct {
+	B64Identity string `json:"b64_identity"`
+}
+
+type inventoryHostReference struct {
+	Reporter    string           `json:"reporter"`
+	Account     domain.AccountID `json:"account"`
+	OrgID       domain.OrgID     `json:"org_id"`
+	RhcClientID domain.ClientID  `json:"rhc_client_id"`
+}
+
+// inventoryMessage is the record that is written to the inventory topic
+type inventoryMessage struct {
+	Operation        string                    `json:"operation"`
+	PlatformMetadata inventoryPlatformMetadata `json:"platform_metadata"`
+	Data             interface{}               `json:"data"`
+}
+
+// inventoryWriter writes the host operations to the inventory kafka topic.  The
+// messages are keyed by client id so that the operations for a host stay in order.
+type inventoryWriter struct {
+	writer         queue.Writer
+	identityHeader controller.IdentityHeaderBuilder
+	reporter       string
+}
+
+func newInventoryWriter(writer queue.Writer, identityHeader controller.IdentityHeaderBuilder, reporter string) *inventoryWriter {
+	return &inventoryWriter{
+		writer:         writer,
+		identityHeader: identityHeader,
+		reporter:       reporter,
+	}
+}
+
+// addHost records the client's host along with the canonical facts that identify it
+func (iw *inventoryWriter) addHost(ctx context.Context, identity domain.Identity, clientID domain.ClientID, canonicalFacts map[string]interface{}) error {
+	host := make(map[string]interface{}, len(canonicalFacts)+4)
+	for fact, value := range canonicalFacts {
+		host[fact] = value
+	}
+
+	host["reporter"] = iw.reporter
+	host["account"] = identity.AccountNumber
+	host["org_id"] = identity.OrgID
+	host["rhc_client_id"] = clientID
+
+	return iw.write(ctx, inventoryAddHostOperation, identity, clientID, host)
+}
+
+func (iw *inventoryWriter) deleteHost(ctx context.Context, identity domain.Identity, clientID domain.ClientID) error {
+	return iw.write(ctx, inventoryDeleteHostOperation, identity, clientID, inventoryHostReference{
+		Reporter:    iw.reporter,
+		Account:     identity.AccountNumber,
+		OrgID:       identity.OrgID,
+		RhcClientID: clientID,
+	})
+}
+
+func (iw *inventoryWriter) write(ctx context.Context, operation string, identity domain.Identity, clientID domain.ClientID, data interface{}) error {
+	if iw.writer == nil {
+		return ErrInventoryWriterNotConfigured
+	}
+
+	identityHeader, err := iw.identityHeader.BuildIdentityHeader(identity)
+	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(inventoryMessage{
+		Operation:        operation,
+		PlatformMetadata: inventoryPlatformMetadata{B64Identity: identityHeader},
+		Data:             data,
+	})
+	if err != nil {
+		return err
+	}
+
+	return iw.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(clientID),
+		Value: value,
+	})
+}
@@ -0,0 +1,103 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+type inventoryRecordingWriter struct {
+	messages []kafka.Message
+}
+
+func (w *inventoryRecordingWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func TestInventoryDeleteHost(t *testing.T) {
+	identityHeader, err := controller.NewIdentityHeaderBuilder("v1")
+	if err != nil {
+		t.Fatalf("Unexpected error creating the identity header builder: %s", err)
+	}
+
+	writer := &inventoryRecordingWriter{}
+	inventory := newInventoryWriter(writer, identityHeader, "cloud-connector")
+
+	identity := domain.Identity{AccountNumber: "1234", OrgID: "5678", Type: downstreamIdentityType}
+
+	if err := inventory.deleteHost(context.TODO(), identity, "client-1"); err != nil {
+		t.Fatalf("Unexpected error deleting the host: %s", err)
+	}
+
+	if len(writer.messages) != 1 || string(writer.messages[0].Key) != "client-1" {
+		t.Fatalf("Expected one inventory message keyed by the client id, got %+v", writer.messages)
+	}
+
+	var msg struct {
+		Operation        string                    `json:"operation"`
+		PlatformMetadata inventoryPlatformMetadata `json:"platform_metadata"`
+		Data             inventoryHostReference    `json:"data"`
+	}
+	if err := json.Unmarshal(writer.messages[0].Value, &msg); err != nil {
+		t.Fatalf("Unable to parse the inventory message: %s", err)
+	}
+
+	expectedData := inventoryHostReference{Reporter: "cloud-connector", Account: "1234", OrgID: "5678", RhcClientID: "client-1"}
+	if msg.Operation != inventoryDeleteHostOperation || msg.Data != expectedData {
+		t.Fatalf("Unexpected inventory message %+v", msg)
+	}
+
+	if _, err := base64.StdEncoding.DecodeString(msg.PlatformMetadata.B64Identity); err != nil || msg.PlatformMetadata.B64Identity == "" {
+		t.Fatalf("Expected a base64 encoded identity, got %q", msg.PlatformMetadata.B64Identity)
+	}
+}
+
+func TestInventoryWriterNotConfigured(t *testing.T) {
+	identityHeader, _ := controller.NewIdentityHeaderBuilder("v1")
+	inventory := newInventoryWriter(nil, identityHeader, "cloud-connector")
+
+	err := inventory.deleteHost(context.TODO(), domain.Identity{AccountNumber: "1234"}, "client-1")
+	if err != ErrInventoryWriterNotConfigured {
+		t.Fatalf("Expected %v, got %v", ErrInventoryWriterNotConfigured, err)
+	}
+}
+
+func TestOnlineMessageAddsHostToInventory(t *testing.T) {
+	cfg := config.GetConfig()
+	cfg.InventoryRegisterHosts = true
+
+	identityHeader, _ := controller.NewIdentityHeaderBuilder("v1")
+	writer := &inventoryRecordingWriter{}
+	dispatcherChanges, _ := newTestDispatcherChangeHandler(t, "ignore")
+
+	deps := newTestControlMessageDeps(controller.NewLocalConnectionManager(), &staticAccountResolver{account: "1234"}, dispatcherChanges)
+	deps.inventory = newInventoryWriter(writer, identityHeader, "cloud-connector")
+	err := handleConnectionStatusMessage(context.Background(), &publishRecordingClient{}, "client-1", unmarshalControlMessage(t, onlineHandshake), cfg, deps, metrics)
+	if err != nil {
+		t.Fatalf("Unexpected error handling the online message: %s", err)
+	}
+
+	if len(writer.messages) != 1 || string(writer.messages[0].Key) != "client-1" {
+		t.Fatalf("Expected one inventory message keyed by the client id, got %+v", writer.messages)
+	}
+
+	var msg struct {
+		Operation string                 `json:"operation"`
+		Data      map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(writer.messages[0].Value, &msg); err != nil {
+		t.Fatalf("Unable to parse the inventory message: %s", err)
+	}
+
+	if msg.Operation != inventoryAddHostOperation || msg.Data["rhc_client_id"] != "client-1" || msg.Data["account"] != "1234" || msg.Data["fqdn"] != "host.example.com" {
+		t.Fatalf("Unexpected inventory message %+v", msg)
+	}
+}
@@ -0,0 +1,92 @@
+package mqtt
+
+import (
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+// lastSeenThrottle limits how often the connection registrar is told that a client
+// was seen.  A client that sends a steady stream of control messages only needs its
+// last seen time to be refreshed often enough that the connection is not reaped (or,
+// in redis, does not expire), so the update is skipped if the client was recorded
+// within the interval.  Clients that have not been recorded within the interval are
+// removed once per interval, which bounds the amount of state that is kept.
+type lastSeenThrottle struct {
+	interval  time.Duration
+	lastPrune time.Time
+	recorded  map[domain.ClientID]time.Time
+	sync.Mutex
+}
+
+// newLastSeenThrottle creates the throttle.  An interval of zero disables the throttle.
+func newLastSeenThrottle(interval time.Duration) *lastSeenThrottle {
+	return &lastSeenThrottle{
+		interval: interval,
+		recorded: make(map[domain.ClientID]time.Time),
+	}
+}
+
+// lastSeenUpdateInterval is half of the shortest window within which a client's last
+// seen time has to be refreshed
+func lastSeenUpdateInterval(cfg *config.Config) time.Duration {
+	window := cfg.StaleConnectionTTL
+	if cfg.ConnectionRegistrarImpl == "redis" && cfg.RedisConnectionTTL > 0 && (window <= 0 || cfg.RedisConnectionTTL < window) {
+		window = cfg.RedisConnectionTTL
+	}
+
+	if window <= 0 {
+		return 0
+	}
+
+	return window / 2
+}
+
+// shouldRecord returns true if the client's last seen time needs to be updated.  The
+// client is considered recorded as of now when true is returned.
+func (t *lastSeenThrottle) shouldRecord(clientID domain.ClientID, now time.Time) bool {
+	if t.interval <= 0 {
+		return true
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	if now.Sub(t.lastPrune) > t.interval {
+		t.prune(now)
+	}
+
+	if recordedAt, found := t.recorded[clientID]; found && now.Sub(recordedAt) < t.interval {
+		return false
+	}
+
+	t.recorded[clientID] = now
+
+	return true
+}
+
+// forget makes sure that the next message from the client updates its last seen time.
+// This is used when the update fails, or when the client is not registered yet, so that
+// the update is not skipped for the rest of the interval.
+func (t *lastSeenThrottle) forget(clientID domain.ClientID) {
+	if t.interval <= 0 {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	delete(t.recorded, clientID)
+}
+
+func (t *lastSeenThrottle) prune(now time.Time) {
+	for clientID, recordedAt := range t.recorded {
+		if now.Sub(recordedAt) >= t.interval {
+			delete(t.recorded, clientID)
+		}
+	}
+
+	t.lastPrune = now
+}
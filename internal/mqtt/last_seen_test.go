@@ -0,0 +1,135 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+func TestLastSeenThrottle(t *testing.T) {
+	now := time.Now()
+	throttle := newLastSeenThrottle(time.Minute)
+
+	var tests = []struct {
+		name     string
+		clientID domain.ClientID
+		at       time.Time
+		expected bool
+	}{
+		{"first message", "client-1", now, true},
+		{"within the interval", "client-1", now.Add(30 * time.Second), false},
+		{"another client", "client-2", now.Add(30 * time.Second), true},
+		{"after the interval", "client-1", now.Add(time.Minute), true},
+	}
+
+	for _, tc := range tests {
+		if actual := throttle.shouldRecord(tc.clientID, tc.at); actual != tc.expected {
+			t.Fatalf("%s: expected shouldRecord to return %t, got %t", tc.name, tc.expected, actual)
+		}
+	}
+
+	throttle.forget("client-1")
+
+	if throttle.shouldRecord("client-1", now.Add(time.Minute+time.Second)) == false {
+		t.Fatalf("Expected a forgotten client to be recorded")
+	}
+}
+
+func TestDisabledLastSeenThrottle(t *testing.T) {
+	throttle := newLastSeenThrottle(0)
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if throttle.shouldRecord("client-1", now) == false {
+			t.Fatalf("Expected every message to be recorded when the throttle is disabled")
+		}
+	}
+}
+
+func TestLastSeenThrottlePrunesClients(t *testing.T) {
+	now := time.Now()
+	throttle := newLastSeenThrottle(time.Minute)
+
+	throttle.shouldRecord("client-1", now)
+	throttle.shouldRecord("client-2", now.Add(2*time.Minute))
+
+	if len(throttle.recorded) != 1 {
+		t.Fatalf("Expected the clients that were not recorded within the interval to be removed, got %d clients", len(throttle.recorded))
+	}
+}
+
+func TestLastSeenUpdateInterval(t *testing.T) {
+	var tests = []struct {
+		name      string
+		registrar string
+		staleTTL  time.Duration
+		redisTTL  time.Duration
+		expected  time.Duration
+	}{
+		{"reaper disabled", "local", 0, time.Hour, 0},
+		{"reaper", "local", 10 * time.Minute, time.Hour, 5 * time.Minute},
+		{"redis", "redis", 0, time.Hour, 30 * time.Minute},
+		{"reaper with redis", "redis", 10 * time.Minute, time.Hour, 5 * time.Minute},
+		{"redis expires before the reaper", "redis", time.Hour, 10 * time.Minute, 5 * time.Minute},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.Config{ConnectionRegistrarImpl: tc.registrar, StaleConnectionTTL: tc.staleTTL, RedisConnectionTTL: tc.redisTTL}
+
+			if actual := lastSeenUpdateInterval(cfg); actual != tc.expected {
+				t.Fatalf("Expected an interval of %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+type countingLastSeenRegistrar struct {
+	controller.ConnectionRegistrar
+	updates int
+	err     error
+}
+
+func (r *countingLastSeenRegistrar) UpdateLastSeen(ctx context.Context, clientID domain.ClientID, seenAt time.Time) error {
+	r.updates++
+	return r.err
+}
+
+func TestControlMessagesAreThrottledWhenUpdatingLastSeen(t *testing.T) {
+	var tests = []struct {
+		name            string
+		err             error
+		expectedUpdates int
+	}{
+		{"update", nil, 1},
+		{"update failed", errors.New("unavailable"), 3},
+		{"not registered", controller.ErrConnectionNotFound, 3},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := config.GetConfig()
+			registrar := &countingLastSeenRegistrar{ConnectionRegistrar: controller.NewLocalConnectionManager(), err: tc.err}
+
+			dispatcherChanges, _ := newTestDispatcherChangeHandler(t, "ignore")
+
+			deps := newTestControlMessageDeps(registrar, &staticAccountResolver{account: "1234"}, dispatcherChanges)
+			deps.lastSeen = newLastSeenThrottle(time.Minute)
+			handler := controlMessageHandler(cfg, deps, metrics)
+
+			for i := 0; i < 3; i++ {
+				handler(&publishRecordingClient{}, testMessage{topic: "redhat/insights/client-1/control/out",
+					payload: []byte(`{"type": "event", "message_id": "1234", "version": 1, "content": {"event": "job-progress"}}`)})
+			}
+
+			if registrar.updates != tc.expectedUpdates {
+				t.Fatalf("Expected %d last seen updates, got %d", tc.expectedUpdates, registrar.updates)
+			}
+		})
+	}
+}
@@ -0,0 +1,482 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
+	"github.com/redhatinsights/platform-go-middlewares/request_id"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	reconnectCommand        = "reconnect"
+	throttleCommand         = "throttle"
+	pingCommand             = "ping"
+	disconnectCommand       = "disconnect"
+	reconnectScheduledEvent = "reconnect-scheduled"
+)
+
+var (
+	ErrInvalidQos = errors.New("Invalid QoS level")
+
+	ErrInvalidReconnectDelayRange = errors.New("Invalid reconnect delay range")
+
+	// ErrPublishTimeout is returned when the broker does not acknowledge a QoS 0 or
+	// QoS 1 message before the deadline.  Publishing the message again is safe, but
+	// the client might receive it twice.
+	ErrPublishTimeout = errors.New("Timed out waiting for the broker to acknowledge the message")
+
+	// ErrPublishIncomplete is returned when the exactly once delivery of a QoS 2 message
+	// is not completed (PUBCOMP) before the deadline.  The broker might or might not
+	// have received the message.  The MQTT client keeps trying to complete the delivery
+	// while it stays connected, but the message is lost if the connection drops before
+	// it is completed.  Publishing the message again might deliver it twice.
+	ErrPublishIncomplete = errors.New("Timed out waiting for the broker to complete the delivery of the message")
+)
+
+func VerifyQos(qos byte) error {
+	if qos > 2 {
+		return ErrInvalidQos
+	}
+	return nil
+}
+
+// buildControlMessage builds a control message that starts its own correlation.  The
+// callers replace the correlation id when the message is part of another one.
+func buildControlMessage(messageType string, content interface{}, timestampFormat string) (*uuid.UUID, *ControlMessage, error) {
+
+	messageID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	message := ControlMessage{
+		MessageType:   messageType,
+		MessageID:     messageID.String(),
+		Version:       1,
+		Sent:          newTimestamp(time.Now(), timestampFormat),
+		Content:       content,
+		CorrelationID: messageID.String(),
+	}
+
+	return &messageID, &message, nil
+}
+
+// withRequestCorrelation ties the message to the API request that is sending it.  The
+// message keeps its own correlation id when the context has no request id.
+func withRequestCorrelation(ctx context.Context, message *ControlMessage) {
+	if requestID := request_id.GetReqID(ctx); requestID != "" {
+		message.CorrelationID = requestID
+	}
+}
+
+func buildReconnectMessage(delay int, timestampFormat string) (*uuid.UUID, *ControlMessage, error) {
+
+	args := map[string]interface{}{"delay": delay}
+
+	content := CommandMessageContent{Command: reconnectCommand, Arguments: args}
+
+	return buildControlMessage("command", content, timestampFormat)
+}
+
+func VerifyReconnectDelayRange(minDelay int, maxDelay int) error {
+	if minDelay < 0 || maxDelay < 0 || (minDelay > 0 && maxDelay > 0 && minDelay > maxDelay) {
+		return ErrInvalidReconnectDelayRange
+	}
+	return nil
+}
+
+// reconnectDelay picks the delay for a reconnect command.  A random delay within the
+// range is used so that the clients that are told to reconnect at the same time (during
+// an outage for example) do not all come back at once.  When only one end of the range
+// is set, that value is used as a fixed delay.  The fixed delay is used when neither
+// end of the range is set.
+func reconnectDelay(fixedDelay int, minDelay int, maxDelay int, intn func(int) int) int {
+	switch {
+	case minDelay <= 0 && maxDelay <= 0:
+		return fixedDelay
+	case maxDelay <= 0 || minDelay == maxDelay:
+		return minDelay
+	case minDelay <= 0:
+		return maxDelay
+	default:
+		return minDelay + intn(maxDelay-minDelay+1)
+	}
+}
+
+func invalidHandshakeReconnectDelay(cfg *config.Config) int {
+	return reconnectDelay(cfg.InvalidHandshakeReconnectDelay, cfg.ReconnectDelayMin, cfg.ReconnectDelayMax, rand.Intn)
+}
+
+func buildThrottleMessage(interval int, timestampFormat string) (*uuid.UUID, *ControlMessage, error) {
+
+	args := map[string]interface{}{"interval": interval}
+
+	content := CommandMessageContent{Command: throttleCommand, Arguments: args}
+
+	return buildControlMessage("command", content, timestampFormat)
+}
+
+func buildDisconnectMessage(timestampFormat string) (*uuid.UUID, *ControlMessage, error) {
+
+	content := CommandMessageContent{Command: disconnectCommand}
+
+	return buildControlMessage("command", content, timestampFormat)
+}
+
+// SendDisconnectMessageToClient sends a disconnect command to the client.  The client
+// disconnects from the broker when it receives the command and does not reconnect.
+func SendDisconnectMessageToClient(client MQTT.Client, topicBuilder *TopicBuilder, signer MessageSigner, timestampFormat string, clientID domain.ClientID) (*uuid.UUID, error) {
+
+	messageID, message, err := buildDisconnectMessage(timestampFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Log.WithFields(logrus.Fields{"clientID": clientID, "message_id": messageID}).Info("Sending disconnect message to client")
+
+	return messageID, sendControlMessage(client, topicBuilder, signer, clientID, message)
+}
+
+func sendThrottleMessageToClient(client MQTT.Client, topicBuilder *TopicBuilder, signer MessageSigner, timestampFormat string, clientID domain.ClientID, interval int) (*uuid.UUID, error) {
+
+	messageID, message, err := buildThrottleMessage(interval, timestampFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Log.WithFields(logrus.Fields{"clientID": clientID, "message_id": messageID, "interval": interval, "correlation_id": message.CorrelationID}).Info("Sending throttle message to client")
+
+	return messageID, sendControlMessage(client, topicBuilder, signer, clientID, message)
+}
+
+// sendReconnectMessageToClient sends a reconnect command to the client.  The pendingCommands
+// store is optional.  It is only needed when the caller is also consuming the events
+// that the clients send in response to the command.
+func sendReconnectMessageToClient(client MQTT.Client, topicBuilder *TopicBuilder, signer MessageSigner, timestampFormat string, clientID domain.ClientID, pendingCommands *pendingCommandStore, delay int, correlationID string) (*uuid.UUID, error) {
+
+	messageID, message, err := buildReconnectMessage(delay, timestampFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	if correlationID != "" {
+		message.CorrelationID = correlationID
+	}
+
+	logger.Log.WithFields(logrus.Fields{"clientID": clientID, "message_id": messageID, "delay": delay, "correlation_id": message.CorrelationID}).Debug("Sending reconnect message to client")
+
+	if pendingCommands != nil {
+		pendingCommands.add(message.MessageID, pendingCommand{ClientID: clientID, Command: reconnectCommand, Delay: delay})
+	}
+
+	return messageID, sendControlMessage(client, topicBuilder, signer, clientID, message)
+}
+
+func sendControlMessage(client MQTT.Client, topicBuilder *TopicBuilder, signer MessageSigner, clientID domain.ClientID, message *ControlMessage) error {
+
+	if err := signOutgoingControlMessage(signer, clientSigningKeyID(clientID), message); err != nil {
+		return err
+	}
+
+	topic := topicBuilder.BuildOutgoingControlTopic(clientID)
+
+	messageBytes, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	t := client.Publish(topic, byte(0), false, messageBytes)
+	go func() {
+		_ = t.Wait()
+		if t.Error() != nil {
+			logger.Log.WithFields(logrus.Fields{"clientID": clientID, "error": t.Error()}).Error("Error publishing control message")
+		}
+	}()
+
+	return nil
+}
+
+// SendControlMessageToClient publishes a command message to the client and waits for the
+// publish to complete.  The id of the message is returned so that the caller can correlate
+// the client's response with the command.  An error is returned if the message could not
+// be published before the context expired or if the client does not support the command.
+func SendControlMessageToClient(ctx context.Context, client MQTT.Client, topicBuilder *TopicBuilder, signer MessageSigner, timestampFormat string, capabilities *CapabilityGate, qos byte, clientID domain.ClientID, content *CommandMessageContent) (*uuid.UUID, error) {
+	if err := capabilities.check(ctx, clientID, content.Command); err != nil {
+		return nil, err
+	}
+
+	messageID, message, err := buildControlMessage("command", content, timestampFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	withRequestCorrelation(ctx, message)
+
+	logger.Log.WithFields(logrus.Fields{"clientID": clientID, "message_id": messageID, "command": content.Command, "correlation_id": message.CorrelationID}).Debug("Sending control message to client")
+
+	if err := publishControlMessage(ctx, client, topicBuilder, signer, qos, clientID, message); err != nil {
+		return nil, err
+	}
+
+	return messageID, nil
+}
+
+// SendControlMessageToAll publishes a single command message to the broadcast control
+// topic instead of publishing the command to each of the clients' control topics.
+//
+// The message is published with the qos level, but each client receives it at the
+// lower of that level and the level of the client's subscription.  The message is not
+// retained so it is only delivered to the clients that are connected when it is
+// published.  Retaining a command, a reconnect for example, would deliver it again to
+// every client that subscribes after it was published.
+//
+// Nothing is broadcast while the capability gate is enabled as the clients' support for
+// the command cannot be checked.
+func SendControlMessageToAll(ctx context.Context, client MQTT.Client, topicBuilder *TopicBuilder, signer MessageSigner, timestampFormat string, capabilities *CapabilityGate, qos byte, content *CommandMessageContent) (*uuid.UUID, error) {
+	if err := VerifyQos(qos); err != nil {
+		return nil, err
+	}
+
+	if err := capabilities.checkBroadcast(content.Command); err != nil {
+		return nil, err
+	}
+
+	messageID, message, err := buildControlMessage("command", content, timestampFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	withRequestCorrelation(ctx, message)
+
+	if err := signOutgoingControlMessage(signer, broadcastSigningKeyID, message); err != nil {
+		return nil, err
+	}
+
+	messageBytes, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Log.WithFields(logrus.Fields{"message_id": messageID, "command": content.Command, "correlation_id": message.CorrelationID}).Info("Broadcasting control message to all clients")
+
+	t := client.Publish(topicBuilder.BuildBroadcastControlTopic(), qos, false, messageBytes)
+
+	select {
+	case <-t.Done():
+		if t.Error() != nil {
+			return nil, t.Error()
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return messageID, nil
+}
+
+// publishDeadlineError replaces the error of a publish that timed out with the error
+// that tells the caller whether the message can safely be published again
+func publishDeadlineError(qos byte, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) == false {
+		return err
+	}
+
+	if qos == 2 {
+		return ErrPublishIncomplete
+	}
+	return ErrPublishTimeout
+}
+
+func publishControlMessage(ctx context.Context, client MQTT.Client, topicBuilder *TopicBuilder, signer MessageSigner, qos byte, clientID domain.ClientID, message *ControlMessage) error {
+
+	if err := signOutgoingControlMessage(signer, clientSigningKeyID(clientID), message); err != nil {
+		return err
+	}
+
+	messageBytes, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	t := client.Publish(topicBuilder.BuildOutgoingControlTopic(clientID), qos, false, messageBytes)
+
+	select {
+	case <-t.Done():
+		return t.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ControlMessageSender publishes control messages to clients.  It does not require
+// the MQTT client to be subscribed to any topics.
+type ControlMessageSender struct {
+	client          MQTT.Client
+	topicBuilder    *TopicBuilder
+	reconnectQos    byte
+	publishTimeout  time.Duration
+	pongs           *PongTracker
+	pongTimeout     time.Duration
+	signer          MessageSigner
+	timestampFormat string
+	capabilities    *CapabilityGate
+}
+
+type ControlMessageSenderOptionsFunc func(*ControlMessageSender)
+
+// WithSyncDelivery makes the sender publish reconnect commands with the QoS level and
+// wait up to the timeout for the broker to acknowledge them.  Without it, reconnect
+// commands are published with QoS 0 and Reconnect only waits until the context expires.
+func WithSyncDelivery(reconnectQos byte, publishTimeout time.Duration) ControlMessageSenderOptionsFunc {
+	return func(cms *ControlMessageSender) {
+		cms.reconnectQos = reconnectQos
+		cms.publishTimeout = publishTimeout
+	}
+}
+
+// WithPongTracking makes Ping wait up to the timeout for the client to respond with a
+// pong.  The tracker must be the one that the connection handler resolves the pongs with.
+func WithPongTracking(pongs *PongTracker, pongTimeout time.Duration) ControlMessageSenderOptionsFunc {
+	return func(cms *ControlMessageSender) {
+		cms.pongs = pongs
+		cms.pongTimeout = pongTimeout
+	}
+}
+
+// WithMessageSigner makes the sender sign the control messages.  Passing nil leaves
+// the messages unsigned.
+func WithMessageSigner(signer MessageSigner) ControlMessageSenderOptionsFunc {
+	return func(cms *ControlMessageSender) {
+		cms.signer = signer
+	}
+}
+
+// WithTimestampFormat sets the serialization format of the sent timestamp of the
+// control messages
+func WithTimestampFormat(format string) ControlMessageSenderOptionsFunc {
+	return func(cms *ControlMessageSender) {
+		cms.timestampFormat = format
+	}
+}
+
+// WithCapabilityGate only sends the reconnect commands to the clients that advertise
+// support for them.  Ping is not gated as it checks that the client is still connected.
+func WithCapabilityGate(capabilities *CapabilityGate) ControlMessageSenderOptionsFunc {
+	return func(cms *ControlMessageSender) {
+		cms.capabilities = capabilities
+	}
+}
+
+func NewControlMessageSender(client MQTT.Client, topicBuilder *TopicBuilder, opts ...ControlMessageSenderOptionsFunc) *ControlMessageSender {
+	cms := &ControlMessageSender{
+		client:       client,
+		topicBuilder: topicBuilder,
+	}
+
+	for _, opt := range opts {
+		opt(cms)
+	}
+
+	return cms
+}
+
+// Reconnect sends a reconnect command to the client and waits for the broker to
+// acknowledge it, for up to the publish timeout if one has been configured.
+func (cms *ControlMessageSender) Reconnect(ctx context.Context, clientID domain.ClientID, delay int) error {
+	if err := VerifyQos(cms.reconnectQos); err != nil {
+		return err
+	}
+
+	if err := cms.capabilities.check(ctx, clientID, reconnectCommand); err != nil {
+		return err
+	}
+
+	messageID, message, err := buildReconnectMessage(delay, cms.timestampFormat)
+	if err != nil {
+		return err
+	}
+
+	withRequestCorrelation(ctx, message)
+
+	if cms.publishTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cms.publishTimeout)
+		defer cancel()
+	}
+
+	logger.Log.WithFields(logrus.Fields{"clientID": clientID, "message_id": messageID, "delay": delay, "qos": cms.reconnectQos, "correlation_id": message.CorrelationID}).Debug("Sending reconnect message to client")
+
+	err = publishControlMessage(ctx, cms.client, cms.topicBuilder, cms.signer, cms.reconnectQos, clientID, message)
+
+	return publishDeadlineError(cms.reconnectQos, err)
+}
+
+// PreviewReconnect builds the reconnect command that Reconnect would publish to the client
+func (cms *ControlMessageSender) PreviewReconnect(ctx context.Context, clientID domain.ClientID, delay int) (controller.MessagePreview, error) {
+	if err := cms.capabilities.check(ctx, clientID, reconnectCommand); err != nil {
+		return controller.MessagePreview{}, err
+	}
+
+	_, message, err := buildReconnectMessage(delay, cms.timestampFormat)
+	if err != nil {
+		return controller.MessagePreview{}, err
+	}
+
+	withRequestCorrelation(ctx, message)
+
+	if err := signOutgoingControlMessage(cms.signer, clientSigningKeyID(clientID), message); err != nil {
+		return controller.MessagePreview{}, err
+	}
+
+	return controller.MessagePreview{Topic: cms.topicBuilder.BuildOutgoingControlTopic(clientID), Message: message}, nil
+}
+
+// Ping publishes a ping command to the client and waits for the client to respond
+// with a pong.  An error wrapping controller.ErrClientUnreachable is returned if the
+// pong does not arrive within the pong timeout (or before the context expires).  Any
+// other error means that the command could not be delivered to the broker and says
+// nothing about the client.  Without pong tracking, Ping only waits for the broker
+// to acknowledge the command.
+func (cms *ControlMessageSender) Ping(ctx context.Context, clientID domain.ClientID) error {
+	messageID, message, err := buildControlMessage("command", CommandMessageContent{Command: pingCommand}, cms.timestampFormat)
+	if err != nil {
+		return err
+	}
+
+	withRequestCorrelation(ctx, message)
+
+	if cms.pongs == nil {
+		return publishControlMessage(ctx, cms.client, cms.topicBuilder, cms.signer, byte(1), clientID, message)
+	}
+
+	// Start waiting before publishing so that a fast pong is not missed
+	pong, stopWaiting := cms.pongs.expect(clientID, messageID.String())
+	defer stopWaiting()
+
+	if err := publishControlMessage(ctx, cms.client, cms.topicBuilder, cms.signer, byte(1), clientID, message); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(cms.pongTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-pong:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("%w: no pong received within %s", controller.ErrClientUnreachable, cms.pongTimeout)
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %s", controller.ErrClientUnreachable, ctx.Err())
+	}
+}
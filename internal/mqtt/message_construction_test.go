@@ -0,0 +1,369 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/redhatinsights/platform-go-middlewares/request_id"
+)
+
+type incompleteToken struct {
+	completedToken
+}
+
+func (t incompleteToken) Done() <-chan struct{} {
+	return make(chan struct{})
+}
+
+func (t incompleteToken) WaitTimeout(time.Duration) bool { return false }
+
+type failedToken struct {
+	completedToken
+}
+
+func (t failedToken) Error() error { return errors.New("connection lost") }
+
+type tokenClient struct {
+	MQTT.Client
+	token MQTT.Token
+	qos   byte
+}
+
+func (c *tokenClient) Publish(topic string, qos byte, retained bool, payload interface{}) MQTT.Token {
+	c.qos = qos
+	return c.token
+}
+
+type incompletePublishClient struct {
+	MQTT.Client
+}
+
+func (c incompletePublishClient) Publish(topic string, qos byte, retained bool, payload interface{}) MQTT.Token {
+	return incompleteToken{}
+}
+
+func TestSendControlMessageToClient(t *testing.T) {
+	client := &publishRecordingClient{}
+	content := &CommandMessageContent{Command: reconnectCommand, Arguments: map[string]interface{}{"delay": 5}}
+
+	messageID, err := SendControlMessageToClient(context.TODO(), client, NewTopicBuilder(), nil, TimestampFormatRFC3339, nil, byte(1), "client-1", content)
+	if err != nil {
+		t.Fatalf("Unexpected error sending the control message: %s", err)
+	}
+
+	if len(client.published) != 1 {
+		t.Fatalf("Expected 1 control message to be published, but got %d", len(client.published))
+	}
+
+	if client.published[0].topic != "redhat/insights/client-1/control/in" {
+		t.Fatalf("Unexpected control message topic: %s", client.published[0].topic)
+	}
+
+	msg := unmarshalControlMessage(t, string(client.published[0].payload))
+	if msg.MessageID != messageID.String() {
+		t.Fatalf("Expected the returned message id %s to match the published message id %s", messageID, msg.MessageID)
+	}
+
+	if msg.Content.(map[string]interface{})["command"] != reconnectCommand {
+		t.Fatalf("Unexpected control message: %s", client.published[0].payload)
+	}
+}
+
+func TestSendControlMessageToClientHonorsContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	content := &CommandMessageContent{Command: reconnectCommand}
+
+	messageID, err := SendControlMessageToClient(ctx, incompletePublishClient{}, NewTopicBuilder(), nil, TimestampFormatRFC3339, nil, byte(1), "client-1", content)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected the send to fail once the context expired, got %v", err)
+	}
+
+	if messageID != nil {
+		t.Fatalf("Expected no message id when the send fails, got %s", messageID)
+	}
+}
+
+func TestReconnectWithSyncDelivery(t *testing.T) {
+	var tests = []struct {
+		name     string
+		qos      byte
+		token    MQTT.Token
+		expected error
+	}{
+		{"qos 1 acknowledged", 1, completedToken{}, nil},
+		{"qos 2 completed", 2, completedToken{}, nil},
+		{"qos 0 timed out", 0, incompleteToken{}, ErrPublishTimeout},
+		{"qos 1 timed out", 1, incompleteToken{}, ErrPublishTimeout},
+		{"qos 2 not completed", 2, incompleteToken{}, ErrPublishIncomplete},
+		{"invalid qos", 3, completedToken{}, ErrInvalidQos},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &tokenClient{token: tc.token}
+			sender := NewControlMessageSender(client, NewTopicBuilder(), WithSyncDelivery(tc.qos, 10*time.Millisecond))
+
+			if err := sender.Reconnect(context.TODO(), "client-1", 30); err != tc.expected {
+				t.Fatalf("Expected %v, got %v", tc.expected, err)
+			}
+
+			if tc.expected != ErrInvalidQos && client.qos != tc.qos {
+				t.Fatalf("Expected the reconnect command to be published with QoS %d, got %d", tc.qos, client.qos)
+			}
+		})
+	}
+}
+
+func TestReconnectReturnsPublishError(t *testing.T) {
+	client := &tokenClient{token: failedToken{}}
+	sender := NewControlMessageSender(client, NewTopicBuilder(), WithSyncDelivery(1, time.Second))
+
+	err := sender.Reconnect(context.TODO(), "client-1", 30)
+	if err == nil || err == ErrPublishTimeout {
+		t.Fatalf("Expected the publish error to be returned, got %v", err)
+	}
+}
+
+func TestReconnectHonorsContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	client := &tokenClient{token: incompleteToken{}}
+	sender := NewControlMessageSender(client, NewTopicBuilder())
+
+	if err := sender.Reconnect(ctx, "client-1", 30); err != context.Canceled {
+		t.Fatalf("Expected the reconnect to stop once the context was cancelled, got %v", err)
+	}
+}
+
+func TestOutgoingControlMessagesCarryACorrelationID(t *testing.T) {
+	client := &publishRecordingClient{}
+	sender := NewControlMessageSender(client, NewTopicBuilder())
+
+	requestCtx := context.WithValue(context.Background(), request_id.RequestIDKey, "request-1")
+
+	if err := sender.Reconnect(requestCtx, "client-1", 30); err != nil {
+		t.Fatalf("Unexpected error sending the reconnect message: %s", err)
+	}
+
+	if err := sender.Ping(context.TODO(), "client-1"); err != nil {
+		t.Fatalf("Unexpected error sending the ping message: %s", err)
+	}
+
+	if _, err := sendThrottleMessageToClient(client, NewTopicBuilder(), nil, TimestampFormatRFC3339, "client-1", 300); err != nil {
+		t.Fatalf("Unexpected error sending the throttle message: %s", err)
+	}
+
+	var messages []ControlMessage
+	for _, published := range client.published {
+		var msg ControlMessage
+		if err := json.Unmarshal(published.payload, &msg); err != nil {
+			t.Fatalf("Unexpected error unmarshalling the control message: %s", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	if messages[0].CorrelationID != "request-1" {
+		t.Fatalf("Expected the reconnect message to carry the request id, got %s", messages[0].CorrelationID)
+	}
+
+	for _, msg := range messages[1:] {
+		if msg.CorrelationID != msg.MessageID {
+			t.Fatalf("Expected the message to start its own correlation, got %s for message %s", msg.CorrelationID, msg.MessageID)
+		}
+	}
+}
+
+func TestReconnectDelay(t *testing.T) {
+	lowest := func(n int) int { return 0 }
+	highest := func(n int) int { return n - 1 }
+
+	var tests = []struct {
+		name     string
+		minDelay int
+		maxDelay int
+		intn     func(int) int
+		expected int
+	}{
+		{"no range uses the fixed delay", 0, 0, highest, 30},
+		{"only the min is set", 10, 0, highest, 10},
+		{"only the max is set", 0, 60, lowest, 60},
+		{"equal min and max", 45, 45, highest, 45},
+		{"lowest value in the range", 10, 60, lowest, 10},
+		{"highest value in the range", 10, 60, highest, 60},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := reconnectDelay(30, tc.minDelay, tc.maxDelay, tc.intn); actual != tc.expected {
+				t.Fatalf("Expected a delay of %d, got %d", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestReconnectDelayIsSpread(t *testing.T) {
+	delays := make(map[int]bool)
+	for i := 0; i < 100; i++ {
+		delay := reconnectDelay(30, 10, 20, rand.Intn)
+		if delay < 10 || delay > 20 {
+			t.Fatalf("Expected the delay to be within the range, got %d", delay)
+		}
+		delays[delay] = true
+	}
+
+	if len(delays) < 2 {
+		t.Fatalf("Expected the delays to be spread across the range, got %v", delays)
+	}
+}
+
+func TestVerifyReconnectDelayRange(t *testing.T) {
+	var tests = []struct {
+		minDelay int
+		maxDelay int
+		expected error
+	}{
+		{0, 0, nil},
+		{10, 0, nil},
+		{0, 10, nil},
+		{10, 20, nil},
+		{20, 10, ErrInvalidReconnectDelayRange},
+		{-1, 10, ErrInvalidReconnectDelayRange},
+	}
+
+	for _, tc := range tests {
+		if err := VerifyReconnectDelayRange(tc.minDelay, tc.maxDelay); err != tc.expected {
+			t.Fatalf("Expected %v for the range %d-%d, got %v", tc.expected, tc.minDelay, tc.maxDelay, err)
+		}
+	}
+}
+
+func TestSendDisconnectMessageToClient(t *testing.T) {
+	client := &publishRecordingClient{}
+
+	messageID, err := SendDisconnectMessageToClient(client, NewTopicBuilder(), nil, TimestampFormatRFC3339, "client-1")
+	if err != nil {
+		t.Fatalf("Unexpected error sending the disconnect message: %s", err)
+	}
+
+	if len(client.published) != 1 || client.published[0].topic != "redhat/insights/client-1/control/in" {
+		t.Fatalf("Expected the disconnect message to be published to the client's control topic, got %+v", client.published)
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(client.published[0].payload, &payload); err != nil {
+		t.Fatalf("Unable to unmarshal the disconnect message: %s", err)
+	}
+
+	if payload["type"] != "command" || payload["message_id"] != messageID.String() || payload["version"] != float64(1) {
+		t.Fatalf("Unexpected disconnect message: %s", client.published[0].payload)
+	}
+
+	if _, found := payload["sent"]; found == false {
+		t.Fatalf("Expected the disconnect message to include the time it was sent: %s", client.published[0].payload)
+	}
+
+	content := payload["content"].(map[string]interface{})
+	if content["command"] != disconnectCommand || content["arguments"] != nil {
+		t.Fatalf("Expected the disconnect command without arguments, got %s", client.published[0].payload)
+	}
+}
+
+func TestClosingTheProxyDisconnectsTheClient(t *testing.T) {
+	client := &publishRecordingClient{}
+	proxy := &ReceptorMQTTProxy{ClientID: "client-1", Client: client}
+
+	if err := proxy.Close(context.TODO()); err != nil {
+		t.Fatalf("Unexpected error closing the proxy: %s", err)
+	}
+
+	if len(client.published) != 1 {
+		t.Fatalf("Expected a disconnect message to be published, got %d messages", len(client.published))
+	}
+
+	msg := unmarshalControlMessage(t, string(client.published[0].payload))
+	if msg.Content.(map[string]interface{})["command"] != disconnectCommand {
+		t.Fatalf("Unexpected message: %s", client.published[0].payload)
+	}
+}
+
+func TestProxySendsDataMessagesWithQos1(t *testing.T) {
+	client := &publishRecordingClient{}
+	proxy := &ReceptorMQTTProxy{ClientID: "client-1", Client: client, ChunkSize: 4}
+
+	if _, err := proxy.SendMessage(context.TODO(), "1234", "client-1", "a payload that is chunked", "playbook"); err != nil {
+		t.Fatalf("Unexpected error sending the message: %s", err)
+	}
+
+	if len(client.published) < 2 {
+		t.Fatalf("Expected the payload to be published in chunks, got %d messages", len(client.published))
+	}
+
+	for _, published := range client.published {
+		if published.qos != 1 {
+			t.Fatalf("Expected each chunk to be published with QoS 1, got %d", published.qos)
+		}
+	}
+}
+
+func TestProxyReturnsPublishFailures(t *testing.T) {
+	proxy := &ReceptorMQTTProxy{ClientID: "client-1", Client: &tokenClient{token: failedToken{}}}
+
+	if _, err := proxy.SendMessage(context.TODO(), "1234", "client-1", "payload", "playbook"); err == nil {
+		t.Fatal("Expected the publish failure to be returned")
+	}
+}
+
+func TestProxySendHonorsContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	proxy := &ReceptorMQTTProxy{ClientID: "client-1", Client: incompletePublishClient{}}
+
+	if _, err := proxy.SendMessage(ctx, "1234", "client-1", "payload", "playbook"); err != context.Canceled {
+		t.Fatalf("Expected the send to be canceled, but got %v", err)
+	}
+}
+
+func TestSendControlMessageToAll(t *testing.T) {
+	client := &publishRecordingClient{}
+
+	messageID, err := SendControlMessageToAll(context.TODO(), client, NewTopicBuilder(), nil, TimestampFormatRFC3339, nil, 1, &CommandMessageContent{Command: reconnectCommand, Arguments: map[string]int{"delay": 60}})
+	if err != nil {
+		t.Fatalf("Unexpected error broadcasting the message: %s", err)
+	}
+
+	if len(client.published) != 1 {
+		t.Fatalf("Expected the message to be published once, but got %d", len(client.published))
+	}
+
+	published := client.published[0]
+	if published.topic != "redhat/insights/broadcast/control/in" || published.qos != 1 || published.retained {
+		t.Fatalf("Unexpected broadcast: topic %s, qos %d, retained %t", published.topic, published.qos, published.retained)
+	}
+
+	msg := unmarshalControlMessage(t, string(published.payload))
+	if msg.MessageID != messageID.String() || msg.MessageType != "command" {
+		t.Fatalf("Unexpected broadcast message: %s", published.payload)
+	}
+}
+
+func TestSendControlMessageToAllHonorsContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := SendControlMessageToAll(ctx, incompletePublishClient{}, NewTopicBuilder(), nil, TimestampFormatRFC3339, nil, 1, &CommandMessageContent{Command: pingCommand}); err != context.Canceled {
+		t.Fatalf("Expected the broadcast to be cancelled, but got %v", err)
+	}
+
+	if _, err := SendControlMessageToAll(context.TODO(), &publishRecordingClient{}, NewTopicBuilder(), nil, TimestampFormatRFC3339, nil, 3, &CommandMessageContent{Command: pingCommand}); err != ErrInvalidQos {
+		t.Fatalf("Expected %v, but got %v", ErrInvalidQos, err)
+	}
+}
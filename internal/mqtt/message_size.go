@@ -0,0 +1,93 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrInvalidMessageSizeLimit = errors.New("Invalid message size limit")
+
+// MessageSizeLimits is the maximum size, in bytes, of the marshaled payload of a data
+// message.  The directive's limit takes precedence over the default limit.  A limit of
+// zero disables the check.
+type MessageSizeLimits struct {
+	defaultLimit int
+	perDirective map[string]int
+	metrics      *Metrics
+}
+
+// NewMessageSizeLimits parses the per directive limits (directive -> bytes)
+func NewMessageSizeLimits(defaultLimit int, perDirective map[string]string, metrics *Metrics) (*MessageSizeLimits, error) {
+	if defaultLimit < 0 {
+		return nil, ErrInvalidMessageSizeLimit
+	}
+
+	limits := &MessageSizeLimits{
+		defaultLimit: defaultLimit,
+		perDirective: make(map[string]int, len(perDirective)),
+		metrics:      metrics,
+	}
+
+	for directive, limitString := range perDirective {
+		limit, err := strconv.Atoi(limitString)
+		if err != nil || limit < 0 {
+			return nil, ErrInvalidMessageSizeLimit
+		}
+
+		limits.perDirective[directive] = limit
+	}
+
+	return limits, nil
+}
+
+func (l *MessageSizeLimits) limit(directive string) int {
+	if limit, exists := l.perDirective[directive]; exists {
+		return limit
+	}
+
+	return l.defaultLimit
+}
+
+// directiveLabel keeps the cardinality of the directive label bounded.  Any directive
+// can be sent so only the directives that have their own limit are used as is.
+func (l *MessageSizeLimits) directiveLabel(directive string) string {
+	if _, exists := l.perDirective[directive]; exists {
+		return directive
+	}
+	return "other"
+}
+
+// check returns a controller.MessageTooLargeError if the marshaled payload is larger
+// than the directive's size limit.  The check is done before publishing so that the
+// broker does not reject the message part way through a chunked publish.  The size is
+// not checked when the limits are nil.
+func (l *MessageSizeLimits) check(directive string, payload interface{}) error {
+	if l == nil {
+		return nil
+	}
+
+	limit := l.limit(directive)
+	if limit <= 0 {
+		return nil
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	if len(payloadBytes) <= limit {
+		return nil
+	}
+
+	logger.Log.WithFields(logrus.Fields{"directive": directive, "size": len(payloadBytes), "limit": limit}).Warn("Rejecting an oversized data message")
+	l.metrics.oversizedDataMessageCounter.WithLabelValues(l.directiveLabel(directive)).Inc()
+
+	return &controller.MessageTooLargeError{Directive: directive, Size: len(payloadBytes), Limit: limit}
+}
@@ -0,0 +1,93 @@
+package mqtt
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNewMessageSizeLimits(t *testing.T) {
+	limits, err := NewMessageSizeLimits(100, map[string]string{"playbook": "1000", "unlimited": "0"}, metrics)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	for directive, expected := range map[string]int{"playbook": 1000, "unlimited": 0, "other": 100} {
+		if actual := limits.limit(directive); actual != expected {
+			t.Fatalf("Expected the limit of %s to be %d, got %d", directive, expected, actual)
+		}
+	}
+
+	if _, err := NewMessageSizeLimits(100, map[string]string{"playbook": "big"}, metrics); err != ErrInvalidMessageSizeLimit {
+		t.Fatalf("Expected %v, got %v", ErrInvalidMessageSizeLimit, err)
+	}
+
+	if _, err := NewMessageSizeLimits(-1, nil, metrics); err != ErrInvalidMessageSizeLimit {
+		t.Fatalf("Expected %v, got %v", ErrInvalidMessageSizeLimit, err)
+	}
+}
+
+func TestSendDataMessageRejectsOversizedPayloads(t *testing.T) {
+	limits, _ := NewMessageSizeLimits(0, map[string]string{"playbook": "16"}, metrics)
+
+	client := &publishRecordingClient{}
+	sender := NewDataMessageSender(client, NewTopicBuilder(), 0, WithMessageSizeLimits(limits))
+
+	rejected := testutil.ToFloat64(metrics.oversizedDataMessageCounter.WithLabelValues("playbook"))
+
+	_, err := sender.SendDataMessage(context.TODO(), "client-1", "playbook", strings.Repeat("a", 32))
+
+	tooLarge, ok := err.(*controller.MessageTooLargeError)
+	if ok == false {
+		t.Fatalf("Expected a MessageTooLargeError, got %v", err)
+	}
+
+	if tooLarge.Directive != "playbook" || tooLarge.Size != 34 || tooLarge.Limit != 16 {
+		t.Fatalf("Unexpected error details: %+v", tooLarge)
+	}
+
+	if len(client.published) != 0 {
+		t.Fatalf("Expected the oversized message to not be published, got %d messages", len(client.published))
+	}
+
+	if testutil.ToFloat64(metrics.oversizedDataMessageCounter.WithLabelValues("playbook")) != rejected+1 {
+		t.Fatal("Expected the rejected message to be counted")
+	}
+
+	// Other directives are not limited
+	if _, err := sender.SendDataMessage(context.TODO(), "client-1", "catalog", strings.Repeat("a", 32)); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+}
+
+func TestPreviewMessageRejectsOversizedPayloads(t *testing.T) {
+	limits, _ := NewMessageSizeLimits(16, nil, metrics)
+
+	proxy := &ReceptorMQTTProxy{ClientID: "client-1", Client: &publishRecordingClient{}, SizeLimits: limits}
+
+	if _, _, err := proxy.PreviewMessage(context.TODO(), "1234", "client-1", strings.Repeat("a", 32), "playbook"); err == nil {
+		t.Fatal("Expected the oversized message to be rejected")
+	}
+
+	if _, _, err := proxy.PreviewMessage(context.TODO(), "1234", "client-1", "small", "playbook"); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+}
+
+func TestOversizedDataMessageDirectiveLabelIsBounded(t *testing.T) {
+	limits, _ := NewMessageSizeLimits(16, map[string]string{"playbook": "16"}, metrics)
+
+	other := testutil.ToFloat64(metrics.oversizedDataMessageCounter.WithLabelValues("other"))
+
+	if err := limits.check("made-up-directive", strings.Repeat("a", 32)); err == nil {
+		t.Fatal("Expected the oversized message to be rejected")
+	}
+
+	if testutil.ToFloat64(metrics.oversizedDataMessageCounter.WithLabelValues("other")) != other+1 {
+		t.Fatal("Expected the directive without its own limit to be counted as other")
+	}
+}
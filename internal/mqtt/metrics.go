@@ -0,0 +1,194 @@
+package mqtt
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+type Metrics struct {
+	reconnectScheduledDelay                 prometheus.Histogram
+	reconnectScheduledEventCounter          *prometheus.CounterVec
+	dispatcherChangeCounter                 *prometheus.CounterVec
+	sourcesRegistrationCounter              *prometheus.CounterVec
+	unverifiableTopicCounter                *prometheus.CounterVec
+	throttleCommandCounter                  prometheus.Counter
+	debouncedOnlineMessageCounter           prometheus.Counter
+	rejectedClientCounter                   *prometheus.CounterVec
+	downstreamTimeoutCounter                *prometheus.CounterVec
+	slowConsumerGauge                       prometheus.Gauge
+	inventoryRecordSkippedCounter           *prometheus.CounterVec
+	invalidCanonicalFactsCounter            prometheus.Counter
+	messageHandlerPanicCounter              prometheus.Counter
+	staleControlMessageCounter              *prometheus.CounterVec
+	duplicateOnlineMessageCounter           *prometheus.CounterVec
+	unexpectedControlMessageContentCounter  *prometheus.CounterVec
+	unverifiedControlMessageCounter         *prometheus.CounterVec
+	unsupportedControlMessageVersionCounter *prometheus.CounterVec
+	oversizedControlMessageCounter          prometheus.Counter
+	oversizedDataMessageCounter             *prometheus.CounterVec
+	brokerConnectedGauge                    *prometheus.GaugeVec
+	subscriptionGauge                       prometheus.Gauge
+	unexpectedConnectionLostCounter         prometheus.Counter
+	lastConnectionLostTimestamp             prometheus.Gauge
+	pendingCommandGauge                     prometheus.Gauge
+	ephemeralHostDeletedCounter             prometheus.Counter
+	controlMessageProcessingDuration        *prometheus.HistogramVec
+	clientEventCounter                      *prometheus.CounterVec
+	deliveryConfirmationCounter             *prometheus.CounterVec
+}
+
+// NewMetrics creates the metrics and registers them with the registerer.  The instance
+// is passed to the types that record the metrics.  Tests can pass their own registry so
+// that the metrics start at zero and do not clash with the other instances.
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	metrics := new(Metrics)
+	factory := promauto.With(reg)
+
+	metrics.reconnectScheduledDelay = factory.NewHistogram(prometheus.HistogramOpts{
+		Name:    "cloud_connector_reconnect_scheduled_delay_seconds",
+		Help:    "The reconnect delay that clients have reported they will honor",
+		Buckets: []float64{0, 1, 5, 10, 30, 60, 120, 300, 600},
+	})
+
+	metrics.reconnectScheduledEventCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_reconnect_scheduled_event_count",
+		Help: "The number of reconnect-scheduled events received from clients",
+	}, []string{"honored"})
+
+	metrics.dispatcherChangeCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_dispatcher_change_count",
+		Help: "The number of dispatchers gained or lost by clients between connections",
+	}, []string{"dispatcher", "change"})
+
+	metrics.sourcesRegistrationCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_sources_registration_count",
+		Help: "The outcome of processing the dispatchers reported by clients",
+	}, []string{"result"})
+
+	metrics.unverifiableTopicCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_unverifiable_topic_count",
+		Help: "The number of messages received on topics that could not be verified",
+	}, []string{"handling"})
+
+	metrics.throttleCommandCounter = factory.NewCounter(prometheus.CounterOpts{
+		Name: "cloud_connector_throttle_command_count",
+		Help: "The number of throttle commands sent to clients",
+	})
+
+	metrics.debouncedOnlineMessageCounter = factory.NewCounter(prometheus.CounterOpts{
+		Name: "cloud_connector_debounced_online_message_count",
+		Help: "The number of online messages that were coalesced with a pending online message",
+	})
+
+	metrics.rejectedClientCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_rejected_client_count",
+		Help: "The number of client handshakes that were rejected",
+	}, []string{"reason"})
+
+	metrics.downstreamTimeoutCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_control_message_downstream_timeout_count",
+		Help: "The number of downstream calls that were cancelled because the control message processing timeout was exceeded",
+	}, []string{"call"})
+
+	metrics.slowConsumerGauge = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "cloud_connector_slow_consumer",
+		Help: "Set to 1 when the control message handler is not keeping up with the rate that messages arrive",
+	})
+
+	metrics.inventoryRecordSkippedCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_inventory_record_skipped_count",
+		Help: "The number of inventory records skipped because the canonical facts did not meet the reporter's requirements",
+	}, []string{"reporter"})
+
+	metrics.invalidCanonicalFactsCounter = factory.NewCounter(prometheus.CounterOpts{
+		Name: "cloud_connector_invalid_canonical_facts_count",
+		Help: "The number of inventory records skipped because the canonical facts were malformed",
+	})
+
+	metrics.messageHandlerPanicCounter = factory.NewCounter(prometheus.CounterOpts{
+		Name: "cloud_connector_message_handler_panic_count",
+		Help: "The number of panics recovered while handling MQTT messages",
+	})
+
+	metrics.staleControlMessageCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_stale_control_message_count",
+		Help: "The number of control messages dropped because they were older than the max message age",
+	}, []string{"type"})
+
+	metrics.duplicateOnlineMessageCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_duplicate_online_message_count",
+		Help: "The number of duplicate online connection-status messages that were not handled",
+	}, []string{"reason"})
+
+	metrics.unexpectedControlMessageContentCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_unexpected_control_message_content_count",
+		Help: "The number of control messages that contained fields that cloud-connector does not recognize",
+	}, []string{"type"})
+
+	metrics.unsupportedControlMessageVersionCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_unsupported_control_message_version_count",
+		Help: "The number of control messages dropped because their version is not supported",
+	}, []string{"type", "version"})
+
+	metrics.unverifiedControlMessageCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_unverified_control_message_count",
+		Help: "The number of control messages dropped because their signature was missing or invalid",
+	}, []string{"reason"})
+
+	metrics.oversizedControlMessageCounter = factory.NewCounter(prometheus.CounterOpts{
+		Name: "cloud_connector_oversized_control_message_count",
+		Help: "The number of control messages dropped because they were larger than the max message size",
+	})
+
+	metrics.oversizedDataMessageCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_oversized_data_message_count",
+		Help: "The number of data messages that were not sent because the payload exceeded the directive's size limit",
+	}, []string{"directive"})
+
+	metrics.brokerConnectedGauge = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cloud_connector_mqtt_broker_connected",
+		Help: "Whether the MQTT client is connected to the broker (1) or not (0)",
+	}, []string{"client_id"})
+
+	metrics.subscriptionGauge = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "cloud_connector_mqtt_subscription_count",
+		Help: "The number of topics that the MQTT client has subscribed to",
+	})
+
+	metrics.unexpectedConnectionLostCounter = factory.NewCounter(prometheus.CounterOpts{
+		Name: "cloud_connector_mqtt_unexpected_connection_lost_count",
+		Help: "The number of times the connection to the MQTT broker was unexpectedly lost",
+	})
+
+	metrics.lastConnectionLostTimestamp = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "cloud_connector_mqtt_last_connection_lost_timestamp_seconds",
+		Help: "The time the connection to the MQTT broker was last lost",
+	})
+
+	metrics.pendingCommandGauge = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "cloud_connector_pending_command_count",
+		Help: "The number of commands sent to clients that are waiting for the client to respond",
+	})
+
+	metrics.ephemeralHostDeletedCounter = factory.NewCounter(prometheus.CounterOpts{
+		Name: "cloud_connector_ephemeral_host_deleted_count",
+		Help: "The number of ephemeral hosts deleted from inventory when the client went offline",
+	})
+
+	metrics.controlMessageProcessingDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "cloud_connector_control_message_processing_duration_seconds",
+		Help: "The time taken to handle control messages",
+	}, []string{"message_type", "outcome"})
+
+	metrics.clientEventCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_client_event_count",
+		Help: "The number of events reported by clients",
+	}, []string{"result"})
+
+	metrics.deliveryConfirmationCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_data_message_delivery_confirmation_count",
+		Help: "The number of data message delivery confirmations by result",
+	}, []string{"result"})
+
+	return metrics
+}
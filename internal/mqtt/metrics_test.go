@@ -0,0 +1,16 @@
+package mqtt
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metrics is the instance that the tests pass to the handlers.  It is registered with
+// its own registry so that it does not clash with the instances created by the tests.
+var metrics = NewMetrics(prometheus.NewRegistry())
+
+func TestMetricsCanBeRegisteredMoreThanOnce(t *testing.T) {
+	NewMetrics(prometheus.NewRegistry())
+	NewMetrics(prometheus.NewRegistry())
+}
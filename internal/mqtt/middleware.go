@@ -0,0 +1,84 @@
+package mqtt
+
+import (
+	"errors"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	RecoverMiddleware      = "recover"
+	BackpressureMiddleware = "backpressure"
+	WorkerPoolMiddleware   = "worker_pool"
+)
+
+var ErrInvalidMessageHandlerMiddleware = errors.New("Invalid message handler middleware")
+
+// MessageHandlerMiddleware wraps a message handler in order to add behavior
+// (metrics, rate limiting, etc) that is not specific to the type of message.
+// A middleware can short-circuit the processing of a message by not calling
+// the next handler.
+type MessageHandlerMiddleware func(next MQTT.MessageHandler) MQTT.MessageHandler
+
+// ChainMessageHandler wraps the handler with the middlewares.  The first middleware
+// is the outermost, so it sees the message first.
+func ChainMessageHandler(handler MQTT.MessageHandler, middlewares ...MessageHandlerMiddleware) MQTT.MessageHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// buildMessageHandlerChain looks up the middlewares by name, preserving the order of the names
+func buildMessageHandlerChain(names []string, available map[string]MessageHandlerMiddleware) ([]MessageHandlerMiddleware, error) {
+	chain := make([]MessageHandlerMiddleware, 0, len(names))
+
+	for _, name := range names {
+		middleware, found := available[name]
+		if found == false {
+			logger.Log.WithFields(logrus.Fields{"middleware": name}).Error("Unknown message handler middleware")
+			return nil, ErrInvalidMessageHandlerMiddleware
+		}
+		chain = append(chain, middleware)
+	}
+
+	return chain, nil
+}
+
+// recoverMiddleware keeps a panic in the handler from taking down the MQTT client's
+// message processing
+func recoverMiddleware(metrics *Metrics) MessageHandlerMiddleware {
+	return func(next MQTT.MessageHandler) MQTT.MessageHandler {
+		return func(client MQTT.Client, message MQTT.Message) {
+			defer func() {
+				if r := recover(); r != nil {
+					logger.Log.WithFields(logrus.Fields{"topic": message.Topic(), "panic": r}).Error("Recovered from a panic while handling a message")
+					metrics.messageHandlerPanicCounter.Inc()
+				}
+			}()
+
+			next(client, message)
+		}
+	}
+}
+
+func backpressureMiddleware(backpressure *backpressureMonitor, topicBuilder *TopicBuilder, signer MessageSigner, timestampFormat string, throttleInterval int, metrics *Metrics) MessageHandlerMiddleware {
+	return func(next MQTT.MessageHandler) MQTT.MessageHandler {
+		return func(client MQTT.Client, message MQTT.Message) {
+			// Messages on unverifiable topics are left for the handler to deal with
+			if clientID, err := verifyTopic(message.Topic()); err == nil {
+				if clientsToThrottle := backpressure.recordMessage(clientID, time.Now()); len(clientsToThrottle) > 0 {
+					logger.Log.WithFields(logrus.Fields{"throttled_clients": clientsToThrottle}).Warn("Message threshold exceeded, throttling the noisiest clients")
+					throttleClients(client, topicBuilder, signer, timestampFormat, clientsToThrottle, throttleInterval, metrics)
+				}
+			}
+
+			next(client, message)
+		}
+	}
+}
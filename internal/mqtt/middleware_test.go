@@ -0,0 +1,154 @@
+package mqtt
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type testMessage struct {
+	MQTT.Message
+	topic   string
+	payload []byte
+}
+
+func (m testMessage) Topic() string   { return m.topic }
+func (m testMessage) Payload() []byte { return m.payload }
+
+func recordingMiddleware(name string, calls *[]string) MessageHandlerMiddleware {
+	return func(next MQTT.MessageHandler) MQTT.MessageHandler {
+		return func(client MQTT.Client, message MQTT.Message) {
+			*calls = append(*calls, name)
+			next(client, message)
+		}
+	}
+}
+
+func shortCircuitMiddleware(calls *[]string) MessageHandlerMiddleware {
+	return func(next MQTT.MessageHandler) MQTT.MessageHandler {
+		return func(client MQTT.Client, message MQTT.Message) {
+			*calls = append(*calls, "short-circuit")
+		}
+	}
+}
+
+func TestMessageHandlerChainOrdering(t *testing.T) {
+	var calls []string
+
+	handler := ChainMessageHandler(
+		func(MQTT.Client, MQTT.Message) { calls = append(calls, "handler") },
+		recordingMiddleware("first", &calls),
+		recordingMiddleware("second", &calls))
+
+	handler(nil, testMessage{topic: "redhat/insights/client-1/control/out"})
+
+	expected := []string{"first", "second", "handler"}
+	if reflect.DeepEqual(calls, expected) == false {
+		t.Fatalf("Expected calls %v, got %v", expected, calls)
+	}
+}
+
+func TestMessageHandlerChainShortCircuit(t *testing.T) {
+	var calls []string
+
+	handler := ChainMessageHandler(
+		func(MQTT.Client, MQTT.Message) { calls = append(calls, "handler") },
+		recordingMiddleware("first", &calls),
+		shortCircuitMiddleware(&calls),
+		recordingMiddleware("third", &calls))
+
+	handler(nil, testMessage{topic: "redhat/insights/client-1/control/out"})
+
+	expected := []string{"first", "short-circuit"}
+	if reflect.DeepEqual(calls, expected) == false {
+		t.Fatalf("Expected calls %v, got %v", expected, calls)
+	}
+}
+
+func TestBuildMessageHandlerChain(t *testing.T) {
+	var calls []string
+
+	available := map[string]MessageHandlerMiddleware{
+		"a": recordingMiddleware("a", &calls),
+		"b": recordingMiddleware("b", &calls),
+	}
+
+	chain, err := buildMessageHandlerChain([]string{"b", "a"}, available)
+	if err != nil {
+		t.Fatalf("Unexpected error building the chain: %s", err)
+	}
+
+	ChainMessageHandler(func(MQTT.Client, MQTT.Message) {}, chain...)(nil, testMessage{})
+
+	if reflect.DeepEqual(calls, []string{"b", "a"}) == false {
+		t.Fatalf("Expected the chain to follow the configured order, got %v", calls)
+	}
+
+	if _, err := buildMessageHandlerChain([]string{"a", "fred"}, available); err != ErrInvalidMessageHandlerMiddleware {
+		t.Fatalf("Expected an unknown middleware to be rejected, got %v", err)
+	}
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	metrics := NewMetrics(prometheus.NewRegistry())
+	handler := recoverMiddleware(metrics)(func(MQTT.Client, MQTT.Message) { panic("boom") })
+
+	handler(nil, testMessage{topic: "redhat/insights/client-1/control/out"})
+
+	if panics := testutil.ToFloat64(metrics.messageHandlerPanicCounter); panics != 1 {
+		t.Fatalf("Expected the panic to be counted, got %v", panics)
+	}
+}
+
+func TestDefaultMessageHandlerChainRecoversPanicsInTheWorkerPool(t *testing.T) {
+	cfg := config.GetConfig()
+	metrics := NewMetrics(prometheus.NewRegistry())
+	inFlight := NewInFlightMessageTracker()
+
+	chain, err := buildMessageHandlerChain(cfg.MqttMessageHandlerMiddlewares, map[string]MessageHandlerMiddleware{
+		RecoverMiddleware:      recoverMiddleware(metrics),
+		BackpressureMiddleware: backpressureMiddleware(newBackpressureMonitor(0, time.Minute, 0), NewTopicBuilder(), nil, TimestampFormatRFC3339, 300, metrics),
+		WorkerPoolMiddleware:   workerPoolMiddleware(1, cfg.MqttMessageWorkerQueueSize, inFlight),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error building the default chain: %s", err)
+	}
+
+	handler := ChainMessageHandler(func(MQTT.Client, MQTT.Message) { panic("boom") }, chain...)
+
+	handler(nil, testMessage{topic: "redhat/insights/client-1/control/out"})
+
+	if inFlight.Wait(time.Second) == false {
+		t.Fatalf("Expected the message to be handled by the worker pool")
+	}
+
+	if panics := testutil.ToFloat64(metrics.messageHandlerPanicCounter); panics != 1 {
+		t.Fatalf("Expected the panic in the worker to be recovered, got %v panics", panics)
+	}
+}
+
+func TestBackpressureMiddleware(t *testing.T) {
+	client := &publishRecordingClient{}
+	backpressure := newBackpressureMonitor(1, time.Minute, 1)
+
+	handled := 0
+	handler := backpressureMiddleware(backpressure, NewTopicBuilder(), nil, TimestampFormatRFC3339, 300, metrics)(func(MQTT.Client, MQTT.Message) { handled++ })
+
+	handler(client, testMessage{topic: "redhat/insights/client-1/control/out"})
+	handler(client, testMessage{topic: "redhat/insights/client-1/control/out"})
+	handler(client, testMessage{topic: "not/a/valid/topic"})
+
+	if handled != 3 {
+		t.Fatalf("Expected every message to be passed to the handler, got %d", handled)
+	}
+
+	if len(client.published) != 1 || client.published[0].topic != "redhat/insights/client-1/control/in" {
+		t.Fatalf("Expected the client to be throttled, got %+v", client.published)
+	}
+}
@@ -0,0 +1,170 @@
+package mqtt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+const (
+	duplicateReasonMessageID = "message_id"
+	duplicateReasonContent   = "content"
+)
+
+type clientLock struct {
+	sync.Mutex
+	refs int
+}
+
+// onlineMessageGuard makes sure that only one online message is handled at a time
+// for each client.  The message id of the last online message that was handled
+// successfully is recorded in the processed message store so that a duplicate of
+// the message (a redelivery for example) is not handled a second time.  The hash of
+// the message's content is recorded too.  A message with a different id, but the same
+// content, is also skipped if it arrives within the duplicate window (a retained
+// handshake that is republished by the client for example).  The per-client locks are
+// removed once they are no longer in use.
+type onlineMessageGuard struct {
+	locks           map[domain.ClientID]*clientLock
+	processed       ProcessedMessageStore
+	duplicateWindow time.Duration
+	metrics         *Metrics
+	sync.Mutex
+}
+
+// newOnlineMessageGuard creates the guard.  A duplicateWindow of zero disables the
+// content check.
+func newOnlineMessageGuard(processed ProcessedMessageStore, duplicateWindow time.Duration, metrics *Metrics) *onlineMessageGuard {
+	return &onlineMessageGuard{
+		locks:           make(map[domain.ClientID]*clientLock),
+		processed:       processed,
+		duplicateWindow: duplicateWindow,
+		metrics:         metrics,
+	}
+}
+
+// handle calls the handler while holding the client's lock.  The handler is not
+// called if the message has already been handled.  The returned bool indicates
+// whether or not the handler was called.
+func (g *onlineMessageGuard) handle(clientID domain.ClientID, messageID string, contentHash string, handler func() error) (bool, error) {
+	lock := g.acquire(clientID)
+	defer g.release(clientID, lock)
+
+	if duplicate, reason := g.isDuplicate(clientID, messageID, contentHash, time.Now()); duplicate {
+		g.metrics.duplicateOnlineMessageCounter.WithLabelValues(reason).Inc()
+		return false, nil
+	}
+
+	if err := handler(); err != nil {
+		return true, err
+	}
+
+	g.recordHandled(clientID, messageID, contentHash, time.Now())
+
+	return true, nil
+}
+
+func (g *onlineMessageGuard) acquire(clientID domain.ClientID) *clientLock {
+	g.Lock()
+	lock, found := g.locks[clientID]
+	if found == false {
+		lock = &clientLock{}
+		g.locks[clientID] = lock
+	}
+	lock.refs++
+	g.Unlock()
+
+	lock.Lock()
+
+	return lock
+}
+
+func (g *onlineMessageGuard) release(clientID domain.ClientID, lock *clientLock) {
+	lock.Unlock()
+
+	g.Lock()
+	defer g.Unlock()
+
+	lock.refs--
+	if lock.refs == 0 {
+		delete(g.locks, clientID)
+	}
+}
+
+func (g *onlineMessageGuard) alreadyHandled(clientID domain.ClientID, messageID string, now time.Time) bool {
+	duplicate, reason := g.isDuplicate(clientID, messageID, "", now)
+	return duplicate && reason == duplicateReasonMessageID
+}
+
+// isDuplicate determines if the message has already been handled and why it is
+// considered a duplicate.  The content check applies to the messages without a
+// message id too.
+func (g *onlineMessageGuard) isDuplicate(clientID domain.ClientID, messageID string, contentHash string, now time.Time) (bool, string) {
+	if messageID == "" && contentHash == "" {
+		return false, ""
+	}
+
+	last, found := g.processed.LastProcessed(clientID, now)
+	if found == false {
+		return false, ""
+	}
+
+	if messageID != "" && last.MessageID == messageID {
+		return true, duplicateReasonMessageID
+	}
+
+	if g.duplicateWindow > 0 && contentHash != "" && last.ContentHash == contentHash && now.Sub(last.Processed) < g.duplicateWindow {
+		return true, duplicateReasonContent
+	}
+
+	return false, ""
+}
+
+func (g *onlineMessageGuard) recordHandled(clientID domain.ClientID, messageID string, contentHash string, now time.Time) {
+	if messageID == "" && contentHash == "" {
+		return
+	}
+
+	g.processed.MarkProcessed(clientID, messageID, contentHash, now)
+}
+
+// clearContent keeps the id of the last online message that was handled for the client,
+// but forgets its content so that the client's next online message is handled even if
+// its content has not changed.  It is called when the client goes offline.
+func (g *onlineMessageGuard) clearContent(clientID domain.ClientID) {
+	lock := g.acquire(clientID)
+	defer g.release(clientID, lock)
+
+	if last, found := g.processed.LastProcessed(clientID, time.Now()); found && last.ContentHash != "" {
+		g.processed.MarkProcessed(clientID, last.MessageID, "", last.Processed)
+	}
+}
+
+// hashControlMessageContent returns the hash of the message's content.  The content is
+// marshalled with sorted keys so the hash does not depend on the order of the fields.
+// An empty hash is returned if the content cannot be marshalled.
+func hashControlMessageContent(content interface{}) string {
+	contentBytes, err := json.Marshal(content)
+	if err != nil {
+		return ""
+	}
+
+	hash := sha256.Sum256(contentBytes)
+
+	return hex.EncodeToString(hash[:])
+}
+
+// lastHandled returns the last online message that was handled for the client
+func (g *onlineMessageGuard) lastHandled(clientID domain.ClientID, now time.Time) (ProcessedMessage, bool) {
+	return g.processed.LastProcessed(clientID, now)
+}
+
+// forget discards the last online message that was handled for the client so that
+// a redelivery of the message is handled again
+func (g *onlineMessageGuard) forget(clientID domain.ClientID) {
+	g.processed.Forget(clientID)
+}
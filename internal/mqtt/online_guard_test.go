@@ -0,0 +1,212 @@
+package mqtt
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/config"
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+
+	"github.com/alicebob/miniredis"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type countingRegistrar struct {
+	controller.ConnectionRegistrar
+	registrations int
+	sync.Mutex
+}
+
+func (cr *countingRegistrar) Register(ctx context.Context, account string, nodeID string, client controller.Receptor) error {
+	cr.Lock()
+	cr.registrations++
+	cr.Unlock()
+
+	// Widen the window in which concurrent handshakes could overlap
+	time.Sleep(10 * time.Millisecond)
+
+	return cr.ConnectionRegistrar.Register(ctx, account, nodeID, client)
+}
+
+func TestConcurrentOnlineMessagesRegisterOnce(t *testing.T) {
+	cfg := config.GetConfig()
+
+	client := &publishRecordingClient{}
+	registrar := &countingRegistrar{ConnectionRegistrar: controller.NewLocalConnectionManager()}
+	lastErrors := controller.NewLastErrorTracker(10, time.Minute)
+	dispatcherChanges, _ := newTestDispatcherChangeHandler(t, "ignore")
+	resolver := &staticAccountResolver{account: "1234"}
+	guard := newOnlineMessageGuard(NewLocalProcessedMessageStore(time.Minute), 0, metrics)
+
+	msg := unmarshalControlMessage(t, onlineHandshake)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			deps := newTestControlMessageDeps(registrar, resolver, dispatcherChanges)
+			deps.onlineGuard = guard
+			deps.lastErrors = lastErrors
+			err := handleConnectionStatusMessage(context.Background(), client, "client-1", msg, cfg, deps, metrics)
+			if err != nil {
+				t.Errorf("Unexpected error handling the online message: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if registrar.registrations != 1 {
+		t.Fatalf("Expected the client to be registered once, got %d registrations", registrar.registrations)
+	}
+
+	if len(guard.locks) != 0 {
+		t.Fatalf("Expected the client locks to be released, got %d", len(guard.locks))
+	}
+}
+
+func TestOnlineMessageGuard(t *testing.T) {
+	guard := newOnlineMessageGuard(NewLocalProcessedMessageStore(time.Minute), 0, metrics)
+
+	calls := 0
+	handler := func() error { calls++; return nil }
+
+	guard.handle("client-1", "message-1", "", handler)
+	guard.handle("client-1", "message-1", "", handler)
+	if calls != 1 {
+		t.Fatalf("Expected a duplicate message to be skipped, got %d calls", calls)
+	}
+
+	guard.handle("client-1", "message-2", "", handler)
+	guard.handle("client-2", "message-1", "", handler)
+	if calls != 3 {
+		t.Fatalf("Expected new messages to be handled, got %d calls", calls)
+	}
+
+	guard.handle("client-3", "", "", handler)
+	guard.handle("client-3", "", "", handler)
+	if calls != 5 {
+		t.Fatalf("Expected messages without a message id to always be handled, got %d calls", calls)
+	}
+}
+
+func TestOnlineMessageGuardExpires(t *testing.T) {
+	processed := NewLocalProcessedMessageStore(time.Minute)
+	guard := newOnlineMessageGuard(processed, 0, metrics)
+
+	now := time.Now()
+	guard.recordHandled("client-1", "message-1", "", now.Add(-2*time.Minute))
+
+	if guard.alreadyHandled("client-1", "message-1", now) {
+		t.Fatalf("Expected the handled message to expire")
+	}
+
+	guard.recordHandled("client-2", "message-1", "", now)
+	if len(processed.processed) != 1 {
+		t.Fatalf("Expected the expired message ids to be removed, got %d", len(processed.processed))
+	}
+}
+
+func TestOnlineMessageReplayedAfterRestartHasSingleEffect(t *testing.T) {
+	cfg := config.GetConfig()
+
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Unable to start miniredis: %s", err)
+	}
+	defer server.Close()
+
+	registrar := &countingRegistrar{ConnectionRegistrar: controller.NewLocalConnectionManager()}
+
+	// Each consumer has its own store, guard and handlers, like a consumer that has
+	// been restarted.  Only the markers that were written to redis are shared.
+	handle := func() {
+		processed := NewRedisProcessedMessageStore(controller.NewRedisClient(server.Addr(), "", 0), time.Minute)
+
+		dispatcherChanges, _ := newTestDispatcherChangeHandler(t, "ignore")
+		deps := newTestControlMessageDeps(registrar, &staticAccountResolver{account: "1234"}, dispatcherChanges)
+		deps.onlineGuard = newOnlineMessageGuard(processed, 0, metrics)
+		err := handleConnectionStatusMessage(context.Background(), &publishRecordingClient{}, "client-1", unmarshalControlMessage(t, onlineHandshake), cfg, deps, metrics)
+		if err != nil {
+			t.Fatalf("Unexpected error handling the online message: %s", err)
+		}
+	}
+
+	handle()
+	handle()
+
+	if registrar.registrations != 1 {
+		t.Fatalf("Expected the client to be registered once, got %d registrations", registrar.registrations)
+	}
+}
+
+func TestOnlineMessageGuardSuppressesDuplicateContent(t *testing.T) {
+	guard := newOnlineMessageGuard(NewLocalProcessedMessageStore(time.Minute), 10*time.Second, metrics)
+
+	calls := 0
+	handler := func() error { calls++; return nil }
+
+	suppressedBefore := testutil.ToFloat64(metrics.duplicateOnlineMessageCounter.WithLabelValues(duplicateReasonContent))
+
+	guard.handle("client-1", "message-1", "hash-1", handler)
+	guard.handle("client-1", "message-2", "hash-1", handler)
+	if calls != 1 {
+		t.Fatalf("Expected a message with duplicate content to be skipped, got %d calls", calls)
+	}
+
+	if delta := testutil.ToFloat64(metrics.duplicateOnlineMessageCounter.WithLabelValues(duplicateReasonContent)) - suppressedBefore; delta != 1 {
+		t.Fatalf("Expected the suppressed duplicate to be counted, got %v", delta)
+	}
+
+	guard.handle("client-1", "message-3", "hash-2", handler)
+	if calls != 2 {
+		t.Fatalf("Expected a message with new content to be handled, got %d calls", calls)
+	}
+
+	guard.clearContent("client-1")
+	guard.handle("client-1", "message-4", "hash-2", handler)
+	if calls != 3 {
+		t.Fatalf("Expected a message to be handled after the client went offline, got %d calls", calls)
+	}
+
+	// Messages without a message id are still checked for duplicate content
+	guard.handle("client-2", "", "hash-1", handler)
+	guard.handle("client-2", "", "hash-1", handler)
+	if calls != 4 {
+		t.Fatalf("Expected a message without a message id and duplicate content to be skipped, got %d calls", calls)
+	}
+
+	guard.handle("client-2", "", "hash-2", handler)
+	if calls != 5 {
+		t.Fatalf("Expected a message without a message id and new content to be handled, got %d calls", calls)
+	}
+}
+
+func TestOnlineMessageGuardDuplicateWindow(t *testing.T) {
+	guard := newOnlineMessageGuard(NewLocalProcessedMessageStore(time.Minute), 10*time.Second, metrics)
+
+	now := time.Now()
+	guard.recordHandled("client-1", "message-1", "hash-1", now.Add(-20*time.Second))
+
+	if duplicate, _ := guard.isDuplicate("client-1", "message-2", "hash-1", now); duplicate {
+		t.Fatalf("Expected duplicate content outside of the window to be handled")
+	}
+
+	guard = newOnlineMessageGuard(NewLocalProcessedMessageStore(time.Minute), 0, metrics)
+	guard.recordHandled("client-1", "message-1", "hash-1", now)
+
+	if duplicate, _ := guard.isDuplicate("client-1", "message-2", "hash-1", now); duplicate {
+		t.Fatalf("Expected the content check to be disabled")
+	}
+}
+
+func TestHashControlMessageContent(t *testing.T) {
+	first := unmarshalControlMessage(t, `{"type": "connection-status", "message_id": "1", "content": {"state": "online", "canonical_facts": {"fqdn": "host"}}}`)
+	second := unmarshalControlMessage(t, `{"type": "connection-status", "message_id": "2", "content": {"canonical_facts": {"fqdn": "host"}, "state": "online"}}`)
+
+	if hashControlMessageContent(first.Content) != hashControlMessageContent(second.Content) {
+		t.Fatalf("Expected the hash to ignore the message id and the order of the fields")
+	}
+}
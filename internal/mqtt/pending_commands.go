@@ -0,0 +1,160 @@
+package mqtt
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+type pendingCommand struct {
+	ClientID domain.ClientID
+	Command  string
+	Delay    int
+	Sent     time.Time
+}
+
+// pendingCommandStore keeps track of the commands that have been sent to clients
+// so that the events the clients send in response can be correlated with the
+// original command.  Commands that have not been responded to within the ttl
+// are discarded.  Once the store holds maxCommands commands, the oldest command
+// is discarded to make room for a new one.  A maxCommands of zero does not limit
+// the number of commands.
+//
+// The commands are expired in the order that they were sent, so the expiration
+// queue is ordered by the time the command was sent.  Resolved commands are left in
+// the queue and skipped when they reach the front of it.
+type pendingCommandStore struct {
+	commands    map[string]pendingCommand
+	expirations pendingCommandQueue
+	ttl         time.Duration
+	maxCommands int
+	metrics     *Metrics
+	sync.Mutex
+}
+
+func newPendingCommandStore(ttl time.Duration, maxCommands int, metrics *Metrics) *pendingCommandStore {
+	return &pendingCommandStore{
+		commands:    make(map[string]pendingCommand),
+		ttl:         ttl,
+		maxCommands: maxCommands,
+		metrics:     metrics,
+	}
+}
+
+func (pcs *pendingCommandStore) add(messageID string, command pendingCommand) {
+	pcs.Lock()
+	defer pcs.Unlock()
+
+	now := time.Now()
+
+	pcs.expire(now)
+
+	if command.Sent.IsZero() {
+		command.Sent = now
+	}
+
+	if _, exists := pcs.commands[messageID]; exists == false {
+		if pcs.maxCommands > 0 && len(pcs.commands) >= pcs.maxCommands {
+			pcs.evictOldest()
+		}
+		pcs.metrics.pendingCommandGauge.Inc()
+	}
+
+	pcs.commands[messageID] = command
+	heap.Push(&pcs.expirations, pendingCommandExpiration{messageID: messageID, sent: command.Sent})
+
+	pcs.compact()
+}
+
+func (pcs *pendingCommandStore) resolve(messageID string) (pendingCommand, bool) {
+	pcs.Lock()
+	defer pcs.Unlock()
+
+	pcs.expire(time.Now())
+
+	command, exists := pcs.commands[messageID]
+	if exists {
+		delete(pcs.commands, messageID)
+		pcs.metrics.pendingCommandGauge.Dec()
+	}
+
+	return command, exists
+}
+
+func (pcs *pendingCommandStore) expire(now time.Time) {
+	for len(pcs.expirations) > 0 && now.Sub(pcs.expirations[0].sent) > pcs.ttl {
+		pcs.remove(heap.Pop(&pcs.expirations).(pendingCommandExpiration))
+	}
+}
+
+// evictOldest discards the command that was sent first
+func (pcs *pendingCommandStore) evictOldest() {
+	for len(pcs.expirations) > 0 {
+		if pcs.remove(heap.Pop(&pcs.expirations).(pendingCommandExpiration)) {
+			logger.Log.WithFields(logrus.Fields{"max_commands": pcs.maxCommands}).Debug("Discarding the oldest pending command to make room for a new one")
+			return
+		}
+	}
+}
+
+// remove discards the command if the expiration is for the command that is pending.
+// The command might have been resolved, or replaced by a command that was sent later.
+func (pcs *pendingCommandStore) remove(expiration pendingCommandExpiration) bool {
+	command, exists := pcs.commands[expiration.messageID]
+	if exists == false || command.Sent.Equal(expiration.sent) == false {
+		return false
+	}
+
+	delete(pcs.commands, expiration.messageID)
+	pcs.metrics.pendingCommandGauge.Dec()
+
+	return true
+}
+
+// compact rebuilds the expiration queue once most of its entries are for commands that
+// are no longer pending so that resolved commands do not pile up in the queue
+func (pcs *pendingCommandStore) compact() {
+	const minCompactionSize = 64
+
+	if len(pcs.expirations) < minCompactionSize || len(pcs.expirations) <= 2*len(pcs.commands) {
+		return
+	}
+
+	expirations := make(pendingCommandQueue, 0, len(pcs.commands))
+	for messageID, command := range pcs.commands {
+		expirations = append(expirations, pendingCommandExpiration{messageID: messageID, sent: command.Sent})
+	}
+
+	heap.Init(&expirations)
+	pcs.expirations = expirations
+}
+
+type pendingCommandExpiration struct {
+	messageID string
+	sent      time.Time
+}
+
+// pendingCommandQueue implements heap.Interface with the command that was sent first
+// at the front of the queue
+type pendingCommandQueue []pendingCommandExpiration
+
+func (q pendingCommandQueue) Len() int           { return len(q) }
+func (q pendingCommandQueue) Less(i, j int) bool { return q[i].sent.Before(q[j].sent) }
+func (q pendingCommandQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *pendingCommandQueue) Push(x interface{}) {
+	*q = append(*q, x.(pendingCommandExpiration))
+}
+
+func (q *pendingCommandQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	expiration := old[n-1]
+	*q = old[:n-1]
+	return expiration
+}
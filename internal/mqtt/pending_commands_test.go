@@ -0,0 +1,108 @@
+package mqtt
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPendingCommandGauge(t *testing.T) {
+	pendingCommands := newPendingCommandStore(time.Minute, 0, metrics)
+
+	// The gauge is shared by every pending command store, so verify the change in value
+	initial := testutil.ToFloat64(metrics.pendingCommandGauge)
+
+	verifyGauge := func(expected float64) {
+		t.Helper()
+		if actual := testutil.ToFloat64(metrics.pendingCommandGauge) - initial; actual != expected {
+			t.Fatalf("Expected %v pending commands, got %v", expected, actual)
+		}
+	}
+
+	pendingCommands.add("1234", pendingCommand{ClientID: "client-1", Command: reconnectCommand})
+	pendingCommands.add("5678", pendingCommand{ClientID: "client-2", Command: reconnectCommand})
+	verifyGauge(2)
+
+	// Adding the same message id again replaces the pending command
+	pendingCommands.add("1234", pendingCommand{ClientID: "client-1", Command: reconnectCommand})
+	verifyGauge(2)
+
+	pendingCommands.resolve("1234")
+	verifyGauge(1)
+
+	// Resolving an unknown message id does not change the gauge
+	pendingCommands.resolve("1234")
+	verifyGauge(1)
+
+	pendingCommands.expire(time.Now().Add(2 * time.Minute))
+	verifyGauge(0)
+}
+
+func TestPendingCommandStoreDiscardsTheOldestCommandWhenFull(t *testing.T) {
+	pendingCommands := newPendingCommandStore(time.Minute, 2, metrics)
+
+	now := time.Now()
+	pendingCommands.add("1234", pendingCommand{ClientID: "client-1", Command: reconnectCommand, Sent: now.Add(-2 * time.Second)})
+	pendingCommands.add("5678", pendingCommand{ClientID: "client-2", Command: reconnectCommand, Sent: now.Add(-1 * time.Second)})
+	pendingCommands.add("9012", pendingCommand{ClientID: "client-3", Command: reconnectCommand, Sent: now})
+
+	if _, found := pendingCommands.resolve("1234"); found {
+		t.Fatalf("Expected the oldest command to be discarded")
+	}
+
+	for _, messageID := range []string{"5678", "9012"} {
+		if _, found := pendingCommands.resolve(messageID); found == false {
+			t.Fatalf("Expected the command %s to still be pending", messageID)
+		}
+	}
+}
+
+func TestPendingCommandStoreExpiresInTheOrderSent(t *testing.T) {
+	pendingCommands := newPendingCommandStore(time.Minute, 0, metrics)
+
+	now := time.Now()
+	pendingCommands.add("late", pendingCommand{ClientID: "client-1", Sent: now.Add(-30 * time.Second)})
+	pendingCommands.add("early", pendingCommand{ClientID: "client-2", Sent: now.Add(-50 * time.Second)})
+
+	pendingCommands.Lock()
+	pendingCommands.expire(now.Add(20 * time.Second))
+	_, earlyPending := pendingCommands.commands["early"]
+	_, latePending := pendingCommands.commands["late"]
+	pendingCommands.Unlock()
+
+	if earlyPending || latePending == false {
+		t.Fatalf("Expected only the command sent first to expire")
+	}
+}
+
+func TestPendingCommandStoreDoesNotExpireReplacedCommand(t *testing.T) {
+	pendingCommands := newPendingCommandStore(time.Minute, 0, metrics)
+
+	now := time.Now()
+	pendingCommands.add("1234", pendingCommand{ClientID: "client-1", Sent: now.Add(-50 * time.Second)})
+	pendingCommands.add("1234", pendingCommand{ClientID: "client-1", Sent: now})
+
+	pendingCommands.Lock()
+	pendingCommands.expire(now.Add(20 * time.Second))
+	pendingCommands.Unlock()
+
+	if _, found := pendingCommands.resolve("1234"); found == false {
+		t.Fatalf("Expected the command that replaced the expired one to still be pending")
+	}
+}
+
+func TestPendingCommandStoreCompactsResolvedCommands(t *testing.T) {
+	pendingCommands := newPendingCommandStore(time.Minute, 0, metrics)
+
+	for i := 0; i < 1000; i++ {
+		messageID := fmt.Sprint(i)
+		pendingCommands.add(messageID, pendingCommand{ClientID: "client-1"})
+		pendingCommands.resolve(messageID)
+	}
+
+	if queued := len(pendingCommands.expirations); queued > 128 {
+		t.Fatalf("Expected the resolved commands to be removed from the expiration queue, got %d queued", queued)
+	}
+}
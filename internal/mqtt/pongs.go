@@ -0,0 +1,73 @@
+package mqtt
+
+import (
+	"sync"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+const pongEvent = "pong"
+
+type pongWaiter struct {
+	clientID domain.ClientID
+	pong     chan struct{}
+}
+
+// PongTracker correlates the pong events that clients publish in response to a ping
+// command with the ping that is waiting for them.  The pong's response_to field must
+// contain the message_id of the ping command.
+type PongTracker struct {
+	waiters map[string]pongWaiter
+	sync.Mutex
+}
+
+func NewPongTracker() *PongTracker {
+	return &PongTracker{
+		waiters: make(map[string]pongWaiter),
+	}
+}
+
+// expect registers a ping that is waiting for a pong.  The returned channel is closed
+// when the pong arrives.  The returned func must be called once the caller stops waiting.
+func (pt *PongTracker) expect(clientID domain.ClientID, messageID string) (<-chan struct{}, func()) {
+	pt.Lock()
+	defer pt.Unlock()
+
+	waiter := pongWaiter{clientID: clientID, pong: make(chan struct{})}
+	pt.waiters[messageID] = waiter
+
+	return waiter.pong, func() {
+		pt.Lock()
+		defer pt.Unlock()
+		delete(pt.waiters, messageID)
+	}
+}
+
+// resolve wakes up the ping that the pong is responding to.  It returns false if no
+// ping sent to the client is waiting for the pong.
+func (pt *PongTracker) resolve(clientID domain.ClientID, responseTo string) bool {
+	pt.Lock()
+	defer pt.Unlock()
+
+	waiter, found := pt.waiters[responseTo]
+	if found == false || waiter.clientID != clientID {
+		return false
+	}
+
+	close(waiter.pong)
+	delete(pt.waiters, responseTo)
+
+	return true
+}
+
+// isPongEvent determines if the event's content is a pong.  Clients send either the
+// bare "pong" string or an event object named pong.
+func isPongEvent(content interface{}) bool {
+	switch c := content.(type) {
+	case string:
+		return c == pongEvent
+	case map[string]interface{}:
+		return c["event"] == pongEvent
+	}
+	return false
+}
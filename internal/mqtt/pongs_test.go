@@ -0,0 +1,99 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+// pongingClient answers each ping by handing a pong to the connection handler
+type pongingClient struct {
+	MQTT.Client
+	pongs    *PongTracker
+	clientID domain.ClientID
+}
+
+func (c *pongingClient) Publish(topic string, qos byte, retained bool, payload interface{}) MQTT.Token {
+	var ping ControlMessage
+	json.Unmarshal(payload.([]byte), &ping)
+
+	pong := ControlMessage{MessageType: "event", MessageID: "pong-1", ResponseTo: ping.MessageID, Version: 1, Content: pongEvent}
+
+	go handleEventMessage(context.TODO(), nil, c.clientID, pong, controller.NewLocalConnectionManager(), newPendingCommandStore(time.Minute, 0, metrics), c.pongs, NewEventForwarder(nil, metrics), metrics)
+
+	return completedToken{}
+}
+
+func TestPingWaitsForPong(t *testing.T) {
+	pongs := NewPongTracker()
+	client := &pongingClient{pongs: pongs, clientID: "client-1"}
+	sender := NewControlMessageSender(client, NewTopicBuilder(), WithPongTracking(pongs, time.Second))
+
+	if err := sender.Ping(context.TODO(), "client-1"); err != nil {
+		t.Fatalf("Expected the pong to be received, got %s", err)
+	}
+
+	if len(pongs.waiters) != 0 {
+		t.Fatalf("Expected the ping to stop waiting once the pong was received")
+	}
+}
+
+func TestPingIgnoresPongFromAnotherClient(t *testing.T) {
+	pongs := NewPongTracker()
+	client := &pongingClient{pongs: pongs, clientID: "client-2"}
+	sender := NewControlMessageSender(client, NewTopicBuilder(), WithPongTracking(pongs, 20*time.Millisecond))
+
+	if err := sender.Ping(context.TODO(), "client-1"); errors.Is(err, controller.ErrClientUnreachable) == false {
+		t.Fatalf("Expected the client to be unreachable, got %v", err)
+	}
+}
+
+func TestPingWithoutPong(t *testing.T) {
+	client := &publishRecordingClient{}
+	sender := NewControlMessageSender(client, NewTopicBuilder(), WithPongTracking(NewPongTracker(), 10*time.Millisecond))
+
+	err := sender.Ping(context.TODO(), "client-1")
+	if errors.Is(err, controller.ErrClientUnreachable) == false {
+		t.Fatalf("Expected the client to be unreachable, got %v", err)
+	}
+
+	if len(client.published) != 1 || client.published[0].qos != 1 {
+		t.Fatalf("Expected the ping to be published with QoS 1, got %+v", client.published)
+	}
+}
+
+func TestPingPublishFailureIsNotUnreachable(t *testing.T) {
+	client := &tokenClient{token: failedToken{}}
+	sender := NewControlMessageSender(client, NewTopicBuilder(), WithPongTracking(NewPongTracker(), time.Second))
+
+	err := sender.Ping(context.TODO(), "client-1")
+	if err == nil || errors.Is(err, controller.ErrClientUnreachable) {
+		t.Fatalf("Expected the publish error to be returned, got %v", err)
+	}
+}
+
+func TestIsPongEvent(t *testing.T) {
+	var tests = []struct {
+		content  interface{}
+		expected bool
+	}{
+		{"pong", true},
+		{map[string]interface{}{"event": "pong"}, true},
+		{"disconnect", false},
+		{map[string]interface{}{"event": "reconnect-scheduled"}, false},
+		{nil, false},
+	}
+
+	for _, tc := range tests {
+		if isPongEvent(tc.content) != tc.expected {
+			t.Fatalf("Expected isPongEvent(%v) to be %t", tc.content, tc.expected)
+		}
+	}
+}
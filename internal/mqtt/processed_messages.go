@@ -0,0 +1,180 @@
+package mqtt
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/go-redis/redis"
+	"github.com/sirupsen/logrus"
+)
+
+var ErrInvalidProcessedMessageStore = errors.New("Invalid processed message store")
+
+// ProcessedMessage is the marker that is kept for the last online message that
+// was processed for a client
+type ProcessedMessage struct {
+	MessageID   string
+	ContentHash string
+	Processed   time.Time
+}
+
+// ProcessedMessageStore keeps the processed message markers that are used to avoid
+// handling the same online message more than once.  The markers expire after the
+// store's ttl.  The online messages are only handled once across consumers and
+// restarts if the consumers share a store that outlives them.
+type ProcessedMessageStore interface {
+	LastProcessed(clientID domain.ClientID, now time.Time) (ProcessedMessage, bool)
+	MarkProcessed(clientID domain.ClientID, messageID string, contentHash string, now time.Time)
+	Forget(clientID domain.ClientID)
+}
+
+type LocalProcessedMessageStore struct {
+	ttl       time.Duration
+	processed map[domain.ClientID]ProcessedMessage
+	sync.Mutex
+}
+
+func NewLocalProcessedMessageStore(ttl time.Duration) *LocalProcessedMessageStore {
+	return &LocalProcessedMessageStore{
+		ttl:       ttl,
+		processed: make(map[domain.ClientID]ProcessedMessage),
+	}
+}
+
+func (s *LocalProcessedMessageStore) LastProcessed(clientID domain.ClientID, now time.Time) (ProcessedMessage, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	last, found := s.processed[clientID]
+	if found == false || now.Sub(last.Processed) >= s.ttl {
+		return ProcessedMessage{}, false
+	}
+
+	return last, true
+}
+
+func (s *LocalProcessedMessageStore) MarkProcessed(clientID domain.ClientID, messageID string, contentHash string, now time.Time) {
+	if s.ttl <= 0 {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	for id, last := range s.processed {
+		if now.Sub(last.Processed) >= s.ttl {
+			delete(s.processed, id)
+		}
+	}
+
+	s.processed[clientID] = ProcessedMessage{MessageID: messageID, ContentHash: contentHash, Processed: now}
+}
+
+func (s *LocalProcessedMessageStore) Forget(clientID domain.ClientID) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.processed, clientID)
+}
+
+const (
+	redisProcessedMessageKeyPrefix = "cloud-connector:processed_online_message:"
+
+	redisProcessedMessageIDField   = "message_id"
+	redisProcessedContentHashField = "content_hash"
+	redisProcessedTimeField        = "processed"
+)
+
+// RedisProcessedMessageStore keeps the processed message markers in redis so that
+// they are shared by the consumers and survive a restart.  Each marker is stored as a
+// hash (keyed by client id) that expires with the marker.
+//
+// The guard treats a marker that cannot be read as missing, so a redis failure results
+// in the online message being handled again rather than being dropped.
+type RedisProcessedMessageStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func NewRedisProcessedMessageStore(client *redis.Client, ttl time.Duration) *RedisProcessedMessageStore {
+	return &RedisProcessedMessageStore{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+func redisProcessedMessageKey(clientID domain.ClientID) string {
+	return redisProcessedMessageKeyPrefix + string(clientID)
+}
+
+func (s *RedisProcessedMessageStore) LastProcessed(clientID domain.ClientID, now time.Time) (ProcessedMessage, bool) {
+	fields, err := s.client.HGetAll(redisProcessedMessageKey(clientID)).Result()
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{"clientID": clientID, "error": err}).Warn("Unable to read the processed online message")
+		return ProcessedMessage{}, false
+	}
+
+	processedNanos, err := strconv.ParseInt(fields[redisProcessedTimeField], 10, 64)
+	if err != nil {
+		// The marker does not exist or it is not one that was written by this store
+		return ProcessedMessage{}, false
+	}
+
+	last := ProcessedMessage{
+		MessageID:   fields[redisProcessedMessageIDField],
+		ContentHash: fields[redisProcessedContentHashField],
+		Processed:   time.Unix(0, processedNanos),
+	}
+
+	if now.Sub(last.Processed) >= s.ttl {
+		return ProcessedMessage{}, false
+	}
+
+	return last, true
+}
+
+func (s *RedisProcessedMessageStore) MarkProcessed(clientID domain.ClientID, messageID string, contentHash string, now time.Time) {
+	if s.ttl <= 0 {
+		return
+	}
+
+	key := redisProcessedMessageKey(clientID)
+
+	pipe := s.client.TxPipeline()
+	pipe.HMSet(key, map[string]interface{}{
+		redisProcessedMessageIDField:   messageID,
+		redisProcessedContentHashField: contentHash,
+		redisProcessedTimeField:        now.UnixNano(),
+	})
+	pipe.ExpireAt(key, now.Add(s.ttl))
+
+	if _, err := pipe.Exec(); err != nil {
+		logger.Log.WithFields(logrus.Fields{"clientID": clientID, "error": err}).Warn("Unable to record the processed online message")
+	}
+}
+
+func (s *RedisProcessedMessageStore) Forget(clientID domain.ClientID) {
+	if err := s.client.Del(redisProcessedMessageKey(clientID)).Err(); err != nil {
+		logger.Log.WithFields(logrus.Fields{"clientID": clientID, "error": err}).Warn("Unable to forget the processed online message")
+	}
+}
+
+// NewProcessedMessageStore creates the processed message store.  The redis store has
+// to be used when there is more than one consumer or the markers need to survive a
+// restart.
+func NewProcessedMessageStore(impl string, redisCfg controller.RedisConfig, ttl time.Duration) (ProcessedMessageStore, error) {
+	switch impl {
+	case "local":
+		return NewLocalProcessedMessageStore(ttl), nil
+	case "redis":
+		return NewRedisProcessedMessageStore(controller.NewRedisClient(redisCfg.Address, redisCfg.Password, redisCfg.DB), ttl), nil
+	default:
+		return nil, ErrInvalidProcessedMessageStore
+	}
+}
@@ -0,0 +1,61 @@
+package mqtt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+
+	"github.com/alicebob/miniredis"
+)
+
+func TestRedisProcessedMessageStore(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Unable to start miniredis: %s", err)
+	}
+	defer server.Close()
+
+	store := NewRedisProcessedMessageStore(controller.NewRedisClient(server.Addr(), "", 0), time.Minute)
+
+	now := time.Now()
+
+	if _, found := store.LastProcessed("client-1", now); found {
+		t.Fatalf("Expected no processed message for an unknown client")
+	}
+
+	store.MarkProcessed("client-1", "message-1", "hash-1", now)
+
+	last, found := store.LastProcessed("client-1", now)
+	if found == false || last.MessageID != "message-1" || last.ContentHash != "hash-1" || last.Processed.Equal(now) == false {
+		t.Fatalf("Unexpected processed message %+v (found %v)", last, found)
+	}
+
+	if _, found := store.LastProcessed("client-1", now.Add(time.Minute)); found {
+		t.Fatalf("Expected the processed message to expire after the ttl")
+	}
+
+	store.Forget("client-1")
+
+	if _, found := store.LastProcessed("client-1", now); found {
+		t.Fatalf("Expected the processed message to be forgotten")
+	}
+}
+
+func TestRedisProcessedMessageStoreIsUnavailable(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Unable to start miniredis: %s", err)
+	}
+
+	store := NewRedisProcessedMessageStore(controller.NewRedisClient(server.Addr(), "", 0), time.Minute)
+	server.Close()
+
+	now := time.Now()
+	store.MarkProcessed("client-1", "message-1", "", now)
+
+	// The message has to be handled again rather than dropped
+	if _, found := store.LastProcessed("client-1", now); found {
+		t.Fatalf("Expected no processed message when redis is unavailable")
+	}
+}
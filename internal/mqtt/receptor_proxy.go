@@ -2,12 +2,16 @@ package mqtt
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 
+	"github.com/RedHatInsights/cloud-connector/internal/controller"
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
 )
 
 var (
@@ -15,42 +19,109 @@ var (
 )
 
 type ReceptorMQTTProxy struct {
-	ClientID string
-	Client   MQTT.Client
+	ClientID  string
+	Client    MQTT.Client
+	Details   *domain.RhcClient
+	Handshake []byte
+	ChunkSize int
+	Signer    MessageSigner
+
+	// TimestampFormat is the serialization format of the sent timestamp of the
+	// control messages that are published to the client
+	TimestampFormat string
+
+	// DeliveryConfirmer confirms the delivery of the data messages.  Delivery
+	// confirmations are disabled when it is nil.
+	DeliveryConfirmer *DeliveryConfirmer
+
+	// SizeLimits rejects the data messages that are too large to send.  The size is not
+	// checked when it is nil.
+	SizeLimits *MessageSizeLimits
 }
 
+// NewReceptorMQTTProxyFactory returns a factory that creates proxies for the clients
+// connected to the broker that the MQTT client is connected to
+func NewReceptorMQTTProxyFactory(client MQTT.Client, chunkSize int, signer MessageSigner, timestampFormat string, confirmer *DeliveryConfirmer, sizeLimits *MessageSizeLimits) controller.ReceptorFactory {
+	return func(account string, nodeID string) controller.Receptor {
+		return &ReceptorMQTTProxy{ClientID: nodeID, Client: client, ChunkSize: chunkSize, Signer: signer, TimestampFormat: timestampFormat, DeliveryConfirmer: confirmer, SizeLimits: sizeLimits}
+	}
+}
+
+// receptorProxyDataMessageQos is the QoS that the data messages are published with.
+// The broker must acknowledge each chunk, otherwise a lost chunk would leave the client
+// unable to reassemble the message.
+const receptorProxyDataMessageQos = byte(1)
+
+// SendMessage publishes the data messages to the client and waits for the broker to
+// acknowledge each of them or for the context to expire
 func (rhp *ReceptorMQTTProxy) SendMessage(ctx context.Context, accountNumber string, recipient string, payload interface{}, directive string) (*uuid.UUID, error) {
 
-	messageID, err := uuid.NewRandom()
+	messageID, messages, err := rhp.PreviewMessage(ctx, accountNumber, recipient, payload, directive)
 	if err != nil {
 		return nil, err
 	}
 
-	fmt.Println("Sending message to connected client")
+	logger := logger.Log.WithFields(logrus.Fields{"clientID": rhp.ClientID, "message_id": messageID, "directive": directive})
+
+	logger.Debug("Sending message to connected client")
+
+	tokens := make([]MQTT.Token, 0, len(messages))
+
+	for _, message := range messages {
+		t, err := publishDataMessage(ctx, rhp.Client, message.Topic, receptorProxyDataMessageQos, message.Message)
+		if err != nil {
+			logger.WithFields(logrus.Fields{"topic": message.Topic, "error": err}).Error("Unable to publish the data message")
+			return nil, err
+		}
+
+		tokens = append(tokens, t)
+	}
+
+	rhp.DeliveryConfirmer.confirmDelivery(domain.ClientID(rhp.ClientID), messageID.String(), directive, tokens)
+
+	return messageID, nil
+}
+
+// PreviewMessage builds the data messages that SendMessage would publish to the client
+func (rhp *ReceptorMQTTProxy) PreviewMessage(ctx context.Context, accountNumber string, recipient string, payload interface{}, directive string) (*uuid.UUID, []controller.MessagePreview, error) {
+
+	messageID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, nil, err
+	}
 
 	topic := fmt.Sprintf("redhat/insights/%s/out", rhp.ClientID)
-	fmt.Println("topic: ", topic)
 
-	message := DataMessage{
-		MessageType: "data",
-		MessageID:   messageID.String(),
-		Version:     1,
-		Content:     payload,
+	if err := rhp.SizeLimits.check(directive, payload); err != nil {
+		return nil, nil, err
+	}
+
+	messages, err := buildDataMessages(messageID, payload, rhp.ChunkSize)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	messageBytes, err := json.Marshal(message)
+	previews := make([]controller.MessagePreview, 0, len(messages))
+	for _, message := range messages {
+		previews = append(previews, controller.MessagePreview{Topic: topic, Message: message})
+	}
 
-	t := rhp.Client.Publish(topic, byte(0), false, messageBytes)
-	go func() {
-		_ = t.Wait() // Can also use '<-t.Done()' in releases > 1.2.0
-		if t.Error() != nil {
-			fmt.Println("public error:", t.Error())
-		}
-	}()
+	return &messageID, previews, nil
+}
+
+func (rhp *ReceptorMQTTProxy) ClientDetails() domain.RhcClient {
+	if rhp.Details == nil {
+		return domain.RhcClient{ClientID: domain.ClientID(rhp.ClientID)}
+	}
+	return *rhp.Details
+}
 
-	return &messageID, nil
+func (rhp *ReceptorMQTTProxy) RawHandshake() []byte {
+	return rhp.Handshake
 }
 
+// Close tells the client to disconnect from the broker
 func (rhp *ReceptorMQTTProxy) Close(ctx context.Context) error {
-	return nil
+	_, err := SendDisconnectMessageToClient(rhp.Client, NewTopicBuilder(), rhp.Signer, rhp.TimestampFormat, domain.ClientID(rhp.ClientID))
+	return err
 }
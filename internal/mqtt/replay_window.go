@@ -0,0 +1,73 @@
+package mqtt
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrReplayedControlMessage = errors.New("Control message has already been received")
+	ErrExpiredControlMessage  = errors.New("Control message was not sent within the replay window")
+)
+
+type seenControlMessage struct {
+	messageID string
+	seen      time.Time
+}
+
+// replayWindow rejects the signed control messages that have already been received.  A
+// signature only proves who built a message, so a captured message could otherwise be
+// published again.  The message ids are remembered for the length of the window.  A
+// message that was not sent within the window is rejected because it can no longer be
+// checked against the remembered message ids.
+type replayWindow struct {
+	window time.Duration
+	seen   map[string]*list.Element
+	order  *list.List // oldest first
+	sync.Mutex
+}
+
+func newReplayWindow(window time.Duration) *replayWindow {
+	return &replayWindow{
+		window: window,
+		seen:   make(map[string]*list.Element),
+		order:  list.New(),
+	}
+}
+
+// check records the message id and returns an error if the message has already been
+// received or was not sent within the window
+func (rw *replayWindow) check(msg ControlMessage, now time.Time) error {
+	if msg.Sent.IsZero() || now.Sub(msg.Sent.Time) > rw.window || msg.Sent.Sub(now) > rw.window {
+		return ErrExpiredControlMessage
+	}
+
+	rw.Lock()
+	defer rw.Unlock()
+
+	rw.expire(now)
+
+	if _, found := rw.seen[msg.MessageID]; found {
+		return ErrReplayedControlMessage
+	}
+
+	rw.seen[msg.MessageID] = rw.order.PushBack(seenControlMessage{messageID: msg.MessageID, seen: now})
+
+	return nil
+}
+
+// expire forgets the message ids that were seen before the window.  The ids are kept
+// in the order that they were seen so only the expired ones are visited.
+func (rw *replayWindow) expire(now time.Time) {
+	for e := rw.order.Front(); e != nil; e = rw.order.Front() {
+		entry := e.Value.(seenControlMessage)
+		if now.Sub(entry.seen) <= rw.window {
+			return
+		}
+
+		rw.order.Remove(e)
+		delete(rw.seen, entry.messageID)
+	}
+}
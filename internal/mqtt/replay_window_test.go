@@ -0,0 +1,65 @@
+package mqtt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReplayWindow(t *testing.T) {
+	now := time.Now()
+	replays := newReplayWindow(time.Minute)
+
+	msg := ControlMessage{MessageID: "1234", Sent: newTimestamp(now, TimestampFormatRFC3339)}
+
+	if err := replays.check(msg, now); err != nil {
+		t.Fatal("expected the first message to be accepted, got: ", err)
+	}
+
+	if err := replays.check(msg, now.Add(30*time.Second)); err != ErrReplayedControlMessage {
+		t.Fatalf("expected %v, got %v", ErrReplayedControlMessage, err)
+	}
+
+	if err := replays.check(ControlMessage{MessageID: "5678", Sent: newTimestamp(now, TimestampFormatRFC3339)}, now); err != nil {
+		t.Fatal("expected another message to be accepted, got: ", err)
+	}
+}
+
+func TestReplayWindowRejectsMessagesSentOutsideTheWindow(t *testing.T) {
+	now := time.Now()
+	replays := newReplayWindow(time.Minute)
+
+	var tests = []struct {
+		name string
+		sent Timestamp
+	}{
+		{"old", newTimestamp(now.Add(-2*time.Minute), TimestampFormatRFC3339)},
+		{"future", newTimestamp(now.Add(2*time.Minute), TimestampFormatRFC3339)},
+		{"missing", Timestamp{}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := replays.check(ControlMessage{MessageID: tc.name, Sent: tc.sent}, now); err != ErrExpiredControlMessage {
+				t.Fatalf("expected %v, got %v", ErrExpiredControlMessage, err)
+			}
+		})
+	}
+}
+
+func TestReplayWindowForgetsExpiredMessages(t *testing.T) {
+	now := time.Now()
+	replays := newReplayWindow(time.Minute)
+
+	replays.check(ControlMessage{MessageID: "1234", Sent: newTimestamp(now, TimestampFormatRFC3339)}, now)
+	replays.check(ControlMessage{MessageID: "5678", Sent: newTimestamp(now.Add(50*time.Second), TimestampFormatRFC3339)}, now.Add(50*time.Second))
+
+	replays.check(ControlMessage{MessageID: "abcd", Sent: newTimestamp(now.Add(90*time.Second), TimestampFormatRFC3339)}, now.Add(90*time.Second))
+
+	if _, found := replays.seen["1234"]; found {
+		t.Fatal("expected the expired message id to be forgotten")
+	}
+
+	if len(replays.seen) != 2 || replays.order.Len() != 2 {
+		t.Fatalf("expected 2 remembered message ids, got %d", len(replays.seen))
+	}
+}
@@ -0,0 +1,133 @@
+package mqtt
+
+import (
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+// InFlightMessageTracker keeps count of the messages that are currently being
+// handled, and of the messages that are queued for the message workers, so that a
+// shutdown can wait for them to finish before the connections and the producers that
+// the handlers use are closed.
+type InFlightMessageTracker struct {
+	count int64
+	// queued counts the messages that were handed to the worker pool and that have
+	// not been handled yet
+	queued int64
+	// idle is closed while no messages are in flight or queued
+	idle chan struct{}
+	sync.Mutex
+}
+
+func NewInFlightMessageTracker() *InFlightMessageTracker {
+	idle := make(chan struct{})
+	close(idle)
+
+	return &InFlightMessageTracker{idle: idle}
+}
+
+func (t *InFlightMessageTracker) InFlight() int64 {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.count
+}
+
+func (t *InFlightMessageTracker) Queued() int64 {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.queued
+}
+
+// track records that a message is being handled.  The returned func must be called
+// once the message has been handled.
+func (t *InFlightMessageTracker) track() func() {
+	return t.add(&t.count)
+}
+
+// trackQueued records that a message was handed to the worker pool.  The returned func
+// must be called once the message has been handled.
+func (t *InFlightMessageTracker) trackQueued() func() {
+	return t.add(&t.queued)
+}
+
+func (t *InFlightMessageTracker) add(counter *int64) func() {
+	t.Lock()
+	if t.count == 0 && t.queued == 0 {
+		t.idle = make(chan struct{})
+	}
+	*counter++
+	t.Unlock()
+
+	return func() {
+		t.Lock()
+		*counter--
+		if t.count == 0 && t.queued == 0 {
+			close(t.idle)
+		}
+		t.Unlock()
+	}
+}
+
+// Wait waits up to the timeout for the messages that are in flight or queued to be
+// handled.  It returns false if messages were still in flight when the timeout expired.
+func (t *InFlightMessageTracker) Wait(timeout time.Duration) bool {
+	t.Lock()
+	idle := t.idle
+	t.Unlock()
+
+	select {
+	case <-idle:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (t *InFlightMessageTracker) middleware(next MQTT.MessageHandler) MQTT.MessageHandler {
+	return func(client MQTT.Client, message MQTT.Message) {
+		done := t.track()
+		defer done()
+
+		next(client, message)
+	}
+}
+
+// Shutdown unsubscribes from the tracked topics so that the broker stops delivering
+// messages, waits up to the drain timeout for the messages that are in flight or queued
+// for the message workers to be handled and then disconnects from the broker.  It has to be called before the kafka
+// producers that the handlers write to are closed.  The quiesce timeout bounds both how
+// long to wait for the broker to acknowledge the unsubscribe and how long the client
+// waits for outstanding work to complete before the connection is closed.
+func Shutdown(client MQTT.Client, subscriptions *SubscriptionTracker, inFlight *InFlightMessageTracker, drainTimeout time.Duration, quiesce time.Duration) {
+	topics := make([]string, 0)
+	for _, subscription := range subscriptions.Subscriptions() {
+		topics = append(topics, subscription.Topic)
+	}
+
+	if len(topics) > 0 {
+		logger.Log.WithFields(logrus.Fields{"topics": topics}).Info("Unsubscribing from topics")
+
+		token := client.Unsubscribe(topics...)
+		if token.WaitTimeout(quiesce) == false {
+			logger.Log.WithFields(logrus.Fields{"topics": topics}).Warn("Timed out waiting for the broker to acknowledge the unsubscribe")
+		} else if token.Error() != nil {
+			logger.Log.WithFields(logrus.Fields{"topics": topics, "error": token.Error()}).Warn("Unable to unsubscribe from topics")
+		}
+	}
+
+	if inFlight.Wait(drainTimeout) == false {
+		logger.Log.WithFields(logrus.Fields{"in_flight": inFlight.InFlight(), "queued": inFlight.Queued()}).Warn("Timed out waiting for the messages in flight to be handled")
+	}
+
+	logger.Log.WithFields(logrus.Fields{"in_flight": inFlight.InFlight(), "queued": inFlight.Queued()}).Info("Disconnecting from the MQTT broker")
+
+	client.Disconnect(uint(quiesce / time.Millisecond))
+}
@@ -0,0 +1,122 @@
+package mqtt
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+type shutdownRecordingClient struct {
+	MQTT.Client
+	unsubscribed []string
+	quiesce      uint
+	disconnected bool
+}
+
+func (c *shutdownRecordingClient) Unsubscribe(topics ...string) MQTT.Token {
+	c.unsubscribed = append(c.unsubscribed, topics...)
+	return completedToken{}
+}
+
+func (c *shutdownRecordingClient) Disconnect(quiesce uint) {
+	c.disconnected = true
+	c.quiesce = quiesce
+}
+
+func TestShutdownUnsubscribesAndDisconnects(t *testing.T) {
+	subscriptions := NewSubscriptionTracker(metrics)
+	subscriptions.add(Subscription{Topic: "redhat/insights/+/control/out"})
+	subscriptions.add(Subscription{Topic: "redhat/insights/+/data/out"})
+
+	client := &shutdownRecordingClient{}
+
+	Shutdown(client, subscriptions, NewInFlightMessageTracker(), time.Second, 250*time.Millisecond)
+
+	expected := []string{"redhat/insights/+/control/out", "redhat/insights/+/data/out"}
+	if reflect.DeepEqual(client.unsubscribed, expected) == false {
+		t.Fatalf("Expected to unsubscribe from %v, but got %v", expected, client.unsubscribed)
+	}
+
+	if client.disconnected == false || client.quiesce != 250 {
+		t.Fatalf("Expected the client to disconnect with a 250ms quiesce, but got %t / %d", client.disconnected, client.quiesce)
+	}
+}
+
+func TestShutdownWithoutSubscriptions(t *testing.T) {
+	client := &shutdownRecordingClient{}
+
+	Shutdown(client, NewSubscriptionTracker(metrics), NewInFlightMessageTracker(), time.Second, time.Second)
+
+	if len(client.unsubscribed) != 0 || client.disconnected == false {
+		t.Fatalf("Expected the client to disconnect without unsubscribing, but got %v / %t", client.unsubscribed, client.disconnected)
+	}
+}
+
+func TestInFlightMessageTracker(t *testing.T) {
+	inFlight := NewInFlightMessageTracker()
+
+	var duringHandling int64
+	handler := inFlight.middleware(func(client MQTT.Client, message MQTT.Message) {
+		duringHandling = inFlight.InFlight()
+	})
+
+	handler(nil, testMessage{topic: "redhat/insights/client-1/control/out"})
+
+	if duringHandling != 1 || inFlight.InFlight() != 0 {
+		t.Fatalf("Expected 1 message in flight while handling and 0 afterwards, but got %d / %d", duringHandling, inFlight.InFlight())
+	}
+}
+
+func TestShutdownWaitsForMessagesInFlight(t *testing.T) {
+	inFlight := NewInFlightMessageTracker()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handled := make(chan struct{})
+
+	handler := inFlight.middleware(func(client MQTT.Client, message MQTT.Message) {
+		close(started)
+		<-release
+		close(handled)
+	})
+
+	go handler(nil, testMessage{topic: "redhat/insights/client-1/control/out"})
+	<-started
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+
+	client := &shutdownRecordingClient{}
+
+	Shutdown(client, NewSubscriptionTracker(metrics), inFlight, time.Second, time.Second)
+
+	select {
+	case <-handled:
+	default:
+		t.Fatalf("Expected the client to be disconnected after the message in flight was handled")
+	}
+
+	if client.disconnected == false {
+		t.Fatalf("Expected the client to be disconnected")
+	}
+}
+
+func TestShutdownStopsWaitingAfterTheDrainTimeout(t *testing.T) {
+	inFlight := NewInFlightMessageTracker()
+
+	done := inFlight.track()
+	defer done()
+
+	client := &shutdownRecordingClient{}
+
+	start := time.Now()
+	Shutdown(client, NewSubscriptionTracker(metrics), inFlight, 20*time.Millisecond, time.Second)
+
+	if client.disconnected == false || time.Since(start) >= time.Second {
+		t.Fatalf("Expected the client to be disconnected once the drain timeout expired")
+	}
+}
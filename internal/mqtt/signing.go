@@ -0,0 +1,218 @@
+package mqtt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+const (
+	MessageSigningNone       = "none"
+	MessageSigningHmacSha256 = "hmac-sha256"
+)
+
+var (
+	ErrInvalidMessageSigning = errors.New("Invalid control message signing mode")
+	ErrMissingSigningKey     = errors.New("A signing key is required to sign control messages")
+	ErrSignatureRequired     = errors.New("Control message signatures can only be required when control message signing is enabled")
+	ErrMissingSignature      = errors.New("Control message is not signed")
+	ErrInvalidSignature      = errors.New("Control message signature is invalid")
+)
+
+// MessageSigner signs the control messages that are sent to the clients and verifies
+// the signatures of the control messages that are received from the clients.  The
+// keyID selects the key that signs the payload so that each client has its own key.
+type MessageSigner interface {
+	Sign(keyID string, payload []byte) (string, error)
+	Verify(keyID string, payload []byte, signature string) error
+}
+
+// broadcastSigningKeyID selects the key that signs the messages published to the
+// broadcast control topic.  It cannot collide with a client's key id.
+const broadcastSigningKeyID = "broadcast"
+
+// clientSigningKeyID selects the key that signs the messages exchanged with the client
+func clientSigningKeyID(clientID domain.ClientID) string {
+	return "client:" + string(clientID)
+}
+
+// HmacMessageSigner signs messages with HMAC-SHA256.  The configured key is never
+// shared with the clients.  Each message is signed with a key derived from it instead:
+//
+//	HMAC-SHA256(key, "client:<client id>") for the messages exchanged with a client
+//	HMAC-SHA256(key, "broadcast") for the messages published to the broadcast topic
+//
+// A client is provisioned with its own derived key (and the broadcast key), so it
+// cannot sign messages for any other client.  The signature is base64 encoded.
+type HmacMessageSigner struct {
+	key []byte
+}
+
+func NewHmacMessageSigner(key []byte) *HmacMessageSigner {
+	return &HmacMessageSigner{key: key}
+}
+
+func (s *HmacMessageSigner) derivedKey(keyID string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(keyID))
+	return mac.Sum(nil)
+}
+
+func (s *HmacMessageSigner) sum(keyID string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.derivedKey(keyID))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func (s *HmacMessageSigner) Sign(keyID string, payload []byte) (string, error) {
+	return base64.StdEncoding.EncodeToString(s.sum(keyID, payload)), nil
+}
+
+func (s *HmacMessageSigner) Verify(keyID string, payload []byte, signature string) error {
+	if signature == "" {
+		return ErrMissingSignature
+	}
+
+	actual, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	if hmac.Equal(actual, s.sum(keyID, payload)) == false {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// NewMessageSigner creates the signer for the signing mode.  The key is read from
+// keyFile.  A nil signer is returned when signing is disabled.
+func NewMessageSigner(mode string, keyFile string) (MessageSigner, error) {
+	switch mode {
+	case MessageSigningNone, "":
+		return nil, nil
+	case MessageSigningHmacSha256:
+		if keyFile == "" {
+			return nil, ErrMissingSigningKey
+		}
+
+		key, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		key = []byte(strings.TrimSpace(string(key)))
+		if len(key) == 0 {
+			return nil, ErrMissingSigningKey
+		}
+
+		return NewHmacMessageSigner(key), nil
+	default:
+		return nil, ErrInvalidMessageSigning
+	}
+}
+
+func VerifyMessageSigning(mode string, requireSignature bool) error {
+	switch mode {
+	case MessageSigningNone, "":
+		if requireSignature {
+			return ErrSignatureRequired
+		}
+		return nil
+	case MessageSigningHmacSha256:
+		return nil
+	default:
+		return ErrInvalidMessageSigning
+	}
+}
+
+// signingPayload builds the bytes that are signed.  Every field of the envelope except
+// for the correlation id (which cloud-connector assigns to the messages that do not have
+// one) is included so that a signed message cannot be altered, or replayed with a new
+// message id or timestamp.  The content is normalized (sorted keys, no whitespace) so
+// that the signature does not depend on how the content was serialized.
+//
+//	<type>\n<version>\n<message_id>\n<response_to>\n<sent as unix seconds>\n<normalized json content>
+func signingPayload(msg *ControlMessage) ([]byte, error) {
+	contentBytes, err := json.Marshal(msg.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	var normalized interface{}
+	if err := json.Unmarshal(contentBytes, &normalized); err != nil {
+		return nil, err
+	}
+
+	normalizedBytes, err := json.Marshal(normalized)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(fmt.Sprintf("%s\n%d\n%s\n%s\n%d\n%s", msg.MessageType, msg.Version, msg.MessageID, msg.ResponseTo, msg.Sent.Unix(), normalizedBytes)), nil
+}
+
+// SignControlMessage sets the signature of the message using the key selected by keyID
+func SignControlMessage(signer MessageSigner, keyID string, msg *ControlMessage) error {
+	payload, err := signingPayload(msg)
+	if err != nil {
+		return err
+	}
+
+	signature, err := signer.Sign(keyID, payload)
+	if err != nil {
+		return err
+	}
+
+	msg.Signature = signature
+
+	return nil
+}
+
+// VerifyControlMessage checks that the message was signed with the key selected by keyID.
+// ErrMissingSignature is returned for unsigned messages and ErrInvalidSignature is
+// returned if the signature does not match.
+func VerifyControlMessage(signer MessageSigner, keyID string, msg *ControlMessage) error {
+	if msg.Signature == "" {
+		return ErrMissingSignature
+	}
+
+	payload, err := signingPayload(msg)
+	if err != nil {
+		return err
+	}
+
+	return signer.Verify(keyID, payload, msg.Signature)
+}
+
+// signOutgoingControlMessage signs a message built by cloud-connector.  Nothing is done
+// when signing is disabled (the signer is nil).
+func signOutgoingControlMessage(signer MessageSigner, keyID string, msg *ControlMessage) error {
+	if signer == nil {
+		return nil
+	}
+
+	return SignControlMessage(signer, keyID, msg)
+}
+
+func unverifiedSignatureReason(err error) string {
+	switch err {
+	case ErrMissingSignature:
+		return "missing"
+	case ErrInvalidSignature:
+		return "invalid"
+	case ErrReplayedControlMessage:
+		return "replayed"
+	case ErrExpiredControlMessage:
+		return "expired"
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,244 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSignedControlMessageVerifies(t *testing.T) {
+	signer := NewHmacMessageSigner([]byte("secret"))
+
+	_, msg, err := buildControlMessage("command", CommandMessageContent{Command: "ping"}, TimestampFormatRFC3339)
+	if err != nil {
+		t.Fatal("unexpected error building the message: ", err)
+	}
+
+	if err := SignControlMessage(signer, clientSigningKeyID("client-1"), msg); err != nil {
+		t.Fatal("unexpected error signing the message: ", err)
+	}
+
+	if msg.Signature == "" {
+		t.Fatal("expected the message to be signed")
+	}
+
+	// Verify the message the way a client would after receiving it over the wire
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var received ControlMessage
+	if err := json.Unmarshal(payload, &received); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifyControlMessage(signer, clientSigningKeyID("client-1"), &received); err != nil {
+		t.Fatal("expected the signature to verify, got: ", err)
+	}
+}
+
+func TestVerifyControlMessageRejectsTamperedMessages(t *testing.T) {
+	var tests = []struct {
+		field  string
+		tamper func(*ControlMessage)
+	}{
+		{"content", func(msg *ControlMessage) { msg.Content = CommandMessageContent{Command: "disconnect"} }},
+		{"type", func(msg *ControlMessage) { msg.MessageType = "event" }},
+		{"version", func(msg *ControlMessage) { msg.Version = 2 }},
+		{"message_id", func(msg *ControlMessage) { msg.MessageID = "another-id" }},
+		{"response_to", func(msg *ControlMessage) { msg.ResponseTo = "another-id" }},
+		{"sent", func(msg *ControlMessage) { msg.Sent = newTimestamp(msg.Sent.Add(time.Hour), TimestampFormatRFC3339) }},
+	}
+
+	signer := NewHmacMessageSigner([]byte("secret"))
+
+	for _, tc := range tests {
+		t.Run(tc.field, func(t *testing.T) {
+			_, msg, err := buildControlMessage("command", CommandMessageContent{Command: "ping"}, TimestampFormatRFC3339)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := SignControlMessage(signer, clientSigningKeyID("client-1"), msg); err != nil {
+				t.Fatal(err)
+			}
+
+			tc.tamper(msg)
+
+			if err := VerifyControlMessage(signer, clientSigningKeyID("client-1"), msg); err != ErrInvalidSignature {
+				t.Fatalf("expected %v, got %v", ErrInvalidSignature, err)
+			}
+		})
+	}
+}
+
+func TestVerifyControlMessageRejectsOtherKeys(t *testing.T) {
+	_, msg, err := buildControlMessage("command", CommandMessageContent{Command: "ping"}, TimestampFormatRFC3339)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SignControlMessage(NewHmacMessageSigner([]byte("secret")), clientSigningKeyID("client-1"), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifyControlMessage(NewHmacMessageSigner([]byte("other")), clientSigningKeyID("client-1"), msg); err != ErrInvalidSignature {
+		t.Fatalf("expected %v, got %v", ErrInvalidSignature, err)
+	}
+
+	// A client's key cannot sign the messages of another client
+	if err := VerifyControlMessage(NewHmacMessageSigner([]byte("secret")), clientSigningKeyID("client-2"), msg); err != ErrInvalidSignature {
+		t.Fatalf("expected %v, got %v", ErrInvalidSignature, err)
+	}
+
+	if err := VerifyControlMessage(NewHmacMessageSigner([]byte("secret")), broadcastSigningKeyID, msg); err != ErrInvalidSignature {
+		t.Fatalf("expected %v, got %v", ErrInvalidSignature, err)
+	}
+}
+
+func TestVerifyControlMessageRejectsUnsignedMessages(t *testing.T) {
+	signer := NewHmacMessageSigner([]byte("secret"))
+
+	_, msg, err := buildControlMessage("command", CommandMessageContent{Command: "ping"}, TimestampFormatRFC3339)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifyControlMessage(signer, clientSigningKeyID("client-1"), msg); err != ErrMissingSignature {
+		t.Fatalf("expected %v, got %v", ErrMissingSignature, err)
+	}
+
+	msg.Signature = "not base64!"
+	if err := VerifyControlMessage(signer, clientSigningKeyID("client-1"), msg); err != ErrInvalidSignature {
+		t.Fatalf("expected %v, got %v", ErrInvalidSignature, err)
+	}
+}
+
+func TestSendControlMessageSignsWithTheClientsKey(t *testing.T) {
+	signer := NewHmacMessageSigner([]byte("secret"))
+	client := &publishRecordingClient{}
+
+	if _, err := SendControlMessageToClient(context.TODO(), client, NewTopicBuilder(), signer, TimestampFormatRFC3339, nil, byte(1), "client-1", &CommandMessageContent{Command: pingCommand}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := SendControlMessageToAll(context.TODO(), client, NewTopicBuilder(), signer, TimestampFormatRFC3339, nil, byte(1), &CommandMessageContent{Command: pingCommand}); err != nil {
+		t.Fatal(err)
+	}
+
+	var direct, broadcast ControlMessage
+	json.Unmarshal(client.published[0].payload, &direct)
+	json.Unmarshal(client.published[1].payload, &broadcast)
+
+	if err := VerifyControlMessage(signer, clientSigningKeyID("client-1"), &direct); err != nil {
+		t.Fatal("expected the message to be signed with the client's key, got: ", err)
+	}
+
+	if err := VerifyControlMessage(signer, broadcastSigningKeyID, &broadcast); err != nil {
+		t.Fatal("expected the broadcast message to be signed with the broadcast key, got: ", err)
+	}
+}
+
+func TestSendControlMessageWithoutSigner(t *testing.T) {
+	client := &publishRecordingClient{}
+
+	if _, err := SendControlMessageToClient(context.TODO(), client, NewTopicBuilder(), nil, TimestampFormatRFC3339, nil, byte(1), "client-1", &CommandMessageContent{Command: pingCommand}); err != nil {
+		t.Fatal(err)
+	}
+
+	var msg ControlMessage
+	json.Unmarshal(client.published[0].payload, &msg)
+
+	if msg.Signature != "" {
+		t.Fatal("expected the message to be unsigned when signing is disabled")
+	}
+}
+
+func TestVerifySignedControlMessageRejectsReplays(t *testing.T) {
+	signer := NewHmacMessageSigner([]byte("secret"))
+	replays := newReplayWindow(time.Minute)
+
+	_, msg, err := buildControlMessage("event", "pong", TimestampFormatRFC3339)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SignControlMessage(signer, clientSigningKeyID("client-1"), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verifySignedControlMessage(signer, replays, "client-1", *msg, time.Now()); err != nil {
+		t.Fatal("expected the first delivery to verify, got: ", err)
+	}
+
+	if err := verifySignedControlMessage(signer, replays, "client-1", *msg, time.Now()); err != ErrReplayedControlMessage {
+		t.Fatalf("expected %v, got %v", ErrReplayedControlMessage, err)
+	}
+}
+
+func TestNewMessageSigner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	emptyKeyFile := filepath.Join(dir, "empty")
+	if err := ioutil.WriteFile(emptyKeyFile, []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if signer, err := NewMessageSigner(MessageSigningNone, ""); signer != nil || err != nil {
+		t.Fatalf("expected signing to be disabled, got %v, %v", signer, err)
+	}
+
+	signer, err := NewMessageSigner(MessageSigningHmacSha256, keyFile)
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+
+	expected, _ := NewHmacMessageSigner([]byte("secret")).Sign("client:client-1", []byte("payload"))
+	if actual, _ := signer.Sign("client:client-1", []byte("payload")); actual != expected {
+		t.Fatal("expected the trailing newline to be stripped from the key")
+	}
+
+	if _, err := NewMessageSigner(MessageSigningHmacSha256, ""); err != ErrMissingSigningKey {
+		t.Fatalf("expected %v, got %v", ErrMissingSigningKey, err)
+	}
+
+	if _, err := NewMessageSigner(MessageSigningHmacSha256, emptyKeyFile); err != ErrMissingSigningKey {
+		t.Fatalf("expected %v, got %v", ErrMissingSigningKey, err)
+	}
+
+	if _, err := NewMessageSigner(MessageSigningHmacSha256, filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("expected an error for a missing key file")
+	}
+
+	if _, err := NewMessageSigner("rot13", keyFile); err != ErrInvalidMessageSigning {
+		t.Fatalf("expected %v, got %v", ErrInvalidMessageSigning, err)
+	}
+}
+
+func TestVerifyMessageSigning(t *testing.T) {
+	if err := VerifyMessageSigning(MessageSigningNone, true); err != ErrSignatureRequired {
+		t.Fatalf("expected %v, got %v", ErrSignatureRequired, err)
+	}
+
+	if err := VerifyMessageSigning(MessageSigningHmacSha256, true); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+
+	if err := VerifyMessageSigning("rot13", false); err != ErrInvalidMessageSigning {
+		t.Fatalf("expected %v, got %v", ErrInvalidMessageSigning, err)
+	}
+}
@@ -0,0 +1,101 @@
+package mqtt
+
+import (
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+// slowConsumerDetector measures how far message processing lags behind the clients.
+// The lag of a message is the time from when the client sent the message to when the
+// handler picks it up, so it includes the time the message spent queued in the broker,
+// in the MQTT client and in the handler middlewares.
+//
+// The smallest lag seen in each window is compared with the max lag.  The smallest lag
+// is used so that a client with a clock that is behind cannot make the consumer look
+// slow on its own.  The consumer is considered slow once the smallest lag has exceeded
+// the max lag in every window for at least the configured duration.
+type slowConsumerDetector struct {
+	window       time.Duration
+	duration     time.Duration
+	maxLag       time.Duration
+	windowStart  time.Time
+	measured     int
+	minLag       time.Duration
+	laggingSince time.Time
+	slow         bool
+	metrics      *Metrics
+	sync.Mutex
+}
+
+func newSlowConsumerDetector(window time.Duration, duration time.Duration, maxLag time.Duration, metrics *Metrics) *slowConsumerDetector {
+	return &slowConsumerDetector{
+		window:   window,
+		duration: duration,
+		maxLag:   maxLag,
+		metrics:  metrics,
+	}
+}
+
+func (scd *slowConsumerDetector) enabled() bool {
+	return scd.window > 0 && scd.duration > 0 && scd.maxLag > 0
+}
+
+// recordMessage records the lag of a message that the client sent at the sent time.
+// Messages without a sent time are ignored.
+func (scd *slowConsumerDetector) recordMessage(sent time.Time, now time.Time) {
+	if scd.enabled() == false || sent.IsZero() {
+		return
+	}
+
+	scd.Lock()
+	defer scd.Unlock()
+
+	scd.evaluate(now)
+
+	lag := now.Sub(sent)
+	if scd.measured == 0 || lag < scd.minLag {
+		scd.minLag = lag
+	}
+	scd.measured++
+}
+
+func (scd *slowConsumerDetector) evaluate(now time.Time) {
+	if scd.windowStart.IsZero() {
+		scd.windowStart = now
+		return
+	}
+
+	if now.Sub(scd.windowStart) < scd.window {
+		return
+	}
+
+	logger := logger.Log.WithFields(logrus.Fields{"measured": scd.measured, "min_lag": scd.minLag, "max_lag": scd.maxLag, "window": scd.window})
+
+	if scd.measured > 0 && scd.minLag > scd.maxLag {
+		if scd.laggingSince.IsZero() {
+			scd.laggingSince = scd.windowStart
+		}
+
+		if scd.slow == false && now.Sub(scd.laggingSince) >= scd.duration {
+			scd.slow = true
+			scd.metrics.slowConsumerGauge.Set(1)
+			logger.WithFields(logrus.Fields{"lagging_since": scd.laggingSince}).Warn("Message processing is not keeping up with message arrival")
+		}
+	} else {
+		scd.laggingSince = time.Time{}
+
+		if scd.slow {
+			scd.slow = false
+			scd.metrics.slowConsumerGauge.Set(0)
+			logger.Info("Message processing has caught up with message arrival")
+		}
+	}
+
+	scd.windowStart = now
+	scd.measured = 0
+	scd.minLag = 0
+}
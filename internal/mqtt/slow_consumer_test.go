@@ -0,0 +1,104 @@
+package mqtt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// feedSlowConsumerDetector simulates the handling of messages at a fixed rate (per
+// second) for the number of seconds.  Each message was sent lag before it is handled.
+func feedSlowConsumerDetector(scd *slowConsumerDetector, start time.Time, seconds int, rate int, lag time.Duration) time.Time {
+	now := start
+	for i := 0; i < seconds; i++ {
+		for j := 0; j < rate; j++ {
+			scd.recordMessage(now.Add(-lag), now)
+		}
+		now = now.Add(time.Second)
+	}
+	return now
+}
+
+func TestSlowConsumerDetected(t *testing.T) {
+	scd := newSlowConsumerDetector(time.Second, 5*time.Second, 10*time.Second, metrics)
+
+	now := feedSlowConsumerDetector(scd, time.Now(), 3, 10, time.Minute)
+	if scd.slow {
+		t.Fatalf("Expected the consumer to not be flagged before the duration has passed")
+	}
+
+	feedSlowConsumerDetector(scd, now, 5, 10, time.Minute)
+	if scd.slow == false {
+		t.Fatalf("Expected the consumer to be flagged as slow")
+	}
+
+	if testutil.ToFloat64(metrics.slowConsumerGauge) != 1 {
+		t.Fatalf("Expected the slow consumer gauge to be set")
+	}
+}
+
+func TestSlowConsumerRecovers(t *testing.T) {
+	scd := newSlowConsumerDetector(time.Second, 2*time.Second, 10*time.Second, metrics)
+
+	now := feedSlowConsumerDetector(scd, time.Now(), 5, 10, time.Minute)
+	if scd.slow == false {
+		t.Fatalf("Expected the consumer to be flagged as slow")
+	}
+
+	feedSlowConsumerDetector(scd, now, 3, 10, time.Second)
+	if scd.slow {
+		t.Fatalf("Expected the consumer to no longer be flagged as slow")
+	}
+
+	if testutil.ToFloat64(metrics.slowConsumerGauge) != 0 {
+		t.Fatalf("Expected the slow consumer gauge to be cleared")
+	}
+}
+
+func TestSlowConsumerIntermittentLag(t *testing.T) {
+	scd := newSlowConsumerDetector(time.Second, 3*time.Second, 10*time.Second, metrics)
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		now = feedSlowConsumerDetector(scd, now, 2, 10, time.Minute)
+		now = feedSlowConsumerDetector(scd, now, 1, 10, time.Second)
+	}
+
+	if scd.slow {
+		t.Fatalf("Expected intermittent lag to not flag the consumer as slow")
+	}
+}
+
+func TestSlowConsumerIgnoresClientsWithSkewedClocks(t *testing.T) {
+	scd := newSlowConsumerDetector(time.Second, 2*time.Second, 10*time.Second, metrics)
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		// One client's clock is an hour behind, the others are handled right away
+		scd.recordMessage(now.Add(-time.Hour), now)
+		now = feedSlowConsumerDetector(scd, now, 1, 10, 0)
+	}
+
+	if scd.slow {
+		t.Fatalf("Expected a client with a skewed clock to not flag the consumer as slow")
+	}
+}
+
+func TestSlowConsumerDisabled(t *testing.T) {
+	scd := newSlowConsumerDetector(time.Second, 0, 10*time.Second, metrics)
+
+	feedSlowConsumerDetector(scd, time.Now(), 10, 10, time.Minute)
+	if scd.slow || scd.measured != 0 {
+		t.Fatalf("Expected the disabled detector to not track messages")
+	}
+}
+
+func TestSlowConsumerIgnoresMessagesWithoutSentTime(t *testing.T) {
+	scd := newSlowConsumerDetector(time.Second, time.Second, 10*time.Second, metrics)
+
+	scd.recordMessage(time.Time{}, time.Now())
+	if scd.measured != 0 {
+		t.Fatalf("Expected a message without a sent time to be ignored")
+	}
+}
@@ -0,0 +1,106 @@
+package mqtt
+
+import (
+	"sort"
+	"sync"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Subscriber struct {
+	Topic      string
+	EntryPoint MQTT.MessageHandler
+	Qos        byte
+}
+
+type Subscription struct {
+	Topic string `json:"topic"`
+	Qos   byte   `json:"qos"`
+}
+
+// SubscriptionTracker keeps track of the topics that the client has successfully
+// subscribed to so that the effective subscriptions can be inspected.  The
+// subscriptions are forgotten when the connection to the broker is lost and are
+// recorded again as the client resubscribes after reconnecting.
+type SubscriptionTracker struct {
+	subscriptions map[string]Subscription
+	metrics       *Metrics
+	sync.RWMutex
+}
+
+func NewSubscriptionTracker(metrics *Metrics) *SubscriptionTracker {
+	return &SubscriptionTracker{
+		subscriptions: make(map[string]Subscription),
+		metrics:       metrics,
+	}
+}
+
+func (st *SubscriptionTracker) add(subscription Subscription) {
+	st.Lock()
+	defer st.Unlock()
+
+	st.subscriptions[subscription.Topic] = subscription
+
+	st.metrics.subscriptionGauge.Set(float64(len(st.subscriptions)))
+}
+
+// reset forgets the subscriptions.  The broker discards them along with a clean
+// session and they are only valid again once the client has resubscribed.
+func (st *SubscriptionTracker) reset() {
+	st.Lock()
+	defer st.Unlock()
+
+	st.subscriptions = make(map[string]Subscription)
+
+	st.metrics.subscriptionGauge.Set(0)
+}
+
+// onConnectionLost is a ConnectionLostHandler that forgets the subscriptions
+func (st *SubscriptionTracker) onConnectionLost(client MQTT.Client, err error) {
+	st.reset()
+}
+
+func (st *SubscriptionTracker) Subscriptions() []Subscription {
+	st.RLock()
+	defer st.RUnlock()
+
+	subscriptions := make([]Subscription, 0, len(st.subscriptions))
+	for _, subscription := range st.subscriptions {
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	sort.Slice(subscriptions, func(i, j int) bool {
+		return subscriptions[i].Topic < subscriptions[j].Topic
+	})
+
+	return subscriptions
+}
+
+// RegisterSubscribers returns an OnConnect handler that subscribes to each of the
+// subscribers' topics and records the subscriptions with the tracker.  The OnConnect
+// handler is called on every connection to the broker, including automatic
+// reconnects, so the subscriptions are re-established after the broker discards
+// them along with a clean session.
+func RegisterSubscribers(subscribers []Subscriber, tracker *SubscriptionTracker) MQTT.OnConnectHandler {
+	return func(client MQTT.Client) {
+		tracker.reset()
+
+		for _, subscriber := range subscribers {
+			logger.Log.Info("Subscribing to topic: ", subscriber.Topic)
+			if token := client.Subscribe(subscriber.Topic, subscriber.Qos, subscriber.EntryPoint); token.Wait() && token.Error() != nil {
+				if client.IsConnectionOpen() == false {
+					// The OnConnect handler will be called again once the client reconnects
+					logger.Log.WithFields(logrus.Fields{"error": token.Error()}).Errorf("Connection lost while subscribing to topic (%s)", subscriber.Topic)
+					return
+				}
+				logger.Log.WithFields(logrus.Fields{"error": token.Error()}).Fatalf("Subscribing to topic (%s) failed", subscriber.Topic)
+			}
+
+			tracker.add(Subscription{Topic: subscriber.Topic, Qos: subscriber.Qos})
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	TimestampFormatRFC3339     = "rfc3339"
+	TimestampFormatRFC3339Nano = "rfc3339nano"
+	TimestampFormatEpochMillis = "epoch_millis"
+)
+
+var (
+	ErrInvalidTimestampFormat = errors.New("Invalid timestamp format")
+
+	// ErrInvalidTimestamp is returned when a timestamp is neither an RFC3339 string
+	// nor epoch millis
+	ErrInvalidTimestamp = errors.New("Invalid timestamp")
+)
+
+// VerifyTimestampFormat checks that the format is one of the supported serialization
+// formats (rfc3339, rfc3339nano or epoch_millis)
+func VerifyTimestampFormat(format string) error {
+	switch format {
+	case TimestampFormatRFC3339, TimestampFormatRFC3339Nano, TimestampFormatEpochMillis:
+		return nil
+	default:
+		return ErrInvalidTimestampFormat
+	}
+}
+
+// Timestamp is a point in time that is serialized using the format it was created
+// with.  When unmarshalling, both RFC3339 strings and epoch millis are accepted.  An
+// empty or null timestamp is left as the zero value.  Any other value that cannot be
+// parsed is rejected with ErrInvalidTimestamp.
+type Timestamp struct {
+	time.Time
+	format string
+}
+
+func newTimestamp(t time.Time, format string) Timestamp {
+	return Timestamp{Time: t.UTC(), format: format}
+}
+
+func (ts Timestamp) MarshalJSON() ([]byte, error) {
+	if ts.IsZero() {
+		return []byte(`""`), nil
+	}
+
+	switch ts.format {
+	case TimestampFormatEpochMillis:
+		millis := ts.UnixNano() / int64(time.Millisecond)
+		return []byte(strconv.FormatInt(millis, 10)), nil
+	case TimestampFormatRFC3339Nano:
+		return json.Marshal(ts.Format(time.RFC3339Nano))
+	default:
+		return json.Marshal(ts.Format(time.RFC3339))
+	}
+}
+
+func (ts *Timestamp) UnmarshalJSON(data []byte) error {
+	*ts = Timestamp{}
+
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	if data[0] != '"' {
+		millis, err := strconv.ParseInt(string(data), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidTimestamp, data)
+		}
+
+		*ts = Timestamp{Time: time.Unix(0, millis*int64(time.Millisecond)).UTC(), format: TimestampFormatEpochMillis}
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidTimestamp, data)
+	}
+
+	if s == "" {
+		return nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidTimestamp, data)
+	}
+
+	*ts = Timestamp{Time: t, format: TimestampFormatRFC3339Nano}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestTimestampSerialization(t *testing.T) {
+	sent := time.Date(2021, time.March, 1, 12, 0, 0, 123456789, time.UTC)
+
+	var tests = []struct {
+		format   string
+		expected string
+	}{
+		{TimestampFormatRFC3339, `"2021-03-01T12:00:00Z"`},
+		{TimestampFormatRFC3339Nano, `"2021-03-01T12:00:00.123456789Z"`},
+		{TimestampFormatEpochMillis, `1614600000123`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.format, func(t *testing.T) {
+			msg := ControlMessage{MessageType: "command", Sent: newTimestamp(sent, tc.format)}
+
+			payload, err := json.Marshal(msg)
+			if err != nil {
+				t.Fatalf("Unexpected error marshalling control message: %s", err)
+			}
+
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(payload, &fields); err != nil {
+				t.Fatalf("Unexpected error unmarshalling control message: %s", err)
+			}
+
+			if string(fields["sent"]) != tc.expected {
+				t.Fatalf("Expected sent to be %s, but got %s", tc.expected, fields["sent"])
+			}
+
+			roundTrip := unmarshalControlMessage(t, string(payload))
+			if roundTrip.Sent.Sub(sent) > time.Second || sent.Sub(roundTrip.Sent.Time) > time.Second {
+				t.Fatalf("Expected sent to round trip to %s, but got %s", sent, roundTrip.Sent)
+			}
+		})
+	}
+}
+
+func TestTimestampDeserialization(t *testing.T) {
+	var tests = []struct {
+		name     string
+		sent     string
+		expected time.Time
+	}{
+		{"rfc3339", `"2021-03-01T12:00:00Z"`, time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)},
+		{"epoch millis", `1614600000123`, time.Date(2021, time.March, 1, 12, 0, 0, 123000000, time.UTC)},
+		{"empty", `""`, time.Time{}},
+		{"null", `null`, time.Time{}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := unmarshalControlMessage(t, `{"type": "event", "sent": `+tc.sent+`}`)
+
+			if msg.Sent.Equal(tc.expected) == false {
+				t.Fatalf("Expected sent to be %s, but got %s", tc.expected, msg.Sent)
+			}
+		})
+	}
+}
+
+func TestInvalidTimestampIsRejected(t *testing.T) {
+	var tests = []struct {
+		name string
+		sent string
+	}{
+		{"not a date", `"yesterday"`},
+		{"not a number", `12.5`},
+		{"object", `{"seconds": 1}`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var msg ControlMessage
+			err := json.Unmarshal([]byte(`{"type": "event", "sent": `+tc.sent+`}`), &msg)
+			if errors.Is(err, ErrInvalidTimestamp) == false {
+				t.Fatalf("Expected %s, but got %v", ErrInvalidTimestamp, err)
+			}
+		})
+	}
+}
+
+func TestInvalidTimestampFailsControlMessageParsing(t *testing.T) {
+	metrics := NewMetrics(prometheus.NewRegistry())
+
+	_, err := parseControlMessage([]byte(`{"type": "event", "message_id": "1234", "version": 1, "sent": "yesterday", "content": {"event": "job-progress"}}`), metrics)
+	if errors.Is(err, ErrInvalidTimestamp) == false {
+		t.Fatalf("Expected %s, but got %v", ErrInvalidTimestamp, err)
+	}
+}
+
+func TestVerifyTimestampFormat(t *testing.T) {
+	for _, format := range []string{TimestampFormatRFC3339, TimestampFormatRFC3339Nano, TimestampFormatEpochMillis} {
+		if err := VerifyTimestampFormat(format); err != nil {
+			t.Fatalf("Expected %s to be valid, but got %s", format, err)
+		}
+	}
+
+	if err := VerifyTimestampFormat("unix"); err != ErrInvalidTimestampFormat {
+		t.Fatalf("Expected %s, but got %v", ErrInvalidTimestampFormat, err)
+	}
+}
@@ -0,0 +1,43 @@
+package mqtt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+// TopicBuilder builds the topics that are used to communicate with the clients
+type TopicBuilder struct {
+}
+
+func NewTopicBuilder() *TopicBuilder {
+	return &TopicBuilder{}
+}
+
+func (tb *TopicBuilder) BuildIncomingWildcardControlTopic() string {
+	return CONTROL_MESSAGE_INCOMING_TOPIC
+}
+
+func (tb *TopicBuilder) BuildIncomingWildcardDataTopic() string {
+	return DATA_MESSAGE_INCOMING_TOPIC
+}
+
+// BuildIncomingControlTopic returns the control topic that the client publishes to
+func (tb *TopicBuilder) BuildIncomingControlTopic(clientID domain.ClientID) string {
+	return strings.Replace(CONTROL_MESSAGE_INCOMING_TOPIC, "+", string(clientID), 1)
+}
+
+func (tb *TopicBuilder) BuildOutgoingControlTopic(clientID domain.ClientID) string {
+	return fmt.Sprintf(CONTROL_MESSAGE_OUTGOING_TOPIC, clientID)
+}
+
+func (tb *TopicBuilder) BuildOutgoingDataTopic(clientID domain.ClientID) string {
+	return fmt.Sprintf(DATA_MESSAGE_OUTGOING_TOPIC, clientID)
+}
+
+// BuildBroadcastControlTopic returns the control topic that all of the clients subscribe
+// to in addition to their own control topic
+func (tb *TopicBuilder) BuildBroadcastControlTopic() string {
+	return BROADCAST_CONTROL_TOPIC
+}
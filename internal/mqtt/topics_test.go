@@ -0,0 +1,71 @@
+package mqtt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/RedHatInsights/cloud-connector/internal/domain"
+)
+
+func TestBuildOutgoingTopics(t *testing.T) {
+	topicBuilder := NewTopicBuilder()
+
+	var tests = []struct {
+		clientID domain.ClientID
+		control  string
+		data     string
+	}{
+		{"client-1", "redhat/insights/client-1/control/in", "redhat/insights/client-1/data/in"},
+		{"", "redhat/insights//control/in", "redhat/insights//data/in"},
+	}
+
+	for _, tc := range tests {
+		t.Run(string(tc.clientID), func(t *testing.T) {
+			if topic := topicBuilder.BuildOutgoingControlTopic(tc.clientID); topic != tc.control {
+				t.Fatalf("Expected control topic %s, but got %s", tc.control, topic)
+			}
+
+			if topic := topicBuilder.BuildOutgoingDataTopic(tc.clientID); topic != tc.data {
+				t.Fatalf("Expected data topic %s, but got %s", tc.data, topic)
+			}
+		})
+	}
+}
+
+func TestIncomingTopicsRoundTrip(t *testing.T) {
+	topicBuilder := NewTopicBuilder()
+
+	for _, wildcardTopic := range []string{topicBuilder.BuildIncomingWildcardControlTopic(), topicBuilder.BuildIncomingWildcardDataTopic()} {
+		t.Run(wildcardTopic, func(t *testing.T) {
+			clientID, err := verifyTopic(strings.Replace(wildcardTopic, "+", "client-1", 1))
+			if err != nil || clientID != "client-1" {
+				t.Fatalf("Expected the topic to be verified with client id client-1, but got %s (%v)", clientID, err)
+			}
+
+			if _, err := verifyTopic(strings.Replace(wildcardTopic, "+", "", 1)); err == nil {
+				t.Fatalf("Expected a topic with an empty client id to fail verification")
+			}
+		})
+	}
+}
+
+func TestBuildIncomingControlTopic(t *testing.T) {
+	topic := NewTopicBuilder().BuildIncomingControlTopic("client-1")
+
+	if topic != "redhat/insights/client-1/control/out" {
+		t.Fatalf("Unexpected incoming control topic %s", topic)
+	}
+}
+
+func TestBuildBroadcastControlTopic(t *testing.T) {
+	topic := NewTopicBuilder().BuildBroadcastControlTopic()
+
+	if topic != "redhat/insights/broadcast/control/in" {
+		t.Fatalf("Unexpected broadcast topic %s", topic)
+	}
+
+	// The broadcast topic must not be mistaken for a client's topic
+	if _, err := verifyTopic(strings.TrimSuffix(topic, "/in") + "/out"); err != ErrInvalidTopicClientID {
+		t.Fatalf("Expected the broadcast client id to be rejected, but got %v", err)
+	}
+}
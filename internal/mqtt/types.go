@@ -3,9 +3,15 @@ package mqtt
 type ControlMessage struct {
 	MessageType string      `json:"type"`
 	MessageID   string      `json:"message_id"` // uuid
+	ResponseTo  string      `json:"response_to,omitempty"`
 	Version     int         `json:"version"`
-	Sent        string      `json:"sent"`
+	Sent        Timestamp   `json:"sent"`
 	Content     interface{} `json:"content"`
+	Signature   string      `json:"signature,omitempty"`
+
+	// CorrelationID ties together the log entries, kafka records and replies that
+	// result from handling the message.  It is not covered by the signature.
+	CorrelationID string `json:"correlation_id,omitempty"`
 }
 
 type ConnectionStatusMessageContent struct {
@@ -21,7 +27,15 @@ type CommandMessageContent struct {
 	Arguments interface{} `json:"arguments"`
 }
 
-type EventMessageContent string // FIXME:  interface{} ??
+type EventMessageContent struct {
+	Event   string      `json:"event"`
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+type ReconnectScheduledEventContent struct {
+	Event string `json:"event"`
+	Delay *int   `json:"delay"`
+}
 
 type CanonicalFacts struct {
 	InsightsID            string   `json:"insights_id"`
@@ -39,10 +53,17 @@ type CatalogServiceFacts struct {
 }
 
 type DataMessage struct {
-	MessageType string      `json:"type"`
-	MessageID   string      `json:"message_id"` // uuid
-	Version     int         `json:"version"`
-	Sent        string      `json:"sent"`
-	Directive   string      `json:"directive"`
-	Content     interface{} `json:"content"`
+	MessageType string            `json:"type"`
+	MessageID   string            `json:"message_id"` // uuid
+	Version     int               `json:"version"`
+	Sent        Timestamp         `json:"sent"`
+	Directive   string            `json:"directive"`
+	Content     interface{}       `json:"content"`
+	Chunk       *DataMessageChunk `json:"chunk,omitempty"`
+}
+
+type DataMessageChunk struct {
+	MessageID string `json:"message_id"`
+	Index     int    `json:"index"`
+	Total     int    `json:"total"`
 }
@@ -0,0 +1,69 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+	"github.com/RedHatInsights/cloud-connector/internal/platform/queue"
+
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	UnverifiableTopicHandlingDrop       = "drop"
+	UnverifiableTopicHandlingDeadLetter = "dead-letter"
+)
+
+// deadLetterWriteTimeout bounds how long the handler waits for room in the dead letter
+// writer's buffer.  The message is dropped if the buffer stays full for longer.
+const deadLetterWriteTimeout = time.Second
+
+var (
+	ErrInvalidUnverifiableTopicHandling = errors.New("Invalid unverifiable topic handling mode")
+	ErrMissingDeadLetterWriter          = errors.New("A dead letter writer is required to dead-letter messages")
+)
+
+// UnverifiableTopicHandler is called when a message is received on a topic that
+// does not match the expected topic structure.  Receiving these messages usually
+// points to a broker ACL or routing misconfiguration.  The handler is called from the
+// message handler, so the dead letter writer is expected to be a bounded async writer.
+type UnverifiableTopicHandler func(topic string, payload []byte, err error)
+
+func NewUnverifiableTopicHandler(mode string, deadLetterWriter queue.Writer, metrics *Metrics) (UnverifiableTopicHandler, error) {
+	switch mode {
+	case UnverifiableTopicHandlingDrop:
+		return func(topic string, payload []byte, err error) {
+			metrics.unverifiableTopicCounter.WithLabelValues(mode).Inc()
+			logger.Log.WithFields(logrus.Fields{"topic": topic, "error": err}).Warn("Dropping message received on an unverifiable topic")
+		}, nil
+	case UnverifiableTopicHandlingDeadLetter:
+		if deadLetterWriter == nil {
+			return nil, ErrMissingDeadLetterWriter
+		}
+		return func(topic string, payload []byte, err error) {
+			metrics.unverifiableTopicCounter.WithLabelValues(mode).Inc()
+			logger := logger.Log.WithFields(logrus.Fields{"topic": topic, "error": err})
+			logger.Warn("Dead-lettering message received on an unverifiable topic")
+
+			deadLetterMsg := kafka.Message{
+				Value: payload,
+				Headers: []kafka.Header{
+					kafka.Header{Key: "mqtt_topic", Value: []byte(topic)},
+					kafka.Header{Key: "reason", Value: []byte(err.Error())},
+				},
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), deadLetterWriteTimeout)
+			defer cancel()
+
+			if err := deadLetterWriter.WriteMessages(ctx, deadLetterMsg); err != nil {
+				logger.WithFields(logrus.Fields{"dead_letter_error": err}).Error("Unable to dead-letter message")
+			}
+		}, nil
+	default:
+		return nil, ErrInvalidUnverifiableTopicHandling
+	}
+}
@@ -0,0 +1,137 @@
+package mqtt
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/RedHatInsights/cloud-connector/internal/platform/queue"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+type recordingWriter struct {
+	messages []kafka.Message
+}
+
+func (rw *recordingWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	rw.messages = append(rw.messages, msgs...)
+	return nil
+}
+
+func TestVerifyTopic(t *testing.T) {
+	var tests = []struct {
+		topic       string
+		clientID    string
+		expectedErr error
+	}{
+		{"redhat/insights/client-1/control/out", "client-1", nil},
+		{"redhat/insights/7c9fe3a6-6c43-4b52-8ef9-2f1b0d4b8a1e/control/out", "7c9fe3a6-6c43-4b52-8ef9-2f1b0d4b8a1e", nil},
+		{"redhat/insights/client-1/control", "", ErrInvalidTopic},
+		{"redhat/insights/client-1/control/in", "", ErrInvalidTopic},
+		{"fedora/insights/client-1/control/out", "", ErrInvalidTopic},
+		{"redhat/insights/client-1/control/out/extra", "", ErrInvalidTopic},
+		{"redhat/insights/client-1/data/out", "client-1", nil},
+		{"redhat/insights/client-1/status/out", "", ErrInvalidTopic},
+		{"redhat/insights//control/out", "", ErrInvalidTopicClientID},
+		{"redhat/insights/+/control/out", "", ErrInvalidTopicClientID},
+		{"redhat/insights/client'; drop table--/control/out", "", ErrInvalidTopicClientID},
+		{"redhat/insights/client\r\nheader/control/out", "", ErrInvalidTopicClientID},
+		{"redhat/insights/.hidden/control/out", "", ErrInvalidTopicClientID},
+		{"redhat/insights/" + strings.Repeat("a", 129) + "/control/out", "", ErrInvalidTopicClientID},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.topic, func(t *testing.T) {
+			clientID, err := verifyTopic(tc.topic)
+			if err != tc.expectedErr {
+				t.Fatalf("Expected error %v, but got %v", tc.expectedErr, err)
+			}
+
+			if string(clientID) != tc.clientID {
+				t.Fatalf("Expected client id %s, but got %s", tc.clientID, clientID)
+			}
+		})
+	}
+}
+
+func TestDeadLetterUnverifiableTopic(t *testing.T) {
+	writer := &recordingWriter{}
+
+	handler, err := NewUnverifiableTopicHandler(UnverifiableTopicHandlingDeadLetter, writer, metrics)
+	if err != nil {
+		t.Fatalf("Unexpected error creating the unverifiable topic handler: %s", err)
+	}
+
+	topic := "redhat/insights/client-1/control/in"
+	_, verifyErr := verifyTopic(topic)
+
+	handler(topic, []byte(`{"type": "connection-status"}`), verifyErr)
+
+	if len(writer.messages) != 1 {
+		t.Fatalf("Expected 1 dead-lettered message, but got %d", len(writer.messages))
+	}
+
+	msg := writer.messages[0]
+
+	if string(msg.Value) != `{"type": "connection-status"}` {
+		t.Fatalf("Expected the original payload to be dead-lettered, but got %s", msg.Value)
+	}
+
+	headers := make(map[string]string)
+	for _, h := range msg.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+
+	if headers["mqtt_topic"] != topic {
+		t.Fatalf("Expected the mqtt_topic header to be %s, but got %s", topic, headers["mqtt_topic"])
+	}
+
+	if headers["reason"] != verifyErr.Error() {
+		t.Fatalf("Expected the reason header to be %s, but got %s", verifyErr.Error(), headers["reason"])
+	}
+}
+
+func TestDeadLetterAfterTheWriterIsClosed(t *testing.T) {
+	writer := queue.NewAsyncWriter(&recordingWriter{}, 1, 1, 1, func([]kafka.Message, error) {})
+	writer.Close()
+
+	handler, err := NewUnverifiableTopicHandler(UnverifiableTopicHandlingDeadLetter, writer, metrics)
+	if err != nil {
+		t.Fatalf("Unexpected error creating the unverifiable topic handler: %s", err)
+	}
+
+	topic := "redhat/insights/client-1/control/in"
+	_, verifyErr := verifyTopic(topic)
+
+	// Messages that arrive while shutting down are dropped instead of panicking
+	handler(topic, []byte("{}"), verifyErr)
+}
+
+func TestDropUnverifiableTopic(t *testing.T) {
+	writer := &recordingWriter{}
+
+	handler, err := NewUnverifiableTopicHandler(UnverifiableTopicHandlingDrop, writer, metrics)
+	if err != nil {
+		t.Fatalf("Unexpected error creating the unverifiable topic handler: %s", err)
+	}
+
+	topic := "redhat/insights/client-1/control/in"
+	_, verifyErr := verifyTopic(topic)
+
+	handler(topic, []byte("{}"), verifyErr)
+
+	if len(writer.messages) != 0 {
+		t.Fatalf("Expected the message to be dropped, but %d were written", len(writer.messages))
+	}
+}
+
+func TestInvalidUnverifiableTopicHandling(t *testing.T) {
+	if _, err := NewUnverifiableTopicHandler("fred", nil, metrics); err != ErrInvalidUnverifiableTopicHandling {
+		t.Fatalf("Expected ErrInvalidUnverifiableTopicHandling, but got %v", err)
+	}
+
+	if _, err := NewUnverifiableTopicHandler(UnverifiableTopicHandlingDeadLetter, nil, metrics); err != ErrMissingDeadLetterWriter {
+		t.Fatalf("Expected ErrMissingDeadLetterWriter, but got %v", err)
+	}
+}
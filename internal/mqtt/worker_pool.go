@@ -0,0 +1,80 @@
+package mqtt
+
+import (
+	"hash/fnv"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+// messageWorkerPool bounds the number of messages that are processed in parallel.
+// Messages are assigned to a worker by topic so that the messages sent by a
+// client are processed in the order they arrived.  Submitting a message blocks
+// when the worker's queue is full.
+type messageWorkerPool struct {
+	queues []chan func()
+}
+
+func newMessageWorkerPool(workers int, queueSize int) *messageWorkerPool {
+	pool := &messageWorkerPool{
+		queues: make([]chan func(), workers),
+	}
+
+	for i := range pool.queues {
+		queue := make(chan func(), queueSize)
+		pool.queues[i] = queue
+
+		go func() {
+			for work := range queue {
+				work()
+			}
+		}()
+	}
+
+	return pool
+}
+
+func (p *messageWorkerPool) submit(key string, work func()) {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+
+	p.queues[h.Sum32()%uint32(len(p.queues))] <- work
+}
+
+// messageWorkerCount determines the size of the worker pool.  A configured
+// count of zero means the size is derived from the number of cpus.
+func messageWorkerCount(configured int, workersPerCPU int, numCPU int) int {
+	if configured > 0 {
+		return configured
+	}
+
+	if workers := workersPerCPU * numCPU; workers > 0 {
+		return workers
+	}
+
+	return 1
+}
+
+// workerPoolMiddleware hands each message off to a pool of workers.  The pool is
+// only started if the middleware is part of the message handler chain.  The messages
+// are tracked as queued until they have been handled so that a shutdown drains the
+// workers' queues as well as the messages that are being processed.
+func workerPoolMiddleware(workers int, queueSize int, inFlight *InFlightMessageTracker) MessageHandlerMiddleware {
+	return func(next MQTT.MessageHandler) MQTT.MessageHandler {
+		logger.Log.WithFields(logrus.Fields{"workers": workers, "queue_size": queueSize}).Info("Starting the message worker pool")
+
+		pool := newMessageWorkerPool(workers, queueSize)
+
+		return func(client MQTT.Client, message MQTT.Message) {
+			done := inFlight.trackQueued()
+
+			pool.submit(message.Topic(), func() {
+				defer done()
+				next(client, message)
+			})
+		}
+	}
+}
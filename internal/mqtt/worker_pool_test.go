@@ -0,0 +1,97 @@
+package mqtt
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+func TestMessageWorkerCount(t *testing.T) {
+	var tests = []struct {
+		name          string
+		configured    int
+		workersPerCPU int
+		numCPU        int
+		expected      int
+	}{
+		{"default derived from cpu count", 0, 4, 2, 8},
+		{"default with a single cpu", 0, 4, 1, 4},
+		{"configured count overrides the default", 3, 4, 2, 3},
+		{"at least one worker", 0, 0, 2, 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := messageWorkerCount(tc.configured, tc.workersPerCPU, tc.numCPU); actual != tc.expected {
+				t.Fatalf("Expected %d workers, got %d", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestWorkerPoolPreservesPerTopicOrder(t *testing.T) {
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	received := make(map[string][]string)
+
+	handler := ChainMessageHandler(func(client MQTT.Client, message MQTT.Message) {
+		defer wg.Done()
+
+		lock.Lock()
+		defer lock.Unlock()
+		received[message.Topic()] = append(received[message.Topic()], string(message.Payload()))
+	}, workerPoolMiddleware(4, 100, NewInFlightMessageTracker()))
+
+	topics := []string{"redhat/insights/client-1/control/out", "redhat/insights/client-2/control/out", "redhat/insights/client-3/control/out"}
+
+	for i := 0; i < 50; i++ {
+		for _, topic := range topics {
+			wg.Add(1)
+			handler(nil, testMessage{topic: topic, payload: []byte(fmt.Sprint(i))})
+		}
+	}
+
+	wg.Wait()
+
+	for _, topic := range topics {
+		if len(received[topic]) != 50 {
+			t.Fatalf("Expected 50 messages on %s, got %d", topic, len(received[topic]))
+		}
+
+		for i, payload := range received[topic] {
+			if payload != fmt.Sprint(i) {
+				t.Fatalf("Expected the messages on %s to be processed in order, got %v", topic, received[topic])
+			}
+		}
+	}
+}
+
+func TestWorkerPoolTracksQueuedMessages(t *testing.T) {
+	inFlight := NewInFlightMessageTracker()
+	release := make(chan struct{})
+
+	handler := ChainMessageHandler(func(client MQTT.Client, message MQTT.Message) {
+		<-release
+	}, workerPoolMiddleware(1, 10, inFlight))
+
+	for i := 0; i < 3; i++ {
+		handler(nil, testMessage{topic: "redhat/insights/client-1/control/out", payload: []byte(fmt.Sprint(i))})
+	}
+
+	if inFlight.Queued() != 3 {
+		t.Fatalf("Expected 3 queued messages, got %d", inFlight.Queued())
+	}
+
+	if inFlight.Wait(10 * time.Millisecond) {
+		t.Fatal("Expected the wait to time out while messages are queued")
+	}
+
+	close(release)
+
+	if inFlight.Wait(time.Second) == false {
+		t.Fatal("Expected the queued messages to be drained")
+	}
+}
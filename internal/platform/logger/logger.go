@@ -3,7 +3,9 @@ package logger
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
 	"os"
 	"strings"
 	"sync"
@@ -21,6 +23,9 @@ var Log *logrus.Logger
 var logLevel logrus.Level
 var initializeLogger sync.Once
 
+var ErrInvalidLogFormat = errors.New("Invalid log format")
+var ErrInvalidLogLevel = errors.New("Invalid log level")
+
 func buildFormatter(format string) logrus.Formatter {
 	switch strings.ToUpper(format) {
 	case "TEXT":
@@ -30,6 +35,30 @@ func buildFormatter(format string) logrus.Formatter {
 	}
 }
 
+// Configure switches the format (text or json) and the level of the logger that
+// InitLogger created.  An empty format or level leaves the current setting in place.
+func Configure(format string, level string) error {
+	switch strings.ToUpper(format) {
+	case "":
+	case "TEXT":
+		Log.SetFormatter(&logrus.TextFormatter{})
+	case "JSON":
+		Log.SetFormatter(NewCloudwatchFormatter())
+	default:
+		return ErrInvalidLogFormat
+	}
+
+	if level != "" {
+		parsedLevel, err := logrus.ParseLevel(level)
+		if err != nil {
+			return ErrInvalidLogLevel
+		}
+		Log.SetLevel(parsedLevel)
+	}
+
+	return nil
+}
+
 // NewCloudwatchFormatter creates a new log formatter
 func NewCloudwatchFormatter() *CustomCloudwatch {
 	f := &CustomCloudwatch{}
@@ -44,7 +73,7 @@ func NewCloudwatchFormatter() *CustomCloudwatch {
 	return f
 }
 
-//Format is the log formatter for the entry
+// Format is the log formatter for the entry
 func (f *CustomCloudwatch) Format(entry *logrus.Entry) ([]byte, error) {
 	b := &bytes.Buffer{}
 
@@ -62,18 +91,14 @@ func (f *CustomCloudwatch) Format(entry *logrus.Entry) ([]byte, error) {
 		"levelname":   entry.Level.String(),
 		"source_host": f.Hostname,
 		"app":         "receptor-controller",
-		"caller":      entry.Caller.Func.Name(),
+	}
+
+	if entry.Caller != nil {
+		data["caller"] = entry.Caller.Function
 	}
 
 	for k, v := range entry.Data {
-		switch v := v.(type) {
-		case error:
-			data[k] = v.Error()
-		case Marshaler:
-			data[k] = v.MarshalLog()
-		default:
-			data[k] = v
-		}
+		data[k] = jsonLogValue(v)
 	}
 
 	j, err := json.Marshal(data)
@@ -86,6 +111,26 @@ func (f *CustomCloudwatch) Format(entry *logrus.Entry) ([]byte, error) {
 	return b.Bytes(), nil
 }
 
+// jsonLogValue converts the value of a field into a value that can be serialized as
+// JSON.  Values that cannot be serialized are logged using their string representation
+// rather than failing to log the entire entry.
+func jsonLogValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case error:
+		return v.Error()
+	case Marshaler:
+		return v.MarshalLog()
+	case time.Duration:
+		return v.String()
+	}
+
+	if _, err := json.Marshal(value); err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+
+	return value
+}
+
 // InitLogger initializes the logger instance
 func InitLogger() {
 
@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type testMarshaler struct{}
+
+func (testMarshaler) MarshalLog() map[string]interface{} {
+	return map[string]interface{}{"marshaled": true}
+}
+
+func TestConfigure(t *testing.T) {
+	InitLogger()
+
+	formatter, level := Log.Formatter, Log.Level
+	defer func() {
+		Log.SetFormatter(formatter)
+		Log.SetLevel(level)
+	}()
+
+	if err := Configure("json", "warn"); err != nil {
+		t.Fatalf("Unexpected error configuring the logger: %s", err)
+	}
+
+	if _, ok := Log.Formatter.(*CustomCloudwatch); ok == false || Log.Level != logrus.WarnLevel {
+		t.Fatalf("Expected the json formatter at the warn level, got %T at %s", Log.Formatter, Log.Level)
+	}
+
+	if err := Configure("", ""); err != nil || Log.Level != logrus.WarnLevel {
+		t.Fatalf("Expected empty settings to leave the logger unchanged")
+	}
+
+	if err := Configure("text", "debug"); err != nil {
+		t.Fatalf("Unexpected error configuring the logger: %s", err)
+	}
+
+	if _, ok := Log.Formatter.(*logrus.TextFormatter); ok == false || Log.Level != logrus.DebugLevel {
+		t.Fatalf("Expected the text formatter at the debug level, got %T at %s", Log.Formatter, Log.Level)
+	}
+
+	if err := Configure("xml", ""); err != ErrInvalidLogFormat {
+		t.Fatalf("Expected %v, got %v", ErrInvalidLogFormat, err)
+	}
+
+	if err := Configure("", "loud"); err != ErrInvalidLogLevel {
+		t.Fatalf("Expected %v, got %v", ErrInvalidLogLevel, err)
+	}
+}
+
+func TestJsonFormatterSerializesFields(t *testing.T) {
+	entry := logrus.NewEntry(logrus.New()).WithFields(logrus.Fields{
+		"error":      errors.New("broken"),
+		"duration":   90 * time.Second,
+		"marshaler":  testMarshaler{},
+		"channel":    make(chan int),
+		"client_ids": []string{"client-1"},
+	})
+	entry.Message = "hello"
+
+	formatted, err := NewCloudwatchFormatter().Format(entry)
+	if err != nil {
+		t.Fatalf("Unexpected error formatting the entry: %s", err)
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(formatted, &data); err != nil {
+		t.Fatalf("Expected the entry to be valid JSON, got %s", formatted)
+	}
+
+	if data["message"] != "hello" || data["error"] != "broken" || data["duration"] != "1m30s" {
+		t.Fatalf("Unexpected fields: %s", formatted)
+	}
+
+	if _, ok := data["channel"].(string); ok == false {
+		t.Fatalf("Expected the channel to be logged as a string, got %s", formatted)
+	}
+
+	if marshaled, ok := data["marshaler"].(map[string]interface{}); ok == false || marshaled["marshaled"] != true {
+		t.Fatalf("Expected the marshaler's fields to be logged, got %s", formatted)
+	}
+}
@@ -5,7 +5,7 @@ type CustomCloudwatch struct {
 	Hostname string
 }
 
-//Marshaler is an interface any type can implement to change its output in our production logs.
+// Marshaler is an interface any type can implement to change its output in our production logs.
 type Marshaler interface {
 	MarshalLog() map[string]interface{}
 }
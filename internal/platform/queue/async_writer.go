@@ -0,0 +1,143 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrWriterClosed is returned when messages are written after the writer was closed
+var ErrWriterClosed = errors.New("The writer has been closed")
+
+// WriteFailureHandler is called by the AsyncWriter when a batch of messages could
+// not be written
+type WriteFailureHandler func(messages []kafka.Message, err error)
+
+// NewWriteFailureHandler returns a handler that logs the failure.  The process is
+// stopped if fatal is true.
+func NewWriteFailureHandler(fatal bool) WriteFailureHandler {
+	return func(messages []kafka.Message, err error) {
+		logger := logger.Log.WithFields(logrus.Fields{"error": err, "messages": len(messages)})
+		if fatal {
+			logger.Fatal("Unable to write messages to kafka")
+		} else {
+			logger.Error("Unable to write messages to kafka")
+		}
+	}
+}
+
+// AsyncWriter hands the messages off to a fixed number of workers that write them to
+// the wrapped writer.  WriteMessages blocks while the buffer is full, which pushes back
+// on the caller instead of queueing an unbounded amount of work.  The workers write the
+// messages that are waiting in the buffer in batches of up to batchSize messages.
+type AsyncWriter struct {
+	writer    Writer
+	messages  chan kafka.Message
+	batchSize int
+	onFailure WriteFailureHandler
+	wg        sync.WaitGroup
+	closed    bool
+	closeLock sync.RWMutex
+}
+
+func NewAsyncWriter(writer Writer, workers int, bufferSize int, batchSize int, onFailure WriteFailureHandler) *AsyncWriter {
+	if workers < 1 {
+		workers = 1
+	}
+
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	aw := &AsyncWriter{
+		writer:    writer,
+		messages:  make(chan kafka.Message, bufferSize),
+		batchSize: batchSize,
+		onFailure: onFailure,
+	}
+
+	aw.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go aw.work()
+	}
+
+	return aw
+}
+
+// WriteMessages buffers the messages.  The messages that do not have a time are given
+// the time that they were buffered.  An error is returned if the context expires while
+// waiting for room in the buffer or if the writer has been closed.
+func (aw *AsyncWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	aw.closeLock.RLock()
+	defer aw.closeLock.RUnlock()
+
+	if aw.closed {
+		return ErrWriterClosed
+	}
+
+	now := time.Now()
+
+	for _, msg := range msgs {
+		if msg.Time.IsZero() {
+			msg.Time = now
+		}
+
+		select {
+		case aw.messages <- msg:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// Close waits for the buffered messages to be written.  Writes that are waiting for
+// room in the buffer are finished first.  Messages written after the writer has been
+// closed are rejected with ErrWriterClosed.
+func (aw *AsyncWriter) Close() {
+	aw.closeLock.Lock()
+	if aw.closed {
+		aw.closeLock.Unlock()
+		return
+	}
+	aw.closed = true
+	close(aw.messages)
+	aw.closeLock.Unlock()
+
+	aw.wg.Wait()
+}
+
+func (aw *AsyncWriter) work() {
+	defer aw.wg.Done()
+
+	for msg := range aw.messages {
+		batch := aw.fillBatch([]kafka.Message{msg})
+
+		if err := aw.writer.WriteMessages(context.Background(), batch...); err != nil {
+			aw.onFailure(batch, err)
+		}
+	}
+}
+
+// fillBatch adds the messages that are already waiting in the buffer to the batch
+func (aw *AsyncWriter) fillBatch(batch []kafka.Message) []kafka.Message {
+	for len(batch) < aw.batchSize {
+		select {
+		case msg, ok := <-aw.messages:
+			if ok == false {
+				return batch
+			}
+			batch = append(batch, msg)
+		default:
+			return batch
+		}
+	}
+
+	return batch
+}
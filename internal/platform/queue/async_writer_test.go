@@ -0,0 +1,164 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// blockingWriter records the batches that it writes.  Writes block until the
+// writer is released.
+type blockingWriter struct {
+	release chan struct{}
+	batches [][]kafka.Message
+	err     error
+	sync.Mutex
+}
+
+func newBlockingWriter() *blockingWriter {
+	return &blockingWriter{release: make(chan struct{})}
+}
+
+func (bw *blockingWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	<-bw.release
+
+	bw.Lock()
+	defer bw.Unlock()
+	bw.batches = append(bw.batches, msgs)
+
+	return bw.err
+}
+
+func (bw *blockingWriter) messageCount() int {
+	bw.Lock()
+	defer bw.Unlock()
+
+	count := 0
+	for _, batch := range bw.batches {
+		count += len(batch)
+	}
+	return count
+}
+
+func ignoreWriteFailures(messages []kafka.Message, err error) {}
+
+func TestAsyncWriterBlocksWhenTheBufferIsFull(t *testing.T) {
+	bw := newBlockingWriter()
+	aw := NewAsyncWriter(bw, 1, 2, 1, ignoreWriteFailures)
+
+	// The worker takes the first message and blocks writing it, the next two
+	// messages fill the buffer
+	for _, v := range []string{"1", "2", "3"} {
+		if err := aw.WriteMessages(context.TODO(), kafka.Message{Value: []byte(v)}); err != nil {
+			t.Fatalf("Unexpected error buffering message %s: %s", v, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := aw.WriteMessages(ctx, kafka.Message{Value: []byte("4")}); err != context.DeadlineExceeded {
+		t.Fatalf("Expected the write to block while the buffer is full, got %v", err)
+	}
+
+	close(bw.release)
+	aw.Close()
+
+	if bw.messageCount() != 3 {
+		t.Fatalf("Expected the 3 buffered messages to be written, got %d", bw.messageCount())
+	}
+}
+
+func TestAsyncWriterWritesInBatches(t *testing.T) {
+	bw := newBlockingWriter()
+	aw := NewAsyncWriter(bw, 1, 10, 3, ignoreWriteFailures)
+
+	for _, v := range []string{"1", "2", "3", "4", "5"} {
+		aw.WriteMessages(context.TODO(), kafka.Message{Value: []byte(v)})
+	}
+
+	close(bw.release)
+	aw.Close()
+
+	if bw.messageCount() != 5 {
+		t.Fatalf("Expected 5 messages to be written, got %d", bw.messageCount())
+	}
+
+	for _, batch := range bw.batches {
+		if len(batch) > 3 {
+			t.Fatalf("Expected batches of at most 3 messages, got %d", len(batch))
+		}
+	}
+
+	if len(bw.batches) == 5 {
+		t.Fatalf("Expected the buffered messages to be batched")
+	}
+}
+
+func TestAsyncWriterReportsWriteFailures(t *testing.T) {
+	bw := newBlockingWriter()
+	bw.err = errors.New("leader not available")
+	close(bw.release)
+
+	var failed []kafka.Message
+	var failure error
+	var mu sync.Mutex
+	aw := NewAsyncWriter(bw, 2, 10, 1, func(messages []kafka.Message, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed = append(failed, messages...)
+		failure = err
+	})
+
+	aw.WriteMessages(context.TODO(), kafka.Message{Value: []byte("1")}, kafka.Message{Value: []byte("2")})
+	aw.Close()
+
+	if len(failed) != 2 || failure != bw.err {
+		t.Fatalf("Expected both failed messages to be reported, got %d (%v)", len(failed), failure)
+	}
+}
+
+func TestAsyncWriterRejectsWritesAfterClose(t *testing.T) {
+	bw := newBlockingWriter()
+	close(bw.release)
+
+	aw := NewAsyncWriter(bw, 1, 2, 1, ignoreWriteFailures)
+	aw.Close()
+
+	// Must not panic by sending on the closed buffer
+	if err := aw.WriteMessages(context.TODO(), kafka.Message{Value: []byte("1")}); err != ErrWriterClosed {
+		t.Fatalf("Expected ErrWriterClosed, got %v", err)
+	}
+
+	aw.Close()
+}
+
+func TestAsyncWriterSetsTheMessageTime(t *testing.T) {
+	bw := newBlockingWriter()
+	close(bw.release)
+
+	aw := NewAsyncWriter(bw, 1, 2, 1, ignoreWriteFailures)
+
+	sent := time.Now().Add(-time.Minute)
+	aw.WriteMessages(context.TODO(), kafka.Message{Value: []byte("1")}, kafka.Message{Value: []byte("2"), Time: sent})
+	aw.Close()
+
+	times := make(map[string]time.Time)
+	for _, batch := range bw.batches {
+		for _, msg := range batch {
+			times[string(msg.Value)] = msg.Time
+		}
+	}
+
+	if times["1"].IsZero() {
+		t.Fatalf("Expected the buffered message to be given a time")
+	}
+
+	if times["2"].Equal(sent) == false {
+		t.Fatalf("Expected the message's own time to be kept, got %v", times["2"])
+	}
+}
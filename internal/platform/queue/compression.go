@@ -0,0 +1,114 @@
+package queue
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ContentEncodingHeader = "content-encoding"
+	GzipContentEncoding   = "gzip"
+)
+
+// ErrDecompressedValueTooLarge is returned when a compressed value expands to more
+// than the max size
+var ErrDecompressedValueTooLarge = errors.New("Decompressed message value is too large")
+
+// CompressingWriter gzips the values of the messages before passing them to the
+// wrapped writer.  The compressed messages get a content-encoding header so that
+// the consumers know to decompress them (see DecompressValue).  Values smaller than
+// the threshold are written as they are because compressing them saves little or
+// even makes them larger.
+type CompressingWriter struct {
+	writer    Writer
+	threshold int
+}
+
+func NewCompressingWriter(writer Writer, threshold int) *CompressingWriter {
+	return &CompressingWriter{writer: writer, threshold: threshold}
+}
+
+func (cw *CompressingWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	compressed := make([]kafka.Message, len(msgs))
+
+	for i, msg := range msgs {
+		compressed[i] = cw.compress(msg)
+	}
+
+	return cw.writer.WriteMessages(ctx, compressed...)
+}
+
+func (cw *CompressingWriter) compress(msg kafka.Message) kafka.Message {
+	if len(msg.Value) < cw.threshold {
+		return msg
+	}
+
+	value, err := gzipValue(msg.Value)
+	if err != nil {
+		// The message is still usable, it is just bigger than it needs to be
+		logger.Log.WithFields(logrus.Fields{"error": err}).Warn("Unable to compress the kafka message, writing it uncompressed")
+		return msg
+	}
+
+	headers := make([]kafka.Header, 0, len(msg.Headers)+1)
+	headers = append(headers, msg.Headers...)
+	headers = append(headers, kafka.Header{Key: ContentEncodingHeader, Value: []byte(GzipContentEncoding)})
+
+	msg.Value = value
+	msg.Headers = headers
+
+	return msg
+}
+
+func gzipValue(value []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(value); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DecompressValue returns the message's value, decompressing it if the message was
+// written by a CompressingWriter.  At most maxSize bytes are decompressed so that a
+// small message cannot expand into an unbounded amount of memory.
+func DecompressValue(msg kafka.Message, maxSize int) ([]byte, error) {
+	for _, header := range msg.Headers {
+		if header.Key == ContentEncodingHeader && string(header.Value) == GzipContentEncoding {
+			r, err := gzip.NewReader(bytes.NewReader(msg.Value))
+			if err != nil {
+				return nil, err
+			}
+			defer r.Close()
+
+			// Read one byte more than allowed to tell a value of exactly maxSize bytes
+			// apart from a larger one
+			value, err := ioutil.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+			if err != nil {
+				return nil, err
+			}
+
+			if len(value) > maxSize {
+				return nil, ErrDecompressedValueTooLarge
+			}
+
+			return value, nil
+		}
+	}
+
+	return msg.Value, nil
+}
@@ -0,0 +1,85 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+func contentEncoding(msg kafka.Message) string {
+	for _, header := range msg.Headers {
+		if header.Key == ContentEncodingHeader {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func TestCompressingWriter(t *testing.T) {
+	large := bytes.Repeat([]byte(`{"url": "https://cloud.redhat.com/api/playbook"}`), 100)
+	small := []byte(`{"event": "job-progress"}`)
+
+	writer := &flakyWriter{}
+
+	err := NewCompressingWriter(writer, 1024).WriteMessages(context.TODO(),
+		kafka.Message{Value: large, Headers: []kafka.Header{{Key: "client_id", Value: []byte("client-1")}}},
+		kafka.Message{Value: small})
+	if err != nil {
+		t.Fatalf("Unexpected error writing the messages: %s", err)
+	}
+
+	compressed, uncompressed := writer.written[0], writer.written[1]
+
+	if contentEncoding(compressed) != GzipContentEncoding || len(compressed.Value) >= len(large) {
+		t.Fatalf("Expected the large message to be compressed, got %d bytes with encoding %q", len(compressed.Value), contentEncoding(compressed))
+	}
+
+	if len(compressed.Headers) != 2 || compressed.Headers[0].Key != "client_id" {
+		t.Fatalf("Expected the existing headers to be kept, got %v", compressed.Headers)
+	}
+
+	if contentEncoding(uncompressed) != "" || bytes.Equal(uncompressed.Value, small) == false {
+		t.Fatalf("Expected the small message to be left uncompressed, got %s", uncompressed.Value)
+	}
+
+	for i, expected := range [][]byte{large, small} {
+		value, err := DecompressValue(writer.written[i], 1048576)
+		if err != nil {
+			t.Fatalf("Unexpected error decompressing the message: %s", err)
+		}
+
+		if bytes.Equal(value, expected) == false {
+			t.Fatalf("Expected the decompressed value to match the original value, got %s", value)
+		}
+	}
+}
+
+func TestDecompressInvalidValue(t *testing.T) {
+	msg := kafka.Message{
+		Value:   []byte("not gzipped"),
+		Headers: []kafka.Header{{Key: ContentEncodingHeader, Value: []byte(GzipContentEncoding)}},
+	}
+
+	if _, err := DecompressValue(msg, 1048576); err == nil {
+		t.Fatalf("Expected an error decompressing an invalid value")
+	}
+}
+
+func TestDecompressValueEnforcesTheMaxSize(t *testing.T) {
+	value := bytes.Repeat([]byte("a"), 1024)
+
+	writer := &flakyWriter{}
+	if err := NewCompressingWriter(writer, 0).WriteMessages(context.TODO(), kafka.Message{Value: value}); err != nil {
+		t.Fatalf("Unexpected error writing the message: %s", err)
+	}
+
+	if decompressed, err := DecompressValue(writer.written[0], len(value)); err != nil || len(decompressed) != len(value) {
+		t.Fatalf("Expected a value of exactly the max size to be decompressed, got %d bytes (%v)", len(decompressed), err)
+	}
+
+	if _, err := DecompressValue(writer.written[0], len(value)-1); err != ErrDecompressedValueTooLarge {
+		t.Fatalf("Expected %s, got %v", ErrDecompressedValueTooLarge, err)
+	}
+}
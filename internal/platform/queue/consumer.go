@@ -1,10 +1,19 @@
 package queue
 
 import (
+	"context"
+
 	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
 	kafka "github.com/segmentio/kafka-go"
 )
 
+// Reader is the subset of the kafka.Reader api that is needed to consume messages and
+// explicitly commit their offsets
+type Reader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
 func StartConsumer(cfg *ConsumerConfig) *kafka.Reader {
 	logger.Log.Info("Starting a new kafka consumer...")
 	logger.Log.Info("Kafka consumer configuration: ", cfg)
@@ -0,0 +1,210 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	PausedTopicModeBuffer = "buffer"
+	PausedTopicModeDrop   = "drop"
+)
+
+var (
+	ErrInvalidPausedTopicMode = errors.New("invalid paused topic mode")
+	ErrResumeInProgress       = errors.New("the topic is already being resumed")
+)
+
+// Writer is the subset of the kafka.Writer api that is needed to produce messages
+type Writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+type topicState struct {
+	paused   bool
+	resuming bool
+	buffered []kafka.Message
+	writer   Writer
+}
+
+// ForwardingController allows forwarding of messages to individual kafka topics
+// to be paused and resumed without stopping the forwarding to the other topics.
+// Messages written to a paused topic are either buffered (up to bufferSize messages)
+// or dropped depending upon the configured mode.
+type ForwardingController struct {
+	mode       string
+	bufferSize int
+	topics     map[string]*topicState
+	sync.Mutex
+}
+
+func NewForwardingController(mode string, bufferSize int) (*ForwardingController, error) {
+	if mode != PausedTopicModeBuffer && mode != PausedTopicModeDrop {
+		return nil, ErrInvalidPausedTopicMode
+	}
+
+	return &ForwardingController{
+		mode:       mode,
+		bufferSize: bufferSize,
+		topics:     make(map[string]*topicState),
+	}, nil
+}
+
+// Writer wraps the writer for the topic so that writes to the topic honor the
+// paused / resumed state of the topic
+func (fc *ForwardingController) Writer(topic string, writer Writer) Writer {
+	fc.Lock()
+	defer fc.Unlock()
+
+	fc.getTopicState(topic).writer = writer
+
+	return &pausableWriter{topic: topic, controller: fc}
+}
+
+func (fc *ForwardingController) Pause(topic string) {
+	fc.Lock()
+	defer fc.Unlock()
+
+	state := fc.getTopicState(topic)
+	if state.paused {
+		return
+	}
+
+	state.paused = true
+	metrics.pausedTopicGauge.Inc()
+
+	logger.Log.WithFields(logrus.Fields{"topic": topic, "mode": fc.mode}).Info("Paused forwarding to kafka topic")
+}
+
+// Resume writes any buffered messages to the topic and then unpauses the topic.  The
+// buffered messages are written without holding the lock so that writes to the other
+// topics are not blocked.  Messages that are written to the topic while the buffered
+// messages are being written are buffered too and are written before the topic is
+// unpaused, so the order of the messages is preserved.  If a write fails, the messages
+// that were not written are buffered again and the topic stays paused.
+func (fc *ForwardingController) Resume(ctx context.Context, topic string) error {
+	fc.Lock()
+
+	state, exists := fc.topics[topic]
+	if exists == false || state.paused == false {
+		fc.Unlock()
+		return nil
+	}
+
+	if state.resuming {
+		fc.Unlock()
+		return ErrResumeInProgress
+	}
+
+	state.resuming = true
+	writer := state.writer
+
+	fc.Unlock()
+
+	logger := logger.Log.WithFields(logrus.Fields{"topic": topic})
+
+	for {
+		fc.Lock()
+		buffered := state.buffered
+		state.buffered = nil
+
+		if len(buffered) == 0 || writer == nil {
+			state.paused = false
+			state.resuming = false
+			metrics.pausedTopicGauge.Dec()
+			metrics.pausedTopicBufferedMessageGauge.WithLabelValues(topic).Set(0)
+			fc.Unlock()
+			break
+		}
+		fc.Unlock()
+
+		logger.Infof("Writing %d buffered messages", len(buffered))
+
+		if err := writer.WriteMessages(ctx, buffered...); err != nil {
+			logger.WithFields(logrus.Fields{"error": err}).Error("Unable to write buffered messages")
+
+			fc.Lock()
+			state.buffered = append(buffered, state.buffered...)
+			state.resuming = false
+			metrics.pausedTopicBufferedMessageGauge.WithLabelValues(topic).Set(float64(len(state.buffered)))
+			fc.Unlock()
+
+			return err
+		}
+	}
+
+	logger.Info("Resumed forwarding to kafka topic")
+
+	return nil
+}
+
+func (fc *ForwardingController) PausedTopics() []string {
+	fc.Lock()
+	defer fc.Unlock()
+
+	pausedTopics := []string{}
+	for topic, state := range fc.topics {
+		if state.paused {
+			pausedTopics = append(pausedTopics, topic)
+		}
+	}
+
+	sort.Strings(pausedTopics)
+
+	return pausedTopics
+}
+
+func (fc *ForwardingController) getTopicState(topic string) *topicState {
+	state, exists := fc.topics[topic]
+	if exists == false {
+		state = &topicState{}
+		fc.topics[topic] = state
+	}
+	return state
+}
+
+func (fc *ForwardingController) writeMessages(ctx context.Context, topic string, msgs ...kafka.Message) error {
+	fc.Lock()
+
+	state := fc.getTopicState(topic)
+
+	if state.paused == false {
+		writer := state.writer
+		fc.Unlock()
+		return writer.WriteMessages(ctx, msgs...)
+	}
+
+	defer fc.Unlock()
+
+	if fc.mode == PausedTopicModeDrop {
+		metrics.pausedTopicDroppedMessageCounter.WithLabelValues(topic).Add(float64(len(msgs)))
+		return nil
+	}
+
+	for _, msg := range msgs {
+		if len(state.buffered) >= fc.bufferSize {
+			metrics.pausedTopicDroppedMessageCounter.WithLabelValues(topic).Inc()
+			continue
+		}
+		state.buffered = append(state.buffered, msg)
+	}
+
+	metrics.pausedTopicBufferedMessageGauge.WithLabelValues(topic).Set(float64(len(state.buffered)))
+
+	return nil
+}
+
+type pausableWriter struct {
+	topic      string
+	controller *ForwardingController
+}
+
+func (pw *pausableWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	return pw.controller.writeMessages(ctx, pw.topic, msgs...)
+}
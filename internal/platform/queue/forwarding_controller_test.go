@@ -0,0 +1,238 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+func init() {
+	logger.InitLogger()
+}
+
+type mockWriter struct {
+	messages []kafka.Message
+}
+
+func (mw *mockWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	mw.messages = append(mw.messages, msgs...)
+	return nil
+}
+
+func newForwardingController(t *testing.T, mode string, bufferSize int) *ForwardingController {
+	fc, err := NewForwardingController(mode, bufferSize)
+	if err != nil {
+		t.Fatalf("Unexpected error creating the forwarding controller: %s", err)
+	}
+	return fc
+}
+
+func TestInvalidPausedTopicMode(t *testing.T) {
+	_, err := NewForwardingController("fred", 10)
+	if err != ErrInvalidPausedTopicMode {
+		t.Fatalf("Expected ErrInvalidPausedTopicMode, but got %v", err)
+	}
+}
+
+func TestWriteToUnpausedTopic(t *testing.T) {
+	fc := newForwardingController(t, PausedTopicModeBuffer, 10)
+	mw := &mockWriter{}
+	w := fc.Writer("topic-a", mw)
+
+	w.WriteMessages(context.TODO(), kafka.Message{Value: []byte("1")})
+
+	if len(mw.messages) != 1 {
+		t.Fatalf("Expected 1 message to be written, but %d were written", len(mw.messages))
+	}
+}
+
+func TestPauseAndResumeTopicInBufferMode(t *testing.T) {
+	fc := newForwardingController(t, PausedTopicModeBuffer, 10)
+	pausedWriter := &mockWriter{}
+	activeWriter := &mockWriter{}
+	pw := fc.Writer("topic-a", pausedWriter)
+	aw := fc.Writer("topic-b", activeWriter)
+
+	fc.Pause("topic-a")
+
+	pw.WriteMessages(context.TODO(), kafka.Message{Value: []byte("1")}, kafka.Message{Value: []byte("2")})
+	aw.WriteMessages(context.TODO(), kafka.Message{Value: []byte("3")})
+
+	if len(pausedWriter.messages) != 0 {
+		t.Fatalf("Expected no messages to be written to the paused topic, but %d were written", len(pausedWriter.messages))
+	}
+
+	if len(activeWriter.messages) != 1 {
+		t.Fatalf("Expected 1 message to be written to the active topic, but %d were written", len(activeWriter.messages))
+	}
+
+	if err := fc.Resume(context.TODO(), "topic-a"); err != nil {
+		t.Fatalf("Unexpected error resuming topic: %s", err)
+	}
+
+	if len(pausedWriter.messages) != 2 {
+		t.Fatalf("Expected the 2 buffered messages to be written on resume, but %d were written", len(pausedWriter.messages))
+	}
+
+	if string(pausedWriter.messages[0].Value) != "1" || string(pausedWriter.messages[1].Value) != "2" {
+		t.Fatalf("Expected buffered messages to be written in order")
+	}
+
+	pw.WriteMessages(context.TODO(), kafka.Message{Value: []byte("4")})
+
+	if len(pausedWriter.messages) != 3 {
+		t.Fatalf("Expected messages to flow after resume, but %d were written", len(pausedWriter.messages))
+	}
+}
+
+func TestPausedTopicBufferIsBounded(t *testing.T) {
+	fc := newForwardingController(t, PausedTopicModeBuffer, 2)
+	mw := &mockWriter{}
+	w := fc.Writer("topic-a", mw)
+
+	fc.Pause("topic-a")
+
+	for _, v := range []string{"1", "2", "3"} {
+		w.WriteMessages(context.TODO(), kafka.Message{Value: []byte(v)})
+	}
+
+	fc.Resume(context.TODO(), "topic-a")
+
+	if len(mw.messages) != 2 {
+		t.Fatalf("Expected 2 buffered messages to be written on resume, but %d were written", len(mw.messages))
+	}
+}
+
+func TestPauseAndResumeTopicInDropMode(t *testing.T) {
+	fc := newForwardingController(t, PausedTopicModeDrop, 10)
+	mw := &mockWriter{}
+	w := fc.Writer("topic-a", mw)
+
+	fc.Pause("topic-a")
+
+	if err := w.WriteMessages(context.TODO(), kafka.Message{Value: []byte("1")}); err != nil {
+		t.Fatalf("Expected dropped message to not return an error, but got %s", err)
+	}
+
+	fc.Resume(context.TODO(), "topic-a")
+
+	if len(mw.messages) != 0 {
+		t.Fatalf("Expected paused messages to be dropped, but %d were written", len(mw.messages))
+	}
+
+	w.WriteMessages(context.TODO(), kafka.Message{Value: []byte("2")})
+
+	if len(mw.messages) != 1 {
+		t.Fatalf("Expected messages to flow after resume, but %d were written", len(mw.messages))
+	}
+}
+
+func TestPausedTopics(t *testing.T) {
+	fc := newForwardingController(t, PausedTopicModeDrop, 10)
+
+	fc.Pause("topic-b")
+	fc.Pause("topic-a")
+	fc.Pause("topic-c")
+	fc.Resume(context.TODO(), "topic-c")
+
+	pausedTopics := fc.PausedTopics()
+	if len(pausedTopics) != 2 || pausedTopics[0] != "topic-a" || pausedTopics[1] != "topic-b" {
+		t.Fatalf("Unexpected paused topics: %v", pausedTopics)
+	}
+}
+
+// pausingWriter blocks the first write until it is released and fails the writes
+// while failing is set
+type pausingWriter struct {
+	mockWriter
+	started chan struct{}
+	release chan struct{}
+	failing bool
+}
+
+func (bw *pausingWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if bw.started != nil {
+		close(bw.started)
+		bw.started = nil
+		<-bw.release
+	}
+
+	if bw.failing {
+		return errors.New("write failed")
+	}
+
+	return bw.mockWriter.WriteMessages(ctx, msgs...)
+}
+
+func TestResumeDoesNotHoldTheLockWhileWriting(t *testing.T) {
+	fc := newForwardingController(t, PausedTopicModeBuffer, 10)
+	bw := &pausingWriter{started: make(chan struct{}), release: make(chan struct{})}
+	w := fc.Writer("topic-a", bw)
+	other := &mockWriter{}
+	ow := fc.Writer("topic-b", other)
+
+	fc.Pause("topic-a")
+	w.WriteMessages(context.TODO(), kafka.Message{Value: []byte("1")})
+
+	started := bw.started
+	resumed := make(chan error)
+	go func() { resumed <- fc.Resume(context.TODO(), "topic-a") }()
+	<-started
+
+	// The other topics and the resuming topic can be written to during the flush
+	ow.WriteMessages(context.TODO(), kafka.Message{Value: []byte("a")})
+	w.WriteMessages(context.TODO(), kafka.Message{Value: []byte("2")})
+
+	if err := fc.Resume(context.TODO(), "topic-a"); err != ErrResumeInProgress {
+		t.Fatalf("Expected ErrResumeInProgress, but got %v", err)
+	}
+
+	close(bw.release)
+
+	if err := <-resumed; err != nil {
+		t.Fatalf("Unexpected error resuming topic: %s", err)
+	}
+
+	if len(other.messages) != 1 {
+		t.Fatalf("Expected the other topic to be written to during the flush, but %d were written", len(other.messages))
+	}
+
+	if len(bw.messages) != 2 || string(bw.messages[0].Value) != "1" || string(bw.messages[1].Value) != "2" {
+		t.Fatalf("Expected the buffered messages to be written in order, got %v", bw.messages)
+	}
+
+	if len(fc.PausedTopics()) != 0 {
+		t.Fatalf("Expected the topic to be resumed, got %v", fc.PausedTopics())
+	}
+}
+
+func TestFailedResumeKeepsTheBufferedMessages(t *testing.T) {
+	fc := newForwardingController(t, PausedTopicModeBuffer, 10)
+	bw := &pausingWriter{failing: true}
+	w := fc.Writer("topic-a", bw)
+
+	fc.Pause("topic-a")
+	w.WriteMessages(context.TODO(), kafka.Message{Value: []byte("1")})
+
+	if err := fc.Resume(context.TODO(), "topic-a"); err == nil {
+		t.Fatal("Expected the failed write to be returned")
+	}
+
+	if len(fc.PausedTopics()) != 1 {
+		t.Fatalf("Expected the topic to stay paused, got %v", fc.PausedTopics())
+	}
+
+	bw.failing = false
+
+	if err := fc.Resume(context.TODO(), "topic-a"); err != nil {
+		t.Fatalf("Unexpected error resuming topic: %s", err)
+	}
+
+	if len(bw.messages) != 1 {
+		t.Fatalf("Expected the buffered message to be written, but %d were written", len(bw.messages))
+	}
+}
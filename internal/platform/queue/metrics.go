@@ -0,0 +1,69 @@
+package queue
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+type Metrics struct {
+	pausedTopicGauge                 prometheus.Gauge
+	pausedTopicBufferedMessageGauge  *prometheus.GaugeVec
+	pausedTopicDroppedMessageCounter *prometheus.CounterVec
+	kafkaWriteSuccessCounter         *prometheus.CounterVec
+	kafkaWriteFailureCounter         *prometheus.CounterVec
+	kafkaWriteLatency                *prometheus.HistogramVec
+	retryQueueDepthGauge             prometheus.Gauge
+	retryQueueDroppedMessageCounter  prometheus.Counter
+}
+
+// NewMetrics creates the metrics and registers them with reg
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	metrics := new(Metrics)
+	factory := promauto.With(reg)
+
+	metrics.pausedTopicGauge = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "cloud_connector_kafka_paused_topic_count",
+		Help: "The number of kafka topics that forwarding has been paused for",
+	})
+
+	metrics.pausedTopicBufferedMessageGauge = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cloud_connector_kafka_paused_topic_buffered_message_count",
+		Help: "The number of messages buffered while forwarding to the kafka topic is paused",
+	}, []string{"topic"})
+
+	metrics.pausedTopicDroppedMessageCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_kafka_paused_topic_dropped_message_count",
+		Help: "The number of messages dropped while forwarding to the kafka topic was paused",
+	}, []string{"topic"})
+
+	metrics.kafkaWriteSuccessCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_kafka_write_success_count",
+		Help: "The number of messages that were successfully written to the kafka topic",
+	}, []string{"topic"})
+
+	metrics.kafkaWriteFailureCounter = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_connector_kafka_write_failure_count",
+		Help: "The number of messages that could not be written to the kafka topic",
+	}, []string{"topic"})
+
+	metrics.kafkaWriteLatency = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "cloud_connector_kafka_write_latency_seconds",
+		Help: "The time between a message's time and the completion of the write to the kafka topic",
+	}, []string{"topic"})
+
+	metrics.retryQueueDepthGauge = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "cloud_connector_kafka_retry_queue_depth",
+		Help: "The number of messages waiting to be retried after a failed kafka write",
+	})
+
+	metrics.retryQueueDroppedMessageCounter = factory.NewCounter(prometheus.CounterOpts{
+		Name: "cloud_connector_kafka_retry_queue_dropped_message_count",
+		Help: "The number of messages dropped because the kafka retry queue was full",
+	})
+
+	return metrics
+}
+
+var (
+	metrics = NewMetrics(prometheus.DefaultRegisterer)
+)
@@ -1,11 +1,15 @@
 package queue
 
 import (
+	"errors"
+	"time"
+
 	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
 	kafka "github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
 )
 
-func StartProducer(cfg *ProducerConfig) *kafka.Writer {
+func StartProducer(cfg *ProducerConfig) *Producer {
 	logger.Log.Info("Starting a new Kafka producer..")
 	logger.Log.Info("Kafka producer configuration: ", cfg)
 
@@ -16,7 +20,70 @@ func StartProducer(cfg *ProducerConfig) *kafka.Writer {
 		BatchBytes: cfg.BatchBytes,
 	})
 
+	// NewWriter treats zero as "all" so the required acks level has to be set on the writer
+	w.RequiredAcks = cfg.RequiredAcks
+
+	producer := &Producer{Writer: w}
+
+	w.Completion = writeCompletionHandler(cfg.LogWriteOutcomes, producer.recordProduced)
+
 	logger.Log.Info("Producing messages to topic: ", cfg.Topic)
 
-	return w
+	return producer
+}
+
+// writeCompletionHandler returns the completion function that records where the
+// messages were written to.  The outcome of each write is logged at info level
+// when logOutcomes is enabled and at debug level otherwise.  The latency is
+// measured from the message's time, which the AsyncWriter sets when the message is
+// buffered.  The latency is not recorded for the messages that were written without
+// a time.  recordProduced is called for each message that was written.
+func writeCompletionHandler(logOutcomes bool, recordProduced func()) func([]kafka.Message, error) {
+	return func(messages []kafka.Message, err error) {
+		for _, msg := range messages {
+			if err != nil {
+				metrics.kafkaWriteFailureCounter.WithLabelValues(msg.Topic).Inc()
+				continue
+			}
+
+			recordProduced()
+
+			metrics.kafkaWriteSuccessCounter.WithLabelValues(msg.Topic).Inc()
+
+			logger := logger.Log.WithFields(logrus.Fields{
+				"topic":     msg.Topic,
+				"partition": msg.Partition,
+				"offset":    msg.Offset,
+			})
+
+			if msg.Time.IsZero() == false {
+				latency := time.Since(msg.Time)
+				metrics.kafkaWriteLatency.WithLabelValues(msg.Topic).Observe(latency.Seconds())
+				logger = logger.WithFields(logrus.Fields{"latency": latency})
+			}
+
+			if logOutcomes {
+				logger.Info("Wrote message to kafka")
+			} else {
+				logger.Debug("Wrote message to kafka")
+			}
+		}
+	}
+}
+
+var ErrInvalidRequiredAcks = errors.New("Invalid required acks level")
+
+// ParseRequiredAcks maps the required acks level (none, one or all) to the
+// corresponding kafka.RequiredAcks value
+func ParseRequiredAcks(requiredAcks string) (kafka.RequiredAcks, error) {
+	switch requiredAcks {
+	case "none":
+		return kafka.RequireNone, nil
+	case "one":
+		return kafka.RequireOne, nil
+	case "all":
+		return kafka.RequireAll, nil
+	default:
+		return kafka.RequireAll, ErrInvalidRequiredAcks
+	}
 }
@@ -0,0 +1,114 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestParseRequiredAcks(t *testing.T) {
+	var tests = []struct {
+		requiredAcks string
+		expected     kafka.RequiredAcks
+	}{
+		{"none", kafka.RequireNone},
+		{"one", kafka.RequireOne},
+		{"all", kafka.RequireAll},
+	}
+
+	for _, tc := range tests {
+		actual, err := ParseRequiredAcks(tc.requiredAcks)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing required acks level %s: %s", tc.requiredAcks, err)
+		}
+
+		if actual != tc.expected {
+			t.Fatalf("Expected required acks level %s to map to %d, but got %d", tc.requiredAcks, tc.expected, actual)
+		}
+	}
+}
+
+func TestParseInvalidRequiredAcks(t *testing.T) {
+	for _, requiredAcks := range []string{"", "ALL", "2"} {
+		if _, err := ParseRequiredAcks(requiredAcks); err != ErrInvalidRequiredAcks {
+			t.Fatalf("Expected required acks level %q to be rejected, got %v", requiredAcks, err)
+		}
+	}
+}
+
+func TestStartProducerRequiredAcks(t *testing.T) {
+	w := StartProducer(&ProducerConfig{Brokers: []string{"localhost:9092"}, Topic: "test", RequiredAcks: kafka.RequireNone})
+	defer w.Close()
+
+	if w.RequiredAcks != kafka.RequireNone {
+		t.Fatalf("Expected the writer to use required acks level none, but got %s", w.RequiredAcks)
+	}
+}
+
+func TestWriteCompletionHandlerLogsWriteLocation(t *testing.T) {
+	hook := test.NewLocal(logger.Log)
+	defer hook.Reset()
+
+	successesBefore := testutil.ToFloat64(metrics.kafkaWriteSuccessCounter.WithLabelValues("test-topic"))
+
+	completion := writeCompletionHandler(true, func() {})
+	completion([]kafka.Message{{Topic: "test-topic", Partition: 2, Offset: 42, Time: time.Now().Add(-time.Second)}}, nil)
+
+	entry := hook.LastEntry()
+	if entry == nil || entry.Message != "Wrote message to kafka" {
+		t.Fatalf("Expected the write to be logged, got %v", entry)
+	}
+
+	if entry.Data["topic"] != "test-topic" || entry.Data["partition"] != 2 || entry.Data["offset"] != int64(42) {
+		t.Fatalf("Expected the write location to be logged, got %v", entry.Data)
+	}
+
+	if latency, ok := entry.Data["latency"].(time.Duration); ok == false || latency < time.Second {
+		t.Fatalf("Expected the write latency to be logged, got %v", entry.Data["latency"])
+	}
+
+	if delta := testutil.ToFloat64(metrics.kafkaWriteSuccessCounter.WithLabelValues("test-topic")) - successesBefore; delta != 1 {
+		t.Fatalf("Expected the successful write to be counted once, got %v", delta)
+	}
+}
+
+func TestWriteCompletionHandlerWithoutMessageTime(t *testing.T) {
+	hook := test.NewLocal(logger.Log)
+	defer hook.Reset()
+
+	completion := writeCompletionHandler(true, func() {})
+	completion([]kafka.Message{{Topic: "test-topic", Partition: 2, Offset: 42}}, nil)
+
+	entry := hook.LastEntry()
+	if entry == nil || entry.Message != "Wrote message to kafka" {
+		t.Fatalf("Expected the write to be logged, got %v", entry)
+	}
+
+	if _, found := entry.Data["latency"]; found {
+		t.Fatalf("Expected no latency to be logged for a message without a time, got %v", entry.Data["latency"])
+	}
+}
+
+func TestWriteCompletionHandlerCountsFailures(t *testing.T) {
+	hook := test.NewLocal(logger.Log)
+	defer hook.Reset()
+
+	failuresBefore := testutil.ToFloat64(metrics.kafkaWriteFailureCounter.WithLabelValues("test-topic"))
+
+	completion := writeCompletionHandler(true, func() {})
+	completion([]kafka.Message{{Topic: "test-topic"}, {Topic: "test-topic"}}, errors.New("leader not available"))
+
+	if len(hook.AllEntries()) != 0 {
+		t.Fatalf("Expected failed writes to not be logged as successful, got %v", hook.AllEntries())
+	}
+
+	if delta := testutil.ToFloat64(metrics.kafkaWriteFailureCounter.WithLabelValues("test-topic")) - failuresBefore; delta != 2 {
+		t.Fatalf("Expected both failed writes to be counted, got %v", delta)
+	}
+}
@@ -0,0 +1,32 @@
+package queue
+
+import (
+	"errors"
+	"sync/atomic"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+var ErrNothingProduced = errors.New("No messages have been produced to kafka")
+
+// Producer is a kafka writer that keeps track of whether it has successfully written
+// a message so that it can back a readiness check
+type Producer struct {
+	*kafka.Writer
+
+	// produced is set once the producer has successfully written a message
+	produced int32
+}
+
+func (p *Producer) recordProduced() {
+	atomic.StoreInt32(&p.produced, 1)
+}
+
+// CheckProduced returns ErrNothingProduced until the producer has successfully written
+// a message to kafka
+func (p *Producer) CheckProduced() error {
+	if atomic.LoadInt32(&p.produced) == 0 {
+		return ErrNothingProduced
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+func TestCheckProduced(t *testing.T) {
+	producer := StartProducer(&ProducerConfig{Brokers: []string{"localhost:9092"}, Topic: "test"})
+	defer producer.Close()
+
+	producer.Completion([]kafka.Message{{Topic: "test"}}, errors.New("write failed"))
+
+	if err := producer.CheckProduced(); err != ErrNothingProduced {
+		t.Fatalf("Expected %v after a failed write, got %v", ErrNothingProduced, err)
+	}
+
+	producer.Completion([]kafka.Message{{Topic: "test"}}, nil)
+
+	if err := producer.CheckProduced(); err != nil {
+		t.Fatalf("Expected no error after a successful write, got %v", err)
+	}
+
+	// Each producer keeps track of its own writes
+	other := StartProducer(&ProducerConfig{Brokers: []string{"localhost:9092"}, Topic: "other"})
+	defer other.Close()
+
+	if err := other.CheckProduced(); err != ErrNothingProduced {
+		t.Fatalf("Expected %v for a producer that has not written anything, got %v", ErrNothingProduced, err)
+	}
+}
@@ -0,0 +1,206 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+)
+
+// RetryQueue holds on to the messages that could not be written to kafka and
+// retries writing them in the background.  The delay between attempts doubles
+// after each failure, up to maxBackoff, and is reset once a write succeeds.  The
+// queue is bounded.  Once it is full, the oldest messages are dropped to make
+// room for the new ones.
+//
+// When the writer reports which messages failed (kafka.WriteErrors), only the
+// failed messages are queued again.  Stop makes a final attempt to write the
+// messages that are still queued.
+type RetryQueue struct {
+	writer         Writer
+	maxSize        int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	messages       []kafka.Message
+	wake           chan struct{}
+	done           chan struct{}
+	wg             sync.WaitGroup
+	sync.Mutex
+}
+
+func NewRetryQueue(writer Writer, maxSize int, initialBackoff time.Duration, maxBackoff time.Duration) *RetryQueue {
+	if maxSize < 1 {
+		maxSize = 1
+	}
+
+	if maxBackoff < initialBackoff {
+		maxBackoff = initialBackoff
+	}
+
+	return &RetryQueue{
+		writer:         writer,
+		maxSize:        maxSize,
+		initialBackoff: initialBackoff,
+		maxBackoff:     maxBackoff,
+		wake:           make(chan struct{}, 1),
+		done:           make(chan struct{}),
+	}
+}
+
+func (rq *RetryQueue) Start() {
+	rq.wg.Add(1)
+	go rq.retry()
+}
+
+// retryQueueFlushTimeout bounds the final write attempt made by Stop
+const retryQueueFlushTimeout = 10 * time.Second
+
+// Stop stops retrying and flushes the queue.  The messages that still cannot be
+// written are lost.
+func (rq *RetryQueue) Stop() {
+	close(rq.done)
+	rq.wg.Wait()
+
+	rq.flush()
+
+	if remaining := rq.Len(); remaining > 0 {
+		logger.Log.WithFields(logrus.Fields{"messages": remaining}).Warn("Discarding messages that could not be written to kafka")
+	}
+}
+
+func (rq *RetryQueue) Len() int {
+	rq.Lock()
+	defer rq.Unlock()
+
+	return len(rq.messages)
+}
+
+// FailureHandler returns a WriteFailureHandler that queues the messages to be retried
+func (rq *RetryQueue) FailureHandler() WriteFailureHandler {
+	return func(messages []kafka.Message, err error) {
+		logger.Log.WithFields(logrus.Fields{"error": err, "messages": len(messages)}).Warn("Unable to write messages to kafka, queueing them to be retried")
+		rq.add(failedMessages(messages, err), false)
+	}
+}
+
+// failedMessages returns the messages that were not written.  All of the messages
+// are considered to have failed unless the error identifies the failed ones.
+func failedMessages(messages []kafka.Message, err error) []kafka.Message {
+	writeErrors, ok := err.(kafka.WriteErrors)
+	if ok == false || len(writeErrors) != len(messages) {
+		return messages
+	}
+
+	failed := make([]kafka.Message, 0, writeErrors.Count())
+	for i, writeError := range writeErrors {
+		if writeError != nil {
+			failed = append(failed, messages[i])
+		}
+	}
+
+	return failed
+}
+
+// flush makes a final attempt to write the queued messages
+func (rq *RetryQueue) flush() {
+	messages := rq.take()
+	if len(messages) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), retryQueueFlushTimeout)
+	defer cancel()
+
+	if err := rq.writer.WriteMessages(ctx, messages...); err != nil {
+		logger.Log.WithFields(logrus.Fields{"error": err, "messages": len(messages)}).Warn("Unable to flush the kafka retry queue")
+		rq.add(failedMessages(messages, err), true)
+		return
+	}
+
+	logger.Log.WithFields(logrus.Fields{"messages": len(messages)}).Info("Flushed queued messages to kafka")
+}
+
+// add queues the messages.  Messages that are being requeued after a failed retry
+// are put back at the front of the queue in order to preserve their order.
+func (rq *RetryQueue) add(messages []kafka.Message, requeue bool) {
+	if len(messages) == 0 {
+		return
+	}
+
+	rq.Lock()
+	defer rq.Unlock()
+
+	before := len(rq.messages)
+
+	if requeue {
+		rq.messages = append(append([]kafka.Message{}, messages...), rq.messages...)
+	} else {
+		rq.messages = append(rq.messages, messages...)
+	}
+
+	if overflow := len(rq.messages) - rq.maxSize; overflow > 0 {
+		logger.Log.WithFields(logrus.Fields{"messages": overflow}).Error("Kafka retry queue is full, dropping the oldest messages")
+		metrics.retryQueueDroppedMessageCounter.Add(float64(overflow))
+		rq.messages = rq.messages[overflow:]
+	}
+
+	metrics.retryQueueDepthGauge.Add(float64(len(rq.messages) - before))
+
+	select {
+	case rq.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (rq *RetryQueue) take() []kafka.Message {
+	rq.Lock()
+	defer rq.Unlock()
+
+	messages := rq.messages
+	rq.messages = nil
+
+	metrics.retryQueueDepthGauge.Sub(float64(len(messages)))
+
+	return messages
+}
+
+func (rq *RetryQueue) retry() {
+	defer rq.wg.Done()
+
+	backoff := rq.initialBackoff
+
+	for {
+		select {
+		case <-rq.wake:
+		case <-rq.done:
+			return
+		}
+
+		for rq.Len() > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-rq.done:
+				return
+			}
+
+			messages := rq.take()
+
+			if err := rq.writer.WriteMessages(context.Background(), messages...); err != nil {
+				logger.Log.WithFields(logrus.Fields{"error": err, "messages": len(messages), "backoff": backoff}).Warn("Retrying the kafka write failed")
+				rq.add(failedMessages(messages, err), true)
+
+				backoff *= 2
+				if backoff > rq.maxBackoff {
+					backoff = rq.maxBackoff
+				}
+				continue
+			}
+
+			logger.Log.WithFields(logrus.Fields{"messages": len(messages)}).Info("Wrote queued messages to kafka")
+			backoff = rq.initialBackoff
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// flakyWriter fails the configured number of writes and records the messages that
+// are written after that
+type flakyWriter struct {
+	failures int
+	attempts int
+	written  []kafka.Message
+	sync.Mutex
+}
+
+func (fw *flakyWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	fw.Lock()
+	defer fw.Unlock()
+
+	fw.attempts++
+	if fw.attempts <= fw.failures {
+		return errors.New("kafka is down")
+	}
+
+	fw.written = append(fw.written, msgs...)
+	return nil
+}
+
+func (fw *flakyWriter) writtenValues() []string {
+	fw.Lock()
+	defer fw.Unlock()
+
+	values := make([]string, 0, len(fw.written))
+	for _, msg := range fw.written {
+		values = append(values, string(msg.Value))
+	}
+	return values
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for condition() == false {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRetryQueueRetriesFailedWrites(t *testing.T) {
+	fw := &flakyWriter{failures: 2}
+
+	rq := NewRetryQueue(fw, 10, time.Millisecond, 4*time.Millisecond)
+	rq.Start()
+	defer rq.Stop()
+
+	onFailure := rq.FailureHandler()
+	onFailure([]kafka.Message{{Value: []byte("1")}, {Value: []byte("2")}}, errors.New("kafka is down"))
+
+	waitFor(t, func() bool { return len(fw.writtenValues()) == 2 })
+
+	if values := fw.writtenValues(); values[0] != "1" || values[1] != "2" {
+		t.Fatalf("Expected the messages to be written in order, but got %v", values)
+	}
+
+	if rq.Len() != 0 {
+		t.Fatalf("Expected the queue to be empty, but it holds %d messages", rq.Len())
+	}
+}
+
+func TestRetryQueueDropsOldestMessagesWhenFull(t *testing.T) {
+	fw := &flakyWriter{}
+
+	// The queue is not started so that the messages stay queued
+	rq := NewRetryQueue(fw, 2, time.Millisecond, time.Millisecond)
+
+	depth := testutil.ToFloat64(metrics.retryQueueDepthGauge)
+	dropped := testutil.ToFloat64(metrics.retryQueueDroppedMessageCounter)
+
+	rq.FailureHandler()([]kafka.Message{{Value: []byte("1")}, {Value: []byte("2")}, {Value: []byte("3")}}, errors.New("kafka is down"))
+
+	if rq.Len() != 2 {
+		t.Fatalf("Expected the queue to hold 2 messages, but it holds %d", rq.Len())
+	}
+
+	if delta := testutil.ToFloat64(metrics.retryQueueDroppedMessageCounter) - dropped; delta != 1 {
+		t.Fatalf("Expected 1 message to be dropped, but got %v", delta)
+	}
+
+	if delta := testutil.ToFloat64(metrics.retryQueueDepthGauge) - depth; delta != 2 {
+		t.Fatalf("Expected the queue depth to increase by 2, but got %v", delta)
+	}
+
+	rq.Start()
+	waitFor(t, func() bool { return len(fw.writtenValues()) == 2 })
+	rq.Stop()
+
+	if values := fw.writtenValues(); values[0] != "2" || values[1] != "3" {
+		t.Fatalf("Expected the oldest message to be dropped, but got %v", values)
+	}
+
+	if delta := testutil.ToFloat64(metrics.retryQueueDepthGauge) - depth; delta != 0 {
+		t.Fatalf("Expected the queue depth to return to %v, but got a delta of %v", depth, delta)
+	}
+}
+
+func TestAsyncWriterQueuesFailedWritesForRetry(t *testing.T) {
+	fw := &flakyWriter{failures: 1}
+
+	rq := NewRetryQueue(fw, 10, time.Millisecond, time.Millisecond)
+	rq.Start()
+	defer rq.Stop()
+
+	aw := NewAsyncWriter(fw, 1, 10, 1, rq.FailureHandler())
+
+	if err := aw.WriteMessages(context.TODO(), kafka.Message{Value: []byte("1")}); err != nil {
+		t.Fatalf("Unexpected error buffering the message: %s", err)
+	}
+	aw.Close()
+
+	waitFor(t, func() bool { return len(fw.writtenValues()) == 1 })
+}
+
+func TestRetryQueueOnlyRequeuesFailedMessages(t *testing.T) {
+	fw := &flakyWriter{}
+
+	// The queue is not started so that the messages stay queued
+	rq := NewRetryQueue(fw, 10, time.Hour, time.Hour)
+
+	messages := []kafka.Message{{Value: []byte("1")}, {Value: []byte("2")}, {Value: []byte("3")}}
+	rq.FailureHandler()(messages, kafka.WriteErrors{nil, errors.New("partition leader is unavailable"), nil})
+
+	if rq.Len() != 1 {
+		t.Fatalf("Expected the queue to hold 1 message, but it holds %d", rq.Len())
+	}
+
+	rq.Stop()
+
+	if values := fw.writtenValues(); len(values) != 1 || values[0] != "2" {
+		t.Fatalf("Expected only the failed message to be retried, but got %v", values)
+	}
+}
+
+func TestRetryQueueFlushesOnStop(t *testing.T) {
+	fw := &flakyWriter{}
+
+	// The queue is not started so that the messages are only written by the flush
+	rq := NewRetryQueue(fw, 10, time.Hour, time.Hour)
+
+	rq.FailureHandler()([]kafka.Message{{Value: []byte("1")}, {Value: []byte("2")}}, errors.New("kafka is down"))
+
+	rq.Stop()
+
+	if values := fw.writtenValues(); len(values) != 2 || values[0] != "1" || values[1] != "2" {
+		t.Fatalf("Expected the queued messages to be flushed, but got %v", values)
+	}
+
+	if rq.Len() != 0 {
+		t.Fatalf("Expected the queue to be empty, but it holds %d messages", rq.Len())
+	}
+}
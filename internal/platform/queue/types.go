@@ -1,10 +1,16 @@
 package queue
 
+import (
+	kafka "github.com/segmentio/kafka-go"
+)
+
 type ProducerConfig struct {
-	Brokers    []string
-	Topic      string
-	BatchSize  int
-	BatchBytes int
+	Brokers          []string
+	Topic            string
+	BatchSize        int
+	BatchBytes       int
+	RequiredAcks     kafka.RequiredAcks
+	LogWriteOutcomes bool
 }
 
 type ConsumerConfig struct {
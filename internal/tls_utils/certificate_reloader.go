@@ -0,0 +1,107 @@
+package tls_utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+// certificateReloader serves the client certificate from the cert and key files.  The
+// files are reloaded when their modification times change so that a rotated certificate
+// is picked up by the next TLS handshake without restarting.
+type certificateReloader struct {
+	certFilePath string
+	keyFilePath  string
+	certModTime  time.Time
+	keyModTime   time.Time
+	cert         *tls.Certificate
+	sync.Mutex
+}
+
+func newCertificateReloader(certFilePath string, keyFilePath string) (*certificateReloader, error) {
+	cr := &certificateReloader{
+		certFilePath: certFilePath,
+		keyFilePath:  keyFilePath,
+	}
+
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+
+	return cr, nil
+}
+
+// GetClientCertificate returns the cached certificate, reloading it first if either file
+// has changed.  If the reload fails (the files are in the middle of being replaced, for
+// example) the previous certificate is returned and the reload is attempted again on the
+// next handshake.
+func (cr *certificateReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cr.Lock()
+	defer cr.Unlock()
+
+	if cr.filesChanged() {
+		if err := cr.reload(); err != nil {
+			logger.Log.WithFields(logrus.Fields{"cert_file": cr.certFilePath, "key_file": cr.keyFilePath, "error": err}).Warn("Unable to reload the client certificate, using the previous certificate")
+		}
+	}
+
+	return cr.cert, nil
+}
+
+func (cr *certificateReloader) filesChanged() bool {
+	certModTime, keyModTime, err := cr.modTimes()
+	if err != nil {
+		return false
+	}
+
+	return certModTime.Equal(cr.certModTime) == false || keyModTime.Equal(cr.keyModTime) == false
+}
+
+func (cr *certificateReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(cr.certFilePath)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	keyInfo, err := os.Stat(cr.keyFilePath)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+func (cr *certificateReloader) reload() error {
+	// Read the modification times first so that a change made while loading is
+	// noticed on the next handshake
+	certModTime, keyModTime, err := cr.modTimes()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.certFilePath, cr.keyFilePath)
+	if err != nil {
+		return err
+	}
+
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+
+	if cr.cert != nil {
+		logger.Log.WithFields(logrus.Fields{"cert_file": cr.certFilePath, "subject": cert.Leaf.Subject.String()}).Info("Reloaded the client certificate")
+	}
+
+	cr.cert = &cert
+	cr.certModTime = certModTime
+	cr.keyModTime = keyModTime
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package tls_utils
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+type TlsConfigFunc func(*tls.Config) error
+
+func NewTlsConfig(certFilePath string, keyFilePath string, configFuncs ...TlsConfigFunc) (*tls.Config, error) {
+	// Import trusted certificates from CAfile.pem.
+	// Alternatively, manually add CA certificates to
+	// default openssl CA bundle.
+	/*
+	   certpool := x509.NewCertPool()
+	   pemCerts, err := ioutil.ReadFile("samplecerts/CAfile.pem")
+	   if err == nil {
+	       certpool.AppendCertsFromPEM(pemCerts)
+	   }
+	*/
+
+	// Import client certificate/key pair.  The pair is reloaded when the files
+	// change so that the certificate can be rotated without a restart.
+	certReloader, err := newCertificateReloader(certFilePath, keyFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create tls.Config with desired tls properties
+	tlsConfig := &tls.Config{
+		// RootCAs = certs used to verify server cert.
+		//RootCAs: certpool,
+		// ClientAuth = whether to request cert from server.
+		// Since the server is set up for SSL, this happens
+		// anyways.
+		//ClientAuth: tls.NoClientCert,
+		// ClientCAs = certs used to validate client cert.
+		//ClientCAs: nil,
+		// InsecureSkipVerify = verify that cert contents
+		// match server. IP matches what is in cert etc.
+		InsecureSkipVerify: true,
+		// GetClientCertificate = returns the cert client sends to server.
+		GetClientCertificate: certReloader.GetClientCertificate,
+	}
+
+	for _, configFunc := range configFuncs {
+		if err := configFunc(tlsConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// WithClientSessionCache enables TLS session resumption using an LRU cache of the
+// given size.  A size of 0 leaves session resumption disabled (Go's default behavior).
+func WithClientSessionCache(size int) TlsConfigFunc {
+	return func(tlsConfig *tls.Config) error {
+		if size < 0 {
+			return fmt.Errorf("invalid tls client session cache size: %d", size)
+		}
+
+		if size > 0 {
+			tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(size)
+		}
+
+		return nil
+	}
+}
+
+func WithSessionTicketsDisabled(disabled bool) TlsConfigFunc {
+	return func(tlsConfig *tls.Config) error {
+		tlsConfig.SessionTicketsDisabled = disabled
+		return nil
+	}
+}
+
+// WithRenegotiation sets the renegotiation support.  The supported values
+// are "never" (Go's default behavior), "once" and "freely".
+func WithRenegotiation(renegotiation string) TlsConfigFunc {
+	return func(tlsConfig *tls.Config) error {
+		renegotiationSupport, err := parseRenegotiationSupport(renegotiation)
+		if err != nil {
+			return err
+		}
+
+		tlsConfig.Renegotiation = renegotiationSupport
+
+		return nil
+	}
+}
+
+func parseRenegotiationSupport(renegotiation string) (tls.RenegotiationSupport, error) {
+	switch renegotiation {
+	case "never", "":
+		return tls.RenegotiateNever, nil
+	case "once":
+		return tls.RenegotiateOnceAsClient, nil
+	case "freely":
+		return tls.RenegotiateFreelyAsClient, nil
+	default:
+		return tls.RenegotiateNever, fmt.Errorf("invalid tls renegotiation setting: %s", renegotiation)
+	}
+}
@@ -0,0 +1,195 @@
+package tls_utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/cloud-connector/internal/platform/logger"
+)
+
+func init() {
+	logger.InitLogger()
+}
+
+func writeTestCertificate(t *testing.T) (string, string, string) {
+	dir, err := ioutil.TempDir("", "tls_utils")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	writeCertificateFiles(t, certFile, keyFile, "test-client")
+
+	return dir, certFile, keyFile
+}
+
+func writeCertificateFiles(t *testing.T, certFile string, keyFile string, commonName string) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate private key: %s", err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		t.Fatalf("Unable to create certificate: %s", err)
+	}
+
+	keyBytes, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("Unable to marshal private key: %s", err)
+	}
+
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600)
+}
+
+func TestNewTlsConfigDefaults(t *testing.T) {
+	dir, certFile, keyFile := writeTestCertificate(t)
+	defer os.RemoveAll(dir)
+
+	tlsConfig, err := NewTlsConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Unexpected error creating tls config: %s", err)
+	}
+
+	if tlsConfig.ClientSessionCache != nil {
+		t.Fatalf("Expected the client session cache to not be set by default")
+	}
+
+	if tlsConfig.Renegotiation != tls.RenegotiateNever {
+		t.Fatalf("Expected renegotiation to be disabled by default")
+	}
+}
+
+func TestNewTlsConfigWithClientSessionCache(t *testing.T) {
+	dir, certFile, keyFile := writeTestCertificate(t)
+	defer os.RemoveAll(dir)
+
+	tlsConfig, err := NewTlsConfig(certFile, keyFile, WithClientSessionCache(64))
+	if err != nil {
+		t.Fatalf("Unexpected error creating tls config: %s", err)
+	}
+
+	if tlsConfig.ClientSessionCache == nil {
+		t.Fatalf("Expected the client session cache to be set")
+	}
+}
+
+func TestNewTlsConfigWithInvalidClientSessionCacheSize(t *testing.T) {
+	dir, certFile, keyFile := writeTestCertificate(t)
+	defer os.RemoveAll(dir)
+
+	_, err := NewTlsConfig(certFile, keyFile, WithClientSessionCache(-1))
+	if err == nil {
+		t.Fatalf("Expected an error for an invalid client session cache size")
+	}
+}
+
+func TestNewTlsConfigWithRenegotiation(t *testing.T) {
+	dir, certFile, keyFile := writeTestCertificate(t)
+	defer os.RemoveAll(dir)
+
+	var tests = []struct {
+		renegotiation string
+		expected      tls.RenegotiationSupport
+		expectError   bool
+	}{
+		{"never", tls.RenegotiateNever, false},
+		{"once", tls.RenegotiateOnceAsClient, false},
+		{"freely", tls.RenegotiateFreelyAsClient, false},
+		{"sometimes", tls.RenegotiateNever, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.renegotiation, func(t *testing.T) {
+			tlsConfig, err := NewTlsConfig(certFile, keyFile, WithRenegotiation(tc.renegotiation))
+			if tc.expectError {
+				if err == nil {
+					t.Fatalf("Expected an error for an invalid renegotiation setting")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error creating tls config: %s", err)
+			}
+
+			if tlsConfig.Renegotiation != tc.expected {
+				t.Fatalf("Expected renegotiation setting %d, but got %d", tc.expected, tlsConfig.Renegotiation)
+			}
+		})
+	}
+}
+
+func servedCommonName(t *testing.T, tlsConfig *tls.Config) string {
+	cert, err := tlsConfig.GetClientCertificate(&tls.CertificateRequestInfo{})
+	if err != nil {
+		t.Fatalf("Unexpected error getting the client certificate: %s", err)
+	}
+
+	return cert.Leaf.Subject.CommonName
+}
+
+func TestNewTlsConfigReloadsRotatedCertificate(t *testing.T) {
+	dir, certFile, keyFile := writeTestCertificate(t)
+	defer os.RemoveAll(dir)
+
+	tlsConfig, err := NewTlsConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Unexpected error creating tls config: %s", err)
+	}
+
+	if commonName := servedCommonName(t, tlsConfig); commonName != "test-client" {
+		t.Fatalf("Expected the original certificate to be served, got %s", commonName)
+	}
+
+	writeCertificateFiles(t, certFile, keyFile, "rotated-client")
+
+	// Make sure the modification times change even on filesystems with a coarse resolution
+	rotatedAt := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, rotatedAt, rotatedAt)
+	os.Chtimes(keyFile, rotatedAt, rotatedAt)
+
+	if commonName := servedCommonName(t, tlsConfig); commonName != "rotated-client" {
+		t.Fatalf("Expected the rotated certificate to be served, got %s", commonName)
+	}
+}
+
+func TestNewTlsConfigKeepsCertificateWhenReloadFails(t *testing.T) {
+	dir, certFile, keyFile := writeTestCertificate(t)
+	defer os.RemoveAll(dir)
+
+	tlsConfig, err := NewTlsConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Unexpected error creating tls config: %s", err)
+	}
+
+	// Simulate the certificate being replaced before the key
+	ioutil.WriteFile(certFile, []byte("not a certificate"), 0600)
+	rotatedAt := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, rotatedAt, rotatedAt)
+
+	if commonName := servedCommonName(t, tlsConfig); commonName != "test-client" {
+		t.Fatalf("Expected the previous certificate to be served, got %s", commonName)
+	}
+}